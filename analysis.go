@@ -0,0 +1,123 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scriggo
+
+import (
+	"io/fs"
+
+	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/internal/compiler"
+)
+
+// Analysis is the result of the analysis of a template file or of the main
+// package of a program. It describes the names and the expressions in the
+// source, and locates their declarations. It is intended for tools, as
+// editors and language servers.
+type Analysis struct {
+	a *compiler.Analysis
+}
+
+// Location is the location of a declaration or of a file.
+type Location struct {
+
+	// Path is the path of the file. If Native is true, it is the path of the
+	// Go source file, in the environment in which the application has been
+	// built, that contains the declaration.
+	Path string
+
+	// Native reports whether the declaration is a native declaration.
+	Native bool
+
+	// Position is the position of the declaration in the file. For a file,
+	// and for native declarations, only Line and Column are significant.
+	Position Position
+}
+
+// AnalyzeTemplate analyzes the named template file rooted at the given file
+// system. It parses and type checks the file, and the files it extends,
+// imports and renders, as BuildTemplate does, but it does not build it.
+//
+// If a syntax error occurs, it returns a nil analysis and a *BuildError or a
+// BuildErrors value. If a type checking error occurs, it returns the analysis
+// of the code checked before the error, and a *BuildError or a BuildErrors
+// value.
+func AnalyzeTemplate(fsys fs.FS, name string, options *BuildOptions) (*Analysis, error) {
+	if f, ok := fsys.(FormatFS); ok {
+		fsys = formatFS{f}
+	}
+	co := compiler.Options{
+		FormatTypes: formatTypes,
+		MaxErrors:   options.maxErrors(),
+	}
+	if options != nil {
+		co.Globals = options.Globals
+		co.AllowGoStmt = options.AllowGoStmt
+		co.NoParseShortShowStmt = options.NoParseShortShowStmt
+		co.Importer = options.Packages
+		co.MDConverter = compiler.Converter(options.MarkdownConverter)
+	}
+	a, err := compiler.AnalyzeTemplate(fsys, name, co)
+	return newAnalysis(a, err)
+}
+
+// AnalyzeProgram analyzes the program in the root of fsys. It parses and
+// type checks the program, as Build does, but it does not build it, and
+// returns the analysis of the main package, whose path is "main".
+//
+// If a syntax error occurs, it returns a nil analysis and a *BuildError or a
+// BuildErrors value. If a type checking error occurs, it returns the analysis
+// of the code checked before the error, and a *BuildError or a BuildErrors
+// value.
+func AnalyzeProgram(fsys fs.FS, options *BuildOptions) (*Analysis, error) {
+	co := compiler.Options{
+		MaxErrors: options.maxErrors(),
+	}
+	if options != nil {
+		co.AllowGoStmt = options.AllowGoStmt
+		co.Importer = options.Packages
+	}
+	a, err := compiler.AnalyzeProgram(fsys, co)
+	return newAnalysis(a, err)
+}
+
+// newAnalysis returns the analysis and the error returned by the compiler.
+func newAnalysis(a *compiler.Analysis, err error) (*Analysis, error) {
+	err = buildError(err)
+	if a == nil {
+		return nil, err
+	}
+	return &Analysis{a: a}, err
+}
+
+// Path returns the path of the analyzed file.
+func (a *Analysis) Path() string {
+	return a.a.Path()
+}
+
+// Describe returns a description of the name or expression, in the analyzed
+// file, that contains the byte at the given offset, and its position. For
+// example, for a variable it returns "var a int". If there is no such name
+// or expression, it returns false.
+func (a *Analysis) Describe(offset int) (string, Position, bool) {
+	s, pos, ok := a.a.Describe(offset)
+	return s, position(pos), ok
+}
+
+// Definition returns the location of the declaration of the name, in the
+// analyzed file, that contains the byte at the given offset. If the offset
+// is in an extends, import or render, it returns the location of the
+// referred file. If there is no such name or file, it returns false.
+func (a *Analysis) Definition(offset int) (Location, bool) {
+	loc, ok := a.a.Definition(offset)
+	if !ok {
+		return Location{}, false
+	}
+	return Location{Path: loc.Path, Native: loc.Native, Position: position(loc.Position)}, true
+}
+
+// position returns the Position corresponding to pos.
+func position(pos ast.Position) Position {
+	return Position{Line: pos.Line, Column: pos.Column, Start: pos.Start, End: pos.End}
+}
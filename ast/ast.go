@@ -78,6 +78,7 @@ const (
 	OperatorExtendedAnd                        // and
 	OperatorExtendedOr                         // or
 	OperatorExtendedNot                        // not
+	OperatorTilde                              // ~
 )
 
 // String returns the string representation of the operator type.
@@ -86,7 +87,7 @@ func (op OperatorType) String() string {
 	// compiler.internalOperatorNotZero.
 	return []string{"==", "!=", "<", "<=", ">", ">=", "!", "&", "|", "&&", "||",
 		"+", "-", "*", "/", "%", "^", "&^", "<<", ">>", "contains", "not contains",
-		"<-", "&", "*", "and", "or", "not", "", ""}[op]
+		"<-", "&", "*", "and", "or", "not", "~", "", ""}[op]
 }
 
 // AssignmentType represents a type of assignment.
@@ -595,7 +596,12 @@ func (n *ChanType) String() string {
 	return s + " " + n.ElementType.String()
 }
 
-// Comment node represents a comment statement in the form {# ... #}.
+// Comment node represents a comment statement in the form {# ... #}, or a
+// comment in the code, in the form // ... or /* ... */.
+//
+// Comment statements are nodes of the tree and their text does not include
+// {# and #}. Comments in the code are in the Comments field of the tree and
+// their text includes the delimiters.
 type Comment struct {
 	*Position        // position in the source.
 	Text      string // comment text.
@@ -811,17 +817,19 @@ func NewForRange(pos *Position, assignment *Assignment, body []Node, els *Block)
 type Func struct {
 	expression
 	*Position
-	Ident    *Identifier // name, nil for function literals.
-	Type     *FuncType   // type.
-	Body     *Block      // body.
-	DistFree bool        // reports whether it is distraction free.
-	Upvars   []Upvar     // Upvars of func.
-	Format   Format      // macro format.
+	Ident      *Identifier  // name, nil for function literals.
+	Recv       *Parameter   // receiver, nil for functions that are not methods.
+	TypeParams []*Parameter // type parameters, nil for non-generic functions.
+	Type       *FuncType    // type.
+	Body       *Block       // body.
+	DistFree   bool         // reports whether it is distraction free.
+	Upvars     []Upvar      // Upvars of func.
+	Format     Format       // macro format.
 }
 
 // NewFunc returns a new Func node.
 func NewFunc(pos *Position, name *Identifier, typ *FuncType, body *Block, distFree bool, format Format) *Func {
-	return &Func{expression{}, pos, name, typ, body, distFree, nil, format}
+	return &Func{expression{}, pos, name, nil, nil, typ, body, distFree, nil, format}
 }
 
 // String returns the string representation of n.
@@ -832,6 +840,9 @@ func (n *Func) String() string {
 	if n.Ident == nil {
 		return "func literal"
 	}
+	if n.Recv != nil {
+		return "method declaration"
+	}
 	return "func declaration"
 }
 
@@ -1003,20 +1014,62 @@ func (n *Index) String() string {
 	return n.Expr.String() + "[" + n.Index.String() + "]"
 }
 
+// IndexList node represents an instantiation of a generic function or type
+// with more than one type argument, as in F[int, string].
+type IndexList struct {
+	*expression
+	*Position              // position in the source.
+	Expr      Expression   // expression.
+	Indices   []Expression // type arguments.
+}
+
+// NewIndexList returns a new IndexList node.
+func NewIndexList(pos *Position, expr Expression, indices []Expression) *IndexList {
+	return &IndexList{&expression{}, pos, expr, indices}
+}
+
+// String returns the string representation of n.
+func (n *IndexList) String() string {
+	s := n.Expr.String() + "["
+	for i, index := range n.Indices {
+		if i > 0 {
+			s += ", "
+		}
+		s += index.String()
+	}
+	return s + "]"
+}
+
 // Interface node represents an interface type.
 type Interface struct {
 	*expression
-	*Position // position in the source.
+	*Position          // position in the source.
+	Methods   []*Field // methods and embedded interfaces. Embedded interfaces have nil Idents.
 }
 
 // NewInterface returns a new Interface node.
 func NewInterface(pos *Position) *Interface {
-	return &Interface{&expression{}, pos}
+	return &Interface{&expression{}, pos, nil}
 }
 
 // String returns the string representation of n.
 func (n *Interface) String() string {
-	return "interface{}"
+	if len(n.Methods) == 0 {
+		return "interface{}"
+	}
+	s := "interface { "
+	for i, m := range n.Methods {
+		if i > 0 {
+			s += "; "
+		}
+		if m.Idents == nil {
+			s += m.Type.String()
+		} else {
+			s += m.Idents[0].Name + strings.TrimPrefix(m.Type.String(), "func")
+		}
+	}
+	s += " }"
+	return s
 }
 
 // KeyValue represents a key value pair in a slice, map or struct composite literal.
@@ -1392,9 +1445,10 @@ func (n *Text) String() string {
 // Tree node represents a tree.
 type Tree struct {
 	*Position
-	Path   string // path of the tree.
-	Nodes  []Node // nodes of the first level of the tree.
-	Format Format // content format.
+	Path     string     // path of the tree.
+	Nodes    []Node     // nodes of the first level of the tree.
+	Format   Format     // content format.
+	Comments []*Comment // comments in the code, in source order.
 }
 
 // NewTree returns a new Tree node.
@@ -1435,15 +1489,16 @@ func (n *TypeAssertion) String() string {
 // TypeDeclaration node represents a type declaration, that is an alias
 // declaration or a type definition.
 type TypeDeclaration struct {
-	*Position                      // position in the source.
-	Ident              *Identifier // identifier of the type.
-	Type               Expression  // expression representing the type.
-	IsAliasDeclaration bool        // reports whether it is an alias declaration or a type definition.
+	*Position                       // position in the source.
+	Ident              *Identifier  // identifier of the type.
+	TypeParams         []*Parameter // type parameters, nil for non-generic types.
+	Type               Expression   // expression representing the type.
+	IsAliasDeclaration bool         // reports whether it is an alias declaration or a type definition.
 }
 
 // NewTypeDeclaration returns a new TypeDeclaration node.
 func NewTypeDeclaration(pos *Position, ident *Identifier, typ Expression, isAliasDeclaration bool) *TypeDeclaration {
-	return &TypeDeclaration{pos, ident, typ, isAliasDeclaration}
+	return &TypeDeclaration{pos, ident, nil, typ, isAliasDeclaration}
 }
 
 // String returns the string representation of n.
@@ -1451,9 +1506,25 @@ func (n *TypeDeclaration) String() string {
 	if n.IsAliasDeclaration {
 		return fmt.Sprintf("type %s = %s", n.Ident.Name, n.Type.String())
 	}
+	if n.TypeParams != nil {
+		return fmt.Sprintf("type %s[%s] %s", n.Ident.Name, parametersString(n.TypeParams), n.Type.String())
+	}
 	return fmt.Sprintf("type %s %s", n.Ident.Name, n.Type.String())
 }
 
+// parametersString returns the string representation of a list of
+// parameters separated by commas.
+func parametersString(params []*Parameter) string {
+	s := ""
+	for i, param := range params {
+		if i > 0 {
+			s += ", "
+		}
+		s += param.String()
+	}
+	return s
+}
+
 // TypeSwitch node represents a "switch" statement on types.
 type TypeSwitch struct {
 	*Position
@@ -25,9 +25,12 @@ func CloneNode(node ast.Node) ast.Node {
 		for i, v := range n.Lhs {
 			variables[i] = CloneExpression(v)
 		}
-		values := make([]ast.Expression, len(n.Rhs))
-		for i, v := range n.Rhs {
-			variables[i] = CloneExpression(v)
+		var values []ast.Expression
+		if n.Rhs != nil {
+			values = make([]ast.Expression, len(n.Rhs))
+			for i, v := range n.Rhs {
+				values[i] = CloneExpression(v)
+			}
 		}
 		return ast.NewAssignment(ClonePosition(n.Position), variables, n.Type, values)
 
@@ -42,7 +45,10 @@ func CloneNode(node ast.Node) ast.Node {
 		return ast.NewBlock(ClonePosition(n.Position), nodes)
 
 	case *ast.Break:
-		label := CloneExpression(n.Label).(*ast.Identifier)
+		var label *ast.Identifier
+		if n.Label != nil {
+			label = CloneExpression(n.Label).(*ast.Identifier)
+		}
 		return ast.NewBreak(ClonePosition(n.Position), label)
 
 	case *ast.Case:
@@ -78,7 +84,10 @@ func CloneNode(node ast.Node) ast.Node {
 		return ast.NewConst(ClonePosition(n.Position), idents, typ, values, n.Index)
 
 	case *ast.Continue:
-		label := CloneExpression(n.Label).(*ast.Identifier)
+		var label *ast.Identifier
+		if n.Label != nil {
+			label = CloneExpression(n.Label).(*ast.Identifier)
+		}
 		return ast.NewContinue(ClonePosition(n.Position), label)
 
 	case *ast.Defer:
@@ -142,7 +151,15 @@ func CloneNode(node ast.Node) ast.Node {
 			ident = ast.NewIdentifier(ClonePosition(n.Ident.Position), n.Ident.Name)
 		}
 		typ := CloneExpression(n.Type).(*ast.FuncType)
-		return ast.NewFunc(ClonePosition(n.Position), ident, typ, CloneNode(n.Body).(*ast.Block), n.DistFree, n.Format)
+		fn := ast.NewFunc(ClonePosition(n.Position), ident, typ, CloneNode(n.Body).(*ast.Block), n.DistFree, n.Format)
+		if n.Recv != nil {
+			var recv *ast.Identifier
+			if n.Recv.Ident != nil {
+				recv = ast.NewIdentifier(ClonePosition(n.Recv.Ident.Position), n.Recv.Ident.Name)
+			}
+			fn.Recv = ast.NewParameter(recv, CloneExpression(n.Recv.Type))
+		}
+		return fn
 
 	case *ast.Go:
 		return ast.NewGo(ClonePosition(n.Position), CloneExpression(n.Call))
@@ -196,6 +213,16 @@ func CloneNode(node ast.Node) ast.Node {
 	case *ast.Raw:
 		return ast.NewRaw(ClonePosition(n.Position), n.Marker, n.Tag, CloneNode(n.Text).(*ast.Text))
 
+	case *ast.Return:
+		var values []ast.Expression
+		if n.Values != nil {
+			values = make([]ast.Expression, len(n.Values))
+			for i, v := range n.Values {
+				values[i] = CloneExpression(v)
+			}
+		}
+		return ast.NewReturn(ClonePosition(n.Position), values)
+
 	case *ast.Select:
 		var text *ast.Text
 		if n.LeadingText != nil {
@@ -244,27 +271,6 @@ func CloneNode(node ast.Node) ast.Node {
 		}
 		return ast.NewStatements(ClonePosition(n.Position), nodes)
 
-	case *ast.StructType:
-		var fields []*ast.Field
-		if n.Fields != nil {
-			fields = make([]*ast.Field, len(n.Fields))
-			for i, field := range n.Fields {
-				var idents []*ast.Identifier
-				if field.Idents != nil {
-					idents = make([]*ast.Identifier, len(field.Idents))
-					for j, ident := range field.Idents {
-						idents[j] = CloneExpression(ident).(*ast.Identifier)
-					}
-				}
-				var typ ast.Expression
-				if field.Type != nil {
-					typ = CloneExpression(field.Type)
-				}
-				fields[i] = ast.NewField(idents, typ, field.Tag)
-			}
-		}
-		return ast.NewStructType(ClonePosition(n.Position), fields)
-
 	case *ast.Switch:
 		var init ast.Node
 		if n.Init != nil {
@@ -291,6 +297,12 @@ func CloneNode(node ast.Node) ast.Node {
 		}
 		return ast.NewText(ClonePosition(n.Position), text, n.Cut)
 
+	case *ast.TypeDeclaration:
+		ident := ast.NewIdentifier(ClonePosition(n.Ident.Position), n.Ident.Name)
+		td := ast.NewTypeDeclaration(ClonePosition(n.Position), ident, CloneExpression(n.Type), n.IsAliasDeclaration)
+		td.TypeParams = cloneParameters(n.TypeParams)
+		return td
+
 	case *ast.TypeSwitch:
 		var init ast.Node
 		if n.Init != nil {
@@ -318,7 +330,14 @@ func CloneNode(node ast.Node) ast.Node {
 		for _, n := range n.Nodes {
 			nn = append(nn, CloneNode(n))
 		}
-		return ast.NewTree(n.Path, nn, n.Format)
+		tree := ast.NewTree(n.Path, nn, n.Format)
+		if n.Comments != nil {
+			tree.Comments = make([]*ast.Comment, len(n.Comments))
+			for i, c := range n.Comments {
+				tree.Comments[i] = ast.NewComment(ClonePosition(c.Position), c.Text)
+			}
+		}
+		return tree
 
 	case *ast.URL:
 		var value = make([]ast.Node, len(n.Value))
@@ -400,7 +419,16 @@ func CloneExpression(expr ast.Expression) ast.Expression {
 			ident = ast.NewIdentifier(ClonePosition(e.Ident.Position), e.Ident.Name)
 		}
 		typ := CloneExpression(e.Type).(*ast.FuncType)
-		expr2 = ast.NewFunc(ClonePosition(e.Position), ident, typ, CloneNode(e.Body).(*ast.Block), false, e.Format)
+		fn := ast.NewFunc(ClonePosition(e.Position), ident, typ, CloneNode(e.Body).(*ast.Block), e.DistFree, e.Format)
+		if e.Recv != nil {
+			var recv *ast.Identifier
+			if e.Recv.Ident != nil {
+				recv = ast.NewIdentifier(ClonePosition(e.Recv.Ident.Position), e.Recv.Ident.Name)
+			}
+			fn.Recv = ast.NewParameter(recv, CloneExpression(e.Recv.Type))
+		}
+		fn.TypeParams = cloneParameters(e.TypeParams)
+		expr2 = fn
 
 	case *ast.FuncType:
 		var parameters []*ast.Parameter
@@ -433,8 +461,26 @@ func CloneExpression(expr ast.Expression) ast.Expression {
 	case *ast.Index:
 		expr2 = ast.NewIndex(ClonePosition(e.Position), CloneExpression(e.Expr), CloneExpression(e.Index))
 
+	case *ast.IndexList:
+		indices := make([]ast.Expression, len(e.Indices))
+		for i, index := range e.Indices {
+			indices[i] = CloneExpression(index)
+		}
+		expr2 = ast.NewIndexList(ClonePosition(e.Position), CloneExpression(e.Expr), indices)
+
 	case *ast.Interface:
-		expr2 = ast.NewInterface(ClonePosition(e.Pos()))
+		n := ast.NewInterface(ClonePosition(e.Pos()))
+		if e.Methods != nil {
+			n.Methods = make([]*ast.Field, len(e.Methods))
+			for i, m := range e.Methods {
+				var idents []*ast.Identifier
+				if m.Idents != nil {
+					idents = []*ast.Identifier{CloneExpression(m.Idents[0]).(*ast.Identifier)}
+				}
+				n.Methods[i] = ast.NewField(idents, CloneExpression(m.Type), "")
+			}
+		}
+		expr2 = n
 
 	case *ast.MapType:
 		expr2 = ast.NewMapType(ClonePosition(e.Pos()), CloneExpression(e.KeyType), CloneExpression(e.ValueType))
@@ -456,6 +502,27 @@ func CloneExpression(expr ast.Expression) ast.Expression {
 		expr2 = ast.NewSlicing(ClonePosition(e.Position), CloneExpression(e.Expr), CloneExpression(e.Low),
 			CloneExpression(e.High), CloneExpression(e.Max), e.IsFull)
 
+	case *ast.StructType:
+		var fields []*ast.Field
+		if e.Fields != nil {
+			fields = make([]*ast.Field, len(e.Fields))
+			for i, field := range e.Fields {
+				var idents []*ast.Identifier
+				if field.Idents != nil {
+					idents = make([]*ast.Identifier, len(field.Idents))
+					for j, ident := range field.Idents {
+						idents[j] = CloneExpression(ident).(*ast.Identifier)
+					}
+				}
+				var typ ast.Expression
+				if field.Type != nil {
+					typ = CloneExpression(field.Type)
+				}
+				fields[i] = ast.NewField(idents, typ, field.Tag)
+			}
+		}
+		expr2 = ast.NewStructType(ClonePosition(e.Position), fields)
+
 	case *ast.TypeAssertion:
 		expr2 = ast.NewTypeAssertion(ClonePosition(e.Position), CloneExpression(e.Expr), CloneExpression(e.Type))
 
@@ -475,3 +542,20 @@ func CloneExpression(expr ast.Expression) ast.Expression {
 func ClonePosition(pos *ast.Position) *ast.Position {
 	return &ast.Position{Line: pos.Line, Column: pos.Column, Start: pos.Start, End: pos.End}
 }
+
+// cloneParameters returns a copy of the parameters params. If params is nil,
+// it returns nil.
+func cloneParameters(params []*ast.Parameter) []*ast.Parameter {
+	if params == nil {
+		return nil
+	}
+	params2 := make([]*ast.Parameter, len(params))
+	for i, param := range params {
+		var ident *ast.Identifier
+		if param.Ident != nil {
+			ident = ast.NewIdentifier(ClonePosition(param.Ident.Position), param.Ident.Name)
+		}
+		params2[i] = ast.NewParameter(ident, CloneExpression(param.Type))
+	}
+	return params2
+}
@@ -0,0 +1,1436 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package astutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/open2b/scriggo/ast"
+)
+
+// Fprint writes the source code of node to w.
+//
+// A tree is printed as a program if its first node is a Package node,
+// otherwise it is printed as a template. The other nodes are printed as code
+// of a program, except for the nodes that can only be in a template, such as
+// Text and Show, that are printed as in a template.
+//
+// The source code is printed in a canonical form: the code in {% %}, {%% %%}
+// and {{ }} is normalized, a show statement with a single expression is
+// printed as {{ ... }} and the blocks are closed with {% end %}. The text of
+// a template is printed as is.
+//
+// The comments in the Comments field of a tree are printed before the
+// statement or declaration that follows them, or at the end of the tag that
+// contains them.
+//
+// If node contains a node that cannot be printed, for example a Placeholder
+// node, Fprint returns an error and nothing is written to w.
+func Fprint(w io.Writer, node ast.Node) (err error) {
+	if node == nil {
+		return errors.New("astutil: cannot print a nil node")
+	}
+	p := &printer{}
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(printerError); ok {
+				err = e
+				return
+			}
+			panic(r)
+		}
+	}()
+	if tree, ok := node.(*ast.Tree); ok {
+		p.comments = tree.Comments
+		if len(tree.Nodes) > 0 {
+			if pkg, ok := tree.Nodes[0].(*ast.Package); ok {
+				p.stmt(pkg)
+				for _, c := range p.comments {
+					p.newline()
+					p.write(c.Text)
+				}
+				p.write("\n")
+				_, err = w.Write(p.buf.Bytes())
+				return err
+			}
+		}
+		p.inline = true
+		p.templateNodes(tree.Nodes)
+		p.closeTag(math.MaxInt32)
+		if len(p.comments) > 0 {
+			p.write("{%%")
+			for _, c := range p.comments {
+				p.write(" ")
+				p.write(c.Text)
+				if isLineComment(c) {
+					p.write("\n")
+				}
+			}
+			p.write(" %%}")
+		}
+	} else {
+		p.node(node)
+	}
+	_, err = w.Write(p.buf.Bytes())
+	return err
+}
+
+// printerError is the error returned by Fprint when a node cannot be
+// printed.
+type printerError struct {
+	node ast.Node
+}
+
+func (err printerError) Error() string {
+	return fmt.Sprintf("astutil: cannot print node of type %T", err.node)
+}
+
+// printer prints nodes. The print methods panic with a printerError value
+// if a node cannot be printed.
+type printer struct {
+	buf      bytes.Buffer
+	inline   bool           // print the code on a single line.
+	indent   string         // indentation of the lines of code.
+	comments []*ast.Comment // comments in the code not yet printed.
+	closing  string         // closing delimiter of the last tag, if not yet printed.
+}
+
+// write writes s.
+func (p *printer) write(s string) {
+	p.buf.WriteString(s)
+}
+
+// newline writes a new line and the indentation. If the current line
+// contains only the indentation, it is removed.
+func (p *printer) newline() {
+	b := p.buf.Bytes()
+	if i := bytes.LastIndexByte(b, '\n'); i >= 0 && len(bytes.Trim(b[i+1:], " \t")) == 0 {
+		p.buf.Truncate(i + 1)
+	}
+	p.buf.WriteByte('\n')
+	p.buf.WriteString(p.indent)
+}
+
+// lineIndent returns the spaces at the beginning of the current line.
+func (p *printer) lineIndent() string {
+	b := p.buf.Bytes()
+	b = b[bytes.LastIndexByte(b, '\n')+1:]
+	n := 0
+	for n < len(b) && (b[n] == ' ' || b[n] == '\t') {
+		n++
+	}
+	return string(b[:n])
+}
+
+// start returns the index of the first byte of node in the source, or -1 if
+// node has no position.
+func start(node ast.Node) int {
+	if pos := node.Pos(); pos != nil {
+		return pos.Start
+	}
+	return -1
+}
+
+// end returns the index of the last byte of node in the source, or -1 if
+// node has no position.
+func end(node ast.Node) int {
+	if pos := node.Pos(); pos != nil {
+		return pos.End
+	}
+	return -1
+}
+
+// isLineComment reports whether c is a comment in the form // ... .
+func isLineComment(c *ast.Comment) bool {
+	return strings.HasPrefix(c.Text, "//")
+}
+
+// nextComment returns the next comment not yet printed, if it starts before
+// pos, otherwise it returns nil.
+func (p *printer) nextComment(pos int) *ast.Comment {
+	if !p.hasComment(pos) {
+		return nil
+	}
+	c := p.comments[0]
+	p.comments = p.comments[1:]
+	return c
+}
+
+// hasComment reports whether there is a comment, not yet printed, that
+// starts before pos.
+func (p *printer) hasComment(pos int) bool {
+	return len(p.comments) > 0 && p.comments[0].Pos() != nil && p.comments[0].Start < pos
+}
+
+// leadingComments writes the comments that start before node, each one
+// followed by a new line or, if the code is printed on a single line and it
+// is not a line comment, by a space. When the code is not printed on a
+// single line, the blank lines in the source between comments are
+// preserved.
+func (p *printer) leadingComments(node ast.Node) {
+	pos := start(node)
+	for c := p.nextComment(pos); c != nil; c = p.nextComment(pos) {
+		p.write(c.Text)
+		switch {
+		case !p.inline:
+			p.newline()
+			if p.hasComment(pos) && p.comments[0].Line > c.Line+strings.Count(c.Text, "\n")+1 {
+				p.newline()
+			}
+		case isLineComment(c):
+			p.write("\n")
+		default:
+			p.write(" ")
+		}
+	}
+}
+
+// trailingComments writes the comments that start before pos, each one
+// preceded by a new line or, if the code is printed on a single line, by a
+// space.
+func (p *printer) trailingComments(pos int) {
+	for c := p.nextComment(pos); c != nil; c = p.nextComment(pos) {
+		if p.inline {
+			p.write(" ")
+		} else {
+			p.newline()
+		}
+		p.write(c.Text)
+		if p.inline && isLineComment(c) {
+			p.write("\n")
+		}
+	}
+}
+
+// openTag closes the last tag, writes the opening delimiter delim and the
+// comments that start before pos.
+func (p *printer) openTag(delim string, pos int) {
+	p.closeTag(pos)
+	p.write(delim)
+	for c := p.nextComment(pos); c != nil; c = p.nextComment(pos) {
+		p.write(c.Text)
+		if isLineComment(c) {
+			p.write("\n")
+		} else {
+			p.write(" ")
+		}
+	}
+}
+
+// closeTag writes the comments that start before pos and the closing
+// delimiter of the last tag, if it has not yet been closed.
+func (p *printer) closeTag(pos int) {
+	if p.closing == "" {
+		return
+	}
+	p.trailingComments(pos)
+	p.write(p.closing)
+	p.closing = ""
+}
+
+// endTag writes the {% end %} tag of a block statement that ends at pos.
+func (p *printer) endTag(pos int) {
+	p.openTag("{% ", pos)
+	p.write("end")
+	p.closing = " %}"
+}
+
+// templateNodes writes the nodes of a template.
+func (p *printer) templateNodes(nodes []ast.Node) {
+	for i := 0; i < len(nodes); i++ {
+		if n := groupLen(nodes[i:], false); n > 1 {
+			p.openTag("{% ", start(nodes[i]))
+			p.group(nodes[i : i+n])
+			p.closing = " %}"
+			i += n - 1
+			continue
+		}
+		p.templateNode(nodes[i])
+	}
+}
+
+// templateNode writes a node of a template.
+func (p *printer) templateNode(node ast.Node) {
+	switch n := node.(type) {
+	case *ast.Text:
+		p.closeTag(start(n))
+		p.buf.Write(n.Text)
+	case *ast.Comment:
+		p.closeTag(start(n))
+		p.write("{#")
+		p.write(n.Text)
+		p.write("#}")
+	case *ast.URL:
+		p.templateNodes(n.Value)
+	case *ast.Show:
+		if len(n.Expressions) == 1 {
+			p.openTag("{{ ", start(n.Expressions[0]))
+			p.expr(n.Expressions[0])
+			p.closing = " }}"
+			return
+		}
+		p.openTag("{% ", start(n))
+		p.stmt(n)
+		p.closing = " %}"
+	case *ast.Statements:
+		p.openTag("{%%", start(n))
+		if len(n.Nodes) == 1 && !isCompound(n.Nodes[0]) && !p.hasComment(end(n)) {
+			p.write(" ")
+			p.stmt(n.Nodes[0])
+			p.closing = " %%}"
+			return
+		}
+		indent := p.lineIndent()
+		p.inline = false
+		p.indent = indent + "\t"
+		p.stmts(n.Nodes, end(n))
+		p.trailingComments(end(n))
+		p.indent = indent
+		p.newline()
+		p.write("%%}")
+		p.indent = ""
+		p.inline = true
+	case *ast.Raw:
+		p.openTag("{% ", start(n))
+		p.write("raw")
+		if n.Marker != "" {
+			p.write(" ")
+			p.write(n.Marker)
+		}
+		if n.Tag != "" {
+			p.write(" ")
+			p.write(strconv.Quote(n.Tag))
+		}
+		p.closing = " %}"
+		if n.Text != nil {
+			p.templateNode(n.Text)
+		}
+		p.endTag(end(n))
+		if n.Marker != "" {
+			p.write(" raw ")
+			p.write(n.Marker)
+		}
+	case *ast.Func:
+		p.openTag("{% ", start(n))
+		if n.DistFree {
+			p.write(n.Ident.Name)
+			p.closing = " %}"
+			p.templateNodes(n.Body.Nodes)
+			return
+		}
+		p.write("macro ")
+		p.write(n.Ident.Name)
+		p.signature(n.Type)
+		p.closing = " %}"
+		p.templateNodes(n.Body.Nodes)
+		p.endTag(end(n))
+	case *ast.Label:
+		p.templateBlock(n.Statement, n)
+	case *ast.If, *ast.For, *ast.ForIn, *ast.ForRange, *ast.Switch, *ast.TypeSwitch, *ast.Select:
+		p.templateBlock(n, nil)
+	case *ast.Using:
+		p.openTag("{% ", start(n.Statement))
+		p.stmt(n.Statement)
+		p.write("; using")
+		if n.Type != nil {
+			p.write(" ")
+			p.expr(n.Type)
+		}
+		p.closing = " %}"
+		p.templateNodes(n.Body.Nodes)
+		p.endTag(end(n))
+	case *ast.Block:
+		p.templateNodes(n.Nodes)
+	default:
+		p.openTag("{% ", start(n))
+		p.stmt(n)
+		p.closing = " %}"
+	}
+}
+
+// templateBlock writes a block statement of a template. label is the label
+// of the statement or nil if it has no label.
+func (p *printer) templateBlock(node ast.Node, label *ast.Label) {
+	if label != nil {
+		p.openTag("{% ", start(label))
+		p.write(label.Ident.Name)
+		p.write(": ")
+	} else {
+		p.openTag("{% ", start(node))
+	}
+	switch n := node.(type) {
+	case *ast.If:
+		p.ifHeader(n)
+		p.closing = " %}"
+		p.templateNodes(n.Then.Nodes)
+		for els := n.Else; els != nil; {
+			switch e := els.(type) {
+			case *ast.If:
+				p.openTag("{% ", start(e))
+				p.write("else ")
+				p.ifHeader(e)
+				p.closing = " %}"
+				p.templateNodes(e.Then.Nodes)
+				els = e.Else
+			case *ast.Block:
+				p.openTag("{% ", start(e))
+				p.write("else")
+				p.closing = " %}"
+				p.templateNodes(e.Nodes)
+				els = nil
+			default:
+				panic(printerError{els})
+			}
+		}
+	case *ast.For:
+		p.forHeader(n)
+		p.closing = " %}"
+		p.templateNodes(n.Body)
+	case *ast.ForIn:
+		p.forInHeader(n)
+		p.closing = " %}"
+		p.templateNodes(n.Body)
+		p.templateElse(n.Else)
+	case *ast.ForRange:
+		p.forRangeHeader(n)
+		p.closing = " %}"
+		p.templateNodes(n.Body)
+		p.templateElse(n.Else)
+	case *ast.Switch:
+		p.switchHeader(n.Init, n.Expr)
+		p.closing = " %}"
+		p.templateCases(n.LeadingText, n.Cases)
+	case *ast.TypeSwitch:
+		p.switchHeader(n.Init, n.Assignment)
+		p.closing = " %}"
+		p.templateCases(n.LeadingText, n.Cases)
+	case *ast.Select:
+		p.write("select")
+		p.closing = " %}"
+		if n.LeadingText != nil {
+			p.templateNode(n.LeadingText)
+		}
+		for _, c := range n.Cases {
+			p.openTag("{% ", start(c))
+			p.selectCaseHeader(c)
+			p.closing = " %}"
+			p.templateNodes(c.Body)
+		}
+	default:
+		panic(printerError{node})
+	}
+	p.endTag(end(node))
+}
+
+// templateElse writes the else block of a for statement of a template.
+func (p *printer) templateElse(els *ast.Block) {
+	if els == nil {
+		return
+	}
+	p.openTag("{% ", start(els))
+	p.write("else")
+	p.closing = " %}"
+	p.templateNodes(els.Nodes)
+}
+
+// templateCases writes the leading text and the cases of a switch statement
+// of a template.
+func (p *printer) templateCases(leadingText *ast.Text, cases []*ast.Case) {
+	if leadingText != nil {
+		p.templateNode(leadingText)
+	}
+	for _, c := range cases {
+		p.openTag("{% ", start(c))
+		p.caseHeader(c)
+		p.closing = " %}"
+		p.templateNodes(c.Body)
+	}
+}
+
+// node writes a node that is not a tree.
+func (p *printer) node(node ast.Node) {
+	switch n := node.(type) {
+	case *ast.Text, *ast.Comment, *ast.URL, *ast.Raw, *ast.Statements, *ast.Using:
+		p.inline = true
+		p.templateNode(n)
+		p.closeTag(math.MaxInt32)
+	case *ast.Func:
+		if n.Type.Macro {
+			p.inline = true
+			p.templateNode(n)
+			p.closeTag(math.MaxInt32)
+			return
+		}
+		p.stmt(n)
+	case *ast.Show:
+		p.inline = true
+		p.templateNode(n)
+		p.closeTag(math.MaxInt32)
+	case *ast.Case:
+		p.caseHeader(n)
+		p.write(":")
+		p.caseBody(n.Body)
+	case *ast.SelectCase:
+		p.selectCaseHeader(n)
+		p.write(":")
+		p.caseBody(n.Body)
+	case ast.Expression:
+		p.expr(n)
+	default:
+		p.stmt(n)
+	}
+}
+
+// isCompound reports whether node is a statement with a body.
+func isCompound(node ast.Node) bool {
+	switch n := node.(type) {
+	case *ast.Block, *ast.For, *ast.ForIn, *ast.ForRange, *ast.If, *ast.Label,
+		*ast.Select, *ast.Switch, *ast.TypeSwitch:
+		return true
+	case *ast.Func:
+		return n.Ident != nil
+	}
+	return false
+}
+
+// groupLen returns the number of declarations, at the beginning of nodes,
+// that are in the same group, as "var ( ... )", or 1 if the first node is
+// not in a group. If imports is true, consecutive import declarations are
+// considered in the same group.
+func groupLen(nodes []ast.Node, imports bool) int {
+	n := 1
+	switch first := nodes[0].(type) {
+	case *ast.Const:
+		for n < len(nodes) {
+			c, ok := nodes[n].(*ast.Const)
+			if !ok || c.Index == 0 && (c.Position == nil || c.Position != first.Position) {
+				break
+			}
+			n++
+		}
+	case *ast.Var:
+		for n < len(nodes) {
+			v, ok := nodes[n].(*ast.Var)
+			if !ok || v.Position == nil || v.Position != first.Position {
+				break
+			}
+			n++
+		}
+	case *ast.TypeDeclaration:
+		for n < len(nodes) {
+			t, ok := nodes[n].(*ast.TypeDeclaration)
+			if !ok || t.Position == nil || t.Position != first.Position {
+				break
+			}
+			n++
+		}
+	case *ast.Import:
+		for imports && n < len(nodes) {
+			if _, ok := nodes[n].(*ast.Import); !ok {
+				break
+			}
+			n++
+		}
+	}
+	return n
+}
+
+// stmts writes statements and declarations, each one on a new line or, if
+// the code is printed on a single line, separated by semicolons. end is the
+// position where the statements end in the source, or -1 if it is unknown.
+func (p *printer) stmts(nodes []ast.Node, end int) {
+	for i := 0; i < len(nodes); i++ {
+		if p.inline {
+			if i > 0 {
+				p.write("; ")
+			}
+		} else {
+			p.newline()
+		}
+		p.leadingComments(nodes[i])
+		off := p.buf.Len()
+		n := groupLen(nodes[i:], false)
+		if n > 1 {
+			p.group(nodes[i : i+n])
+		} else {
+			p.stmt(nodes[i])
+		}
+		i += n - 1
+		if p.inline {
+			continue
+		}
+		// Write the comments on the same line of a statement written on a
+		// single line, after the statement.
+		if pos := nodes[i].Pos(); pos != nil && bytes.IndexByte(p.buf.Bytes()[off:], '\n') == -1 {
+			next := end
+			if i+1 < len(nodes) {
+				next = start(nodes[i+1])
+			}
+			for p.hasComment(next) && p.comments[0].Line == pos.Line {
+				p.write(" ")
+				p.write(p.nextComment(next).Text)
+			}
+		}
+	}
+}
+
+// block writes a block with the given nodes, that ends at pos.
+func (p *printer) block(nodes []ast.Node, pos int) {
+	p.write("{")
+	if p.inline {
+		if len(nodes) > 0 {
+			p.write(" ")
+			p.stmts(nodes, pos)
+		}
+		p.trailingComments(pos)
+		if len(nodes) > 0 {
+			p.write(" ")
+		}
+		p.write("}")
+		return
+	}
+	indent := p.indent
+	p.indent += "\t"
+	p.stmts(nodes, pos)
+	p.trailingComments(pos)
+	p.indent = indent
+	if len(nodes) > 0 || p.buf.Bytes()[p.buf.Len()-1] != '{' {
+		p.newline()
+	}
+	p.write("}")
+}
+
+// caseBody writes the body of a case clause.
+func (p *printer) caseBody(nodes []ast.Node) {
+	if p.inline {
+		for _, node := range nodes {
+			p.write(" ")
+			p.stmt(node)
+			p.write(";")
+		}
+		return
+	}
+	indent := p.indent
+	p.indent += "\t"
+	p.stmts(nodes, -1)
+	p.indent = indent
+}
+
+// group writes a group of declarations of the same kind.
+func (p *printer) group(nodes []ast.Node) {
+	switch nodes[0].(type) {
+	case *ast.Const:
+		p.write("const ")
+	case *ast.Import:
+		p.write("import ")
+	case *ast.TypeDeclaration:
+		p.write("type ")
+	case *ast.Var:
+		p.write("var ")
+	}
+	if len(nodes) == 1 {
+		p.spec(nodes[0], nil)
+		return
+	}
+	p.write("(")
+	if p.inline {
+		for i, node := range nodes {
+			if i > 0 {
+				p.write(";")
+			}
+			p.write(" ")
+			p.spec(node, nodes[:i])
+		}
+		p.write(" )")
+		return
+	}
+	indent := p.indent
+	p.indent += "\t"
+	for i, node := range nodes {
+		p.newline()
+		p.spec(node, nodes[:i])
+	}
+	p.indent = indent
+	p.newline()
+	p.write(")")
+}
+
+// spec writes the specification of a declaration. prev contains the
+// previous declarations in the same group.
+func (p *printer) spec(node ast.Node, prev []ast.Node) {
+	switch n := node.(type) {
+	case *ast.Const:
+		p.leadingComments(n.Lhs[0])
+		p.identifiers(n.Lhs)
+		// Do not print the type and the values copied by the parser from
+		// the previous declaration of the group.
+		if len(prev) > 0 {
+			if c, ok := prev[len(prev)-1].(*ast.Const); ok && implicitConst(c, n) {
+				return
+			}
+		}
+		if n.Type != nil {
+			p.write(" ")
+			p.expr(n.Type)
+		}
+		if len(n.Rhs) > 0 {
+			p.write(" = ")
+			p.exprs(n.Rhs)
+		}
+	case *ast.Import:
+		p.leadingComments(n)
+		if n.Ident != nil {
+			p.write(n.Ident.Name)
+			p.write(" ")
+		}
+		p.write(strconv.Quote(n.Path))
+		if n.For != nil {
+			p.write(" for ")
+			p.identifiers(n.For)
+		}
+	case *ast.TypeDeclaration:
+		p.leadingComments(n.Ident)
+		p.write(n.Ident.Name)
+		if n.TypeParams != nil {
+			p.write("[")
+			p.parameters(n.TypeParams, false)
+			p.write("]")
+		}
+		if n.IsAliasDeclaration {
+			p.write(" =")
+		}
+		p.write(" ")
+		p.expr(n.Type)
+	case *ast.Var:
+		p.leadingComments(n.Lhs[0])
+		p.identifiers(n.Lhs)
+		if n.Type != nil {
+			p.write(" ")
+			p.expr(n.Type)
+		}
+		if len(n.Rhs) > 0 {
+			p.write(" = ")
+			p.exprs(n.Rhs)
+		}
+	}
+}
+
+// implicitConst reports whether the type and the values of the constant
+// declaration c have been copied from the previous declaration prev.
+func implicitConst(prev, c *ast.Const) bool {
+	if len(c.Rhs) == 0 || len(c.Rhs) != len(prev.Rhs) {
+		return false
+	}
+	for i, v := range c.Rhs {
+		p1, p2 := prev.Rhs[i].Pos(), v.Pos()
+		if p1 == nil || p2 == nil || *p1 != *p2 {
+			return false
+		}
+	}
+	if c.Type == nil || prev.Type == nil {
+		return c.Type == nil && prev.Type == nil
+	}
+	p1, p2 := prev.Type.Pos(), c.Type.Pos()
+	return p1 != nil && p2 != nil && *p1 == *p2
+}
+
+// stmt writes a statement or a declaration.
+func (p *printer) stmt(node ast.Node) {
+	switch n := node.(type) {
+	case *ast.Assignment:
+		p.assignment(n)
+	case *ast.Block:
+		p.block(n.Nodes, end(n))
+	case *ast.Break:
+		p.write("break")
+		if n.Label != nil {
+			p.write(" ")
+			p.write(n.Label.Name)
+		}
+	case *ast.Const, *ast.Import, *ast.TypeDeclaration, *ast.Var:
+		p.group([]ast.Node{n})
+	case *ast.Continue:
+		p.write("continue")
+		if n.Label != nil {
+			p.write(" ")
+			p.write(n.Label.Name)
+		}
+	case *ast.Defer:
+		p.write("defer ")
+		p.expr(n.Call)
+	case *ast.Extends:
+		p.write("extends ")
+		p.write(strconv.Quote(n.Path))
+	case *ast.Fallthrough:
+		p.write("fallthrough")
+	case *ast.For:
+		p.forHeader(n)
+		p.write(" ")
+		p.block(n.Body, end(n))
+	case *ast.ForIn:
+		p.forInHeader(n)
+		p.write(" ")
+		p.block(n.Body, end(n))
+		p.codeElse(n.Else)
+	case *ast.ForRange:
+		p.forRangeHeader(n)
+		p.write(" ")
+		p.block(n.Body, end(n))
+		p.codeElse(n.Else)
+	case *ast.Func:
+		if n.Ident == nil || n.Type.Macro {
+			p.expr(n)
+			return
+		}
+		p.write("func ")
+		if n.Recv != nil {
+			p.write("(")
+			p.parameters([]*ast.Parameter{n.Recv}, false)
+			p.write(") ")
+		}
+		p.write(n.Ident.Name)
+		if n.TypeParams != nil {
+			p.write("[")
+			p.parameters(n.TypeParams, false)
+			p.write("]")
+		}
+		p.signature(n.Type)
+		if n.Body != nil {
+			p.write(" ")
+			p.block(n.Body.Nodes, end(n.Body))
+		}
+	case *ast.Go:
+		p.write("go ")
+		p.expr(n.Call)
+	case *ast.Goto:
+		p.write("goto ")
+		p.write(n.Label.Name)
+	case *ast.If:
+		p.ifHeader(n)
+		p.write(" ")
+		p.block(n.Then.Nodes, end(n.Then))
+		if n.Else != nil {
+			p.write(" else ")
+			p.stmt(n.Else)
+		}
+	case *ast.Label:
+		// As gofmt, write the label one level to the left.
+		if !p.inline && bytes.HasSuffix(p.buf.Bytes(), []byte("\n"+p.indent)) && p.indent != "" {
+			p.buf.Truncate(p.buf.Len() - 1)
+		}
+		p.write(n.Ident.Name)
+		p.write(":")
+		if n.Statement != nil {
+			if p.inline {
+				p.write(" ")
+			} else {
+				p.newline()
+			}
+			p.leadingComments(n.Statement)
+			p.stmt(n.Statement)
+		}
+	case *ast.Package:
+		p.leadingComments(n)
+		p.write("package ")
+		p.write(n.Name)
+		decls := n.Declarations
+		for i := 0; i < len(decls); {
+			p.write("\n")
+			p.newline()
+			p.leadingComments(decls[i])
+			k := groupLen(decls[i:], true)
+			p.decl(decls[i : i+k])
+			i += k
+		}
+	case *ast.Return:
+		p.write("return")
+		if len(n.Values) > 0 {
+			p.write(" ")
+			p.exprs(n.Values)
+		}
+	case *ast.Select:
+		p.write("select {")
+		for _, c := range n.Cases {
+			if p.inline {
+				p.write(" ")
+			} else {
+				p.newline()
+			}
+			p.leadingComments(c)
+			p.selectCaseHeader(c)
+			p.write(":")
+			p.caseBody(c.Body)
+		}
+		p.closeBrace(end(n))
+	case *ast.Send:
+		p.expr(n.Channel)
+		p.write(" <- ")
+		p.expr(n.Value)
+	case *ast.Show:
+		p.write("show ")
+		p.exprs(n.Expressions)
+	case *ast.Switch:
+		p.switchHeader(n.Init, n.Expr)
+		p.switchBody(n.Cases, end(n))
+	case *ast.TypeSwitch:
+		p.switchHeader(n.Init, n.Assignment)
+		p.switchBody(n.Cases, end(n))
+	case ast.Expression:
+		p.expr(n)
+	default:
+		panic(printerError{node})
+	}
+}
+
+// decl writes a declaration, or a group of declarations, at package level.
+func (p *printer) decl(nodes []ast.Node) {
+	if len(nodes) == 1 {
+		p.stmt(nodes[0])
+		return
+	}
+	p.group(nodes)
+}
+
+// codeElse writes the else block of a for statement.
+func (p *printer) codeElse(els *ast.Block) {
+	if els != nil {
+		p.write(" else ")
+		p.block(els.Nodes, end(els))
+	}
+}
+
+// switchBody writes the body of a switch statement that ends at pos.
+func (p *printer) switchBody(cases []*ast.Case, pos int) {
+	p.write(" {")
+	for _, c := range cases {
+		if p.inline {
+			p.write(" ")
+		} else {
+			p.newline()
+		}
+		p.leadingComments(c)
+		p.caseHeader(c)
+		p.write(":")
+		p.caseBody(c.Body)
+	}
+	p.closeBrace(pos)
+}
+
+// closeBrace writes the comments that start before pos and the closing
+// brace of a switch or select statement.
+func (p *printer) closeBrace(pos int) {
+	p.trailingComments(pos)
+	if p.inline {
+		p.write(" }")
+		return
+	}
+	p.newline()
+	p.write("}")
+}
+
+// assignment writes an assignment.
+func (p *printer) assignment(n *ast.Assignment) {
+	p.exprs(n.Lhs)
+	switch n.Type {
+	case ast.AssignmentIncrement:
+		p.write("++")
+		return
+	case ast.AssignmentDecrement:
+		p.write("--")
+		return
+	}
+	p.write(" ")
+	p.write(assignmentOperator[n.Type])
+	p.write(" ")
+	p.exprs(n.Rhs)
+}
+
+var assignmentOperator = [...]string{
+	ast.AssignmentSimple:         "=",
+	ast.AssignmentDeclaration:    ":=",
+	ast.AssignmentAddition:       "+=",
+	ast.AssignmentSubtraction:    "-=",
+	ast.AssignmentMultiplication: "*=",
+	ast.AssignmentDivision:       "/=",
+	ast.AssignmentModulo:         "%=",
+	ast.AssignmentAnd:            "&=",
+	ast.AssignmentOr:             "|=",
+	ast.AssignmentXor:            "^=",
+	ast.AssignmentAndNot:         "&^=",
+	ast.AssignmentLeftShift:      "<<=",
+	ast.AssignmentRightShift:     ">>=",
+}
+
+// ifHeader writes the header of an if statement.
+func (p *printer) ifHeader(n *ast.If) {
+	p.write("if ")
+	if n.Init != nil {
+		p.stmt(n.Init)
+		p.write("; ")
+	}
+	p.expr(n.Condition)
+}
+
+// forHeader writes the header of a for statement.
+func (p *printer) forHeader(n *ast.For) {
+	if n.Init == nil && n.Post == nil {
+		p.write("for")
+		if n.Condition != nil {
+			p.write(" ")
+			p.expr(n.Condition)
+		}
+		return
+	}
+	p.write("for ")
+	if n.Init != nil {
+		p.stmt(n.Init)
+	}
+	p.write(";")
+	if n.Condition != nil {
+		p.write(" ")
+		p.expr(n.Condition)
+	}
+	p.write(";")
+	if n.Post != nil {
+		p.write(" ")
+		p.stmt(n.Post)
+	}
+}
+
+// forInHeader writes the header of a for in statement.
+func (p *printer) forInHeader(n *ast.ForIn) {
+	p.write("for ")
+	p.write(n.Ident.Name)
+	p.write(" in ")
+	p.expr(n.Expr)
+}
+
+// forRangeHeader writes the header of a for range statement.
+func (p *printer) forRangeHeader(n *ast.ForRange) {
+	p.write("for ")
+	if a := n.Assignment; len(a.Lhs) > 0 {
+		p.exprs(a.Lhs)
+		p.write(" ")
+		p.write(assignmentOperator[a.Type])
+		p.write(" ")
+	}
+	p.write("range ")
+	p.expr(n.Assignment.Rhs[0])
+}
+
+// switchHeader writes the header of a switch statement given its init
+// statement and its expression or type switch guard.
+func (p *printer) switchHeader(init ast.Node, guard ast.Node) {
+	p.write("switch")
+	if init != nil {
+		p.write(" ")
+		p.stmt(init)
+		p.write(";")
+	}
+	switch g := guard.(type) {
+	case nil:
+	case *ast.Assignment:
+		p.write(" ")
+		// The parser represents "x.(type)" as "_ = x.(type)".
+		if ident, ok := g.Lhs[0].(*ast.Identifier); ok && ident.Name == "_" && g.Type == ast.AssignmentSimple {
+			p.expr(g.Rhs[0])
+			return
+		}
+		p.assignment(g)
+	case ast.Expression:
+		p.write(" ")
+		p.expr(g)
+	}
+}
+
+// caseHeader writes the header of a case clause of a switch statement.
+func (p *printer) caseHeader(n *ast.Case) {
+	if n.Expressions == nil {
+		p.write("default")
+		return
+	}
+	p.write("case ")
+	p.exprs(n.Expressions)
+}
+
+// selectCaseHeader writes the header of a case clause of a select
+// statement.
+func (p *printer) selectCaseHeader(n *ast.SelectCase) {
+	if n.Comm == nil {
+		p.write("default")
+		return
+	}
+	p.write("case ")
+	p.stmt(n.Comm)
+}
+
+// identifiers writes a list of identifiers.
+func (p *printer) identifiers(idents []*ast.Identifier) {
+	for i, ident := range idents {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.write(ident.Name)
+	}
+}
+
+// exprs writes a list of expressions.
+func (p *printer) exprs(exprs []ast.Expression) {
+	for i, expr := range exprs {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.expr(expr)
+	}
+}
+
+// signature writes the parameters and the result of a function or macro
+// type.
+func (p *printer) signature(t *ast.FuncType) {
+	if t.Parameters != nil || !t.Macro {
+		p.write("(")
+		p.parameters(t.Parameters, t.IsVariadic)
+		p.write(")")
+	}
+	if len(t.Result) == 0 {
+		return
+	}
+	p.write(" ")
+	if t.Macro || len(t.Result) == 1 && t.Result[0].Ident == nil {
+		p.expr(t.Result[0].Type)
+		return
+	}
+	p.write("(")
+	p.parameters(t.Result, false)
+	p.write(")")
+}
+
+// parameters writes a list of parameters.
+func (p *printer) parameters(params []*ast.Parameter, isVariadic bool) {
+	for i, param := range params {
+		if i > 0 {
+			p.write(", ")
+		}
+		if param.Ident != nil {
+			p.write(param.Ident.Name)
+			if param.Type != nil {
+				p.write(" ")
+			}
+		}
+		if param.Type != nil {
+			if isVariadic && i == len(params)-1 {
+				p.write("...")
+			}
+			p.expr(param.Type)
+		}
+	}
+}
+
+// expr writes an expression.
+func (p *printer) expr(expr ast.Expression) {
+	for i := 0; i < expr.Parenthesis(); i++ {
+		p.write("(")
+	}
+	switch e := expr.(type) {
+	case *ast.ArrayType:
+		p.write("[")
+		if e.Len == nil {
+			p.write("...")
+		} else {
+			p.expr(e.Len)
+		}
+		p.write("]")
+		p.expr(e.ElementType)
+	case *ast.BasicLiteral:
+		p.write(e.Value)
+	case *ast.BinaryOperator:
+		p.operand(e.Expr1, e.Precedence(), false)
+		p.write(" ")
+		p.write(e.Op.String())
+		p.write(" ")
+		p.operand(e.Expr2, e.Precedence(), true)
+	case *ast.Call:
+		parens := false
+		switch f := e.Func.(type) {
+		case *ast.FuncType:
+			parens = len(f.Result) == 0
+		case *ast.ChanType:
+			parens = true
+		}
+		if parens && e.Func.Parenthesis() == 0 {
+			p.write("(")
+			p.expr(e.Func)
+			p.write(")")
+		} else {
+			p.primary(e.Func)
+		}
+		p.write("(")
+		p.exprs(e.Args)
+		if e.IsVariadic {
+			p.write("...")
+		}
+		p.write(")")
+	case *ast.ChanType:
+		switch e.Direction {
+		case ast.ReceiveDirection:
+			p.write("<-chan ")
+		case ast.SendDirection:
+			p.write("chan<- ")
+		default:
+			p.write("chan ")
+		}
+		if c, ok := e.ElementType.(*ast.ChanType); ok && c.Direction == ast.ReceiveDirection && c.Parenthesis() == 0 {
+			p.write("(")
+			p.expr(c)
+			p.write(")")
+		} else {
+			p.expr(e.ElementType)
+		}
+	case *ast.CompositeLiteral:
+		if e.Type != nil {
+			p.expr(e.Type)
+		}
+		p.write("{")
+		for i, kv := range e.KeyValues {
+			if i > 0 {
+				p.write(", ")
+			}
+			if kv.Key != nil {
+				p.expr(kv.Key)
+				p.write(": ")
+			}
+			p.expr(kv.Value)
+		}
+		p.write("}")
+	case *ast.Default:
+		p.operand(e.Expr1, 0, false)
+		p.write(" default ")
+		p.operand(e.Expr2, 0, true)
+	case *ast.Func:
+		if e.Type.Macro {
+			p.expr(e.Type)
+			break
+		}
+		p.write("func")
+		p.signature(e.Type)
+		p.write(" ")
+		p.block(e.Body.Nodes, end(e.Body))
+	case *ast.FuncType:
+		if e.Macro {
+			p.write("macro")
+		} else {
+			p.write("func")
+		}
+		p.signature(e)
+	case *ast.Identifier:
+		p.write(e.String())
+	case *ast.Index:
+		p.primary(e.Expr)
+		p.write("[")
+		p.expr(e.Index)
+		p.write("]")
+	case *ast.IndexList:
+		p.primary(e.Expr)
+		p.write("[")
+		p.exprs(e.Indices)
+		p.write("]")
+	case *ast.Interface:
+		p.interfaceType(e)
+	case *ast.MapType:
+		p.write("map[")
+		p.expr(e.KeyType)
+		p.write("]")
+		p.expr(e.ValueType)
+	case *ast.Render:
+		p.write("render ")
+		p.write(strconv.Quote(e.Path))
+	case *ast.Selector:
+		p.primary(e.Expr)
+		p.write(".")
+		p.write(e.Ident)
+	case *ast.SliceType:
+		p.write("[]")
+		p.expr(e.ElementType)
+	case *ast.Slicing:
+		p.primary(e.Expr)
+		p.write("[")
+		if e.Low != nil {
+			p.expr(e.Low)
+		}
+		p.write(":")
+		if e.High != nil {
+			p.expr(e.High)
+		}
+		if e.IsFull {
+			p.write(":")
+			p.expr(e.Max)
+		}
+		p.write("]")
+	case *ast.StructType:
+		p.structType(e)
+	case *ast.TypeAssertion:
+		p.primary(e.Expr)
+		p.write(".(")
+		if e.Type == nil {
+			p.write("type")
+		} else {
+			p.expr(e.Type)
+		}
+		p.write(")")
+	case *ast.UnaryOperator:
+		p.write(e.Op.String())
+		if e.Op == ast.OperatorExtendedNot {
+			p.write(" ")
+		}
+		parens := false
+		if e.Expr.Parenthesis() == 0 {
+			switch operand := e.Expr.(type) {
+			case *ast.BinaryOperator, *ast.Default:
+				parens = true
+			case *ast.UnaryOperator:
+				// Avoid that two operators are read as a single token.
+				switch e.Op {
+				case ast.OperatorSubtraction, ast.OperatorAddition:
+					parens = operand.Op == e.Op
+				case ast.OperatorAddress:
+					parens = operand.Op == ast.OperatorAddress || operand.Op == ast.OperatorXor
+				}
+			}
+		}
+		if parens {
+			p.write("(")
+			p.expr(e.Expr)
+			p.write(")")
+		} else {
+			p.expr(e.Expr)
+		}
+	default:
+		panic(printerError{expr})
+	}
+	for i := 0; i < expr.Parenthesis(); i++ {
+		p.write(")")
+	}
+}
+
+// operand writes an operand of a binary operator with precedence prec.
+// right reports whether it is the right operand.
+func (p *printer) operand(expr ast.Expression, prec int, right bool) {
+	parens := false
+	if expr.Parenthesis() == 0 {
+		switch e := expr.(type) {
+		case *ast.BinaryOperator:
+			parens = e.Precedence() < prec || right && e.Precedence() == prec
+		case *ast.Default:
+			parens = true
+		}
+	}
+	if parens {
+		p.write("(")
+		p.expr(expr)
+		p.write(")")
+		return
+	}
+	p.expr(expr)
+}
+
+// primary writes the operand of a selector, index, slice, type assertion or
+// call expression.
+func (p *printer) primary(expr ast.Expression) {
+	if expr.Parenthesis() == 0 {
+		switch expr.(type) {
+		case *ast.BinaryOperator, *ast.UnaryOperator, *ast.Default:
+			p.write("(")
+			p.expr(expr)
+			p.write(")")
+			return
+		}
+	}
+	p.expr(expr)
+}
+
+// structType writes a struct type.
+func (p *printer) structType(t *ast.StructType) {
+	if len(t.Fields) == 0 {
+		p.write("struct{}")
+		return
+	}
+	p.write("struct {")
+	indent := p.indent
+	if !p.inline {
+		p.indent += "\t"
+	}
+	for i, field := range t.Fields {
+		if p.inline {
+			if i > 0 {
+				p.write(";")
+			}
+			p.write(" ")
+		} else {
+			p.newline()
+		}
+		if field.Idents != nil {
+			p.identifiers(field.Idents)
+			p.write(" ")
+		}
+		p.expr(field.Type)
+		if field.Tag != "" {
+			p.write(" ")
+			if strconv.CanBackquote(field.Tag) {
+				p.write("`" + field.Tag + "`")
+			} else {
+				p.write(strconv.Quote(field.Tag))
+			}
+		}
+	}
+	p.indent = indent
+	if p.inline {
+		p.write(" }")
+		return
+	}
+	p.newline()
+	p.write("}")
+}
+
+// interfaceType writes an interface type.
+func (p *printer) interfaceType(t *ast.Interface) {
+	if len(t.Methods) == 0 {
+		p.write("interface{}")
+		return
+	}
+	p.write("interface {")
+	indent := p.indent
+	if !p.inline {
+		p.indent += "\t"
+	}
+	for i, m := range t.Methods {
+		if p.inline {
+			if i > 0 {
+				p.write(";")
+			}
+			p.write(" ")
+		} else {
+			p.newline()
+		}
+		if m.Idents == nil {
+			p.expr(m.Type)
+			continue
+		}
+		p.write(m.Idents[0].Name)
+		p.signature(m.Type.(*ast.FuncType))
+	}
+	p.indent = indent
+	if p.inline {
+		p.write(" }")
+		return
+	}
+	p.newline()
+	p.write("}")
+}
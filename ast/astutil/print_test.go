@@ -0,0 +1,296 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package astutil_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/ast/astutil"
+	"github.com/open2b/scriggo/internal/compiler"
+	"github.com/open2b/scriggo/internal/fstest"
+)
+
+var fprintTemplateTests = []struct {
+	src      string
+	expected string
+}{
+	{"", ""},
+	{"a", "a"},
+	{"{{a}}", "{{ a }}"},
+	{"{{ a+b*c }}", "{{ a + b * c }}"},
+	{"{{ (a+b)*c }}", "{{ (a + b) * c }}"},
+	{"{{ a-(b-c) }}", "{{ a - (b - c) }}"},
+	{"{{ - -a }}", "{{ -(-a) }}"},
+	{"{{ -(-a) }}", "{{ -(-a) }}"},
+	{"{{ not a }}", "{{ not a }}"},
+	{"{{ a default b }}", "{{ a default b }}"},
+	{"{{ render \"a.html\" }}", "{{ render \"a.html\" }}"},
+	{"{{ f(a, b...) }}", "{{ f(a, b...) }}"},
+	{"{{ (*T)(a) }}", "{{ (*T)(a) }}"},
+	{"{{ a.b[c][1:2:3] }}", "{{ a.b[c][1:2:3] }}"},
+	{"{{ s[:] }}", "{{ s[:] }}"},
+	{"{{ x.(int) }}", "{{ x.(int) }}"},
+	{"{{ []int{1, 2} }}", "{{ []int{1, 2} }}"},
+	{"{{ map[string]int{\"a\":1} }}", "{{ map[string]int{\"a\": 1} }}"},
+	{"{{ [...]T{{1}} }}", "{{ [...]T{{1}} }}"},
+	{"{{ func(a, b int, c ...string) (int, error) { return 0, nil }() }}", "{{ func(a, b int, c ...string) (int, error) { return 0, nil }() }}"},
+	{"{{ struct{A int `json:\"a\"`; B, C string}{} }}", "{{ struct { A int `json:\"a\"`; B, C string }{} }}"},
+	{"{{ (<-chan int)(c) }}", "{{ (<-chan int)(c) }}"},
+	{"{# a comment #}", "{# a comment #}"},
+	{"{%a:=1%}", "{% a := 1 %}"},
+	{"{% a, b = b, a %}", "{% a, b = b, a %}"},
+	{"{% a &^= 1 %}{% a++ %}", "{% a &^= 1 %}{% a++ %}"},
+	{"{% var a int %}", "{% var a int %}"},
+	{"{% var ( a = 1; b = 2 ) %}", "{% var ( a = 1; b = 2 ) %}"},
+	{"{% const ( A = iota; B; C ) %}", "{% const ( A = iota; B; C ) %}"},
+	{"{% type T struct{ A int } %}", "{% type T struct { A int } %}"},
+	{"{% type I interface{ M(a int) string; fmt.Stringer } %}", "{% type I interface { M(a int) string; fmt.Stringer } %}"},
+	{"{% type A = int %}", "{% type A = int %}"},
+	{"{% show a, b %}", "{% show a, b %}"},
+	{"{% extends \"layout.html\" %}", "{% extends \"layout.html\" %}"},
+	{"{% import \"a.html\" %}{% import b \"b.html\" %}{% import . \"c.html\" %}{% import \"d.html\" for D, E %}",
+		"{% import \"a.html\" %}{% import b \"b.html\" %}{% import . \"c.html\" %}{% import \"d.html\" for D, E %}"},
+	{"{% if a %}b{% end %}", "{% if a %}b{% end %}"},
+	{"{% if x := 1; x > 0 %}a{% else if b %}b{% else %}c{% end if %}", "{% if x := 1; x > 0 %}a{% else if b %}b{% else %}c{% end %}"},
+	{"{% for %}a{% end %}", "{% for %}a{% end %}"},
+	{"{% for i := 0; i < 3; i++ %}a{% end for %}", "{% for i := 0; i < 3; i++ %}a{% end %}"},
+	{"{% for ;; %}a{% end %}", "{% for %}a{% end %}"},
+	{"{% for k, v := range m %}a{% else %}b{% end %}", "{% for k, v := range m %}a{% else %}b{% end %}"},
+	{"{% for range m %}a{% end %}", "{% for range m %}a{% end %}"},
+	{"{% for v in s %}a{% else %}b{% end %}", "{% for v in s %}a{% else %}b{% end %}"},
+	{"{% switch a %}\n{% case 1, 2 %}a{% fallthrough %}{% default %}b{% end %}", "{% switch a %}\n{% case 1, 2 %}a{% fallthrough %}{% default %}b{% end %}"},
+	{"{% switch x := f(); %}{% case x > 0 %}a{% end %}", "{% switch x := f(); %}{% case x > 0 %}a{% end %}"},
+	{"{% switch v := x.(type) %}{% case int %}a{% end %}", "{% switch v := x.(type) %}{% case int %}a{% end %}"},
+	{"{% switch x.(type) %}{% case nil %}a{% end %}", "{% switch x.(type) %}{% case nil %}a{% end %}"},
+	{"{% select %}{% case v := <-c %}a{% case c <- 1 %}b{% default %}c{% end %}", "{% select %}{% case v := <-c %}a{% case c <- 1 %}b{% default %}c{% end %}"},
+	{"{% L: for %}{% break L %}{% end %}", "{% L: for %}{% break L %}{% end %}"},
+	{"{% macro M %}a{% end %}", "{% macro M %}a{% end %}"},
+	{"{% macro M() %}a{% end macro %}", "{% macro M() %}a{% end %}"},
+	{"{% macro M(a int, b ...string) html %}a{% end %}", "{% macro M(a int, b ...string) html %}a{% end %}"},
+	{"{% raw %}{{ a }}{% end raw %}", "{% raw %}{{ a }}{% end %}"},
+	{"{% raw code \"go\" %}{% end %}{% end raw code %}", "{% raw code \"go\" %}{% end %}{% end raw code %}"},
+	{"{% show M(); using %}a{% end %}", "{% show M(); using %}a{% end %}"},
+	{"{% show M(itea); using macro(s string) %}a{% end %}", "{% show M(itea); using macro(s string) %}a{% end %}"},
+	{"{% a := itea; using html %}a{% end using %}", "{% a := itea; using html %}a{% end %}"},
+	{"{%% a := 1 %%}", "{%% a := 1 %%}"},
+	{"{%%\na := 1\nb := 2 %%}", "{%%\n\ta := 1\n\tb := 2\n%%}"},
+	{"  {%%\nif a { b() } else { c() } %%}", "  {%%\n  \tif a {\n  \t\tb()\n  \t} else {\n  \t\tc()\n  \t}\n  %%}"},
+	{"{%%\nswitch a {\ncase 1:\nb()\ndefault:\n} %%}", "{%%\n\tswitch a {\n\tcase 1:\n\t\tb()\n\tdefault:\n\t}\n%%}"},
+	{"{% a := 1 // comment\n %}", "{% a := 1 // comment\n %}"},
+	{"{% /* c1 */ a := 1 /* c2 */ %}{% b := 2 %}", "{% /* c1 */ a := 1 /* c2 */ %}{% b := 2 %}"},
+	{"{%%\n// c1\na := 1\n/* c2 */\n%%}", "{%%\n\t// c1\n\ta := 1\n\t/* c2 */\n%%}"},
+	{"{%%\na := 1 // c1\nb := 2 /* c2 */ /* c3 */\n%%}", "{%%\n\ta := 1 // c1\n\tb := 2 /* c2 */ /* c3 */\n%%}"},
+	{"{% f(func() {\n\ta()\n}) %}", "{% f(func() { a() }) %}"},
+}
+
+// TestFprintTemplate tests printing the tree of a template.
+func TestFprintTemplate(t *testing.T) {
+	for _, cas := range fprintTemplateTests {
+		got := printTemplate(t, cas.src)
+		if got != cas.expected {
+			t.Errorf("source %q: expected %q, got %q", cas.src, cas.expected, got)
+			continue
+		}
+		// The printed source must be parsed to a tree that is printed in the
+		// same way.
+		if again := printTemplate(t, got); again != got {
+			t.Errorf("source %q: printed source %q is printed as %q", cas.src, got, again)
+		}
+	}
+}
+
+func printTemplate(t *testing.T, src string) string {
+	tree, _, err := compiler.ParseTemplateSource([]byte(src), ast.FormatHTML, false, false)
+	if err != nil {
+		t.Fatalf("source %q: unexpected parsing error: %s", src, err)
+	}
+	var b strings.Builder
+	err = astutil.Fprint(&b, tree)
+	if err != nil {
+		t.Fatalf("source %q: unexpected error: %s", src, err)
+	}
+	return b.String()
+}
+
+const fprintProgramSource = `// Package main.
+package main
+
+import "fmt"
+import ( "os"; s "strings" )
+
+// Colors.
+const ( Red = iota; Green; Blue )
+const N, M int = 1, 2
+
+var ( a int; b = "b" )
+
+type ( T struct { A, B int; C string ` + "`c`" + ` }; U = T )
+
+type Shape interface { Area() float64; fmt.Stringer }
+
+func f(a int, b ...string) (n int, err error) {
+	defer g()
+	go g()
+	// A comment.
+	for i := 0; i < 10; i++ { if i % 2 == 0 { continue } else if i > 5 { break } }
+	switch x := a; { case x > 0: fallthrough; default: }
+	select { case v := <-c: _ = v; case c <- 1: }
+	L:
+	for k := range b { _ = k; goto L }
+	var fn = func() {}
+	fn()
+	return a &^ 1, nil /* trailing */
+}
+
+func (t *T) Sum() int { return t.A + t.B }
+
+type Number interface { ~int | ~float64 }
+
+type Pair[K comparable, V any] struct { Key K; Val V }
+
+func Sum[T Number](s ...T) T { var t T; for _, v := range s { t += v }; return t }
+
+func (p Pair[K, V]) Values() []V { return []V{p.Val} }
+
+var _ = Sum[int](1, 2)
+
+func main() {}
+`
+
+const fprintProgramExpected = `// Package main.
+package main
+
+import (
+	"fmt"
+	"os"
+	s "strings"
+)
+
+// Colors.
+const (
+	Red = iota
+	Green
+	Blue
+)
+
+const N, M int = 1, 2
+
+var (
+	a int
+	b = "b"
+)
+
+type (
+	T struct {
+		A, B int
+		C string ` + "`c`" + `
+	}
+	U = T
+)
+
+type Shape interface {
+	Area() float64
+	fmt.Stringer
+}
+
+func f(a int, b ...string) (n int, err error) {
+	defer g()
+	go g()
+	// A comment.
+	for i := 0; i < 10; i++ {
+		if i % 2 == 0 {
+			continue
+		} else if i > 5 {
+			break
+		}
+	}
+	switch x := a; {
+	case x > 0:
+		fallthrough
+	default:
+	}
+	select {
+	case v := <-c:
+		_ = v
+	case c <- 1:
+	}
+L:
+	for k := range b {
+		_ = k
+		goto L
+	}
+	var fn = func() {}
+	fn()
+	return a &^ 1, nil /* trailing */
+}
+
+func (t *T) Sum() int {
+	return t.A + t.B
+}
+
+type Number interface {
+	~int | ~float64
+}
+
+type Pair[K comparable, V any] struct {
+	Key K
+	Val V
+}
+
+func Sum[T Number](s ...T) T {
+	var t T
+	for _, v := range s {
+		t += v
+	}
+	return t
+}
+
+func (p Pair[K, V]) Values() []V {
+	return []V{p.Val}
+}
+
+var _ = Sum[int](1, 2)
+
+func main() {}
+`
+
+// TestFprintProgram tests printing the tree of a program.
+func TestFprintProgram(t *testing.T) {
+	got := printProgram(t, fprintProgramSource)
+	if got != fprintProgramExpected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", fprintProgramExpected, got)
+	}
+	if again := printProgram(t, got); again != got {
+		t.Fatalf("printed source is printed as:\n%s", again)
+	}
+}
+
+func printProgram(t *testing.T, src string) string {
+	tree, err := compiler.ParseProgram(fstest.Files{"main.go": src})
+	if err != nil {
+		t.Fatalf("unexpected parsing error: %s", err)
+	}
+	var b strings.Builder
+	err = astutil.Fprint(&b, tree)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return b.String()
+}
+
+// TestFprintError tests that Fprint returns an error for a node that
+// cannot be printed.
+func TestFprintError(t *testing.T) {
+	var b strings.Builder
+	err := astutil.Fprint(&b, ast.NewPlaceholder())
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if b.Len() > 0 {
+		t.Fatalf("expected no output, got %q", b.String())
+	}
+}
@@ -0,0 +1,674 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/open2b/scriggo"
+)
+
+// dapMaxElements is the maximum number of elements of a slice, an array or
+// a map returned by the variables request.
+const dapMaxElements = 100
+
+// dap executes the sub command "dap":
+//
+//	scriggo dap
+//
+// It reads the messages of the Debug Adapter Protocol from in and writes the
+// responses and the events to out.
+func dap(in io.Reader, out io.Writer) error {
+	s := &dapServer{
+		out:         out,
+		breakpoints: map[string]map[int]bool{},
+		sources:     map[string]string{},
+		actions:     make(chan scriggo.DebugAction),
+	}
+	s.changed = sync.NewCond(&s.mu)
+	defer s.terminate()
+	r := bufio.NewReader(in)
+	for {
+		msg, err := readLSPMessage(r)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		disconnect, err := s.handle(msg)
+		if err != nil {
+			return err
+		}
+		if disconnect {
+			return nil
+		}
+	}
+}
+
+// dapState is the state of the execution of a debugged template or program.
+type dapState int
+
+const (
+	dapNotStarted dapState = iota
+	dapRunning
+	dapStopped
+	dapTerminated
+)
+
+// dapServer is a debug adapter for templates and programs. It implements the
+// scriggo.Debugger interface.
+type dapServer struct {
+	out     io.Writer
+	writeMu sync.Mutex // protects seq and the writes to out.
+	seq     int
+
+	// run runs the template or the program to debug; it is set by the
+	// launch request.
+	run func(ctx context.Context) error
+
+	// source returns the path of the source file of a template file or
+	// of a package.
+	source func(path string) string
+
+	cancel  context.CancelFunc
+	actions chan scriggo.DebugAction // actions of a stopped execution.
+
+	// The following fields are protected by mu.
+	mu          sync.Mutex
+	changed     *sync.Cond // signaled when state changes.
+	state       dapState
+	breakpoints map[string]map[int]bool // lines with a breakpoint, by source path.
+	sources     map[string]string       // source paths by template file or package path.
+	entry       bool                    // reports whether it stops on entry.
+	pause       bool                    // reports whether a pause has been requested.
+	reason      string                  // reason of the last stop.
+	frames      []scriggo.DebugFrame    // frames of the stopped execution.
+	refs        []dapReference          // variables references of the stopped execution.
+}
+
+// dapReference is a reference to the variables of a frame or to the
+// elements of a value.
+type dapReference struct {
+	variables []scriggo.DebugVariable
+	value     reflect.Value
+}
+
+// dapMessage is a request.
+type dapMessage struct {
+	Seq       int             `json:"seq"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// handle handles the request msg. It returns true if msg is the disconnect
+// request.
+func (s *dapServer) handle(msg []byte) (bool, error) {
+	var m dapMessage
+	err := json.Unmarshal(msg, &m)
+	if err != nil {
+		return false, err
+	}
+	var body interface{}
+	switch m.Command {
+	case "initialize":
+		body = map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+		}
+	case "launch":
+		var args struct {
+			Program     string `json:"program"`
+			Root        string `json:"root"`
+			StopOnEntry bool   `json:"stopOnEntry"`
+		}
+		_ = json.Unmarshal(m.Arguments, &args)
+		err = s.launch(args.Program, args.Root)
+		if err != nil {
+			return false, s.respondError(m, err.Error())
+		}
+		s.mu.Lock()
+		s.entry = args.StopOnEntry
+		s.mu.Unlock()
+		err = s.respond(m, nil)
+		if err != nil {
+			return false, err
+		}
+		return false, s.event("initialized", nil)
+	case "setBreakpoints":
+		var args struct {
+			Source struct {
+				Path string `json:"path"`
+			} `json:"source"`
+			Breakpoints []struct {
+				Line int `json:"line"`
+			} `json:"breakpoints"`
+		}
+		if err := json.Unmarshal(m.Arguments, &args); err != nil {
+			return false, s.respondError(m, "invalid arguments")
+		}
+		lines := map[int]bool{}
+		breakpoints := make([]map[string]interface{}, len(args.Breakpoints))
+		for i, bp := range args.Breakpoints {
+			lines[bp.Line] = true
+			breakpoints[i] = map[string]interface{}{"verified": true, "line": bp.Line}
+		}
+		s.mu.Lock()
+		s.breakpoints[filepath.Clean(args.Source.Path)] = lines
+		s.mu.Unlock()
+		body = map[string]interface{}{"breakpoints": breakpoints}
+	case "configurationDone":
+		if s.run == nil {
+			return false, s.respondError(m, "configurationDone request received before the launch request")
+		}
+		err = s.respond(m, nil)
+		if err != nil {
+			return false, err
+		}
+		s.start()
+		return false, nil
+	case "threads":
+		body = map[string]interface{}{
+			"threads": []map[string]interface{}{{"id": 1, "name": "main"}},
+		}
+	case "stackTrace":
+		body = s.stackTrace()
+	case "scopes":
+		var args struct {
+			FrameID int `json:"frameId"`
+		}
+		_ = json.Unmarshal(m.Arguments, &args)
+		body = s.scopes(args.FrameID)
+	case "variables":
+		var args struct {
+			VariablesReference int `json:"variablesReference"`
+		}
+		_ = json.Unmarshal(m.Arguments, &args)
+		body = s.variables(args.VariablesReference)
+	case "continue", "next", "stepIn", "stepOut":
+		if m.Command == "continue" {
+			body = map[string]interface{}{"allThreadsContinued": true}
+		}
+		err = s.respond(m, body)
+		if err != nil {
+			return false, err
+		}
+		action := map[string]scriggo.DebugAction{
+			"continue": scriggo.DebugContinue,
+			"next":     scriggo.DebugStepOver,
+			"stepIn":   scriggo.DebugStepIn,
+			"stepOut":  scriggo.DebugStepOut,
+		}[m.Command]
+		s.resume(action)
+		return false, nil
+	case "pause":
+		s.mu.Lock()
+		s.pause = true
+		s.mu.Unlock()
+	case "disconnect", "terminate":
+		s.terminate()
+		return m.Command == "disconnect", s.respond(m, nil)
+	default:
+		return false, s.respondError(m, "unknown command: "+m.Command)
+	}
+	return false, s.respond(m, body)
+}
+
+// launch prepares the execution of the template or program with the given
+// path. A path of a directory, or of a file with the .go extension, is the
+// path of a program, otherwise it is the path of a template file. root is
+// the root directory of the template, as for the -root flag of the run
+// command.
+func (s *dapServer) launch(name string, root string) error {
+	if name == "" {
+		return errors.New("missing program")
+	}
+	name, err := filepath.Abs(name)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	// Program.
+	if fi.IsDir() || filepath.Ext(name) == ".go" {
+		dir := name
+		if !fi.IsDir() {
+			dir = filepath.Dir(name)
+		}
+		program, err := scriggo.Build(os.DirFS(dir), &scriggo.BuildOptions{AllowGoStmt: true})
+		if err != nil {
+			return err
+		}
+		modPath := readModulePath(dir)
+		s.source = func(path string) string {
+			if path == "main" {
+				return goFile(dir)
+			}
+			return goFile(filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(path, modPath+"/"))))
+		}
+		s.run = func(ctx context.Context) error {
+			return program.Run(&scriggo.RunOptions{Context: ctx, Print: s.print, Debugger: s})
+		}
+		return nil
+	}
+
+	// Template.
+	fsys, file, err := templateFileSystem(name, buildFlags{root: root})
+	if err != nil {
+		return err
+	}
+	opts, err := templateBuildOptions(file, buildFlags{})
+	if err != nil {
+		return err
+	}
+	template, err := scriggo.BuildTemplate(fsys, file, opts)
+	if err != nil {
+		return err
+	}
+	if root == "" {
+		root = filepath.Dir(name)
+	} else if root, err = filepath.Abs(root); err != nil {
+		return err
+	}
+	s.source = func(path string) string {
+		return filepath.Join(root, filepath.FromSlash(path))
+	}
+	s.run = func(ctx context.Context) error {
+		return template.Run(dapOutput{s}, nil, &scriggo.RunOptions{Context: ctx, Print: s.print, Debugger: s})
+	}
+	return nil
+}
+
+// start starts the execution.
+func (s *dapServer) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.setState(dapRunning)
+	go func() {
+		err := s.run(ctx)
+		exitCode := 0
+		if err != nil {
+			exitCode = 1
+			var e *scriggo.ExitError
+			if errors.As(err, &e) {
+				exitCode = e.Code
+			}
+			if err != context.Canceled {
+				s.output("stderr", err.Error()+"\n")
+			}
+		}
+		_ = s.event("exited", map[string]interface{}{"exitCode": exitCode})
+		_ = s.event("terminated", nil)
+		s.setState(dapTerminated)
+	}()
+}
+
+// terminate terminates the execution, if it has been started, and waits
+// for its termination.
+func (s *dapServer) terminate() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	for {
+		s.mu.Lock()
+		state := s.state
+		s.mu.Unlock()
+		if state == dapTerminated {
+			return
+		}
+		// The canceled execution terminates when resumed.
+		if !s.resume(scriggo.DebugContinue) {
+			s.wait()
+		}
+	}
+}
+
+// setState sets the state of the execution.
+func (s *dapServer) setState(state dapState) {
+	s.mu.Lock()
+	s.state = state
+	s.changed.Broadcast()
+	s.mu.Unlock()
+}
+
+// wait waits until the execution is stopped or terminated, and reports
+// whether it is stopped.
+func (s *dapServer) wait() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.state == dapRunning {
+		s.changed.Wait()
+	}
+	return s.state == dapStopped
+}
+
+// resume resumes the stopped execution with the given action. It reports
+// whether the execution was stopped.
+func (s *dapServer) resume(action scriggo.DebugAction) bool {
+	s.mu.Lock()
+	if s.state != dapStopped {
+		s.mu.Unlock()
+		return false
+	}
+	s.state = dapRunning
+	s.frames = nil
+	s.refs = nil
+	s.mu.Unlock()
+	s.actions <- action
+	return true
+}
+
+// Break implements the scriggo.Debugger interface.
+func (s *dapServer) Break(path string, line int) bool {
+	source := s.sourcePath(path)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.entry:
+		s.entry = false
+		s.reason = "entry"
+	case s.pause:
+		s.pause = false
+		s.reason = "pause"
+	case s.breakpoints[source][line]:
+		s.reason = "breakpoint"
+	default:
+		s.reason = "step"
+		return false
+	}
+	return true
+}
+
+// Stop implements the scriggo.Debugger interface.
+func (s *dapServer) Stop(frames []scriggo.DebugFrame) scriggo.DebugAction {
+	s.mu.Lock()
+	s.frames = frames
+	reason := s.reason
+	s.mu.Unlock()
+	_ = s.event("stopped", map[string]interface{}{
+		"reason":            reason,
+		"threadId":          1,
+		"allThreadsStopped": true,
+	})
+	s.setState(dapStopped)
+	return <-s.actions
+}
+
+// sourcePath returns the path of the source file of a template file or of a
+// package with the given path.
+func (s *dapServer) sourcePath(path string) string {
+	s.mu.Lock()
+	source, ok := s.sources[path]
+	s.mu.Unlock()
+	if !ok {
+		source = s.source(path)
+		s.mu.Lock()
+		s.sources[path] = source
+		s.mu.Unlock()
+	}
+	return source
+}
+
+// stackTrace returns the body of the response to a stackTrace request.
+func (s *dapServer) stackTrace() interface{} {
+	s.wait()
+	s.mu.Lock()
+	frames := s.frames
+	s.mu.Unlock()
+	stackFrames := make([]map[string]interface{}, len(frames))
+	for i, frame := range frames {
+		source := s.sourcePath(frame.Path)
+		stackFrames[i] = map[string]interface{}{
+			"id":     i + 1,
+			"name":   frame.Func,
+			"source": map[string]string{"name": filepath.Base(source), "path": source},
+			"line":   frame.Position.Line,
+			"column": frame.Position.Column,
+		}
+	}
+	return map[string]interface{}{"stackFrames": stackFrames, "totalFrames": len(frames)}
+}
+
+// scopes returns the body of the response to a scopes request.
+func (s *dapServer) scopes(frameID int) interface{} {
+	s.wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	scopes := []map[string]interface{}{}
+	if 0 < frameID && frameID <= len(s.frames) {
+		s.refs = append(s.refs, dapReference{variables: s.frames[frameID-1].Variables})
+		scopes = append(scopes, map[string]interface{}{
+			"name":               "Locals",
+			"presentationHint":   "locals",
+			"variablesReference": len(s.refs),
+			"expensive":          false,
+		})
+	}
+	return map[string]interface{}{"scopes": scopes}
+}
+
+// variables returns the body of the response to a variables request.
+func (s *dapServer) variables(ref int) interface{} {
+	s.wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	variables := []map[string]interface{}{}
+	if ref <= 0 || ref > len(s.refs) {
+		return map[string]interface{}{"variables": variables}
+	}
+	r := s.refs[ref-1]
+	if r.variables != nil {
+		for _, v := range r.variables {
+			variables = append(variables, s.variable(v.Name, v.Value))
+		}
+		return map[string]interface{}{"variables": variables}
+	}
+	switch v := r.value; v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			variables = append(variables, s.variable(v.Type().Field(i).Name, v.Field(i)))
+		}
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < v.Len() && i < dapMaxElements; i++ {
+			variables = append(variables, s.variable("["+strconv.Itoa(i)+"]", v.Index(i)))
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		names := make([]string, len(keys))
+		for i, key := range keys {
+			names[i] = formatValue(key)
+		}
+		sort.Sort(keysByName{keys, names})
+		for i, key := range keys {
+			if i == dapMaxElements {
+				break
+			}
+			variables = append(variables, s.variable("["+names[i]+"]", v.MapIndex(key)))
+		}
+	case reflect.Ptr, reflect.Interface:
+		variables = append(variables, s.variable("*", v.Elem()))
+	}
+	return map[string]interface{}{"variables": variables}
+}
+
+// variable returns a variable of the response to a variables request with
+// the given name and value. If the value has elements, it adds a reference
+// to the value.
+func (s *dapServer) variable(name string, v reflect.Value) map[string]interface{} {
+	variable := map[string]interface{}{
+		"name":               name,
+		"value":              formatValue(v),
+		"variablesReference": 0,
+	}
+	if !v.IsValid() {
+		return variable
+	}
+	variable["type"] = v.Type().String()
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.NumField() == 0 {
+			return variable
+		}
+	case reflect.Array, reflect.Slice, reflect.Map:
+		if v.Len() == 0 {
+			return variable
+		}
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return variable
+		}
+	default:
+		return variable
+	}
+	s.refs = append(s.refs, dapReference{value: v})
+	variable["variablesReference"] = len(s.refs)
+	return variable
+}
+
+// print implements the print builtin of the debugged execution.
+func (s *dapServer) print(v interface{}) {
+	s.output("stderr", fmt.Sprint(v))
+}
+
+// output sends an output event with the given category and output.
+func (s *dapServer) output(category, output string) {
+	_ = s.event("output", map[string]interface{}{"category": category, "output": output})
+}
+
+// respond responds with success to the request m.
+func (s *dapServer) respond(m dapMessage, body interface{}) error {
+	resp := map[string]interface{}{
+		"type":        "response",
+		"request_seq": m.Seq,
+		"success":     true,
+		"command":     m.Command,
+	}
+	if body != nil {
+		resp["body"] = body
+	}
+	return s.write(resp)
+}
+
+// respondError responds to the request m with an error.
+func (s *dapServer) respondError(m dapMessage, message string) error {
+	return s.write(map[string]interface{}{
+		"type":        "response",
+		"request_seq": m.Seq,
+		"success":     false,
+		"command":     m.Command,
+		"message":     message,
+	})
+}
+
+// event sends an event.
+func (s *dapServer) event(event string, body interface{}) error {
+	e := map[string]interface{}{
+		"type":  "event",
+		"event": event,
+	}
+	if body != nil {
+		e["body"] = body
+	}
+	return s.write(e)
+}
+
+// write writes the message v, setting its sequence number.
+func (s *dapServer) write(v map[string]interface{}) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.seq++
+	v["seq"] = s.seq
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	return err
+}
+
+// dapOutput is an io.Writer that sends the output of a template as output
+// events.
+type dapOutput struct {
+	s *dapServer
+}
+
+func (out dapOutput) Write(p []byte) (int, error) {
+	out.s.output("stdout", string(p))
+	return len(p), nil
+}
+
+// keysByName sorts the keys of a map by their names.
+type keysByName struct {
+	keys  []reflect.Value
+	names []string
+}
+
+func (k keysByName) Len() int           { return len(k.keys) }
+func (k keysByName) Less(i, j int) bool { return k.names[i] < k.names[j] }
+func (k keysByName) Swap(i, j int) {
+	k.keys[i], k.keys[j] = k.keys[j], k.keys[i]
+	k.names[i], k.names[j] = k.names[j], k.names[i]
+}
+
+// formatValue formats the value of a variable.
+func formatValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return "nil"
+	case reflect.String:
+		return strconv.Quote(v.String())
+	case reflect.Func:
+		if v.IsNil() {
+			return "nil"
+		}
+		return v.Type().String()
+	}
+	return fmt.Sprint(v)
+}
+
+// readModulePath returns the module path in the go.mod file in dir. If there
+// is no go.mod file, it returns an empty string.
+func readModulePath(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "module ") {
+			return strings.Trim(strings.TrimSpace(line[len("module "):]), `"`)
+		}
+	}
+	return ""
+}
+
+// goFile returns the path of the Go file in dir. A package of a program has
+// only one file.
+func goFile(dir string) string {
+	files, err := os.ReadDir(dir)
+	if err == nil {
+		for _, file := range files {
+			if file.Type().IsRegular() && filepath.Ext(file.Name()) == ".go" {
+				return filepath.Join(dir, file.Name())
+			}
+		}
+	}
+	return dir
+}
@@ -0,0 +1,186 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestDAP tests a session of the debug adapter.
+func TestDAP(t *testing.T) {
+
+	dir := t.TempDir()
+	index := filepath.Join(dir, "index.html")
+	err := os.WriteFile(index, []byte("{% s := \"a\" %}\n{{ s }}\n{% v := []int{1, 2} %}\n{{ len(v) }}"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in, inW := io.Pipe()
+	outR, out := io.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- dap(in, out)
+		_ = out.Close()
+	}()
+
+	// Read the messages in a goroutine, as the adapter can write an event
+	// while the test writes a request.
+	type message struct {
+		s        string
+		response bool
+	}
+	messages := make(chan message, 100)
+	go func() {
+		defer close(messages)
+		r := bufio.NewReader(outR)
+		for {
+			data, err := readLSPMessage(r)
+			if err != nil {
+				return
+			}
+			var msg struct {
+				Type    string          `json:"type"`
+				Command string          `json:"command"`
+				Success bool            `json:"success"`
+				Message string          `json:"message"`
+				Event   string          `json:"event"`
+				Body    json.RawMessage `json:"body"`
+			}
+			_ = json.Unmarshal(data, &msg)
+			if msg.Type == "event" {
+				s := msg.Event
+				if msg.Body != nil {
+					s += " " + string(msg.Body)
+				}
+				messages <- message{s, false}
+				continue
+			}
+			s := msg.Command
+			if !msg.Success {
+				s += " error: " + msg.Message
+			} else if msg.Body != nil {
+				s += " " + string(msg.Body)
+			}
+			messages <- message{s, true}
+		}
+	}()
+	read := func() (string, bool) {
+		msg, ok := <-messages
+		if !ok {
+			t.Fatal("unexpected end of messages")
+		}
+		return msg.s, msg.response
+	}
+
+	// send sends a request and reads the messages up to its response.
+	var responses, events []string
+	seq := 0
+	send := func(command string, arguments interface{}) {
+		seq++
+		msg := map[string]interface{}{"seq": seq, "type": "request", "command": command}
+		if arguments != nil {
+			msg["arguments"] = arguments
+		}
+		data, _ := json.Marshal(msg)
+		_, err := fmt.Fprintf(inW, "Content-Length: %d\r\n\r\n%s", len(data), data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for {
+			s, response := read()
+			if response {
+				responses = append(responses, s)
+				return
+			}
+			events = append(events, s)
+		}
+	}
+
+	send("initialize", map[string]interface{}{"adapterID": "scriggo"})
+	send("launch", map[string]interface{}{"program": index})
+	send("setBreakpoints", map[string]interface{}{
+		"source":      map[string]string{"path": index},
+		"breakpoints": []map[string]int{{"line": 3}},
+	})
+	send("configurationDone", nil)
+	send("threads", nil)
+	send("stackTrace", map[string]int{"threadId": 1})
+	send("scopes", map[string]int{"frameId": 1})
+	send("variables", map[string]int{"variablesReference": 1})
+	send("next", map[string]int{"threadId": 1})
+	send("scopes", map[string]int{"frameId": 1})
+	send("variables", map[string]int{"variablesReference": 1})
+	send("variables", map[string]int{"variablesReference": 2})
+	send("continue", map[string]int{"threadId": 1})
+	for len(events) == 0 || events[len(events)-1] != "terminated" {
+		s, _ := read()
+		events = append(events, s)
+	}
+	send("unknown", nil)
+	send("disconnect", nil)
+	_ = inW.Close()
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	source := `{"name":"index.html","path":` + jsonString(index) + `}`
+	expectedResponses := []string{
+		`initialize {"supportsConfigurationDoneRequest":true}`,
+		`launch`,
+		`setBreakpoints {"breakpoints":[{"line":3,"verified":true}]}`,
+		`configurationDone`,
+		`threads {"threads":[{"id":1,"name":"main"}]}`,
+		`stackTrace {"stackFrames":[{"column":14,"id":1,"line":3,"name":"main.main","source":` + source + `}],"totalFrames":1}`,
+		`scopes {"scopes":[{"expensive":false,"name":"Locals","presentationHint":"locals","variablesReference":1}]}`,
+		`variables {"variables":[{"name":"s","type":"string","value":"\"a\"","variablesReference":0}]}`,
+		`next`,
+		`scopes {"scopes":[{"expensive":false,"name":"Locals","presentationHint":"locals","variablesReference":1}]}`,
+		`variables {"variables":[{"name":"s","type":"string","value":"\"a\"","variablesReference":0},{"name":"v","type":"[]int","value":"[1 2]","variablesReference":2}]}`,
+		`variables {"variables":[{"name":"[0]","type":"int","value":"1","variablesReference":0},{"name":"[1]","type":"int","value":"2","variablesReference":0}]}`,
+		`continue {"allThreadsContinued":true}`,
+		`unknown error: unknown command: unknown`,
+		`disconnect`,
+	}
+	if len(responses) != len(expectedResponses) {
+		t.Fatalf("expected %d responses, got %d: %q", len(expectedResponses), len(responses), responses)
+	}
+	for i, resp := range responses {
+		if resp != expectedResponses[i] {
+			t.Fatalf("response %d: expected %s, got %s", i+1, expectedResponses[i], resp)
+		}
+	}
+
+	expectedEvents := []string{
+		`initialized`,
+		`output {"category":"stdout","output":"a"}`,
+		`output {"category":"stdout","output":"\n"}`,
+		`stopped {"allThreadsStopped":true,"reason":"breakpoint","threadId":1}`,
+		`stopped {"allThreadsStopped":true,"reason":"step","threadId":1}`,
+		`output {"category":"stdout","output":"2"}`,
+		`exited {"exitCode":0}`,
+		`terminated`,
+	}
+	if len(events) != len(expectedEvents) {
+		t.Fatalf("expected %d events, got %d: %q", len(expectedEvents), len(events), events)
+	}
+	for i, event := range events {
+		if event != expectedEvents[i] {
+			t.Fatalf("event %d: expected %s, got %s", i+1, expectedEvents[i], event)
+		}
+	}
+}
+
+// jsonString returns s encoded as a JSON string.
+func jsonString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
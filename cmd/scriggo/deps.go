@@ -0,0 +1,56 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/open2b/scriggo"
+)
+
+// deps executes the sub command "deps":
+//
+//	scriggo deps
+func deps(names []string, flags buildFlags) error {
+	var all []scriggo.Dependency
+	for _, name := range names {
+		fsys, name, err := templateFileSystem(name, flags)
+		if err != nil {
+			return err
+		}
+		opts, err := templateBuildOptions(name, flags)
+		if err != nil {
+			return err
+		}
+		template, err := scriggo.BuildTemplate(fsys, name, opts)
+		if err != nil {
+			return err
+		}
+		all = append(all, template.Dependencies()...)
+	}
+	out := bufio.NewWriter(os.Stdout)
+	writeDependencies(out, all, flags.l)
+	return out.Flush()
+}
+
+// writeDependencies writes the dependencies deps to w. If list is true, it
+// writes only the paths of the dependencies, once per path, otherwise it
+// writes also the positions and the kinds of the references.
+func writeDependencies(w io.Writer, deps []scriggo.Dependency, list bool) {
+	written := map[string]bool{}
+	for _, dep := range deps {
+		if list {
+			if !written[dep.Path] {
+				_, _ = fmt.Fprintln(w, dep.Path)
+				written[dep.Path] = true
+			}
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "%s:%s: %s %s\n", dep.File, dep.Position, dep.Kind, dep.Path)
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/open2b/scriggo"
+)
+
+// TestWriteDependencies tests the writeDependencies function.
+func TestWriteDependencies(t *testing.T) {
+	deps := []scriggo.Dependency{
+		{Path: "layout.html", File: "index.html", Kind: scriggo.DependencyExtends, Position: scriggo.Position{Line: 1, Column: 4}},
+		{Path: "macros.html", File: "layout.html", Kind: scriggo.DependencyImport, Position: scriggo.Position{Line: 1, Column: 11}},
+		{Path: "macros.html", File: "index.html", Kind: scriggo.DependencyImport, Position: scriggo.Position{Line: 1, Column: 38}},
+		{Path: "footer.html", File: "index.html", Kind: scriggo.DependencyRender, Position: scriggo.Position{Line: 3, Column: 7}},
+	}
+	var b strings.Builder
+	writeDependencies(&b, deps, false)
+	expected := "index.html:1:4: extends layout.html\n" +
+		"layout.html:1:11: import macros.html\n" +
+		"index.html:1:38: import macros.html\n" +
+		"index.html:3:7: render footer.html\n"
+	if b.String() != expected {
+		t.Fatalf("expected output %q, got %q", expected, b.String())
+	}
+	b.Reset()
+	writeDependencies(&b, deps, true)
+	expected = "layout.html\nmacros.html\nfooter.html\n"
+	if b.String() != expected {
+		t.Fatalf("expected output %q, got %q", expected, b.String())
+	}
+}
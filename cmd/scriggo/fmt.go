@@ -0,0 +1,100 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/ast/astutil"
+)
+
+// _fmt executes the sub command "fmt":
+//
+//	scriggo fmt
+func _fmt(names []string, write bool) error {
+	for _, name := range names {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		var out []byte
+		if filepath.Ext(name) == ".go" {
+			out, err = format.Source(src)
+			if err != nil {
+				return fmt.Errorf("%s:%s", name, err)
+			}
+		} else {
+			out, err = formatTemplate(filepath.Base(name), src)
+			if err != nil {
+				return err
+			}
+		}
+		if !write {
+			_, err = os.Stdout.Write(out)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if bytes.Equal(src, out) {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(name, out, fi.Mode().Perm())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatTemplate formats the source of the template file with the given
+// name. The format of the file is determined by the extension of name.
+func formatTemplate(name string, src []byte) ([]byte, error) {
+	printed, err := printTemplate(name, src)
+	if err != nil {
+		return nil, err
+	}
+	// The parser skips the shebang line, so it is copied from the source.
+	var out []byte
+	if bytes.HasPrefix(src, []byte("#!")) {
+		shebang := src
+		if i := bytes.IndexByte(src, '\n'); i >= 0 {
+			shebang = src[:i+1]
+		}
+		out = append(out, shebang...)
+	}
+	out = append(out, printed...)
+	// Check that the formatted source is parsed to a tree that is printed in
+	// the same way, so the formatting cannot change the template.
+	if again, err := printTemplate(name, out); err != nil || !bytes.Equal(again, printed) {
+		return nil, fmt.Errorf("%s: cannot format the template without changing it", name)
+	}
+	return out, nil
+}
+
+// printTemplate parses the source of the named template file, without
+// expanding it, and returns the printed tree.
+func printTemplate(name string, src []byte) ([]byte, error) {
+	fsys := scriggo.Files{name: src}
+	tree, err := scriggo.ParseTemplate(fsys, name, &scriggo.ParseOptions{NoExpand: true})
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	err = astutil.Fprint(&b, tree)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,39 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+// TestFormatTemplate tests the formatTemplate function.
+func TestFormatTemplate(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{"", ""},
+		{"<b>{{a}}</b>", "<b>{{ a }}</b>"},
+		{"{%if a%}\n  {%show a,b%}\n{%end if%}", "{% if a %}\n  {% show a, b %}\n{% end %}"},
+		{"#!/usr/bin/env scriggo\n{{a}}", "#!/usr/bin/env scriggo\n{{ a }}"},
+		{"{% x:=1 // set x\n%}", "{% x := 1 // set x\n %}"},
+	}
+	for _, test := range tests {
+		got, err := formatTemplate("index.html", []byte(test.src))
+		if err != nil {
+			t.Fatalf("source %q: unexpected error: %s", test.src, err)
+		}
+		if string(got) != test.expected {
+			t.Fatalf("source %q: expected %q, got %q", test.src, test.expected, string(got))
+		}
+	}
+	_, err := formatTemplate("index.html", []byte("{% if %}"))
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if err.Error() != "index.html:1:7: syntax error: missing condition in if statement" {
+		t.Fatalf("unexpected error %q", err)
+	}
+}
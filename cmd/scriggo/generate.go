@@ -27,8 +27,9 @@ import (
 func renderPackages(w io.Writer, dir string, sf *scriggofile, goos string, flags buildFlags) error {
 
 	type packageType struct {
-		name string
-		decl map[string]string
+		name  string
+		decl  map[string]string
+		stubs []string
 	}
 	cache := newPackageNameCache()
 
@@ -55,7 +56,7 @@ func renderPackages(w io.Writer, dir string, sf *scriggofile, goos string, flags
 		if flags.v {
 			_, _ = fmt.Fprintf(os.Stderr, "%s\n", imp.path)
 		}
-		pkgName, decls, refToImport, refToReflect, err := loadGoPackage(imp.path, dir, goos, flags, imp.including, imp.excluding, cache)
+		pkgName, decls, stubs, refToImport, refToReflect, err := loadGoPackage(imp.path, dir, goos, flags, imp.including, imp.excluding, cache)
 		if err != nil {
 			return err
 		}
@@ -109,7 +110,7 @@ func renderPackages(w io.Writer, dir string, sf *scriggofile, goos string, flags
 		switch imp.asPath {
 		case "main": // Add read declarations to package main as builtins.
 			if packages["main"] == nil {
-				packages["main"] = &packageType{"main", map[string]string{}}
+				packages["main"] = &packageType{name: "main", decl: map[string]string{}}
 			}
 			for name, decl := range decls {
 				if _, ok := packages["main"].decl[name]; ok {
@@ -117,6 +118,7 @@ func renderPackages(w io.Writer, dir string, sf *scriggofile, goos string, flags
 				}
 				packages["main"].decl[name] = decl
 			}
+			packages["main"].stubs = append(packages["main"].stubs, stubs...)
 		default: // Add read declarations to the specified package.
 			if packages[path] == nil {
 				packages[path] = &packageType{
@@ -130,6 +132,7 @@ func renderPackages(w io.Writer, dir string, sf *scriggofile, goos string, flags
 				packages[path].decl[name] = decl
 				packages[path].name = pkgName
 			}
+			packages[path].stubs = append(packages[path].stubs, stubs...)
 		}
 
 	}
@@ -172,6 +175,7 @@ func renderPackages(w io.Writer, dir string, sf *scriggofile, goos string, flags
 		Variable     string
 		Path, Name   string
 		Declarations []declaration
+		Stubs        []string
 	}, len(paths))
 	for i, path := range paths {
 		pkg := packages[path]
@@ -191,11 +195,13 @@ func renderPackages(w io.Writer, dir string, sf *scriggofile, goos string, flags
 			Variable     string
 			Path, Name   string
 			Declarations []declaration
+			Stubs        []string
 		}{
 			Variable:     sf.variable,
 			Path:         strconv.Quote(path),
 			Name:         strconv.Quote(pkg.name),
 			Declarations: declarations,
+			Stubs:        pkg.stubs,
 		}
 	}
 
@@ -231,6 +237,9 @@ func init() {
 		Name:         {{.Name}},
 		Declarations: decs,
 	}
+	{{- range .Stubs}}
+	{{.}}
+	{{- end}}
 
 	{{- end}}
 }
@@ -256,6 +265,10 @@ func init() {
 // loadGoPackage loads the Go package with the given path and returns its name
 // and its exported declarations.
 //
+// If the flag stubs is set, it also returns the code that registers the
+// stubs of the functions and of the methods of the types in the exported
+// declarations.
+//
 // refToImport reports whether at least one declaration refers to the import
 // path directly; for example when importing a package with no declarations or
 // where all declarations are constant literals refToImport is false.
@@ -263,7 +276,7 @@ func init() {
 // refToScriggo reports whether at least one of the declarations refers to the
 // package 'scriggo', while refToReflect reports whether at least one of the
 // declarations refers to the package 'reflect'.
-func loadGoPackage(path, dir, goos string, flags buildFlags, including, excluding []string, cache packageNameCache) (name string, decl map[string]string, refToImport, refToReflect bool, err error) {
+func loadGoPackage(path, dir, goos string, flags buildFlags, including, excluding []string, cache packageNameCache) (name string, decl map[string]string, stubs []string, refToImport, refToReflect bool, err error) {
 
 	allowed := func(n string) bool {
 		if len(including) > 0 {
@@ -301,32 +314,33 @@ func loadGoPackage(path, dir, goos string, flags buildFlags, including, excludin
 	if dir != "" {
 		cwd, err := os.Getwd()
 		if err != nil {
-			return "", nil, false, false, fmt.Errorf("scriggo: can't get current directory: %s", err)
+			return "", nil, nil, false, false, fmt.Errorf("scriggo: can't get current directory: %s", err)
 		}
 		err = os.Chdir(dir)
 		if err != nil {
-			return "", nil, false, false, fmt.Errorf("scriggo: can't change current directory: %s", err)
+			return "", nil, nil, false, false, fmt.Errorf("scriggo: can't change current directory: %s", err)
 		}
 		defer func() {
 			err = os.Chdir(cwd)
 			if err != nil {
 				name = ""
 				decl = nil
+				stubs = nil
 				err = fmt.Errorf("scriggo: can't change current directory: %s", err)
 			}
 		}()
 	}
 	packages, err := pkgs.Load(conf, path)
 	if err != nil {
-		return "", nil, false, false, err
+		return "", nil, nil, false, false, err
 	}
 
 	if pkgs.PrintErrors(packages) > 0 {
-		return "", nil, false, false, errors.New("error")
+		return "", nil, nil, false, false, errors.New("error")
 	}
 
 	if len(packages) > 1 {
-		return "", nil, false, false, errors.New("package query returned more than one package")
+		return "", nil, nil, false, false, errors.New("package query returned more than one package")
 	}
 
 	if len(packages) != 1 {
@@ -337,6 +351,7 @@ func loadGoPackage(path, dir, goos string, flags buildFlags, including, excludin
 	pkgBase := cache.uniquePackageName(path, name)
 
 	numUntyped := 0
+	stubsOf := map[string][]string{}
 
 	for _, v := range packages[0].TypesInfo.Defs {
 		// Include only exported names. Do not take into account whether the
@@ -393,6 +408,11 @@ func loadGoPackage(path, dir, goos string, flags buildFlags, including, excludin
 		case *types.Func:
 			if v.Type().(*types.Signature).Recv() == nil {
 				decl[v.Name()] = fmt.Sprintf("%s.%s", pkgBase, v.Name())
+				if flags.stubs {
+					if stub, ok := funcStub(v, pkgBase); ok {
+						stubsOf[v.Name()] = []string{stub}
+					}
+				}
 			}
 		case *types.Var:
 			if !v.Embedded() && !v.IsField() {
@@ -401,10 +421,23 @@ func loadGoPackage(path, dir, goos string, flags buildFlags, including, excludin
 		case *types.TypeName:
 			decl[v.Name()] = fmt.Sprintf("reflect.TypeOf((*%s.%s)(nil)).Elem()", pkgBase, v.Name())
 			refToReflect = true
+			if flags.stubs {
+				stubsOf[v.Name()] = methodStubs(v, pkgBase)
+			}
 		}
 	}
 
 	refToImport = len(decl) > numUntyped
 
-	return name, decl, refToImport, refToReflect, nil
+	// Sort the stubs by declaration name.
+	stubNames := make([]string, 0, len(stubsOf))
+	for n := range stubsOf {
+		stubNames = append(stubNames, n)
+	}
+	sort.Strings(stubNames)
+	for _, n := range stubNames {
+		stubs = append(stubs, stubsOf[n]...)
+	}
+
+	return name, decl, stubs, refToImport, refToReflect, nil
 }
@@ -20,6 +20,14 @@ The commands are:
     serve       run a web server and serve the template rooted at the current
                 directory
 
+    deps        print the files extended, imported and rendered by templates
+
+    fmt         format templates and Go source files
+
+    lsp         run a language server for templates
+
+    dap         run a debug adapter for templates and programs
+
     init        initialize an interpreter for Go programs
 
     import      generate the source for an importer used by Scriggo to import 
@@ -93,7 +101,7 @@ See also: scriggo import.
 `
 
 const helpImport = `
-usage: scriggo import [-f Scriggofile] [-v] [-x] [-o output] [module]
+usage: scriggo import [-f Scriggofile] [-v] [-x] [-o output] [-stubs] [module]
 
 Import generate the code for a package importer. An importer is used by Scriggo
 to import a package when an 'import' statement is executed.
@@ -135,6 +143,13 @@ The -x flag prints the executed commands.
 The -o flag writes the generated Go file to the named output file, instead to
 the standard output.
 
+The -stubs flag also generates, for the imported functions and methods, stubs
+that call them without reflection. The stubs are registered in an init
+function with native.RegisterFuncStub and native.RegisterMethodStub. Only the
+functions and methods that are not variadic and whose parameters and results
+have boolean, integer, floating-point or string types have a stub; the others
+are called with reflection.
+
 For more about the Scriggofile specific format, see 'scriggo help Scriggofile'.
 
 `
@@ -171,6 +186,11 @@ The run flags are:
 		use the named file format: Text, HTML, Markdown, CSS, JS or JSON.
 	-metrics
 		print metrics about execution time.
+	-cpuprofile file
+		write a CPU profile of the execution to the named file, in the
+		format of pprof. The profile has the number of instructions and
+		the time per function, macro and line, and it can be read with
+		'go tool pprof'.
 	-S n
 		print the assembly code of the executed file to the standard error.
 		n determines the maximum length, in runes, of disassembled Text
@@ -192,6 +212,122 @@ Examples:
 
 	scriggo run -o ./public ./sources/index.html
 
+	scriggo run -cpuprofile cpu.prof index.html
+
+`
+
+const helpDeps = `
+usage: scriggo deps [-l] [deps flags] file...
+
+Deps prints the dependencies of template files, that are the files extended,
+imported and rendered by the template files and, transitively, by these files.
+
+For example:
+
+    scriggo deps article.html
+
+prints a line for every reference to a file, with the path and the position
+of the file that contains the reference, the kind of the reference and the
+path of the referenced file:
+
+    article.html:1:4: extends layout.html
+    layout.html:1:11: import macros.html
+
+The template files are built, as with the run command, so they must not have
+errors. Paths are relative to the directory of each template file.
+
+The -l flag prints only the paths of the referenced files, once per path, for
+all the template files.
+
+The deps flags are:
+
+	-root dir
+		set the root directory to dir instead of the file's directory.
+	-const name=value
+		build the template files with a global constant with the given name
+		and value. name should be a Go identifier and value should be a
+		string literal, a number literal, true or false. There can be
+		multiple name=value pairs.
+	-format format
+		use the named file format: Text, HTML, Markdown, CSS, JS or JSON.
+`
+
+const helpFmt = `
+usage: scriggo fmt [-w] file...
+
+Fmt formats template and Go source files and prints the result to the
+standard output.
+
+For example:
+
+    scriggo fmt -w index.html layout.html main.go
+
+In templates, the code in {{ }}, {% %} and {%% %%} is formatted with a single
+space after the opening delimiter and before the closing one, the show
+statements with a single expression are written as {{ ... }} and the blocks
+are closed with {% end %}. The text is left unchanged. Files with the .go
+extension are formatted as gofmt does.
+
+The template files are only parsed, so the files they extend, import and
+render are not read and the code can refer to undeclared names.
+
+The -w flag writes the result to the files, instead of the standard output,
+if it differs from their content.
+`
+
+const helpLsp = `
+usage: scriggo lsp [-f Scriggofile]
+
+Lsp runs a language server for templates that communicates with an editor,
+over the standard input and output, with the Language Server Protocol.
+
+It provides:
+
+* the diagnostics of the errors found parsing and type checking the open
+  templates
+
+* the types of the names and expressions when hovering them
+
+* the definitions of macros, variables and constants, of imported and
+  rendered template files and of native functions
+
+* the completion of the global declarations
+
+The templates are type checked, as with the run command, with the global
+declarations of the scriggo command. The paths are relative to the root of
+the workspace, if the template file is in the workspace, otherwise they are
+relative to the directory of the template file.
+
+The -f flag completes the declarations imported by the named Scriggofile,
+instead of the global declarations of the scriggo command. See 'scriggo help
+Scriggofile' for more information about the Scriggofile.
+`
+
+const helpDap = `
+usage: scriggo dap
+
+Dap runs a debug adapter for templates and programs that communicates with an
+editor, over the standard input and output, with the Debug Adapter Protocol.
+
+It supports line breakpoints, pause, step in, step over and step out, and the
+inspection of the call stack and of the local variables of the main goroutine.
+
+The launch request has the following arguments:
+
+    program
+        path of the template file to debug or, for a program, path of its
+        directory or of its main Go file. A program can import only the
+        packages of its module.
+
+    root
+        root directory of the template, as for the -root flag of the run
+        command. By default it is the directory of the template file.
+
+    stopOnEntry
+        reports whether the execution stops at the first line.
+
+The templates are executed, as with the run command, with the global
+declarations of the scriggo command, and their output is sent to the editor.
 `
 
 const helpServe = `
@@ -326,14 +462,18 @@ Limitations
     under development. To check the state of a limitation please refer to the
     Github issue linked in the list below.
 
-    * methods declarations (issue #458)
-    * interface types definition (issue #218)
     * assigning to non-variables in 'for range' statements (issue #182)
     * importing the "unsafe" package from Scriggo (issue #288)
     * importing the "runtime" package from Scriggo (issue #524)
     * labeled continue and break statements (issue #83)
     * some kinds of pointer shorthands (issue #383)
     * compilation of non-main packages without importing them (issue #521)
+    * type checking of the bodies of generic functions and methods before
+      they are instantiated, and generic types declared inside functions
+    * methods declared in Scriggo and promoted through embedded fields cannot
+      be used in method expressions
+    * method expressions of interface types defined in Scriggo, and method
+      expressions (*T).M of methods declared with a value receiver
 
     For a comprehensive list of not-yet-implemented features
     see https://github.com/open2b/scriggo/labels/missing-feature.
@@ -359,6 +499,13 @@ Limitations due to maintain the interoperability with Go official compiler 'gc'
       limitation of the StructOf function of reflect.
       See Go issue #15924 (https://github.com/golang/go/issues/15924).
 
+    * methods declared in Scriggo are not seen by the 'reflect' package, and
+      native code sees only the String and Error methods of a value with a
+      Scriggo defined type. So a Scriggo defined type can implement a native
+      interface type only if the interface has no other methods. For the same
+      reason, interface types defined in Scriggo are seen by native code as
+      the empty interface type.
+
     * cannot define functions without a body (TODO)
 
     * a select supports a maximum of 65536 cases.
@@ -375,12 +522,12 @@ Arbitrary limitations
     These limitations have been arbitrarily added to Scriggo to enhance
     performances:
 
-    * 127 registers of a given type (integer, floating point, string or
+    * 32767 registers of a given type (integer, floating point, string or
       general) per function
-    * 256 function literal declarations plus unique functions calls per
+    * 65536 function literal declarations plus unique functions calls per
       function
     * 256 types available per function
-    * 256 unique native functions per function
+    * 65536 unique native functions per function
     * 16384 integer values per function
     * 256 string values per function
     * 16384 floating-point values per function
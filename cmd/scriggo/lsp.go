@@ -0,0 +1,608 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/native"
+)
+
+// Completion item kinds of the Language Server Protocol.
+const (
+	completionFunction = 3
+	completionVariable = 6
+	completionClass    = 7
+	completionModule   = 9
+	completionValue    = 12
+	completionConstant = 21
+)
+
+// lsp executes the sub command "lsp":
+//
+//	scriggo lsp
+//
+// It reads the messages of the Language Server Protocol from in and writes
+// the responses and the notifications to out.
+func lsp(in io.Reader, out io.Writer, flags buildFlags) error {
+	s := &lspServer{
+		out:  out,
+		docs: map[string][]byte{},
+	}
+	if flags.f == "" {
+		s.completions = globalsCompletions(globals)
+	} else {
+		items, err := scriggofileCompletions(flags.f)
+		if err != nil {
+			return err
+		}
+		s.completions = items
+	}
+	r := bufio.NewReader(in)
+	for {
+		msg, err := readLSPMessage(r)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		exit, err := s.handle(msg)
+		if err != nil {
+			return err
+		}
+		if exit {
+			if !s.shutdown {
+				return errors.New("exit notification received before the shutdown request")
+			}
+			return nil
+		}
+	}
+}
+
+// lspServer is a language server for templates.
+type lspServer struct {
+	out         io.Writer
+	root        string            // root directory of the workspace; it can be empty.
+	docs        map[string][]byte // open documents by path.
+	completions []lspCompletionItem
+	shutdown    bool // reports whether the shutdown request has been received.
+}
+
+// lspMessage is a request or a notification.
+type lspMessage struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspCompletionItem struct {
+	Label string `json:"label"`
+	Kind  int    `json:"kind"`
+}
+
+type lspTextDocumentPosition struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position lspPosition `json:"position"`
+}
+
+// handle handles the message msg. It returns true if msg is the exit
+// notification.
+func (s *lspServer) handle(msg []byte) (bool, error) {
+	var m lspMessage
+	err := json.Unmarshal(msg, &m)
+	if err != nil {
+		return false, s.respondError(nil, -32700, "parse error")
+	}
+	var result interface{}
+	switch m.Method {
+	case "initialize":
+		var params struct {
+			RootURI  *string `json:"rootUri"`
+			RootPath *string `json:"rootPath"`
+		}
+		_ = json.Unmarshal(m.Params, &params)
+		if params.RootURI != nil {
+			s.root, _ = uriToPath(*params.RootURI)
+		} else if params.RootPath != nil {
+			s.root = *params.RootPath
+		}
+		result = map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   1, // full
+				"hoverProvider":      true,
+				"definitionProvider": true,
+				"completionProvider": map[string]interface{}{},
+			},
+			"serverInfo": map[string]string{
+				"name":    "scriggo",
+				"version": version(),
+			},
+		}
+	case "initialized", "$/cancelRequest", "$/setTrace":
+		return false, nil
+	case "shutdown":
+		s.shutdown = true
+	case "exit":
+		return true, nil
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(m.Params, &params); err != nil {
+			return false, nil
+		}
+		return false, s.update(params.TextDocument.URI, []byte(params.TextDocument.Text))
+	case "textDocument/didChange":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err := json.Unmarshal(m.Params, &params); err != nil || len(params.ContentChanges) == 0 {
+			return false, nil
+		}
+		text := params.ContentChanges[len(params.ContentChanges)-1].Text
+		return false, s.update(params.TextDocument.URI, []byte(text))
+	case "textDocument/didClose":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(m.Params, &params); err != nil {
+			return false, nil
+		}
+		if name, ok := uriToPath(params.TextDocument.URI); ok {
+			delete(s.docs, name)
+		}
+		return false, s.publishDiagnostics(params.TextDocument.URI, nil)
+	case "textDocument/hover":
+		var params lspTextDocumentPosition
+		if err := json.Unmarshal(m.Params, &params); err != nil {
+			return false, s.respondError(m.ID, -32602, "invalid params")
+		}
+		result = s.hover(params)
+	case "textDocument/definition":
+		var params lspTextDocumentPosition
+		if err := json.Unmarshal(m.Params, &params); err != nil {
+			return false, s.respondError(m.ID, -32602, "invalid params")
+		}
+		result = s.definition(params)
+	case "textDocument/completion":
+		result = s.completions
+	default:
+		if m.ID == nil {
+			// Ignore unknown notifications.
+			return false, nil
+		}
+		return false, s.respondError(m.ID, -32601, "method not found: "+m.Method)
+	}
+	if m.ID == nil {
+		return false, nil
+	}
+	return false, s.write(map[string]interface{}{"jsonrpc": "2.0", "id": m.ID, "result": result})
+}
+
+// update updates the content of the document with the given URI and
+// publishes its diagnostics.
+func (s *lspServer) update(uri string, src []byte) error {
+	name, ok := uriToPath(uri)
+	if !ok || filepath.Ext(name) == ".go" {
+		// Only template files are analyzed.
+		return nil
+	}
+	s.docs[name] = src
+	_, err := s.analyze(name)
+	var diagnostics []lspDiagnostic
+	if errs, ok := err.(scriggo.BuildErrors); ok {
+		for _, err := range errs {
+			diagnostics = append(diagnostics, s.diagnostic(name, err))
+		}
+	} else if err != nil {
+		diagnostics = append(diagnostics, s.diagnostic(name, err))
+	}
+	return s.publishDiagnostics(uri, diagnostics)
+}
+
+// templateName returns the root directory of the template file with the
+// given path and the name of the file relative to the root. The root is the
+// root of the workspace, if it contains the file, otherwise it is the
+// directory of the file.
+func (s *lspServer) templateName(name string) (string, string) {
+	if s.root != "" {
+		if rel, err := filepath.Rel(s.root, name); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return s.root, filepath.ToSlash(rel)
+		}
+	}
+	return filepath.Dir(name), filepath.Base(name)
+}
+
+// analyze analyzes the template file with the given path.
+func (s *lspServer) analyze(name string) (*scriggo.Analysis, error) {
+	root, rel := s.templateName(name)
+	fsys := lspFS{FS: os.DirFS(root), root: root, docs: s.docs}
+	opts, err := templateBuildOptions(rel, buildFlags{})
+	if err != nil {
+		return nil, err
+	}
+	// Report all the errors as diagnostics.
+	opts.MaxErrors = -1
+	return scriggo.AnalyzeTemplate(fsys, rel, opts)
+}
+
+// diagnostic returns the diagnostic for the error err occurred analyzing
+// the file with the given path.
+func (s *lspServer) diagnostic(name string, err error) lspDiagnostic {
+	d := lspDiagnostic{Severity: 1, Source: "scriggo", Message: err.Error()}
+	var e *scriggo.BuildError
+	if !errors.As(err, &e) {
+		return d
+	}
+	if _, rel := s.templateName(name); e.Path() != rel {
+		// The error is in another file.
+		return d
+	}
+	src := s.docs[name]
+	pos := e.Position()
+	start := lineColumnToOffset(src, pos.Line, pos.Column)
+	end := start
+	if pos.End > pos.Start && pos.Start == start {
+		end = pos.End + 1
+	}
+	d.Range = lspRange{Start: offsetToPosition(src, start), End: offsetToPosition(src, end)}
+	d.Message = e.Message()
+	return d
+}
+
+// publishDiagnostics publishes the diagnostics of the document with the
+// given URI.
+func (s *lspServer) publishDiagnostics(uri string, diagnostics []lspDiagnostic) error {
+	if diagnostics == nil {
+		diagnostics = []lspDiagnostic{}
+	}
+	return s.write(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "textDocument/publishDiagnostics",
+		"params": map[string]interface{}{
+			"uri":         uri,
+			"diagnostics": diagnostics,
+		},
+	})
+}
+
+// hover returns the result of an hover request.
+func (s *lspServer) hover(params lspTextDocumentPosition) interface{} {
+	name, a, ok := s.analysis(params.TextDocument.URI)
+	if !ok {
+		return nil
+	}
+	src := s.docs[name]
+	desc, pos, ok := a.Describe(positionToOffset(src, params.Position))
+	if !ok {
+		return nil
+	}
+	return map[string]interface{}{
+		"contents": map[string]string{
+			"kind":  "markdown",
+			"value": "```go\n" + desc + "\n```",
+		},
+		"range": lspRange{Start: offsetToPosition(src, pos.Start), End: offsetToPosition(src, pos.End+1)},
+	}
+}
+
+// definition returns the result of a definition request.
+func (s *lspServer) definition(params lspTextDocumentPosition) interface{} {
+	name, a, ok := s.analysis(params.TextDocument.URI)
+	if !ok {
+		return nil
+	}
+	loc, ok := a.Definition(positionToOffset(s.docs[name], params.Position))
+	if !ok {
+		return nil
+	}
+	file := loc.Path
+	if !loc.Native {
+		root, _ := s.templateName(name)
+		file = filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(loc.Path, "/")))
+	}
+	var pos lspPosition
+	if src, ok := s.docs[file]; ok {
+		pos = offsetToPosition(src, lineColumnToOffset(src, loc.Position.Line, loc.Position.Column))
+	} else if src, err := os.ReadFile(file); err == nil {
+		pos = offsetToPosition(src, lineColumnToOffset(src, loc.Position.Line, loc.Position.Column))
+	} else {
+		pos = lspPosition{Line: loc.Position.Line - 1}
+	}
+	return lspLocation{URI: pathToURI(file), Range: lspRange{Start: pos, End: pos}}
+}
+
+// analysis returns the path and the analysis of the open document with the
+// given URI. If the document is not open or it cannot be analyzed, it
+// returns false.
+func (s *lspServer) analysis(uri string) (string, *scriggo.Analysis, bool) {
+	name, ok := uriToPath(uri)
+	if !ok {
+		return "", nil, false
+	}
+	if _, ok := s.docs[name]; !ok {
+		return "", nil, false
+	}
+	a, _ := s.analyze(name)
+	if a == nil {
+		return "", nil, false
+	}
+	return name, a, true
+}
+
+// respondError responds to the request with the given id with an error.
+func (s *lspServer) respondError(id json.RawMessage, code int, message string) error {
+	return s.write(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"error":   map[string]interface{}{"code": code, "message": message},
+	})
+}
+
+// write writes the message v.
+func (s *lspServer) write(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	return err
+}
+
+// readLSPMessage reads a message, with its header, from r and returns its
+// content.
+func readLSPMessage(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line != "" {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			return nil, fmt.Errorf("invalid header line %q", line)
+		}
+		if name, value := line[:i], line[i+1:]; strings.EqualFold(name, "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || length < 0 {
+				return nil, fmt.Errorf("invalid Content-Length %q", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("missing Content-Length header")
+	}
+	msg := make([]byte, length)
+	_, err := io.ReadFull(r, msg)
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// lspFS is a file system that reads the open documents from memory and the
+// other files from FS.
+type lspFS struct {
+	fs.FS
+	root string
+	docs map[string][]byte
+}
+
+func (fsys lspFS) Open(name string) (fs.File, error) {
+	if src, ok := fsys.docs[filepath.Join(fsys.root, filepath.FromSlash(name))]; ok {
+		return scriggo.Files{name: src}.Open(name)
+	}
+	return fsys.FS.Open(name)
+}
+
+// uriToPath returns the path of a file URI.
+func uriToPath(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return "", false
+	}
+	return filepath.FromSlash(u.Path), true
+}
+
+// pathToURI returns the file URI of a path.
+func pathToURI(name string) string {
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(name)}
+	return u.String()
+}
+
+// positionToOffset returns the byte offset in src of the position pos.
+func positionToOffset(src []byte, pos lspPosition) int {
+	offset := 0
+	for line := 0; line < pos.Line; line++ {
+		i := strings.IndexByte(string(src[offset:]), '\n')
+		if i < 0 {
+			return len(src)
+		}
+		offset += i + 1
+	}
+	for n := 0; n < pos.Character && offset < len(src) && src[offset] != '\n'; {
+		r, size := utf8.DecodeRune(src[offset:])
+		n += len(utf16.Encode([]rune{r}))
+		offset += size
+	}
+	return offset
+}
+
+// offsetToPosition returns the position of the byte offset in src.
+func offsetToPosition(src []byte, offset int) lspPosition {
+	if offset > len(src) {
+		offset = len(src)
+	}
+	var pos lspPosition
+	for i := 0; i < offset; {
+		r, size := utf8.DecodeRune(src[i:])
+		if r == '\n' {
+			pos.Line++
+			pos.Character = 0
+		} else {
+			pos.Character += len(utf16.Encode([]rune{r}))
+		}
+		i += size
+	}
+	return pos
+}
+
+// lineColumnToOffset returns the byte offset in src of the given line and
+// column, both starting from 1, with the column in characters.
+func lineColumnToOffset(src []byte, line, column int) int {
+	offset := 0
+	for l := 1; l < line; l++ {
+		i := strings.IndexByte(string(src[offset:]), '\n')
+		if i < 0 {
+			return len(src)
+		}
+		offset += i + 1
+	}
+	for c := 1; c < column && offset < len(src) && src[offset] != '\n'; c++ {
+		_, size := utf8.DecodeRune(src[offset:])
+		offset += size
+	}
+	return offset
+}
+
+// globalsCompletions returns the completion items for the global
+// declarations decls.
+func globalsCompletions(decls native.Declarations) []lspCompletionItem {
+	items := make([]lspCompletionItem, 0, len(decls))
+	for name, value := range decls {
+		kind := completionConstant
+		switch v := value.(type) {
+		case native.ImportablePackage:
+			kind = completionModule
+		case reflect.Type:
+			kind = completionClass
+		case native.UntypedStringConst, native.UntypedBooleanConst, native.UntypedNumericConst:
+		case nil:
+		default:
+			switch reflect.TypeOf(v).Kind() {
+			case reflect.Func:
+				kind = completionFunction
+			case reflect.Ptr:
+				kind = completionVariable
+			}
+		}
+		items = append(items, lspCompletionItem{Label: name, Kind: kind})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+	return items
+}
+
+// scriggofileCompletions returns the completion items for the declarations
+// imported by the Scriggofile with the given path.
+func scriggofileCompletions(name string) ([]lspCompletionItem, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sf, err := parseScriggofile(f, runtime.GOOS)
+	if err != nil {
+		return nil, err
+	}
+	var items []lspCompletionItem
+	dir := filepath.Dir(name)
+	cache := newPackageNameCache()
+	for _, imp := range sf.imports {
+		if imp.stdlib {
+			for _, p := range stdLibPaths() {
+				items = append(items, lspCompletionItem{Label: path.Base(p), Kind: completionModule})
+			}
+			continue
+		}
+		if imp.asPath != "main" {
+			p := imp.path
+			if imp.asPath != "" {
+				p = imp.asPath
+			}
+			items = append(items, lspCompletionItem{Label: path.Base(p), Kind: completionModule})
+			continue
+		}
+		_, decls, _, _, _, err := loadGoPackage(imp.path, dir, runtime.GOOS, buildFlags{}, imp.including, imp.excluding, cache)
+		if err != nil {
+			return nil, err
+		}
+		for name, decl := range decls {
+			if imp.notCapitalized {
+				name = uncapitalize(name)
+			}
+			kind := completionValue
+			switch {
+			case strings.HasPrefix(decl, "native.Untyped"):
+				kind = completionConstant
+			case strings.HasPrefix(decl, "&"):
+				kind = completionVariable
+			case strings.HasPrefix(decl, "reflect.TypeOf"):
+				kind = completionClass
+			}
+			items = append(items, lspCompletionItem{Label: name, Kind: kind})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+	return items, nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestLSPPositions tests the conversions between positions and offsets.
+func TestLSPPositions(t *testing.T) {
+	src := []byte("a\nèb𝄞c\n")
+	tests := []struct {
+		offset int
+		pos    lspPosition
+	}{
+		{0, lspPosition{0, 0}},
+		{2, lspPosition{1, 0}},
+		{4, lspPosition{1, 1}},
+		{5, lspPosition{1, 2}},
+		{9, lspPosition{1, 4}},
+		{11, lspPosition{2, 0}},
+	}
+	for _, test := range tests {
+		if got := offsetToPosition(src, test.offset); got != test.pos {
+			t.Errorf("offset %d: expected position %v, got %v", test.offset, test.pos, got)
+		}
+		if got := positionToOffset(src, test.pos); got != test.offset {
+			t.Errorf("position %v: expected offset %d, got %d", test.pos, test.offset, got)
+		}
+	}
+	if got := lineColumnToOffset(src, 2, 4); got != 9 {
+		t.Errorf("line 2 column 4: expected offset 9, got %d", got)
+	}
+}
+
+// TestLSP tests a session of the language server.
+func TestLSP(t *testing.T) {
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "macros.html"), []byte("{% macro M(s string) %}{{ s }}{% end %}"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := filepath.Join(dir, "index.html")
+	uri := pathToURI(index)
+
+	var in bytes.Buffer
+	send := func(id int, method string, params interface{}) {
+		msg := map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+		if id > 0 {
+			msg["id"] = id
+		}
+		data, _ := json.Marshal(msg)
+		_, _ = fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	}
+	position := func(line, character int) interface{} {
+		return map[string]interface{}{
+			"textDocument": map[string]string{"uri": uri},
+			"position":     map[string]int{"line": line, "character": character},
+		}
+	}
+	send(1, "initialize", map[string]interface{}{"rootUri": pathToURI(dir)})
+	send(0, "initialized", map[string]interface{}{})
+	send(0, "textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]string{"uri": uri, "text": "{% import \"macros.html\" %}\n{{ M(1) }}{{ u }}"},
+	})
+	send(0, "textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]string{"uri": uri},
+		"contentChanges": []map[string]string{{"text": "{% import \"macros.html\" %}\n{% v := \"a\" %}{{ M(v) }}"}},
+	})
+	send(2, "textDocument/hover", position(1, 19))
+	send(3, "textDocument/definition", position(1, 17))
+	send(4, "textDocument/completion", position(1, 0))
+	send(5, "unknown", nil)
+	send(6, "shutdown", nil)
+	send(0, "exit", nil)
+
+	var out bytes.Buffer
+	err = lsp(&in, &out, buildFlags{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var messages []map[string]json.RawMessage
+	r := bufio.NewReader(&out)
+	for {
+		data, err := readLSPMessage(r)
+		if err != nil {
+			break
+		}
+		var msg map[string]json.RawMessage
+		err = json.Unmarshal(data, &msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, msg)
+	}
+	if len(messages) != 8 {
+		t.Fatalf("expected 8 messages, got %d", len(messages))
+	}
+
+	expected := []struct {
+		key   string
+		value string
+	}{
+		{"id", "1"},
+		{"params", `{"diagnostics":[{"range":{"start":{"line":1,"character":4},"end":{"line":1,"character":4}},"severity":1,"source":"scriggo","message":"cannot use 1 (type untyped int) as type string in argument to M"},{"range":{"start":{"line":1,"character":13},"end":{"line":1,"character":13}},"severity":1,"source":"scriggo","message":"undefined: u"}],"uri":"` + uri + `"}`},
+		{"params", `{"diagnostics":[],"uri":"` + uri + `"}`},
+		{"result", `{"contents":{"kind":"markdown","value":"` + "```go\\nvar v string\\n```" + `"},"range":{"start":{"line":1,"character":19},"end":{"line":1,"character":20}}}`},
+		{"result", `{"uri":"` + pathToURI(filepath.Join(dir, "macros.html")) + `","range":{"start":{"line":0,"character":9},"end":{"line":0,"character":9}}}`},
+		{"result", ""},
+		{"error", `{"code":-32601,"message":"method not found: unknown"}`},
+		{"result", "null"},
+	}
+	for i, e := range expected {
+		got, ok := messages[i][e.key]
+		if !ok {
+			t.Fatalf("message %d: expected %q, got %s", i+1, e.key, messages[i])
+		}
+		if e.value != "" && string(got) != e.value {
+			t.Fatalf("message %d: expected %s %s, got %s", i+1, e.key, e.value, got)
+		}
+	}
+	if !strings.Contains(string(messages[5]["result"]), `{"label":"base64","kind":3}`) {
+		t.Fatalf("expected base64 in completion items, got %s", messages[5]["result"])
+	}
+}
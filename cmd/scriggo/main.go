@@ -117,9 +117,21 @@ var commandsHelp = map[string]func(){
 	"import": func() {
 		txtToHelp(helpImport)
 	},
+	"dap": func() {
+		txtToHelp(helpDap)
+	},
+	"deps": func() {
+		txtToHelp(helpDeps)
+	},
+	"fmt": func() {
+		txtToHelp(helpFmt)
+	},
 	"init": func() {
 		txtToHelp(helpInit)
 	},
+	"lsp": func() {
+		txtToHelp(helpLsp)
+	},
 	"run": func() {
 		txtToHelp(helpRun)
 	},
@@ -155,6 +167,39 @@ var commands = map[string]func(){
 		fmt.Fprintf(os.Stdout, "If you encountered an issue, report it at:\n\n\thttps://github.com/open2b/scriggo/issues/new\n\n")
 		exit(0)
 	},
+	"deps": func() {
+		flag.Usage = commandsHelp["deps"]
+		root := flag.String("root", "", "set the root directory to named dir instead of the file's directory.")
+		var consts []string
+		flag.Func("const", "build with global constants with the given names and values.", func(s string) error {
+			consts = append(consts, s)
+			return nil
+		})
+		format := flag.String("format", "", "force deps to use the named file format.")
+		l := flag.Bool("l", false, "print only the paths of the dependencies.")
+		flag.Parse()
+		if len(flag.Args()) == 0 {
+			exitError("%s", "missing file name")
+		}
+		err := deps(flag.Args(), buildFlags{consts: consts, format: *format, l: *l, root: *root})
+		if err != nil {
+			exitError("%s", err)
+		}
+		exit(0)
+	},
+	"fmt": func() {
+		flag.Usage = commandsHelp["fmt"]
+		w := flag.Bool("w", false, "write the result to the files instead of stdout.")
+		flag.Parse()
+		if len(flag.Args()) == 0 {
+			exitError("%s", "missing file name")
+		}
+		err := _fmt(flag.Args(), *w)
+		if err != nil {
+			exitError("%s", err)
+		}
+		exit(0)
+	},
 	"init": func() {
 		flag.Usage = commandsHelp["init"]
 		f := flag.String("f", "", "path of the Scriggofile.")
@@ -181,6 +226,7 @@ var commands = map[string]func(){
 		v := flag.Bool("v", false, "print the names of packages as the are imported.")
 		x := flag.Bool("x", false, "print the commands.")
 		o := flag.String("o", "", "write the source to the named file instead of stdout.")
+		stubs := flag.Bool("stubs", false, "generate stubs to call functions and methods without reflection.")
 		flag.Parse()
 		var path string
 		switch n := len(flag.Args()); n {
@@ -191,7 +237,34 @@ var commands = map[string]func(){
 			flag.Usage()
 			exitError(`bad number of arguments`)
 		}
-		err := _import(path, buildFlags{f: *f, v: *v, x: *x, o: *o})
+		err := _import(path, buildFlags{f: *f, v: *v, x: *x, o: *o, stubs: *stubs})
+		if err != nil {
+			exitError("%s", err)
+		}
+		exit(0)
+	},
+	"dap": func() {
+		flag.Usage = commandsHelp["dap"]
+		flag.Parse()
+		if len(flag.Args()) > 0 {
+			flag.Usage()
+			exitError(`bad number of arguments`)
+		}
+		err := dap(os.Stdin, os.Stdout)
+		if err != nil {
+			exitError("%s", err)
+		}
+		exit(0)
+	},
+	"lsp": func() {
+		flag.Usage = commandsHelp["lsp"]
+		f := flag.String("f", "", "path of the Scriggofile with the declarations to complete.")
+		flag.Parse()
+		if len(flag.Args()) > 0 {
+			flag.Usage()
+			exitError(`bad number of arguments`)
+		}
+		err := lsp(os.Stdin, os.Stdout, buildFlags{f: *f})
 		if err != nil {
 			exitError("%s", err)
 		}
@@ -208,6 +281,7 @@ var commands = map[string]func(){
 		format := flag.String("format", "", "force run to use the named file format.")
 		s := flag.Int("S", 0, "print assembly listing. n determines the length of Text instructions.")
 		metrics := flag.Bool("metrics", false, "print metrics about file execution.")
+		cpuprofile := flag.String("cpuprofile", "", "write a CPU profile of the execution to the named file.")
 		o := flag.String("o", "", "write the resulting code to the named file or directory instead of stdout.")
 		flag.Parse()
 		asm := -2 // -2: no assembler
@@ -228,7 +302,7 @@ var commands = map[string]func(){
 		default:
 			exitError("%s", "too many file names")
 		}
-		err := run(name, buildFlags{consts: consts, format: *format, metrics: *metrics, o: *o, root: *root, s: asm})
+		err := run(name, buildFlags{consts: consts, cpuprofile: *cpuprofile, format: *format, metrics: *metrics, o: *o, root: *root, s: asm})
 		if err != nil {
 			exitError("%s", err)
 		}
@@ -416,10 +490,11 @@ func _import(path string, flags buildFlags) (err error) {
 }
 
 type buildFlags struct {
-	metrics, work, v, x, w bool
-	f, format, o, root     string
-	consts                 []string
-	s                      int
+	metrics, work, v, x, w, l      bool
+	stubs                          bool
+	cpuprofile, f, format, o, root string
+	consts                         []string
+	s                              int
 }
 
 // _init executes the sub commands "init":
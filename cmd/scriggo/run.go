@@ -36,55 +36,14 @@ const runBufSize = 65536
 //	scriggo run
 func run(name string, flags buildFlags) (err error) {
 
-	var fsys fs.FS
-	if flags.root == "" {
-		fsys = os.DirFS(filepath.Dir(name))
-		name = filepath.Base(name)
-	} else {
-		root, err := filepath.Abs(flags.root)
-		if err != nil {
-			return err
-		}
-		nameAbs, err := filepath.Abs(name)
-		if err != nil {
-			return err
-		}
-		name, err = filepath.Rel(root, nameAbs)
-		if err != nil {
-			return err
-		}
-		fsys = os.DirFS(root)
-	}
-
-	// Handle "-format" option.
-	if flags.f != "" {
-		format, err := parseFormat(flags.f)
-		if err != nil {
-			return err
-		}
-		fsys = formatFS{FS: fsys, format: format}
-	}
-
-	md := goldmark.New(
-		goldmark.WithRendererOptions(html.WithUnsafe()),
-		goldmark.WithParserOptions(parser.WithAutoHeadingID()),
-		goldmark.WithExtensions(extension.GFM))
-
-	opts := &scriggo.BuildOptions{
-		AllowGoStmt: true,
-		Globals:     globals,
-		MarkdownConverter: func(src []byte, out io.Writer) error {
-			return md.Convert(src, out)
-		},
+	fsys, name, err := templateFileSystem(name, flags)
+	if err != nil {
+		return err
 	}
-	opts.Globals["filepath"] = strings.TrimSuffix(name, path.Ext(name))
 
-	// Handle "-const" option.
-	for _, consts := range flags.consts {
-		err = parseConstants(consts, opts.Globals)
-		if err != nil {
-			return err
-		}
+	opts, err := templateBuildOptions(name, flags)
+	if err != nil {
+		return err
 	}
 
 	var start time.Time
@@ -128,8 +87,14 @@ func run(name string, flags buildFlags) (err error) {
 		start = time.Now()
 	}
 
+	// Handle "-cpuprofile" option.
+	var runOpts *scriggo.RunOptions
+	if flags.cpuprofile != "" {
+		runOpts = &scriggo.RunOptions{Profiler: &scriggo.Profiler{}}
+	}
+
 	// Run the template.
-	err = template.Run(buf, nil, nil)
+	err = template.Run(buf, nil, runOpts)
 
 	if flags.metrics {
 		runTime := time.Since(start)
@@ -142,9 +107,92 @@ func run(name string, flags buildFlags) (err error) {
 		err = buf.Flush()
 	}
 
+	if err == nil && runOpts != nil {
+		err = writeProfile(flags.cpuprofile, runOpts.Profiler)
+	}
+
 	return err
 }
 
+// writeProfile writes the profile collected by p to the named file.
+func writeProfile(name string, p *scriggo.Profiler) error {
+	fi, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	err = p.WriteProfile(fi)
+	if err2 := fi.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// templateFileSystem returns the file system of the named template file and
+// the name of the file in the file system, as determined by the -root and
+// -format flags.
+func templateFileSystem(name string, flags buildFlags) (fs.FS, string, error) {
+
+	var fsys fs.FS
+	if flags.root == "" {
+		fsys = os.DirFS(filepath.Dir(name))
+		name = filepath.Base(name)
+	} else {
+		root, err := filepath.Abs(flags.root)
+		if err != nil {
+			return nil, "", err
+		}
+		nameAbs, err := filepath.Abs(name)
+		if err != nil {
+			return nil, "", err
+		}
+		name, err = filepath.Rel(root, nameAbs)
+		if err != nil {
+			return nil, "", err
+		}
+		fsys = os.DirFS(root)
+	}
+
+	// Handle "-format" option.
+	if flags.format != "" {
+		format, err := parseFormat(flags.format)
+		if err != nil {
+			return nil, "", err
+		}
+		fsys = formatFS{FS: fsys, format: format}
+	}
+
+	return fsys, name, nil
+}
+
+// templateBuildOptions returns the options to build the named template file,
+// with the constants of the -const flag.
+func templateBuildOptions(name string, flags buildFlags) (*scriggo.BuildOptions, error) {
+
+	md := goldmark.New(
+		goldmark.WithRendererOptions(html.WithUnsafe()),
+		goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+		goldmark.WithExtensions(extension.GFM))
+
+	opts := &scriggo.BuildOptions{
+		AllowGoStmt: true,
+		Globals:     globals,
+		MarkdownConverter: func(src []byte, out io.Writer) error {
+			return md.Convert(src, out)
+		},
+	}
+	opts.Globals["filepath"] = strings.TrimSuffix(name, path.Ext(name))
+
+	// Handle "-const" option.
+	for _, consts := range flags.consts {
+		err := parseConstants(consts, opts.Globals)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return opts, nil
+}
+
 // parseFormat parses and returns a format.
 func parseFormat(s string) (scriggo.Format, error) {
 	switch s {
@@ -0,0 +1,215 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"go/types"
+	"strings"
+)
+
+// funcStub returns the code that registers the stub of the function fn of
+// the package with name pkgBase. ok is false if fn cannot have a stub.
+func funcStub(fn *types.Func, pkgBase string) (code string, ok bool) {
+	sig := fn.Type().(*types.Signature)
+	if isGeneric(sig) {
+		return "", false
+	}
+	body, ok := stubBody(pkgBase+"."+fn.Name(), sig, fn.Pkg(), pkgBase)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("native.RegisterFuncStub(%s.%s, %s)", pkgBase, fn.Name(), body), true
+}
+
+// methodStubs returns the code that registers the stubs of the methods of
+// the type with name typeName, and of its pointer type, of the package with
+// name pkgBase.
+func methodStubs(typeName *types.TypeName, pkgBase string) []string {
+	if typeName.IsAlias() {
+		return nil
+	}
+	named, ok := typeName.Type().(*types.Named)
+	if !ok || types.IsInterface(named) || isGeneric(named) {
+		return nil
+	}
+	var stubs []string
+	for _, typ := range []types.Type{named, types.NewPointer(named)} {
+		name := pkgBase + "." + typeName.Name()
+		reflectType := fmt.Sprintf("reflect.TypeOf((*%s)(nil)).Elem()", name)
+		if _, ok := typ.(*types.Pointer); ok {
+			name = "*" + name
+			reflectType = fmt.Sprintf("reflect.TypeOf((%s)(nil))", name)
+		}
+		methods := types.NewMethodSet(typ)
+		for i := 0; i < methods.Len(); i++ {
+			method := methods.At(i).Obj().(*types.Func)
+			if !method.Exported() {
+				continue
+			}
+			sig := method.Type().(*types.Signature)
+			call := fmt.Sprintf("r.Receiver.(%s).%s", name, method.Name())
+			body, ok := stubBody(call, sig, typeName.Pkg(), pkgBase)
+			if !ok {
+				continue
+			}
+			stubs = append(stubs, fmt.Sprintf("native.RegisterMethodStub(%s, %q, %s)", reflectType, method.Name(), body))
+		}
+	}
+	return stubs
+}
+
+// stubBody returns the function literal of a stub that calls the function
+// fun with signature sig. pkg is the package of the function, with name
+// pkgBase. ok is false if the function cannot be called by a stub.
+func stubBody(fun string, sig *types.Signature, pkg *types.Package, pkgBase string) (body string, ok bool) {
+	if sig.Variadic() || isStubIdentifier(pkgBase) {
+		return "", false
+	}
+	var b strings.Builder
+	b.WriteString("func(r *native.Registers) {\n")
+	// Count the results, as the arguments follow them in the registers.
+	index := map[string]int{}
+	results := sig.Results()
+	regs := make([]string, results.Len())
+	names := make([]string, results.Len())
+	for i := 0; i < results.Len(); i++ {
+		regs[i], names[i], ok = stubType(results.At(i).Type(), pkg, pkgBase)
+		if !ok {
+			return "", false
+		}
+	}
+	for _, reg := range regs {
+		index[reg]++
+	}
+	// Write the call.
+	b.WriteString("\t\t")
+	if len(regs) > 0 {
+		for i := range regs {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "v%d", i)
+		}
+		b.WriteString(" := ")
+	}
+	b.WriteString(fun)
+	b.WriteString("(")
+	params := sig.Params()
+	for i := 0; i < params.Len(); i++ {
+		reg, name, ok := stubType(params.At(i).Type(), pkg, pkgBase)
+		if !ok {
+			return "", false
+		}
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		arg := fmt.Sprintf("r.%s[%d]", reg, index[reg])
+		index[reg]++
+		switch {
+		case name == "bool":
+			arg += " != 0"
+		case isBasicBool(params.At(i).Type()):
+			arg = name + "(" + arg + " != 0)"
+		case name != registerTypes[reg]:
+			arg = name + "(" + arg + ")"
+		}
+		b.WriteString(arg)
+	}
+	b.WriteString(")\n")
+	// Write the results.
+	index = map[string]int{}
+	for i, reg := range regs {
+		dst := fmt.Sprintf("r.%s[%d]", reg, index[reg])
+		index[reg]++
+		if isBasicBool(results.At(i).Type()) {
+			fmt.Fprintf(&b, "\t\tif v%d {\n\t\t\t%s = 1\n\t\t} else {\n\t\t\t%s = 0\n\t\t}\n", i, dst, dst)
+			continue
+		}
+		if names[i] == registerTypes[reg] {
+			fmt.Fprintf(&b, "\t\t%s = v%d\n", dst, i)
+		} else {
+			fmt.Fprintf(&b, "\t\t%s = %s(v%d)\n", dst, registerTypes[reg], i)
+		}
+	}
+	b.WriteString("\t}")
+	return b.String(), true
+}
+
+// isStubIdentifier reports whether name is an identifier declared in the
+// body of a stub, and so it cannot be used as package name in the body.
+func isStubIdentifier(name string) bool {
+	if name == "r" {
+		return true
+	}
+	if len(name) < 2 || name[0] != 'v' {
+		return false
+	}
+	for _, c := range name[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// registerTypes maps the registers of native.Registers to their element
+// types.
+var registerTypes = map[string]string{
+	"Int":    "int64",
+	"Float":  "float64",
+	"String": "string",
+}
+
+// stubType returns the register, "Int", "Float" or "String", in which a
+// value of type t is passed to a stub and the name of t. pkg is the package
+// of the function, with name pkgBase. ok is false if t cannot be passed to a
+// stub.
+func stubType(t types.Type, pkg *types.Package, pkgBase string) (reg, name string, ok bool) {
+	switch t := t.(type) {
+	case *types.Basic:
+		name = t.Name()
+	case *types.Named:
+		// Only the types of the package can be referred by name.
+		obj := t.Obj()
+		if obj.Pkg() != pkg || !obj.Exported() || isGeneric(t) {
+			return "", "", false
+		}
+		name = pkgBase + "." + obj.Name()
+	default:
+		return "", "", false
+	}
+	basic, ok := t.Underlying().(*types.Basic)
+	if !ok {
+		return "", "", false
+	}
+	switch info := basic.Info(); {
+	case info&types.IsUntyped != 0:
+		return "", "", false
+	case info&(types.IsBoolean|types.IsInteger) != 0:
+		return "Int", name, true
+	case info&types.IsFloat != 0:
+		return "Float", name, true
+	case info&types.IsString != 0:
+		return "String", name, true
+	}
+	return "", "", false
+}
+
+// isBasicBool reports whether the underlying type of t is bool.
+func isBasicBool(t types.Type) bool {
+	basic, ok := t.Underlying().(*types.Basic)
+	return ok && basic.Info()&types.IsBoolean != 0
+}
+
+// isGeneric reports whether t is a generic function signature or a generic
+// type. A generic function or type cannot be used without instantiation.
+func isGeneric(t types.Type) bool {
+	s := types.TypeString(t, func(*types.Package) string { return "" })
+	if _, ok := t.(*types.Signature); ok {
+		return strings.HasPrefix(s, "func[")
+	}
+	return strings.HasSuffix(s, "]")
+}
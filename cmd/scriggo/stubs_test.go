@@ -0,0 +1,115 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+)
+
+const stubsTestPackage = `package p
+
+type Celsius float64
+
+func (c Celsius) Fahrenheit() float64 { return float64(c)*9/5 + 32 }
+
+type Flag bool
+
+type Counter struct{ n int }
+
+func (c *Counter) Add(n int) int { c.n += n; return c.n }
+func (c Counter) Value() int { return c.n }
+func (c Counter) String(s ...string) string { return "" }
+
+type List[T any] []T
+
+func (l List[T]) Len() int { return len(l) }
+
+func Index(s, substr string) int { return 0 }
+func Frexp(f float32) (float64, int8) { return 0, 0 }
+func Not(f Flag) Flag { return !f }
+func Equal(a, b uint) bool { return a == b }
+func Do() {}
+func Sum(n ...int) int { return 0 }
+func Error() error { return nil }
+func Map[T any](t T) T { return t }
+`
+
+// TestStubs tests the generation of the stubs.
+func TestStubs(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", stubsTestPackage, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := types.Config{}
+	pkg, err := conf.Check("p", fset, []*ast.File{file}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	funcTests := map[string]string{
+		"Index": "native.RegisterFuncStub(p.Index, func(r *native.Registers) {\n" +
+			"\t\tv0 := p.Index(r.String[0], r.String[1])\n" +
+			"\t\tr.Int[0] = int64(v0)\n\t})",
+		"Frexp": "native.RegisterFuncStub(p.Frexp, func(r *native.Registers) {\n" +
+			"\t\tv0, v1 := p.Frexp(float32(r.Float[1]))\n" +
+			"\t\tr.Float[0] = v0\n\t\tr.Int[0] = int64(v1)\n\t})",
+		"Not": "native.RegisterFuncStub(p.Not, func(r *native.Registers) {\n" +
+			"\t\tv0 := p.Not(p.Flag(r.Int[1] != 0))\n" +
+			"\t\tif v0 {\n\t\t\tr.Int[0] = 1\n\t\t} else {\n\t\t\tr.Int[0] = 0\n\t\t}\n\t})",
+		"Equal": "native.RegisterFuncStub(p.Equal, func(r *native.Registers) {\n" +
+			"\t\tv0 := p.Equal(uint(r.Int[1]), uint(r.Int[2]))\n" +
+			"\t\tif v0 {\n\t\t\tr.Int[0] = 1\n\t\t} else {\n\t\t\tr.Int[0] = 0\n\t\t}\n\t})",
+		"Do":    "native.RegisterFuncStub(p.Do, func(r *native.Registers) {\n\t\tp.Do()\n\t})",
+		"Sum":   "",
+		"Error": "",
+		"Map":   "",
+	}
+	for name, expected := range funcTests {
+		fn := pkg.Scope().Lookup(name).(*types.Func)
+		got, ok := funcStub(fn, "p")
+		if ok != (expected != "") {
+			t.Fatalf("%s: expected ok %t, got %t", name, expected != "", ok)
+		}
+		if got != expected {
+			t.Fatalf("%s: expected stub\n%s\ngot\n%s", name, expected, got)
+		}
+	}
+	methodTests := map[string][]string{
+		"Celsius": {
+			"native.RegisterMethodStub(reflect.TypeOf((*p.Celsius)(nil)).Elem(), \"Fahrenheit\", func(r *native.Registers) {\n" +
+				"\t\tv0 := r.Receiver.(p.Celsius).Fahrenheit()\n\t\tr.Float[0] = v0\n\t})",
+			"native.RegisterMethodStub(reflect.TypeOf((*p.Celsius)(nil)), \"Fahrenheit\", func(r *native.Registers) {\n" +
+				"\t\tv0 := r.Receiver.(*p.Celsius).Fahrenheit()\n\t\tr.Float[0] = v0\n\t})",
+		},
+		"Counter": {
+			"native.RegisterMethodStub(reflect.TypeOf((*p.Counter)(nil)).Elem(), \"Value\", func(r *native.Registers) {\n" +
+				"\t\tv0 := r.Receiver.(p.Counter).Value()\n\t\tr.Int[0] = int64(v0)\n\t})",
+			"native.RegisterMethodStub(reflect.TypeOf((*p.Counter)(nil)), \"Add\", func(r *native.Registers) {\n" +
+				"\t\tv0 := r.Receiver.(*p.Counter).Add(int(r.Int[1]))\n\t\tr.Int[0] = int64(v0)\n\t})",
+			"native.RegisterMethodStub(reflect.TypeOf((*p.Counter)(nil)), \"Value\", func(r *native.Registers) {\n" +
+				"\t\tv0 := r.Receiver.(*p.Counter).Value()\n\t\tr.Int[0] = int64(v0)\n\t})",
+		},
+		"Flag": nil,
+		"List": nil,
+	}
+	for name, expected := range methodTests {
+		typeName := pkg.Scope().Lookup(name).(*types.TypeName)
+		got := methodStubs(typeName, "p")
+		if len(got) != len(expected) {
+			t.Fatalf("%s: expected %d stubs, got %d", name, len(expected), len(got))
+		}
+		for i, stub := range got {
+			if stub != expected[i] {
+				t.Fatalf("%s: expected stub\n%s\ngot\n%s", name, expected[i], stub)
+			}
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scriggo
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/open2b/scriggo/internal/runtime"
+)
+
+// Coverage collects the code coverage of executions. See the Coverage field
+// of RunOptions.
+//
+// The coverage is collected per block, where a block is a statement or an
+// expression with a position, as a call. A line is covered if all its
+// blocks have been executed, so the branches of an if statement that have
+// never been executed are reported as not covered. The body of a function,
+// a method or a macro is a block, executed at every call, so also those
+// that have never been called, even if empty, are reported as not covered.
+//
+// A Coverage can collect the coverage of many executions, also
+// concurrently. The zero value is ready to use.
+type Coverage struct {
+	mu     sync.Mutex
+	blocks map[coverageKey]int64 // execution counts by block.
+}
+
+// CoverageBlock represents a block of code with the number of times it has
+// been executed.
+type CoverageBlock struct {
+	Path     string   // path of the file.
+	Position Position // position of the block in the file.
+	Count    int64    // number of executions.
+}
+
+// coverageKey is the key of a block.
+type coverageKey struct {
+	path     string
+	position runtime.Position
+}
+
+// coverage implements the runtime.Coverage interface adding the counts to a
+// Coverage.
+type coverage struct {
+	c *Coverage
+}
+
+func (c coverage) Add(counts []runtime.CoverageCount) {
+	c.c.add(counts)
+}
+
+// add adds the counts of an execution.
+func (c *Coverage) add(counts []runtime.CoverageCount) {
+	c.mu.Lock()
+	if c.blocks == nil {
+		c.blocks = map[coverageKey]int64{}
+	}
+	for _, count := range counts {
+		c.blocks[coverageKey{count.Path, count.Position}] += count.Count
+	}
+	c.mu.Unlock()
+}
+
+// Blocks returns the blocks of the executed files, sorted by path and
+// position.
+func (c *Coverage) Blocks() []CoverageBlock {
+	c.mu.Lock()
+	blocks := make([]CoverageBlock, 0, len(c.blocks))
+	for key, count := range c.blocks {
+		pos := key.position
+		blocks = append(blocks, CoverageBlock{
+			Path:     key.path,
+			Position: Position{Line: pos.Line, Column: pos.Column, Start: pos.Start, End: pos.End},
+			Count:    count,
+		})
+	}
+	c.mu.Unlock()
+	sort.Slice(blocks, func(i, j int) bool {
+		a, b := blocks[i], blocks[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Position.Start != b.Position.Start {
+			return a.Position.Start < b.Position.Start
+		}
+		return a.Position.End < b.Position.End
+	})
+	return blocks
+}
+
+// Percent returns the percentage of executed blocks.
+func (c *Coverage) Percent() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.blocks) == 0 {
+		return 0
+	}
+	executed := 0
+	for _, count := range c.blocks {
+		if count > 0 {
+			executed++
+		}
+	}
+	return 100 * float64(executed) / float64(len(c.blocks))
+}
+
+// WriteProfile writes the coverage to w in the format of the profiles of
+// the 'go test -coverprofile' command, with the "count" mode. Every block
+// spans from its position to the following column.
+func (c *Coverage) WriteProfile(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	_, _ = b.WriteString("mode: count\n")
+	for _, block := range c.Blocks() {
+		pos := block.Position
+		_, _ = fmt.Fprintf(b, "%s:%d.%d,%d.%d 1 %d\n", block.Path, pos.Line, pos.Column, pos.Line, pos.Column+1, block.Count)
+	}
+	return b.Flush()
+}
+
+// WriteHTML writes to w an HTML report of the coverage over the sources of
+// the executed files, that are read from fsys. fsys is the file system
+// passed to BuildTemplate or to Build. The lines with blocks that have been
+// executed are shown in green and the lines with blocks that have never been
+// executed are shown in red.
+func (c *Coverage) WriteHTML(w io.Writer, fsys fs.FS) error {
+
+	blocks := c.Blocks()
+	var paths []string
+	byPath := map[string][]CoverageBlock{}
+	for _, block := range blocks {
+		if _, ok := byPath[block.Path]; !ok {
+			paths = append(paths, block.Path)
+		}
+		byPath[block.Path] = append(byPath[block.Path], block)
+	}
+
+	b := bufio.NewWriter(w)
+	_, _ = b.WriteString(coverageHTMLHeader)
+	_, _ = b.WriteString("<select id=\"files\" onchange=\"show(this.value)\">\n")
+	for i, p := range paths {
+		executed := 0
+		for _, block := range byPath[p] {
+			if block.Count > 0 {
+				executed++
+			}
+		}
+		percent := 100 * float64(executed) / float64(len(byPath[p]))
+		_, _ = fmt.Fprintf(b, "<option value=\"file%d\">%s (%.1f%%)</option>\n", i, html.EscapeString(p), percent)
+	}
+	_, _ = b.WriteString("</select>\n")
+
+	for i, p := range paths {
+		src, err := readCoverageSource(fsys, p)
+		if err != nil {
+			return err
+		}
+		// Determine the minimum count of the blocks of every line.
+		lines := map[int]int64{}
+		for _, block := range byPath[p] {
+			line := block.Position.Line
+			if count, ok := lines[line]; !ok || block.Count < count {
+				lines[line] = block.Count
+			}
+		}
+		display := "none"
+		if i == 0 {
+			display = "block"
+		}
+		_, _ = fmt.Fprintf(b, "<pre class=\"file\" id=\"file%d\" style=\"display: %s\">\n", i, display)
+		for n, line := range strings.Split(string(src), "\n") {
+			class := "none"
+			title := ""
+			if count, ok := lines[n+1]; ok {
+				class = "cov"
+				if count == 0 {
+					class = "nocov"
+				}
+				title = " title=\"" + strconv.FormatInt(count, 10) + "\""
+			}
+			_, _ = fmt.Fprintf(b, "<span class=\"%s\"%s><span class=\"num\">%5d</span> %s</span>\n", class, title, n+1, html.EscapeString(line))
+		}
+		_, _ = b.WriteString("</pre>\n")
+	}
+	_, _ = b.WriteString(coverageHTMLFooter)
+
+	return b.Flush()
+}
+
+// readCoverageSource reads the source of the file with the given path from
+// fsys. For a program, the path is the path of a package, and it reads the
+// Go file of the package.
+func readCoverageSource(fsys fs.FS, name string) ([]byte, error) {
+	name = strings.TrimPrefix(name, "/")
+	if src, err := fs.ReadFile(fsys, name); err == nil {
+		return src, nil
+	}
+	dir := name
+	if name == "main" {
+		dir = "."
+	} else if mod, err := fs.ReadFile(fsys, "go.mod"); err == nil {
+		for _, line := range strings.Split(string(mod), "\n") {
+			if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "module" {
+				dir = strings.TrimPrefix(name, strings.Trim(fields[1], `"`)+"/")
+				break
+			}
+		}
+	}
+	files, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if file.Type().IsRegular() && path.Ext(file.Name()) == ".go" {
+			return fs.ReadFile(fsys, path.Join(dir, file.Name()))
+		}
+	}
+	return nil, fmt.Errorf("scriggo: cannot find source of %q", name)
+}
+
+const coverageHTMLHeader = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Scriggo coverage</title>
+<style>
+body { background: #fff; color: #333; font-family: monospace; }
+select { margin: 10px 0; }
+.num { color: #999; }
+.cov { color: #2a7d2a; }
+.nocov { color: #c0392b; }
+.none { color: #888; }
+</style>
+</head>
+<body>
+`
+
+const coverageHTMLFooter = `<script>
+function show(id) {
+	var files = document.getElementsByClassName("file");
+	for (var i = 0; i < files.length; i++) {
+		files[i].style.display = files[i].id === id ? "block" : "none";
+	}
+}
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,100 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scriggo
+
+import (
+	"reflect"
+
+	"github.com/open2b/scriggo/internal/runtime"
+)
+
+// DebugAction is the action returned by the Stop method of a Debugger to
+// resume a stopped execution.
+type DebugAction int
+
+const (
+	// DebugContinue continues the execution up to the next breakpoint.
+	DebugContinue DebugAction = iota
+
+	// DebugStepIn stops the execution at the next line, also if it is in a
+	// called function.
+	DebugStepIn
+
+	// DebugStepOver stops the execution at the next line of the current
+	// function, or of a caller if the current function returns.
+	DebugStepOver
+
+	// DebugStepOut stops the execution at the next line of a caller of the
+	// current function.
+	DebugStepOut
+)
+
+// Debugger is implemented by the debuggers. See the Debugger field of
+// RunOptions.
+//
+// The methods of a debugger are called only by the main goroutine, they
+// are not called by goroutines started with the go statement and when a
+// native function calls a function or macro.
+type Debugger interface {
+
+	// Break is called every time the execution reaches a new line of a file,
+	// and reports whether the execution must stop. It should return true if
+	// there is a breakpoint at the line or if a pause has been requested.
+	Break(path string, line int) bool
+
+	// Stop is called when the execution is stopped, because Break returned
+	// true or because of a step, and returns the action to resume the
+	// execution. frames contains the frames of the call stack starting from
+	// the current frame. The execution resumes when Stop returns.
+	Stop(frames []DebugFrame) DebugAction
+}
+
+// DebugFrame represents a frame of the call stack of a stopped execution.
+type DebugFrame struct {
+	StackFrame
+
+	// Variables contains the local variables in scope and the variables
+	// of the enclosing functions referred by a function literal. For the
+	// frames of the callers, Position is the position of the call.
+	Variables []DebugVariable
+}
+
+// DebugVariable represents a variable in a frame of a stopped execution.
+type DebugVariable struct {
+	Name  string        // name of the variable.
+	Value reflect.Value // value of the variable.
+	Upvar bool          // reports whether it is a variable of an enclosing function.
+}
+
+// debugger implements the runtime.Debugger interface calling a Debugger.
+type debugger struct {
+	d Debugger
+}
+
+func (d debugger) Break(path string, line int) bool {
+	return d.d.Break(path, line)
+}
+
+func (d debugger) Stop(frames []runtime.DebugFrame) runtime.DebugAction {
+	fs := make([]DebugFrame, len(frames))
+	for i, f := range frames {
+		fs[i] = DebugFrame{
+			StackFrame: StackFrame{
+				Func:     f.Func,
+				Macro:    f.Macro,
+				Native:   f.Native,
+				Path:     f.Path,
+				Position: Position{Line: f.Position.Line, Column: f.Position.Column, Start: f.Position.Start, End: f.Position.End},
+			},
+		}
+		if f.Variables != nil {
+			fs[i].Variables = make([]DebugVariable, len(f.Variables))
+			for j, v := range f.Variables {
+				fs[i].Variables[j] = DebugVariable(v)
+			}
+		}
+	}
+	return runtime.DebugAction(d.d.Stop(fs))
+}
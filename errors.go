@@ -5,7 +5,9 @@
 package scriggo
 
 import (
+	"reflect"
 	"strconv"
+	"strings"
 
 	"github.com/open2b/scriggo/internal/compiler"
 	"github.com/open2b/scriggo/internal/runtime"
@@ -50,6 +52,50 @@ func (err *BuildError) Message() string {
 	return err.err.Message()
 }
 
+// BuildErrors represents the errors occurred building a program or template,
+// when more than one error occurred, sorted by path and position. See the
+// MaxErrors field of BuildOptions.
+type BuildErrors []*BuildError
+
+// Error returns a string representation of the errors, one per line.
+func (errs BuildErrors) Error() string {
+	var b strings.Builder
+	for i, err := range errs {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+// As reports whether the first error matches target, so that errors.As
+// with a **BuildError target finds the first error.
+func (errs BuildErrors) As(target interface{}) bool {
+	if t, ok := target.(**BuildError); ok && len(errs) > 0 {
+		*t = errs[0]
+		return true
+	}
+	return false
+}
+
+// buildError returns the error to return in place of the error err returned
+// by the compiler. If err is a compiler.Error value, it returns a *BuildError
+// value, and if it is a compiler.Errors value, it returns a BuildErrors value.
+func buildError(err error) error {
+	switch e := err.(type) {
+	case compiler.Error:
+		return &BuildError{err: e}
+	case compiler.Errors:
+		errs := make(BuildErrors, len(e))
+		for i, err := range e {
+			errs[i] = &BuildError{err: err}
+		}
+		return errs
+	}
+	return err
+}
+
 // ExitError represents an exit from an execution with a non-zero status code.
 // It may wrap the error that caused the exit.
 //
@@ -122,3 +168,158 @@ func (p *PanicError) Position() Position {
 	pos := p.p.Position()
 	return Position{Line: pos.Line, Column: pos.Column, Start: pos.Start, End: pos.End}
 }
+
+// StackTrace returns the stack trace of the panic, with a frame for every
+// function and macro call, starting from the frame where the panic occurred.
+// If the panic occurred in a native function, the first frame is the frame
+// of the native function.
+func (p *PanicError) StackTrace() []StackFrame {
+	trace := p.p.StackTrace()
+	frames := make([]StackFrame, len(trace))
+	for i, f := range trace {
+		frames[i] = StackFrame{
+			Func:     f.Func,
+			Macro:    f.Macro,
+			Native:   f.Native,
+			Path:     f.Path,
+			Position: Position{Line: f.Position.Line, Column: f.Position.Column, Start: f.Position.Start, End: f.Position.End},
+		}
+	}
+	return frames
+}
+
+// StackFrame represents a frame of the stack trace of a panic.
+type StackFrame struct {
+
+	// Func is the name of the function or macro qualified by the package
+	// name, for example "main.f". The name of a template file is "main.main".
+	// For a function literal, Func is the name of the enclosing function
+	// followed by ".func".
+	Func string
+
+	// Macro reports whether Func is a macro or a template file.
+	Macro bool
+
+	// Native reports whether Func is a native function. For native
+	// functions, Path and Position are not significant.
+	Native bool
+
+	// Path is the path of the file.
+	Path string
+
+	// Position is the position in the file of the call, or of the
+	// instruction that panicked for the first Scriggo frame.
+	Position Position
+}
+
+// InstructionLimitError represents the error that occurs when an executed
+// program or template exceeds the maximum number of instructions set with
+// the MaxInstructions run option.
+type InstructionLimitError struct {
+	err *runtime.InstructionLimitError
+}
+
+// Error returns a string representation of the error.
+func (err *InstructionLimitError) Error() string {
+	return err.err.Error()
+}
+
+// Limit returns the maximum number of instructions.
+func (err *InstructionLimitError) Limit() int64 {
+	return err.err.Limit()
+}
+
+// Path returns the path of the file of the last executed instruction.
+func (err *InstructionLimitError) Path() string {
+	return err.err.Path()
+}
+
+// Position returns the position in the file of the last executed
+// instruction.
+func (err *InstructionLimitError) Position() Position {
+	pos := err.err.Position()
+	return Position{Line: pos.Line, Column: pos.Column, Start: pos.Start, End: pos.End}
+}
+
+// AllocationLimitError represents the error that occurs when an executed
+// program or template exceeds the maximum number of bytes set with the
+// MaxAllocatedBytes run option.
+type AllocationLimitError struct {
+	err *runtime.AllocationLimitError
+}
+
+// Error returns a string representation of the error.
+func (err *AllocationLimitError) Error() string {
+	return err.err.Error()
+}
+
+// Limit returns the maximum number of bytes.
+func (err *AllocationLimitError) Limit() int64 {
+	return err.err.Limit()
+}
+
+// Allocated returns the number of bytes allocated before the allocation
+// that exceeded the limit.
+func (err *AllocationLimitError) Allocated() int64 {
+	return err.err.Allocated()
+}
+
+// Path returns the path of the file where the allocation occurred.
+func (err *AllocationLimitError) Path() string {
+	return err.err.Path()
+}
+
+// Position returns the position in the file where the allocation occurred.
+func (err *AllocationLimitError) Position() Position {
+	pos := err.err.Position()
+	return Position{Line: pos.Line, Column: pos.Column, Start: pos.Start, End: pos.End}
+}
+
+// NativeCallDeniedError represents the error that occurs when a call to a
+// native function is denied by the OnNativeCall run option.
+type NativeCallDeniedError struct {
+	err *runtime.NativeCallDeniedError
+}
+
+// Error returns a string representation of the error.
+func (err *NativeCallDeniedError) Error() string {
+	return err.err.Error()
+}
+
+// Unwrap returns the error returned by the OnNativeCall function.
+func (err *NativeCallDeniedError) Unwrap() error {
+	return err.err.Unwrap()
+}
+
+// Package returns the package path of the native function.
+func (err *NativeCallDeniedError) Package() string {
+	return err.err.Package()
+}
+
+// Name returns the name of the native function.
+func (err *NativeCallDeniedError) Name() string {
+	return err.err.Name()
+}
+
+// Receiver returns the receiver type, if it is a call to a method of a
+// native value, otherwise it returns nil.
+func (err *NativeCallDeniedError) Receiver() reflect.Type {
+	return err.err.Receiver()
+}
+
+// Method returns the method name, if it is a call to a method of a native
+// value.
+func (err *NativeCallDeniedError) Method() string {
+	return err.err.Method()
+}
+
+// Path returns the path of the file of the call.
+func (err *NativeCallDeniedError) Path() string {
+	return err.err.Path()
+}
+
+// Position returns the position in the file of the call.
+func (err *NativeCallDeniedError) Position() Position {
+	pos := err.err.Position()
+	return Position{Line: pos.Line, Column: pos.Column, Start: pos.Start, End: pos.End}
+}
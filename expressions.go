@@ -0,0 +1,91 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scriggo
+
+import (
+	"io"
+	"reflect"
+
+	"github.com/open2b/scriggo/internal/compiler"
+	"github.com/open2b/scriggo/internal/runtime"
+	"github.com/open2b/scriggo/native"
+)
+
+// Expression is an expression compiled with the CompileExpression function.
+type Expression struct {
+	fn      *runtime.Function
+	typeof  runtime.TypeOfFunc
+	globals []compiler.Global
+	result  int
+	typ     reflect.Type
+}
+
+// CompileExpression compiles the Go expression src. decls contains the
+// constants, types, variables, functions and packages that can be referred
+// by the expression, as the globals of a template. Variables can be
+// initialized on every evaluation.
+//
+// The value of the expression must be assignable to resultType, and untyped
+// constants are converted to resultType. If resultType is nil, the value can
+// have any type.
+//
+// If a compilation error occurs, it returns a *BuildError with path
+// "expression" and the position in src.
+func CompileExpression(src string, decls native.Declarations, resultType reflect.Type) (*Expression, error) {
+	co := compiler.Options{
+		Globals:     decls,
+		FormatTypes: formatTypes,
+	}
+	code, err := compiler.BuildExpression(src, resultType, co)
+	if err != nil {
+		err = buildError(err)
+		return nil, err
+	}
+	if resultType == nil {
+		resultType = emptyInterfaceType
+	}
+	expr := &Expression{
+		fn:      code.Main,
+		typeof:  code.TypeOf,
+		globals: code.Globals,
+		result:  -1,
+		typ:     resultType,
+	}
+	for i, global := range code.Globals {
+		if global.Pkg == "main" && global.Name == compiler.ExpressionResult {
+			expr.result = i
+			break
+		}
+	}
+	return expr, nil
+}
+
+var emptyInterfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// Type returns the type of the values returned by the Eval method.
+func (expr *Expression) Type() reflect.Type {
+	return expr.typ
+}
+
+// Eval evaluates the expression and returns its value. It can be called
+// concurrently by multiple goroutines.
+//
+// vars contains the values of the variables declared in decls, as for the
+// Run method of Template, and it can be nil.
+//
+// Eval returns the same errors returned by the Run method of Program.
+func (expr *Expression) Eval(vars map[string]interface{}, options *RunOptions) (interface{}, error) {
+	values := initGlobalVariables(expr.globals, vars)
+	vm := newVM(options, nil)
+	vm.SetRenderer(io.Discard, nil)
+	err := vm.Run(expr.fn, expr.typeof, values)
+	if err != nil {
+		return nil, convertRunError(err)
+	}
+	if expr.result < 0 {
+		return reflect.Zero(expr.typ).Interface(), nil
+	}
+	return values[expr.result].Interface(), nil
+}
@@ -0,0 +1,410 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"io/fs"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/ast/astutil"
+)
+
+// Analysis holds the information collected by the type checker on a template
+// file or on the main package of a program. It is returned by
+// AnalyzeTemplate and AnalyzeProgram and it is used by tools, as a language
+// server, that need to know the types and the declarations of the names in
+// the source.
+type Analysis struct {
+	// path is the path of the analyzed file.
+	path string
+
+	// files maps the nodes of the parsed trees to the paths of their files.
+	files map[ast.Node]string
+
+	// typeInfos contains the type infos of the nodes type checked before
+	// the type checking terminated.
+	typeInfos map[ast.Node]*typeInfo
+
+	// definitions maps the identifiers and the package selectors to their
+	// declarations. A declaration is an *ast.Identifier value or, for the
+	// packages and the imported names, an *ast.Import value.
+	definitions map[ast.Node]ast.Node
+}
+
+// A Location is the location of a declaration or of a file.
+type Location struct {
+	Path     string       // path of the file.
+	Native   bool         // path is the path, in the Go build environment, of the source of a native declaration.
+	Position ast.Position // position in the file; for a file it is 1:1.
+}
+
+// AnalyzeTemplate parses and type checks the named template file, as
+// BuildTemplate does, without emitting the code, and returns the resulting
+// analysis.
+//
+// If a syntax error occurs, it returns a nil analysis and the error. If a
+// type checking error occurs, it returns the analysis of the code checked
+// before the error, and the error.
+func AnalyzeTemplate(fsys fs.FS, name string, opts Options) (*Analysis, error) {
+
+	tree, _, err := parseTemplate(fsys, name, opts.NoParseShortShowStmt, false, collectedErrors(opts.MaxErrors))
+	if err != nil {
+		return nil, sortErrors(err, opts.MaxErrors)
+	}
+
+	a := newAnalysis(tree)
+	checkerOpts := checkerOptions{
+		allowGoStmt: opts.AllowGoStmt,
+		analysis:    a,
+		formatTypes: opts.FormatTypes,
+		globals:     opts.Globals,
+		mdConverter: opts.MDConverter,
+		mod:         templateMod,
+		maxErrors:   collectedErrors(opts.MaxErrors),
+	}
+	_, err = typecheck(tree, opts.Importer, checkerOpts)
+
+	return a, sortErrors(err, opts.MaxErrors)
+}
+
+// AnalyzeProgram parses and type checks the program in the root of fsys, as
+// BuildProgram does, without emitting the code, and returns the analysis of
+// the main package. The path of the main package is "main".
+//
+// If a syntax error occurs, it returns a nil analysis and the error. If a
+// type checking error occurs, it returns the analysis of the code checked
+// before the error, and the error.
+func AnalyzeProgram(fsys fs.FS, opts Options) (*Analysis, error) {
+
+	tree, err := parseProgram(fsys, collectedErrors(opts.MaxErrors))
+	if err != nil {
+		return nil, sortErrors(err, opts.MaxErrors)
+	}
+
+	a := newAnalysis(tree)
+	checkerOpts := checkerOptions{
+		allowGoStmt: opts.AllowGoStmt,
+		analysis:    a,
+		globals:     opts.Globals,
+		mod:         programMod,
+		maxErrors:   collectedErrors(opts.MaxErrors),
+	}
+	_, err = typecheck(tree, opts.Importer, checkerOpts)
+
+	return a, sortErrors(err, opts.MaxErrors)
+}
+
+// newAnalysis returns a new analysis for tree. It must be called before
+// tree is type checked.
+func newAnalysis(tree *ast.Tree) *Analysis {
+	a := &Analysis{
+		path:        tree.Path,
+		files:       map[ast.Node]string{},
+		definitions: map[ast.Node]ast.Node{},
+	}
+	c := &nodeCollector{files: a.files, trees: map[*ast.Tree]bool{}}
+	c.collect(tree)
+	return a
+}
+
+// setCompilation sets the compilation from which the analysis collects the
+// type infos and the definitions. a can be nil.
+func (a *Analysis) setCompilation(compilation *compilation) {
+	if a == nil {
+		return
+	}
+	a.typeInfos = compilation.typeInfos
+	compilation.definitions = a.definitions
+}
+
+// Path returns the path of the analyzed file.
+func (a *Analysis) Path() string {
+	return a.path
+}
+
+// Describe returns a description of the name or expression, in the analyzed
+// file, that contains the byte at the given offset, with its type, and its
+// position. If there is no such name or expression, it returns false.
+func (a *Analysis) Describe(offset int) (string, ast.Position, bool) {
+	var node ast.Node
+	for n := range a.typeInfos {
+		if a.contains(n, offset) && a.innermost(n, node) {
+			node = n
+		}
+	}
+	// The type checker does not store the type infos of the package names
+	// in the selectors.
+	if s, ok := node.(*ast.Selector); ok {
+		if ident, ok := s.Expr.(*ast.Identifier); ok && a.contains(ident, offset) {
+			if _, ok := a.typeInfos[ident]; !ok {
+				return "package " + ident.Name, *ident.Pos(), true
+			}
+		}
+	}
+	if node == nil {
+		return "", ast.Position{}, false
+	}
+	return describe(node, a.typeInfos[node]), *node.Pos(), true
+}
+
+// Definition returns the location of the declaration of the name, in the
+// analyzed file, that contains the byte at the given offset. If the offset
+// is in an extends, import or render, it returns the location of the
+// referred file. If there is no such name or file, it returns false.
+func (a *Analysis) Definition(offset int) (Location, bool) {
+	var node ast.Node
+	for n := range a.files {
+		switch n := n.(type) {
+		case *ast.Extends, *ast.Import, *ast.Render:
+		case *ast.Identifier, *ast.Selector:
+			if _, ok := a.definitions[n]; !ok && nativeFunc(a.typeInfos[n]) == nil {
+				continue
+			}
+		default:
+			continue
+		}
+		if a.contains(n, offset) && a.innermost(n, node) {
+			node = n
+		}
+	}
+	var tree *ast.Tree
+	switch n := node.(type) {
+	case nil:
+		return Location{}, false
+	case *ast.Extends:
+		tree = n.Tree
+	case *ast.Import:
+		tree = n.Tree
+	case *ast.Render:
+		tree = n.Tree
+	default:
+		switch decl := a.definitions[n].(type) {
+		case *ast.Identifier:
+			if path, ok := a.files[decl]; ok {
+				return Location{Path: path, Position: *decl.Pos()}, true
+			}
+		case *ast.Import:
+			if decl.Tree == nil {
+				break
+			}
+			var name string
+			switch n := n.(type) {
+			case *ast.Identifier:
+				name = n.Name
+			case *ast.Selector:
+				name = n.Ident
+			}
+			if ident := declaration(decl.Tree, name); ident != nil {
+				return Location{Path: a.files[ident], Position: *ident.Pos()}, true
+			}
+			return Location{Path: decl.Tree.Path, Position: ast.Position{Line: 1, Column: 1}}, true
+		}
+		if fn := nativeFunc(a.typeInfos[n]); fn != nil {
+			file, line := fn.FileLine(fn.Entry())
+			return Location{Path: file, Native: true, Position: ast.Position{Line: line, Column: 1}}, true
+		}
+		return Location{}, false
+	}
+	if tree == nil {
+		return Location{}, false
+	}
+	return Location{Path: tree.Path, Position: ast.Position{Line: 1, Column: 1}}, true
+}
+
+// contains reports whether node is in the analyzed file and contains the
+// byte at the given offset.
+func (a *Analysis) contains(node ast.Node, offset int) bool {
+	if a.files[node] != a.path {
+		return false
+	}
+	pos := node.Pos()
+	return pos != nil && pos.Start <= offset && offset <= pos.End
+}
+
+// innermost reports whether node, that contains the same offset as
+// previous, is more internal than previous. previous can be nil.
+func (a *Analysis) innermost(node, previous ast.Node) bool {
+	if previous == nil {
+		return true
+	}
+	p1, p2 := node.Pos(), previous.Pos()
+	if s1, s2 := p1.End-p1.Start, p2.End-p2.Start; s1 != s2 {
+		return s1 < s2
+	}
+	// Prefer identifiers, and then the node that starts before, to return
+	// always the same node.
+	if _, ok := previous.(*ast.Identifier); ok {
+		return false
+	}
+	if _, ok := node.(*ast.Identifier); ok {
+		return true
+	}
+	return p1.Start < p2.Start
+}
+
+// describe returns a description of node with type info ti.
+func describe(node ast.Node, ti *typeInfo) string {
+	var name string
+	switch n := node.(type) {
+	case *ast.Identifier:
+		name = n.Name
+	case *ast.Selector:
+		if _, ok := n.Expr.(*ast.Identifier); ok {
+			name = n.String()
+		}
+	}
+	s := ""
+	switch {
+	case ti.IsPackage():
+		return "package " + name
+	case ti.IsType():
+		if name == "" || name == ti.Type.String() {
+			return "type " + ti.Type.String()
+		}
+		return "type " + name + " " + ti.Type.String()
+	case ti.IsBuiltinFunction():
+		return "func " + name
+	case ti.IsMacroDeclaration():
+		return "macro " + name + strings.TrimPrefix(ti.String(), "func")
+	case ti.IsConstant():
+		s = "const "
+	case name != "" && ti.Addressable():
+		s = "var "
+	case name != "" && nativeFunc(ti) != nil:
+		s = "func "
+	}
+	if name != "" {
+		s += name + " "
+	}
+	s += ti.String()
+	if ti.IsConstant() {
+		s += " = " + ti.Constant.String()
+	}
+	return s
+}
+
+// nativeFunc returns the function of a native function with type info ti.
+// If ti is nil or it is not a native function, it returns nil.
+func nativeFunc(ti *typeInfo) *runtime.Func {
+	if ti == nil || !ti.IsNative() {
+		return nil
+	}
+	rv, ok := ti.value.(reflect.Value)
+	if !ok || rv.Kind() != reflect.Func || rv.IsNil() {
+		return nil
+	}
+	return runtime.FuncForPC(rv.Pointer())
+}
+
+// declaration returns the identifier of the package-level declaration with
+// the given name in tree. If there is no such declaration, it returns nil.
+func declaration(tree *ast.Tree, name string) *ast.Identifier {
+	nodes := tree.Nodes
+	if len(nodes) == 1 {
+		if pkg, ok := nodes[0].(*ast.Package); ok {
+			nodes = pkg.Declarations
+		}
+	}
+	for _, node := range nodes {
+		var idents []*ast.Identifier
+		switch n := node.(type) {
+		case *ast.Func:
+			if n.Recv == nil {
+				idents = []*ast.Identifier{n.Ident}
+			}
+		case *ast.TypeDeclaration:
+			idents = []*ast.Identifier{n.Ident}
+		case *ast.Var:
+			idents = n.Lhs
+		case *ast.Const:
+			idents = n.Lhs
+		case *ast.Assignment:
+			// A macro declaration transformed by the type checker.
+			if n.Type == ast.AssignmentDeclaration {
+				for _, lh := range n.Lhs {
+					if ident, ok := lh.(*ast.Identifier); ok {
+						idents = append(idents, ident)
+					}
+				}
+			}
+		}
+		for _, ident := range idents {
+			if ident != nil && ident.Name == name && ident.Pos() != nil {
+				return ident
+			}
+		}
+	}
+	return nil
+}
+
+// nodeCollector collects the nodes of a tree, and of the trees it extends,
+// imports and renders, with the paths of their files.
+type nodeCollector struct {
+	path  string
+	files map[ast.Node]string
+	trees map[*ast.Tree]bool
+}
+
+// collect collects the nodes of tree.
+func (c *nodeCollector) collect(tree *ast.Tree) {
+	if tree == nil || c.trees[tree] {
+		return
+	}
+	c.trees[tree] = true
+	path := c.path
+	c.path = tree.Path
+	astutil.Walk(c, tree)
+	c.path = path
+}
+
+// Visit implements the astutil.Visitor interface.
+func (c *nodeCollector) Visit(node ast.Node) astutil.Visitor {
+	switch n := node.(type) {
+	case nil:
+		return nil
+	case *ast.Call:
+		// Walk does not visit the called function.
+		astutil.Walk(c, n.Func)
+	case *ast.Extends:
+		c.collect(n.Tree)
+	case *ast.Func:
+		// Walk does not visit the name, the receiver and the type of a
+		// function.
+		if n.Ident != nil {
+			astutil.Walk(c, n.Ident)
+		}
+		if n.Recv != nil {
+			if n.Recv.Ident != nil {
+				astutil.Walk(c, n.Recv.Ident)
+			}
+			astutil.Walk(c, n.Recv.Type)
+		}
+		astutil.Walk(c, n.Type)
+	case *ast.FuncType:
+		for _, param := range n.Parameters {
+			if param.Ident != nil {
+				astutil.Walk(c, param.Ident)
+			}
+		}
+		for _, param := range n.Result {
+			if param.Ident != nil {
+				astutil.Walk(c, param.Ident)
+			}
+		}
+	case *ast.Import:
+		c.collect(n.Tree)
+	case *ast.Render:
+		c.collect(n.Tree)
+	case *ast.TypeAssertion:
+		if n.Type != nil {
+			astutil.Walk(c, n.Type)
+		}
+	}
+	c.files[node] = c.path
+	return c
+}
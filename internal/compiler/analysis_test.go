@@ -0,0 +1,123 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/internal/fstest"
+	"github.com/open2b/scriggo/native"
+)
+
+const analysisIndex = `{% import "imp.html" %}{% import p "imp.html" %}
+{% macro M(s string) %}{{ s }}{% end %}
+{% const c = 3 %}{% x := 5 %}
+{{ M("a") }}{{ I() }}{{ p.I() }}{{ x + c }}{{ strings.ToUpper("a") }}`
+
+// offsetOf returns the offset of the n-th occurrence, starting from 1, of
+// s in analysisIndex, plus delta.
+func offsetOf(t *testing.T, s string, n, delta int) int {
+	offset := -1
+	for i := 0; i < n; i++ {
+		j := strings.Index(analysisIndex[offset+1:], s)
+		if j < 0 {
+			t.Fatalf("%q not found", s)
+		}
+		offset += j + 1
+	}
+	return offset + delta
+}
+
+func TestAnalyzeTemplate(t *testing.T) {
+	fsys := fstest.Files{
+		"index.html": analysisIndex,
+		"imp.html":   "{% macro I %}i{% end %}",
+	}
+	opts := Options{
+		FormatTypes: formatTypes,
+		Globals: native.Declarations{
+			"strings": native.Package{
+				Name:         "strings",
+				Declarations: native.Declarations{"ToUpper": strings.ToUpper},
+			},
+		},
+	}
+	a, err := AnalyzeTemplate(fsys, "index.html", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if a.Path() != "index.html" {
+		t.Fatalf("expected path %q, got %q", "index.html", a.Path())
+	}
+
+	descriptions := []struct {
+		offset   int
+		expected string
+	}{
+		{offsetOf(t, "x + c", 1, 0), "var x int"},
+		{offsetOf(t, "x + c", 1, 4), "const c untyped int = 3"},
+		{offsetOf(t, "x + c", 1, 2), "int"},
+		{offsetOf(t, "M(\"a\")", 1, 0), "macro M(string) compiler.html"},
+		{offsetOf(t, "s }}", 1, 0), "var s string"},
+		{offsetOf(t, "strings.", 1, 1), "package strings"},
+	}
+	for _, d := range descriptions {
+		got, _, ok := a.Describe(d.offset)
+		if !ok {
+			t.Errorf("offset %d: expected description %q, got nothing", d.offset, d.expected)
+			continue
+		}
+		if got != d.expected {
+			t.Errorf("offset %d: expected description %q, got %q", d.offset, d.expected, got)
+		}
+	}
+
+	definitions := []struct {
+		offset   int
+		expected Location
+	}{
+		{offsetOf(t, "M(\"a\")", 1, 0), Location{Path: "index.html", Position: ast.Position{Line: 2, Column: 10, Start: 58, End: 58}}},
+		{offsetOf(t, "x + c", 1, 0), Location{Path: "index.html", Position: ast.Position{Line: 3, Column: 21, Start: 109, End: 109}}},
+		{offsetOf(t, "I()", 1, 0), Location{Path: "imp.html", Position: ast.Position{Line: 1, Column: 10, Start: 9, End: 9}}},
+		{offsetOf(t, "I()", 2, 0), Location{Path: "imp.html", Position: ast.Position{Line: 1, Column: 10, Start: 9, End: 9}}},
+		{offsetOf(t, "\"imp.html\"", 1, 1), Location{Path: "imp.html", Position: ast.Position{Line: 1, Column: 1}}},
+	}
+	for _, d := range definitions {
+		got, ok := a.Definition(d.offset)
+		if !ok {
+			t.Errorf("offset %d: expected definition %v, got nothing", d.offset, d.expected)
+			continue
+		}
+		if got != d.expected {
+			t.Errorf("offset %d: expected definition %#v, got %#v", d.offset, d.expected, got)
+		}
+	}
+
+	// Definition of a native function.
+	loc, ok := a.Definition(offsetOf(t, "ToUpper", 1, 0))
+	if !ok {
+		t.Fatal("expected definition of strings.ToUpper, got nothing")
+	}
+	if !loc.Native || !strings.HasSuffix(loc.Path, "strings/strings.go") {
+		t.Fatalf("unexpected definition of strings.ToUpper: %v", loc)
+	}
+}
+
+func TestAnalyzeTemplateError(t *testing.T) {
+	fsys := fstest.Files{"index.html": "{% a := 1 %}{{ a }}{{ b }}"}
+	a, err := AnalyzeTemplate(fsys, "index.html", Options{FormatTypes: formatTypes})
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if a == nil {
+		t.Fatal("expected analysis, got nil")
+	}
+	got, _, ok := a.Describe(15)
+	if !ok || got != "var a int" {
+		t.Fatalf("expected description %q, got %q", "var a int", got)
+	}
+}
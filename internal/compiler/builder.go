@@ -9,6 +9,7 @@ import (
 	"math"
 	"reflect"
 	"strconv"
+	"strings"
 
 	"github.com/open2b/scriggo/ast"
 	"github.com/open2b/scriggo/internal/runtime"
@@ -17,9 +18,9 @@ import (
 // Define some constants that define limits of the implementation.
 const (
 	// Functions.
-	maxRegistersCount        = 127
-	maxNativeFunctionsCount  = 256
-	maxScriggoFunctionsCount = 256
+	maxRegistersCount        = 32767
+	maxNativeFunctionsCount  = 65536
+	maxScriggoFunctionsCount = 65536
 	maxFieldIndexesCount     = 256
 	maxSelectCasesCount      = 65536
 
@@ -112,6 +113,52 @@ func decodeValueIndex(a, b int8) (t registerType, i int) {
 	return registerType(uint8(a) >> 6), int(decodeUint16(a, b) &^ (3 << 14))
 }
 
+// decodeOperands decodes the operands of the instruction at address addr of
+// body, merging the high bytes of the preceding OpWide instruction, if any.
+func decodeOperands(body []runtime.Instruction, addr runtime.Addr) (a, b, c int16) {
+	in := body[addr]
+	a, b, c = int16(in.A), int16(in.B), int16(in.C)
+	if addr > 0 && body[addr-1].Op == runtime.OpWide {
+		hi := body[addr-1]
+		a = int16(hi.A)<<8 | int16(uint8(in.A))
+		b = int16(hi.B)<<8 | int16(uint8(in.B))
+		c = int16(hi.C)<<8 | int16(uint8(in.C))
+	}
+	return a, b, c
+}
+
+// decodeStackShift decodes the stack shift stored in body at address addr,
+// returning the shift and the number of instructions it occupies.
+func decodeStackShift(body []runtime.Instruction, addr runtime.Addr) (runtime.StackShift, runtime.Addr) {
+	s := body[addr]
+	if s.Op >= 0 {
+		return runtime.StackShift{int16(s.Op), int16(s.A), int16(s.B), int16(s.C)}, 1
+	}
+	lo, hi := body[addr+1], body[addr+2]
+	return runtime.StackShift{
+		int16(hi.Op)<<8 | int16(uint8(lo.Op)),
+		int16(hi.A)<<8 | int16(uint8(lo.A)),
+		int16(hi.B)<<8 | int16(uint8(lo.B)),
+		int16(hi.C)<<8 | int16(uint8(lo.C)),
+	}, 4
+}
+
+// decodeDataWord decodes the data word, at address addr of body, that
+// follows the MakeSlice, Slice and StringSlice instructions. If wide is true
+// the data word is followed by a word with the high bytes of its operands.
+// It returns the operands and the number of words.
+func decodeDataWord(body []runtime.Instruction, addr runtime.Addr, wide bool) (a, b, c int16, n runtime.Addr) {
+	in := body[addr]
+	if !wide {
+		return int16(in.A), int16(in.B), int16(in.C), 1
+	}
+	hi := body[addr+1]
+	a = int16(hi.A)<<8 | int16(uint8(in.A))
+	b = int16(hi.B)<<8 | int16(uint8(in.B))
+	c = int16(hi.C)<<8 | int16(uint8(in.C))
+	return a, b, c, 2
+}
+
 // newFunction returns a new function with a given package, name and type.
 // file and pos are, respectively, the file and the position where the
 // function is declared.
@@ -166,12 +213,13 @@ type functionBuilder struct {
 	fn                     *runtime.Function
 	labelAddrs             []runtime.Addr // addresses of the labels; the address of the label n is labelAddrs[n-1]
 	gotos                  map[runtime.Addr]label
-	maxRegs                map[registerType]int8 // max number of registers allocated at the same time.
-	numRegs                map[registerType]int8
-	scopes                 []map[string]int8
+	maxRegs                map[registerType]int16 // max number of registers allocated at the same time.
+	numRegs                map[registerType]int16
+	scopes                 []map[string]int16
+	scopeVars              [][]int // indexes in fn.Vars of the variables declared in the scopes.
 	scopeShifts            []runtime.StackShift
-	complexBinaryOpIndexes map[ast.OperatorType]int8 // indexes of complex binary op. functions.
-	complexUnaryOpIndex    int8                      // index of complex negation function.
+	complexBinaryOpIndexes map[ast.OperatorType]int16 // indexes of complex binary op. functions.
+	complexUnaryOpIndex    int16                      // index of complex negation function.
 
 	// text refers to the latest emitted Text instruction with its text to be flushed into the function.
 	text struct {
@@ -193,10 +241,10 @@ func newBuilder(fn *runtime.Function, path string) *functionBuilder {
 	builder := &functionBuilder{
 		fn:                     fn,
 		gotos:                  map[runtime.Addr]label{},
-		maxRegs:                map[registerType]int8{},
-		numRegs:                map[registerType]int8{},
-		scopes:                 []map[string]int8{},
-		complexBinaryOpIndexes: map[ast.OperatorType]int8{},
+		maxRegs:                map[registerType]int16{},
+		numRegs:                map[registerType]int16{},
+		scopes:                 []map[string]int16{},
+		complexBinaryOpIndexes: map[ast.OperatorType]int16{},
 		complexUnaryOpIndex:    -1,
 		path:                   path,
 	}
@@ -216,14 +264,17 @@ func (fb *functionBuilder) currentStackShift() runtime.StackShift {
 // enterScope enters a new scope.
 // Every enterScope call must be paired with a corresponding exitScope call.
 func (fb *functionBuilder) enterScope() {
-	fb.scopes = append(fb.scopes, map[string]int8{})
+	fb.scopes = append(fb.scopes, map[string]int16{})
+	fb.scopeVars = append(fb.scopeVars, nil)
 	fb.enterStack()
 }
 
 // exitScope exits last scope.
 // Every exitScope call must be paired with a corresponding enterScope call.
 func (fb *functionBuilder) exitScope() {
+	fb.closeVars(fb.scopeVars[len(fb.scopeVars)-1])
 	fb.scopes = fb.scopes[:len(fb.scopes)-1]
+	fb.scopeVars = fb.scopeVars[:len(fb.scopeVars)-1]
 	fb.exitStack()
 }
 
@@ -260,7 +311,7 @@ func (fb *functionBuilder) exitStack() {
 }
 
 // newRegister makes a new register of a given kind.
-func (fb *functionBuilder) newRegister(kind reflect.Kind) int8 {
+func (fb *functionBuilder) newRegister(kind reflect.Kind) int16 {
 	t := kindToType(kind)
 	num := fb.numRegs[t]
 	if num == maxRegistersCount {
@@ -271,20 +322,52 @@ func (fb *functionBuilder) newRegister(kind reflect.Kind) int8 {
 }
 
 // newIndirectRegister allocates a new indirect register.
-func (fb *functionBuilder) newIndirectRegister() int8 {
+func (fb *functionBuilder) newIndirectRegister() int16 {
 	return -fb.newRegister(reflect.Interface)
 }
 
 // bindVarReg binds name with register reg. To create a new variable, use
 // VariableRegister in conjunction with bindVarReg.
-func (fb *functionBuilder) bindVarReg(name string, reg int8) {
-	fb.scopes[len(fb.scopes)-1][name] = reg
+//
+// typ is the type of the variable and it is used by debuggers to read its
+// value. It is nil for the variables introduced by the emitter. Blank
+// identifiers, and the names starting with '$' introduced by the type
+// checker, are not recorded for debuggers.
+func (fb *functionBuilder) bindVarReg(name string, reg int16, typ reflect.Type) {
+	c := len(fb.scopes) - 1
+	fb.scopes[c][name] = reg
+	if typ == nil || name == "_" || strings.HasPrefix(name, "$") {
+		return
+	}
+	// Close the scope of a variable with the same name in the same scope.
+	for _, i := range fb.scopeVars[c] {
+		if v := &fb.fn.Vars[i]; v.Name == name && v.End == 0 {
+			v.End = fb.currentAddr()
+		}
+	}
+	fb.scopeVars[c] = append(fb.scopeVars[c], len(fb.fn.Vars))
+	fb.fn.Vars = append(fb.fn.Vars, runtime.VarInfo{
+		Name:  name,
+		Type:  typ,
+		Reg:   reg,
+		Start: fb.currentAddr(),
+	})
+}
+
+// closeVars closes the scopes, at the current address, of the variables
+// with the given indexes in fb.fn.Vars.
+func (fb *functionBuilder) closeVars(vars []int) {
+	for _, i := range vars {
+		if v := &fb.fn.Vars[i]; v.End == 0 {
+			v.End = fb.currentAddr()
+		}
+	}
 }
 
 // declaredInCurrentScope returns the register where v is stored and true in
 // case of v is a variable declared in the current scope, else returns 0 and
 // false.
-func (fb *functionBuilder) declaredInCurrentScope(v string) (int8, bool) {
+func (fb *functionBuilder) declaredInCurrentScope(v string) (int16, bool) {
 	reg, ok := fb.scopes[len(fb.scopes)-1][v]
 	return reg, ok
 }
@@ -301,7 +384,7 @@ func (fb *functionBuilder) declaredInFunc(v string) bool {
 }
 
 // scopeLookup returns n's register.
-func (fb *functionBuilder) scopeLookup(n string) int8 {
+func (fb *functionBuilder) scopeLookup(n string) int16 {
 	for i := len(fb.scopes) - 1; i >= 0; i-- {
 		reg, ok := fb.scopes[i][n]
 		if ok {
@@ -399,26 +482,29 @@ func (fb *functionBuilder) addType(typ reflect.Type, preserveType bool) int {
 	return index
 }
 
-// addNativeFunction adds a native function to the builder's function.
-func (fb *functionBuilder) addNativeFunction(f *runtime.NativeFunction) int8 {
+// addNativeFunction adds a native function to the builder's function and
+// returns its index. An index greater than 127 does not fit in an int8
+// operand and the VM reads it, as an uint16, from a wide instruction.
+func (fb *functionBuilder) addNativeFunction(f *runtime.NativeFunction) int16 {
 	fn := fb.fn
 	r := len(fn.NativeFunctions)
 	if r == maxNativeFunctionsCount {
 		panic(newLimitExceededError(fb.fn.Pos, fb.path, "native functions count exceeded %d", maxNativeFunctionsCount))
 	}
 	fn.NativeFunctions = append(fn.NativeFunctions, f)
-	return int8(r)
+	return int16(r)
 }
 
-// addFunction adds a function to the builder's function.
-func (fb *functionBuilder) addFunction(f *runtime.Function) int8 {
+// addFunction adds a function to the builder's function and returns its
+// index. See addNativeFunction for the encoding of the index.
+func (fb *functionBuilder) addFunction(f *runtime.Function) int16 {
 	fn := fb.fn
 	r := len(fn.Functions)
 	if r == maxScriggoFunctionsCount {
 		panic(newLimitExceededError(fb.fn.Pos, fb.path, "Scriggo functions count exceeded %d", maxScriggoFunctionsCount))
 	}
 	fn.Functions = append(fn.Functions, f)
-	return int8(r)
+	return int16(r)
 }
 
 // makeStringValue makes a new string value, returning it's index.
@@ -539,6 +625,64 @@ func (fb *functionBuilder) currentAddr() runtime.Addr {
 	return runtime.Addr(len(fb.fn.Body))
 }
 
+// isInt8 reports whether the operand v fits in an int8.
+func isInt8(v int16) bool {
+	return -128 <= v && v <= 127
+}
+
+// appendInstruction appends an instruction with operation op and operands
+// a, b and c to the function body. If an operand does not fit in an int8,
+// the instruction is preceded by an OpWide instruction.
+func (fb *functionBuilder) appendInstruction(op runtime.Operation, a, b, c int16) {
+	if isInt8(a) && isInt8(b) && isInt8(c) {
+		fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: int8(a), B: int8(b), C: int8(c)})
+		return
+	}
+	fb.appendWideInstruction(op, a, b, c)
+}
+
+// appendWideInstruction is like appendInstruction but always precedes the
+// instruction with an OpWide instruction with the high bytes of the
+// operands. The info of the instruction, if added before, is moved to the
+// address of the instruction.
+func (fb *functionBuilder) appendWideInstruction(op runtime.Operation, a, b, c int16) {
+	fn := fb.fn
+	addr := fb.currentAddr()
+	if info, ok := fn.InstructionInfo[addr]; ok {
+		delete(fn.InstructionInfo, addr)
+		fn.InstructionInfo[addr+1] = info
+	}
+	fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.OpWide, A: int8(a >> 8), B: int8(b >> 8), C: int8(c >> 8)})
+	fn.Body = append(fn.Body, runtime.Instruction{Op: op, A: int8(a), B: int8(b), C: int8(c)})
+}
+
+// appendDataWord appends the data word, with operands a, b and c, that
+// follows the MakeSlice, Slice and StringSlice instructions. If wide is true,
+// it also appends a word with the high bytes of the operands.
+func (fb *functionBuilder) appendDataWord(wide bool, a, b, c int16) {
+	fn := fb.fn
+	fn.Body = append(fn.Body, runtime.Instruction{A: int8(a), B: int8(b), C: int8(c)})
+	if wide {
+		fn.Body = append(fn.Body, runtime.Instruction{A: int8(a >> 8), B: int8(b >> 8), C: int8(c >> 8)})
+	}
+}
+
+// appendStackShift appends the stack shift of a call to the function body.
+// See the runtime.StackShift type for its encoding.
+func (fb *functionBuilder) appendStackShift(shift runtime.StackShift) {
+	fn := fb.fn
+	if isInt8(shift[0]) && isInt8(shift[1]) && isInt8(shift[2]) && isInt8(shift[3]) {
+		fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.Operation(shift[0]), A: int8(shift[1]), B: int8(shift[2]), C: int8(shift[3])})
+		return
+	}
+	fn.Body = append(fn.Body,
+		runtime.Instruction{Op: -1},
+		runtime.Instruction{Op: runtime.Operation(shift[0]), A: int8(shift[1]), B: int8(shift[2]), C: int8(shift[3])},
+		runtime.Instruction{Op: runtime.Operation(shift[0] >> 8), A: int8(shift[1] >> 8), B: int8(shift[2] >> 8), C: int8(shift[3] >> 8)},
+		runtime.Instruction{Op: -1},
+	)
+}
+
 // newLabel creates a new empty label. Use setLabelAddr to associate an
 // address to it.
 func (fb *functionBuilder) newLabel() label {
@@ -585,6 +729,9 @@ func (fb *functionBuilder) end() {
 		fn.Body[addr] = i
 	}
 	fb.gotos = nil
+	for _, vars := range fb.scopeVars {
+		fb.closeVars(vars)
+	}
 	for typ, num := range fb.maxRegs {
 		if num > fn.NumReg[typ] {
 			fn.NumReg[typ] = num
@@ -592,7 +739,7 @@ func (fb *functionBuilder) end() {
 	}
 }
 
-func (fb *functionBuilder) allocRegister(typ registerType, reg int8) {
+func (fb *functionBuilder) allocRegister(typ registerType, reg int16) {
 	if max, ok := fb.maxRegs[typ]; !ok || reg > max {
 		fb.maxRegs[typ] = reg
 	}
@@ -603,7 +750,7 @@ func (fb *functionBuilder) allocRegister(typ registerType, reg int8) {
 
 // complexOperationIndex returns the index of the function which performs the
 // binary or unary operation specified by op.
-func (fb *functionBuilder) complexOperationIndex(op ast.OperatorType, unary bool) int8 {
+func (fb *functionBuilder) complexOperationIndex(op ast.OperatorType, unary bool) int16 {
 	if unary {
 		if fb.complexUnaryOpIndex != -1 {
 			return fb.complexUnaryOpIndex
@@ -20,7 +20,7 @@ func (fb *functionBuilder) emitNop() {
 // emitAdd appends a new "Add" instruction to the function body.
 //
 //	z = x + y
-func (fb *functionBuilder) emitAdd(k bool, x, y, z int8, kind reflect.Kind) {
+func (fb *functionBuilder) emitAdd(k bool, x, y, z int16, kind reflect.Kind) {
 	var op runtime.Operation
 	switch kind {
 	case reflect.Int:
@@ -31,68 +31,66 @@ func (fb *functionBuilder) emitAdd(k bool, x, y, z int8, kind reflect.Kind) {
 		if z != x {
 			panic(fmt.Errorf("z must be == x for kind %s", kind))
 		}
-		x = int8(flattenIntegerKind(kind))
+		x = int16(flattenIntegerKind(kind))
 		op = runtime.OpAdd
 	}
 	if k {
 		op = -op
 	}
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: x, B: y, C: z})
+	fb.appendInstruction(op, x, y, z)
 }
 
 // emitAddr appends a new "Addr" instruction to the function body.
 //
 //	dest = &expr.Field
 //	dest = &expr[index]
-func (fb *functionBuilder) emitAddr(expr, index, dest int8, pos *ast.Position) {
+func (fb *functionBuilder) emitAddr(expr, index, dest int16, pos *ast.Position) {
 	fb.addPosAndPath(pos)
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpAddr, A: expr, B: index, C: dest})
+	fb.appendInstruction(runtime.OpAddr, expr, index, dest)
 }
 
 // emitAnd appends a new "And" instruction to the function body.
 //
 //	z = x & y
-func (fb *functionBuilder) emitAnd(k bool, x, y, z int8, kind reflect.Kind) {
+func (fb *functionBuilder) emitAnd(k bool, x, y, z int16, kind reflect.Kind) {
 	op := runtime.OpAnd
 	if k {
 		op = -op
 	}
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: x, B: y, C: z})
+	fb.appendInstruction(op, x, y, z)
 }
 
 // emitAndNot appends a new "AndNot" instruction to the function body.
 //
 //	z = x &^ y
-func (fb *functionBuilder) emitAndNot(k bool, x, y, z int8, kind reflect.Kind) {
+func (fb *functionBuilder) emitAndNot(k bool, x, y, z int16, kind reflect.Kind) {
 	op := runtime.OpAndNot
 	if k {
 		op = -op
 	}
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: x, B: y, C: z})
+	fb.appendInstruction(op, x, y, z)
 }
 
 // emitAppend appends a new "Append" instruction to the function body.
-func (fb *functionBuilder) emitAppend(start, end, s int8, elementsKind reflect.Kind) {
+func (fb *functionBuilder) emitAppend(start, end, s int16, elementsKind reflect.Kind) {
 	fb.addOperandKinds(elementsKind, elementsKind, 0)
-	fn := fb.fn
-	fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.OpAppend, A: start, B: end, C: s})
+	fb.appendInstruction(runtime.OpAppend, start, end, s)
 }
 
 // emitAppendSlice appends a new "AppendSlice" instruction to the function body.
 //
 //	s = append(s, t)
-func (fb *functionBuilder) emitAppendSlice(t, s int8, pos *ast.Position) {
+func (fb *functionBuilder) emitAppendSlice(t, s int16, pos *ast.Position) {
 	fb.addPosAndPath(pos)
-	fn := fb.fn
-	fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.OpAppendSlice, A: t, C: s})
+	fb.appendInstruction(runtime.OpAppendSlice, t, 0, s)
 }
 
 // emitAssert appends a new "assert" instruction to the function body.
 //
 //	z = e.(t)
-func (fb *functionBuilder) emitAssert(e int8, typ reflect.Type, z int8) {
+func (fb *functionBuilder) emitAssert(e int16, typ reflect.Type, z int16) {
 	t := fb.addType(typ, true)
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpAssert, A: e, B: int8(t), C: z})
+	fb.appendInstruction(runtime.OpAssert, e, int16(int8(t)), z)
 }
 
 // emitBreak appends a new "Break" instruction to the function body.
@@ -107,97 +105,99 @@ func (fb *functionBuilder) emitBreak(lab label) {
 // emitCallFunc appends a new "CallFunc" instruction to the function body.
 //
 //	p.f()
-func (fb *functionBuilder) emitCallFunc(f int8, shift runtime.StackShift, pos *ast.Position) {
+func (fb *functionBuilder) emitCallFunc(f int16, shift runtime.StackShift, pos *ast.Position) {
 	fb.addPosAndPath(pos)
-	fn := fb.fn
-	fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.OpCallFunc, A: f})
-	fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.Operation(shift[0]), A: shift[1], B: shift[2], C: shift[3]})
+	fb.appendInstruction(runtime.OpCallFunc, f, 0, 0)
+	fb.appendStackShift(shift)
 }
 
 // emitCallMacro appends a new "CallMacro" instruction to the function body.
 //
 //	p.m()
-func (fb *functionBuilder) emitCallMacro(f int8, shift runtime.StackShift, pos *ast.Position, toFormat ast.Format) {
+func (fb *functionBuilder) emitCallMacro(f int16, shift runtime.StackShift, pos *ast.Position, toFormat ast.Format) {
 	fb.addPosAndPath(pos)
-	fn := fb.fn
-	fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.OpCallMacro, A: f, B: int8(toFormat)})
-	fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.Operation(shift[0]), A: shift[1], B: shift[2], C: shift[3]})
+	fb.appendInstruction(runtime.OpCallMacro, f, int16(int8(toFormat)), 0)
+	fb.appendStackShift(shift)
 }
 
 // emitCallIndirect appends a new "CallIndirect" instruction to the function body.
 //
 //	f()
-func (fb *functionBuilder) emitCallIndirect(f int8, numVariadic int8, shift runtime.StackShift, pos *ast.Position, funcType reflect.Type, toFormat ast.Format) {
+func (fb *functionBuilder) emitCallIndirect(f int16, numVariadic int8, shift runtime.StackShift, pos *ast.Position, funcType reflect.Type, toFormat ast.Format) {
 	fb.addPosAndPath(pos)
 	fb.addFunctionType(funcType)
-	fn := fb.fn
-	fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.OpCallIndirect, A: f, B: int8(toFormat), C: numVariadic})
-	fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.Operation(shift[0]), A: shift[1], B: shift[2], C: shift[3]})
+	fb.appendInstruction(runtime.OpCallIndirect, f, int16(int8(toFormat)), int16(numVariadic))
+	fb.appendStackShift(shift)
 }
 
 // emitCallNative appends a new "CallNative" instruction to the function body.
 //
 //	p.F()
-func (fb *functionBuilder) emitCallNative(f int8, numVariadic int8, shift runtime.StackShift, pos *ast.Position) {
+func (fb *functionBuilder) emitCallNative(f int16, numVariadic int8, shift runtime.StackShift, pos *ast.Position) {
 	fb.addPosAndPath(pos)
-	fn := fb.fn
-	fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.OpCallNative, A: f, C: numVariadic})
-	fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.Operation(shift[0]), A: shift[1], B: shift[2], C: shift[3]})
+	fb.appendInstruction(runtime.OpCallNative, f, 0, int16(numVariadic))
+	fb.appendStackShift(shift)
 }
 
 // emitCap appends a new "cap" instruction to the function body.
 //
 //	z = cap(s)
-func (fb *functionBuilder) emitCap(s, z int8) {
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpCap, A: s, C: z})
+func (fb *functionBuilder) emitCap(s, z int16) {
+	fb.appendInstruction(runtime.OpCap, s, 0, z)
 }
 
-// emitCase appends a new "Case" instruction to the function body.
+// emitCase appends a new "Case" instruction to the function body. If wide
+// is true, the instruction is preceded by an OpWide instruction even if its
+// operands fit in an int8. See also emitSelect.
 //
 //	case ch <- value
 //	case value = <-ch
 //	default
-func (fb *functionBuilder) emitCase(kvalue bool, dir reflect.SelectDir, value, ch int8) {
-	in := runtime.Instruction{Op: runtime.OpCase, A: int8(dir)}
+func (fb *functionBuilder) emitCase(kvalue bool, dir reflect.SelectDir, value, ch int16, wide bool) {
+	op := runtime.OpCase
 	if kvalue {
-		in.Op = -in.Op
+		op = -op
 	}
+	var b, c int16
 	switch dir {
 	case reflect.SelectSend:
-		in.B = value
-		in.C = ch
+		b = value
+		c = ch
 	case reflect.SelectRecv:
-		in.B = ch
-		in.C = value
+		b = ch
+		c = value
 	}
-	fb.fn.Body = append(fb.fn.Body, in)
+	if wide {
+		fb.appendWideInstruction(op, int16(dir), b, c)
+		return
+	}
+	fb.appendInstruction(op, int16(dir), b, c)
 }
 
 // emitClose appends a new "Close" instruction to the function body.
 //
 //	close(ch)
-func (fb *functionBuilder) emitClose(ch int8, pos *ast.Position) {
+func (fb *functionBuilder) emitClose(ch int16, pos *ast.Position) {
 	fb.addPosAndPath(pos)
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpClose, A: ch})
+	fb.appendInstruction(runtime.OpClose, ch, 0, 0)
 }
 
 // emitComplex appends a new "Complex" instruction to the function body.
 //
 //	z = complex(x, y)
-func (fb *functionBuilder) emitComplex(x, y, z int8, kind reflect.Kind) {
+func (fb *functionBuilder) emitComplex(x, y, z int16, kind reflect.Kind) {
 	op := runtime.OpComplex128
 	if kind == reflect.Complex64 {
 		op = runtime.OpComplex64
 	}
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: x, B: y, C: z})
+	fb.appendInstruction(op, x, y, z)
 }
 
 // emitConcat appends a new "concat" instruction to the function body.
 //
 //	z = concat(s, t)
-func (fb *functionBuilder) emitConcat(s, t, z int8) {
-	fn := fb.fn
-	fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.OpConcat, A: s, B: t, C: z})
+func (fb *functionBuilder) emitConcat(s, t, z int16) {
+	fb.appendInstruction(runtime.OpConcat, s, t, z)
 }
 
 // emitContinue appends a new "Continue" instruction to the function body.
@@ -212,8 +212,7 @@ func (fb *functionBuilder) emitContinue(lab label) {
 // emitConvert appends a new "Convert" instruction to the function body.
 //
 //	dst = typ(src)
-func (fb *functionBuilder) emitConvert(src int8, typ reflect.Type, dst int8, srcKind reflect.Kind) {
-	fn := fb.fn
+func (fb *functionBuilder) emitConvert(src int16, typ reflect.Type, dst int16, srcKind reflect.Kind) {
 	regType := fb.addType(typ, false)
 	var op runtime.Operation
 	switch kindToType(srcKind) {
@@ -236,39 +235,38 @@ func (fb *functionBuilder) emitConvert(src int8, typ reflect.Type, dst int8, src
 	case floatRegister:
 		op = runtime.OpConvertFloat
 	}
-	fn.Body = append(fn.Body, runtime.Instruction{Op: op, A: src, B: int8(regType), C: dst})
+	fb.appendInstruction(op, src, int16(int8(regType)), dst)
 }
 
 // emitCopy appends a new "Copy" instruction to the function body.
 //
 //	n == 0:   copy(dst, src)
 //	n != 0:   n := copy(dst, src)
-func (fb *functionBuilder) emitCopy(dst, src, n int8) {
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpCopy, A: src, B: n, C: dst})
+func (fb *functionBuilder) emitCopy(dst, src, n int16) {
+	fb.appendInstruction(runtime.OpCopy, src, n, dst)
 }
 
 // emitDefer appends a new "Defer" instruction to the function body.
 //
 //	defer
-func (fb *functionBuilder) emitDefer(f int8, numVariadic int8, off, arg runtime.StackShift, funcType reflect.Type) {
+func (fb *functionBuilder) emitDefer(f int16, numVariadic int8, off, arg runtime.StackShift, funcType reflect.Type) {
 	fb.addFunctionType(funcType)
-	fn := fb.fn
-	fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.OpDefer, A: f, C: numVariadic})
-	fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.Operation(off[0]), A: off[1], B: off[2], C: off[3]})
-	fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.Operation(arg[0]), A: arg[1], B: arg[2], C: arg[3]})
+	fb.appendInstruction(runtime.OpDefer, f, 0, int16(numVariadic))
+	fb.appendStackShift(off)
+	fb.appendStackShift(arg)
 }
 
 // emitDelete appends a new "delete" instruction to the function body.
 //
 //	delete(m, k)
-func (fb *functionBuilder) emitDelete(m, k int8) {
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpDelete, A: m, B: k})
+func (fb *functionBuilder) emitDelete(m, k int16) {
+	fb.appendInstruction(runtime.OpDelete, m, k, 0)
 }
 
 // emitDiv appends a new "div" instruction to the function body.
 //
 //	z = x / y
-func (fb *functionBuilder) emitDiv(ky bool, x, y, z int8, kind reflect.Kind, pos *ast.Position) {
+func (fb *functionBuilder) emitDiv(ky bool, x, y, z int16, kind reflect.Kind, pos *ast.Position) {
 	var op runtime.Operation
 	switch kind {
 	case reflect.Int:
@@ -279,39 +277,39 @@ func (fb *functionBuilder) emitDiv(ky bool, x, y, z int8, kind reflect.Kind, pos
 		if z != x {
 			panic(fmt.Errorf("z must be == x for kind %s", kind))
 		}
-		x = int8(flattenIntegerKind(kind))
+		x = int16(flattenIntegerKind(kind))
 		op = runtime.OpDiv
 	}
 	fb.addPosAndPath(pos)
 	if ky {
 		op = -op
 	}
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: x, B: y, C: z})
+	fb.appendInstruction(op, x, y, z)
 }
 
 // emitField appends a new "Field" instruction to the function body.
 //
 //	c = a.field
-func (fb *functionBuilder) emitField(a, field, c int8, dstKind reflect.Kind) {
+func (fb *functionBuilder) emitField(a int16, field int8, c int16, dstKind reflect.Kind) {
 	fb.addOperandKinds(0, 0, dstKind)
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpField, A: a, B: field, C: c})
+	fb.appendInstruction(runtime.OpField, a, int16(field), c)
 }
 
 // emitGetVar appends a new "GetVar" instruction to the function body.
 //
 //	r = v
-func (fb *functionBuilder) emitGetVar(v int, r int8, varKind reflect.Kind) {
+func (fb *functionBuilder) emitGetVar(v int, r int16, varKind reflect.Kind) {
 	a, b := encodeInt16(int16(v))
 	fb.addOperandKinds(0, 0, varKind)
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpGetVar, A: a, B: b, C: r})
+	fb.appendInstruction(runtime.OpGetVar, int16(a), int16(b), r)
 }
 
 // emitGetVarAddr appends a new "GetVarAddr" instruction to the function body.
 //
 //	r = &v
-func (fb *functionBuilder) emitGetVarAddr(v int, r int8) {
+func (fb *functionBuilder) emitGetVarAddr(v int, r int16) {
 	a, b := encodeInt16(int16(v))
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpGetVarAddr, A: a, B: b, C: r})
+	fb.appendInstruction(runtime.OpGetVarAddr, int16(a), int16(b), r)
 }
 
 // emitGo appends a new "Go" instruction to the function body.
@@ -359,7 +357,7 @@ func (fb *functionBuilder) emitGoto(lab label) {
 //	len(x) >  y
 //	len(x) >= y
 //	x contains y
-func (fb *functionBuilder) emitIf(ky bool, x int8, o runtime.Condition, y int8, kind reflect.Kind, pos *ast.Position) {
+func (fb *functionBuilder) emitIf(ky bool, x int16, o runtime.Condition, y int16, kind reflect.Kind, pos *ast.Position) {
 	fb.addPosAndPath(pos)
 	var op runtime.Operation
 	switch kindToType(kind) {
@@ -375,7 +373,7 @@ func (fb *functionBuilder) emitIf(ky bool, x int8, o runtime.Condition, y int8,
 	if ky {
 		op = -op
 	}
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: x, B: int8(o), C: y})
+	fb.appendInstruction(op, x, int16(int8(o)), y)
 }
 
 // emitIndex appends a new "Index", "IndexRef", "MapIndex", or "IndexString"
@@ -388,9 +386,8 @@ func (fb *functionBuilder) emitIf(ky bool, x int8, o runtime.Condition, y int8,
 //
 // TODO: consider splitting emitIndex in two methods removing the 'ref bool'
 // argument.
-func (fb *functionBuilder) emitIndex(ki bool, expr, i, dst int8, t reflect.Type, pos *ast.Position, ref bool) {
+func (fb *functionBuilder) emitIndex(ki bool, expr, i, dst int16, t reflect.Type, pos *ast.Position, ref bool) {
 	fb.addPosAndPath(pos)
-	fn := fb.fn
 	kind := t.Kind()
 	// TODO: re-enable this check?
 	// if ref && (kind != reflect.Array && kind != reflect.Slice) {
@@ -419,86 +416,81 @@ func (fb *functionBuilder) emitIndex(ki bool, expr, i, dst int8, t reflect.Type,
 	if ki {
 		op = -op
 	}
-	fn.Body = append(fn.Body, runtime.Instruction{Op: op, A: expr, B: i, C: dst})
+	fb.appendInstruction(op, expr, i, dst)
 }
 
 // emitLen appends a new "len" instruction to the function body.
 //
 //	l = len(s)
-func (fb *functionBuilder) emitLen(s, l int8, t reflect.Type) {
+func (fb *functionBuilder) emitLen(s, l int16, t reflect.Type) {
 	a := stringRegister
 	if t.Kind() != reflect.String {
 		a = generalRegister
 	}
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpLen, A: int8(a), B: s, C: l})
+	fb.appendInstruction(runtime.OpLen, int16(int8(a)), s, l)
 }
 
 // emitLoadFunc appends a new "LoadFunc" instruction to the function body.
 //
 //	z = p.f
-func (fb *functionBuilder) emitLoadFunc(native bool, f int8, z int8) {
-	fn := fb.fn
-	var a int8
+func (fb *functionBuilder) emitLoadFunc(native bool, f int16, z int16) {
+	var a int16
 	if native {
 		a = 1
 	}
-	fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.OpLoadFunc, A: a, B: f, C: z})
+	fb.appendInstruction(runtime.OpLoadFunc, a, f, z)
 }
 
 // emitLoad appends a new "Load" instruction to the function body.
-func (fb *functionBuilder) emitLoad(index int, dst int8, kind reflect.Kind) {
+func (fb *functionBuilder) emitLoad(index int, dst int16, kind reflect.Kind) {
 	a, b := encodeValueIndex(kindToType(kind), index)
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpLoad, A: a, B: b, C: dst})
+	fb.appendInstruction(runtime.OpLoad, int16(a), int16(b), dst)
 }
 
 // emitMakeArray appends a new "MakeArray" instruction to the function body.
-func (fb *functionBuilder) emitMakeArray(typ reflect.Type, dst int8) {
+func (fb *functionBuilder) emitMakeArray(typ reflect.Type, dst int16) {
 	if typ.Kind() != reflect.Array {
 		panic(internalError("%s is not an array type", typ))
 	}
 	// NOTE: the code of emitMakeArray, emitMakeStruct and emitNew is very
 	// similar. If you change this code remember to review/change the code of
 	// the other methods.
-	fn := fb.fn
 	b := fb.addType(typ, false)
-	fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.OpMakeArray, B: int8(b), C: dst})
+	fb.appendInstruction(runtime.OpMakeArray, 0, int16(int8(b)), dst)
 }
 
 // emitMakeChan appends a new "MakeChan" instruction to the function body.
 //
 //	dst = make(typ, capacity)
-func (fb *functionBuilder) emitMakeChan(typ reflect.Type, kCapacity bool, capacity int8, dst int8, pos *ast.Position) {
+func (fb *functionBuilder) emitMakeChan(typ reflect.Type, kCapacity bool, capacity int16, dst int16, pos *ast.Position) {
 	fb.addPosAndPath(pos)
-	fn := fb.fn
 	t := fb.addType(typ, false)
 	op := runtime.OpMakeChan
 	if kCapacity {
 		op = -op
 	}
-	fn.Body = append(fn.Body, runtime.Instruction{Op: op, A: int8(t), B: capacity, C: dst})
+	fb.appendInstruction(op, int16(int8(t)), capacity, dst)
 }
 
 // emitMakeMap appends a new "MakeMap" instruction to the function body.
 //
 //	dst = make(typ, size)
-func (fb *functionBuilder) emitMakeMap(typ reflect.Type, kSize bool, size int8, dst int8) {
-	fn := fb.fn
+func (fb *functionBuilder) emitMakeMap(typ reflect.Type, kSize bool, size int16, dst int16) {
 	t := fb.addType(typ, false)
 	op := runtime.OpMakeMap
 	if kSize {
 		op = -op
 	}
-	fn.Body = append(fn.Body, runtime.Instruction{Op: op, A: int8(t), B: size, C: dst})
+	fb.appendInstruction(op, int16(int8(t)), size, dst)
 }
 
 // emitMakeSlice appends a new "MakeSlice" instruction to the function body.
 //
 //	make(sliceType, len, cap)
-func (fb *functionBuilder) emitMakeSlice(kLen, kCap bool, sliceType reflect.Type, len, cap, dst int8, pos *ast.Position) {
+func (fb *functionBuilder) emitMakeSlice(kLen, kCap bool, sliceType reflect.Type, len, cap, dst int16, pos *ast.Position) {
 	fb.addPosAndPath(pos)
-	fn := fb.fn
 	t := fb.addType(sliceType, false)
-	var k int8
+	var k int16
 	if len == 0 && cap == 0 {
 		k = 0
 	} else {
@@ -509,50 +501,52 @@ func (fb *functionBuilder) emitMakeSlice(kLen, kCap bool, sliceType reflect.Type
 		if kCap {
 			k |= 1 << 2
 		}
+		if !isInt8(len) || !isInt8(cap) {
+			k |= 1 << 3
+		}
 	}
-	fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.OpMakeSlice, A: int8(t), B: k, C: dst})
+	fb.appendInstruction(runtime.OpMakeSlice, int16(int8(t)), k, dst)
 	if k > 0 {
-		fn.Body = append(fn.Body, runtime.Instruction{A: len, B: cap})
+		fb.appendDataWord(k&(1<<3) != 0, len, cap, 0)
 	}
 }
 
 // emitMakeStruct appends a new "MakeStruct" instruction to the function body.
-func (fb *functionBuilder) emitMakeStruct(typ reflect.Type, dst int8) {
+func (fb *functionBuilder) emitMakeStruct(typ reflect.Type, dst int16) {
 	if typ.Kind() != reflect.Struct {
 		panic(internalError("%s is not a struct type", typ.Kind()))
 	}
 	// NOTE: the code of emitMakeArray, emitMakeStruct and emitNew is very
 	// similar. If you change this code remember to review/change the code of
 	// the other methods.
-	fn := fb.fn
 	b := fb.addType(typ, false)
-	fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.OpMakeStruct, B: int8(b), C: dst})
+	fb.appendInstruction(runtime.OpMakeStruct, 0, int16(int8(b)), dst)
 }
 
 // emitMethodValue appends a new "MethodValue" instruction to the function body.
 //
 //	dst = receiver.name
-func (fb *functionBuilder) emitMethodValue(name int8, receiver int8, dst int8, pos *ast.Position) {
+func (fb *functionBuilder) emitMethodValue(name int8, receiver int16, dst int16, pos *ast.Position) {
 	fb.addPosAndPath(pos)
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpMethodValue, A: receiver, B: name, C: dst})
+	fb.appendInstruction(runtime.OpMethodValue, receiver, int16(name), dst)
 }
 
 // emitMove appends a new "Move" instruction to the function body.
 //
 //	z = x
-func (fb *functionBuilder) emitMove(k bool, x, z int8, kind reflect.Kind) {
+func (fb *functionBuilder) emitMove(k bool, x, z int16, kind reflect.Kind) {
 	op := runtime.OpMove
 	if k {
 		op = -op
 	}
-	a := int8(kindToType(kind))
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: a, B: x, C: z})
+	a := int16(kindToType(kind))
+	fb.appendInstruction(op, a, x, z)
 }
 
 // emitMul appends a new "mul" instruction to the function body.
 //
 //	z = x * y
-func (fb *functionBuilder) emitMul(ky bool, x, y, z int8, kind reflect.Kind) {
+func (fb *functionBuilder) emitMul(ky bool, x, y, z int16, kind reflect.Kind) {
 	var op runtime.Operation
 	switch kind {
 	case reflect.Int:
@@ -563,51 +557,50 @@ func (fb *functionBuilder) emitMul(ky bool, x, y, z int8, kind reflect.Kind) {
 		if z != x {
 			panic(fmt.Errorf("z must be == x for kind %s", kind))
 		}
-		x = int8(flattenIntegerKind(kind))
+		x = int16(flattenIntegerKind(kind))
 		op = runtime.OpMul
 	}
 	if ky {
 		op = -op
 	}
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: x, B: y, C: z})
+	fb.appendInstruction(op, x, y, z)
 }
 
 // emitNeg appends a new "neg" instruction to the function body.
 //
 //	z = -y
-func (fb *functionBuilder) emitNeg(y, z int8, kind reflect.Kind) {
-	x := int8(flattenIntegerKind(kind))
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpNeg, A: x, B: y, C: z})
+func (fb *functionBuilder) emitNeg(y, z int16, kind reflect.Kind) {
+	x := int16(flattenIntegerKind(kind))
+	fb.appendInstruction(runtime.OpNeg, x, y, z)
 }
 
 // emitNew appends a new "new" instruction to the function body.
 //
 //	z = new(t)
-func (fb *functionBuilder) emitNew(typ reflect.Type, z int8) {
+func (fb *functionBuilder) emitNew(typ reflect.Type, z int16) {
 	// NOTE: the code of emitMakeArray, emitMakeStruct and emitNew is very
 	// similar. If you change this code remember to review/change the code of
 	// the other methods.
-	fn := fb.fn
 	b := fb.addType(typ, false)
-	fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.OpNew, B: int8(b), C: z})
+	fb.appendInstruction(runtime.OpNew, 0, int16(int8(b)), z)
 }
 
 // emitNotZero appends a new "NotZero" instruction to the function body.
-func (fb *functionBuilder) emitNotZero(kind reflect.Kind, dst, src int8) {
-	regType := int8(kindToType(kind))
+func (fb *functionBuilder) emitNotZero(kind reflect.Kind, dst, src int16) {
+	regType := int16(kindToType(kind))
 	regType += 10 // to distinguish "NotZero" from "Zero".
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpZero, A: regType, B: src, C: dst})
+	fb.appendInstruction(runtime.OpZero, regType, src, dst)
 }
 
 // emitOr appends a new "Or" instruction to the function body.
 //
 //	z = x | y
-func (fb *functionBuilder) emitOr(k bool, x, y, z int8, kind reflect.Kind) {
+func (fb *functionBuilder) emitOr(k bool, x, y, z int16, kind reflect.Kind) {
 	op := runtime.OpOr
 	if k {
 		op = -op
 	}
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: x, B: y, C: z})
+	fb.appendInstruction(op, x, y, z)
 }
 
 // emitPanic appends a new "Panic" instruction to the function body. If the
@@ -616,30 +609,31 @@ func (fb *functionBuilder) emitOr(k bool, x, y, z int8, kind reflect.Kind) {
 // otherwise typ should be nil.
 //
 //	panic(v)
-func (fb *functionBuilder) emitPanic(v int8, typ reflect.Type, pos *ast.Position) {
+func (fb *functionBuilder) emitPanic(v int16, typ reflect.Type, pos *ast.Position) {
 	fb.addPosAndPath(pos)
-	fn := fb.fn
-	in := runtime.Instruction{Op: runtime.OpPanic, A: v}
+	var t int16
 	if typ != nil {
-		in.C = int8(fb.addType(typ, true))
+		t = int16(int8(fb.addType(typ, true)))
 	}
-	fn.Body = append(fn.Body, in)
+	fb.appendInstruction(runtime.OpPanic, v, 0, t)
 }
 
 // emitPrint appends a new "Print" instruction to the function body.
 //
 //	print(arg)
-func (fb *functionBuilder) emitPrint(arg int8) {
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpPrint, A: arg})
+func (fb *functionBuilder) emitPrint(arg int16) {
+	fb.appendInstruction(runtime.OpPrint, arg, 0, 0)
 }
 
 // emitRange appends a new "Range" instruction to the function body.
 //
 //	for i, e := range s
-func (fb *functionBuilder) emitRange(k bool, s, i, e int8, kind reflect.Kind) {
-	fn := fb.fn
+//
+// For values of type []int, []float64, []string and map[string]T, it
+// appends an instruction specialized for the type.
+func (fb *functionBuilder) emitRange(k bool, s, i, e int16, typ reflect.Type) {
 	var op runtime.Operation
-	switch kind {
+	switch kind := typ.Kind(); kind {
 	case reflect.String:
 		op = runtime.OpRangeString
 		if k {
@@ -650,19 +644,30 @@ func (fb *functionBuilder) emitRange(k bool, s, i, e int8, kind reflect.Kind) {
 			panic("bug on emitter: emitRange with k = true is compatible only with kind == reflect.String")
 		}
 		op = runtime.OpRange
+		switch {
+		case kind == reflect.Slice && typ.Elem() == intType:
+			op = runtime.OpRangeSliceInt
+		case kind == reflect.Slice && typ.Elem() == float64Type:
+			op = runtime.OpRangeSliceFloat64
+		case kind == reflect.Slice && typ.Elem() == stringType:
+			op = runtime.OpRangeSliceString
+		case kind == reflect.Map && typ.Key() == stringType:
+			op = runtime.OpRangeMapString
+			fb.addOperandKinds(0, reflect.String, typ.Elem().Kind())
+		}
 	}
-	fn.Body = append(fn.Body, runtime.Instruction{Op: op, A: s, B: i, C: e})
+	fb.appendInstruction(op, s, i, e)
 }
 
 // emitRealImag appends a new "RealImag" instruction to the function body.
 //
 //	y, z = real(x), imag(x)
-func (fb *functionBuilder) emitRealImag(k bool, x, y, z int8) {
+func (fb *functionBuilder) emitRealImag(k bool, x, y, z int16) {
 	op := runtime.OpRealImag
 	if k {
 		op = -op
 	}
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: x, B: y, C: z})
+	fb.appendInstruction(op, x, y, z)
 }
 
 // emitReceive appends a new "Receive" instruction to the function body.
@@ -670,27 +675,27 @@ func (fb *functionBuilder) emitRealImag(k bool, x, y, z int8) {
 //	dst = <- ch
 //
 //	dst, ok = <- ch
-func (fb *functionBuilder) emitReceive(ch, ok, dst int8) {
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpReceive, A: ch, B: ok, C: dst})
+func (fb *functionBuilder) emitReceive(ch, ok, dst int16) {
+	fb.appendInstruction(runtime.OpReceive, ch, ok, dst)
 }
 
 // emitRecover appends a new "Recover" instruction to the function body.
 //
 //	recover()
 //	defer recover()
-func (fb *functionBuilder) emitRecover(r int8, down bool) {
-	var a int8
+func (fb *functionBuilder) emitRecover(r int16, down bool) {
+	var a int16
 	if down {
 		// Recover down the stack.
 		a = 1
 	}
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpRecover, A: a, C: r})
+	fb.appendInstruction(runtime.OpRecover, a, 0, r)
 }
 
 // emitRem appends a new "Rem" instruction to the function body.
 //
 //	z = x % y
-func (fb *functionBuilder) emitRem(ky bool, x, y, z int8, kind reflect.Kind, pos *ast.Position) {
+func (fb *functionBuilder) emitRem(ky bool, x, y, z int16, kind reflect.Kind, pos *ast.Position) {
 	fb.addPosAndPath(pos)
 	var op runtime.Operation
 	switch kind {
@@ -700,13 +705,13 @@ func (fb *functionBuilder) emitRem(ky bool, x, y, z int8, kind reflect.Kind, pos
 		if z != x {
 			panic(fmt.Errorf("z must be == x for kind %s", kind))
 		}
-		x = int8(flattenIntegerKind(kind))
+		x = int16(flattenIntegerKind(kind))
 		op = runtime.OpRem
 	}
 	if ky {
 		op = -op
 	}
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: x, B: y, C: z})
+	fb.appendInstruction(op, x, y, z)
 }
 
 // emitReturn appends a new "return" instruction to the function body.
@@ -716,79 +721,84 @@ func (fb *functionBuilder) emitReturn() {
 	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpReturn})
 }
 
-// emitSelect appends a new "Select" instruction to the function body.
+// emitSelect appends a new "Select" instruction to the function body. wide
+// reports whether the preceding Case instructions have been emitted with an
+// OpWide instruction.
 //
 //	select
-func (fb *functionBuilder) emitSelect() {
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpSelect})
+func (fb *functionBuilder) emitSelect(wide bool) {
+	var a int16
+	if wide {
+		a = 1
+	}
+	fb.appendInstruction(runtime.OpSelect, a, 0, 0)
 }
 
 // emitSend appends a new "Send" instruction to the function body.
 //
 //	ch <- v
-func (fb *functionBuilder) emitSend(ch, v int8, pos *ast.Position, chanElemKind reflect.Kind) {
+func (fb *functionBuilder) emitSend(ch, v int16, pos *ast.Position, chanElemKind reflect.Kind) {
 	fb.addPosAndPath(pos)
 	fb.addOperandKinds(chanElemKind, 0, 0)
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpSend, A: v, C: ch})
+	fb.appendInstruction(runtime.OpSend, v, 0, ch)
 }
 
 // emitSetField appends a new "SetField" instruction to the function body.
 //
 //	s.field = v
-func (fb *functionBuilder) emitSetField(k bool, s, field, v int8, fieldKind reflect.Kind) {
+func (fb *functionBuilder) emitSetField(k bool, s int16, field int8, v int16, fieldKind reflect.Kind) {
 	fb.addOperandKinds(fieldKind, 0, 0)
 	op := runtime.OpSetField
 	if k {
 		op = -op
 	}
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: v, B: s, C: field})
+	fb.appendInstruction(op, v, s, int16(field))
 }
 
 // emitSetMap appends a new "SetMap" instruction to the function body.
 //
 //	m[key] = value
-func (fb *functionBuilder) emitSetMap(k bool, m, value, key int8, mapType reflect.Type, pos *ast.Position) {
+func (fb *functionBuilder) emitSetMap(k bool, m, value, key int16, mapType reflect.Type, pos *ast.Position) {
 	keyType := mapType.Key()
 	valueType := mapType.Elem()
 	fb.addPosAndPath(pos)
 	fb.addOperandKinds(valueType.Kind(), 0, keyType.Kind())
-	fn := fb.fn
 	op := runtime.OpSetMap
 	if k {
 		op = -op
 	}
-	fn.Body = append(fn.Body, runtime.Instruction{Op: op, A: value, B: m, C: key})
+	fb.appendInstruction(op, value, m, key)
 }
 
 // emitSetSlice appends a new "SetSlice" instruction to the function body.
 //
 //	slice[index] = value
-func (fb *functionBuilder) emitSetSlice(k bool, slice, value, index int8, pos *ast.Position, sliceElemKind reflect.Kind) {
+func (fb *functionBuilder) emitSetSlice(k bool, slice, value, index int16, pos *ast.Position, sliceElemKind reflect.Kind) {
 	fb.addPosAndPath(pos)
 	fb.addOperandKinds(sliceElemKind, 0, 0)
-	in := runtime.Instruction{Op: runtime.OpSetSlice, A: value, B: slice, C: index}
+	op := runtime.OpSetSlice
 	if k {
-		in.Op = -in.Op
+		op = -op
 	}
-	fb.fn.Body = append(fb.fn.Body, in)
+	fb.appendInstruction(op, value, slice, index)
 }
 
 // emitSetVar appends a new "SetVar" instruction to the function body.
 //
 //	v = r
-func (fb *functionBuilder) emitSetVar(k bool, r int8, v int, dstKind reflect.Kind) {
+func (fb *functionBuilder) emitSetVar(k bool, r int16, v int, dstKind reflect.Kind) {
 	fb.addOperandKinds(dstKind, 0, 0)
 	op := runtime.OpSetVar
 	if k {
 		op = -op
 	}
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: r, B: int8(v >> 8), C: int8(v)})
+	fb.appendInstruction(op, r, int16(int8(v>>8)), int16(int8(v)))
 }
 
 // emitShl appends a new "Shl" instruction to the function body.
 //
 //	z = x << y
-func (fb *functionBuilder) emitShl(k bool, x, y, z int8, kind reflect.Kind) {
+func (fb *functionBuilder) emitShl(k bool, x, y, z int16, kind reflect.Kind) {
 	var op runtime.Operation
 	switch kind {
 	case reflect.Int:
@@ -797,28 +807,28 @@ func (fb *functionBuilder) emitShl(k bool, x, y, z int8, kind reflect.Kind) {
 		if z != x {
 			panic(fmt.Errorf("z must be == x for kind %s", kind))
 		}
-		x = int8(flattenIntegerKind(kind))
+		x = int16(flattenIntegerKind(kind))
 		op = runtime.OpShl
 	}
 	if k {
 		op = -op
 	}
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: x, B: y, C: z})
+	fb.appendInstruction(op, x, y, z)
 }
 
 // emitShow appends a new "Show" instruction to the function body.
 //
 //	show(type, value, ctx)
-func (fb *functionBuilder) emitShow(typ reflect.Type, v int8, ctx ast.Context, inURL, isURLSet bool) {
+func (fb *functionBuilder) emitShow(typ reflect.Type, v int16, ctx ast.Context, inURL, isURLSet bool) {
 	t := fb.addType(typ, true)
 	c := encodeRenderContext(ctx, inURL, isURLSet)
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpShow, A: int8(t), B: v, C: int8(c)})
+	fb.appendInstruction(runtime.OpShow, int16(int8(t)), v, int16(int8(c)))
 }
 
 // emitShr appends a new "Shr" instruction to the function body.
 //
 //	z = x >> y
-func (fb *functionBuilder) emitShr(k bool, x, y, z int8, kind reflect.Kind) {
+func (fb *functionBuilder) emitShr(k bool, x, y, z int16, kind reflect.Kind) {
 	var op runtime.Operation
 	switch kind {
 	case reflect.Int:
@@ -827,22 +837,21 @@ func (fb *functionBuilder) emitShr(k bool, x, y, z int8, kind reflect.Kind) {
 		if z != x {
 			panic(fmt.Errorf("z must be == x for kind %s", kind))
 		}
-		x = int8(flattenIntegerKind(kind))
+		x = int16(flattenIntegerKind(kind))
 		op = runtime.OpShr
 	}
 	if k {
 		op = -op
 	}
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: x, B: y, C: z})
+	fb.appendInstruction(op, x, y, z)
 }
 
 // emitSlice appends a new "Slice" instruction to the function body.
 //
 //	slice[low:high:max]
-func (fb *functionBuilder) emitSlice(klow, khigh, kmax bool, src, dst, low, high, max int8, pos *ast.Position) {
+func (fb *functionBuilder) emitSlice(klow, khigh, kmax bool, src, dst, low, high, max int16, pos *ast.Position) {
 	fb.addPosAndPath(pos)
-	fn := fb.fn
-	var b int8
+	var b int16
 	if klow {
 		b = 1
 	}
@@ -852,31 +861,38 @@ func (fb *functionBuilder) emitSlice(klow, khigh, kmax bool, src, dst, low, high
 	if kmax {
 		b |= 4
 	}
-	fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.OpSlice, A: src, B: b, C: dst})
-	fn.Body = append(fn.Body, runtime.Instruction{A: low, B: high, C: max})
+	wide := !isInt8(low) || !isInt8(high) || !isInt8(max)
+	if wide {
+		b |= 8
+	}
+	fb.appendInstruction(runtime.OpSlice, src, b, dst)
+	fb.appendDataWord(wide, low, high, max)
 }
 
 // emitStringSlice appends a new "StringSlice" instruction to the function body.
 //
 //	string[low:high]
-func (fb *functionBuilder) emitStringSlice(klow, khigh bool, src, dst, low, high int8, pos *ast.Position) {
+func (fb *functionBuilder) emitStringSlice(klow, khigh bool, src, dst, low, high int16, pos *ast.Position) {
 	fb.addPosAndPath(pos)
-	fn := fb.fn
-	var b int8
+	var b int16
 	if klow {
 		b = 1
 	}
 	if khigh {
 		b |= 2
 	}
-	fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.OpStringSlice, A: src, B: b, C: dst})
-	fn.Body = append(fn.Body, runtime.Instruction{A: low, B: high})
+	wide := !isInt8(low) || !isInt8(high)
+	if wide {
+		b |= 8
+	}
+	fb.appendInstruction(runtime.OpStringSlice, src, b, dst)
+	fb.appendDataWord(wide, low, high, 0)
 }
 
 // emitSub appends a new "Sub" instruction to the function body.
 //
 //	z = x - y
-func (fb *functionBuilder) emitSub(k bool, x, y, z int8, kind reflect.Kind) {
+func (fb *functionBuilder) emitSub(k bool, x, y, z int16, kind reflect.Kind) {
 	var op runtime.Operation
 	switch kind {
 	case reflect.Int:
@@ -887,19 +903,19 @@ func (fb *functionBuilder) emitSub(k bool, x, y, z int8, kind reflect.Kind) {
 		if z != x {
 			panic(fmt.Errorf("z must be == x for kind %s", kind))
 		}
-		x = int8(flattenIntegerKind(kind))
+		x = int16(flattenIntegerKind(kind))
 		op = runtime.OpSub
 	}
 	if k {
 		op = -op
 	}
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: x, B: y, C: z})
+	fb.appendInstruction(op, x, y, z)
 }
 
 // emitSubInv appends a new "SubInv" instruction to the function body.
 //
 //	z = y - x
-func (fb *functionBuilder) emitSubInv(k bool, x, y, z int8, kind reflect.Kind) {
+func (fb *functionBuilder) emitSubInv(k bool, x, y, z int16, kind reflect.Kind) {
 	var op runtime.Operation
 	switch kind {
 	case reflect.Int:
@@ -910,13 +926,13 @@ func (fb *functionBuilder) emitSubInv(k bool, x, y, z int8, kind reflect.Kind) {
 		if z != x {
 			panic(fmt.Errorf("z must be == x for kind %s", kind))
 		}
-		x = int8(flattenIntegerKind(kind))
+		x = int16(flattenIntegerKind(kind))
 		op = runtime.OpSubInv
 	}
 	if k {
 		op = -op
 	}
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: x, B: y, C: z})
+	fb.appendInstruction(op, x, y, z)
 }
 
 // emitText appends a new "Text" instruction to the function body.
@@ -957,35 +973,34 @@ func (fb *functionBuilder) emitText(txt []byte, inURL, isURLSet bool) {
 // emitTailCall appends a new "TailCall" instruction to the function body.
 //
 //	f()
-func (fb *functionBuilder) emitTailCall(f int8, pos *ast.Position) {
+func (fb *functionBuilder) emitTailCall(f int16, pos *ast.Position) {
 	fb.addPosAndPath(pos)
-	fn := fb.fn
-	fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.OpTailCall, A: f})
+	fb.appendInstruction(runtime.OpTailCall, f, 0, 0)
 }
 
 // emitTypify appends a new "Typify" instruction to the function body.
-func (fb *functionBuilder) emitTypify(k bool, typ reflect.Type, x, z int8) {
+func (fb *functionBuilder) emitTypify(k bool, typ reflect.Type, x, z int16) {
 	t := fb.addType(typ, true)
 	op := runtime.OpTypify
 	if k {
 		op = -op
 	}
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: int8(t), B: x, C: z})
+	fb.appendInstruction(op, int16(int8(t)), x, z)
 }
 
 // emitXor appends a new "Xor" instruction to the function body.
 //
 //	z = x ^ y
-func (fb *functionBuilder) emitXor(k bool, x, y, z int8, kind reflect.Kind) {
+func (fb *functionBuilder) emitXor(k bool, x, y, z int16, kind reflect.Kind) {
 	op := runtime.OpXor
 	if k {
 		op = -op
 	}
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: x, B: y, C: z})
+	fb.appendInstruction(op, x, y, z)
 }
 
 // emitZero appends a new "Zero" instruction to the function body.
-func (fb *functionBuilder) emitZero(kind reflect.Kind, dst, src int8) {
-	regType := int8(kindToType(kind))
-	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpZero, A: regType, B: src, C: dst})
+func (fb *functionBuilder) emitZero(kind reflect.Kind, dst, src int16) {
+	regType := int16(kindToType(kind))
+	fb.appendInstruction(runtime.OpZero, regType, src, dst)
 }
@@ -43,8 +43,10 @@ func typecheck(tree *ast.Tree, importer native.Importer, opts checkerOptions) (m
 			return nil, &CheckingError{path: tree.Path, pos: *pkg.Pos(), err: errors.New("package name must be main")}
 		}
 		compilation := newCompilation(nil)
+		compilation.maxErrors = opts.maxErrors
+		opts.analysis.setCompilation(compilation)
 		err := checkPackage(compilation, pkg, tree.Path, importer, opts, false)
-		if err != nil {
+		if err = compilation.checkingErrors(err); err != nil {
 			return nil, err
 		}
 		return compilation.pkgInfos, nil
@@ -61,6 +63,8 @@ func typecheck(tree *ast.Tree, importer native.Importer, opts checkerOptions) (m
 	}
 
 	compilation := newCompilation(globalScope)
+	compilation.maxErrors = opts.maxErrors
+	opts.analysis.setCompilation(compilation)
 	tc := newTypechecker(compilation, tree.Path, opts, importer)
 
 	// If tree extends another template file, transform it swapping the files
@@ -90,7 +94,10 @@ func typecheck(tree *ast.Tree, importer native.Importer, opts checkerOptions) (m
 	// Type check a template file.
 	var err error
 	tree.Nodes, err = tc.checkNodesInNewScopeError(tree, tree.Nodes)
-	if err != nil {
+	if err == nil {
+		err = compilation.checkInstanceBodies()
+	}
+	if err = compilation.checkingErrors(err); err != nil {
 		return nil, err
 	}
 	mainPkgInfo := &packageInfo{}
@@ -120,6 +127,12 @@ type checkerOptions struct {
 
 	// mdConverter converts a Markdown source code to HTML.
 	mdConverter Converter
+
+	// analysis, if not nil, collects the type infos and the definitions.
+	analysis *Analysis
+
+	// maxErrors is the maximum number of errors to report.
+	maxErrors int
 }
 
 // typechecker represents the state of the type checking.
@@ -228,6 +241,44 @@ func newTypechecker(compilation *compilation, path string, opts checkerOptions,
 	return &tc
 }
 
+// tryCheck calls check to type check node, a declaration or a statement,
+// and returns the error returned by check.
+//
+// If the errors are collected, and check panics or returns with a checking
+// error, tryCheck reports the error, restores the state of the type checker
+// and returns nil, so that the type checking can continue with the next
+// declaration or statement.
+func (tc *typechecker) tryCheck(node ast.Node, check func() error) (err error) {
+	if tc.compilation.maxErrors == 0 {
+		return check()
+	}
+	scopes := len(tc.scopes.s)
+	ancestors := len(tc.ancestors)
+	iota := tc.iota
+	withinUsingAffectedStmt := tc.withinUsingAffectedStmt
+	iteaName := tc.compilation.iteaName
+	defer func() {
+		if r := recover(); r != nil {
+			cerr, ok := r.(*CheckingError)
+			if !ok {
+				panic(r)
+			}
+			err = cerr
+		}
+		if cerr, ok := err.(*CheckingError); ok {
+			tc.scopes.s = tc.scopes.s[:scopes]
+			tc.ancestors = tc.ancestors[:ancestors]
+			tc.iota = iota
+			tc.withinUsingAffectedStmt = withinUsingAffectedStmt
+			tc.compilation.iteaName = iteaName
+			tc.terminating = false
+			tc.compilation.addError(node, cerr)
+			err = nil
+		}
+	}()
+	return check()
+}
+
 // assignScope assigns value to name in the current scope.
 //
 // decl is the identifier that declared the value, or nil if native.
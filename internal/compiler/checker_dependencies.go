@@ -115,7 +115,10 @@ func (d *deps) analyzeGlobalDeclarationAssignment(n *ast.Assignment) {
 
 // analyzeGlobalFunc analyzes a global function declaration.
 func (d *deps) analyzeGlobalFunc(n *ast.Func) {
-	scopes := depScopes{map[string]struct{}{}}
+	scopes := typeParamsScopes(n.TypeParams)
+	for _, p := range n.TypeParams {
+		d.addDepsToGlobal(n.Ident, p.Type, scopes)
+	}
 	for _, f := range n.Type.Parameters {
 		if f.Ident != nil {
 			scopes = declareLocally(scopes, f.Ident.Name)
@@ -134,7 +137,21 @@ func (d *deps) analyzeGlobalFunc(n *ast.Func) {
 
 // analyzeGlobalTypeDeclaration analyzes a global type declaration.
 func (d *deps) analyzeGlobalTypeDeclaration(td *ast.TypeDeclaration) {
-	d.addDepsToGlobal(td.Ident, td.Type, nil)
+	scopes := typeParamsScopes(td.TypeParams)
+	for _, p := range td.TypeParams {
+		d.addDepsToGlobal(td.Ident, p.Type, scopes)
+	}
+	d.addDepsToGlobal(td.Ident, td.Type, scopes)
+}
+
+// typeParamsScopes returns the scopes with the type parameters params
+// declared locally.
+func typeParamsScopes(params []*ast.Parameter) depScopes {
+	scopes := depScopes{map[string]struct{}{}}
+	for _, p := range params {
+		scopes = declareLocally(scopes, p.Ident.Name)
+	}
+	return scopes
 }
 
 // analyzeTree analyzes tree returning a data structure holding all dependencies
@@ -151,7 +168,9 @@ func analyzeTree(pkg *ast.Package) packageDeclsDeps {
 		case *ast.Const:
 			d.analyzeGlobalConst(n)
 		case *ast.Func:
-			d.analyzeGlobalFunc(n)
+			if n.Recv == nil {
+				d.analyzeGlobalFunc(n)
+			}
 		case *ast.TypeDeclaration:
 			d.analyzeGlobalTypeDeclaration(n)
 		}
@@ -375,8 +394,18 @@ func (d *deps) nodeDeps(n ast.Node, scopes depScopes) []*ast.Identifier {
 	case *ast.Index:
 		deps := d.nodeDeps(n.Expr, scopes)
 		return append(deps, d.nodeDeps(n.Index, scopes)...)
+	case *ast.IndexList:
+		deps := d.nodeDeps(n.Expr, scopes)
+		for _, index := range n.Indices {
+			deps = append(deps, d.nodeDeps(index, scopes)...)
+		}
+		return deps
 	case *ast.Interface:
-		return nil
+		deps := []*ast.Identifier{}
+		for _, m := range n.Methods {
+			deps = append(deps, d.nodeDeps(m.Type, scopes)...)
+		}
+		return deps
 	case *ast.Label:
 		return nil
 	case *ast.MapType:
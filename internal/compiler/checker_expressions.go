@@ -15,6 +15,7 @@ import (
 
 	"github.com/open2b/scriggo/ast"
 	"github.com/open2b/scriggo/internal/compiler/types"
+	"github.com/open2b/scriggo/internal/runtime"
 )
 
 var untypedBoolTypeInfo = &typeInfo{Type: boolType, Properties: propertyUntyped}
@@ -71,6 +72,8 @@ func (tc *typechecker) checkIdentifier(ident *ast.Identifier, used bool) *typeIn
 		panic(tc.errorf(ident, "use of builtin %s not in function call", ident.Name))
 	}
 
+	tc.compilation.addDefinition(ident, decl)
+
 	// Check if it is an upvar.
 	isUpVar := ti.Addressable() && tc.scopes.Function(ident.Name) != tc.scopes.CurrentFunction()
 
@@ -108,7 +111,7 @@ func (tc *typechecker) checkIdentifier(ident *ast.Identifier, used bool) *typeIn
 				if nestedFuncs := tc.scopes.Functions(); len(nestedFuncs) > 0 {
 					upvar := ast.Upvar{
 						NativeName:      ident.Name,
-						NativePkg:       ident.Name,
+						NativePkg:       ti.NativePackageName,
 						NativeValue:     rv,
 						NativeValueType: ti.Type,
 					}
@@ -185,6 +188,9 @@ func (tc *typechecker) checkExpr(expr ast.Expression) *typeInfo {
 	if ti.IsType() {
 		panic(tc.errorf(expr, "type %s is not an expression", ti))
 	}
+	if ti.IsGeneric() {
+		panic(tc.errorf(expr, "cannot use generic function %s without instantiation", expr))
+	}
 	tc.compilation.typeInfos[expr] = ti
 	return ti
 }
@@ -216,11 +222,10 @@ func subExpr(expr ast.Expression, left bool) ast.Expression {
 
 // checkType type checks a type and returns its type info.
 func (tc *typechecker) checkType(expr ast.Expression) *typeInfo {
-	ti := tc.typeof(expr, true)
-	if !ti.IsType() {
-		panic(tc.errorf(expr, "%s is not a type", expr))
+	ti := tc.checkTypeOrConstraint(expr)
+	if ti.constraint != nil {
+		panic(tc.errorf(expr, "cannot use type %s outside a type constraint: %s", expr, ti.constraint.reason()))
 	}
-	tc.compilation.typeInfos[expr] = ti
 	return ti
 }
 
@@ -228,6 +233,15 @@ func (tc *typechecker) checkType(expr ast.Expression) *typeInfo {
 // info.
 func (tc *typechecker) checkExprOrType(expr ast.Expression) *typeInfo {
 	ti := tc.typeof(expr, false)
+	if ti.IsGeneric() {
+		if ti.value.(*generic).typ != nil {
+			panic(tc.errorf(expr, "cannot use generic type %s without instantiation", expr))
+		}
+		panic(tc.errorf(expr, "cannot use generic function %s without instantiation", expr))
+	}
+	if ti.constraint != nil {
+		panic(tc.errorf(expr, "cannot use type %s outside a type constraint: %s", expr, ti.constraint.reason()))
+	}
 	tc.compilation.typeInfos[expr] = ti
 	return ti
 }
@@ -276,6 +290,9 @@ func (tc *typechecker) typeof(expr ast.Expression, typeExpected bool) *typeInfo
 		}
 
 	case *ast.UnaryOperator:
+		if expr.Op == ast.OperatorTilde {
+			panic(tc.errorf(expr, "cannot use ~ outside of interface or type constraint"))
+		}
 		t := tc.checkExprOrType(expr.Expr)
 		if t.IsType() {
 			if expr.Op == ast.OperatorPointer {
@@ -532,7 +549,11 @@ func (tc *typechecker) typeof(expr ast.Expression, typeExpected bool) *typeInfo
 		panic(tc.errorf(expr, "cannot use default expression in this context"))
 
 	case *ast.Interface:
-		return &typeInfo{Type: emptyInterfaceType, Properties: propertyIsType | propertyUniverse}
+		if len(expr.Methods) == 0 {
+			return &typeInfo{Type: emptyInterfaceType, Properties: propertyIsType | propertyUniverse}
+		}
+		t, c := tc.checkInterfaceType(expr)
+		return &typeInfo{Type: t, Properties: propertyIsType, constraint: c}
 
 	case *ast.FuncType:
 		tc.checkDuplicateParams(expr)
@@ -605,6 +626,9 @@ func (tc *typechecker) typeof(expr ast.Expression, typeExpected bool) *typeInfo
 		return tis[0]
 
 	case *ast.Index:
+		if g := tc.genericOf(expr.Expr); g != nil {
+			return tc.checkInstantiation(g, expr.Expr, []ast.Expression{expr.Index}, expr)
+		}
 		t := tc.checkExpr(expr.Expr)
 		if t.Nil() {
 			panic(tc.errorf(expr, "use of untyped nil"))
@@ -655,6 +679,15 @@ func (tc *typechecker) typeof(expr ast.Expression, typeExpected bool) *typeInfo
 			panic(tc.errorf(expr, "invalid operation: %s (type %s does not support indexing)", expr, t.ShortString()))
 		}
 
+	case *ast.IndexList:
+		if g := tc.genericOf(expr.Expr); g != nil {
+			return tc.checkInstantiation(g, expr.Expr, expr.Indices, expr)
+		}
+		if t := tc.checkExprOrType(expr.Expr); t.IsType() {
+			panic(tc.errorf(expr.Expr, "%s is not a generic type", expr.Expr))
+		}
+		panic(tc.errorf(expr, "invalid operation: more than one index"))
+
 	case *ast.Render:
 		return tc.checkRender(expr)
 
@@ -740,12 +773,18 @@ func (tc *typechecker) typeof(expr ast.Expression, typeExpected bool) *typeInfo
 		}
 		if t.IsType() {
 			// Method expression.
+			if me, ok := tc.checkScriggoMethodExpression(t, expr); ok {
+				return me
+			}
 			return tc.checkMethodExpression(t, expr)
 		}
 		if expr.Ident == "_" {
 			panic(tc.errorf(expr, "cannot refer to blank field or method"))
 		}
 		// Method value.
+		if mv, ok := tc.checkScriggoMethodValue(t, expr); ok {
+			return mv
+		}
 		if mv, ok := tc.checkMethodValue(t, expr); ok {
 			return mv
 		}
@@ -1598,13 +1637,18 @@ func (tc *typechecker) checkCallExpression(expr *ast.Call) []*typeInfo {
 		}
 	}
 
-	t := tc.checkExprOrType(expr.Func)
+	t := tc.checkGenericCall(expr)
+	if t == nil {
+		t = tc.checkExprOrType(expr.Func)
+	}
 
 	switch t.MethodType {
 	case methodValueConcrete:
 		t.MethodType = methodCallConcrete
 	case methodValueInterface:
 		t.MethodType = methodCallInterface
+	case methodValueScriggo:
+		t.MethodType = methodCallScriggo
 	}
 
 	if t.Nil() {
@@ -2415,10 +2459,12 @@ func (tc *typechecker) checkPackageSelector(expr *ast.Selector) (*typeInfo, bool
 	if !ok {
 		return nil, false
 	}
-	pkg, _, ok := tc.scopes.Lookup(ident.Name)
+	pkg, decl, ok := tc.scopes.Lookup(ident.Name)
 	if !ok || !pkg.IsPackage() {
 		return nil, false
 	}
+	tc.compilation.addDefinition(ident, decl)
+	tc.compilation.addDefinition(expr, decl)
 	if !isExported(expr.Ident) {
 		panic(tc.errorf(expr, "cannot refer to unexported name %s", expr))
 	}
@@ -2455,6 +2501,53 @@ func (tc *typechecker) checkPackageSelector(expr *ast.Selector) (*typeInfo, bool
 	return ti, true
 }
 
+// checkInterfaceType checks the non-empty interface type expr and returns
+// its type and, if the interface has a type set, its type constraint.
+func (tc *typechecker) checkInterfaceType(expr *ast.Interface) (reflect.Type, *typeConstraint) {
+	var methods []reflect.Method
+	var constraint *typeConstraint
+	indexOf := map[string]int{}
+	for _, field := range expr.Methods {
+		if field.Idents == nil {
+			// Embedded interface or type set.
+			t, c := tc.checkConstraint(field.Type)
+			if c != nil {
+				if constraint == nil {
+					constraint = &typeConstraint{}
+				}
+				constraint.comparable = constraint.comparable || c.comparable
+				constraint.unions = append(constraint.unions, c.unions...)
+			}
+			for i := 0; i < t.NumMethod(); i++ {
+				m := t.Method(i)
+				if j, ok := indexOf[m.Name]; ok {
+					if methods[j].Type != m.Type {
+						panic(tc.errorf(field.Type, "duplicate method %s", m.Name))
+					}
+					continue
+				}
+				indexOf[m.Name] = len(methods)
+				methods = append(methods, reflect.Method{Name: m.Name, PkgPath: m.PkgPath, Type: m.Type})
+			}
+			continue
+		}
+		t := tc.checkType(field.Type).Type
+		name := field.Idents[0]
+		if isBlankIdentifier(name) {
+			panic(tc.errorf(name, "methods must have a unique non-blank name"))
+		}
+		if _, ok := indexOf[name.Name]; ok {
+			panic(tc.errorf(name, "duplicate method %s", name.Name))
+		}
+		indexOf[name.Name] = len(methods)
+		methods = append(methods, reflect.Method{Name: name.Name, Type: t})
+	}
+	if methods == nil {
+		return emptyInterfaceType, constraint
+	}
+	return tc.types.InterfaceOf(methods), constraint
+}
+
 // checkMethodExpression checks a method expression.
 func (tc *typechecker) checkMethodExpression(t *typeInfo, expr *ast.Selector) *typeInfo {
 
@@ -2476,6 +2569,9 @@ func (tc *typechecker) checkMethodExpression(t *typeInfo, expr *ast.Selector) *t
 	ti := &typeInfo{Properties: propertyIsNative | propertyHasValue}
 
 	if t.Type.Kind() == reflect.Interface {
+		if _, ok := t.Type.(runtime.ScriggoType); ok {
+			panic(tc.errorf(expr, "method expression %s on interface type defined in Scriggo is not supported in this release of Scriggo", expr))
+		}
 		if !isExported(name) {
 			panic(tc.errorf(expr, "%s undefined (cannot refer to unexported field or method %s)", expr, name))
 		}
@@ -2535,7 +2631,7 @@ func (tc *typechecker) checkMethodValue(t *typeInfo, expr *ast.Selector) (*typeI
 	}
 
 	if kind == reflect.Interface {
-		if !isExported(name) {
+		if _, ok := typ.(runtime.ScriggoType); !ok && !isExported(name) {
 			panic(tc.errorf(expr, "%s undefined (cannot refer to unexported field or method %s)", expr, name))
 		}
 		return &typeInfo{
@@ -2554,6 +2650,163 @@ func (tc *typechecker) checkMethodValue(t *typeInfo, expr *ast.Selector) (*typeI
 	}, true
 }
 
+// checkScriggoMethodExpression checks a method expression of a method
+// declared in Scriggo. If the type has the method, it returns the type info
+// and true, otherwise returns nil and false.
+func (tc *typechecker) checkScriggoMethodExpression(t *typeInfo, expr *ast.Selector) (*typeInfo, bool) {
+	typ := t.Type
+	m, ok := types.MethodByName(typ, expr.Ident)
+	if !ok {
+		if typ.Kind() != reflect.Ptr {
+			if _, ok := types.MethodByName(tc.types.PtrTo(typ), expr.Ident); ok {
+				panic(tc.errorf(expr, "invalid method expression %s (needs pointer receiver: (*%s).%s)",
+					expr, expr.Expr, expr.Ident))
+			}
+		}
+		return nil, false
+	}
+	if !m.Ptr && typ.Kind() == reflect.Ptr {
+		panic(tc.errorf(expr, "method expression (%s).%s with value receiver is not supported in this release of Scriggo",
+			expr.Expr, expr.Ident))
+	}
+	mt := m.Type
+	in := make([]reflect.Type, mt.NumIn()+1)
+	in[0] = typ
+	for i := 0; i < mt.NumIn(); i++ {
+		in[i+1] = mt.In(i)
+	}
+	out := make([]reflect.Type, mt.NumOut())
+	for i := 0; i < mt.NumOut(); i++ {
+		out[i] = mt.Out(i)
+	}
+	return &typeInfo{
+		Type:       tc.types.FuncOf(in, out, mt.IsVariadic()),
+		value:      m,
+		MethodType: methodExprScriggo,
+	}, true
+}
+
+// checkScriggoMethodValue checks a method value of a method declared in
+// Scriggo. If the type has the method, it returns the type info and true,
+// otherwise returns nil and false.
+//
+// If the method has a pointer receiver and the receiver is not a pointer,
+// t.M is transformed into (&t).M. If the method has a value receiver and the
+// receiver is a pointer, t.M is transformed into (*t).M.
+func (tc *typechecker) checkScriggoMethodValue(t *typeInfo, expr *ast.Selector) (*typeInfo, bool) {
+	typ := t.Type
+	isPtr := typ.Kind() == reflect.Ptr
+	m, ok := types.MethodByName(typ, expr.Ident)
+	if !ok && !isPtr {
+		m, ok = types.MethodByName(tc.types.PtrTo(typ), expr.Ident)
+	}
+	if !ok && isPtr && typ.Elem().Kind() == reflect.Ptr {
+		if _, ok := types.MethodByName(typ.Elem(), expr.Ident); ok {
+			panic(tc.errorf(expr, "calling method %s with receiver %s (type %s) requires explicit dereference",
+				expr.Ident, expr.Expr, typ))
+		}
+	}
+	if !ok {
+		// Look for a method promoted from an embedded field.
+		path := tc.promotedMethodPath(typ, expr)
+		if path == nil {
+			return nil, false
+		}
+		for _, name := range path {
+			expr.Expr = ast.NewSelector(expr.Pos(), expr.Expr, name)
+		}
+		return tc.checkScriggoMethodValue(tc.checkExpr(expr.Expr), expr)
+	}
+	t.setValue(nil)
+	switch {
+	case m.Ptr && !isPtr:
+		if !t.Addressable() {
+			panic(tc.errorf(expr, "cannot call pointer method on %s", expr.Expr))
+		}
+		if ident, ok := expr.Expr.(*ast.Identifier); ok {
+			if _, decl, ok := tc.scopes.LookupInFunc(ident.Name); ok {
+				tc.compilation.indirectVars[decl] = true
+			}
+		}
+		expr.Expr = ast.NewUnaryOperator(expr.Pos(), ast.OperatorAddress, expr.Expr)
+		tc.compilation.typeInfos[expr.Expr] = &typeInfo{Type: tc.types.PtrTo(typ)}
+	case !m.Ptr && isPtr:
+		expr.Expr = ast.NewUnaryOperator(expr.Pos(), ast.OperatorPointer, expr.Expr)
+		tc.compilation.typeInfos[expr.Expr] = &typeInfo{Type: typ.Elem(), Properties: propertyAddressable}
+	}
+	return &typeInfo{
+		Type:       m.Type,
+		value:      m,
+		MethodType: methodValueScriggo,
+	}, true
+}
+
+// promotedMethodPath returns the names of the embedded fields to select,
+// starting from a value of type t, to reach the value on which the method
+// declared in Scriggo with the given name is promoted. If there is no such
+// method at the shallowest depth, or if it is hidden by a field or a native
+// method, it returns nil. It panics if the selector is ambiguous.
+func (tc *typechecker) promotedMethodPath(t reflect.Type, expr *ast.Selector) []string {
+	name := expr.Ident
+	type embedded struct {
+		typ  reflect.Type
+		path []string
+	}
+	visited := map[reflect.Type]bool{}
+	current := []embedded{{typ: t}}
+	for depth := 0; len(current) > 0; depth++ {
+		var next []embedded
+		var found []string
+		n := 0
+		for _, e := range current {
+			typ := e.typ
+			if depth > 0 {
+				_, ok := types.MethodByName(typ, name)
+				if !ok && typ.Kind() != reflect.Ptr {
+					_, ok = types.MethodByName(tc.types.PtrTo(typ), name)
+				}
+				if ok {
+					found = e.path
+					n++
+				} else if _, ok := typ.MethodByName(name); ok {
+					n++
+				}
+			}
+			if typ.Kind() == reflect.Ptr {
+				typ = typ.Elem()
+			}
+			if typ.Kind() != reflect.Struct || visited[typ] {
+				continue
+			}
+			visited[typ] = true
+			for i := 0; i < typ.NumField(); i++ {
+				f := typ.Field(i)
+				fieldName := decodeFieldName(f.Name)
+				if fieldName == name {
+					n++
+				}
+				if f.Anonymous {
+					path := make([]string, len(e.path)+1)
+					copy(path, e.path)
+					path[len(e.path)] = fieldName
+					next = append(next, embedded{typ: f.Type, path: path})
+				}
+			}
+		}
+		if n > 0 {
+			if found == nil {
+				return nil
+			}
+			if n > 1 {
+				panic(tc.errorf(expr, "ambiguous selector %s", expr))
+			}
+			return found
+		}
+		current = next
+	}
+	return nil
+}
+
 // checkKeySelector checks a key selector.
 func (tc *typechecker) checkKeySelector(t *typeInfo, expr *ast.Selector) (*typeInfo, bool) {
 
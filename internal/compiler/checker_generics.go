@@ -0,0 +1,881 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/ast/astutil"
+	"github.com/open2b/scriggo/internal/compiler/types"
+)
+
+// Generic functions and types are implemented by instantiation. A generic
+// declaration is neither type checked nor emitted; instead, for every list of
+// type arguments it is instantiated with, the declaration is cloned, its type
+// parameters are bound to the type arguments and the clone is type checked as
+// a non-generic declaration. The clones of functions and methods are added to
+// the declarations of the package, so they are emitted as any other function.
+
+// generic represents a generic function or type declared in Scriggo.
+type generic struct {
+	tc        *typechecker         // type checker of the declaring package.
+	pkg       *ast.Package         // declaring package.
+	fn        *ast.Func            // function declaration; nil for types.
+	typ       *ast.TypeDeclaration // type declaration; nil for functions.
+	params    []*ast.Parameter     // type parameters with their constraints.
+	methods   []*ast.Func          // methods of a generic type.
+	ready     bool                 // methods can be declared on the instances.
+	failed    bool                 // type checking of an instance failed.
+	instances []*instance
+}
+
+// instance represents an instance of a generic function or type.
+type instance struct {
+	generic *generic
+	args    []reflect.Type // type arguments.
+	name    string         // name, as "Map[int,string]".
+	typ     reflect.Type   // type; nil if the instantiation is in progress.
+}
+
+// instanceBody is the body of a function or method of an instance, that is
+// type checked after the declarations of the package.
+type instanceBody struct {
+	generic *generic
+	params  []*ast.Identifier // type parameters.
+	args    []reflect.Type    // type arguments.
+	fn      *ast.Func
+}
+
+// typeConstraint represents the type set of an interface used as type
+// constraint, if it is not the set of all types.
+type typeConstraint struct {
+	comparable bool        // only comparable types.
+	unions     []typeUnion // the type must be in every union.
+}
+
+// typeUnion is a union of type terms, as "~int | string".
+type typeUnion []typeTerm
+
+// typeTerm is a term of a union.
+type typeTerm struct {
+	tilde bool
+	typ   reflect.Type
+}
+
+// includes reports whether the union u includes the type t.
+func (u typeUnion) includes(t reflect.Type) bool {
+	for _, term := range u {
+		if t == term.typ || term.tilde && types.IdenticalUnderlying(t, term.typ) {
+			return true
+		}
+	}
+	return false
+}
+
+func (u typeUnion) String() string {
+	var b strings.Builder
+	for i, term := range u {
+		if i > 0 {
+			b.WriteString(" | ")
+		}
+		if term.tilde {
+			b.WriteByte('~')
+		}
+		b.WriteString(term.typ.String())
+	}
+	return b.String()
+}
+
+// reason returns the reason why a type with the constraint c cannot be used
+// outside a type constraint.
+func (c *typeConstraint) reason() string {
+	if c.unions != nil {
+		return "interface contains type constraints"
+	}
+	return "interface is (or embeds) comparable"
+}
+
+// isGenericDeclaration reports whether f is the declaration of a generic
+// function or of a method of a generic type.
+func isGenericDeclaration(f *ast.Func) bool {
+	if f.TypeParams != nil {
+		return true
+	}
+	if f.Recv == nil {
+		return false
+	}
+	typ := f.Recv.Type
+	if op, ok := typ.(*ast.UnaryOperator); ok && op.Op == ast.OperatorPointer {
+		typ = op.Expr
+	}
+	switch typ.(type) {
+	case *ast.Index, *ast.IndexList:
+		return true
+	}
+	return false
+}
+
+// receiverTypeParams returns the base type and the type parameters of the
+// receiver type typ of a method of a generic type.
+func receiverTypeParams(typ ast.Expression) (ast.Expression, []ast.Expression) {
+	if op, ok := typ.(*ast.UnaryOperator); ok && op.Op == ast.OperatorPointer {
+		typ = op.Expr
+	}
+	switch typ := typ.(type) {
+	case *ast.Index:
+		return typ.Expr, []ast.Expression{typ.Index}
+	case *ast.IndexList:
+		return typ.Expr, typ.Indices
+	}
+	return typ, nil
+}
+
+// newGeneric returns a new generic, declared in the package pkg, with the
+// type parameters params.
+func (tc *typechecker) newGeneric(pkg *ast.Package, params []*ast.Parameter) *generic {
+	g := &generic{tc: tc, pkg: pkg, params: make([]*ast.Parameter, len(params))}
+	var constraint ast.Expression
+	for i := len(params) - 1; i >= 0; i-- {
+		if params[i].Type != nil {
+			constraint = params[i].Type
+		}
+		g.params[i] = ast.NewParameter(params[i].Ident, constraint)
+	}
+	for i, p := range g.params {
+		for _, q := range g.params[:i] {
+			if p.Ident.Name == q.Ident.Name && !isBlankIdentifier(p.Ident) {
+				panic(tc.errorf(p.Ident, "%s redeclared in this block", p.Ident.Name))
+			}
+		}
+	}
+	return g
+}
+
+// name returns the name of g.
+func (g *generic) name() string {
+	if g.fn != nil {
+		return g.fn.Ident.Name
+	}
+	return g.typ.Ident.Name
+}
+
+// paramIndex returns the index of the type parameter with the given name, or
+// -1 if there is no such parameter.
+func (g *generic) paramIndex(name string) int {
+	for i, p := range g.params {
+		if p.Ident.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// paramIdents returns the identifiers of the type parameters of g.
+func (g *generic) paramIdents() []*ast.Identifier {
+	idents := make([]*ast.Identifier, len(g.params))
+	for i, p := range g.params {
+		idents[i] = p.Ident
+	}
+	return idents
+}
+
+// typechecker returns a type checker for an instance of g, in which the type
+// parameters params are bound to the type arguments args.
+func (g *generic) typechecker(params []*ast.Identifier, args []reflect.Type) *typechecker {
+	tc := newTypechecker(g.tc.compilation, g.tc.path, g.tc.opts, g.tc.importer)
+	tc.types = g.tc.types
+	tc.structDeclPkg = g.tc.structDeclPkg
+	pkgNames := g.tc.scopes.s[3].names
+	names := make(map[string]scopeName, len(pkgNames)+len(params))
+	for name, n := range pkgNames {
+		names[name] = n
+	}
+	for i, param := range params {
+		names[param.Name] = scopeName{ti: &typeInfo{Type: args[i], Properties: propertyIsType}, decl: param}
+	}
+	tc.scopes.s[3].names = names
+	return tc
+}
+
+// declareGenericFunc declares the generic function f of the package pkg.
+func (tc *typechecker) declareGenericFunc(pkg *ast.Package, f *ast.Func) {
+	if name := f.Ident.Name; name == "init" || name == "main" {
+		panic(tc.errorf(f.Ident, "func %s must have no type parameters", name))
+	}
+	g := tc.newGeneric(pkg, f.TypeParams)
+	g.fn = f
+	tc.useImports(f)
+	if isBlankIdentifier(f.Ident) {
+		return
+	}
+	if _, ok := tc.scopes.FilePackage(f.Ident.Name); ok {
+		panic(tc.errorf(f.Ident, "%s redeclared in this block", f.Ident.Name))
+	}
+	tc.scopes.Declare(f.Ident.Name, &typeInfo{value: g}, f.Ident, nil)
+}
+
+// declareGenericType declares the generic type td of the package pkg.
+func (tc *typechecker) declareGenericType(pkg *ast.Package, td *ast.TypeDeclaration) *generic {
+	g := tc.newGeneric(pkg, td.TypeParams)
+	g.typ = td
+	tc.useImports(td)
+	if !isBlankIdentifier(td.Ident) {
+		tc.assignScope(td.Ident.Name, &typeInfo{value: g}, td.Ident, nil)
+	}
+	return g
+}
+
+// addGenericMethod adds the method f, declared on a generic type, to the
+// methods of its type. generics contains the generic types of the package.
+func (tc *typechecker) addGenericMethod(f *ast.Func, generics map[string]*generic) {
+	base, params := receiverTypeParams(f.Recv.Type)
+	var g *generic
+	if ident, ok := base.(*ast.Identifier); ok {
+		g = generics[ident.Name]
+	}
+	if g == nil {
+		panic(tc.errorf(base, "%s is not a generic type", base))
+	}
+	if len(params) != len(g.params) {
+		panic(tc.errorf(f.Recv.Type, "got %d type parameters, but receiver base type declares %d", len(params), len(g.params)))
+	}
+	for _, param := range params {
+		if _, ok := param.(*ast.Identifier); !ok {
+			panic(tc.errorf(param, "receiver type parameter %s must be an identifier", param))
+		}
+	}
+	tc.useImports(f)
+	g.methods = append(g.methods, f)
+}
+
+// useImports marks as used the imported packages and names referred in the
+// generic declaration node, as its body is not type checked until it is
+// instantiated.
+func (tc *typechecker) useImports(node ast.Node) {
+	u := importsUser{tc.scopes}
+	var params []*ast.Parameter
+	switch n := node.(type) {
+	case *ast.Func:
+		params = n.TypeParams
+	case *ast.TypeDeclaration:
+		params = n.TypeParams
+		node = n.Type
+	}
+	for _, p := range params {
+		astutil.Walk(u, p.Type)
+	}
+	astutil.Walk(u, node)
+}
+
+// importsUser is an astutil.Visitor that marks as used the imported packages
+// and names referred in the visited nodes.
+type importsUser struct {
+	scopes *scopes
+}
+
+// Visit implements the astutil.Visitor interface.
+func (u importsUser) Visit(node ast.Node) astutil.Visitor {
+	switch n := node.(type) {
+	case nil:
+		return nil
+	case *ast.Identifier:
+		if _, ok := u.scopes.LookupImport(n.Name); ok {
+			u.scopes.Use(n.Name)
+		}
+	case *ast.Call:
+		// Walk does not visit the called function.
+		astutil.Walk(u, n.Func)
+	case *ast.Func:
+		// Walk does not visit the receiver and the type of a function.
+		if n.Recv != nil {
+			astutil.Walk(u, n.Recv.Type)
+		}
+		astutil.Walk(u, n.Type)
+	case *ast.TypeAssertion:
+		if n.Type != nil {
+			astutil.Walk(u, n.Type)
+		}
+	}
+	return u
+}
+
+// genericOf returns the generic function or type referred by expr, that can
+// be an identifier or a package selector. If expr does not refer to a generic,
+// it returns nil.
+func (tc *typechecker) genericOf(expr ast.Expression) *generic {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		ti, _, ok := tc.scopes.Lookup(expr.Name)
+		if !ok {
+			return nil
+		}
+		if g, ok := ti.value.(*generic); ok {
+			tc.checkIdentifier(expr, true)
+			return g
+		}
+	case *ast.Selector:
+		ident, ok := expr.Expr.(*ast.Identifier)
+		if !ok {
+			return nil
+		}
+		pkg, _, ok := tc.scopes.Lookup(ident.Name)
+		if !ok || !pkg.IsPackage() {
+			return nil
+		}
+		ti, ok := pkg.value.(*packageInfo).Declarations[expr.Ident]
+		if !ok {
+			return nil
+		}
+		if g, ok := ti.value.(*generic); ok {
+			tc.checkPackageSelector(expr)
+			return g
+		}
+	}
+	return nil
+}
+
+// checkTypeArgs checks the type arguments exprs of the generic g and returns
+// their types. node is the instantiation. If partial is true, there can be
+// fewer type arguments than type parameters.
+func (tc *typechecker) checkTypeArgs(g *generic, exprs []ast.Expression, node ast.Node, partial bool) []reflect.Type {
+	if n := len(g.params); len(exprs) > n || len(exprs) < n && (g.typ != nil || !partial) {
+		if len(exprs) < n && g.fn != nil {
+			panic(tc.errorf(node, "cannot infer %s", g.params[len(exprs)].Ident))
+		}
+		panic(tc.errorf(node, "got %d type arguments but %s has %d type parameters", len(exprs), g.name(), n))
+	}
+	args := make([]reflect.Type, len(exprs))
+	for i, expr := range exprs {
+		args[i] = tc.checkType(expr).Type
+	}
+	return args
+}
+
+// checkInstantiation checks the instantiation expr of the generic g, referred
+// by base, with the type arguments exprs, and returns its type info.
+func (tc *typechecker) checkInstantiation(g *generic, base ast.Expression, exprs []ast.Expression, expr ast.Expression) *typeInfo {
+	args := tc.checkTypeArgs(g, exprs, expr, false)
+	inst := tc.instantiate(g, args, expr)
+	if g.typ != nil {
+		return &typeInfo{Type: inst.typ, Properties: propertyIsType}
+	}
+	return tc.instanceFunc(inst, base)
+}
+
+// instanceFunc returns the type info of the function of the instance inst,
+// where the generic function is referred by base. The type info has, as
+// replacement, the expression that refers to the function of the instance.
+func (tc *typechecker) instanceFunc(inst *instance, base ast.Expression) *typeInfo {
+	var r ast.Expression
+	if sel, ok := base.(*ast.Selector); ok {
+		r = ast.NewSelector(sel.Pos(), sel.Expr, inst.name)
+	} else {
+		r = ast.NewIdentifier(base.Pos(), inst.name)
+	}
+	tc.compilation.typeInfos[r] = &typeInfo{Type: inst.typ}
+	return &typeInfo{Type: inst.typ, replacement: r}
+}
+
+// checkGenericCall checks the call expr if it calls a generic function,
+// inferring the type arguments that are not explicitly given, and replaces
+// the called function with the function of the instance. It returns the type
+// info of the called function or nil if the called function is not generic.
+func (tc *typechecker) checkGenericCall(expr *ast.Call) *typeInfo {
+	base := expr.Func
+	var exprs []ast.Expression
+	switch f := expr.Func.(type) {
+	case *ast.Index:
+		base, exprs = f.Expr, []ast.Expression{f.Index}
+	case *ast.IndexList:
+		base, exprs = f.Expr, f.Indices
+	}
+	g := tc.genericOf(base)
+	if g == nil || g.fn == nil {
+		return nil
+	}
+	args := tc.checkTypeArgs(g, exprs, expr.Func, true)
+	if len(args) < len(g.params) {
+		args = tc.inferTypeArgs(g, expr, args)
+	}
+	inst := tc.instantiate(g, args, expr.Func)
+	ti := tc.instanceFunc(inst, base)
+	expr.Func = ti.replacement.(ast.Expression)
+	return tc.compilation.typeInfos[expr.Func]
+}
+
+// instantiate returns the instance of g with the type arguments args,
+// instantiating g if it has not already been instantiated with args. node is
+// the instantiation.
+func (tc *typechecker) instantiate(g *generic, args []reflect.Type, node ast.Node) *instance {
+
+	for _, inst := range g.instances {
+		if equalTypes(inst.args, args) {
+			if inst.typ == nil {
+				panic(tc.errorf(node, "invalid recursive type %s", inst.name))
+			}
+			return inst
+		}
+	}
+
+	// Check that the type arguments satisfy the constraints.
+	params := g.paramIdents()
+	itc := g.typechecker(params, args)
+	for i, p := range g.params {
+		if err := itc.satisfies(args[i], astutil.CloneExpression(p.Type)); err != nil {
+			panic(tc.errorf(node, "%s", err))
+		}
+	}
+
+	inst := &instance{generic: g, args: args, name: instanceName(g, args)}
+	g.instances = append(g.instances, inst)
+	defer func() {
+		if inst.typ == nil {
+			for i, in := range g.instances {
+				if in == inst {
+					g.instances = append(g.instances[:i], g.instances[i+1:]...)
+					break
+				}
+			}
+		}
+	}()
+
+	if g.typ != nil {
+		typ := itc.checkType(astutil.CloneExpression(g.typ.Type)).Type
+		defType := itc.types.DefinedOf(inst.name, typ)
+		if defType.Kind() == reflect.Struct {
+			itc.structDeclPkg[defType] = itc.path
+		}
+		inst.typ = defType
+		tc.compilation.instances[defType] = inst
+		if g.ready {
+			g.declareMethods(inst)
+		}
+		return inst
+	}
+
+	fn := astutil.CloneNode(g.fn).(*ast.Func)
+	fn.Ident = ast.NewIdentifier(fn.Ident.Pos(), inst.name)
+	fn.TypeParams = nil
+	inst.typ = itc.checkType(fn.Type).Type
+	g.pkg.Declarations = append(g.pkg.Declarations, fn)
+	tc.compilation.instanceBodies = append(tc.compilation.instanceBodies, instanceBody{g, params, args, fn})
+
+	return inst
+}
+
+// declareMethods declares the methods of the generic type g on its instance
+// inst.
+func (g *generic) declareMethods(inst *instance) {
+	for _, m := range g.methods {
+		fn := astutil.CloneNode(m).(*ast.Func)
+		base, exprs := receiverTypeParams(fn.Recv.Type)
+		params := make([]*ast.Identifier, len(exprs))
+		for i, expr := range exprs {
+			params[i] = expr.(*ast.Identifier)
+		}
+		// Replace the receiver base type with an identifier that refers to
+		// the type of the instance.
+		ident := ast.NewIdentifier(base.Pos(), inst.name)
+		g.tc.compilation.typeInfos[ident] = &typeInfo{Type: inst.typ, Properties: propertyIsType}
+		if op, ok := fn.Recv.Type.(*ast.UnaryOperator); ok && op.Op == ast.OperatorPointer {
+			op.Expr = ident
+		} else {
+			fn.Recv.Type = ident
+		}
+		tc := g.typechecker(params, inst.args)
+		tc.declareMethod(fn, map[reflect.Type]bool{inst.typ: true})
+		g.pkg.Declarations = append(g.pkg.Declarations, fn)
+		tc.compilation.instanceBodies = append(tc.compilation.instanceBodies, instanceBody{g, params, inst.args, fn})
+	}
+}
+
+// checkInstanceBodies type checks the bodies of the functions and methods of
+// the instances, including the instances created while checking them.
+func (compilation *compilation) checkInstanceBodies() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if cerr, ok := r.(*CheckingError); ok {
+				err = cerr
+				return
+			}
+			panic(r)
+		}
+	}()
+	for len(compilation.instanceBodies) > 0 {
+		body := compilation.instanceBodies[0]
+		compilation.instanceBodies = compilation.instanceBodies[1:]
+		if body.generic.failed {
+			continue
+		}
+		tc := body.generic.typechecker(body.params, body.args)
+		errors := len(compilation.errors)
+		_ = tc.tryCheck(body.fn, func() error {
+			tc.checkFunc(body.fn)
+			return nil
+		})
+		// Do not report the same errors for every instance.
+		if len(compilation.errors) > errors {
+			body.generic.failed = true
+		}
+	}
+	return nil
+}
+
+// instanceName returns the name of the instance of g with the type arguments
+// args.
+func instanceName(g *generic, args []reflect.Type) string {
+	var b strings.Builder
+	b.WriteString(g.name())
+	b.WriteByte('[')
+	for i, arg := range args {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(arg.String())
+	}
+	b.WriteByte(']')
+	name := b.String()
+	// Types with the same name, declared in different packages or scopes,
+	// have the same string representation.
+	for i := 2; ; i++ {
+		exists := false
+		for _, inst := range g.instances {
+			if inst.name == name {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			return name
+		}
+		name = fmt.Sprintf("%s[%d]", b.String(), i)
+	}
+}
+
+// equalTypes reports whether the types of x and y are equal.
+func equalTypes(x, y []reflect.Type) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// checkTypeOrConstraint type checks a type, that can also be an interface
+// used as type constraint, and returns its type info.
+func (tc *typechecker) checkTypeOrConstraint(expr ast.Expression) *typeInfo {
+	ti := tc.typeof(expr, true)
+	if ti.IsGeneric() {
+		panic(tc.errorf(expr, "cannot use generic type %s without instantiation", expr))
+	}
+	if !ti.IsType() {
+		panic(tc.errorf(expr, "%s is not a type", expr))
+	}
+	tc.compilation.typeInfos[expr] = ti
+	return ti
+}
+
+// checkConstraint checks the type constraint expr and returns the interface
+// type with its methods and, if it is not the set of all types, its type set.
+func (tc *typechecker) checkConstraint(expr ast.Expression) (reflect.Type, *typeConstraint) {
+	switch e := expr.(type) {
+	case *ast.BinaryOperator:
+		if e.Op == ast.OperatorBitOr {
+			return emptyInterfaceType, &typeConstraint{unions: []typeUnion{tc.checkUnion(expr)}}
+		}
+	case *ast.UnaryOperator:
+		if e.Op == ast.OperatorTilde {
+			return emptyInterfaceType, &typeConstraint{unions: []typeUnion{tc.checkUnion(expr)}}
+		}
+	}
+	ti := tc.checkTypeOrConstraint(expr)
+	if ti.Type.Kind() != reflect.Interface {
+		return emptyInterfaceType, &typeConstraint{unions: []typeUnion{{{typ: ti.Type}}}}
+	}
+	return ti.Type, ti.constraint
+}
+
+// checkUnion checks the union of type terms expr.
+func (tc *typechecker) checkUnion(expr ast.Expression) typeUnion {
+	if op, ok := expr.(*ast.BinaryOperator); ok && op.Op == ast.OperatorBitOr {
+		return append(tc.checkUnion(op.Expr1), tc.checkUnion(op.Expr2)...)
+	}
+	var term typeTerm
+	if op, ok := expr.(*ast.UnaryOperator); ok && op.Op == ast.OperatorTilde {
+		term.tilde = true
+		expr = op.Expr
+	}
+	ti := tc.checkTypeOrConstraint(expr)
+	if ti.Type.Kind() == reflect.Interface {
+		if ti.Type.NumMethod() > 0 {
+			panic(tc.errorf(expr, "cannot use %s in union (%s contains methods)", expr, expr))
+		}
+		if ti.constraint != nil {
+			panic(tc.errorf(expr, "cannot use %s in union (%s)", expr, ti.constraint.reason()))
+		}
+	}
+	term.typ = ti.Type
+	return typeUnion{term}
+}
+
+// satisfies returns an error if the type t does not satisfy the type
+// constraint expr.
+func (tc *typechecker) satisfies(t reflect.Type, expr ast.Expression) error {
+	iface, c := tc.checkConstraint(expr)
+	if iface.NumMethod() > 0 && !types.Implements(t, iface) {
+		return fmt.Errorf("%s does not satisfy %s (missing method %s)", t, expr, missingMethod(t, iface))
+	}
+	if c == nil {
+		return nil
+	}
+	if c.comparable && !t.Comparable() {
+		return fmt.Errorf("%s does not satisfy comparable", t)
+	}
+	for _, u := range c.unions {
+		if !u.includes(t) {
+			return fmt.Errorf("%s does not satisfy %s (%s missing in %s)", t, expr, t, u)
+		}
+	}
+	return nil
+}
+
+// missingMethod returns the name of a method of the interface type iface
+// that the type t does not have.
+func missingMethod(t, iface reflect.Type) string {
+	for i := 0; i < iface.NumMethod(); i++ {
+		name := iface.Method(i).Name
+		if _, _, ok := types.LookupMethod(t, name); ok {
+			continue
+		}
+		if _, ok := t.MethodByName(name); !ok {
+			return name
+		}
+	}
+	return iface.Method(0).Name
+}
+
+// inference holds the state of the inference of the type arguments of a call
+// to a generic function.
+type inference struct {
+	g    *generic
+	args []reflect.Type
+}
+
+// inferTypeArgs infers the type arguments of the generic function g, called
+// by expr, that are not in explicit, the explicit type arguments.
+func (tc *typechecker) inferTypeArgs(g *generic, expr *ast.Call, explicit []reflect.Type) []reflect.Type {
+
+	inf := &inference{g: g, args: make([]reflect.Type, len(g.params))}
+	copy(inf.args, explicit)
+	params := g.fn.Type.Parameters
+
+	// Unify the types of the parameters with the types of the typed
+	// arguments.
+	var untyped []int
+	for i, arg := range expr.Args {
+		p := i
+		variadic := g.fn.Type.IsVariadic && i >= len(params)-1
+		if variadic {
+			p = len(params) - 1
+		} else if i >= len(params) {
+			break
+		}
+		ti := tc.checkExpr(arg)
+		if ti.Nil() {
+			continue
+		}
+		if ti.Untyped() {
+			untyped = append(untyped, i)
+			continue
+		}
+		typ := ti.Type
+		if variadic && expr.IsVariadic {
+			if typ.Kind() != reflect.Slice {
+				continue
+			}
+			typ = typ.Elem()
+		}
+		if param := paramType(params, p); !inf.unify(param, typ) {
+			panic(tc.errorf(arg, "type %s of %s does not match %s", ti, arg, param))
+		}
+	}
+
+	// Infer the type arguments from the core types of the constraints, as
+	// E from "S ~[]E".
+	for changed := true; changed; {
+		changed = false
+		for i, p := range g.params {
+			core := coreType(p.Type)
+			if core == nil || inf.args[i] == nil {
+				continue
+			}
+			n := inf.bound()
+			inf.unify(core, inf.args[i])
+			changed = changed || inf.bound() > n
+		}
+	}
+
+	// Use the default types of the untyped constant arguments.
+	isDefault := make([]bool, len(g.params))
+	for _, i := range untyped {
+		p := i
+		if i >= len(params) {
+			p = len(params) - 1
+		}
+		ident, ok := paramType(params, p).(*ast.Identifier)
+		if !ok {
+			continue
+		}
+		k := g.paramIndex(ident.Name)
+		if k == -1 || inf.args[k] != nil && !isDefault[k] {
+			continue
+		}
+		typ := tc.compilation.typeInfos[expr.Args[i]].Type
+		if inf.args[k] == nil || untypedRank(typ) > untypedRank(inf.args[k]) {
+			inf.args[k] = typ
+			isDefault[k] = true
+		}
+	}
+
+	for i, arg := range inf.args {
+		if arg == nil {
+			panic(tc.errorf(expr, "cannot infer %s", g.params[i].Ident))
+		}
+	}
+
+	return inf.args
+}
+
+// bound returns the number of bound type parameters.
+func (inf *inference) bound() int {
+	n := 0
+	for _, arg := range inf.args {
+		if arg != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// unify unifies the type expression expr, of a parameter of the generic
+// function, with the type t, binding the type parameters in expr. It reports
+// whether the unification succeeded.
+func (inf *inference) unify(expr ast.Expression, t reflect.Type) bool {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		i := inf.g.paramIndex(expr.Name)
+		if i == -1 {
+			return true
+		}
+		if inf.args[i] == nil {
+			inf.args[i] = t
+			return true
+		}
+		return inf.args[i] == t
+	case *ast.ArrayType:
+		return t.Kind() == reflect.Array && inf.unify(expr.ElementType, t.Elem())
+	case *ast.SliceType:
+		return t.Kind() == reflect.Slice && inf.unify(expr.ElementType, t.Elem())
+	case *ast.ChanType:
+		return t.Kind() == reflect.Chan && inf.unify(expr.ElementType, t.Elem())
+	case *ast.MapType:
+		return t.Kind() == reflect.Map && inf.unify(expr.KeyType, t.Key()) && inf.unify(expr.ValueType, t.Elem())
+	case *ast.UnaryOperator:
+		if expr.Op != ast.OperatorPointer {
+			return true
+		}
+		return t.Kind() == reflect.Ptr && inf.unify(expr.Expr, t.Elem())
+	case *ast.FuncType:
+		if t.Kind() != reflect.Func || t.NumIn() != len(expr.Parameters) || t.NumOut() != len(expr.Result) {
+			return false
+		}
+		for i := range expr.Parameters {
+			in := t.In(i)
+			if expr.IsVariadic && i == len(expr.Parameters)-1 {
+				if !t.IsVariadic() {
+					return false
+				}
+				in = in.Elem()
+			}
+			if !inf.unify(paramType(expr.Parameters, i), in) {
+				return false
+			}
+		}
+		for i := range expr.Result {
+			if !inf.unify(paramType(expr.Result, i), t.Out(i)) {
+				return false
+			}
+		}
+		return true
+	case *ast.Index, *ast.IndexList:
+		base, exprs := receiverTypeParams(expr)
+		inst, ok := inf.g.tc.compilation.instances[t]
+		if !ok || len(exprs) != len(inst.args) {
+			return false
+		}
+		var name string
+		switch base := base.(type) {
+		case *ast.Identifier:
+			name = base.Name
+		case *ast.Selector:
+			name = base.Ident
+		}
+		if name != inst.generic.name() {
+			return false
+		}
+		for i, e := range exprs {
+			if !inf.unify(e, inst.args[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// paramType returns the type of the i-th parameter in params.
+func paramType(params []*ast.Parameter, i int) ast.Expression {
+	for _, p := range params[i:] {
+		if p.Type != nil {
+			return p.Type
+		}
+	}
+	return nil
+}
+
+// coreType returns the type of the single term of the constraint expr, as
+// []E for "~[]E". If expr has not a single term, it returns nil.
+func coreType(expr ast.Expression) ast.Expression {
+	switch e := expr.(type) {
+	case *ast.UnaryOperator:
+		if e.Op == ast.OperatorTilde {
+			return e.Expr
+		}
+	case *ast.ArrayType, *ast.SliceType, *ast.MapType, *ast.ChanType, *ast.FuncType:
+		return expr
+	}
+	return nil
+}
+
+// untypedRank returns the rank of the default type t of an untyped constant.
+// If untyped constants of different kinds are passed for the same type
+// parameter, the type with the highest rank is used.
+func untypedRank(t reflect.Type) int {
+	switch t.Kind() {
+	case reflect.Int32:
+		return 1
+	case reflect.Float64:
+		return 2
+	case reflect.Complex128:
+		return 3
+	}
+	return 0
+}
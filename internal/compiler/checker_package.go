@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/internal/compiler/types"
 	"github.com/open2b/scriggo/native"
 )
 
@@ -303,7 +304,7 @@ func sortDeclarations(pkg *ast.Package) error {
 				}
 			}
 			for _, f := range funcs {
-				if f.Ident.Name == d.Name {
+				if f.Recv == nil && f.Ident.Name == d.Name {
 					newDs = append(newDs, d)
 				}
 			}
@@ -444,7 +445,7 @@ varsLoop:
 					}
 				}
 				for _, f := range funcs {
-					if dep.Name == f.Ident.Name {
+					if f.Recv == nil && dep.Name == f.Ident.Name {
 						// This dependency has been resolved: move
 						// on checking for next one.
 						found = true
@@ -504,6 +505,69 @@ varsLoop:
 
 }
 
+// localDefinedTypes returns the defined types declared in the package pkg.
+func (tc *typechecker) localDefinedTypes(pkg *ast.Package) map[reflect.Type]bool {
+	defined := map[reflect.Type]bool{}
+	for _, d := range pkg.Declarations {
+		if td, ok := d.(*ast.TypeDeclaration); ok && !td.IsAliasDeclaration {
+			if ti, ok := tc.scopes.FilePackage(td.Ident.Name); ok && ti.IsType() {
+				defined[ti.Type] = true
+			}
+		}
+	}
+	return defined
+}
+
+// declareMethod declares the method f on the base type of its receiver. The
+// base type must be a defined type in localTypes.
+func (tc *typechecker) declareMethod(f *ast.Func, localTypes map[reflect.Type]bool) {
+	recv := tc.checkType(f.Recv.Type).Type
+	base := recv
+	ptr := false
+	if op, ok := f.Recv.Type.(*ast.UnaryOperator); ok && op.Op == ast.OperatorPointer {
+		base = recv.Elem()
+		ptr = true
+	}
+	if !localTypes[base] {
+		panic(tc.errorf(f.Recv.Type, "cannot define new methods on non-local type %s", base))
+	}
+	if k := base.Kind(); k == reflect.Ptr || k == reflect.Interface {
+		panic(tc.errorf(f.Recv.Type, "invalid receiver type %s (pointer or interface type)", recv))
+	}
+	typ := tc.checkType(f.Type).Type
+	in := make([]reflect.Type, typ.NumIn()+1)
+	in[0] = recv
+	for i := 0; i < typ.NumIn(); i++ {
+		in[i+1] = typ.In(i)
+	}
+	out := make([]reflect.Type, typ.NumOut())
+	for i := 0; i < typ.NumOut(); i++ {
+		out[i] = typ.Out(i)
+	}
+	m := &types.Method{Name: f.Ident.Name, Type: typ, Ptr: ptr}
+	tc.compilation.typeInfos[f] = &typeInfo{Type: tc.types.FuncOf(in, out, typ.IsVariadic()), value: m}
+	if isBlankIdentifier(f.Ident) {
+		return
+	}
+	if prev, ok := types.MethodByName(tc.types.PtrTo(base), m.Name); ok {
+		switch {
+		case prev.Ptr != ptr:
+			panic(tc.errorf(f.Ident, "method redeclared: %s.%s", base, m.Name))
+		case ptr:
+			panic(tc.errorf(f.Ident, "(*%s).%s redeclared in this block", base, m.Name))
+		}
+		panic(tc.errorf(f.Ident, "%s.%s redeclared in this block", base, m.Name))
+	}
+	if base.Kind() == reflect.Struct {
+		for i := 0; i < base.NumField(); i++ {
+			if decodeFieldName(base.Field(i).Name) == m.Name {
+				panic(tc.errorf(f.Ident, "type %s has both field and method named %s", base, m.Name))
+			}
+		}
+	}
+	types.AddMethod(base, m)
+}
+
 // checkPackage type checks a package.
 //
 // extendingFile indicates whether the package pkg was originally a template
@@ -566,10 +630,12 @@ func checkPackage(compilation *compilation, pkg *ast.Package, path string, impor
 		compilation.alreadySortedPkgs[pkg] = true
 	}
 
+	numDecls := len(pkg.Declarations)
+
 	// First: import packages.
 	for _, d := range pkg.Declarations {
 		if d, ok := d.(*ast.Import); ok {
-			err := tc.checkImport(d)
+			err := tc.tryCheck(d, func() error { return tc.checkImport(d) })
 			if err != nil {
 				return err
 			}
@@ -577,64 +643,133 @@ func checkPackage(compilation *compilation, pkg *ast.Package, path string, impor
 	}
 
 	// Second: check all type declarations.
+	genericTypes := map[string]*generic{}
 	for _, d := range pkg.Declarations {
 		if td, ok := d.(*ast.TypeDeclaration); ok {
-			name, ti := tc.checkTypeDeclaration(td)
-			if ti != nil {
-				tc.assignScope(name, ti, td.Ident, nil)
-			}
+			_ = tc.tryCheck(td, func() error {
+				if td.TypeParams != nil {
+					genericTypes[td.Ident.Name] = tc.declareGenericType(pkg, td)
+					return nil
+				}
+				name, ti := tc.checkTypeDeclaration(td)
+				if ti != nil {
+					tc.assignScope(name, ti, td.Ident, nil)
+				}
+				return nil
+			})
 		}
 	}
 
-	// Defines functions in file/package block before checking all
-	// declarations.
+	// Defines functions in file/package block, and methods on the types
+	// declared in the package, before checking all declarations.
+	var localTypes map[reflect.Type]bool
 	for _, d := range pkg.Declarations {
 		if f, ok := d.(*ast.Func); ok {
-			if f.Body == nil {
-				return tc.errorf(f.Ident.Pos(), "missing function body")
-			}
-			if f.Ident.Name == "init" || f.Ident.Name == "main" {
-				if len(f.Type.Parameters) > 0 || len(f.Type.Result) > 0 {
-					return tc.errorf(f.Ident, "func %s must have no arguments and no return values", f.Ident.Name)
+			err := tc.tryCheck(f, func() error {
+				if f.Body == nil {
+					return tc.errorf(f.Ident.Pos(), "missing function body")
 				}
-			}
-			if f.Type.Macro && len(f.Type.Result) == 0 {
-				tc.makeMacroResultExplicit(f)
-			}
-			// Function type must be checked for every function, including
-			// 'init's functions.
-			funcType := tc.checkType(f.Type).Type
-			if f.Ident.Name == "init" || isBlankIdentifier(f.Ident) {
-				// Do not add 'init' and '_' functions to the file/package block.
-				continue
-			}
-			if _, ok := tc.scopes.FilePackage(f.Ident.Name); ok {
-				return tc.errorf(f.Ident, "%s redeclared in this block", f.Ident.Name)
-			}
-			ti := &typeInfo{Type: funcType}
-			if f.Type.Macro {
-				ti.Properties |= propertyIsMacroDeclaration
-				if extendingFile {
-					ti.Properties |= propertyMacroDeclaredInFileWithExtends
+				if f.TypeParams != nil {
+					tc.declareGenericFunc(pkg, f)
+					return nil
 				}
+				if isGenericDeclaration(f) {
+					tc.addGenericMethod(f, genericTypes)
+					return nil
+				}
+				if f.Recv != nil {
+					if localTypes == nil {
+						localTypes = tc.localDefinedTypes(pkg)
+					}
+					tc.declareMethod(f, localTypes)
+					return nil
+				}
+				if f.Ident.Name == "init" || f.Ident.Name == "main" {
+					if len(f.Type.Parameters) > 0 || len(f.Type.Result) > 0 {
+						return tc.errorf(f.Ident, "func %s must have no arguments and no return values", f.Ident.Name)
+					}
+				}
+				if f.Type.Macro && len(f.Type.Result) == 0 {
+					tc.makeMacroResultExplicit(f)
+				}
+				// Function type must be checked for every function, including
+				// 'init's functions.
+				funcType := tc.checkType(f.Type).Type
+				if f.Ident.Name == "init" || isBlankIdentifier(f.Ident) {
+					// Do not add 'init' and '_' functions to the file/package block.
+					return nil
+				}
+				if _, ok := tc.scopes.FilePackage(f.Ident.Name); ok {
+					return tc.errorf(f.Ident, "%s redeclared in this block", f.Ident.Name)
+				}
+				ti := &typeInfo{Type: funcType}
+				if f.Type.Macro {
+					ti.Properties |= propertyIsMacroDeclaration
+					if extendingFile {
+						ti.Properties |= propertyMacroDeclaredInFileWithExtends
+					}
+				}
+				tc.scopes.Declare(f.Ident.Name, ti, f.Ident, nil)
+				return nil
+			})
+			if err != nil {
+				return err
 			}
-			tc.scopes.Declare(f.Ident.Name, ti, f.Ident, nil)
 		}
 	}
 
-	// Type check and defined functions, variables and constants.
-	for _, d := range pkg.Declarations {
-		switch d := d.(type) {
-		case *ast.Func:
-			tc.checkFunc(d)
-		case *ast.Const:
-			tc.checkConstantDeclaration(d)
-		case *ast.Var:
-			tc.checkVariableDeclaration(d)
+	// Declare the methods of the generic types on the instances created
+	// while checking the declarations of types and functions.
+	for _, d := range pkg.Declarations[:numDecls] {
+		td, ok := d.(*ast.TypeDeclaration)
+		if !ok || td.TypeParams == nil {
+			continue
+		}
+		g, ok := genericTypes[td.Ident.Name]
+		if !ok {
+			continue
+		}
+		g.ready = true
+		for _, inst := range g.instances {
+			_ = tc.tryCheck(g.typ, func() error {
+				g.declareMethods(inst)
+				return nil
+			})
 		}
 	}
 
-	if tc.opts.mod != templateMod {
+	// Type check and defined functions, variables and constants. The
+	// declarations of the instances, added to the package while checking,
+	// are checked by checkInstanceBodies.
+	for _, d := range pkg.Declarations[:numDecls] {
+		if tc.compilation.failed[d] {
+			continue
+		}
+		if f, ok := d.(*ast.Func); ok && isGenericDeclaration(f) {
+			continue
+		}
+		_ = tc.tryCheck(d, func() error {
+			switch d := d.(type) {
+			case *ast.Func:
+				tc.checkFunc(d)
+			case *ast.Const:
+				tc.checkConstantDeclaration(d)
+			case *ast.Var:
+				tc.checkVariableDeclaration(d)
+			}
+			return nil
+		})
+	}
+
+	// Type check the bodies of the instances of generic functions and
+	// methods.
+	if err := compilation.checkInstanceBodies(); err != nil {
+		return err
+	}
+
+	// If errors have been reported, the imported packages may have been used
+	// in the declarations that failed.
+	if tc.opts.mod != templateMod && len(tc.compilation.errors) == 0 {
 		// Check that the imported packages have been used.
 		if node := tc.scopes.UnusedImport(); node != nil {
 			var s string
@@ -647,7 +782,7 @@ func checkPackage(compilation *compilation, pkg *ast.Package, path string, impor
 		}
 	}
 
-	if pkg.Name == "main" {
+	if pkg.Name == "main" && !tc.compilation.failedNames["main"] {
 		if _, ok := tc.scopes.FilePackage("main"); !ok {
 			return tc.errorf(new(ast.Position), "function main is undeclared in the main package")
 		}
@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/internal/fstest"
 	"github.com/open2b/scriggo/native"
 )
 
@@ -42,7 +43,7 @@ func TestInitializationLoop(t *testing.T) {
 	}
 	for name, cas := range cases {
 		t.Run(name, func(t *testing.T) {
-			tree, err := parseSource([]byte(cas.src), false)
+			tree, err := parseSource([]byte(cas.src), false, 0)
 			if err != nil {
 				t.Fatalf("parsing error: %s", err)
 			}
@@ -296,7 +297,7 @@ func TestPackageOrdering(t *testing.T) {
 	}
 	for name, cas := range cases {
 		t.Run(name, func(t *testing.T) {
-			tree, err := parseSource([]byte(cas.src), false)
+			tree, err := parseSource([]byte(cas.src), false, 0)
 			if err != nil {
 				t.Fatalf("parsing error: %s", err)
 			}
@@ -368,3 +369,26 @@ func TestToTypeCheckerScope(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckerPackageErrors(t *testing.T) {
+	src := "package main\n\nfunc main() {\n\tf()\n\tvar a int = \"\"\n}\n\nfunc f() int { return \"\" }\n\n" +
+		"type T U\n\nvar v T\n\nfunc g() { h() }\n"
+	expected := "main:5:14: cannot use \"\" (type untyped string) as type int in assignment\n" +
+		"main:8:16: cannot use \"\" (type untyped string) as type int in return argument\n" +
+		"main:10:8: undefined: U\n" +
+		"main:14:12: undefined: h"
+	_, err := BuildProgram(fstest.Files{"main.go": src}, Options{MaxErrors: -1})
+	if err == nil {
+		t.Fatalf("expected error %q, got nothing", expected)
+	}
+	if err.Error() != expected {
+		t.Fatalf("expected error %q, got %q", expected, err)
+	}
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("expected an Errors value, got %T", err)
+	}
+	if len(errs) != 4 {
+		t.Fatalf("expected 4 errors, got %d", len(errs))
+	}
+}
@@ -497,6 +497,7 @@ var universe = map[string]scopeName{
 	"any":        {ti: &typeInfo{Type: emptyInterfaceType, Alias: "any", Properties: propertyIsType | propertyUniverse}},
 	"byte":       {ti: &typeInfo{Type: uint8Type, Alias: "byte", Properties: propertyIsType | propertyUniverse}},
 	"bool":       {ti: &typeInfo{Type: boolType, Properties: propertyIsType | propertyUniverse}},
+	"comparable": {ti: &typeInfo{Type: emptyInterfaceType, Alias: "comparable", Properties: propertyIsType | propertyUniverse, constraint: &typeConstraint{comparable: true}}},
 	"complex128": {ti: &typeInfo{Type: complex128Type, Properties: propertyIsType | propertyUniverse}},
 	"complex64":  {ti: &typeInfo{Type: complex64Type, Properties: propertyIsType | propertyUniverse}},
 	"error":      {ti: &typeInfo{Type: errorType, Properties: propertyIsType | propertyUniverse}},
@@ -129,7 +129,18 @@ func (tc *typechecker) checkNodesInNewScopeError(block ast.Node, nodes []ast.Nod
 		}
 	}()
 	tc.scopes.Enter(block)
-	newNodes = tc.checkNodes(nodes)
+	if tc.compilation.maxErrors == 0 {
+		newNodes = tc.checkNodes(nodes)
+	} else {
+		// Check the nodes one at a time to continue with the next node when
+		// the checking of a node fails.
+		for _, node := range nodes {
+			_ = tc.tryCheck(node, func() error {
+				newNodes = append(newNodes, tc.checkNodes([]ast.Node{node})...)
+				return nil
+			})
+		}
+	}
 	tc.scopes.Exit()
 	return
 }
@@ -558,6 +569,7 @@ nodesLoop:
 				panic(tc.errorf(node, "cannot type switch on non-interface value %v (type %s)", ta.Expr,
 					t.StringWithNumber(true)))
 			}
+			iface := t.Type
 			var name string
 			var ti *typeInfo
 			if a := node.Assignment; a.Type == ast.AssignmentDeclaration {
@@ -591,6 +603,10 @@ nodesLoop:
 					if !t.IsType() {
 						panic(tc.errorf(cas, "%v (type %s) is not a type", expr, t.StringWithNumber(true)))
 					}
+					if t.Type.Kind() != reflect.Interface && !types.Implements(t.Type, iface) {
+						panic(tc.errorf(cas, "impossible type switch case: %v (type %s) cannot have dynamic type %s%s",
+							ta.Expr, iface, t.Type, tc.notImplementedReason(t.Type, iface)))
+					}
 					if name != "" && len(cas.Expressions) == 1 {
 						ti := &typeInfo{Type: t.Type, Properties: propertyAddressable}
 						ident := ast.NewIdentifier(cas.Expressions[0].Pos(), name)
@@ -663,6 +679,9 @@ nodesLoop:
 			tc.terminating = false
 
 		case *ast.TypeDeclaration:
+			if node.TypeParams != nil {
+				panic(tc.errorf(node, "generic type %s cannot be declared inside a function", node.Ident))
+			}
 			name, ti := tc.checkTypeDeclaration(node)
 			if ti != nil {
 				tc.assignScope(name, ti, node.Ident, nil)
@@ -1120,7 +1139,12 @@ func (tc *typechecker) checkFunc(node *ast.Func) {
 	tc.scopes.Enter(node)
 	tc.addToAncestors(node)
 
-	// Adds parameters to the function body scope.
+	// Adds the receiver and the parameters to the function body scope.
+	if recv := node.Recv; recv != nil && recv.Ident != nil && !isBlankIdentifier(recv.Ident) {
+		t := tc.compilation.typeInfos[recv.Type].Type
+		tc.scopes.Declare(recv.Ident.Name, &typeInfo{Type: t, Properties: propertyAddressable}, recv.Ident, nil)
+		tc.scopes.Use(recv.Ident.Name)
+	}
 	t := node.Type.Reflect
 	for i := 0; i < t.NumIn(); i++ {
 		param := node.Type.Parameters[i]
@@ -1321,14 +1345,14 @@ func (tc *typechecker) checkReturn(node *ast.Return) ast.Node {
 //	type Int int
 //	type Int = int
 func (tc *typechecker) checkTypeDeclaration(node *ast.TypeDeclaration) (string, *typeInfo) {
-	typ := tc.checkType(node.Type)
+	typ := tc.checkTypeOrConstraint(node.Type)
 	if isBlankIdentifier(node.Ident) {
 		return "", nil
 	}
 	name := node.Ident.Name
 	if node.IsAliasDeclaration {
 		// Return the base type.
-		return name, &typeInfo{Type: typ.Type, Alias: node.Ident.Name, Properties: typ.Properties}
+		return name, &typeInfo{Type: typ.Type, Alias: node.Ident.Name, Properties: typ.Properties, constraint: typ.constraint}
 	}
 	// Create a new Scriggo type.
 	defType := tc.types.DefinedOf(name, typ.Type)
@@ -1343,6 +1367,7 @@ func (tc *typechecker) checkTypeDeclaration(node *ast.TypeDeclaration) (string,
 	return name, &typeInfo{
 		Type:       defType,
 		Properties: propertyIsType,
+		constraint: typ.constraint,
 	}
 }
 
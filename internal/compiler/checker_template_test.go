@@ -755,3 +755,35 @@ func TestJSONCycles(t *testing.T) {
 		}
 	}
 }
+
+var checkerErrorsTests = []struct {
+	src       string
+	maxErrors int
+	err       string
+}{
+	{`{% a := 1 + "" %}{{ a }}{{ b }}{% var c int = "" %}{% d := 5 %}{{ d }}`, -1, "index.html:1:11: invalid operation: 1 + \"\" (mismatched types int and string)\n" +
+		"index.html:1:28: undefined: b\n" +
+		"index.html:1:47: cannot use \"\" (type untyped string) as type int in assignment"},
+	{`{% a := 1 + "" %}{{ b }}{% var c int = "" %}`, 2, "index.html:1:11: invalid operation: 1 + \"\" (mismatched types int and string)\n" +
+		"index.html:1:21: undefined: b"},
+	{`{% a := 1 + "" %}{{ b }}`, 0, "index.html:1:11: invalid operation: 1 + \"\" (mismatched types int and string)"},
+	{`{% import "imp.html" %}{{ M() }}{{ N() }}{{ e }}`, -1, "imp.html:1:17: undefined: x\n" +
+		"index.html:1:45: undefined: e"},
+}
+
+func TestCheckerErrors(t *testing.T) {
+	for _, test := range checkerErrorsTests {
+		fsys := fstest.Files{
+			"index.html": test.src,
+			"imp.html":   "{% macro M %}{{ x }}{% end %}{% macro N %}{% end %}",
+		}
+		_, err := BuildTemplate(fsys, "index.html", Options{FormatTypes: formatTypes, MaxErrors: test.maxErrors})
+		if err == nil {
+			t.Errorf("source: %q, expected error %q, got nothing", test.src, test.err)
+			continue
+		}
+		if err.Error() != test.err {
+			t.Errorf("source: %q, expected error %q, got %q", test.src, test.err, err)
+		}
+	}
+}
@@ -1286,6 +1286,7 @@ var checkerStmts = map[string]string{
 	`v := interface{}(3); switch x := v.(type) {  }`:                             `x declared but not used`,
 	`v := interface{}(3); switch x := v.(type) { default: case int: }`:           `x declared but not used`,
 	`v := interface{}(3); switch x := v.(type) { case string: case int: _ = x }`: ok,
+	`var e error; switch e.(type) { case int: }`:                                 `impossible type switch case: e (type error) cannot have dynamic type int (missing Error method)`,
 
 	// Fallthrough
 	`switch 1 { case 1: fallthrough; default: }`:                      ok,
@@ -1837,7 +1838,7 @@ func TestCheckerStatements(t *testing.T) {
 					}
 				}
 			}()
-			tree, err := parseSource([]byte(src), true)
+			tree, err := parseSource([]byte(src), true, 0)
 			if err != nil {
 				t.Errorf("source: %s returned parser error: %s", src, err.Error())
 				return
@@ -2376,7 +2377,7 @@ func TestTypechecker_MaxIndex(t *testing.T) {
 	compilation := newCompilation(nil)
 	tc := newTypechecker(compilation, "", checkerOptions{}, nil)
 	for src, expected := range cases {
-		tree, err := parseSource([]byte(src), true)
+		tree, err := parseSource([]byte(src), true, 0)
 		if err != nil {
 			t.Error(err)
 		}
@@ -2498,7 +2499,7 @@ func TestFunctionUpVars(t *testing.T) {
 	for src, expected := range cases {
 		compilation := newCompilation(nil)
 		tc := newTypechecker(compilation, "", checkerOptions{}, nil)
-		tree, err := parseSource([]byte(src), true)
+		tree, err := parseSource([]byte(src), true, 0)
 		if err != nil {
 			t.Error(err)
 			continue
@@ -13,6 +13,7 @@ import (
 
 	"github.com/open2b/scriggo/ast"
 	"github.com/open2b/scriggo/internal/compiler/types"
+	"github.com/open2b/scriggo/internal/runtime"
 	"github.com/open2b/scriggo/native"
 )
 
@@ -547,18 +548,36 @@ func (tc *typechecker) typedValue(ti *typeInfo, t reflect.Type) interface{} {
 // errTypeAssertion is called when the type typ does not implement the
 // interface iface. It returns the corresponding compile-time error.
 func (tc *typechecker) errTypeAssertion(typ reflect.Type, iface reflect.Type) error {
-	msg := fmt.Sprintf("impossible type assertion:\n\t%s does not implement %s", typ, iface)
+	return fmt.Errorf("impossible type assertion:\n\t%s does not implement %s%s", typ, iface, tc.notImplementedReason(typ, iface))
+}
+
+// notImplementedReason returns the reason, as " (missing M method)", why the
+// type typ does not implement the interface iface.
+func (tc *typechecker) notImplementedReason(typ reflect.Type, iface reflect.Type) string {
 	num := iface.NumMethod()
 	for i := 0; i < num; i++ {
 		mi := iface.Method(i)
+		if _, ok := typ.(runtime.ScriggoType); ok {
+			m, _, ok := types.LookupMethod(typ, mi.Name)
+			if !ok {
+				if _, _, ok = types.LookupMethod(tc.types.PtrTo(typ), mi.Name); ok {
+					return fmt.Sprintf(" (%s method has pointer receiver)", mi.Name)
+				}
+				return fmt.Sprintf(" (missing %s method)", mi.Name)
+			}
+			if m.Type != mi.Type {
+				return fmt.Sprintf(" (wrong type for %s method)\n\t\thave %s\n\t\twant %s", mi.Name, m.Type, mi.Type)
+			}
+			continue
+		}
 		mt, ok := typ.MethodByName(mi.Name)
 		if !ok {
 			ptr := tc.types.PtrTo(typ)
 			_, ok = ptr.MethodByName(mi.Name)
 			if ok {
-				return fmt.Errorf("%s (%s method has pointer receiver)", msg, mi.Name)
+				return fmt.Sprintf(" (%s method has pointer receiver)", mi.Name)
 			}
-			return fmt.Errorf("%s (missing %s method)", msg, mi.Name)
+			return fmt.Sprintf(" (missing %s method)", mi.Name)
 		}
 		numIn := mt.Type.NumIn() - 1
 		numOut := mt.Type.NumOut()
@@ -588,9 +607,12 @@ func (tc *typechecker) errTypeAssertion(typ reflect.Type, iface reflect.Type) er
 			}
 			have = "func(" + have[p:]
 			want := mi.Type.String()
-			return fmt.Errorf("%s (wrong type for %s method)\n\t\thave %s\n\t\twant %s", msg, mi.Name, have, want)
+			return fmt.Sprintf(" (wrong type for %s method)\n\t\thave %s\n\t\twant %s", mi.Name, have, want)
 		}
 	}
+	if _, ok := typ.(runtime.ScriggoType); ok {
+		return " (only the Error and String methods of a Scriggo type are visible to native interfaces)"
+	}
 	panic("unexpected")
 }
 
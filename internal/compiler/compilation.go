@@ -5,8 +5,11 @@
 package compiler
 
 import (
+	"path"
+	"reflect"
 	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/open2b/scriggo/ast"
 )
@@ -76,6 +79,152 @@ type compilation struct {
 	// This information must be kept here because it becomes lost after
 	// transforming the tree in case of extends.
 	extendedTrees map[string]bool
+
+	// definitions maps identifiers and package selectors to their
+	// declarations. It is nil if the definitions are not collected.
+	definitions map[ast.Node]ast.Node
+
+	// maxErrors is the maximum number of checking errors to report, as
+	// Options.MaxErrors. If it is zero, the type checking stops at the first
+	// error.
+	maxErrors int
+
+	// errors contains the checking errors reported so far. It is used only
+	// if maxErrors is not zero.
+	errors []*CheckingError
+
+	// failed contains the declarations and the statements whose type
+	// checking failed, and failedNames the names they declare. The uses of
+	// these names are not reported as undefined.
+	failed      map[ast.Node]bool
+	failedNames map[string]bool
+
+	// instances maps the types instantiated from generic types to their
+	// instances.
+	instances map[reflect.Type]*instance
+
+	// instanceBodies contains the functions and the methods of the
+	// instances whose bodies have not been type checked yet.
+	instanceBodies []instanceBody
+}
+
+// addError adds err to the reported errors. node is the declaration or the
+// statement whose type checking failed. addError panics with err if err has
+// already been reported or if the maximum number of errors is reached.
+func (compilation *compilation) addError(node ast.Node, err *CheckingError) {
+	if compilation.reported(err) {
+		panic(err)
+	}
+	if compilation.failed == nil {
+		compilation.failed = map[ast.Node]bool{}
+		compilation.failedNames = map[string]bool{}
+	}
+	// Do not report the use of a name whose declaration failed.
+	cascading := false
+	if name := strings.TrimPrefix(err.err.Error(), "undefined: "); name != err.err.Error() {
+		cascading = compilation.failedNames[name]
+	}
+	compilation.failed[node] = true
+	for _, name := range declaredNames(node) {
+		compilation.failedNames[name] = true
+	}
+	if cascading {
+		return
+	}
+	compilation.errors = append(compilation.errors, err)
+	if len(compilation.errors) == compilation.maxErrors {
+		panic(err)
+	}
+}
+
+// checkingErrors returns the error to return at the end of the type
+// checking, given the error err with which the type checking terminated.
+// If more than one error has been reported, it returns an Errors value.
+func (compilation *compilation) checkingErrors(err error) error {
+	if len(compilation.errors) == 0 {
+		return err
+	}
+	errs := make(Errors, 0, len(compilation.errors)+1)
+	for _, e := range compilation.errors {
+		errs = append(errs, e)
+	}
+	if err != nil {
+		e, ok := err.(Error)
+		if !ok {
+			return err
+		}
+		if ce, ok := err.(*CheckingError); !ok || !compilation.reported(ce) {
+			errs = append(errs, e)
+		}
+	}
+	return errorList(errs)
+}
+
+// reported reports whether err has been reported.
+func (compilation *compilation) reported(err *CheckingError) bool {
+	for _, e := range compilation.errors {
+		if e == err {
+			return true
+		}
+	}
+	return false
+}
+
+// declaredNames returns the names declared by a declaration or a statement.
+func declaredNames(node ast.Node) []string {
+	var names []string
+	switch n := node.(type) {
+	case *ast.Assignment:
+		if n.Type == ast.AssignmentDeclaration {
+			for _, lh := range n.Lhs {
+				if ident, ok := lh.(*ast.Identifier); ok {
+					names = append(names, ident.Name)
+				}
+			}
+		}
+	case *ast.Const:
+		for _, ident := range n.Lhs {
+			names = append(names, ident.Name)
+		}
+	case *ast.Func:
+		if n.Ident != nil && n.Recv == nil {
+			names = append(names, n.Ident.Name)
+		}
+	case *ast.Import:
+		if n.Ident != nil && n.Ident.Name != "_" && n.Ident.Name != "." {
+			names = append(names, n.Ident.Name)
+		} else if n.Ident == nil && n.Tree == nil {
+			names = append(names, path.Base(n.Path))
+		}
+	case *ast.TypeDeclaration:
+		names = append(names, n.Ident.Name)
+	case *ast.Var:
+		for _, ident := range n.Lhs {
+			names = append(names, ident.Name)
+		}
+	}
+	return names
+}
+
+// addDefinition adds decl as declaration of node, if the definitions are
+// collected. decl can be an *ast.Identifier or an *ast.Import value.
+func (compilation *compilation) addDefinition(node, decl ast.Node) {
+	if compilation.definitions == nil {
+		return
+	}
+	switch d := decl.(type) {
+	case *ast.Identifier:
+		if d == nil {
+			return
+		}
+	case *ast.Import:
+		if d == nil {
+			return
+		}
+	default:
+		return
+	}
+	compilation.definitions[node] = decl
 }
 
 type renderIR struct {
@@ -96,6 +245,7 @@ func newCompilation(globalScope map[string]scopeName) *compilation {
 		globalScope:       globalScope,
 		extendingTrees:    map[string]bool{},
 		extendedTrees:     map[string]bool{},
+		instances:         map[reflect.Type]*instance{},
 	}
 }
 
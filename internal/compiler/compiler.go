@@ -14,9 +14,12 @@
 package compiler
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
 	"reflect"
+	"sort"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 
@@ -36,7 +39,7 @@ var formatTypeName = [...]string{"string", "html", "css", "js", "json", "markdow
 // As a special case, if the operand is an interface type then its value is
 // compared with the zero of the dynamic type of the interface.
 const (
-	internalOperatorZero = ast.OperatorExtendedNot + iota + 1
+	internalOperatorZero = ast.OperatorTilde + iota + 1
 	internalOperatorNotZero
 )
 
@@ -55,11 +58,95 @@ type Error interface {
 	Message() string
 }
 
+// Errors is a list of errors, sorted by path and position. It is returned,
+// in place of a single error, when more than one error occurs building a
+// template or a program.
+type Errors []Error
+
+// Error returns a string with the errors separated by a new line.
+func (errs Errors) Error() string {
+	var b strings.Builder
+	for i, err := range errs {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+// errorList returns nil if errs is empty, the error if errs has only one
+// error, otherwise it returns errs.
+func errorList(errs Errors) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return errs
+}
+
+// collectedErrors returns the maximum number of errors to collect, as in
+// Options.MaxErrors, to report at most max errors. As the reported errors
+// are the first ones in the sorted errors, all the errors are collected if
+// max is positive.
+func collectedErrors(max int) int {
+	if max > 0 {
+		return -1
+	}
+	return max
+}
+
+// sortErrors sorts the errors of err, if it is an Errors value, by path and
+// position, removes the errors with the same path and position of a previous
+// error and, if max is positive, keeps only the first max errors. It returns
+// the remaining errors as errorList does.
+func sortErrors(err error, max int) error {
+	errs, ok := err.(Errors)
+	if !ok {
+		return err
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		a, b := errs[i], errs[j]
+		if a.Path() != b.Path() {
+			return a.Path() < b.Path()
+		}
+		p1, p2 := a.Position(), b.Position()
+		if p1.Line != p2.Line {
+			return p1.Line < p2.Line
+		}
+		return p1.Column < p2.Column
+	})
+	n := 0
+	for _, e := range errs {
+		if n > 0 {
+			prev := errs[n-1]
+			p1, p2 := prev.Position(), e.Position()
+			if prev.Path() == e.Path() && p1.Line == p2.Line && p1.Column == p2.Column {
+				continue
+			}
+		}
+		errs[n] = e
+		n++
+	}
+	if max > 0 && n > max {
+		n = max
+	}
+	return errorList(errs[:n])
+}
+
 // Options represents a set of options used during the compilation.
 type Options struct {
 	AllowGoStmt          bool
 	NoParseShortShowStmt bool
 
+	// MaxErrors is the maximum number of errors reported. If it is zero, only
+	// the first error is reported, if it is negative, all errors are
+	// reported. If more than one error is reported, the returned error is an
+	// Errors value.
+	MaxErrors int
+
 	FormatTypes map[ast.Format]reflect.Type
 	Globals     native.Declarations
 
@@ -70,6 +157,9 @@ type Options struct {
 	MDConverter Converter
 
 	TreeTransformer func(*ast.Tree) error
+
+	// Optimize, when true, optimizes the emitted bytecode.
+	Optimize bool
 }
 
 // GoModError represents an error in a go.mod file.
@@ -108,9 +198,9 @@ func (e *GoModError) Position() ast.Position {
 func BuildProgram(fsys fs.FS, opts Options) (*Code, error) {
 
 	// Parse the source code.
-	tree, err := ParseProgram(fsys)
+	tree, err := parseProgram(fsys, collectedErrors(opts.MaxErrors))
 	if err != nil {
-		return nil, err
+		return nil, sortErrors(err, opts.MaxErrors)
 	}
 
 	// Transform the tree.
@@ -126,10 +216,17 @@ func BuildProgram(fsys fs.FS, opts Options) (*Code, error) {
 		mod:         programMod,
 		allowGoStmt: opts.AllowGoStmt,
 		globals:     opts.Globals,
+		maxErrors:   collectedErrors(opts.MaxErrors),
 	}
-	tci, err := typecheck(tree, opts.Importer, checkerOpts)
+	importer := opts.Importer
+	var recorder *importRecorder
+	if importer != nil {
+		recorder = &importRecorder{importer: importer}
+		importer = recorder
+	}
+	tci, err := typecheck(tree, importer, checkerOpts)
 	if err != nil {
-		return nil, err
+		return nil, sortErrors(err, opts.MaxErrors)
 	}
 	typeInfos := map[ast.Node]*typeInfo{}
 	for _, pkgInfos := range tci {
@@ -144,6 +241,15 @@ func BuildProgram(fsys fs.FS, opts Options) (*Code, error) {
 		return nil, err
 	}
 
+	// Optimize the code.
+	if opts.Optimize {
+		optimize(code)
+	}
+
+	if recorder != nil {
+		code.Packages = recorder.paths
+	}
+
 	return code, nil
 }
 
@@ -157,9 +263,10 @@ func BuildTemplate(fsys fs.FS, name string, opts Options) (*Code, error) {
 
 	// Parse the source code.
 	var err error
-	tree, err = ParseTemplate(fsys, name, opts.NoParseShortShowStmt)
+	var dependencies []Dependency
+	tree, dependencies, err = parseTemplate(fsys, name, opts.NoParseShortShowStmt, false, collectedErrors(opts.MaxErrors))
 	if err != nil {
-		return nil, err
+		return nil, sortErrors(err, opts.MaxErrors)
 	}
 
 	// Transform the tree.
@@ -170,6 +277,10 @@ func BuildTemplate(fsys fs.FS, name string, opts Options) (*Code, error) {
 		}
 	}
 
+	// Keep the path of the file because the type checker changes the path
+	// of the tree if the file extends another file.
+	path := tree.Path
+
 	// Type check the tree.
 	checkerOpts := checkerOptions{
 		allowGoStmt: opts.AllowGoStmt,
@@ -177,9 +288,108 @@ func BuildTemplate(fsys fs.FS, name string, opts Options) (*Code, error) {
 		globals:     opts.Globals,
 		mdConverter: opts.MDConverter,
 		mod:         templateMod,
+		maxErrors:   collectedErrors(opts.MaxErrors),
+	}
+	importer := opts.Importer
+	var recorder *importRecorder
+	if importer != nil {
+		recorder = &importRecorder{importer: importer}
+		importer = recorder
+	}
+	tci, err := typecheck(tree, importer, checkerOpts)
+	if err != nil {
+		return nil, sortErrors(err, opts.MaxErrors)
+	}
+	typeInfos := map[ast.Node]*typeInfo{}
+	for _, pkgInfos := range tci {
+		for node, ti := range pkgInfos.TypeInfos {
+			typeInfos[node] = ti
+		}
+	}
+
+	// Emit the code.
+	code, err := emitTemplate(tree, path, typeInfos, tci["main"].IndirectVars, opts.FormatTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Optimize the code.
+	if opts.Optimize {
+		optimize(code)
+	}
+
+	if recorder != nil {
+		code.Packages = recorder.paths
+	}
+	code.Dependencies = dependencies
+
+	return code, nil
+}
+
+// ExpressionPath is the path reported in the errors of an expression built
+// with BuildExpression.
+const ExpressionPath = "expression"
+
+// ExpressionResult is the name of the global variable to which the value of
+// an expression built with BuildExpression is assigned. It is not a valid
+// identifier, so it cannot be referred by the expression.
+const ExpressionResult = "$result"
+
+// BuildExpression builds the expression src with the given options. The
+// identifiers in the expression are resolved in opts.Globals, and the value
+// of the expression, that must be assignable to resultType, is assigned to
+// the global variable ExpressionResult. If resultType is nil, the type of the
+// result is the empty interface.
+//
+// The returned code is executed as a template, and the variables declared in
+// opts.Globals can be initialized on every execution.
+func BuildExpression(src string, resultType reflect.Type, opts Options) (*Code, error) {
+
+	// Parse the expression.
+	expr, err := ParseExpression([]byte(src))
+	if err != nil {
+		if e, ok := err.(*SyntaxError); ok {
+			e.path = ExpressionPath
+		}
+		return nil, err
+	}
+
+	// Assign the expression to the result variable.
+	if resultType == nil {
+		resultType = emptyInterfaceType
+	}
+	pos := expr.Pos()
+	result := ast.NewIdentifier(pos, ExpressionResult)
+	assignment := ast.NewAssignment(pos, []ast.Expression{result}, ast.AssignmentSimple, []ast.Expression{expr})
+	tree := ast.NewTree(ExpressionPath, []ast.Node{assignment}, ast.FormatText)
+
+	globals := make(native.Declarations, len(opts.Globals)+1)
+	for name, decl := range opts.Globals {
+		globals[name] = decl
+	}
+	globals[ExpressionResult] = reflect.Zero(reflect.PtrTo(resultType)).Interface()
+
+	// Type check the tree.
+	checkerOpts := checkerOptions{
+		formatTypes: opts.FormatTypes,
+		globals:     globals,
+		mod:         templateMod,
 	}
-	tci, err := typecheck(tree, opts.Importer, checkerOpts)
+	importer := opts.Importer
+	var recorder *importRecorder
+	if importer != nil {
+		recorder = &importRecorder{importer: importer}
+		importer = recorder
+	}
+	tci, err := typecheck(tree, importer, checkerOpts)
 	if err != nil {
+		// The assignment to the result variable is not written by the user,
+		// so report its error as an error in the expression result.
+		if e, ok := err.(*CheckingError); ok && e.pos == *pos {
+			if msg := e.err.Error(); strings.HasSuffix(msg, " in assignment") {
+				e.err = errors.New(strings.TrimSuffix(msg, "assignment") + "expression result")
+			}
+		}
 		return nil, err
 	}
 	typeInfos := map[ast.Node]*typeInfo{}
@@ -190,9 +400,21 @@ func BuildTemplate(fsys fs.FS, name string, opts Options) (*Code, error) {
 	}
 
 	// Emit the code.
-	code, err := emitTemplate(tree, typeInfos, tci["main"].IndirectVars, opts.FormatTypes)
+	code, err := emitTemplate(tree, ExpressionPath, typeInfos, tci["main"].IndirectVars, opts.FormatTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Optimize the code.
+	if opts.Optimize {
+		optimize(code)
+	}
 
-	return code, err
+	if recorder != nil {
+		code.Packages = recorder.paths
+	}
+
+	return code, nil
 }
 
 // CheckingError records a type checking error with the path and the position
@@ -238,12 +460,29 @@ type Global struct {
 type Code struct {
 	// Globals is a slice of all globals used in Code.
 	Globals []Global
-	// Functions is a map of exported functions indexed by name.
+	// Functions is a map of exported functions indexed by name. For a
+	// template, it contains the macros declared in the template file.
 	Functions map[string]*runtime.Function
 	// Main is the Code entry point.
 	Main *runtime.Function
+	// Init, if not nil, initializes the package variables and calls the
+	// init functions. Main calls it before executing its body. For a
+	// template, it initializes the files imported by the template file, and
+	// Main does not call it.
+	Init *runtime.Function
 	// TypeOf returns the type of a value, including new types defined in code.
 	TypeOf runtime.TypeOfFunc
+	// Packages contains the paths of the imported native packages.
+	Packages []string
+	// Dependencies contains the references to the files extended, imported
+	// and rendered, directly or indirectly, by a template.
+	Dependencies []Dependency
+	// Types contains the types defined in Code that have methods.
+	Types []reflect.Type
+	// Declared contains the functions, the methods and the macros declared
+	// in Code, also those that are never called. The code coverage reports
+	// them as not executed.
+	Declared []*runtime.Function
 }
 
 // emitProgram emits the code for a program given its ast node, the type info
@@ -262,11 +501,15 @@ func emitProgram(pkgMain *ast.Package, typeInfos map[ast.Node]*typeInfo, indirec
 	e := newEmitter(typeInfos, nil, indirectVars)
 	functions, _, _ := e.emitPackage(pkgMain, false, "main")
 	main, _ := e.fnStore.availableScriggoFn(pkgMain, "main")
+	init, _ := e.fnStore.availableScriggoFn(pkgMain, "$init")
 	pkg := &Code{
 		Globals:   e.varStore.getGlobals(),
 		Functions: functions,
 		Main:      main,
+		Init:      init,
 		TypeOf:    e.types.TypeOf,
+		Types:     e.methodTypes,
+		Declared:  e.declaredFuncs,
 	}
 	return pkg, nil
 }
@@ -274,7 +517,7 @@ func emitProgram(pkgMain *ast.Package, typeInfos map[ast.Node]*typeInfo, indirec
 // emitTemplate emits the code for a template given its tree, the type info and
 // indirect variables. emitTemplate returns a function that is the entry point
 // of the template and the global variables.
-func emitTemplate(tree *ast.Tree, typeInfos map[ast.Node]*typeInfo, indirectVars map[*ast.Identifier]bool, formatTypes map[ast.Format]reflect.Type) (_ *Code, err error) {
+func emitTemplate(tree *ast.Tree, path string, typeInfos map[ast.Node]*typeInfo, indirectVars map[*ast.Identifier]bool, formatTypes map[ast.Format]reflect.Type) (_ *Code, err error) {
 	// Recover and eventually return a LimitExceededError.
 	defer func() {
 		if r := recover(); r != nil {
@@ -288,6 +531,22 @@ func emitTemplate(tree *ast.Tree, typeInfos map[ast.Node]*typeInfo, indirectVars
 	e := newEmitter(typeInfos, formatTypes, indirectVars)
 	e.pkg = &ast.Package{}
 	e.isTemplate = true
+	e.templatePath = path
+	e.templateMacros = map[string]*runtime.Function{}
+	if path == tree.Path {
+		// The template file does not extend another file, so its macros are
+		// declared as function literals assigned to local variables.
+		e.templateMacroLits = map[*ast.Func]string{}
+		for _, node := range tree.Nodes {
+			if n, ok := node.(*ast.Assignment); ok && len(n.Lhs) == 1 && len(n.Rhs) == 1 {
+				ident, ok1 := n.Lhs[0].(*ast.Identifier)
+				fn, ok2 := n.Rhs[0].(*ast.Func)
+				if ok1 && ok2 && fn.Type.Macro && e.ti(ident).IsMacroDeclaration() {
+					e.templateMacroLits[fn] = ident.Name
+				}
+			}
+		}
+	}
 	typ := reflect.FuncOf(nil, nil, false)
 	e.fb = newBuilder(newMacro("main", "main", typ, tree.Format, tree.Path, tree.Pos()), tree.Path)
 	e.fb.changePath(tree.Path)
@@ -295,7 +554,27 @@ func emitTemplate(tree *ast.Tree, typeInfos map[ast.Node]*typeInfo, indirectVars
 	e.emitNodes(tree.Nodes)
 	e.fb.exitScope()
 	e.fb.end()
-	return &Code{Main: e.fb.fn, TypeOf: e.types.TypeOf, Globals: e.varStore.getGlobals()}, nil
+	main := e.fb.fn
+	if e.templateMacroLits != nil {
+		e.emitTemplateMacros(tree.Nodes, tree.Path)
+	}
+	code := &Code{Main: main, TypeOf: e.types.TypeOf, Globals: e.varStore.getGlobals(), Declared: e.declaredFuncs}
+	if len(e.templateMacros) > 0 {
+		code.Functions = e.templateMacros
+		// Emit a function that calls the init functions of the imports, so
+		// that the macros can be called without executing the template.
+		if len(e.templateInits) > 0 {
+			code.Init = newFunction("main", "$init", typ, path, &ast.Position{})
+			fb := newBuilder(code.Init, path)
+			for _, fn := range e.templateInits {
+				index := fb.addFunction(fn)
+				fb.emitCallFunc(index, runtime.StackShift{}, nil)
+			}
+			fb.emitReturn()
+			fb.end()
+		}
+	}
+	return code, nil
 }
 
 // isExported reports whether name is exported, according to
@@ -257,7 +257,12 @@ func disassembleFunction(b *bytes.Buffer, globals []Global, fn *runtime.Function
 		if label, ok := labelOf[runtime.Addr(addr)]; ok {
 			_, _ = fmt.Fprintf(b, "%s%d:", indent, label)
 		}
+		if fn.Body[addr].Op == runtime.OpWide {
+			// The operands are merged by disassembleInstruction.
+			addr++
+		}
 		in := fn.Body[addr]
+		_, inB, inC := decodeOperands(fn.Body, addr)
 		switch in.Op {
 		case runtime.OpBreak, runtime.OpContinue, runtime.OpGoto:
 			label := labelOf[runtime.Addr(decodeUint24(in.A, in.B, in.C))]
@@ -266,23 +271,32 @@ func disassembleFunction(b *bytes.Buffer, globals []Global, fn *runtime.Function
 			_, _ = fmt.Fprintf(b, "%s\t%s", indent, disassembleInstruction(fn, globals, addr, textSize))
 		}
 		// TODO: this part is not clear:
-		if in.Op == runtime.OpLoadFunc && (int(in.B) < len(fn.Functions)) && fn.Functions[uint8(in.B)].Parent != nil { // function literal
+		if in.Op == runtime.OpLoadFunc && in.A == 0 && fn.Functions[uint16(inB)].Parent != nil { // function literal
 			b.WriteByte(' ')
-			b.WriteString(disassembleOperand(fn, in.C, reflect.Interface, false))
+			b.WriteString(disassembleOperand(fn, inC, reflect.Interface, false))
 			b.WriteString(" func")
-			disassembleFunction(b, globals, fn.Functions[uint8(in.B)], 0, depth+1)
+			disassembleFunction(b, globals, fn.Functions[uint16(inB)], 0, depth+1)
 		} else {
 			b.WriteByte('\n')
 		}
 		switch in.Op {
-		case runtime.OpCallFunc, runtime.OpCallMacro, runtime.OpCallIndirect, runtime.OpCallNative,
-			runtime.OpTailCall, runtime.OpSlice, runtime.OpStringSlice:
+		case runtime.OpCallFunc, runtime.OpCallMacro, runtime.OpCallIndirect, runtime.OpCallNative:
+			_, n := decodeStackShift(fn.Body, addr+1)
+			addr += n
+		case runtime.OpTailCall:
 			addr += 1
 		case runtime.OpDefer:
-			addr += 2
-		}
-		if in.Op == runtime.OpMakeSlice && in.B > 0 {
-			addr += 1
+			_, n := decodeStackShift(fn.Body, addr+1)
+			_, m := decodeStackShift(fn.Body, addr+1+n)
+			addr += n + m
+		case runtime.OpSlice, runtime.OpStringSlice:
+			_, _, _, n := decodeDataWord(fn.Body, addr+1, inB&8 != 0)
+			addr += n
+		case runtime.OpMakeSlice:
+			if inB > 0 {
+				_, _, _, n := decodeDataWord(fn.Body, addr+1, inB&8 != 0)
+				addr += n
+			}
 		}
 	}
 }
@@ -309,8 +323,8 @@ func getKind(operand rune, fn *runtime.Function, addr runtime.Addr) reflect.Kind
 }
 
 func disassembleInstruction(fn *runtime.Function, globals []Global, addr runtime.Addr, textSize int) string {
-	in := fn.Body[addr]
-	op, a, b, c := in.Op, in.A, in.B, in.C
+	op := fn.Body[addr].Op
+	a, b, c := decodeOperands(fn.Body, addr)
 	k := false
 	if op < 0 {
 		op = -op
@@ -359,30 +373,29 @@ func disassembleInstruction(fn *runtime.Function, globals []Global, addr runtime
 		var kind = reflectToRegisterKind(t.Kind())
 		s += " " + disassembleOperand(fn, c, kind, false)
 	case runtime.OpBreak, runtime.OpContinue, runtime.OpGoto:
-		s += " " + strconv.Itoa(int(decodeUint24(a, b, c)))
+		s += " " + strconv.Itoa(int(decodeUint24(int8(a), int8(b), int8(c))))
 	case runtime.OpCallFunc, runtime.OpCallMacro, runtime.OpCallIndirect, runtime.OpCallNative, runtime.OpTailCall, runtime.OpDefer:
 		if a != runtime.CurrentFunction {
 			switch op {
 			case runtime.OpCallFunc, runtime.OpCallMacro, runtime.OpTailCall:
-				sf := fn.Functions[uint8(a)]
+				sf := fn.Functions[uint16(a)]
 				s += " " + packageName(sf.Pkg) + "." + sf.Name
 			case runtime.OpCallIndirect:
 				s += " " + "("
 				s += disassembleOperand(fn, a, reflect.Interface, false)
 				s += ")"
 			case runtime.OpCallNative:
-				nf := fn.NativeFunctions[uint8(a)]
+				nf := fn.NativeFunctions[uint16(a)]
 				s += " " + packageName(nf.Package()) + "." + nf.Name()
 			case runtime.OpDefer:
 				s += " " + disassembleOperand(fn, a, reflect.Interface, false)
 			}
 		}
-		grow := fn.Body[addr+1]
-		stackShift := runtime.StackShift{int8(grow.Op), grow.A, grow.B, grow.C}
+		stackShift, _ := decodeStackShift(fn.Body, addr+1)
 		if c != runtime.NoVariadicArgs && (op == runtime.OpCallIndirect || op == runtime.OpCallNative || op == runtime.OpDefer) {
 			s += " ..." + strconv.Itoa(int(c))
 		}
-		_, _, typ := funcNameType(fn, a, addr, op)
+		_, _, typ := funcNameType(fn, uint16(a), addr, op)
 		for i := 0; i < 4; i++ {
 			s += " "
 			if typ == nil || !funcHasParameterInRegister(typ, registerType(i)) {
@@ -392,7 +405,7 @@ func disassembleInstruction(fn *runtime.Function, globals []Global, addr runtime
 			s += string("ifsg"[i])
 			s += strconv.Itoa(int(stackShift[i] + 1))
 		}
-		s += "\t; " + disassembleFunctionCall(fn, a, addr, op, stackShift, c)
+		s += "\t; " + disassembleFunctionCall(fn, uint16(a), addr, op, stackShift, int8(c))
 	case runtime.OpCap:
 		s += " " + disassembleOperand(fn, a, reflect.Interface, false)
 		s += " " + disassembleOperand(fn, c, reflect.Int, false)
@@ -539,7 +552,7 @@ func disassembleInstruction(fn *runtime.Function, globals []Global, addr runtime
 		s += " " + disassembleOperand(fn, c, reflect.Int, false)
 	case runtime.OpLoadFunc:
 		if a == 0 {
-			f := fn.Functions[uint8(b)]
+			f := fn.Functions[uint16(b)]
 			if f.Parent != nil { // f is a function literal.
 				s = "Func" // overwrite s.
 			} else {
@@ -547,12 +560,12 @@ func disassembleInstruction(fn *runtime.Function, globals []Global, addr runtime
 				s += " " + disassembleOperand(fn, c, reflect.Interface, false)
 			}
 		} else { // LoadFunc (native).
-			f := fn.NativeFunctions[uint8(b)]
+			f := fn.NativeFunctions[uint16(b)]
 			s += " " + packageName(f.Package()) + "." + f.Name()
 			s += " " + disassembleOperand(fn, c, reflect.Interface, false)
 		}
 	case runtime.OpLoad:
-		t, i := decodeValueIndex(a, b)
+		t, i := decodeValueIndex(int8(a), int8(b))
 		switch t {
 		case intRegister:
 			s += " " + fmt.Sprintf("%d", fn.Values.Int[i])
@@ -582,9 +595,9 @@ func disassembleInstruction(fn *runtime.Function, globals []Global, addr runtime
 	case runtime.OpMakeSlice:
 		s += " " + fn.Types[int(uint(a))].Elem().String()
 		if b > 0 {
-			next := fn.Body[addr+1]
-			s += " " + disassembleOperand(fn, next.A, reflect.Int, (b&(1<<1)) != 0)
-			s += " " + disassembleOperand(fn, next.B, reflect.Int, (b&(1<<2)) != 0)
+			length, capacity, _, _ := decodeDataWord(fn.Body, addr+1, b&(1<<3) != 0)
+			s += " " + disassembleOperand(fn, length, reflect.Int, (b&(1<<1)) != 0)
+			s += " " + disassembleOperand(fn, capacity, reflect.Int, (b&(1<<2)) != 0)
 		} else {
 			s += " 0 0"
 		}
@@ -627,6 +640,22 @@ func disassembleInstruction(fn *runtime.Function, globals []Global, addr runtime
 		s += " " + disassembleOperand(fn, a, reflect.Interface, false)
 		s += " " + disassembleOperand(fn, b, reflect.Int, false)
 		s += " " + disassembleOperand(fn, c, reflect.Int, false)
+	case runtime.OpRangeMapString:
+		s += " " + disassembleOperand(fn, a, reflect.Interface, false)
+		s += " " + disassembleOperand(fn, b, reflect.String, false)
+		s += " " + disassembleOperand(fn, c, getKind('c', fn, addr), false)
+	case runtime.OpRangeSliceFloat64:
+		s += " " + disassembleOperand(fn, a, reflect.Interface, false)
+		s += " " + disassembleOperand(fn, b, reflect.Int, false)
+		s += " " + disassembleOperand(fn, c, reflect.Float64, false)
+	case runtime.OpRangeSliceInt:
+		s += " " + disassembleOperand(fn, a, reflect.Interface, false)
+		s += " " + disassembleOperand(fn, b, reflect.Int, false)
+		s += " " + disassembleOperand(fn, c, reflect.Int, false)
+	case runtime.OpRangeSliceString:
+		s += " " + disassembleOperand(fn, a, reflect.Interface, false)
+		s += " " + disassembleOperand(fn, b, reflect.Int, false)
+		s += " " + disassembleOperand(fn, c, reflect.String, false)
 	case runtime.OpRangeString:
 		s += " " + disassembleOperand(fn, a, reflect.String, k)
 		s += " " + disassembleOperand(fn, b, reflect.Int, false)
@@ -671,37 +700,36 @@ func disassembleInstruction(fn *runtime.Function, globals []Global, addr runtime
 		ctx, _, _ := decodeRenderContext(runtime.Context(c))
 		s += " " + "(" + ctx.String() + ")"
 	case runtime.OpSlice:
+		low, high, max, _ := decodeDataWord(fn.Body, addr+1, b&8 != 0)
 		khigh := b&2 != 0
-		high := fn.Body[addr+1].B
 		if khigh && high == -1 {
 			khigh = false
 			high = 0
 		}
 		kmax := b&4 != 0
-		max := fn.Body[addr+1].C
 		if kmax && max == -1 {
 			kmax = false
 			max = 0
 		}
 		s += " " + disassembleOperand(fn, a, reflect.Interface, false)
-		s += " " + disassembleOperand(fn, fn.Body[addr+1].A, reflect.Int, b&1 != 0)
+		s += " " + disassembleOperand(fn, low, reflect.Int, b&1 != 0)
 		s += " " + disassembleOperand(fn, high, reflect.Int, khigh)
 		s += " " + disassembleOperand(fn, max, reflect.Int, kmax)
 		s += " " + disassembleOperand(fn, c, reflect.Interface, false)
 	case runtime.OpStringSlice:
+		low, high, _, _ := decodeDataWord(fn.Body, addr+1, b&8 != 0)
 		khigh := b&2 != 0
-		high := fn.Body[addr+1].B
 		if khigh && high == -1 {
 			khigh = false
 			high = 0
 		}
 		s += " " + disassembleOperand(fn, a, reflect.String, false)
-		s += " " + disassembleOperand(fn, fn.Body[addr+1].A, reflect.Int, b&1 != 0)
+		s += " " + disassembleOperand(fn, low, reflect.Int, b&1 != 0)
 		s += " " + disassembleOperand(fn, high, reflect.Int, khigh)
 		s += " " + disassembleOperand(fn, c, reflect.String, false)
 	case runtime.OpText:
 		if textSize != 0 {
-			i := int(decodeUint16(a, b))
+			i := int(decodeUint16(int8(a), int8(b)))
 			s += " " + disassembleText(fn.Text[i], textSize)
 		}
 	case runtime.OpTypify:
@@ -736,7 +764,7 @@ func disassembleInstruction(fn *runtime.Function, globals []Global, addr runtime
 // funcNameType returns a boolean indications if the specific function is a
 // macro, its name and its type. If the function is not available. Only one of
 // index and addr is meaningful, depending on the operation specified by op.
-func funcNameType(fn *runtime.Function, index int8, addr runtime.Addr, op runtime.Operation) (bool, string, reflect.Type) {
+func funcNameType(fn *runtime.Function, index uint16, addr runtime.Addr, op runtime.Operation) (bool, string, reflect.Type) {
 	switch op {
 	case runtime.OpCallFunc, runtime.OpCallMacro:
 		macro := fn.Functions[index].Macro
@@ -775,7 +803,7 @@ func funcHasParameterInRegister(fn reflect.Type, reg registerType) bool {
 // disassembleFunctionCall disassemble a function call returning an
 // human-readable string representing the call. The result of this function is
 // used as a comment to the byte code.
-func disassembleFunctionCall(fn *runtime.Function, index int8, addr runtime.Addr, op runtime.Operation, stackShift runtime.StackShift, variadic int8) string {
+func disassembleFunctionCall(fn *runtime.Function, index uint16, addr runtime.Addr, op runtime.Operation, stackShift runtime.StackShift, variadic int8) string {
 	macro, name, typ := funcNameType(fn, index, addr, op)
 	if typ == nil {
 		return ""
@@ -851,7 +879,7 @@ func disassembleVarRef(fn *runtime.Function, globals []Global, ref int16) string
 		v := globals[ref]
 		return packageName(v.Pkg) + "." + v.Name
 	}
-	s := disassembleOperand(fn, -int8(ref), reflect.Interface, false)
+	s := disassembleOperand(fn, -ref, reflect.Interface, false)
 	if depth > 0 {
 		s += "@" + strconv.Itoa(depth)
 	}
@@ -925,7 +953,7 @@ func registerKindToLabel(kind reflect.Kind) string {
 	}
 }
 
-func disassembleOperand(fn *runtime.Function, op int8, kind reflect.Kind, constant bool) string {
+func disassembleOperand(fn *runtime.Function, op int16, kind reflect.Kind, constant bool) string {
 	if constant {
 		switch {
 		case reflect.Int <= kind && kind <= reflect.Int64:
@@ -1092,6 +1120,14 @@ var operationName = [...]string{
 
 	runtime.OpRange: "Range",
 
+	runtime.OpRangeMapString: "Range",
+
+	runtime.OpRangeSliceFloat64: "Range",
+
+	runtime.OpRangeSliceInt: "Range",
+
+	runtime.OpRangeSliceString: "Range",
+
 	runtime.OpRangeString: "Range",
 
 	runtime.OpRealImag: "RealImag",
@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/ast/astutil"
 	"github.com/open2b/scriggo/internal/compiler/types"
 	"github.com/open2b/scriggo/internal/runtime"
 )
@@ -36,7 +37,8 @@ type emitter struct {
 	// isTemplate reports whether the emitter is currently emitting a template.
 	isTemplate bool
 
-	// rangeLabels contains the addresses of the current active Range instructions.
+	// rangeLabels contains the addresses of the Goto instructions that follow
+	// the current active Range instructions.
 	rangeLabels []label
 
 	// breakable is true if emitting a "breakable" statement (except ForRange,
@@ -51,6 +53,10 @@ type emitter struct {
 	// jump.
 	breakLabel *label
 
+	// provedIndexes contains the index expressions on slices for which the
+	// index has been proved to be within the bounds of the slice.
+	provedIndexes map[*ast.Index]bool
+
 	// inURL indicates if the emitter is currently inside an *ast.URL node.
 	inURL bool
 
@@ -83,6 +89,30 @@ type emitter struct {
 	// alreadyInitializedTemplatePkgs keeps track of the template packages for
 	// which the initialization code has already been emitted.
 	alreadyInitializedTemplatePkgs map[string]bool
+
+	// templatePath is the path of the file of the emitted template.
+	templatePath string
+
+	// templateMacros contains the macros declared at the top level of the
+	// file of the emitted template, indexed by name.
+	templateMacros map[string]*runtime.Function
+
+	// templateMacroLits contains the function literals of the macros
+	// declared at the top level of the file of the emitted template, if it
+	// does not extend another file, with the names of the macros.
+	templateMacroLits map[*ast.Func]string
+
+	// templateInits contains the init functions of the packages imported by
+	// the file of the emitted template.
+	templateInits []*runtime.Function
+
+	// methodTypes contains the defined types with methods declared in the
+	// emitted packages.
+	methodTypes []reflect.Type
+
+	// declaredFuncs contains the functions, the methods and the macros
+	// declared in the emitted packages.
+	declaredFuncs []*runtime.Function
 }
 
 // newEmitter returns a new emitter with the given type infos, format types,
@@ -96,12 +126,209 @@ func newEmitter(typeInfos map[ast.Node]*typeInfo, formatTypes map[ast.Format]ref
 		alreadyEmittedFuncs:            map[*ast.Func]*runtime.Function{},
 		alreadyInitializedVars:         map[*ast.Identifier]int16{},
 		alreadyInitializedTemplatePkgs: map[string]bool{},
+		provedIndexes:                  map[*ast.Index]bool{},
 	}
 	em.fnStore = newFunctionStore(em)
 	em.varStore = newVarStore(em, indirectVars)
 	return em
 }
 
+// addTemplateInits adds the init functions inits to the init functions of
+// the template file, if they have not already been added.
+func (em *emitter) addTemplateInits(inits []*runtime.Function) {
+	for _, fn := range inits {
+		add := true
+		for _, ini := range em.templateInits {
+			if ini == fn {
+				add = false
+				break
+			}
+		}
+		if add {
+			em.templateInits = append(em.templateInits, fn)
+		}
+	}
+}
+
+// emitTemplateMacros emits, for every macro declared in the file of the
+// template that refers to other declarations of the file, a macro that
+// executes these declarations, also if referred indirectly, and then the
+// body of the macro. In this way, the macro can be called without executing
+// the file. nodes are the nodes of the file, that does not extend another
+// file.
+func (em *emitter) emitTemplateMacros(nodes []ast.Node, path string) {
+
+	// Function literals must not be collected as macros of the template.
+	lits := em.templateMacroLits
+	em.templateMacroLits = nil
+
+	// Flatten the statements.
+	var decls []ast.Node
+	for _, node := range nodes {
+		if n, ok := node.(*ast.Statements); ok {
+			decls = append(decls, n.Nodes...)
+		} else {
+			decls = append(decls, node)
+		}
+	}
+
+	// declared contains the identifiers declared by the declarations, with
+	// the indexes of the declarations.
+	declared := map[*ast.Identifier]int{}
+	for i, node := range decls {
+		for _, ident := range declaredIdentifiers(node) {
+			declared[ident] = i
+		}
+	}
+
+	// A macro is declared by a variable declaration followed by the
+	// assignment of the macro. assignments contains the indexes of the
+	// assignments, indexed by the indexes of the variable declarations.
+	assignments := map[int]int{}
+	for i, node := range decls {
+		if n, ok := node.(*ast.Assignment); ok && n.Type == ast.AssignmentSimple && len(n.Rhs) == 1 {
+			if lit, ok := n.Rhs[0].(*ast.Func); ok {
+				if _, ok := lits[lit]; ok {
+					if j := lastDeclaration(decls[:i], n.Lhs[0].(*ast.Identifier).Name); j >= 0 {
+						assignments[j] = i
+					}
+				}
+			}
+		}
+	}
+
+	// refs returns the indexes of the declarations referred by the
+	// declaration with index i.
+	refs := func(i int) []int {
+		var indexes []int
+		var exprs []ast.Expression
+		switch n := decls[i].(type) {
+		case *ast.Var:
+			exprs = n.Rhs
+		case *ast.Assignment:
+			exprs = n.Rhs
+		}
+		for _, expr := range exprs {
+			astutil.Inspect(expr, func(node ast.Node) bool {
+				switch n := node.(type) {
+				case *ast.Func:
+					for _, uv := range n.Upvars {
+						if ident, ok := uv.Declaration.(*ast.Identifier); ok {
+							if j, ok := declared[ident]; ok {
+								indexes = append(indexes, j)
+							}
+						}
+					}
+					return false
+				case *ast.Identifier:
+					if j := lastDeclaration(decls[:i], n.Name); j >= 0 {
+						indexes = append(indexes, j)
+					}
+				}
+				return true
+			})
+		}
+		return indexes
+	}
+
+	for i, node := range decls {
+		n, ok := node.(*ast.Assignment)
+		if !ok || len(n.Rhs) != 1 {
+			continue
+		}
+		lit, ok := n.Rhs[0].(*ast.Func)
+		if !ok {
+			continue
+		}
+		name, ok := lits[lit]
+		if !ok || len(refs(i)) == 0 {
+			continue
+		}
+		// Determine the declarations to execute.
+		executed := map[int]bool{}
+		var visit func(i int)
+		visit = func(i int) {
+			for _, j := range refs(i) {
+				if !executed[j] {
+					executed[j] = true
+					visit(j)
+					if k, ok := assignments[j]; ok && !executed[k] {
+						executed[k] = true
+						visit(k)
+					}
+				}
+			}
+		}
+		visit(i)
+		fn := newMacro("main", name, em.typ(lit), lit.Format, path, lit.Pos())
+		fn.BodyPos = bodyPosition(lit)
+		em.fb = newBuilder(fn, path)
+		em.fb.enterScope()
+		em.prepareFunctionBodyParameters(lit)
+		params := make([]int16, len(lit.Type.Parameters))
+		for i, param := range lit.Type.Parameters {
+			if param.Ident != nil && !isBlankIdentifier(param.Ident) {
+				params[i] = em.fb.scopeLookup(param.Ident.Name)
+			}
+		}
+		em.fb.enterScope()
+		for j, decl := range decls {
+			if executed[j] {
+				em.emitNodes([]ast.Node{decl})
+			}
+		}
+		// Bind the parameters again, as the declarations can shadow them.
+		em.fb.enterScope()
+		for i, param := range lit.Type.Parameters {
+			if params[i] != 0 {
+				em.fb.bindVarReg(param.Ident.Name, params[i], em.typ(param.Type))
+			}
+		}
+		em.emitNodes(lit.Body.Nodes)
+		em.fb.exitScope()
+		em.fb.exitScope()
+		em.fb.exitScope()
+		em.fb.end()
+		em.templateMacros[name] = fn
+	}
+
+}
+
+// lastDeclaration returns the index of the last declaration in decls that
+// declares an identifier with the given name, or -1 if there is no such
+// declaration.
+func lastDeclaration(decls []ast.Node, name string) int {
+	for i := len(decls) - 1; i >= 0; i-- {
+		for _, ident := range declaredIdentifiers(decls[i]) {
+			if ident.Name == name {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// declaredIdentifiers returns the identifiers declared by node, if it is a
+// variable declaration or a short variable declaration.
+func declaredIdentifiers(node ast.Node) []*ast.Identifier {
+	switch n := node.(type) {
+	case *ast.Var:
+		return n.Lhs
+	case *ast.Assignment:
+		if n.Type != ast.AssignmentDeclaration {
+			return nil
+		}
+		idents := make([]*ast.Identifier, 0, len(n.Lhs))
+		for _, lh := range n.Lhs {
+			if ident, ok := lh.(*ast.Identifier); ok {
+				idents = append(idents, ident)
+			}
+		}
+		return idents
+	}
+	return nil
+}
+
 // ti returns the type info of node n.
 func (em *emitter) ti(n ast.Node) *typeInfo {
 	if ti, ok := em.typeInfos[n]; ok {
@@ -165,6 +392,17 @@ func (em *emitter) emitPackage(pkg *ast.Package, extendingFile bool, path string
 		// their bodies: order of declaration doesn't matter at package level.
 		for _, dec := range pkg.Declarations {
 			if fun, ok := dec.(*ast.Func); ok {
+				if isGenericDeclaration(fun) {
+					continue
+				}
+				if fun.Recv != nil {
+					// Methods are not available by name, they are called
+					// through the methods of their types.
+					if !isBlankIdentifier(fun.Ident) {
+						em.newMethodFunction(fun, path)
+					}
+					continue
+				}
 				var fn *runtime.Function
 				if emFn, ok := em.alreadyEmittedFuncs[fun]; ok {
 					fn = emFn
@@ -174,6 +412,7 @@ func (em *emitter) emitPackage(pkg *ast.Package, extendingFile bool, path string
 					} else {
 						fn = newFunction("main", fun.Ident.Name, fun.Type.Reflect, path, fun.Pos())
 					}
+					fn.BodyPos = bodyPosition(fun)
 				}
 				if fun.Ident.Name == "init" {
 					inits = append(inits, fn)
@@ -184,6 +423,9 @@ func (em *emitter) emitPackage(pkg *ast.Package, extendingFile bool, path string
 				if isExported(fun.Ident.Name) || isDummyMacroForRender {
 					functions[fun.Ident.Name] = fn
 				}
+				if fun.Type.Macro && !isDummyMacroForRender && em.isTemplate && path == em.templatePath {
+					em.templateMacros[fun.Ident.Name] = fn
+				}
 			}
 		}
 	}
@@ -208,7 +450,7 @@ func (em *emitter) emitPackage(pkg *ast.Package, extendingFile bool, path string
 			}
 			em.fb = initVarsFb
 			addresses := make([]address, len(n.Lhs))
-			pkgVarRegs := map[string]int8{}
+			pkgVarRegs := map[string]int16{}
 			pkgVarTypes := map[string]reflect.Type{}
 			for i, v := range n.Lhs {
 				if isBlankIdentifier(v) {
@@ -246,7 +488,7 @@ func (em *emitter) emitPackage(pkg *ast.Package, extendingFile bool, path string
 	for _, dec := range pkg.Declarations {
 		if n, ok := dec.(*ast.Func); ok {
 			var fn *runtime.Function
-			if isBlankIdentifier(n.Ident) {
+			if isBlankIdentifier(n.Ident) || isGenericDeclaration(n) {
 				// Do not emit this function declaration; it has already been
 				// type checked, so there's no need to enter into its body
 				// again.
@@ -256,7 +498,9 @@ func (em *emitter) emitPackage(pkg *ast.Package, extendingFile bool, path string
 				// Function has already been emitted, nothing to do.
 				continue
 			}
-			if n.Ident.Name == "init" {
+			if n.Recv != nil {
+				fn = em.ti(n).value.(*types.Method).Func
+			} else if n.Ident.Name == "init" {
 				fn = inits[initToBuild]
 				initToBuild++
 			} else {
@@ -267,24 +511,35 @@ func (em *emitter) emitPackage(pkg *ast.Package, extendingFile bool, path string
 			// If this is the main function, functions that initialize variables
 			// must be called before executing every other statement of the main
 			// function.
-			if n.Ident.Name == "main" {
+			if n.Recv == nil && n.Ident.Name == "main" && (initVarsFn != nil || len(inits) > 0) {
+				// The variables are initialized and the init functions are
+				// called by a special "$init" function, so that they can also
+				// be executed without executing the main function.
+				initFn := newFunction("main", "$init", reflect.FuncOf(nil, nil, false), path, &ast.Position{})
+				em.fnStore.makeAvailableScriggoFn(em.pkg, "$init", initFn)
+				initFb := newBuilder(initFn, path)
 				// First: initialize the package variables.
 				if initVarsFn != nil {
 					iv, _ := em.fnStore.availableScriggoFn(em.pkg, "$initvars")
-					index := em.fb.addFunction(iv) // TODO: check addFunction
-					em.fb.emitCallFunc(index, runtime.StackShift{}, nil)
+					index := initFb.addFunction(iv) // TODO: check addFunction
+					initFb.emitCallFunc(index, runtime.StackShift{}, nil)
 				}
 				// Second: call all init functions, in order.
 				for _, initFunc := range inits {
-					index := em.fb.addFunction(initFunc)
-					em.fb.emitCallFunc(index, runtime.StackShift{}, nil)
+					index := initFb.addFunction(initFunc)
+					initFb.emitCallFunc(index, runtime.StackShift{}, nil)
 				}
+				initFb.emitReturn()
+				initFb.end()
+				index := em.fb.addFunction(initFn)
+				em.fb.emitCallFunc(index, runtime.StackShift{}, nil)
 			}
 			em.prepareFunctionBodyParameters(n)
 			em.emitNodes(n.Body.Nodes)
 			em.fb.end()
 			em.fb.exitScope()
 			em.alreadyEmittedFuncs[n] = fn
+			em.declaredFuncs = append(em.declaredFuncs, fn)
 		}
 	}
 
@@ -303,6 +558,38 @@ func (em *emitter) emitPackage(pkg *ast.Package, extendingFile bool, path string
 
 }
 
+// newMethodFunction creates the function of the method declaration fun, sets
+// it as the function of the method and adds the receiver type to the types
+// with methods. The receiver is the first parameter of the function.
+func (em *emitter) newMethodFunction(fun *ast.Func, path string) {
+	if _, ok := em.alreadyEmittedFuncs[fun]; ok {
+		return
+	}
+	ti := em.ti(fun)
+	m := ti.value.(*types.Method)
+	recv := em.typ(fun.Recv.Type)
+	t := recv
+	if m.Ptr {
+		t = recv.Elem()
+	}
+	add := true
+	for _, mt := range em.methodTypes {
+		if mt == t {
+			add = false
+			break
+		}
+	}
+	if add {
+		em.methodTypes = append(em.methodTypes, t)
+	}
+	name := recv.String() + "." + m.Name
+	if m.Ptr {
+		name = "(" + recv.String() + ")." + m.Name
+	}
+	m.Func = newFunction("main", name, ti.Type, path, fun.Pos())
+	m.Func.BodyPos = bodyPosition(fun)
+}
+
 // callOptions holds information about a function call.
 type callOptions struct {
 	predefined    bool
@@ -318,11 +605,11 @@ type callOptions struct {
 //
 // Note that while prepareCallParameters is called before calling the function,
 // prepareFunctionBodyParameters is called before emitting its body.
-func (em *emitter) prepareCallParameters(fType reflect.Type, fArgs []ast.Expression, opts callOptions) ([]int8, []reflect.Type) {
+func (em *emitter) prepareCallParameters(fType reflect.Type, fArgs []ast.Expression, opts callOptions) ([]int16, []reflect.Type) {
 
 	fNumOut := fType.NumOut()
 	fNumIn := fType.NumIn()
-	fOutRegs := make([]int8, fNumOut)
+	fOutRegs := make([]int16, fNumOut)
 	fOutTypes := make([]reflect.Type, fNumOut)
 
 	// Reserve space for the output parameters.
@@ -351,13 +638,13 @@ func (em *emitter) prepareCallParameters(fType reflect.Type, fArgs []ast.Express
 			nonVarArgsCount := fNumIn - 1
 			varArgsCount := gOutCount - (fNumIn - 1)
 			// Reserve space for non variadic parameters.
-			var nonVarParamRegs []int8
+			var nonVarParamRegs []int16
 			for i := 0; i < nonVarArgsCount; i++ {
 				reg := em.fb.newRegister(fType.In(i).Kind())
 				nonVarParamRegs = append(nonVarParamRegs, reg)
 			}
 			// Reserve space for variadic parameters.
-			var varParamRegs []int8
+			var varParamRegs []int16
 			sliceType := fType.In(fNumIn - 1)
 			if opts.predefined {
 				// When calling a predefined variadic function, the variadic
@@ -370,7 +657,7 @@ func (em *emitter) prepareCallParameters(fType reflect.Type, fArgs []ast.Express
 			} else {
 				// When calling a non-predefined variadic function, the
 				// variadic parameters must be emitted inside a slice.
-				varParamRegs = []int8{em.fb.newRegister(reflect.Slice)}
+				varParamRegs = []int16{em.fb.newRegister(reflect.Slice)}
 			}
 			em.fb.enterStack()
 			gOutRegs, gOutTypes := em.emitCallNode(g, false, false, runtime.ReturnString)
@@ -391,15 +678,15 @@ func (em *emitter) prepareCallParameters(fType reflect.Type, fArgs []ast.Express
 				if varArgsCount == 0 {
 					// The slice must be nil, not empty.
 					c := em.fb.makeGeneralValue(reflect.Zero(sliceType))
-					em.changeRegister(true, c, slice, sliceType, sliceType)
+					em.changeRegister(true, int16(c), slice, sliceType, sliceType)
 				} else {
 					pos := fArgs[0].Pos()
-					em.fb.emitMakeSlice(true, true, sliceType, int8(varArgsCount), int8(varArgsCount), slice, pos)
+					em.fb.emitMakeSlice(true, true, sliceType, int16(varArgsCount), int16(varArgsCount), slice, pos)
 					for i := nonVarArgsCount; i < len(gOutRegs); i++ {
 						gArgReg := gOutRegs[i]
 						gArgType := gOutTypes[i]
 						index := em.fb.newRegister(reflect.Int)
-						em.changeRegister(true, int8(i-nonVarArgsCount), index, intType, intType)
+						em.changeRegister(true, int16(i-nonVarArgsCount), index, intType, intType)
 						if canEmitDirectly(gArgType.Kind(), sliceType.Elem().Kind()) {
 							em.fb.emitSetSlice(false, slice, gArgReg, index, pos, sliceType.Elem().Kind())
 						} else {
@@ -446,14 +733,14 @@ func (em *emitter) prepareCallParameters(fType reflect.Type, fArgs []ast.Express
 			}
 		} else {
 			slice := em.fb.newRegister(reflect.Slice)
-			em.fb.emitMakeSlice(true, true, fType.In(fNumIn-1), int8(varArgsCount), int8(varArgsCount), slice, nil) // TODO: fix pos.
+			em.fb.emitMakeSlice(true, true, fType.In(fNumIn-1), int16(varArgsCount), int16(varArgsCount), slice, nil) // TODO: fix pos.
 			for i := 0; i < varArgsCount; i++ {
 				tmp := em.fb.newRegister(t.Kind())
 				em.fb.enterStack()
 				em.emitExprR(fArgs[i+fNumIn-1], t, tmp)
 				em.fb.exitStack()
 				index := em.fb.newRegister(reflect.Int)
-				em.fb.emitMove(true, int8(i), index, reflect.Int)
+				em.fb.emitMove(true, int16(i), index, reflect.Int)
 				pos := fArgs[len(fArgs)-1].Pos()
 				em.fb.emitSetSlice(false, slice, tmp, index, pos, fType.In(fNumIn-1).Elem().Kind())
 			}
@@ -499,17 +786,23 @@ func (em *emitter) prepareFunctionBodyParameters(fn *ast.Func) {
 
 	// Reserve space for the return parameters and eventually bind them.
 	for _, out := range fn.Type.Result {
-		kind := em.typ(out.Type).Kind()
-		reg := em.fb.newRegister(kind)
+		typ := em.typ(out.Type)
+		reg := em.fb.newRegister(typ.Kind())
 		if out.Ident != nil && !isBlankIdentifier(out.Ident) {
-			em.fb.bindVarReg(out.Ident.Name, reg)
+			em.fb.bindVarReg(out.Ident.Name, reg, typ)
 		}
 	}
 
+	// The receiver of a method is its first input parameter.
+	params := fn.Type.Parameters
+	if fn.Recv != nil {
+		params = append([]*ast.Parameter{fn.Recv}, params...)
+	}
+
 	// Reserve space for the input parameters and eventually bind them.
-	for i, inParam := range fn.Type.Parameters {
+	for i, inParam := range params {
 		kind := em.typ(inParam.Type).Kind()
-		if fn.Type.IsVariadic && i == len(fn.Type.Parameters)-1 {
+		if fn.Type.IsVariadic && i == len(params)-1 {
 			kind = reflect.Slice
 		}
 		if inParam.Ident == nil || isBlankIdentifier(inParam.Ident) {
@@ -522,7 +815,7 @@ func (em *emitter) prepareFunctionBodyParameters(fn *ast.Func) {
 			//
 			// Indirect input parameters are handled below.
 			arg := em.fb.newRegister(kind)
-			em.fb.bindVarReg(inParam.Ident.Name, arg)
+			em.fb.bindVarReg(inParam.Ident.Name, arg, em.typ(inParam.Type))
 		}
 	}
 
@@ -532,14 +825,15 @@ func (em *emitter) prepareFunctionBodyParameters(fn *ast.Func) {
 		if out.Ident != nil && em.varStore.mustBeDeclaredAsIndirect(out.Ident) {
 			dst := em.fb.scopeLookup(out.Ident.Name)
 			reg := em.fb.newIndirectRegister()
-			em.fb.emitNew(em.typ(out.Type), -reg)
-			em.fb.bindVarReg(out.Ident.Name, reg)
-			em.fb.fn.FinalRegs = append(em.fb.fn.FinalRegs, [2]int8{-reg, dst})
+			typ := em.typ(out.Type)
+			em.fb.emitNew(typ, -reg)
+			em.fb.bindVarReg(out.Ident.Name, reg, typ)
+			em.fb.fn.FinalRegs = append(em.fb.fn.FinalRegs, [2]int16{-reg, dst})
 		}
 	}
 
 	// Rebind input parameters that should be declared as indirect.
-	for _, param := range fn.Type.Parameters {
+	for _, param := range params {
 		if em.varStore.mustBeDeclaredAsIndirect(param.Ident) {
 			// reg is used only to read input parameters; after copying values
 			// into the indirect register it is not used anymore.
@@ -550,7 +844,7 @@ func (em *emitter) prepareFunctionBodyParameters(fn *ast.Func) {
 			typ := em.typ(param.Type)
 			em.fb.emitNew(typ, -indirect)
 			em.changeRegister(false, reg, indirect, typ, typ)
-			em.fb.bindVarReg(param.Ident.Name, indirect)
+			em.fb.bindVarReg(param.Ident.Name, indirect, typ)
 		}
 
 	}
@@ -561,7 +855,7 @@ func (em *emitter) prepareFunctionBodyParameters(fn *ast.Func) {
 // registers and the reflect types of the returned values.
 // goStmt indicates if the call node belongs to a 'go statement', while
 // deferStmt reports whether it must be deferred.
-func (em *emitter) emitCallNode(call *ast.Call, goStmt bool, deferStmt bool, toFormat ast.Format) ([]int8, []reflect.Type) {
+func (em *emitter) emitCallNode(call *ast.Call, goStmt bool, deferStmt bool, toFormat ast.Format) ([]int16, []reflect.Type) {
 
 	funTi := em.ti(call.Func)
 
@@ -579,25 +873,44 @@ func (em *emitter) emitCallNode(call *ast.Call, goStmt bool, deferStmt bool, toF
 		name := call.Func.(*ast.Selector).Ident
 		s := em.fb.makeStringValue(name)
 		em.fb.emitMethodValue(s, rcvr, method, call.Func.Pos())
-		call.Args = append([]ast.Expression{rcvrExpr}, call.Args...)
+		// The method value has the receiver bound, so it is called as an
+		// indirect function.
 		stackShift := em.fb.currentStackShift()
-		opts := callOptions{
-			predefined:    true,
-			receiverAsArg: true,
-			callHasDots:   call.IsVariadic,
-		}
+		opts := callOptions{predefined: false, callHasDots: call.IsVariadic}
 		regs, types := em.prepareCallParameters(funTi.Type, call.Args, opts)
-		// TODO(Gianluca): handle variadic method calls.
 		if goStmt {
 			em.fb.emitGo()
 		}
 		if deferStmt {
-			panic(internalError("not implemented"))
+			args := stackDifference(em.fb.currentStackShift(), stackShift)
+			em.fb.emitDefer(method, int8(runtime.NoVariadicArgs), stackShift, args, funTi.Type)
+			return regs, types
 		}
-		em.fb.emitCallIndirect(method, 0, stackShift, call.Pos(), funTi.Type, toFormat)
+		em.fb.emitCallIndirect(method, int8(runtime.NoVariadicArgs), stackShift, call.Pos(), funTi.Type, toFormat)
 		return regs, types
 	}
 
+	// Call of a method declared in Scriggo.
+	if funTi.MethodType == methodCallScriggo {
+		fn := funTi.value.(*types.Method).Func
+		args := append([]ast.Expression{call.Func.(*ast.Selector).Expr}, call.Args...)
+		stackShift := em.fb.currentStackShift()
+		regs, typs := em.prepareCallParameters(funTi.Type, args, callOptions{receiverAsArg: true, callHasDots: call.IsVariadic})
+		index := em.fnStore.scriggoFnIndex(fn)
+		if goStmt {
+			em.fb.emitGo()
+		}
+		if deferStmt {
+			args := stackDifference(em.fb.currentStackShift(), stackShift)
+			reg := em.fb.newRegister(reflect.Func)
+			em.fb.emitLoadFunc(false, index, reg)
+			em.fb.emitDefer(reg, runtime.NoVariadicArgs, stackShift, args, fn.Type)
+			return regs, typs
+		}
+		em.fb.emitCallFunc(index, stackShift, call.Pos())
+		return regs, typs
+	}
+
 	// Predefined function (identifiers, selectors etc...).
 	// Calls of predefined functions stored in builtin variables are handled as
 	// common "indirect" calls.
@@ -714,7 +1027,7 @@ func (em *emitter) emitCallNode(call *ast.Call, goStmt bool, deferStmt bool, toF
 
 // emitBuiltin emits instructions for a builtin call, writing the result, if
 // necessary, into the register reg.
-func (em *emitter) emitBuiltin(call *ast.Call, reg int8, dstType reflect.Type) {
+func (em *emitter) emitBuiltin(call *ast.Call, reg int16, dstType reflect.Type) {
 	args := call.Args
 	switch call.Func.(*ast.Identifier).Name {
 	case "append":
@@ -739,7 +1052,7 @@ func (em *emitter) emitBuiltin(call *ast.Call, reg int8, dstType reflect.Type) {
 		em.fb.enterStack()
 		tmp := em.fb.newRegister(sliceType.Kind())
 		em.changeRegister(false, slice, tmp, sliceType, sliceType)
-		elems := []int8{}
+		elems := []int16{}
 		for _, argExpr := range args[1:] {
 			elem := em.fb.newRegister(sliceType.Elem().Kind())
 			em.fb.enterStack()
@@ -749,7 +1062,7 @@ func (em *emitter) emitBuiltin(call *ast.Call, reg int8, dstType reflect.Type) {
 		}
 		// TODO(Gianluca): if len(appendArgs) > 255 split in blocks
 		if len(elems) > 0 {
-			em.fb.emitAppend(elems[0], elems[0]+int8(len(elems)), tmp, sliceType.Elem().Kind())
+			em.fb.emitAppend(elems[0], elems[0]+int16(len(elems)), tmp, sliceType.Elem().Kind())
 		}
 		em.changeRegister(false, tmp, reg, sliceType, dstType)
 		em.fb.exitStack()
@@ -822,6 +1135,15 @@ func (em *emitter) emitBuiltin(call *ast.Call, reg int8, dstType reflect.Type) {
 		em.fb.exitStack()
 	case "make":
 		typ := em.typ(args[0])
+		if !canEmitDirectly(typ.Kind(), dstType.Kind()) {
+			// The value must be typified, as it could have methods.
+			em.fb.enterStack()
+			tmp := em.fb.newRegister(typ.Kind())
+			em.emitBuiltin(call, tmp, typ)
+			em.changeRegister(false, tmp, reg, typ, dstType)
+			em.fb.exitStack()
+			return
+		}
 		switch typ.Kind() {
 		case reflect.Map:
 			if len(args) == 1 {
@@ -834,7 +1156,7 @@ func (em *emitter) emitBuiltin(call *ast.Call, reg int8, dstType reflect.Type) {
 			lenExpr := args[1]
 			lenn, kLen := em.emitExprK(lenExpr, intType)
 			var kCap bool
-			var capp int8
+			var capp int16
 			if len(args) == 3 {
 				capArg := args[2]
 				capp, kCap = em.emitExprK(capArg, intType)
@@ -845,7 +1167,7 @@ func (em *emitter) emitBuiltin(call *ast.Call, reg int8, dstType reflect.Type) {
 			em.fb.emitMakeSlice(kLen, kCap, typ, lenn, capp, reg, call.Pos())
 		case reflect.Chan:
 			var kCapacity bool
-			var capacity int8
+			var capacity int16
 			if len(args) == 1 {
 				capacity = 0
 				kCapacity = true
@@ -858,6 +1180,16 @@ func (em *emitter) emitBuiltin(call *ast.Call, reg int8, dstType reflect.Type) {
 			panic(internalError("unexpected type %s", typ))
 		}
 	case "new":
+		if !canEmitDirectly(reflect.Ptr, dstType.Kind()) {
+			// The pointer must be typified, as it could have methods.
+			typ := em.typ(call)
+			em.fb.enterStack()
+			tmp := em.fb.newRegister(reflect.Ptr)
+			em.fb.emitNew(em.typ(args[0]), tmp)
+			em.changeRegister(false, tmp, reg, typ, dstType)
+			em.fb.exitStack()
+			return
+		}
 		em.fb.emitNew(em.typ(args[0]), reg)
 	case "panic":
 		arg := em.emitExpr(args[0], emptyInterfaceType)
@@ -894,7 +1226,7 @@ func (em *emitter) emitBuiltin(call *ast.Call, reg int8, dstType reflect.Type) {
 				if i > 0 {
 					str := em.fb.makeStringValue(" ")
 					sep := em.fb.newRegister(reflect.Interface)
-					em.changeRegister(true, str, sep, stringType, emptyInterfaceType)
+					em.changeRegister(true, int16(str), sep, stringType, emptyInterfaceType)
 					em.fb.emitPrint(sep)
 				}
 				if canEmitDirectly(argTypes[i].Kind(), reflect.Interface) {
@@ -914,7 +1246,7 @@ func (em *emitter) emitBuiltin(call *ast.Call, reg int8, dstType reflect.Type) {
 					em.fb.enterStack()
 					str := em.fb.makeStringValue(" ")
 					sep := em.fb.newRegister(reflect.Interface)
-					em.changeRegister(true, str, sep, stringType, emptyInterfaceType)
+					em.changeRegister(true, int16(str), sep, stringType, emptyInterfaceType)
 					em.fb.emitPrint(sep)
 					em.fb.exitStack()
 				}
@@ -927,7 +1259,7 @@ func (em *emitter) emitBuiltin(call *ast.Call, reg int8, dstType reflect.Type) {
 		em.fb.enterStack()
 		str := em.fb.makeStringValue("\n")
 		sep := em.fb.newRegister(reflect.Interface)
-		em.changeRegister(true, str, sep, stringType, emptyInterfaceType)
+		em.changeRegister(true, int16(str), sep, stringType, emptyInterfaceType)
 		em.fb.emitPrint(sep)
 		em.fb.exitStack()
 	case "real", "imag":
@@ -986,7 +1318,7 @@ func (em *emitter) emitCondition(cond ast.Expression) {
 	if ti := em.ti(cond); ti != nil && ti.HasValue() && !ti.IsNative() {
 		// The condition of the 'if' instruction of VM is a binary operation,
 		// so the boolean constant expression 'x' is emitted as 'x == true'.
-		var c int8 = 0
+		var c int16 = 0
 		if ti.value.(int64) == 1 {
 			c = 1
 		}
@@ -1166,7 +1498,7 @@ func (em *emitter) emitCondition(cond ast.Expression) {
 
 // emitComplexOperation emits the operation on the given complex numbers putting
 // the result into the given register.
-func (em *emitter) emitComplexOperation(exprType reflect.Type, expr1 ast.Expression, op ast.OperatorType, expr2 ast.Expression, reg int8, dstType reflect.Type) {
+func (em *emitter) emitComplexOperation(exprType reflect.Type, expr1 ast.Expression, op ast.OperatorType, expr2 ast.Expression, reg int16, dstType reflect.Type) {
 	stackShift := em.fb.currentStackShift()
 	em.fb.enterScope()
 	index := em.fb.complexOperationIndex(op, false)
@@ -18,7 +18,7 @@ type address struct {
 	em            *emitter           // a reference to the current emitter.
 	target        assignmentTarget   // target of the assignment.
 	addressedType reflect.Type       // type of the addressed type (see the methods below).
-	op1, op2      int8               // two bytes for store addressing information (see the methods below).
+	op1, op2      int16              // two values for store addressing information (see the methods below).
 	pos           *ast.Position      // position of the addressed element in the source code.
 	operator      ast.AssignmentType // type of the assignment that involves this address.
 	nonLocal      int                // index of non-local vars. Not relevant if the assignment happens locally.
@@ -64,7 +64,7 @@ func (em *emitter) addressBlankIdent(pos *ast.Position) address {
 // the given type that is stored in reg.
 // op is the type of the assignment that involves this address, and pos is the
 // position of the assignment in the source code.
-func (em *emitter) addressLocalVar(reg int8, typ reflect.Type, pos *ast.Position, op ast.AssignmentType) address {
+func (em *emitter) addressLocalVar(reg int16, typ reflect.Type, pos *ast.Position, op ast.AssignmentType) address {
 	return address{
 		addressedType: typ,
 		em:            em,
@@ -94,7 +94,7 @@ func (em *emitter) addressNonLocalVar(index int, typ reflect.Type, pos *ast.Posi
 // expression, with the map and key stored into the given registers. op is the
 // type of the assignment that involves this address, and pos is the position
 // of the assignment in the source code.
-func (em *emitter) addressLocalMapIndex(mapReg int8, keyReg int8, mapType reflect.Type, pos *ast.Position, op ast.AssignmentType) address {
+func (em *emitter) addressLocalMapIndex(mapReg int16, keyReg int16, mapType reflect.Type, pos *ast.Position, op ast.AssignmentType) address {
 	return address{
 		addressedType: mapType,
 		em:            em,
@@ -111,7 +111,7 @@ func (em *emitter) addressLocalMapIndex(mapReg int8, keyReg int8, mapType reflec
 // registers. nonLocalMap refers to the index of the non-local map. op is the
 // type of the assignment that involves this address, and pos is the position
 // of the assignment in the source code.
-func (em *emitter) addressNonLocalMapIndex(nonLocalMap int, mapReg int8, keyReg int8, mapType reflect.Type, pos *ast.Position, op ast.AssignmentType) address {
+func (em *emitter) addressNonLocalMapIndex(nonLocalMap int, mapReg int16, keyReg int16, mapType reflect.Type, pos *ast.Position, op ast.AssignmentType) address {
 	return address{
 		addressedType: mapType,
 		em:            em,
@@ -128,7 +128,7 @@ func (em *emitter) addressNonLocalMapIndex(nonLocalMap int, mapReg int8, keyReg
 // declared as 'indirect' that is going to be stored at the given register.
 // op is the type of the assignment that involves this address, and pos is the
 // position of the assignment in the source code.
-func (em *emitter) addressNewIndirectVar(reg int8, typ reflect.Type, pos *ast.Position, op ast.AssignmentType) address {
+func (em *emitter) addressNewIndirectVar(reg int16, typ reflect.Type, pos *ast.Position, op ast.AssignmentType) address {
 	return address{
 		addressedType: typ,
 		em:            em,
@@ -143,7 +143,7 @@ func (em *emitter) addressNewIndirectVar(reg int8, typ reflect.Type, pos *ast.Po
 // indirection. reg contains the pointed value, and pointedType is its type.
 // op is the type of the assignment that involves this address, and pos is the
 // position of the assignment in the source code.
-func (em *emitter) addressPtrIndirect(reg int8, pointedType reflect.Type, pos *ast.Position, op ast.AssignmentType) address {
+func (em *emitter) addressPtrIndirect(reg int16, pointedType reflect.Type, pos *ast.Position, op ast.AssignmentType) address {
 	return address{
 		addressedType: pointedType,
 		em:            em,
@@ -159,7 +159,7 @@ func (em *emitter) addressPtrIndirect(reg int8, pointedType reflect.Type, pos *a
 // the slice and indexReg is the register that holds the index of the slice. op
 // is the type of the assignment that involves this address, and pos is the
 // position of the assignment in the source code.
-func (em *emitter) addressSliceIndex(sliceReg int8, indexReg int8, sliceType reflect.Type, pos *ast.Position, op ast.AssignmentType) address {
+func (em *emitter) addressSliceIndex(sliceReg int16, indexReg int16, sliceType reflect.Type, pos *ast.Position, op ast.AssignmentType) address {
 	return address{
 		addressedType: sliceType,
 		em:            em,
@@ -177,7 +177,7 @@ func (em *emitter) addressSliceIndex(sliceReg int8, indexReg int8, sliceType ref
 // slice. sliceIndex is the index of the non-local slice. op is the type of the
 // assignment that involves this address, and pos is the position of the
 // assignment in the source code.
-func (em *emitter) addressGlobalSliceIndex(sliceIndex int, sliceReg int8, indexReg int8, sliceType reflect.Type, pos *ast.Position, op ast.AssignmentType) address {
+func (em *emitter) addressGlobalSliceIndex(sliceIndex int, sliceReg int16, indexReg int16, sliceType reflect.Type, pos *ast.Position, op ast.AssignmentType) address {
 	return address{
 		addressedType: sliceType,
 		em:            em,
@@ -196,7 +196,7 @@ func (em *emitter) addressGlobalSliceIndex(sliceIndex int, sliceReg int8, indexR
 // encoded slice of the field index. op is the type of the assignment that
 // involves this address, and pos is the position of the assignment in the
 // source code.
-func (em *emitter) addressLocalStructSelector(structReg int8, kFieldIndex int8, structType reflect.Type, pos *ast.Position, op ast.AssignmentType) address {
+func (em *emitter) addressLocalStructSelector(structReg int16, kFieldIndex int16, structType reflect.Type, pos *ast.Position, op ast.AssignmentType) address {
 	return address{
 		addressedType: structType,
 		em:            em,
@@ -214,7 +214,7 @@ func (em *emitter) addressLocalStructSelector(structReg int8, kFieldIndex int8,
 // index of the integer constant that contains the encoded slice of the field
 // index. op is the type of the assignment that involves this address, and pos
 // is the position of the assignment in the source code.
-func (em *emitter) addressNonLocalStructSelector(structIndex int, localStructReg int8, kFieldIndex int8, structType reflect.Type, pos *ast.Position, op ast.AssignmentType) address {
+func (em *emitter) addressNonLocalStructSelector(structIndex int, localStructReg int16, kFieldIndex int16, structType reflect.Type, pos *ast.Position, op ast.AssignmentType) address {
 	return address{
 		addressedType: structType,
 		em:            em,
@@ -229,7 +229,7 @@ func (em *emitter) addressNonLocalStructSelector(structIndex int, localStructReg
 
 // assign assigns value, with type valueType, to the address. If k is true
 // value is a constant otherwise is a register.
-func (a address) assign(k bool, value int8, valueType reflect.Type) {
+func (a address) assign(k bool, value int16, valueType reflect.Type) {
 	switch a.target {
 	case assignNonLocalVar:
 		a.em.fb.emitSetVar(k, value, a.nonLocal, a.addressedType.Kind())
@@ -253,9 +253,9 @@ func (a address) assign(k bool, value int8, valueType reflect.Type) {
 		a.em.fb.emitSetMap(k, a.op1, value, a.op2, a.addressedType, a.pos)
 		a.em.fb.emitSetVar(false, a.op1, a.nonLocal, a.addressedType.Kind())
 	case assignLocalStructSelector:
-		a.em.fb.emitSetField(k, a.op1, a.op2, value, valueType.Kind())
+		a.em.fb.emitSetField(k, a.op1, int8(a.op2), value, valueType.Kind())
 	case assignNonLocalStructSelector:
-		a.em.fb.emitSetField(k, a.op1, a.op2, value, valueType.Kind())
+		a.em.fb.emitSetField(k, a.op1, int8(a.op2), value, valueType.Kind())
 		a.em.fb.emitSetVar(false, a.op1, a.nonLocal, a.addressedType.Kind())
 	}
 }
@@ -320,10 +320,10 @@ func (em *emitter) emitAssignmentOperation(addr address, rh ast.Expression) {
 		assignNonLocalSliceIndex:
 		em.fb.emitIndex(false, addr.op1, addr.op2, c, addrTyp, addr.pos, false)
 	case assignPtrIndirection:
-		em.changeRegister(false, addr.op1, c, addrTyp, addrTyp)
+		em.changeRegister(false, -addr.op1, c, typ, typ)
 	case assignLocalStructSelector,
 		assignNonLocalStructSelector:
-		em.fb.emitField(addr.op1, addr.op2, c, typ.Kind())
+		em.fb.emitField(addr.op1, int8(addr.op2), c, typ.Kind())
 	}
 
 	// Emit the code that evaluates the right side of the assignment.
@@ -407,7 +407,7 @@ func (em *emitter) assignValuesToAddresses(addresses []address, values []ast.Exp
 
 	if len(addresses) == len(values) {
 		em.fb.enterStack()
-		regs := make([]int8, len(values))
+		regs := make([]int16, len(values))
 		types := make([]reflect.Type, len(values))
 		ks := make([]bool, len(values))
 		for i := range values {
@@ -455,7 +455,7 @@ func (em *emitter) assignValuesToAddresses(addresses []address, values []ast.Exp
 		okType := addresses[1].addressedType
 		okReg := em.fb.newRegister(reflect.Bool)
 		pos := valueExpr.Pos()
-		em.fb.emitIndex(true, expr, key, value, exprType, pos, false)
+		em.fb.emitIndex(true, expr, int16(key), value, exprType, pos, false)
 		em.fb.emitMove(true, 1, okReg, reflect.Bool)
 		em.fb.emitIf(false, 0, runtime.ConditionOK, 0, reflect.Interface, pos)
 		em.fb.emitMove(true, 0, okReg, reflect.Bool)
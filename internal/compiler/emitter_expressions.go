@@ -10,25 +10,26 @@ import (
 	"reflect"
 
 	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/internal/compiler/types"
 	"github.com/open2b/scriggo/internal/runtime"
 )
 
 // emitExpr emits expr into a register of a given type. emitExpr tries to not
 // create a new register, but to use an existing one. The register used for
 // emission is returned.
-func (em *emitter) emitExpr(expr ast.Expression, dstType reflect.Type) int8 {
+func (em *emitter) emitExpr(expr ast.Expression, dstType reflect.Type) int16 {
 	reg, _ := em._emitExpr(expr, dstType, 0, false, false)
 	return reg
 }
 
 // emitExprK emits expr into a register of a given type. The boolean return
-// parameter reports whether the returned int8 is a constant or not.
-func (em *emitter) emitExprK(expr ast.Expression, dstType reflect.Type) (int8, bool) {
+// parameter reports whether the returned int16 is a constant or not.
+func (em *emitter) emitExprK(expr ast.Expression, dstType reflect.Type) (int16, bool) {
 	return em._emitExpr(expr, dstType, 0, false, true)
 }
 
 // emitExprR emits expr into register reg with the given type.
-func (em *emitter) emitExprR(expr ast.Expression, dstType reflect.Type, reg int8) {
+func (em *emitter) emitExprR(expr ast.Expression, dstType reflect.Type, reg int16) {
 	_, _ = em._emitExpr(expr, dstType, reg, true, false)
 }
 
@@ -43,11 +44,20 @@ func (em *emitter) emitExprR(expr ast.Expression, dstType reflect.Type, reg int8
 //
 // _emitExpr is an internal support method, and should be called by emitExpr,
 // emitExprK and emitExprR exclusively.
-func (em *emitter) _emitExpr(expr ast.Expression, dstType reflect.Type, reg int8, useGivenReg bool, allowK bool) (int8, bool) {
+func (em *emitter) _emitExpr(expr ast.Expression, dstType reflect.Type, reg int16, useGivenReg bool, allowK bool) (int16, bool) {
 
 	// Take the type info of the expression.
 	ti := em.ti(expr)
 
+	// An instantiated generic function is emitted as the function of its
+	// instance.
+	switch expr.(type) {
+	case *ast.Index, *ast.IndexList:
+		if ti != nil && ti.replacement != nil {
+			return em._emitExpr(ti.replacement.(ast.Expression), dstType, reg, useGivenReg, allowK)
+		}
+	}
+
 	// No need to use the given register: check if expr can be emitted without
 	// allocating a new one.
 	if !useGivenReg {
@@ -57,13 +67,13 @@ func (em *emitter) _emitExpr(expr ast.Expression, dstType reflect.Type, reg int8
 			case int64:
 				if canEmitDirectly(reflect.Int, dstType.Kind()) {
 					if -128 <= v && v <= 127 {
-						return int8(v), true
+						return int16(v), true
 					}
 				}
 			case float64:
 				if canEmitDirectly(reflect.Float64, dstType.Kind()) {
 					if math.Floor(v) == v && -128 <= v && v <= 127 {
-						return int8(v), true
+						return int16(v), true
 					}
 				}
 			}
@@ -191,23 +201,27 @@ func (em *emitter) _emitExpr(expr ast.Expression, dstType reflect.Type, reg int8
 			return reg, false
 		}
 
-		var tmp int8
+		var tmp int16
 		if canEmitDirectly(reflect.Func, dstType.Kind()) {
 			tmp = reg
 		} else {
 			tmp = em.fb.newRegister(reflect.Func)
 		}
 		fn := &runtime.Function{
-			Pkg:    em.fb.fn.Pkg,
-			File:   em.fb.fn.File,
-			Macro:  expr.Type.Macro,
-			Format: expr.Format,
-			Pos:    convertPosition(expr.Pos()),
-			Type:   ti.Type,
-			Parent: em.fb.fn,
+			Pkg:     em.fb.fn.Pkg,
+			File:    em.fb.fn.File,
+			Macro:   expr.Type.Macro,
+			Format:  expr.Format,
+			Pos:     convertPosition(expr.Pos()),
+			BodyPos: bodyPosition(expr),
+			Type:    ti.Type,
+			Parent:  em.fb.fn,
 		}
 		em.fb.emitLoadFunc(false, em.fb.addFunction(fn), tmp)
 		em.setFunctionVarRefs(fn, expr.Upvars)
+		if name, ok := em.templateMacroLits[expr]; ok {
+			em.templateMacros[name] = fn
+		}
 
 		funcLitBuilder := newBuilder(fn, em.fb.getPath())
 		currFB := em.fb
@@ -275,7 +289,7 @@ func (em *emitter) _emitExpr(expr ast.Expression, dstType reflect.Type, reg int8
 
 		exprType := em.typ(expr.Expr)
 		src := em.emitExpr(expr.Expr, exprType)
-		var low, high int8 = 0, -1
+		var low, high int16 = 0, -1
 		var kLow, kHigh = true, true
 		// emit low
 		if expr.Low != nil {
@@ -298,7 +312,7 @@ func (em *emitter) _emitExpr(expr ast.Expression, dstType reflect.Type, reg int8
 			}
 		} else {
 			// If necessary, emit max.
-			var max int8 = -1
+			var max int16 = -1
 			var kMax = true
 			if expr.Max != nil {
 				max, kMax = em.emitExprK(expr.Max, em.typ(expr.Max))
@@ -331,7 +345,7 @@ func (em *emitter) _emitExpr(expr ast.Expression, dstType reflect.Type, reg int8
 
 // emitBinaryOp emits the code for the binary expression expr and stores the
 // result in the register reg of type regType.
-func (em *emitter) emitBinaryOp(expr *ast.BinaryOperator, reg int8, regType reflect.Type) {
+func (em *emitter) emitBinaryOp(expr *ast.BinaryOperator, reg int16, regType reflect.Type) {
 
 	var (
 		ti   = em.ti(expr)
@@ -350,7 +364,7 @@ func (em *emitter) emitBinaryOp(expr *ast.BinaryOperator, reg int8, regType refl
 	// Emit code for the operators && and ||.
 	if op == ast.OperatorAnd || op == ast.OperatorOr {
 		x := reg
-		y := int8(0)
+		y := int16(0)
 		direct := canEmitDirectly(regType.Kind(), reflect.Bool)
 		if !direct {
 			em.fb.enterStack()
@@ -529,7 +543,7 @@ func (em *emitter) emitBinaryOp(expr *ast.BinaryOperator, reg int8, regType refl
 
 }
 
-func (em *emitter) emitCompositeLiteral(expr *ast.CompositeLiteral, reg int8, dstType reflect.Type) (int8, bool) {
+func (em *emitter) emitCompositeLiteral(expr *ast.CompositeLiteral, reg int16, dstType reflect.Type) (int16, bool) {
 	typ := em.typ(expr.Type)
 	switch typ.Kind() {
 	case reflect.Slice, reflect.Array:
@@ -553,7 +567,7 @@ func (em *emitter) emitCompositeLiteral(expr *ast.CompositeLiteral, reg int8, ds
 				em.fb.emitLoad(em.fb.makeIntValue(int64(length)), r, reflect.Int)
 				length = int(r)
 			}
-			em.fb.emitMakeSlice(k, k, typ, int8(length), int8(length), workingReg, expr.Pos())
+			em.fb.emitMakeSlice(k, k, typ, int16(length), int16(length), workingReg, expr.Pos())
 		} else {
 			em.fb.emitMakeArray(typ, workingReg)
 		}
@@ -585,7 +599,7 @@ func (em *emitter) emitCompositeLiteral(expr *ast.CompositeLiteral, reg int8, ds
 			if index > 127 {
 				em.fb.emitLoad(em.fb.makeIntValue(index), indexReg, reflect.Int)
 			} else {
-				em.fb.emitMove(true, int8(index), indexReg, reflect.Int)
+				em.fb.emitMove(true, int16(index), indexReg, reflect.Int)
 			}
 			elem, k := em.emitExprK(kv.Value, typ.Elem())
 			if workingReg != 0 {
@@ -620,7 +634,7 @@ func (em *emitter) emitCompositeLiteral(expr *ast.CompositeLiteral, reg int8, ds
 		}
 		// Assign key-value pairs to the struct fields.
 		em.fb.enterStack()
-		var structt int8
+		var structt int16
 		if canEmitDirectly(typ.Kind(), dstType.Kind()) {
 			structt = em.fb.newRegister(reflect.Struct)
 		} else {
@@ -659,7 +673,7 @@ func (em *emitter) emitCompositeLiteral(expr *ast.CompositeLiteral, reg int8, ds
 		tmp := em.fb.newRegister(reflect.Map)
 		size := len(expr.KeyValues)
 		if size <= 127 {
-			em.fb.emitMakeMap(typ, true, int8(size), tmp)
+			em.fb.emitMakeMap(typ, true, int16(size), tmp)
 		} else {
 			index := em.fb.makeIntValue(int64(size))
 			sizeReg := em.fb.newRegister(reflect.Int)
@@ -680,7 +694,7 @@ func (em *emitter) emitCompositeLiteral(expr *ast.CompositeLiteral, reg int8, ds
 }
 
 // emitIndex emits an index in register reg.
-func (em *emitter) emitIndex(v *ast.Index, reg int8, dstType reflect.Type) {
+func (em *emitter) emitIndex(v *ast.Index, reg int16, dstType reflect.Type) {
 	exprType := em.typ(v.Expr)
 	exprReg := em.emitExpr(v.Expr, exprType)
 	var indexType reflect.Type
@@ -697,19 +711,23 @@ func (em *emitter) emitIndex(v *ast.Index, reg int8, dstType reflect.Type) {
 		elemType = exprType.Elem()
 	}
 	pos := v.Pos()
+	// The index of a slice proved to be within the bounds, see the
+	// proveIndexes method, is read with an Index instruction that reads the
+	// most common element types without reflection.
+	ref := !em.provedIndexes[v] || exprType.Kind() != reflect.Slice
 	if canEmitDirectly(elemType.Kind(), dstType.Kind()) {
-		em.fb.emitIndex(kindex, exprReg, index, reg, exprType, pos, true)
+		em.fb.emitIndex(kindex, exprReg, index, reg, exprType, pos, ref)
 		return
 	}
 	em.fb.enterStack()
 	tmp := em.fb.newRegister(elemType.Kind())
-	em.fb.emitIndex(kindex, exprReg, index, tmp, exprType, pos, true)
+	em.fb.emitIndex(kindex, exprReg, index, tmp, exprType, pos, ref)
 	em.changeRegister(false, tmp, reg, elemType, dstType)
 	em.fb.exitStack()
 }
 
 // emitSelector emits selector in register reg.
-func (em *emitter) emitSelector(v *ast.Selector, reg int8, dstType reflect.Type) {
+func (em *emitter) emitSelector(v *ast.Selector, reg int16, dstType reflect.Type) {
 
 	ti := em.ti(v)
 
@@ -722,7 +740,7 @@ func (em *emitter) emitSelector(v *ast.Selector, reg int8, dstType reflect.Type)
 			pos := v.Pos()
 			em.fb.enterStack()
 			dst := em.fb.newRegister(reflect.Interface)
-			em.fb.emitIndex(true, exprReg, keyReg, dst, typ, pos, false)
+			em.fb.emitIndex(true, exprReg, int16(keyReg), dst, typ, pos, false)
 			em.changeRegister(false, dst, reg, typ, dstType)
 			em.fb.exitStack()
 			return
@@ -752,6 +770,35 @@ func (em *emitter) emitSelector(v *ast.Selector, reg int8, dstType reflect.Type)
 		return
 	}
 
+	// Method value of a method declared in Scriggo.
+	if ti.MethodType == methodValueScriggo {
+		expr := v.Expr
+		typ := em.typ(expr)
+		rcvr := em.fb.newRegister(typ.Kind())
+		em.emitExprR(expr, typ, rcvr)
+		// The receiver is wrapped, so MethodValue can find the method from
+		// its type.
+		wrapped := em.fb.newRegister(reflect.Interface)
+		em.fb.emitTypify(false, typ, rcvr, wrapped)
+		if kindToType(dstType.Kind()) != generalRegister {
+			panic(internalError("not implemented"))
+		}
+		s := em.fb.makeStringValue(v.Ident)
+		em.fb.emitMethodValue(s, wrapped, reg, v.Pos())
+		return
+	}
+
+	// Method expression of a method declared in Scriggo.
+	if ti.MethodType == methodExprScriggo {
+		if reg == 0 {
+			return
+		}
+		index := em.fnStore.scriggoFnIndex(ti.value.(*types.Method).Func)
+		em.fb.emitLoadFunc(false, index, reg)
+		em.changeRegister(false, reg, reg, ti.Type, dstType)
+		return
+	}
+
 	// Predefined package variable or imported package variable.
 	if index, ok := em.varStore.nonLocalVarIndex(v); ok {
 		if reg == 0 {
@@ -807,7 +854,7 @@ func (em *emitter) emitSelector(v *ast.Selector, reg int8, dstType reflect.Type)
 
 // emitUnaryOp emits the code for the unary expression expr and stores the
 // result in the register reg of type regType.
-func (em *emitter) emitUnaryOp(expr *ast.UnaryOperator, reg int8, regType reflect.Type) {
+func (em *emitter) emitUnaryOp(expr *ast.UnaryOperator, reg int16, regType reflect.Type) {
 
 	var (
 		exprType    = em.typ(expr)
@@ -901,6 +948,12 @@ func (em *emitter) emitUnaryOp(expr *ast.UnaryOperator, reg int8, regType reflec
 	// *operand
 	case ast.OperatorPointer:
 		exprReg := em.emitExpr(operand, operandType)
+		if exprReg < 0 {
+			// The operand is an indirect variable.
+			r := em.fb.newRegister(operandType.Kind())
+			em.fb.emitMove(false, exprReg, r, operandType.Kind())
+			exprReg = r
+		}
 		if canEmitDirectly(exprType.Kind(), regType.Kind()) {
 			em.changeRegister(false, -exprReg, reg, operandType.Elem(), regType)
 			return
@@ -917,8 +970,16 @@ func (em *emitter) emitUnaryOp(expr *ast.UnaryOperator, reg int8, regType reflec
 		case *ast.Identifier:
 			if em.fb.declaredInFunc(operand.Name) {
 				r := em.fb.scopeLookup(operand.Name)
-				em.fb.emitNew(em.types.PtrTo(exprType), reg)
-				em.fb.emitMove(false, -r, reg, regType.Kind())
+				if canEmitDirectly(exprType.Kind(), regType.Kind()) {
+					em.fb.emitNew(em.types.PtrTo(exprType), reg)
+					em.fb.emitMove(false, -r, reg, regType.Kind())
+					return
+				}
+				em.fb.enterStack()
+				tmp := em.fb.newRegister(reflect.Ptr)
+				em.fb.emitMove(false, -r, tmp, reflect.Ptr)
+				em.changeRegister(false, tmp, reg, exprType, regType)
+				em.fb.exitStack()
 				return
 			}
 			// Address of a non-local variable.
@@ -948,11 +1009,28 @@ func (em *emitter) emitUnaryOp(expr *ast.UnaryOperator, reg int8, regType reflec
 		// &v[i]
 		// (where v is a slice or an addressable array)
 		case *ast.Index:
-			expr := em.emitExpr(operand.Expr, em.typ(operand.Expr))
+			var expr int16
+			if em.typ(operand.Expr).Kind() == reflect.Array {
+				// Get a pointer to the array if it is a non-local variable,
+				// or if it is a dereferenced pointer, as their values are
+				// copies of the arrays.
+				ident, isIdent := operand.Expr.(*ast.Identifier)
+				isLocal := isIdent && em.fb.declaredInFunc(ident.Name)
+				if index, ok := em.varStore.nonLocalVarIndex(operand.Expr); ok && !isLocal {
+					expr = em.fb.newRegister(reflect.Ptr)
+					em.fb.emitGetVarAddr(index, expr)
+				} else if op, ok := operand.Expr.(*ast.UnaryOperator); ok && op.Op == ast.OperatorPointer {
+					expr = em.emitExpr(op.Expr, em.typ(op.Expr))
+				}
+			}
+			if expr == 0 {
+				expr = em.emitExpr(operand.Expr, em.typ(operand.Expr))
+			}
 			index := em.emitExpr(operand.Index, intType)
 			pos := operand.Expr.Pos()
 			if canEmitDirectly(exprType.Kind(), regType.Kind()) {
 				em.fb.emitAddr(expr, index, reg, pos)
+				return
 			}
 			em.fb.enterStack()
 			dest := em.fb.newRegister(exprType.Kind())
@@ -988,12 +1066,12 @@ func (em *emitter) emitUnaryOp(expr *ast.UnaryOperator, reg int8, regType reflec
 			index := em.fb.makeFieldIndex(field.Index)
 			pos := operand.Expr.Pos()
 			if canEmitDirectly(em.types.PtrTo(field.Type).Kind(), regType.Kind()) {
-				em.fb.emitAddr(exprReg, index, reg, pos)
+				em.fb.emitAddr(exprReg, int16(index), reg, pos)
 				return
 			}
 			em.fb.enterStack()
 			dest := em.fb.newRegister(reflect.Ptr)
-			em.fb.emitAddr(exprReg, index, dest, pos)
+			em.fb.emitAddr(exprReg, int16(index), dest, pos)
 			em.changeRegister(false, dest, reg, em.types.PtrTo(field.Type), regType)
 			em.fb.exitStack()
 
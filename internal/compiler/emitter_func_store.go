@@ -26,11 +26,11 @@ type functionStore struct {
 
 	// scriggoFuncIndexes holds the indexes of the Scriggo functions that have
 	// been added to Functions because they are referenced in the Scriggo code.
-	scriggoFuncIndexes map[*runtime.Function]map[*runtime.Function]int8
+	scriggoFuncIndexes map[*runtime.Function]map[*runtime.Function]int16
 
 	// predefFuncIndexes holds the indexes of the predefined functions that have
 	// been added to Predefined because they are referenced in the Scriggo code.
-	predefFuncIndexes map[*runtime.Function]map[reflect.Value]int8
+	predefFuncIndexes map[*runtime.Function]map[reflect.Value]int16
 }
 
 // newFunctionStore returns a new functionStore.
@@ -38,8 +38,8 @@ func newFunctionStore(emitter *emitter) *functionStore {
 	return &functionStore{
 		emitter:               emitter,
 		availableScriggoFuncs: map[*ast.Package]map[string]*runtime.Function{},
-		scriggoFuncIndexes:    map[*runtime.Function]map[*runtime.Function]int8{},
-		predefFuncIndexes:     map[*runtime.Function]map[reflect.Value]int8{},
+		scriggoFuncIndexes:    map[*runtime.Function]map[*runtime.Function]int16{},
+		predefFuncIndexes:     map[*runtime.Function]map[reflect.Value]int16{},
 	}
 }
 
@@ -63,23 +63,22 @@ func (fs *functionStore) availableScriggoFn(pkg *ast.Package, name string) (*run
 // scriggoFnIndex returns the index of the given Scriggo function inside the
 // Functions slice of the current function. If fun is not present in such slice
 // it is added by this call.
-func (fs *functionStore) scriggoFnIndex(fn *runtime.Function) int8 {
+func (fs *functionStore) scriggoFnIndex(fn *runtime.Function) int16 {
 	currFn := fs.emitter.fb.fn
 	if fs.scriggoFuncIndexes[currFn] == nil {
-		fs.scriggoFuncIndexes[currFn] = map[*runtime.Function]int8{}
+		fs.scriggoFuncIndexes[currFn] = map[*runtime.Function]int16{}
 	}
 	if index, ok := fs.scriggoFuncIndexes[currFn][fn]; ok {
 		return index
 	}
-	index := int8(len(currFn.Functions))
-	currFn.Functions = append(currFn.Functions, fn)
+	index := fs.emitter.fb.addFunction(fn)
 	fs.scriggoFuncIndexes[currFn][fn] = index
 	return index
 }
 
 // predefFunc returns the index of the predefined function 'contained' in fn if
 // there's one, else returns 0 and false.
-func (fs *functionStore) predefFunc(fn ast.Expression, allowMethod bool) (int8, bool) {
+func (fs *functionStore) predefFunc(fn ast.Expression, allowMethod bool) (int16, bool) {
 	ti := fs.emitter.ti(fn)
 	if (ti == nil) || (!ti.IsNative()) {
 		return 0, false
@@ -111,16 +110,21 @@ func (fs *functionStore) predefFunc(fn ast.Expression, allowMethod bool) (int8,
 	fnRv := ti.value.(reflect.Value)
 	currFn := fs.emitter.fb.fn
 	if fs.predefFuncIndexes[currFn] == nil {
-		fs.predefFuncIndexes[currFn] = map[reflect.Value]int8{}
+		fs.predefFuncIndexes[currFn] = map[reflect.Value]int16{}
 	}
 	if index, ok := fs.predefFuncIndexes[currFn][fnRv]; ok {
 		return index, true
 	}
-	f := newNativeFunction(ti.NativePackageName, name, fnRv.Interface())
-	index := int8(len(currFn.NativeFunctions))
-	currFn.NativeFunctions = append(currFn.NativeFunctions, f)
+	var f *runtime.NativeFunction
+	if ti.MethodType == methodCallConcrete {
+		// The method is called with the receiver as first argument.
+		f = runtime.NewNativeMethod(fnRv.Type().In(0), fn.(*ast.Selector).Ident, fnRv.Interface())
+	} else {
+		f = newNativeFunction(ti.NativePackageName, name, fnRv.Interface())
+	}
+	index := fs.emitter.fb.addNativeFunction(f)
 	if fs.predefFuncIndexes[currFn] == nil {
-		fs.predefFuncIndexes[currFn] = map[reflect.Value]int8{}
+		fs.predefFuncIndexes[currFn] = map[reflect.Value]int16{}
 	}
 	fs.predefFuncIndexes[currFn][fnRv] = index
 	return index, true
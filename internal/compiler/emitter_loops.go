@@ -0,0 +1,187 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"reflect"
+
+	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/ast/astutil"
+)
+
+// forAsRange returns a for range statement equivalent to the for statement
+// node, if node has the form
+//
+//	for i := 0; i < len(s); i++ { ... }
+//
+// where s is a slice in a local variable and the body neither assigns nor
+// declares i and s. It returns nil otherwise.
+//
+// The returned statement is emitted as a Range instruction that, unlike the
+// for statement, does not evaluate len(s) and increment i at every
+// iteration.
+func (em *emitter) forAsRange(node *ast.For) *ast.ForRange {
+	// Check the initialization statement.
+	init, ok := node.Init.(*ast.Assignment)
+	if !ok || init.Type != ast.AssignmentDeclaration || len(init.Lhs) != 1 || len(init.Rhs) != 1 {
+		return nil
+	}
+	i, ok := init.Lhs[0].(*ast.Identifier)
+	if !ok || isBlankIdentifier(i) || em.typ(i) != intType || em.varStore.mustBeDeclaredAsIndirect(i) {
+		return nil
+	}
+	if !em.isIntConstant(init.Rhs[0], 0) {
+		return nil
+	}
+	// Check the condition.
+	cond, ok := node.Condition.(*ast.BinaryOperator)
+	if !ok || cond.Op != ast.OperatorLess {
+		return nil
+	}
+	if ident, ok := cond.Expr1.(*ast.Identifier); !ok || ident.Name != i.Name {
+		return nil
+	}
+	if em.builtinCallName(cond.Expr2) != "len" {
+		return nil
+	}
+	s, ok := cond.Expr2.(*ast.Call).Args[0].(*ast.Identifier)
+	if !ok || s.Name == i.Name || !em.isLocalSlice(s) {
+		return nil
+	}
+	// Check the post statement. The type checker transforms i++ into i += 1.
+	post, ok := node.Post.(*ast.Assignment)
+	if !ok || post.Type != ast.AssignmentAddition || !em.isIntConstant(post.Rhs[0], 1) {
+		return nil
+	}
+	if ident, ok := post.Lhs[0].(*ast.Identifier); !ok || ident.Name != i.Name {
+		return nil
+	}
+	if _, ok := loopInvariant(node.Body, s.Name, i.Name); !ok {
+		return nil
+	}
+	assignment := ast.NewAssignment(init.Pos(), []ast.Expression{i}, ast.AssignmentDeclaration, []ast.Expression{s})
+	return ast.NewForRange(node.Pos(), assignment, node.Body, nil)
+}
+
+// proveIndexes records in em.provedIndexes the index expressions s[i] in the
+// body of the for range statement node, where s is the ranged slice and i is
+// the index declared by node. As neither s nor i are changed in the body,
+// the index i is always within the bounds of s.
+func (em *emitter) proveIndexes(node *ast.ForRange) {
+	if node.Assignment.Type != ast.AssignmentDeclaration || len(node.Assignment.Lhs) == 0 {
+		return
+	}
+	i, ok := node.Assignment.Lhs[0].(*ast.Identifier)
+	if !ok || isBlankIdentifier(i) || em.varStore.mustBeDeclaredAsIndirect(i) {
+		return
+	}
+	s, ok := node.Assignment.Rhs[0].(*ast.Identifier)
+	if !ok || s.Name == i.Name || !em.isLocalSlice(s) {
+		return
+	}
+	if len(node.Assignment.Lhs) == 2 {
+		if e, ok := node.Assignment.Lhs[1].(*ast.Identifier); ok && e.Name == s.Name {
+			return
+		}
+	}
+	indexes, ok := loopInvariant(node.Body, s.Name, i.Name)
+	if !ok {
+		return
+	}
+	for _, index := range indexes {
+		em.provedIndexes[index] = true
+	}
+}
+
+// isIntConstant reports whether expr is a constant with integer value n.
+func (em *emitter) isIntConstant(expr ast.Expression, n int64) bool {
+	ti := em.ti(expr)
+	if ti == nil || !ti.HasValue() {
+		return false
+	}
+	v, ok := ti.value.(int64)
+	return ok && v == n
+}
+
+// isLocalSlice reports whether s is a slice stored in a local variable that
+// is not indirect, and so it cannot be changed by other functions.
+func (em *emitter) isLocalSlice(s *ast.Identifier) bool {
+	if em.typ(s).Kind() != reflect.Slice || !em.fb.declaredInFunc(s.Name) {
+		return false
+	}
+	return em.fb.scopeLookup(s.Name) > 0
+}
+
+// loopInvariant reports whether the variables with names s and i are
+// invariant in the body of a loop, that is whether nodes neither assign nor
+// declare them. If they are invariant, it also returns the index expressions
+// s[i] in nodes.
+//
+// Function literals are not visited, as a variable that a function literal
+// refers to is indirect. Goto statements and using statements are not
+// supported.
+func loopInvariant(nodes []ast.Node, s, i string) ([]*ast.Index, bool) {
+	v := &invarianceVisitor{s: s, i: i}
+	for _, node := range nodes {
+		astutil.Walk(v, node)
+		if v.variant {
+			return nil, false
+		}
+	}
+	return v.indexes, true
+}
+
+// invarianceVisitor implements the astutil.Visitor interface and is used by
+// loopInvariant.
+type invarianceVisitor struct {
+	s, i    string
+	variant bool
+	indexes []*ast.Index
+}
+
+// Visit implements the astutil.Visitor interface.
+func (v *invarianceVisitor) Visit(node ast.Node) astutil.Visitor {
+	if v.variant {
+		return nil
+	}
+	switch n := node.(type) {
+	case *ast.Func:
+		return nil
+	case *ast.Goto, *ast.Using:
+		v.variant = true
+	case *ast.Assignment:
+		for _, lh := range n.Lhs {
+			if ident, ok := lh.(*ast.Identifier); ok {
+				v.declared(ident)
+			}
+		}
+	case *ast.Var:
+		for _, ident := range n.Lhs {
+			v.declared(ident)
+		}
+	case *ast.Const:
+		for _, ident := range n.Lhs {
+			v.declared(ident)
+		}
+	case *ast.TypeDeclaration:
+		v.declared(n.Ident)
+	case *ast.ForIn:
+		v.declared(n.Ident)
+	case *ast.Index:
+		s, ok1 := n.Expr.(*ast.Identifier)
+		i, ok2 := n.Index.(*ast.Identifier)
+		if ok1 && ok2 && s.Name == v.s && i.Name == v.i {
+			v.indexes = append(v.indexes, n)
+		}
+	}
+	return v
+}
+
+// declared marks the loop as variant if ident is s or i.
+func (v *invarianceVisitor) declared(ident *ast.Identifier) {
+	if ident.Name == v.s || ident.Name == v.i {
+		v.variant = true
+	}
+}
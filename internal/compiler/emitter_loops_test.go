@@ -0,0 +1,81 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"testing"
+
+	"github.com/open2b/scriggo/internal/fstest"
+	"github.com/open2b/scriggo/internal/runtime"
+)
+
+var emitterLoopsTests = []struct {
+	body     string
+	expected []runtime.Operation // expected operations.
+	excluded []runtime.Operation // operations that are not expected.
+}{
+	// Specialized range instructions.
+	{`s := []int{1}; for i, v := range s { println(i, v) }`, []runtime.Operation{runtime.OpRangeSliceInt}, nil},
+	{`s := []float64{1}; for _, v := range s { println(v) }`, []runtime.Operation{runtime.OpRangeSliceFloat64}, nil},
+	{`s := []string{"a"}; for _, v := range s { println(v) }`, []runtime.Operation{runtime.OpRangeSliceString}, nil},
+	{`m := map[string]int{"a": 1}; for k, v := range m { println(k, v) }`, []runtime.Operation{runtime.OpRangeMapString}, nil},
+	{`m := map[string][]int{}; for k := range m { println(k) }`, []runtime.Operation{runtime.OpRangeMapString}, nil},
+	{`s := []bool{true}; for _, v := range s { println(v) }`, []runtime.Operation{runtime.OpRange}, nil},
+	{`m := map[int]string{}; for k := range m { println(k) }`, []runtime.Operation{runtime.OpRange}, nil},
+	{`type T int; s := []T{1}; for _, v := range s { println(v) }`, []runtime.Operation{runtime.OpRange}, nil},
+
+	// Proved indexes.
+	{`s := []int{1}; for i := range s { println(s[i]) }`, []runtime.Operation{runtime.OpIndex}, []runtime.Operation{runtime.OpIndexRef}},
+	{`s := []int{1}; for i := range s { println(s[i+1]) }`, []runtime.Operation{runtime.OpIndexRef}, []runtime.Operation{runtime.OpIndex}},
+	{`s := []int{1}; for i := range s { s = nil; println(s[i]) }`, []runtime.Operation{runtime.OpIndexRef}, []runtime.Operation{runtime.OpIndex}},
+	{`s := []int{1}; for i := range s { i = 0; println(s[i]) }`, []runtime.Operation{runtime.OpIndexRef}, []runtime.Operation{runtime.OpIndex}},
+	{`s := []int{1}; for i := range s { if i > 0 { s := []int{}; println(s[i]) } }`, []runtime.Operation{runtime.OpIndexRef}, []runtime.Operation{runtime.OpIndex}},
+	{`s := []int{1}; for i := range s { func() { println(s[i]) }() }`, []runtime.Operation{runtime.OpRangeSliceInt}, []runtime.Operation{runtime.OpIndex}},
+
+	// For statements iterating over the indexes of a slice.
+	{`s := []int{1}; for i := 0; i < len(s); i++ { println(s[i]) }`, []runtime.Operation{runtime.OpRangeSliceInt, runtime.OpIndex}, []runtime.Operation{runtime.OpLen}},
+	{`s := []string{"a"}; for i := 0; i < len(s); i += 1 { println(s[i]) }`, []runtime.Operation{runtime.OpRangeSliceString, runtime.OpIndex}, []runtime.Operation{runtime.OpLen}},
+	{`s := []int{1}; for i := 1; i < len(s); i++ { println(s[i]) }`, []runtime.Operation{runtime.OpLen}, []runtime.Operation{runtime.OpRangeSliceInt}},
+	{`s := []int{1}; for i := 0; i <= len(s); i++ { println(i) }`, []runtime.Operation{runtime.OpLen}, []runtime.Operation{runtime.OpRangeSliceInt}},
+	{`s := []int{1}; for i := 0; i < len(s); i += 2 { println(i) }`, []runtime.Operation{runtime.OpLen}, []runtime.Operation{runtime.OpRangeSliceInt}},
+	{`s := []int{1}; for i := 0; i < len(s); i++ { s = append(s, 1) }`, []runtime.Operation{runtime.OpLen}, []runtime.Operation{runtime.OpRangeSliceInt}},
+	{`s := []int{1}; for i := 0; i < len(s); i++ { i++ }`, []runtime.Operation{runtime.OpLen}, []runtime.Operation{runtime.OpRangeSliceInt}},
+	{`s := []int{1}; for i := 0; i < len(s); i++ { f := func() { s = nil }; f() }`, []runtime.Operation{runtime.OpLen}, []runtime.Operation{runtime.OpRangeSliceInt}},
+	{`s := []int{1}; for i := 0; i < len(s); i++ { defer func() { println(i) }() }`, []runtime.Operation{runtime.OpLen}, []runtime.Operation{runtime.OpRangeSliceInt}},
+	{`s := "a"; for i := 0; i < len(s); i++ { println(s[i]) }`, []runtime.Operation{runtime.OpIndexString}, []runtime.Operation{runtime.OpRangeString}},
+}
+
+// TestEmitterLoops tests that the loops are emitted with the specialized
+// range instructions and that the proved indexes are emitted with the Index
+// instruction.
+func TestEmitterLoops(t *testing.T) {
+	for _, test := range emitterLoopsTests {
+		t.Run(test.body, func(t *testing.T) {
+			src := "package main\n\nfunc main() {\n\t" + test.body + "\n}\n"
+			code, err := BuildProgram(fstest.Files{"main.go": src}, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ops := map[runtime.Operation]bool{}
+			for _, in := range decodeBody(code.Main).code {
+				op := in.op
+				if op < 0 {
+					op = -op
+				}
+				ops[op] = true
+			}
+			for _, op := range test.expected {
+				if !ops[op] {
+					t.Fatalf("expected operation %s", operationName[op])
+				}
+			}
+			for _, op := range test.excluded {
+				if ops[op] {
+					t.Fatalf("unexpected operation %s", operationName[op])
+				}
+			}
+		})
+	}
+}
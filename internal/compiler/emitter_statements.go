@@ -16,6 +16,15 @@ import (
 func (em *emitter) emitNodes(nodes []ast.Node) {
 
 	for _, node := range nodes {
+
+		// Associate the position of the statement to its first instruction,
+		// so that every statement has a position at run time.
+		if _, ok := node.(*ast.Text); !ok {
+			if pos := node.Pos(); pos != nil {
+				em.fb.addPosAndPath(pos)
+			}
+		}
+
 		switch node := node.(type) {
 
 		case *ast.Assignment:
@@ -95,6 +104,12 @@ func (em *emitter) emitNodes(nodes []ast.Node) {
 						}
 						em.alreadyInitializedTemplatePkgs[node.Tree.Path] = true
 					}
+					// Collect the init functions of the files imported by the
+					// template file and, if it extends another file, of the
+					// template file itself.
+					if node.Tree.Path == em.templatePath || em.fb.getPath() == em.templatePath {
+						em.addTemplateInits(inits)
+					}
 				}
 			}
 
@@ -103,48 +118,7 @@ func (em *emitter) emitNodes(nodes []ast.Node) {
 			// emitter.emitSwitch.
 
 		case *ast.For:
-			currentBreakable := em.breakable
-			currentBreakLabel := em.breakLabel
-			em.breakable = true
-			em.breakLabel = nil
-			em.fb.enterScope()
-			if node.Init != nil {
-				em.emitNodes([]ast.Node{node.Init})
-			}
-			if node.Condition != nil {
-				forHead := em.fb.newLabel()
-				forPost := em.fb.newLabel()
-				em.fb.setLabelAddr(forHead)
-				em.emitCondition(node.Condition)
-				endForLabel := em.fb.newLabel()
-				em.fb.emitGoto(endForLabel)
-				em.rangeLabels = append(em.rangeLabels, forPost)
-				em.emitNodes(node.Body)
-				em.rangeLabels = em.rangeLabels[:len(em.rangeLabels)-1]
-				em.fb.setLabelAddr(forPost)
-				if node.Post != nil {
-					em.emitNodes([]ast.Node{node.Post})
-				}
-				em.fb.emitGoto(forHead)
-				em.fb.setLabelAddr(endForLabel)
-			} else {
-				forLabel := em.fb.newLabel()
-				em.fb.setLabelAddr(forLabel)
-				endForLabel := em.fb.newLabel()
-				em.rangeLabels = append(em.rangeLabels, forLabel)
-				em.emitNodes(node.Body)
-				if node.Post != nil {
-					em.emitNodes([]ast.Node{node.Post})
-				}
-				em.fb.emitGoto(forLabel)
-				em.fb.setLabelAddr(endForLabel)
-			}
-			em.fb.exitScope()
-			if em.breakLabel != nil {
-				em.fb.setLabelAddr(*em.breakLabel)
-			}
-			em.breakable = currentBreakable
-			em.breakLabel = currentBreakLabel
+			em.emitFor(node)
 
 		case *ast.ForRange:
 			em.emitForRange(node)
@@ -223,7 +197,7 @@ func (em *emitter) emitNodes(nodes []ast.Node) {
 			}
 
 		case *ast.Return:
-			offset := [4]int8{}
+			offset := [4]int16{}
 			// Emit return statements with a function call that returns more
 			// than one value.
 			//
@@ -235,7 +209,7 @@ func (em *emitter) emitNodes(nodes []ast.Node) {
 			if len(node.Values) == 1 && fnType.NumOut() > 1 {
 				returnedRegs, types := em.emitCallNode(node.Values[0].(*ast.Call), false, false, runtime.ReturnString)
 				for i, typ := range types {
-					var dstReg int8
+					var dstReg int16
 					switch kindToType(typ.Kind()) {
 					case intRegister:
 						offset[0]++
@@ -257,7 +231,7 @@ func (em *emitter) emitNodes(nodes []ast.Node) {
 			}
 			for i, v := range node.Values {
 				typ := fnType.Out(i)
-				var reg int8
+				var reg int16
 				switch kindToType(typ.Kind()) {
 				case intRegister:
 					offset[0]++
@@ -328,6 +302,9 @@ func (em *emitter) emitNodes(nodes []ast.Node) {
 		case *ast.Text:
 			txt := node.Text[node.Cut.Left : len(node.Text)-node.Cut.Right]
 			if len(txt) != 0 {
+				if node.Position != nil {
+					em.fb.addPosAndPath(textPosition(node))
+				}
 				em.fb.emitText(txt, em.inURL, em.isURLSet)
 			}
 
@@ -366,13 +343,13 @@ func (em *emitter) emitNodes(nodes []ast.Node) {
 			// declaration of a variable on the left side of = would shadow a
 			// variable with the same name on the right (they are two different
 			// variables).
-			varsToBind := make(map[string]int8, len(node.Lhs))
+			varsToBind := make(map[*ast.Identifier]int16, len(node.Lhs))
 			for i, v := range node.Lhs {
 				if isBlankIdentifier(v) {
 					addresses[i] = em.addressBlankIdent(v.Pos())
 				} else {
 					staticType := em.typ(v)
-					var varr int8
+					var varr int16
 					if em.varStore.mustBeDeclaredAsIndirect(v) {
 						varr = em.fb.newIndirectRegister()
 						addresses[i] = em.addressNewIndirectVar(varr, staticType, v.Pos(), 0)
@@ -380,12 +357,14 @@ func (em *emitter) emitNodes(nodes []ast.Node) {
 						varr = em.fb.newRegister(staticType.Kind())
 						addresses[i] = em.addressLocalVar(varr, staticType, v.Pos(), 0)
 					}
-					varsToBind[v.Name] = varr
+					varsToBind[v] = varr
 				}
 			}
 			em.assignValuesToAddresses(addresses, node.Rhs)
-			for name, reg := range varsToBind {
-				em.fb.bindVarReg(name, reg)
+			for _, v := range node.Lhs {
+				if reg, ok := varsToBind[v]; ok {
+					em.fb.bindVarReg(v.Name, reg, em.typ(v))
+				}
 			}
 
 		case ast.Expression:
@@ -416,6 +395,17 @@ func (em *emitter) canOptimizeShowMacro(expr ast.Expression, ctx ast.Context) bo
 	if !fn.IsMacroDeclaration() {
 		return false
 	}
+	// The value of an indirect or a closure variable is called as a native
+	// function, so the macro returns its output instead of rendering it.
+	if ident, ok := call.Func.(*ast.Identifier); ok {
+		if em.fb.declaredInFunc(ident.Name) {
+			if em.fb.scopeLookup(ident.Name) < 0 {
+				return false
+			}
+		} else if _, ok := em.varStore.nonLocalVarIndex(ident); ok {
+			return false
+		}
+	}
 	var from ast.Format
 	typ := fn.Type.Out(0)
 	for f, t := range em.formatTypes {
@@ -434,7 +424,7 @@ func (em *emitter) emitAssignmentNode(node *ast.Assignment) {
 	// Emit a short declaration.
 	if node.Type == ast.AssignmentDeclaration {
 		addresses := make([]address, len(node.Lhs))
-		varsToBind := make(map[string]int8, len(node.Lhs))
+		varsToBind := make(map[*ast.Identifier]int16, len(node.Lhs))
 		for i, v := range node.Lhs {
 			pos := v.Pos()
 			if isBlankIdentifier(v) {
@@ -446,7 +436,7 @@ func (em *emitter) emitAssignmentNode(node *ast.Assignment) {
 			// Declare an indirect local variable.
 			if em.varStore.mustBeDeclaredAsIndirect(v) {
 				varr := em.fb.newIndirectRegister()
-				varsToBind[v.Name] = varr
+				varsToBind[v] = varr
 				addresses[i] = em.addressNewIndirectVar(varr, varType, pos, node.Type)
 				continue
 			}
@@ -456,13 +446,17 @@ func (em *emitter) emitAssignmentNode(node *ast.Assignment) {
 			} else {
 				// Declare a local variable.
 				varr := em.fb.newRegister(varType.Kind())
-				varsToBind[v.Name] = varr
+				varsToBind[v] = varr
 				addresses[i] = em.addressLocalVar(varr, varType, pos, node.Type)
 			}
 		}
 		em.assignValuesToAddresses(addresses, node.Rhs)
-		for name, reg := range varsToBind {
-			em.fb.bindVarReg(name, reg)
+		for _, v := range node.Lhs {
+			if v, ok := v.(*ast.Identifier); ok {
+				if reg, ok := varsToBind[v]; ok {
+					em.fb.bindVarReg(v.Name, reg, em.typ(v))
+				}
+			}
 		}
 		return
 	}
@@ -533,9 +527,9 @@ func (em *emitter) emitAssignmentNode(node *ast.Assignment) {
 			}
 			index := em.fb.makeFieldIndex(field.Index)
 			if nonLocalStruct, ok := em.varStore.nonLocalVarIndex(expr); ok {
-				addresses[i] = em.addressNonLocalStructSelector(nonLocalStruct, reg, index, typ, pos, node.Type)
+				addresses[i] = em.addressNonLocalStructSelector(nonLocalStruct, reg, int16(index), typ, pos, node.Type)
 			} else {
-				addresses[i] = em.addressLocalStructSelector(reg, index, typ, pos, node.Type)
+				addresses[i] = em.addressLocalStructSelector(reg, int16(index), typ, pos, node.Type)
 			}
 		case *ast.UnaryOperator:
 			if v.Operator() != ast.OperatorPointer {
@@ -668,7 +662,7 @@ func (em *emitter) emitSelect(selectNode *ast.Select) {
 
 	// Emit an empty select.
 	if len(selectNode.Cases) == 0 {
-		em.fb.emitSelect()
+		em.fb.emitSelect(false)
 		return
 	}
 
@@ -676,9 +670,9 @@ func (em *emitter) emitSelect(selectNode *ast.Select) {
 	// the 'select' statement will be released at the end of it.
 	em.fb.enterStack()
 
-	chs := make([]int8, len(selectNode.Cases))
+	chs := make([]int16, len(selectNode.Cases))
 	ok := em.fb.newRegister(reflect.Bool)
-	value := [4]int8{
+	value := [4]int16{
 		intRegister:     em.fb.newRegister(reflect.Int),
 		floatRegister:   em.fb.newRegister(reflect.Float64),
 		stringRegister:  em.fb.newRegister(reflect.String),
@@ -707,6 +701,17 @@ func (em *emitter) emitSelect(selectNode *ast.Select) {
 		}
 	}
 
+	// The 'case' instructions are emitted all wide, if at least one of them
+	// has an operand that does not fit in an int8, so that the VM can find
+	// the chosen case.
+	wide := false
+	for _, r := range append(chs, value[:]...) {
+		if !isInt8(r) {
+			wide = true
+			break
+		}
+	}
+
 	// Emit all the 'case' instructions.
 	casesLabel := make([]label, len(selectNode.Cases))
 	for i, cas := range selectNode.Cases {
@@ -714,28 +719,28 @@ func (em *emitter) emitSelect(selectNode *ast.Select) {
 		switch comm := cas.Comm.(type) {
 		case nil:
 			// default
-			em.fb.emitCase(false, reflect.SelectDefault, 0, 0)
+			em.fb.emitCase(false, reflect.SelectDefault, 0, 0, wide)
 		case *ast.UnaryOperator:
 			// <- ch
-			em.fb.emitCase(false, reflect.SelectRecv, 0, chs[i])
+			em.fb.emitCase(false, reflect.SelectRecv, 0, chs[i], wide)
 		case *ast.Assignment:
 			// v [, ok ] = <- ch
 			chExpr := comm.Rhs[0].(*ast.UnaryOperator).Expr
 			chType := em.typ(chExpr)
 			elemType := chType.Elem()
-			em.fb.emitCase(false, reflect.SelectRecv, value[kindToType(elemType.Kind())], chs[i])
+			em.fb.emitCase(false, reflect.SelectRecv, value[kindToType(elemType.Kind())], chs[i], wide)
 		case *ast.Send:
 			// ch <- v
 			chExpr := comm.Channel
 			chType := em.typ(chExpr)
 			elemType := chType.Elem()
-			em.fb.emitCase(false, reflect.SelectSend, value[kindToType(elemType.Kind())], chs[i])
+			em.fb.emitCase(false, reflect.SelectSend, value[kindToType(elemType.Kind())], chs[i], wide)
 		}
 		em.fb.emitGoto(casesLabel[i])
 	}
 
 	// Emit the 'select' instruction.
-	em.fb.emitSelect()
+	em.fb.emitSelect(wide)
 
 	// Emit bodies of the 'select' cases.
 	casesEnd := em.fb.newLabel()
@@ -748,7 +753,7 @@ func (em *emitter) emitSelect(selectNode *ast.Select) {
 			chExpr := receiveExpr.Expr
 			elemType := em.typ(chExpr).Elem()
 			// Split the assignment in the received value and the ok value if this exists.
-			em.fb.bindVarReg("$chanElem", value[kindToType(elemType.Kind())])
+			em.fb.bindVarReg("$chanElem", value[kindToType(elemType.Kind())], nil)
 			pos := chExpr.Pos()
 			valueExpr := ast.NewIdentifier(pos, "$chanElem")
 			em.typeInfos[valueExpr] = em.typeInfos[receiveExpr]
@@ -762,7 +767,7 @@ func (em *emitter) emitSelect(selectNode *ast.Select) {
 				em.typeInfos[okExpr] = &typeInfo{
 					Type: boolType,
 				}
-				em.fb.bindVarReg("$ok", ok)
+				em.fb.bindVarReg("$ok", ok, nil)
 				okAssignment := ast.NewAssignment(pos, assignment.Lhs[1:2], assignment.Type, []ast.Expression{okExpr})
 				em.emitAssignmentNode(okAssignment)
 			}
@@ -791,7 +796,7 @@ func (em *emitter) emitSwitch(node *ast.Switch) {
 		em.emitNodes([]ast.Node{node.Init})
 	}
 
-	var expr int8
+	var expr int16
 	var typ reflect.Type
 
 	if node.Expr == nil {
@@ -886,10 +891,10 @@ func (em *emitter) emitTypeSwitch(node *ast.TypeSwitch) {
 		guardNewVar = node.Assignment.Lhs[0].(*ast.Identifier).Name
 	}
 
-	var intReg int8
-	var floatReg int8
-	var stringReg int8
-	var generalReg int8
+	var intReg int16
+	var floatReg int16
+	var stringReg int16
+	var generalReg int16
 
 	// Allocate only the necessary register.
 	// Note that 'expr' has already been allocated; these registers are
@@ -935,7 +940,7 @@ func (em *emitter) emitTypeSwitch(node *ast.TypeSwitch) {
 				em.fb.emitIf(false, expr, runtime.ConditionInterfaceNil, 0, reflect.Interface, clause.Expressions[0].Pos())
 			} else {
 				typ := em.ti(clause.Expressions[0]).Type
-				var reg int8
+				var reg int16
 				switch kindToType(typ.Kind()) {
 				case intRegister:
 					reg = intReg
@@ -986,18 +991,19 @@ func (em *emitter) emitTypeSwitch(node *ast.TypeSwitch) {
 		em.fb.enterScope()
 		if guardNewVar != "" {
 			if len(clause.Expressions) == 1 && !em.isPredeclNil(clause.Expressions[0]) {
-				switch kindToType(em.ti(clause.Expressions[0]).Type.Kind()) {
+				typ := em.ti(clause.Expressions[0]).Type
+				switch kindToType(typ.Kind()) {
 				case intRegister:
-					em.fb.bindVarReg(guardNewVar, intReg)
+					em.fb.bindVarReg(guardNewVar, intReg, typ)
 				case floatRegister:
-					em.fb.bindVarReg(guardNewVar, floatReg)
+					em.fb.bindVarReg(guardNewVar, floatReg, typ)
 				case stringRegister:
-					em.fb.bindVarReg(guardNewVar, stringReg)
+					em.fb.bindVarReg(guardNewVar, stringReg, typ)
 				case generalRegister:
-					em.fb.bindVarReg(guardNewVar, generalReg)
+					em.fb.bindVarReg(guardNewVar, generalReg, typ)
 				}
 			} else {
-				em.fb.bindVarReg(guardNewVar, expr)
+				em.fb.bindVarReg(guardNewVar, expr, em.typ(guardExpr))
 			}
 		}
 		em.emitNodes(clause.Body)
@@ -1010,12 +1016,85 @@ func (em *emitter) emitTypeSwitch(node *ast.TypeSwitch) {
 
 }
 
+// emitFor emits a for statement.
+func (em *emitter) emitFor(node *ast.For) {
+
+	// A for statement that iterates over the indexes of a slice is emitted
+	// as a for range statement.
+	if r := em.forAsRange(node); r != nil {
+		em.emitForRange(r)
+		return
+	}
+
+	// A continue statement in the body continues the for statement, and not
+	// the innermost enclosing Range instruction.
+	inForRange := em.inForRange
+	em.inForRange = false
+
+	currentBreakable := em.breakable
+	currentBreakLabel := em.breakLabel
+	em.breakable = true
+	em.breakLabel = nil
+	em.fb.enterScope()
+	if node.Init != nil {
+		em.emitNodes([]ast.Node{node.Init})
+	}
+	if node.Condition != nil {
+		forHead := em.fb.newLabel()
+		forPost := em.fb.newLabel()
+		em.fb.setLabelAddr(forHead)
+		em.emitCondition(node.Condition)
+		endForLabel := em.fb.newLabel()
+		em.fb.emitGoto(endForLabel)
+		em.rangeLabels = append(em.rangeLabels, forPost)
+		em.emitNodes(node.Body)
+		em.rangeLabels = em.rangeLabels[:len(em.rangeLabels)-1]
+		em.fb.setLabelAddr(forPost)
+		if node.Post != nil {
+			em.emitNodes([]ast.Node{node.Post})
+		}
+		em.fb.emitGoto(forHead)
+		em.fb.setLabelAddr(endForLabel)
+	} else {
+		forLabel := em.fb.newLabel()
+		forPost := em.fb.newLabel()
+		em.fb.setLabelAddr(forLabel)
+		endForLabel := em.fb.newLabel()
+		// A continue statement jumps to the post statement, also if there
+		// is no condition.
+		em.rangeLabels = append(em.rangeLabels, forPost)
+		em.emitNodes(node.Body)
+		em.rangeLabels = em.rangeLabels[:len(em.rangeLabels)-1]
+		em.fb.setLabelAddr(forPost)
+		if node.Post != nil {
+			em.emitNodes([]ast.Node{node.Post})
+		}
+		em.fb.emitGoto(forLabel)
+		em.fb.setLabelAddr(endForLabel)
+	}
+	em.fb.exitScope()
+	if em.breakLabel != nil {
+		em.fb.setLabelAddr(*em.breakLabel)
+	}
+	em.breakable = currentBreakable
+	em.breakLabel = currentBreakLabel
+	em.inForRange = inForRange
+
+}
+
 // emitForRange emits a for range statement.
 func (em *emitter) emitForRange(node *ast.ForRange) {
 
 	inForRange := em.inForRange
 	em.inForRange = true
 
+	// A break statement in the body breaks the Range instruction, and not
+	// the innermost enclosing breakable statement.
+	breakable := em.breakable
+	breakLabel := em.breakLabel
+	em.breakable = false
+	em.breakLabel = nil
+
 	em.fb.enterScope()
 
 	vars := node.Assignment.Lhs
@@ -1032,21 +1111,22 @@ func (em *emitter) emitForRange(node *ast.ForRange) {
 	// indirect and move values between them before executing the instructions
 	// of the for statement's body.
 
-	var index, elem int8
-	var indirectIndex, indirectElem int8
+	var index, elem int16
+	var indirectIndex, indirectElem int16
 	var indexType, elemType reflect.Type
 
 	if len(vars) >= 1 && !isBlankIdentifier(vars[0]) {
 		name := vars[0].(*ast.Identifier).Name
 		indexType = em.typ(vars[0])
 		if node.Assignment.Type == ast.AssignmentDeclaration {
-			index = em.fb.newRegister(reflect.Int)
+			// The index is a key for maps and an element for channels.
+			index = em.fb.newRegister(indexType.Kind())
 			if em.varStore.mustBeDeclaredAsIndirect(vars[0].(*ast.Identifier)) {
 				indirectIndex = em.fb.newIndirectRegister()
 				em.fb.emitNew(indexType, -indirectIndex)
-				em.fb.bindVarReg(name, indirectIndex)
+				em.fb.bindVarReg(name, indirectIndex, indexType)
 			} else {
-				em.fb.bindVarReg(name, index)
+				em.fb.bindVarReg(name, index, indexType)
 			}
 		} else {
 			index = em.fb.scopeLookup(name)
@@ -1061,9 +1141,9 @@ func (em *emitter) emitForRange(node *ast.ForRange) {
 			if em.varStore.mustBeDeclaredAsIndirect(vars[1].(*ast.Identifier)) {
 				indirectElem = em.fb.newIndirectRegister()
 				em.fb.emitNew(elemType, -indirectElem)
-				em.fb.bindVarReg(name, indirectElem)
+				em.fb.bindVarReg(name, indirectElem, elemType)
 			} else {
-				em.fb.bindVarReg(name, elem)
+				em.fb.bindVarReg(name, elem, elemType)
 			}
 		} else {
 			elem = em.fb.scopeLookup(name)
@@ -1071,10 +1151,10 @@ func (em *emitter) emitForRange(node *ast.ForRange) {
 	}
 
 	rangeLabel := em.fb.newLabel()
-	em.fb.setLabelAddr(rangeLabel)
 	endRange := em.fb.newLabel()
 	em.rangeLabels = append(em.rangeLabels, rangeLabel)
-	em.fb.emitRange(kExpr, exprReg, index, elem, exprType.Kind())
+	em.fb.emitRange(kExpr, exprReg, index, elem, exprType)
+	em.fb.setLabelAddr(rangeLabel)
 	em.fb.emitGoto(endRange)
 	em.fb.enterScope()
 
@@ -1085,6 +1165,7 @@ func (em *emitter) emitForRange(node *ast.ForRange) {
 		em.changeRegister(false, elem, indirectElem, elemType, elemType)
 	}
 
+	em.proveIndexes(node)
 	em.emitNodes(node.Body)
 	em.fb.emitContinue(rangeLabel)
 	em.fb.setLabelAddr(endRange)
@@ -1092,6 +1173,8 @@ func (em *emitter) emitForRange(node *ast.ForRange) {
 	em.fb.exitScope()
 	em.fb.exitScope()
 	em.inForRange = inForRange
+	em.breakable = breakable
+	em.breakLabel = breakLabel
 
 	if node.Else != nil {
 		endForLabel := em.fb.newLabel()
@@ -14,19 +14,19 @@ import (
 
 // changeRegister emits the code that move the content of register src to
 // register dst, making a conversion if necessary.
-func (em *emitter) changeRegister(k bool, src, dst int8, srcType reflect.Type, dstType reflect.Type) {
+func (em *emitter) changeRegister(k bool, src, dst int16, srcType reflect.Type, dstType reflect.Type) {
 	em._changeRegister(k, src, dst, srcType, dstType, false)
 }
 
 // changeRegisterConvertFormat behaves like changeRegister but handles a format
 // conversion from a value with type 'markdown' to 'html'.
-func (em *emitter) changeRegisterConvertFormat(k bool, src, dst int8, srcType reflect.Type, dstType reflect.Type) {
+func (em *emitter) changeRegisterConvertFormat(k bool, src, dst int16, srcType reflect.Type, dstType reflect.Type) {
 	em._changeRegister(k, src, dst, srcType, dstType, true)
 }
 
 // _changeRegister should be called only by 'changeRegister' and
 // 'changeRegisterMDToHTML'.
-func (em *emitter) _changeRegister(k bool, src, dst int8, srcType reflect.Type, dstType reflect.Type, mdToHTML bool) {
+func (em *emitter) _changeRegister(k bool, src, dst int16, srcType reflect.Type, dstType reflect.Type, mdToHTML bool) {
 
 	// dst is indirect, so the value must be "typed" to its true (original) type
 	// before putting it into general.
@@ -265,10 +265,12 @@ func canEmitDirectly(k1, k2 reflect.Kind) bool {
 // before changing or saving it.
 func (em *emitter) setFunctionVarRefs(fn *runtime.Function, closureVars []ast.Upvar) {
 	refs := make([]int16, len(closureVars))
+	names := make([]string, len(closureVars))
 	for i := range closureVars {
 		v := &closureVars[i]
 		// v is predefined.
 		if v.Declaration == nil {
+			names[i] = v.NativeName
 			refs[i] = em.varStore.predefVarIndex(v.NativeValue, v.NativeValueType, v.NativePkg, v.NativeName)
 			em.varStore.setPredefVarRef(fn, v.NativeValue, int16(i))
 			continue
@@ -276,6 +278,7 @@ func (em *emitter) setFunctionVarRefs(fn *runtime.Function, closureVars []ast.Up
 		em.varStore.setClosureVar(fn, v.Declaration.(*ast.Identifier).Name, int16(i))
 		// v is a variable declared in function.
 		ident := v.Declaration.(*ast.Identifier)
+		names[i] = ident.Name
 		if em.fb.declaredInFunc(ident.Name) {
 			refs[i] = int16(em.fb.scopeLookup(ident.Name))
 			continue
@@ -290,9 +293,10 @@ func (em *emitter) setFunctionVarRefs(fn *runtime.Function, closureVars []ast.Up
 		panic(internalError("don't know how to handle identifier %s", ident))
 	}
 	fn.VarRefs = refs
+	fn.UpvarNames = names
 }
 
-func (em *emitter) emitValueNotPredefined(ti *typeInfo, reg int8, dstType reflect.Type) (int8, bool) {
+func (em *emitter) emitValueNotPredefined(ti *typeInfo, reg int16, dstType reflect.Type) (int16, bool) {
 	typ := ti.Type
 	if reg == 0 {
 		return reg, false
@@ -300,7 +304,7 @@ func (em *emitter) emitValueNotPredefined(ti *typeInfo, reg int8, dstType reflec
 	// Handle nil values.
 	if ti.value == nil {
 		c := em.fb.makeGeneralValue(reflect.ValueOf(nil))
-		em.changeRegister(true, c, reg, typ, dstType)
+		em.changeRegister(true, int16(c), reg, typ, dstType)
 		return reg, false
 	}
 	switch v := ti.value.(type) {
@@ -333,7 +337,7 @@ func (em *emitter) emitValueNotPredefined(ti *typeInfo, reg int8, dstType reflec
 		return reg, false
 	case string:
 		c := em.fb.makeStringValue(v)
-		em.changeRegister(true, c, reg, typ, dstType)
+		em.changeRegister(true, int16(c), reg, typ, dstType)
 		return reg, false
 	}
 	v := reflect.ValueOf(ti.value)
@@ -368,7 +372,7 @@ func (em *emitter) emitValueNotPredefined(ti *typeInfo, reg int8, dstType reflec
 		reflect.Map,
 		reflect.Ptr:
 		c := em.fb.makeGeneralValue(v)
-		em.changeRegister(true, c, reg, typ, dstType)
+		em.changeRegister(true, int16(c), reg, typ, dstType)
 	case reflect.UnsafePointer:
 		panic(internalError("not implemented"))
 	default:
@@ -380,7 +384,7 @@ func (em *emitter) emitValueNotPredefined(ti *typeInfo, reg int8, dstType reflec
 // emitComparison emits the comparison expression x op y as a sequence of
 // instructions where the last one is an 'if' instruction. ky indicates if y
 // is a constant.
-func (em *emitter) emitComparison(op ast.OperatorType, ky bool, x, y int8, tx, ty reflect.Type, pos *ast.Position) {
+func (em *emitter) emitComparison(op ast.OperatorType, ky bool, x, y int16, tx, ty reflect.Type, pos *ast.Position) {
 	xKind := tx.Kind()
 	yKind := ty.Kind()
 	var condition runtime.Condition
@@ -452,7 +456,7 @@ func (em *emitter) emitComparison(op ast.OperatorType, ky bool, x, y int8, tx, t
 // it emits 'x not contains y'. ky indicates if y is a constant.
 //
 // ty is nil if the expression is 'x contains nil' or 'x not contains nil'.
-func (em *emitter) emitContains(not, ky bool, x, y int8, tx, ty reflect.Type, pos *ast.Position) {
+func (em *emitter) emitContains(not, ky bool, x, y int16, tx, ty reflect.Type, pos *ast.Position) {
 	var condition runtime.Condition
 	var t reflect.Type
 	switch tx.Kind() {
@@ -503,3 +507,31 @@ func convertPosition(pos *ast.Position) *runtime.Position {
 		End:    pos.End,
 	}
 }
+
+// bodyPosition returns the position of the first character of the body of
+// fn, or nil if fn has no body.
+func bodyPosition(fn *ast.Func) *runtime.Position {
+	if fn.Body == nil || fn.Body.Pos() == nil {
+		return nil
+	}
+	pos := convertPosition(fn.Body.Pos())
+	pos.End = pos.Start
+	return pos
+}
+
+// textPosition returns the position of the text of node that is not cut.
+func textPosition(node *ast.Text) *ast.Position {
+	pos := *node.Position
+	cut := node.Text[:node.Cut.Left]
+	for _, c := range string(cut) {
+		if c == '\n' {
+			pos.Line++
+			pos.Column = 1
+		} else {
+			pos.Column++
+		}
+	}
+	pos.Start += node.Cut.Left
+	pos.End -= node.Cut.Right
+	return &pos
+}
@@ -88,13 +88,14 @@ type lexer struct {
 		index int         // index of first byte of the current attribute value in src
 		ctx   ast.Context // context of the tag's content
 	}
-	rawMarker      []byte     // raw marker, not nil when a raw statement has been lexed
-	tokens         chan token // tokens, is closed at the end of the scan
-	lastTokenType  tokenTyp   // type of the last non-empty emitted token
-	totals         int        // total number of emitted tokens, excluding automatically inserted semicolons
-	err            error      // error, reports whether there was an error
-	templateSyntax bool       // support template syntax.
-	noParseShow    bool       // do not parse the short show statement.
+	rawMarker      []byte         // raw marker, not nil when a raw statement has been lexed
+	tokens         chan token     // tokens, is closed at the end of the scan
+	lastTokenType  tokenTyp       // type of the last non-empty emitted token
+	totals         int            // total number of emitted tokens, excluding automatically inserted semicolons
+	err            error          // error, reports whether there was an error
+	templateSyntax bool           // support template syntax.
+	noParseShow    bool           // do not parse the short show statement.
+	comments       []*ast.Comment // comments in the code, read by the parser after the EOF token
 }
 
 // newline is called when the lexer encounters a new line.
@@ -115,6 +116,14 @@ func (l *lexer) errorf(format string, a ...interface{}) *SyntaxError {
 	return syntaxError(&pos, format, a...)
 }
 
+// addComment adds to the comments the comment, in the code, at the current
+// line and column with the given length.
+func (l *lexer) addComment(length int) {
+	start := len(l.text) - len(l.src)
+	pos := &ast.Position{Line: l.line, Column: l.column, Start: start, End: start + length - 1}
+	l.comments = append(l.comments, ast.NewComment(pos, string(l.src[:length])))
+}
+
 // emit emits a token of type typ and length length at the current line and
 // column.
 func (l *lexer) emit(typ tokenTyp, length int) {
@@ -1031,11 +1040,13 @@ LOOP:
 			if len(l.src) > 1 && l.src[1] == '/' {
 				p := bytes.IndexAny(l.src, "\n"+string(BOM))
 				if p == -1 {
+					l.addComment(len(l.src))
 					break LOOP
 				}
 				if l.src[p] != '\n' {
 					return l.errorf(bomErrorMsg)
 				}
+				l.addComment(p)
 				l.src = l.src[p:]
 				if endLineAsSemicolon {
 					l.emit(tokenSemicolon, 0)
@@ -1046,11 +1057,13 @@ LOOP:
 				continue LOOP
 			}
 			if len(l.src) > 1 && l.src[1] == '*' {
-				l.src = l.src[2:]
-				p := bytes.Index(l.src, []byte("*/"))
+				p := bytes.Index(l.src[2:], []byte("*/"))
 				if p == -1 {
+					l.src = l.src[2:]
 					return l.errorf("comment not terminated")
 				}
+				l.addComment(p + 4)
+				l.src = l.src[2:]
 				nl := bytes.IndexAny(l.src[:p], "\n"+string(BOM))
 				if nl >= 0 && l.src[nl] != '\n' {
 					return l.errorf(bomErrorMsg)
@@ -1250,6 +1263,10 @@ LOOP:
 				l.column++
 			}
 			endLineAsSemicolon = false
+		case '~':
+			l.emit(tokenTilde, 1)
+			l.column++
+			endLineAsSemicolon = false
 		case ':':
 			if len(l.src) > 1 && l.src[1] == '=' {
 				l.emit(tokenDeclaration, 2)
@@ -747,6 +747,32 @@ func TestPositions(t *testing.T) {
 	}
 }
 
+func TestLexerComments(t *testing.T) {
+	src := "a{% b := 1 // c1\n%}{{ /* c2\n */ b }}{# c3 #}"
+	expected := []*ast.Comment{
+		ast.NewComment(&ast.Position{Line: 1, Column: 12, Start: 11, End: 15}, "// c1"),
+		ast.NewComment(&ast.Position{Line: 2, Column: 6, Start: 22, End: 30}, "/* c2\n */"),
+	}
+	lex := scanTemplate([]byte(src), ast.FormatHTML, false)
+	for tok := range lex.Tokens() {
+		if tok.typ == tokenEOF {
+			break
+		}
+	}
+	if lex.err != nil {
+		t.Fatalf("unexpected error %s", lex.err)
+	}
+	if len(lex.comments) != len(expected) {
+		t.Fatalf("expected %d comments, got %d", len(expected), len(lex.comments))
+	}
+	for i, c := range lex.comments {
+		if c.Text != expected[i].Text || *c.Position != *expected[i].Position {
+			t.Fatalf("expected comment %q at %#v, got %q at %#v", expected[i].Text,
+				*expected[i].Position, c.Text, *c.Position)
+		}
+	}
+}
+
 func TestLexerReadTag(t *testing.T) {
 	for _, test := range scanTagTests {
 		src := []byte(test.src)
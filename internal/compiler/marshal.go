@@ -0,0 +1,1808 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"unicode"
+
+	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/internal/compiler/types"
+	"github.com/open2b/scriggo/internal/runtime"
+	"github.com/open2b/scriggo/native"
+)
+
+// codeMagic is the prefix of a marshaled code.
+const codeMagic = "\x00scriggo"
+
+// codeVersion is the version of the binary format of a marshaled code. It
+// must be incremented every time the format changes.
+const codeVersion = 12
+
+// Tags of the encoded types.
+const (
+	typeRef byte = iota
+	typeNil
+	typeBasic
+	typeEmptyInterface
+	typeError
+	typeNative
+	typeDefined
+	typeArray
+	typeChan
+	typeFunc
+	typeMap
+	typePtr
+	typeSlice
+	typeStruct
+	typeInterface
+)
+
+// Tags of the encoded values.
+const (
+	valueInvalid byte = iota
+	valueZero
+	valueBool
+	valueInt
+	valueUint
+	valueFloat
+	valueComplex
+	valueString
+	valueNative
+	valueArray
+	valueSlice
+	valueMap
+	valueStruct
+)
+
+// Tags of the encoded references to native functions and variables.
+const (
+	refDecl byte = iota
+	refMethod
+	refComplex
+	refNil
+)
+
+// basicTypes contains the predeclared types that are not referenced by name.
+var basicTypes = map[reflect.Kind]reflect.Type{
+	reflect.Bool:       boolType,
+	reflect.Int:        intType,
+	reflect.Int8:       reflect.TypeOf(int8(0)),
+	reflect.Int16:      reflect.TypeOf(int16(0)),
+	reflect.Int32:      int32Type,
+	reflect.Int64:      reflect.TypeOf(int64(0)),
+	reflect.Uint:       uintType,
+	reflect.Uint8:      uint8Type,
+	reflect.Uint16:     reflect.TypeOf(uint16(0)),
+	reflect.Uint32:     reflect.TypeOf(uint32(0)),
+	reflect.Uint64:     reflect.TypeOf(uint64(0)),
+	reflect.Uintptr:    reflect.TypeOf(uintptr(0)),
+	reflect.Float32:    float32Type,
+	reflect.Float64:    float64Type,
+	reflect.Complex64:  complex64Type,
+	reflect.Complex128: complex128Type,
+	reflect.String:     stringType,
+}
+
+// complexFunctions contains the functions used to execute operations on
+// complex numbers, indexed by their names.
+var complexFunctions = map[string]interface{}{
+	"neg": negComplex,
+	"add": addComplex,
+	"sub": subComplex,
+	"mul": mulComplex,
+	"div": divComplex,
+}
+
+// indexedTypes contains the native types that can be used by a compiled code
+// even if they are not reachable from the native declarations.
+var indexedTypes = []reflect.Type{
+	envType,
+	timeType,
+	stringerType, envStringerType,
+	htmlStringerType, htmlEnvStringerType,
+	cssStringerType, cssEnvStringerType,
+	jsStringerType, jsEnvStringerType,
+	jsonStringerType, jsonEnvStringerType,
+	mdStringerType, mdEnvStringerType,
+}
+
+// Marshal returns the binary encoding of code. opts must contain the same
+// importer, globals and format types used to build code.
+//
+// Native functions, variables and types are encoded as references to their
+// declarations so that they can be resolved by Unmarshal. If code contains a
+// value that cannot be referenced, Marshal returns an error.
+func Marshal(code *Code, opts Options) (_ []byte, err error) {
+	index, err := newNativeIndex(code.Packages, opts)
+	if err != nil {
+		return nil, err
+	}
+	enc := &encoder{
+		index:   index,
+		types:   map[reflect.Type]int{},
+		fns:     map[*runtime.Function]int{},
+		natives: map[*runtime.NativeFunction]int{},
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(codingError); ok {
+				err = e
+				return
+			}
+			panic(r)
+		}
+	}()
+	enc.encode(code)
+	return enc.b, nil
+}
+
+// Unmarshal decodes a code encoded by Marshal. Native functions, variables
+// and types are resolved with the importer, the globals and the format types
+// in opts.
+//
+// If a native declaration does not exist or has a type different from when
+// the code has been marshaled, Unmarshal returns an error. If data is not a
+// valid encoding, for example because it is corrupted or truncated,
+// Unmarshal returns an error and does not panic.
+func Unmarshal(data []byte, opts Options) (_ *Code, err error) {
+	if len(data) < len(codeMagic) || string(data[:len(codeMagic)]) != codeMagic {
+		return nil, errors.New("scriggo: invalid code")
+	}
+	dec := &decoder{b: data[len(codeMagic):], opts: opts, types: types.NewTypes()}
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(codingError); ok {
+				err = e
+				return
+			}
+			panic(r)
+		}
+	}()
+	return dec.decode(), nil
+}
+
+// codingError is the error returned by Marshal and Unmarshal.
+type codingError struct {
+	msg string
+}
+
+func (err codingError) Error() string {
+	return err.msg
+}
+
+// codingErrorf returns a codingError that can be used as panic argument
+// during the encoding and the decoding.
+func codingErrorf(format string, a ...interface{}) codingError {
+	return codingError{"scriggo: " + fmt.Sprintf(format, a...)}
+}
+
+// importRecorder is a native.Importer that records the paths of the imported
+// packages.
+type importRecorder struct {
+	importer native.Importer
+	paths    []string
+}
+
+// Import implements the native.Importer interface.
+func (r *importRecorder) Import(path string) (native.ImportablePackage, error) {
+	pkg, err := r.importer.Import(path)
+	if err != nil || pkg == nil {
+		return pkg, err
+	}
+	for _, p := range r.paths {
+		if p == path {
+			return pkg, nil
+		}
+	}
+	r.paths = append(r.paths, path)
+	return pkg, nil
+}
+
+// nativeDecl is a native function or variable declaration.
+type nativeDecl struct {
+	global bool          // declared in the globals.
+	path   []string      // package path, if not global, and names.
+	value  reflect.Value // function or pointer to the variable.
+}
+
+// declKey is the key of a native function or variable in a nativeIndex.
+type declKey struct {
+	kind    reflect.Kind
+	pointer uintptr
+}
+
+// methodDecl is a method of a native type.
+type methodDecl struct {
+	typ  reflect.Type
+	name string
+}
+
+// nativeIndex indexes the native declarations, and the native types
+// reachable from them, so that they can be referenced by name.
+type nativeIndex struct {
+	types   map[string]reflect.Type
+	decls   map[declKey][]nativeDecl
+	methods map[uintptr][]methodDecl
+	visited map[reflect.Type]bool
+}
+
+// newNativeIndex returns a new index of the declarations of the native
+// packages with the given paths and of the globals in opts.
+func newNativeIndex(packages []string, opts Options) (*nativeIndex, error) {
+	index := &nativeIndex{
+		types:   map[string]reflect.Type{},
+		decls:   map[declKey][]nativeDecl{},
+		visited: map[reflect.Type]bool{},
+	}
+	for _, t := range indexedTypes {
+		index.addType(t)
+	}
+	for _, t := range opts.FormatTypes {
+		index.addType(t)
+	}
+	if opts.Globals != nil {
+		index.addPackage(native.Package{Name: "main", Declarations: opts.Globals}, true, nil)
+	}
+	for _, path := range packages {
+		if opts.Importer == nil {
+			return nil, fmt.Errorf("scriggo: cannot find package %q", path)
+		}
+		pkg, err := opts.Importer.Import(path)
+		if err != nil {
+			return nil, err
+		}
+		if pkg == nil {
+			return nil, fmt.Errorf("scriggo: cannot find package %q", path)
+		}
+		index.addPackage(pkg, false, []string{path})
+	}
+	return index, nil
+}
+
+// addPackage adds the declarations of pkg to the index. path is the path of
+// the declarations in pkg.
+func (index *nativeIndex) addPackage(pkg native.ImportablePackage, global bool, path []string) {
+	_ = pkg.LookupFunc(func(name string, decl native.Declaration) error {
+		p := append(path[:len(path):len(path)], name)
+		switch d := decl.(type) {
+		case reflect.Type:
+			index.addType(d)
+		case native.ImportablePackage:
+			index.addPackage(d, global, p)
+		default:
+			v := reflect.ValueOf(d)
+			if !v.IsValid() {
+				return nil
+			}
+			index.addType(v.Type())
+			if k := v.Kind(); (k == reflect.Func || k == reflect.Ptr) && !v.IsNil() {
+				key := declKey{k, v.Pointer()}
+				index.decls[key] = append(index.decls[key], nativeDecl{global: global, path: p, value: v})
+			}
+		}
+		return nil
+	})
+}
+
+// addType adds t, and the types reachable from t, to the index.
+func (index *nativeIndex) addType(t reflect.Type) {
+	if index.visited[t] {
+		return
+	}
+	index.visited[t] = true
+	if isReferencedByName(t) {
+		key := nativeTypeKey(t)
+		if _, ok := index.types[key]; !ok {
+			index.types[key] = t
+		}
+	}
+	switch t.Kind() {
+	case reflect.Array, reflect.Chan, reflect.Ptr, reflect.Slice:
+		index.addType(t.Elem())
+	case reflect.Map:
+		index.addType(t.Key())
+		index.addType(t.Elem())
+	case reflect.Func:
+		for i := 0; i < t.NumIn(); i++ {
+			index.addType(t.In(i))
+		}
+		for i := 0; i < t.NumOut(); i++ {
+			index.addType(t.Out(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			index.addType(t.Field(i).Type)
+		}
+	}
+	for i := 0; i < t.NumMethod(); i++ {
+		index.addType(t.Method(i).Type)
+	}
+	if t.Name() != "" && t.Kind() != reflect.Interface {
+		index.addType(reflect.PtrTo(t))
+	}
+}
+
+// method returns the method of a native type with the function f.
+func (index *nativeIndex) method(f reflect.Value) (methodDecl, bool) {
+	if index.methods == nil {
+		index.methods = map[uintptr][]methodDecl{}
+		for t := range index.visited {
+			if t.Kind() == reflect.Interface {
+				continue
+			}
+			for i := 0; i < t.NumMethod(); i++ {
+				m := t.Method(i)
+				p := m.Func.Pointer()
+				index.methods[p] = append(index.methods[p], methodDecl{typ: t, name: m.Name})
+			}
+		}
+	}
+	for _, m := range index.methods[f.Pointer()] {
+		if method, _ := m.typ.MethodByName(m.name); method.Type == f.Type() {
+			return m, true
+		}
+	}
+	return methodDecl{}, false
+}
+
+// isReferencedByName reports whether t is a native type that is referenced
+// by name because it is a defined type or cannot be created with reflect.
+func isReferencedByName(t reflect.Type) bool {
+	if _, ok := t.(runtime.ScriggoType); ok {
+		return false
+	}
+	if t.Name() != "" {
+		return t.PkgPath() != ""
+	}
+	switch t.Kind() {
+	case reflect.Interface:
+		return t.NumMethod() > 0
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// nativeTypeKey returns the key of a native type referenced by name.
+func nativeTypeKey(t reflect.Type) string {
+	if t.Name() == "" {
+		return t.String()
+	}
+	return t.PkgPath() + "." + t.Name()
+}
+
+// typeFingerprint returns a string that describes the underlying type of t.
+// It is used to verify that a native type has not been changed.
+func typeFingerprint(t reflect.Type) string {
+	s := t.Kind().String()
+	switch t.Kind() {
+	case reflect.Array:
+		s += fmt.Sprintf("[%d]%s", t.Len(), t.Elem())
+	case reflect.Chan, reflect.Ptr, reflect.Slice:
+		s += " " + t.Elem().String()
+	case reflect.Map:
+		s += fmt.Sprintf("[%s]%s", t.Key(), t.Elem())
+	case reflect.Func:
+		s += " " + t.String()
+	case reflect.Interface:
+		for i := 0; i < t.NumMethod(); i++ {
+			m := t.Method(i)
+			s += fmt.Sprintf(" %s.%s %s;", m.PkgPath, m.Name, m.Type)
+		}
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			s += fmt.Sprintf(" %s.%s %s %q %t;", f.PkgPath, f.Name, f.Type, f.Tag, f.Anonymous)
+		}
+	}
+	return s
+}
+
+// encoder implements the encoding of a code.
+type encoder struct {
+	b       []byte
+	index   *nativeIndex
+	types   map[reflect.Type]int
+	fns     map[*runtime.Function]int
+	natives map[*runtime.NativeFunction]int
+}
+
+// encode encodes code.
+func (enc *encoder) encode(code *Code) {
+
+	enc.b = append(enc.b, codeMagic...)
+	enc.writeUint(codeVersion)
+	enc.writeStrings(code.Packages)
+
+	// Collect the functions and the native functions.
+	var fns []*runtime.Function
+	var natives []*runtime.NativeFunction
+	var collect func(fn *runtime.Function)
+	collect = func(fn *runtime.Function) {
+		if _, ok := enc.fns[fn]; ok {
+			return
+		}
+		enc.fns[fn] = len(fns)
+		fns = append(fns, fn)
+		for _, nf := range fn.NativeFunctions {
+			if _, ok := enc.natives[nf]; !ok {
+				enc.natives[nf] = len(natives)
+				natives = append(natives, nf)
+			}
+		}
+		for _, f := range fn.Functions {
+			collect(f)
+		}
+		for _, c := range fn.Inlined {
+			collect(c.Func)
+		}
+		if fn.Parent != nil {
+			collect(fn.Parent)
+		}
+	}
+	collect(code.Main)
+	if code.Init != nil {
+		collect(code.Init)
+	}
+	names := make([]string, 0, len(code.Functions))
+	for name := range code.Functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		collect(code.Functions[name])
+	}
+	for _, t := range code.Types {
+		for _, m := range types.Methods(t) {
+			collect(m.Func)
+		}
+	}
+	for _, fn := range code.Declared {
+		collect(fn)
+	}
+
+	// Encode the native functions.
+	enc.writeUint(uint64(len(natives)))
+	for _, nf := range natives {
+		enc.writeString(nf.Package())
+		enc.writeString(nf.Name())
+		enc.writeString(nf.Method())
+		if nf.Method() != "" {
+			enc.writeType(nf.Receiver())
+		}
+		if nf.Package() == "scriggo.complex" {
+			enc.writeByte(refComplex)
+			continue
+		}
+		enc.writeNativeRef(reflect.ValueOf(nf.Func()))
+	}
+
+	// Encode the functions.
+	enc.writeUint(uint64(len(fns)))
+	for _, fn := range fns {
+		enc.writeFunction(fn)
+	}
+	enc.writeUint(uint64(enc.fns[code.Main]))
+	enc.writeBool(code.Init != nil)
+	if code.Init != nil {
+		enc.writeUint(uint64(enc.fns[code.Init]))
+	}
+	enc.writeUint(uint64(len(names)))
+	for _, name := range names {
+		enc.writeString(name)
+		enc.writeUint(uint64(enc.fns[code.Functions[name]]))
+	}
+
+	// Encode the methods.
+	enc.writeUint(uint64(len(code.Types)))
+	for _, t := range code.Types {
+		enc.writeType(t)
+		methods := types.Methods(t)
+		enc.writeUint(uint64(len(methods)))
+		for _, m := range methods {
+			enc.writeString(m.Name)
+			enc.writeType(m.Type)
+			enc.writeBool(m.Ptr)
+			enc.writeUint(uint64(enc.fns[m.Func]))
+		}
+	}
+
+	// Encode the declared functions.
+	enc.writeUint(uint64(len(code.Declared)))
+	for _, fn := range code.Declared {
+		enc.writeUint(uint64(enc.fns[fn]))
+	}
+
+	// Encode the globals.
+	enc.writeUint(uint64(len(code.Globals)))
+	for _, global := range code.Globals {
+		enc.writeString(global.Pkg)
+		enc.writeString(global.Name)
+		enc.writeType(global.Type)
+		enc.writeBool(global.Value.IsValid())
+		if global.Value.IsValid() {
+			if !global.Value.CanAddr() {
+				panic(codingErrorf("cannot marshal global %s: it is not a variable", global.Name))
+			}
+			enc.writeNativeRef(global.Value.Addr())
+		}
+	}
+
+	// Encode the dependencies.
+	enc.writeUint(uint64(len(code.Dependencies)))
+	for _, dep := range code.Dependencies {
+		enc.writeString(dep.Path)
+		enc.writeString(dep.Parent)
+		enc.writeByte(byte(dep.Kind))
+		enc.writePosition(*convertPosition(&dep.Pos))
+	}
+
+}
+
+// writeFunction writes fn.
+func (enc *encoder) writeFunction(fn *runtime.Function) {
+	enc.writeString(fn.Pkg)
+	enc.writeString(fn.Name)
+	enc.writeString(fn.File)
+	enc.writeBool(fn.Pos != nil)
+	if fn.Pos != nil {
+		enc.writePosition(*fn.Pos)
+	}
+	enc.writeBool(fn.BodyPos != nil)
+	if fn.BodyPos != nil {
+		enc.writePosition(*fn.BodyPos)
+	}
+	enc.writeType(fn.Type)
+	if fn.Parent == nil {
+		enc.writeUint(0)
+	} else {
+		enc.writeUint(uint64(enc.fns[fn.Parent]) + 1)
+	}
+	enc.writeUint(uint64(len(fn.VarRefs)))
+	for _, ref := range fn.VarRefs {
+		enc.writeInt(int64(ref))
+	}
+	enc.writeUint(uint64(len(fn.Types)))
+	for _, t := range fn.Types {
+		enc.writeType(t)
+	}
+	for _, n := range fn.NumReg {
+		enc.writeInt(int64(n))
+	}
+	enc.writeUint(uint64(len(fn.FinalRegs)))
+	for _, regs := range fn.FinalRegs {
+		enc.writeInt(int64(regs[0]))
+		enc.writeInt(int64(regs[1]))
+	}
+	enc.writeBool(fn.Macro)
+	enc.writeUint(uint64(fn.Format))
+	enc.writeUint(uint64(len(fn.Values.Int)))
+	for _, v := range fn.Values.Int {
+		enc.writeInt(v)
+	}
+	enc.writeUint(uint64(len(fn.Values.Float)))
+	for _, v := range fn.Values.Float {
+		enc.writeUint(math.Float64bits(v))
+	}
+	enc.writeStrings(fn.Values.String)
+	enc.writeUint(uint64(len(fn.Values.General)))
+	for _, v := range fn.Values.General {
+		enc.writeValue(v)
+	}
+	enc.writeUint(uint64(len(fn.FieldIndexes)))
+	for _, indexes := range fn.FieldIndexes {
+		enc.writeUint(uint64(len(indexes)))
+		for _, i := range indexes {
+			enc.writeUint(uint64(i))
+		}
+	}
+	enc.writeUint(uint64(len(fn.Functions)))
+	for _, f := range fn.Functions {
+		enc.writeUint(uint64(enc.fns[f]))
+	}
+	enc.writeUint(uint64(len(fn.NativeFunctions)))
+	for _, nf := range fn.NativeFunctions {
+		enc.writeUint(uint64(enc.natives[nf]))
+	}
+	enc.writeUint(uint64(len(fn.Body)))
+	for _, in := range fn.Body {
+		enc.b = append(enc.b, byte(in.Op), byte(in.A), byte(in.B), byte(in.C))
+	}
+	enc.writeUint(uint64(len(fn.Text)))
+	for _, txt := range fn.Text {
+		enc.writeString(string(txt))
+	}
+	addrs := make([]int, 0, len(fn.InstructionInfo))
+	for addr := range fn.InstructionInfo {
+		addrs = append(addrs, int(addr))
+	}
+	sort.Ints(addrs)
+	enc.writeUint(uint64(len(addrs)))
+	for _, addr := range addrs {
+		info := fn.InstructionInfo[runtime.Addr(addr)]
+		enc.writeUint(uint64(addr))
+		enc.writePosition(info.Position)
+		enc.writeString(info.Path)
+		for _, k := range info.OperandKind {
+			enc.writeByte(byte(k))
+		}
+		enc.writeType(info.FuncType)
+	}
+	enc.writeVars(fn.Vars)
+	enc.writeStrings(fn.UpvarNames)
+	enc.writeUint(uint64(len(fn.Inlined)))
+	for _, c := range fn.Inlined {
+		enc.writeUint(uint64(enc.fns[c.Func]))
+		enc.writeInt(int64(c.Parent))
+		enc.writeUint(uint64(c.Start))
+		enc.writeUint(uint64(c.End))
+		enc.writeString(c.Path)
+		enc.writePosition(c.Position)
+		enc.writeVars(c.Vars)
+	}
+}
+
+// writeVars writes the local variables vars.
+func (enc *encoder) writeVars(vars []runtime.VarInfo) {
+	enc.writeUint(uint64(len(vars)))
+	for _, v := range vars {
+		enc.writeString(v.Name)
+		enc.writeType(v.Type)
+		enc.writeInt(int64(v.Reg))
+		enc.writeUint(uint64(v.Start))
+		enc.writeUint(uint64(v.End))
+	}
+}
+
+// writeType writes the type t.
+func (enc *encoder) writeType(t reflect.Type) {
+	if t == nil {
+		enc.writeByte(typeNil)
+		return
+	}
+	if id, ok := enc.types[t]; ok {
+		enc.writeByte(typeRef)
+		enc.writeUint(uint64(id))
+		return
+	}
+	_, isScriggoType := t.(runtime.ScriggoType)
+	switch {
+	case isScriggoType && t.Name() != "":
+		enc.writeByte(typeDefined)
+		enc.writeString(t.Name())
+		enc.writeType(types.Underlying(t))
+	case isReferencedByName(t):
+		key := nativeTypeKey(t)
+		if enc.index.types[key] != t {
+			panic(codingErrorf("cannot marshal type %s: it is not reachable from the native declarations", t))
+		}
+		enc.writeByte(typeNative)
+		enc.writeString(key)
+		enc.writeString(typeFingerprint(t))
+	case t.Name() != "":
+		if t == errorType {
+			enc.writeByte(typeError)
+			break
+		}
+		if basicTypes[t.Kind()] != t {
+			panic(codingErrorf("cannot marshal type %s", t))
+		}
+		enc.writeByte(typeBasic)
+		enc.writeByte(byte(t.Kind()))
+	default:
+		switch t.Kind() {
+		case reflect.Array:
+			enc.writeByte(typeArray)
+			enc.writeUint(uint64(t.Len()))
+			enc.writeType(t.Elem())
+		case reflect.Chan:
+			enc.writeByte(typeChan)
+			enc.writeByte(byte(t.ChanDir()))
+			enc.writeType(t.Elem())
+		case reflect.Func:
+			enc.writeByte(typeFunc)
+			enc.writeBool(t.IsVariadic())
+			enc.writeUint(uint64(t.NumIn()))
+			for i := 0; i < t.NumIn(); i++ {
+				enc.writeType(t.In(i))
+			}
+			enc.writeUint(uint64(t.NumOut()))
+			for i := 0; i < t.NumOut(); i++ {
+				enc.writeType(t.Out(i))
+			}
+		case reflect.Interface:
+			if !isScriggoType {
+				enc.writeByte(typeEmptyInterface)
+				break
+			}
+			enc.writeByte(typeInterface)
+			enc.writeUint(uint64(t.NumMethod()))
+			for i := 0; i < t.NumMethod(); i++ {
+				m := t.Method(i)
+				enc.writeString(m.Name)
+				enc.writeString(m.PkgPath)
+				enc.writeType(m.Type)
+			}
+		case reflect.Map:
+			enc.writeByte(typeMap)
+			enc.writeType(t.Key())
+			enc.writeType(t.Elem())
+		case reflect.Ptr:
+			enc.writeByte(typePtr)
+			enc.writeType(t.Elem())
+		case reflect.Slice:
+			enc.writeByte(typeSlice)
+			enc.writeType(t.Elem())
+		case reflect.Struct:
+			enc.writeByte(typeStruct)
+			enc.writeUint(uint64(t.NumField()))
+			for i := 0; i < t.NumField(); i++ {
+				field := t.Field(i)
+				enc.writeString(field.Name)
+				enc.writeType(field.Type)
+				enc.writeString(string(field.Tag))
+				enc.writeBool(field.Anonymous)
+			}
+		default:
+			panic(codingErrorf("cannot marshal type %s", t))
+		}
+	}
+	enc.types[t] = len(enc.types)
+}
+
+// writeValue writes the value v.
+func (enc *encoder) writeValue(v reflect.Value) {
+	if !v.IsValid() {
+		enc.writeByte(valueInvalid)
+		return
+	}
+	t := v.Type()
+	if v.IsZero() {
+		enc.writeByte(valueZero)
+		enc.writeType(t)
+		return
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		enc.writeByte(valueBool)
+		enc.writeType(t)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		enc.writeByte(valueInt)
+		enc.writeType(t)
+		enc.writeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		enc.writeByte(valueUint)
+		enc.writeType(t)
+		enc.writeUint(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		enc.writeByte(valueFloat)
+		enc.writeType(t)
+		enc.writeUint(math.Float64bits(v.Float()))
+	case reflect.Complex64, reflect.Complex128:
+		enc.writeByte(valueComplex)
+		enc.writeType(t)
+		c := v.Complex()
+		enc.writeUint(math.Float64bits(real(c)))
+		enc.writeUint(math.Float64bits(imag(c)))
+	case reflect.String:
+		enc.writeByte(valueString)
+		enc.writeType(t)
+		enc.writeString(v.String())
+	case reflect.Func, reflect.Ptr:
+		enc.writeByte(valueNative)
+		enc.writeNativeRef(v)
+	case reflect.Array:
+		enc.writeByte(valueArray)
+		enc.writeType(t)
+		for i := 0; i < v.Len(); i++ {
+			enc.writeElem(v.Index(i))
+		}
+	case reflect.Slice:
+		enc.writeByte(valueSlice)
+		enc.writeType(t)
+		enc.writeUint(uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			enc.writeElem(v.Index(i))
+		}
+	case reflect.Map:
+		enc.writeByte(valueMap)
+		enc.writeType(t)
+		enc.writeUint(uint64(v.Len()))
+		iter := v.MapRange()
+		for iter.Next() {
+			enc.writeElem(iter.Key())
+			enc.writeElem(iter.Value())
+		}
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath != "" {
+				panic(codingErrorf("cannot marshal value of type %s", t))
+			}
+		}
+		enc.writeByte(valueStruct)
+		enc.writeType(t)
+		for i := 0; i < v.NumField(); i++ {
+			enc.writeElem(v.Field(i))
+		}
+	default:
+		panic(codingErrorf("cannot marshal value of type %s", t))
+	}
+}
+
+// writeElem writes v, an element of a composite value.
+func (enc *encoder) writeElem(v reflect.Value) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	enc.writeValue(v)
+}
+
+// writeNativeRef writes a reference to the native function or variable v.
+// If v is a variable, it must be a pointer to the variable.
+func (enc *encoder) writeNativeRef(v reflect.Value) {
+	enc.writeType(v.Type())
+	if v.IsNil() {
+		enc.writeByte(refNil)
+		return
+	}
+	for _, decl := range enc.index.decls[declKey{v.Kind(), v.Pointer()}] {
+		if decl.value.Type() == v.Type() {
+			enc.writeByte(refDecl)
+			enc.writeBool(decl.global)
+			enc.writeStrings(decl.path)
+			return
+		}
+	}
+	if v.Kind() == reflect.Func {
+		if m, ok := enc.index.method(v); ok {
+			enc.writeByte(refMethod)
+			enc.writeType(m.typ)
+			enc.writeString(m.name)
+			return
+		}
+	}
+	panic(codingErrorf("cannot marshal value of type %s: it is not a native declaration", v.Type()))
+}
+
+func (enc *encoder) writeBool(b bool) {
+	if b {
+		enc.b = append(enc.b, 1)
+	} else {
+		enc.b = append(enc.b, 0)
+	}
+}
+
+func (enc *encoder) writeByte(b byte) {
+	enc.b = append(enc.b, b)
+}
+
+func (enc *encoder) writeInt(n int64) {
+	var buf [binary.MaxVarintLen64]byte
+	enc.b = append(enc.b, buf[:binary.PutVarint(buf[:], n)]...)
+}
+
+func (enc *encoder) writePosition(pos runtime.Position) {
+	enc.writeUint(uint64(pos.Line))
+	enc.writeUint(uint64(pos.Column))
+	enc.writeUint(uint64(pos.Start))
+	enc.writeUint(uint64(pos.End))
+}
+
+func (enc *encoder) writeString(s string) {
+	enc.writeUint(uint64(len(s)))
+	enc.b = append(enc.b, s...)
+}
+
+func (enc *encoder) writeStrings(s []string) {
+	enc.writeUint(uint64(len(s)))
+	for _, e := range s {
+		enc.writeString(e)
+	}
+}
+
+func (enc *encoder) writeUint(n uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	enc.b = append(enc.b, buf[:binary.PutUvarint(buf[:], n)]...)
+}
+
+// maxDecodingDepth is the maximum depth of the nested types and values that
+// can be decoded.
+const maxDecodingDepth = 1000
+
+// decoder implements the decoding of a code.
+type decoder struct {
+	b       []byte
+	opts    Options
+	index   *nativeIndex
+	types   *types.Types
+	typs    []reflect.Type
+	fns     []*runtime.Function
+	natives []*runtime.NativeFunction
+	depth   int // depth of the type or value that is decoded.
+}
+
+// enter enters a nested type or value. It panics if the depth exceeds
+// maxDecodingDepth.
+func (dec *decoder) enter() {
+	dec.depth++
+	if dec.depth > maxDecodingDepth {
+		panic(codingErrorf("invalid code"))
+	}
+}
+
+// exit exits a nested type or value.
+func (dec *decoder) exit() {
+	dec.depth--
+}
+
+// decode decodes a code.
+func (dec *decoder) decode() *Code {
+
+	if v := dec.readUint(); v != codeVersion {
+		panic(codingErrorf("code has been marshaled with an incompatible version"))
+	}
+
+	code := &Code{TypeOf: dec.types.TypeOf}
+	code.Packages = dec.readStrings()
+	var err error
+	dec.index, err = newNativeIndex(code.Packages, dec.opts)
+	if err != nil {
+		panic(codingError{err.Error()})
+	}
+
+	// Decode the native functions.
+	dec.natives = make([]*runtime.NativeFunction, dec.readCount())
+	for i := range dec.natives {
+		pkg := dec.readString()
+		name := dec.readString()
+		method := dec.readString()
+		var rcv reflect.Type
+		if method != "" {
+			rcv = dec.readNonNilType()
+			if _, ok := rcv.(runtime.ScriggoType); ok {
+				panic(codingErrorf("invalid code"))
+			}
+		}
+		var fn interface{}
+		if pkg == "scriggo.complex" {
+			if dec.readByte() != refComplex {
+				panic(codingErrorf("invalid code"))
+			}
+			var ok bool
+			fn, ok = complexFunctions[name]
+			if !ok {
+				panic(codingErrorf("invalid code"))
+			}
+		} else {
+			v := dec.readNativeRef("")
+			if v.Kind() != reflect.Func || v.IsNil() {
+				panic(codingErrorf("invalid code"))
+			}
+			fn = v.Interface()
+		}
+		if method != "" {
+			dec.natives[i] = runtime.NewNativeMethod(rcv, method, fn)
+		} else {
+			dec.natives[i] = runtime.NewNativeFunction(pkg, name, fn)
+		}
+	}
+
+	// Decode the functions.
+	dec.fns = make([]*runtime.Function, dec.readCount())
+	for i := range dec.fns {
+		dec.fns[i] = &runtime.Function{}
+	}
+	for _, fn := range dec.fns {
+		dec.readFunction(fn)
+	}
+	code.Main = dec.readFunctionRef()
+	if dec.readBool() {
+		code.Init = dec.readFunctionRef()
+	}
+	if n := dec.readCount(); n > 0 {
+		code.Functions = make(map[string]*runtime.Function, n)
+		for i := 0; i < n; i++ {
+			name := dec.readString()
+			code.Functions[name] = dec.readFunctionRef()
+		}
+	}
+
+	// Decode the methods.
+	if n := dec.readCount(); n > 0 {
+		code.Types = make([]reflect.Type, n)
+		for i := range code.Types {
+			t := dec.readNonNilType()
+			if _, ok := t.(runtime.ScriggoType); !ok || t.Name() == "" {
+				panic(codingErrorf("invalid code"))
+			}
+			code.Types[i] = t
+			for k := dec.readCount(); k > 0; k-- {
+				m := &types.Method{}
+				m.Name = dec.readString()
+				m.Type = dec.readNonNilType()
+				m.Ptr = dec.readBool()
+				m.Func = dec.readFunctionRef()
+				if _, ok := types.MethodByName(dec.types.PtrTo(t), m.Name); ok {
+					panic(codingErrorf("invalid code"))
+				}
+				types.AddMethod(t, m)
+			}
+		}
+	}
+
+	// Decode the declared functions.
+	if n := dec.readCount(); n > 0 {
+		code.Declared = make([]*runtime.Function, n)
+		for i := range code.Declared {
+			code.Declared[i] = dec.readFunctionRef()
+		}
+	}
+
+	// Decode the globals.
+	if n := dec.readCount(); n > 0 {
+		code.Globals = make([]Global, n)
+		for i := range code.Globals {
+			global := &code.Globals[i]
+			global.Pkg = dec.readString()
+			global.Name = dec.readString()
+			global.Type = dec.readType()
+			if dec.readBool() {
+				v := dec.readNativeRef(global.Name)
+				if v.Kind() != reflect.Ptr || v.IsNil() || v.Type().Elem() != global.Type {
+					panic(codingErrorf("invalid code"))
+				}
+				global.Value = v.Elem()
+			}
+		}
+	}
+
+	// Decode the dependencies.
+	if n := dec.readCount(); n > 0 {
+		code.Dependencies = make([]Dependency, n)
+		for i := range code.Dependencies {
+			dep := &code.Dependencies[i]
+			dep.Path = dec.readString()
+			dep.Parent = dec.readString()
+			dep.Kind = DependencyKind(dec.readByte())
+			pos := dec.readPosition()
+			dep.Pos = ast.Position{Line: pos.Line, Column: pos.Column, Start: pos.Start, End: pos.End}
+		}
+	}
+
+	if len(dec.b) > 0 {
+		panic(codingErrorf("invalid code"))
+	}
+
+	for _, fn := range dec.fns {
+		validateFunction(fn)
+	}
+
+	return code
+}
+
+// readFunction reads a function into fn.
+func (dec *decoder) readFunction(fn *runtime.Function) {
+	fn.Pkg = dec.readString()
+	fn.Name = dec.readString()
+	fn.File = dec.readString()
+	if dec.readBool() {
+		pos := dec.readPosition()
+		fn.Pos = &pos
+	}
+	if dec.readBool() {
+		pos := dec.readPosition()
+		fn.BodyPos = &pos
+	}
+	fn.Type = dec.readType()
+	if i := dec.readIndex(); i > 0 {
+		if i > len(dec.fns) {
+			panic(codingErrorf("invalid code"))
+		}
+		fn.Parent = dec.fns[i-1]
+	}
+	if n := dec.readCount(); n > 0 {
+		fn.VarRefs = make([]int16, n)
+		for i := range fn.VarRefs {
+			fn.VarRefs[i] = int16(dec.readInt())
+		}
+	}
+	if n := dec.readCount(); n > 0 {
+		fn.Types = make([]reflect.Type, n)
+		for i := range fn.Types {
+			fn.Types[i] = dec.readType()
+		}
+	}
+	for i := range fn.NumReg {
+		fn.NumReg[i] = int16(dec.readInt())
+	}
+	if n := dec.readCount(); n > 0 {
+		fn.FinalRegs = make([][2]int16, n)
+		for i := range fn.FinalRegs {
+			fn.FinalRegs[i] = [2]int16{int16(dec.readInt()), int16(dec.readInt())}
+		}
+	}
+	fn.Macro = dec.readBool()
+	fn.Format = ast.Format(dec.readUint())
+	if n := dec.readCount(); n > 0 {
+		fn.Values.Int = make([]int64, n)
+		for i := range fn.Values.Int {
+			fn.Values.Int[i] = dec.readInt()
+		}
+	}
+	if n := dec.readCount(); n > 0 {
+		fn.Values.Float = make([]float64, n)
+		for i := range fn.Values.Float {
+			fn.Values.Float[i] = math.Float64frombits(dec.readUint())
+		}
+	}
+	fn.Values.String = dec.readStrings()
+	if n := dec.readCount(); n > 0 {
+		fn.Values.General = make([]reflect.Value, n)
+		for i := range fn.Values.General {
+			fn.Values.General[i] = dec.readValue()
+		}
+	}
+	if n := dec.readCount(); n > 0 {
+		fn.FieldIndexes = make([][]int, n)
+		for i := range fn.FieldIndexes {
+			indexes := make([]int, dec.readCount())
+			for j := range indexes {
+				indexes[j] = dec.readIndex()
+			}
+			fn.FieldIndexes[i] = indexes
+		}
+	}
+	if n := dec.readCount(); n > 0 {
+		fn.Functions = make([]*runtime.Function, n)
+		for i := range fn.Functions {
+			fn.Functions[i] = dec.readFunctionRef()
+		}
+	}
+	if n := dec.readCount(); n > 0 {
+		fn.NativeFunctions = make([]*runtime.NativeFunction, n)
+		for i := range fn.NativeFunctions {
+			j := dec.readIndex()
+			if j >= len(dec.natives) {
+				panic(codingErrorf("invalid code"))
+			}
+			fn.NativeFunctions[i] = dec.natives[j]
+		}
+	}
+	if n := dec.readCount(); n > 0 {
+		if 4*n > len(dec.b) {
+			panic(codingErrorf("invalid code"))
+		}
+		fn.Body = make([]runtime.Instruction, n)
+		for i := range fn.Body {
+			b := dec.b[4*i:]
+			fn.Body[i] = runtime.Instruction{Op: runtime.Operation(b[0]), A: int8(b[1]), B: int8(b[2]), C: int8(b[3])}
+		}
+		dec.b = dec.b[4*n:]
+	}
+	if n := dec.readCount(); n > 0 {
+		fn.Text = make([][]byte, n)
+		for i := range fn.Text {
+			fn.Text[i] = []byte(dec.readString())
+		}
+	}
+	if n := dec.readCount(); n > 0 {
+		fn.InstructionInfo = make(map[runtime.Addr]runtime.InstructionInfo, n)
+		for i := 0; i < n; i++ {
+			addr := runtime.Addr(dec.readUint())
+			var info runtime.InstructionInfo
+			info.Position = dec.readPosition()
+			info.Path = dec.readString()
+			for j := range info.OperandKind {
+				info.OperandKind[j] = reflect.Kind(dec.readByte())
+			}
+			info.FuncType = dec.readType()
+			fn.InstructionInfo[addr] = info
+		}
+	}
+	fn.Vars = dec.readVars()
+	fn.UpvarNames = dec.readStrings()
+	if n := dec.readCount(); n > 0 {
+		fn.Inlined = make([]runtime.InlinedCall, n)
+		for i := range fn.Inlined {
+			c := &fn.Inlined[i]
+			c.Func = dec.readFunctionRef()
+			c.Parent = int(dec.readInt())
+			if c.Parent < -1 || c.Parent >= i {
+				panic(codingErrorf("invalid code"))
+			}
+			c.Start = runtime.Addr(dec.readUint())
+			c.End = runtime.Addr(dec.readUint())
+			c.Path = dec.readString()
+			c.Position = dec.readPosition()
+			c.Vars = dec.readVars()
+		}
+	}
+}
+
+// validateFunction validates the body of fn, a decoded function, so that the
+// indexes in its instructions refer to the elements of the tables of fn that
+// the VM accesses when it executes them.
+func validateFunction(fn *runtime.Function) {
+	for _, n := range fn.NumReg {
+		if n < 0 {
+			panic(codingErrorf("invalid code"))
+		}
+	}
+	hasType := func(i int16) bool {
+		j := int(uint8(i))
+		return j < len(fn.Types) && fn.Types[j] != nil
+	}
+	body := fn.Body
+	end := runtime.Addr(len(body))
+	// stackShiftSize returns the number of words of the stack shift at addr.
+	stackShiftSize := func(addr runtime.Addr) runtime.Addr {
+		if addr < end && body[addr].Op < 0 {
+			return 4
+		}
+		return 1
+	}
+	for addr := runtime.Addr(0); addr < end; {
+		if body[addr].Op == runtime.OpWide {
+			addr++
+			if addr == end {
+				panic(codingErrorf("invalid code"))
+			}
+		}
+		op := body[addr].Op
+		a, b, c := decodeOperands(body, addr)
+		addr++
+		ok := true
+		var n runtime.Addr // number of words that follow the instruction.
+		switch op {
+		case runtime.OpAssert, runtime.OpConvert, runtime.OpConvertInt, runtime.OpConvertUint,
+			runtime.OpConvertFloat, runtime.OpConvertString, runtime.OpMakeArray, runtime.OpMakeStruct, runtime.OpNew:
+			ok = hasType(b)
+		case runtime.OpMakeChan, -runtime.OpMakeChan, runtime.OpMakeMap, -runtime.OpMakeMap,
+			runtime.OpShow, runtime.OpTypify, -runtime.OpTypify:
+			ok = hasType(a)
+		case runtime.OpMakeSlice:
+			ok = hasType(a)
+			if b > 0 {
+				n = 1
+				if b&8 != 0 {
+					n = 2
+				}
+			}
+		case runtime.OpSlice, runtime.OpStringSlice:
+			n = 1
+			if b&8 != 0 {
+				n = 2
+			}
+		case runtime.OpCallFunc, runtime.OpCallMacro:
+			ok = int(uint16(a)) < len(fn.Functions)
+			n = stackShiftSize(addr)
+		case runtime.OpCallNative:
+			ok = int(uint16(a)) < len(fn.NativeFunctions)
+			n = stackShiftSize(addr)
+		case runtime.OpCallIndirect:
+			n = stackShiftSize(addr)
+		case runtime.OpDefer:
+			n = stackShiftSize(addr)
+			n += stackShiftSize(addr + n)
+		case runtime.OpTailCall:
+			if a != runtime.CurrentFunction && a != 0 {
+				ok = int(uint16(b)) < len(fn.Functions)
+			}
+		case runtime.OpLoadFunc:
+			if a == 1 {
+				ok = int(uint16(b)) < len(fn.NativeFunctions)
+				break
+			}
+			ok = int(uint16(b)) < len(fn.Functions)
+		case runtime.OpLoad:
+			t, i := decodeValueIndex(int8(a), int8(b))
+			switch t {
+			case intRegister:
+				ok = i < len(fn.Values.Int)
+			case floatRegister:
+				ok = i < len(fn.Values.Float)
+			case stringRegister:
+				ok = i < len(fn.Values.String)
+			case generalRegister:
+				ok = i < len(fn.Values.General)
+			}
+		case runtime.OpMethodValue:
+			ok = int(uint8(b)) < len(fn.Values.String)
+		case runtime.OpField:
+			ok = int(uint8(b)) < len(fn.FieldIndexes)
+		case runtime.OpSetField, -runtime.OpSetField:
+			ok = int(uint8(c)) < len(fn.FieldIndexes)
+		case runtime.OpText:
+			ok = int(decodeUint16(int8(a), int8(b))) < len(fn.Text)
+		case runtime.OpGoto, runtime.OpBreak, runtime.OpContinue:
+			ok = runtime.Addr(decodeUint24(int8(a), int8(b), int8(c))) < end
+		}
+		if !ok || n > end-addr {
+			panic(codingErrorf("invalid code"))
+		}
+		addr += n
+	}
+	for addr := range fn.InstructionInfo {
+		if addr >= end {
+			panic(codingErrorf("invalid code"))
+		}
+	}
+	for _, c := range fn.Inlined {
+		if c.Start > c.End || c.End > end {
+			panic(codingErrorf("invalid code"))
+		}
+	}
+}
+
+// readVars reads local variables.
+func (dec *decoder) readVars() []runtime.VarInfo {
+	n := dec.readCount()
+	if n == 0 {
+		return nil
+	}
+	vars := make([]runtime.VarInfo, n)
+	for i := range vars {
+		v := &vars[i]
+		v.Name = dec.readString()
+		v.Type = dec.readType()
+		v.Reg = int16(dec.readInt())
+		v.Start = runtime.Addr(dec.readUint())
+		v.End = runtime.Addr(dec.readUint())
+	}
+	return vars
+}
+
+// readFunctionRef reads a reference to a function.
+func (dec *decoder) readFunctionRef() *runtime.Function {
+	i := dec.readIndex()
+	if i >= len(dec.fns) {
+		panic(codingErrorf("invalid code"))
+	}
+	return dec.fns[i]
+}
+
+// readType reads a type. It validates the type so that it can be created
+// with reflect.
+func (dec *decoder) readType() reflect.Type {
+	dec.enter()
+	defer dec.exit()
+	var t reflect.Type
+	switch tag := dec.readByte(); tag {
+	case typeRef:
+		id := dec.readIndex()
+		if id >= len(dec.typs) {
+			panic(codingErrorf("invalid code"))
+		}
+		return dec.typs[id]
+	case typeNil:
+		return nil
+	case typeBasic:
+		var ok bool
+		t, ok = basicTypes[reflect.Kind(dec.readByte())]
+		if !ok {
+			panic(codingErrorf("invalid code"))
+		}
+	case typeEmptyInterface:
+		t = emptyInterfaceType
+	case typeError:
+		t = errorType
+	case typeNative:
+		key := dec.readString()
+		fingerprint := dec.readString()
+		var ok bool
+		t, ok = dec.index.types[key]
+		if !ok {
+			panic(codingErrorf("type %s does not exist", key))
+		}
+		if typeFingerprint(t) != fingerprint {
+			panic(codingErrorf("type %s has been changed", key))
+		}
+	case typeDefined:
+		name := dec.readString()
+		underlying := dec.readType()
+		if name == "" || underlying == nil {
+			panic(codingErrorf("invalid code"))
+		}
+		t = dec.types.DefinedOf(name, underlying)
+	case typeArray:
+		n := dec.readIndex()
+		elem := dec.readNonNilType()
+		t = makeType(func() reflect.Type { return dec.types.ArrayOf(n, elem) })
+	case typeChan:
+		dir := reflect.ChanDir(dec.readByte())
+		if dir != reflect.RecvDir && dir != reflect.SendDir && dir != reflect.BothDir {
+			panic(codingErrorf("invalid code"))
+		}
+		elem := dec.readNonNilType()
+		t = makeType(func() reflect.Type { return dec.types.ChanOf(dir, elem) })
+	case typeFunc:
+		variadic := dec.readBool()
+		in := make([]reflect.Type, dec.readCount())
+		for i := range in {
+			in[i] = dec.readNonNilType()
+		}
+		out := make([]reflect.Type, dec.readCount())
+		for i := range out {
+			out[i] = dec.readNonNilType()
+		}
+		if variadic && (len(in) == 0 || in[len(in)-1].Kind() != reflect.Slice) {
+			panic(codingErrorf("invalid code"))
+		}
+		t = makeType(func() reflect.Type { return dec.types.FuncOf(in, out, variadic) })
+	case typeMap:
+		key := dec.readNonNilType()
+		if !key.Comparable() {
+			panic(codingErrorf("invalid code"))
+		}
+		elem := dec.readNonNilType()
+		t = makeType(func() reflect.Type { return dec.types.MapOf(key, elem) })
+	case typePtr:
+		elem := dec.readNonNilType()
+		t = makeType(func() reflect.Type { return dec.types.PtrTo(elem) })
+	case typeSlice:
+		elem := dec.readNonNilType()
+		t = makeType(func() reflect.Type { return dec.types.SliceOf(elem) })
+	case typeStruct:
+		fields := make([]reflect.StructField, dec.readCount())
+		names := make(map[string]bool, len(fields))
+		for i := range fields {
+			name := dec.readString()
+			if !isFieldName(name) || names[name] {
+				panic(codingErrorf("invalid code"))
+			}
+			if name != "_" {
+				names[name] = true
+			}
+			fields[i].Name = name
+			fields[i].Type = dec.readNonNilType()
+			fields[i].Tag = reflect.StructTag(dec.readString())
+			fields[i].Anonymous = dec.readBool()
+		}
+		t = makeType(func() reflect.Type { return dec.types.StructOf(fields) })
+	case typeInterface:
+		methods := make([]reflect.Method, dec.readCount())
+		for i := range methods {
+			methods[i].Name = dec.readString()
+			methods[i].PkgPath = dec.readString()
+			methods[i].Type = dec.readNonNilType()
+			if !isFieldName(methods[i].Name) || methods[i].Name == "_" || methods[i].Type.Kind() != reflect.Func {
+				panic(codingErrorf("invalid code"))
+			}
+			if i > 0 && methods[i].Name <= methods[i-1].Name {
+				panic(codingErrorf("invalid code"))
+			}
+		}
+		if len(methods) == 0 {
+			panic(codingErrorf("invalid code"))
+		}
+		t = makeType(func() reflect.Type { return dec.types.InterfaceOf(methods) })
+	default:
+		panic(codingErrorf("invalid code"))
+	}
+	dec.typs = append(dec.typs, t)
+	return t
+}
+
+// makeType calls f, that makes a type with reflect, and returns the type.
+// The decoded types are validated, but they can still be types that reflect
+// does not allow, as an array too large, so if f panics, makeType panics
+// with an invalid code error.
+func makeType(f func() reflect.Type) reflect.Type {
+	defer func() {
+		if recover() != nil {
+			panic(codingErrorf("invalid code"))
+		}
+	}()
+	return f()
+}
+
+// readNonNilType reads a type that cannot be nil.
+func (dec *decoder) readNonNilType() reflect.Type {
+	t := dec.readType()
+	if t == nil {
+		panic(codingErrorf("invalid code"))
+	}
+	return t
+}
+
+// readValue reads a value.
+func (dec *decoder) readValue() reflect.Value {
+	dec.enter()
+	defer dec.exit()
+	tag := dec.readByte()
+	switch tag {
+	case valueInvalid:
+		return reflect.Value{}
+	case valueNative:
+		return dec.readNativeRef("")
+	}
+	t := dec.readNonNilType()
+	if _, ok := t.(runtime.ScriggoType); ok {
+		panic(codingErrorf("invalid code"))
+	}
+	if !isValueKind(tag, t.Kind()) {
+		panic(codingErrorf("invalid code"))
+	}
+	v := reflect.New(t).Elem()
+	switch tag {
+	case valueZero:
+	case valueBool:
+		v.SetBool(true)
+	case valueInt:
+		v.SetInt(dec.readInt())
+	case valueUint:
+		v.SetUint(dec.readUint())
+	case valueFloat:
+		v.SetFloat(math.Float64frombits(dec.readUint()))
+	case valueComplex:
+		re := math.Float64frombits(dec.readUint())
+		im := math.Float64frombits(dec.readUint())
+		v.SetComplex(complex(re, im))
+	case valueString:
+		v.SetString(dec.readString())
+	case valueArray:
+		for i := 0; i < v.Len(); i++ {
+			dec.readElem(v.Index(i))
+		}
+	case valueSlice:
+		n := dec.readCount()
+		v.Set(reflect.MakeSlice(t, n, n))
+		for i := 0; i < n; i++ {
+			dec.readElem(v.Index(i))
+		}
+	case valueMap:
+		n := dec.readCount()
+		v.Set(reflect.MakeMapWithSize(t, n))
+		for i := 0; i < n; i++ {
+			key := reflect.New(t.Key()).Elem()
+			dec.readElem(key)
+			elem := reflect.New(t.Elem()).Elem()
+			dec.readElem(elem)
+			v.SetMapIndex(key, elem)
+		}
+	case valueStruct:
+		for i := 0; i < v.NumField(); i++ {
+			if t.Field(i).PkgPath != "" {
+				panic(codingErrorf("invalid code"))
+			}
+			dec.readElem(v.Field(i))
+		}
+	default:
+		panic(codingErrorf("invalid code"))
+	}
+	return v
+}
+
+// isValueKind reports whether a value with the given tag can have a type
+// with kind k.
+func isValueKind(tag byte, k reflect.Kind) bool {
+	switch tag {
+	case valueZero:
+		return true
+	case valueBool:
+		return k == reflect.Bool
+	case valueInt:
+		return reflect.Int <= k && k <= reflect.Int64
+	case valueUint:
+		return reflect.Uint <= k && k <= reflect.Uintptr
+	case valueFloat:
+		return k == reflect.Float32 || k == reflect.Float64
+	case valueComplex:
+		return k == reflect.Complex64 || k == reflect.Complex128
+	case valueString:
+		return k == reflect.String
+	case valueArray:
+		return k == reflect.Array
+	case valueSlice:
+		return k == reflect.Slice
+	case valueMap:
+		return k == reflect.Map
+	case valueStruct:
+		return k == reflect.Struct
+	}
+	return false
+}
+
+// readElem reads an element of a composite value into v.
+func (dec *decoder) readElem(v reflect.Value) {
+	e := dec.readValue()
+	if !e.IsValid() {
+		return
+	}
+	if !e.Type().AssignableTo(v.Type()) {
+		panic(codingErrorf("invalid code"))
+	}
+	v.Set(e)
+}
+
+// readNativeRef reads a reference to a native function or variable and
+// returns its value. name is used in the error messages.
+func (dec *decoder) readNativeRef(name string) reflect.Value {
+	t := dec.readNonNilType()
+	var v reflect.Value
+	switch dec.readByte() {
+	case refDecl:
+		global := dec.readBool()
+		path := dec.readStrings()
+		decl, err := dec.lookup(global, path)
+		if err != nil {
+			panic(codingError{err.Error()})
+		}
+		v = reflect.ValueOf(decl)
+		if name == "" {
+			name = path[len(path)-1]
+		}
+	case refNil:
+		if k := t.Kind(); k != reflect.Func && k != reflect.Ptr {
+			panic(codingErrorf("invalid code"))
+		}
+		return reflect.Zero(t)
+	case refMethod:
+		typ := dec.readNonNilType()
+		if _, ok := typ.(runtime.ScriggoType); ok {
+			panic(codingErrorf("invalid code"))
+		}
+		method := dec.readString()
+		m, ok := typ.MethodByName(method)
+		if !ok {
+			panic(codingErrorf("method %s.%s does not exist", typ, method))
+		}
+		v = m.Func
+		if name == "" {
+			name = typ.String() + "." + method
+		}
+	default:
+		panic(codingErrorf("invalid code"))
+	}
+	if !v.IsValid() || v.Type() != t {
+		panic(codingErrorf("%s does not have type %s", name, t))
+	}
+	return v
+}
+
+// lookup looks up the native declaration with the given path. If global is
+// true, the declaration is looked up in the globals, otherwise path[0] is
+// the path of the package.
+func (dec *decoder) lookup(global bool, path []string) (native.Declaration, error) {
+	if len(path) == 0 {
+		return nil, errors.New("scriggo: invalid code")
+	}
+	var pkg native.ImportablePackage
+	if global {
+		pkg = native.Package{Name: "main", Declarations: dec.opts.Globals}
+	} else {
+		if dec.opts.Importer == nil {
+			return nil, fmt.Errorf("scriggo: cannot find package %q", path[0])
+		}
+		var err error
+		pkg, err = dec.opts.Importer.Import(path[0])
+		if err != nil {
+			return nil, err
+		}
+		if pkg == nil {
+			return nil, fmt.Errorf("scriggo: cannot find package %q", path[0])
+		}
+		path = path[1:]
+	}
+	for i, name := range path {
+		decl := pkg.Lookup(name)
+		if decl == nil {
+			return nil, fmt.Errorf("scriggo: %s is not declared", name)
+		}
+		if i == len(path)-1 {
+			return decl, nil
+		}
+		var ok bool
+		pkg, ok = decl.(native.ImportablePackage)
+		if !ok {
+			return nil, fmt.Errorf("scriggo: %s is not a package", name)
+		}
+	}
+	return nil, errors.New("scriggo: invalid code")
+}
+
+// isFieldName reports whether name can be the name of a struct field or of
+// an interface method.
+func isFieldName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if r != '_' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (dec *decoder) readBool() bool {
+	return dec.readByte() != 0
+}
+
+func (dec *decoder) readByte() byte {
+	if len(dec.b) == 0 {
+		panic(codingErrorf("invalid code"))
+	}
+	b := dec.b[0]
+	dec.b = dec.b[1:]
+	return b
+}
+
+func (dec *decoder) readInt() int64 {
+	n, size := binary.Varint(dec.b)
+	if size <= 0 {
+		panic(codingErrorf("invalid code"))
+	}
+	dec.b = dec.b[size:]
+	return n
+}
+
+// readCount reads the number of elements that follow.
+func (dec *decoder) readCount() int {
+	n := dec.readUint()
+	if n > uint64(len(dec.b)) {
+		panic(codingErrorf("invalid code"))
+	}
+	return int(n)
+}
+
+// readIndex reads an index or a non-negative integer.
+func (dec *decoder) readIndex() int {
+	n := dec.readUint()
+	if n > math.MaxInt32 {
+		panic(codingErrorf("invalid code"))
+	}
+	return int(n)
+}
+
+func (dec *decoder) readPosition() runtime.Position {
+	return runtime.Position{
+		Line:   dec.readIndex(),
+		Column: dec.readIndex(),
+		Start:  dec.readIndex(),
+		End:    dec.readIndex(),
+	}
+}
+
+func (dec *decoder) readString() string {
+	n := dec.readIndex()
+	if n > len(dec.b) {
+		panic(codingErrorf("invalid code"))
+	}
+	s := string(dec.b[:n])
+	dec.b = dec.b[n:]
+	return s
+}
+
+func (dec *decoder) readStrings() []string {
+	n := dec.readCount()
+	if n == 0 {
+		return nil
+	}
+	s := make([]string, n)
+	for i := range s {
+		s[i] = dec.readString()
+	}
+	return s
+}
+
+func (dec *decoder) readUint() uint64 {
+	n, size := binary.Uvarint(dec.b)
+	if size <= 0 {
+		panic(codingErrorf("invalid code"))
+	}
+	dec.b = dec.b[size:]
+	return n
+}
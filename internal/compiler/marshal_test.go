@@ -0,0 +1,64 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/open2b/scriggo/internal/runtime"
+)
+
+var validateFunctionCases = []struct {
+	name  string
+	body  []runtime.Instruction
+	info  runtime.Addr
+	valid bool
+}{
+	{"valid", []runtime.Instruction{
+		{Op: runtime.OpCallFunc}, {}, {Op: runtime.OpNew, C: 1}, {Op: runtime.OpField, A: 1, C: 1},
+		{Op: runtime.OpText}, {Op: runtime.OpGoto}, {Op: runtime.OpReturn}}, 6, true},
+	{"missing function", []runtime.Instruction{{Op: runtime.OpCallFunc, A: 1}, {}, {Op: runtime.OpReturn}}, 0, false},
+	{"missing native function", []runtime.Instruction{{Op: runtime.OpCallNative}, {}, {Op: runtime.OpReturn}}, 0, false},
+	{"missing function value", []runtime.Instruction{{Op: runtime.OpLoadFunc, B: 1, C: 1}, {Op: runtime.OpReturn}}, 0, false},
+	{"missing type", []runtime.Instruction{{Op: runtime.OpNew, B: 1, C: 1}, {Op: runtime.OpReturn}}, 0, false},
+	{"missing field index", []runtime.Instruction{{Op: runtime.OpField, A: 1, B: 1, C: 1}, {Op: runtime.OpReturn}}, 0, false},
+	{"missing text", []runtime.Instruction{{Op: runtime.OpText, B: 1}, {Op: runtime.OpReturn}}, 0, false},
+	{"missing string constant", []runtime.Instruction{{Op: runtime.OpLoad, A: -1 << 7, C: 1}, {Op: runtime.OpReturn}}, 0, false},
+	{"jump out of the body", []runtime.Instruction{{Op: runtime.OpGoto, C: 2}, {Op: runtime.OpReturn}}, 0, false},
+	{"truncated stack shift", []runtime.Instruction{{Op: runtime.OpReturn}, {Op: runtime.OpCallFunc}, {Op: -1}}, 0, false},
+	{"missing stack shift", []runtime.Instruction{{Op: runtime.OpReturn}, {Op: runtime.OpCallFunc}}, 0, false},
+	{"wide prefix without instruction", []runtime.Instruction{{Op: runtime.OpReturn}, {Op: runtime.OpWide}}, 0, false},
+	{"instruction info out of the body", []runtime.Instruction{{Op: runtime.OpReturn}}, 1, false},
+}
+
+// TestValidateFunction tests that validateFunction panics for the indexes
+// that do not refer to the tables of a function.
+func TestValidateFunction(t *testing.T) {
+	for _, cas := range validateFunctionCases {
+		t.Run(cas.name, func(t *testing.T) {
+			fn := &runtime.Function{
+				Functions:       []*runtime.Function{{}},
+				Types:           []reflect.Type{intType},
+				FieldIndexes:    [][]int{{0}},
+				Text:            [][]byte{[]byte("a")},
+				Body:            cas.body,
+				InstructionInfo: map[runtime.Addr]runtime.InstructionInfo{cas.info: {}},
+			}
+			defer func() {
+				r := recover()
+				if cas.valid && r != nil {
+					t.Fatalf("unexpected panic: %v", r)
+				}
+				if !cas.valid {
+					if _, ok := r.(codingError); !ok {
+						t.Fatalf("expected a codingError panic, got %v", r)
+					}
+				}
+			}()
+			validateFunction(fn)
+		})
+	}
+}
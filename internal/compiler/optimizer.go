@@ -0,0 +1,1080 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"sort"
+
+	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/internal/compiler/types"
+	"github.com/open2b/scriggo/internal/runtime"
+)
+
+// maxInlinedInstructions is the maximum number of instructions, excluding
+// the final Return, of a function or macro that can be inlined.
+const maxInlinedInstructions = 12
+
+// maxOptimizationPasses is the maximum number of times the optimization
+// passes are repeated on a function body.
+const maxOptimizationPasses = 8
+
+// optimize optimizes the bytecode of the functions in code.
+//
+// The calls to small leaf functions and macros are inlined, the integer
+// constants are propagated and folded, the jumps are threaded and the
+// unreachable and redundant instructions are removed. Consecutive Text
+// instructions are merged in a single instruction.
+//
+// The optimized functions behave as the original ones.
+func optimize(code *Code) {
+	o := &optimizer{
+		done:   map[*runtime.Function]bool{},
+		leaves: map[*runtime.Function]*optBody{},
+	}
+	o.optimizeFunction(code.Main)
+	if code.Init != nil {
+		o.optimizeFunction(code.Init)
+	}
+	names := make([]string, 0, len(code.Functions))
+	for name := range code.Functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		o.optimizeFunction(code.Functions[name])
+	}
+	for _, t := range code.Types {
+		for _, m := range types.Methods(t) {
+			o.optimizeFunction(m.Func)
+		}
+	}
+}
+
+// optimizer optimizes functions.
+type optimizer struct {
+	done   map[*runtime.Function]bool
+	leaves map[*runtime.Function]*optBody // bodies of the functions that can be inlined; nil if a function cannot be inlined.
+}
+
+// optimizeFunction optimizes fn and, before it, the functions it refers to.
+func (o *optimizer) optimizeFunction(fn *runtime.Function) {
+	if o.done[fn] {
+		return
+	}
+	o.done[fn] = true
+	for _, f := range fn.Functions {
+		o.optimizeFunction(f)
+	}
+	if fn.Parent != nil {
+		o.optimizeFunction(fn.Parent)
+	}
+	b := decodeBody(fn)
+	b.inline(o)
+	for i := 0; i < maxOptimizationPasses; i++ {
+		changed := b.propagateConstants()
+		changed = b.threadJumps() || changed
+		changed = b.removeUnreachable() || changed
+		changed = b.removeRedundant() || changed
+		changed = b.mergeTexts() || changed
+		if !changed {
+			break
+		}
+	}
+	b.encode()
+}
+
+// leaf returns the body, without the final Return, of fn if fn can be
+// inlined. Otherwise it returns nil.
+//
+// A function can be inlined if it is small, it does not refer to non-local
+// variables and its body is a sequence of instructions, that only read and
+// write direct registers, followed by a Return.
+func (o *optimizer) leaf(fn *runtime.Function) *optBody {
+	if b, ok := o.leaves[fn]; ok {
+		return b
+	}
+	o.leaves[fn] = nil
+	if fn.VarRefs != nil || fn.FinalRegs != nil {
+		return nil
+	}
+	b := decodeBody(fn)
+	code := b.code
+	n := len(code) - 1
+	if n < 0 || n > maxInlinedInstructions || code[n].op != runtime.OpReturn {
+		return nil
+	}
+	for _, in := range code[:n] {
+		ta, tb, tc, ok := inlineOperands(fn, in)
+		if !ok || ta != noRegister && in.a <= 0 || tb != noRegister && in.b <= 0 || tc != noRegister && in.c <= 0 {
+			return nil
+		}
+	}
+	b.code = code[:n]
+	o.leaves[fn] = b
+	return b
+}
+
+// noRegister indicates that an operand is not a register.
+const noRegister registerType = -1
+
+// inlineOperands returns the types of the registers referred by the
+// operands of in, an instruction of fn, or noRegister for the operands that
+// do not refer to a register. ok reports whether in can be inlined.
+func inlineOperands(fn *runtime.Function, in optInstruction) (a, b, c registerType, ok bool) {
+	k := in.op < 0
+	switch in.op {
+	case runtime.OpMove, -runtime.OpMove:
+		t := registerType(in.a)
+		if k {
+			return noRegister, noRegister, t, true
+		}
+		return noRegister, t, t, true
+	case runtime.OpAddInt, -runtime.OpAddInt, runtime.OpSubInt, -runtime.OpSubInt,
+		runtime.OpMulInt, -runtime.OpMulInt, runtime.OpAnd, -runtime.OpAnd,
+		runtime.OpAndNot, -runtime.OpAndNot, runtime.OpOr, -runtime.OpOr,
+		runtime.OpXor, -runtime.OpXor, runtime.OpShlInt, -runtime.OpShlInt,
+		runtime.OpShrInt, -runtime.OpShrInt:
+		if k {
+			return intRegister, noRegister, intRegister, true
+		}
+		return intRegister, intRegister, intRegister, true
+	case runtime.OpAddFloat64, -runtime.OpAddFloat64, runtime.OpSubFloat64, -runtime.OpSubFloat64,
+		runtime.OpMulFloat64, -runtime.OpMulFloat64, runtime.OpDivFloat64, -runtime.OpDivFloat64:
+		if k {
+			return floatRegister, noRegister, floatRegister, true
+		}
+		return floatRegister, floatRegister, floatRegister, true
+	case runtime.OpConcat:
+		return stringRegister, stringRegister, stringRegister, true
+	case runtime.OpLoad:
+		t, _ := decodeValueIndex(int8(in.a), int8(in.b))
+		return noRegister, noRegister, t, true
+	case runtime.OpText:
+		return noRegister, noRegister, noRegister, true
+	case runtime.OpShow, -runtime.OpShow:
+		if k {
+			return noRegister, noRegister, noRegister, true
+		}
+		return noRegister, showRegisterType(fn, in), noRegister, true
+	}
+	return noRegister, noRegister, noRegister, false
+}
+
+// showRegisterType returns the type of the register of the value shown by
+// the Show instruction in of fn.
+func showRegisterType(fn *runtime.Function, in optInstruction) registerType {
+	t := fn.Types[uint8(in.a)]
+	if st, ok := t.(runtime.ScriggoType); ok {
+		t = st.GoType()
+	}
+	return kindToType(t.Kind())
+}
+
+// optInstruction is an instruction decoded by the optimizer.
+type optInstruction struct {
+	op      runtime.Operation
+	a, b, c int16
+	wide    bool                     // the instruction must be preceded by an OpWide instruction.
+	data    []runtime.Instruction    // words that follow the instruction, as the stack shift of a call.
+	target  int                      // index of the instruction a Goto, Break or Continue jumps to.
+	text    []byte                   // text of a Text instruction.
+	info    *runtime.InstructionInfo // information about the instruction, if any.
+	inlined *optInlined              // innermost inlined call the instruction belongs to, if any.
+	removed bool
+}
+
+// optInlined is a call inlined by the optimizer.
+type optInlined struct {
+	fn     *runtime.Function // inlined function.
+	parent *optInlined       // inlined call that contains the call, if any.
+	path   string            // path of the source file of the call.
+	pos    runtime.Position  // position of the call.
+	vars   []runtime.VarInfo // local variables of fn, with the registers of the calling function.
+	scopes [][2]int          // indexes of the instructions where the scopes of vars start and end.
+	at     int               // index of the first instruction of the body, or of the following one if the body is empty.
+}
+
+// isJump reports whether op jumps to an address stored in its operands.
+func isJump(op runtime.Operation) bool {
+	return op == runtime.OpGoto || op == runtime.OpBreak || op == runtime.OpContinue
+}
+
+// isSkip reports whether op can skip the next instruction.
+func isSkip(op runtime.Operation) bool {
+	switch op {
+	case runtime.OpIf, -runtime.OpIf, runtime.OpIfInt, -runtime.OpIfInt,
+		runtime.OpIfFloat, -runtime.OpIfFloat, runtime.OpIfString, -runtime.OpIfString,
+		runtime.OpAssert, runtime.OpCase, -runtime.OpCase:
+		return true
+	}
+	return false
+}
+
+// isRange reports whether op is a Range instruction.
+func isRange(op runtime.Operation) bool {
+	switch op {
+	case runtime.OpRange, runtime.OpRangeMapString, runtime.OpRangeSliceFloat64,
+		runtime.OpRangeSliceInt, runtime.OpRangeSliceString, runtime.OpRangeString, -runtime.OpRangeString:
+		return true
+	}
+	return false
+}
+
+// optBody is the body of a function decoded by the optimizer.
+type optBody struct {
+	fn      *runtime.Function
+	code    []optInstruction
+	vars    [][2]int      // indexes of the instructions where the scopes of fn.Vars start and end.
+	inlined []*optInlined // inlined calls; an inlined call follows the call that contains it.
+}
+
+// decodeBody decodes the body of fn.
+func decodeBody(fn *runtime.Function) *optBody {
+	body := fn.Body
+	b := &optBody{fn: fn}
+	// index contains, for every address, the index of its instruction.
+	index := make([]int, len(body)+1)
+	for addr := runtime.Addr(0); addr < runtime.Addr(len(body)); {
+		start := addr
+		in := optInstruction{target: -1}
+		if body[addr].Op == runtime.OpWide {
+			in.wide = true
+			addr++
+		}
+		in.op = body[addr].Op
+		in.a, in.b, in.c = decodeOperands(body, addr)
+		if info, ok := fn.InstructionInfo[addr]; ok {
+			in.info = &info
+		} else if info, ok := fn.InstructionInfo[start]; ok {
+			in.info = &info
+		}
+		addr++
+		var n runtime.Addr
+		switch in.op {
+		case runtime.OpCallFunc, runtime.OpCallMacro, runtime.OpCallIndirect, runtime.OpCallNative:
+			_, n = decodeStackShift(body, addr)
+		case runtime.OpDefer:
+			_, n1 := decodeStackShift(body, addr)
+			_, n2 := decodeStackShift(body, addr+n1)
+			n = n1 + n2
+		case runtime.OpSlice, runtime.OpStringSlice:
+			_, _, _, n = decodeDataWord(body, addr, in.b&8 != 0)
+		case runtime.OpMakeSlice:
+			if in.b > 0 {
+				_, _, _, n = decodeDataWord(body, addr, in.b&8 != 0)
+			}
+		case runtime.OpText:
+			in.text = fn.Text[decodeUint16(int8(in.a), int8(in.b))]
+		}
+		in.data = body[addr : addr+n]
+		addr += n
+		for ; start < addr; start++ {
+			index[start] = len(b.code)
+		}
+		b.code = append(b.code, in)
+	}
+	index[len(body)] = len(b.code)
+	indexOf := func(addr runtime.Addr) int {
+		if int(addr) >= len(body) {
+			return len(b.code)
+		}
+		return index[addr]
+	}
+	for i, in := range b.code {
+		if isJump(in.op) {
+			b.code[i].target = indexOf(runtime.Addr(decodeUint24(int8(in.a), int8(in.b), int8(in.c))))
+		}
+	}
+	if fn.Vars != nil {
+		b.vars = make([][2]int, len(fn.Vars))
+		for i, v := range fn.Vars {
+			b.vars[i] = [2]int{indexOf(v.Start), indexOf(v.End)}
+		}
+	}
+	for _, c := range fn.Inlined {
+		in := &optInlined{fn: c.Func, path: c.Path, pos: c.Position, vars: c.Vars, at: indexOf(c.Start)}
+		if c.Parent >= 0 {
+			in.parent = b.inlined[c.Parent]
+		}
+		in.scopes = make([][2]int, len(c.Vars))
+		for i, v := range c.Vars {
+			in.scopes[i] = [2]int{indexOf(v.Start), indexOf(v.End)}
+		}
+		// As a call follows the call that contains it, the innermost call
+		// is the last one to be assigned.
+		for i := indexOf(c.Start); i < indexOf(c.End); i++ {
+			b.code[i].inlined = in
+		}
+		b.inlined = append(b.inlined, in)
+	}
+	return b
+}
+
+// encode encodes the body and stores it in the function.
+func (b *optBody) encode() {
+	b.compact()
+	fn := b.fn
+	needsWide := func(in optInstruction) bool {
+		return in.wide || !isInt8(in.a) || !isInt8(in.b) || !isInt8(in.c)
+	}
+	addrs := make([]runtime.Addr, len(b.code)+1)
+	var addr runtime.Addr
+	for i, in := range b.code {
+		addrs[i] = addr
+		if needsWide(in) {
+			addr++
+		}
+		addr += 1 + runtime.Addr(len(in.data))
+	}
+	addrs[len(b.code)] = addr
+	body := make([]runtime.Instruction, 0, addr)
+	var text [][]byte
+	var infos map[runtime.Addr]runtime.InstructionInfo
+	for _, in := range b.code {
+		switch {
+		case isJump(in.op):
+			a, b, c := encodeUint24(uint32(addrs[in.target]))
+			in.a, in.b, in.c = int16(a), int16(b), int16(c)
+		case in.op == runtime.OpText:
+			a, b := encodeUint16(uint16(len(text)))
+			in.a, in.b = int16(a), int16(b)
+			text = append(text, in.text)
+		}
+		if needsWide(in) {
+			body = append(body, runtime.Instruction{Op: runtime.OpWide, A: int8(in.a >> 8), B: int8(in.b >> 8), C: int8(in.c >> 8)})
+		}
+		if in.info != nil {
+			if infos == nil {
+				infos = map[runtime.Addr]runtime.InstructionInfo{}
+			}
+			infos[runtime.Addr(len(body))] = *in.info
+		}
+		body = append(body, runtime.Instruction{Op: in.op, A: int8(in.a), B: int8(in.b), C: int8(in.c)})
+		body = append(body, in.data...)
+	}
+	fn.Body = body
+	fn.Text = text
+	fn.InstructionInfo = infos
+	for i, v := range b.vars {
+		fn.Vars[i].Start = addrs[v[0]]
+		fn.Vars[i].End = addrs[v[1]]
+	}
+	b.encodeInlined(addrs)
+}
+
+// encodeInlined stores the inlined calls in the function. addrs contains
+// the address of every instruction. The calls whose instructions have all
+// been removed are stored with an empty range at the address of the
+// instruction that follows them, so that the code coverage counts them.
+func (b *optBody) encodeInlined(addrs []runtime.Addr) {
+	bounds := map[*optInlined][2]int{}
+	for i, in := range b.code {
+		for c := in.inlined; c != nil; c = c.parent {
+			if r, ok := bounds[c]; ok {
+				bounds[c] = [2]int{r[0], i + 1}
+			} else {
+				bounds[c] = [2]int{i, i + 1}
+			}
+		}
+	}
+	var inlined []runtime.InlinedCall
+	index := map[*optInlined]int{}
+	for _, c := range b.inlined {
+		r, ok := bounds[c]
+		if !ok {
+			r = [2]int{c.at, c.at}
+		}
+		call := runtime.InlinedCall{
+			Func:     c.fn,
+			Parent:   -1,
+			Start:    addrs[r[0]],
+			End:      addrs[r[1]],
+			Path:     c.path,
+			Position: c.pos,
+			Vars:     make([]runtime.VarInfo, len(c.vars)),
+		}
+		if c.parent != nil {
+			call.Parent = index[c.parent]
+		}
+		for i, v := range c.vars {
+			v.Start = addrs[c.scopes[i][0]]
+			v.End = addrs[c.scopes[i][1]]
+			call.Vars[i] = v
+		}
+		index[c] = len(inlined)
+		inlined = append(inlined, call)
+	}
+	b.fn.Inlined = inlined
+}
+
+// compact removes the removed instructions from the body. The position of a
+// removed instruction is moved to the next instruction, if it has not one
+// and it belongs to the same inlined call.
+func (b *optBody) compact() {
+	index := make([]int, len(b.code)+1)
+	code := b.code[:0]
+	var info *runtime.InstructionInfo
+	var inlined *optInlined
+	for i, in := range b.code {
+		index[i] = len(code)
+		if in.removed {
+			if in.info != nil && in.info.Position.Line > 0 {
+				info = &runtime.InstructionInfo{Position: in.info.Position, Path: in.info.Path}
+				inlined = in.inlined
+			}
+			continue
+		}
+		if in.info == nil && in.inlined == inlined {
+			in.info = info
+		}
+		info = nil
+		code = append(code, in)
+	}
+	index[len(b.code)] = len(code)
+	b.remap(code, index)
+}
+
+// remap replaces the instructions of the body with code. index contains, for
+// every index of the current instructions, the index of the instruction in
+// code.
+func (b *optBody) remap(code []optInstruction, index []int) {
+	for i, in := range code {
+		if isJump(in.op) {
+			code[i].target = index[in.target]
+		}
+	}
+	for i, v := range b.vars {
+		b.vars[i] = [2]int{index[v[0]], index[v[1]]}
+	}
+	for _, c := range b.inlined {
+		for i, s := range c.scopes {
+			c.scopes[i] = [2]int{index[s[0]], index[s[1]]}
+		}
+		c.at = index[c.at]
+	}
+	b.code = code
+}
+
+// successors returns the indexes of the instructions that can be executed
+// after the instruction with index i. s1 and s2 are -1 if there are no
+// successors.
+func (b *optBody) successors(i int) (s1, s2 int) {
+	s1, s2 = -1, -1
+	switch op := b.code[i].op; {
+	case op == runtime.OpGoto:
+		return b.code[i].target, -1
+	case op == runtime.OpBreak, op == runtime.OpContinue, op == runtime.OpReturn, op == runtime.OpTailCall:
+		return -1, -1
+	case isSkip(op), isRange(op):
+		if i+2 < len(b.code) {
+			s2 = i + 2
+		}
+	}
+	if i+1 < len(b.code) {
+		s1 = i + 1
+	}
+	return s1, s2
+}
+
+// leaders returns, for every instruction, whether it begins a basic block,
+// that is it is not executed only after the preceding instruction.
+func (b *optBody) leaders() []bool {
+	leaders := make([]bool, len(b.code))
+	preds := make([]int, len(b.code))
+	for i := range b.code {
+		s1, s2 := b.successors(i)
+		for _, s := range [2]int{s1, s2} {
+			if s < 0 {
+				continue
+			}
+			preds[s]++
+			if s != i+1 {
+				leaders[s] = true
+			}
+		}
+	}
+	for i, n := range preds {
+		if i == 0 || n != 1 {
+			leaders[i] = true
+		}
+	}
+	return leaders
+}
+
+// pinned returns, for every instruction, whether it cannot be removed or
+// replaced by other instructions, and whether it must remain a Goto
+// instruction, because a preceding instruction depends on its position.
+//
+// An instruction is pinned if it follows an instruction that can skip it,
+// a Go instruction or a Range instruction. The Case and Goto instructions
+// that precede a Select instruction are also pinned.
+func (b *optBody) pinned() (pinned, fixed []bool) {
+	pinned = make([]bool, len(b.code))
+	fixed = make([]bool, len(b.code))
+	for i, in := range b.code {
+		if i+1 < len(b.code) {
+			switch {
+			case isSkip(in.op), in.op == runtime.OpGo:
+				pinned[i+1] = true
+			case isRange(in.op):
+				pinned[i+1] = true
+				fixed[i+1] = true
+			}
+		}
+		if in.op == runtime.OpSelect {
+			for j := i - 1; j > 0; j -= 2 {
+				if b.code[j].op != runtime.OpGoto || b.code[j-1].op != runtime.OpCase && b.code[j-1].op != -runtime.OpCase {
+					break
+				}
+				pinned[j], fixed[j] = true, true
+				pinned[j-1], fixed[j-1] = true, true
+			}
+		}
+	}
+	return pinned, fixed
+}
+
+// inline inlines the calls to the functions and macros that can be inlined.
+// It does not inline calls in functions with deferred calls, as the Defer
+// instruction moves the registers of the calling function.
+func (b *optBody) inline(o *optimizer) bool {
+	var numText int
+	for _, in := range b.code {
+		switch in.op {
+		case runtime.OpDefer:
+			return false
+		case runtime.OpText:
+			numText++
+		}
+	}
+	pinned, _ := b.pinned()
+	code := make([]optInstruction, 0, len(b.code))
+	index := make([]int, len(b.code)+1)
+	var inlined []*optInlined
+	changed := false
+	for i, in := range b.code {
+		index[i] = len(code)
+		if !pinned[i] && (in.op == runtime.OpCallFunc || in.op == runtime.OpCallMacro) {
+			callee := b.fn.Functions[uint16(in.a)]
+			// A macro is inlined only if its output is not converted to another
+			// format or returned as a string.
+			inlinable := !callee.Macro
+			if in.op == runtime.OpCallMacro {
+				inlinable = callee.Macro && in.b != runtime.ReturnString && ast.Format(in.b) == callee.Format
+			}
+			if inlinable {
+				if leaf := o.leaf(callee); leaf != nil {
+					shift, _ := decodeStackShift(in.data, 0)
+					if body, calls, ok := b.instantiate(callee, leaf, in, shift, &numText, len(code)); ok {
+						code = append(code, body...)
+						inlined = append(inlined, calls...)
+						changed = true
+						continue
+					}
+				}
+			}
+		}
+		code = append(code, in)
+	}
+	index[len(b.code)] = len(code)
+	if changed {
+		b.remap(code, index)
+		b.inlined = append(b.inlined, inlined...)
+	}
+	return changed
+}
+
+// instantiate returns the instructions of leaf, the body of the function
+// callee, to inline in place of the call instruction call with the given
+// stack shift, and the inlined calls of these instructions. The registers,
+// values and types of callee are moved to the function of the body.
+// numText is the number of Text instructions of the body and index is the
+// index that the first returned instruction will have in the body. It
+// returns false if leaf cannot be inlined because a limit would be exceeded.
+func (b *optBody) instantiate(callee *runtime.Function, leaf *optBody, call optInstruction, shift runtime.StackShift, numText *int, index int) ([]optInstruction, []*optInlined, bool) {
+	fn := b.fn
+	numReg := fn.NumReg
+	for t, n := range callee.NumReg {
+		r := int(shift[t]) + int(n)
+		if r > maxRegistersCount {
+			return nil, nil, false
+		}
+		if int16(r) > numReg[t] {
+			numReg[t] = int16(r)
+		}
+	}
+	values := fn.Values
+	typs := fn.Types
+	texts := *numText
+	// value returns the index in values of the value with type t and index i
+	// in the values of callee.
+	value := func(t registerType, i int) (int, bool) {
+		var n, max int
+		switch t {
+		case intRegister:
+			v := callee.Values.Int[i]
+			for j, w := range values.Int {
+				if w == v {
+					return j, true
+				}
+			}
+			n, max = len(values.Int), maxIntValuesCount
+			values.Int = append(values.Int, v)
+		case floatRegister:
+			n, max = len(values.Float), maxFloatValuesCount
+			values.Float = append(values.Float, callee.Values.Float[i])
+		case stringRegister:
+			v := callee.Values.String[i]
+			for j, w := range values.String {
+				if w == v {
+					return j, true
+				}
+			}
+			n, max = len(values.String), maxStringValuesCount
+			values.String = append(values.String, v)
+		case generalRegister:
+			n, max = len(values.General), maxGeneralValuesCount
+			values.General = append(values.General, callee.Values.General[i])
+		}
+		return n, n < max
+	}
+	// calls contains the inlined calls of the instantiated instructions; the
+	// first one is the call to callee, followed by the calls inlined in leaf.
+	calls := []*optInlined{{fn: callee, path: fn.File, vars: make([]runtime.VarInfo, len(callee.Vars)), scopes: make([][2]int, len(leaf.vars)), at: index}}
+	if call.info != nil {
+		if call.info.Path != "" {
+			calls[0].path = call.info.Path
+		}
+		calls[0].pos = call.info.Position
+	}
+	for _, c := range leaf.inlined {
+		calls = append(calls, &optInlined{fn: c.fn, path: c.path, pos: c.pos, vars: make([]runtime.VarInfo, len(c.vars)), scopes: make([][2]int, len(c.scopes)), at: index + c.at})
+	}
+	instance := map[*optInlined]*optInlined{nil: calls[0]}
+	for i, c := range leaf.inlined {
+		instance[c] = calls[i+1]
+		calls[i+1].parent = instance[c.parent]
+	}
+	for i, c := range calls {
+		vars, scopes := callee.Vars, leaf.vars
+		if i > 0 {
+			vars, scopes = leaf.inlined[i-1].vars, leaf.inlined[i-1].scopes
+		}
+		for j, v := range vars {
+			if v.Reg > 0 {
+				t := v.Type
+				if st, ok := t.(runtime.ScriggoType); ok {
+					t = st.GoType()
+				}
+				v.Reg += shift[kindToType(t.Kind())]
+			}
+			c.vars[j] = v
+			c.scopes[j] = [2]int{index + scopes[j][0], index + scopes[j][1]}
+		}
+	}
+	code := make([]optInstruction, len(leaf.code))
+	for i, in := range leaf.code {
+		ta, tb, tc, _ := inlineOperands(callee, in)
+		if ta != noRegister {
+			in.a += shift[ta]
+		}
+		if tb != noRegister {
+			in.b += shift[tb]
+		}
+		if tc != noRegister {
+			in.c += shift[tc]
+		}
+		switch in.op {
+		case -runtime.OpMove:
+			if t := registerType(in.a); t == stringRegister || t == generalRegister {
+				v, ok := value(t, int(uint8(in.b)))
+				if !ok || v > 255 {
+					return nil, nil, false
+				}
+				in.b = int16(int8(v))
+			}
+		case runtime.OpLoad:
+			t, j := decodeValueIndex(int8(in.a), int8(in.b))
+			v, ok := value(t, j)
+			if !ok {
+				return nil, nil, false
+			}
+			a, b := encodeValueIndex(t, v)
+			in.a, in.b = int16(a), int16(b)
+		case runtime.OpText:
+			texts++
+			if texts > 1<<16 {
+				return nil, nil, false
+			}
+		case runtime.OpShow, -runtime.OpShow:
+			if in.op < 0 {
+				if t := showRegisterType(callee, in); t == stringRegister || t == generalRegister {
+					v, ok := value(t, int(uint8(in.b)))
+					if !ok || v > 255 {
+						return nil, nil, false
+					}
+					in.b = int16(int8(v))
+				}
+			}
+			typ := callee.Types[uint8(in.a)]
+			t := -1
+			for j, tt := range typs {
+				if tt == typ {
+					t = j
+					break
+				}
+			}
+			if t == -1 {
+				if len(typs) == maxTypesCount {
+					return nil, nil, false
+				}
+				t = len(typs)
+				typs = append(typs, typ)
+			}
+			in.a = int16(int8(t))
+		}
+		in.wide = false
+		if in.info != nil {
+			info := *in.info
+			if info.Path == "" {
+				info.Path = callee.File
+			}
+			in.info = &info
+		}
+		in.inlined = instance[in.inlined]
+		code[i] = in
+	}
+	fn.NumReg = numReg
+	fn.Values = values
+	fn.Types = typs
+	*numText = texts
+	return code, calls, true
+}
+
+// propagateConstants propagates, within the basic blocks, the constant
+// values of the integer registers. The operands with a known value are
+// replaced with constants, the operations with constant operands are folded
+// and the moves of values already in their destination are removed. The
+// IfInt instructions with a constant condition are replaced by a Goto or a
+// Nop instruction.
+func (b *optBody) propagateConstants() bool {
+	changed := false
+	leaders := b.leaders()
+	pinned, _ := b.pinned()
+	known := map[int16]int64{}
+	// intValue returns the value of the operand r if it is known.
+	intValue := func(r int16, k bool) (int64, bool) {
+		if k {
+			return int64(r), true
+		}
+		if r <= 0 {
+			return 0, false
+		}
+		v, ok := known[r]
+		return v, ok
+	}
+	// set sets the value of the register r, if it is known, and reports
+	// whether the register already has this value.
+	set := func(r int16, v int64, ok bool) bool {
+		if r <= 0 {
+			return false
+		}
+		if !ok {
+			delete(known, r)
+			return false
+		}
+		if w, ok := known[r]; ok && w == v {
+			return true
+		}
+		known[r] = v
+		return false
+	}
+	for i := range b.code {
+		if leaders[i] {
+			for r := range known {
+				delete(known, r)
+			}
+		}
+		in := &b.code[i]
+		k := in.op < 0
+		switch in.op {
+		case runtime.OpMove, -runtime.OpMove:
+			if registerType(in.a) != intRegister {
+				break
+			}
+			v, ok := intValue(in.b, k)
+			if set(in.c, v, ok) && !pinned[i] {
+				in.removed = true
+				changed = true
+				break
+			}
+			if ok && !k && isInt8(int16(v)) && int64(int16(v)) == v {
+				in.op, in.b = -runtime.OpMove, int16(v)
+				changed = true
+			}
+		case runtime.OpLoad:
+			t, j := decodeValueIndex(int8(in.a), int8(in.b))
+			if t == intRegister && set(in.c, b.fn.Values.Int[j], true) && !pinned[i] {
+				in.removed = true
+				changed = true
+			}
+		case runtime.OpAddInt, -runtime.OpAddInt, runtime.OpSubInt, -runtime.OpSubInt,
+			runtime.OpSubInvInt, -runtime.OpSubInvInt, runtime.OpMulInt, -runtime.OpMulInt,
+			runtime.OpDivInt, -runtime.OpDivInt, runtime.OpRemInt, -runtime.OpRemInt,
+			runtime.OpAnd, -runtime.OpAnd, runtime.OpAndNot, -runtime.OpAndNot,
+			runtime.OpOr, -runtime.OpOr, runtime.OpXor, -runtime.OpXor,
+			runtime.OpShlInt, -runtime.OpShlInt, runtime.OpShrInt, -runtime.OpShrInt:
+			x, xok := intValue(in.a, false)
+			y, yok := intValue(in.b, k)
+			// A division by a constant zero is never emitted, so the runtime
+			// only converts the panic of the non-constant form.
+			isDiv := in.op == runtime.OpDivInt || in.op == runtime.OpRemInt
+			if yok && !k && isInt8(int16(y)) && int64(int16(y)) == y && !(isDiv && y == 0) {
+				in.op, in.b = -in.op, int16(y)
+				changed = true
+			}
+			var v int64
+			var ok bool
+			if xok && yok {
+				v, ok = foldIntOperation(in.op, x, y)
+			}
+			if ok && isInt8(int16(v)) && int64(int16(v)) == v {
+				in.op, in.a, in.b = -runtime.OpMove, int16(intRegister), int16(v)
+				changed = true
+			}
+			set(in.c, v, ok)
+		case runtime.OpIfInt, -runtime.OpIfInt:
+			cond, ok := foldIntCondition(runtime.Condition(in.b), in.a, in.c, k, intValue)
+			if !ok || i+2 >= len(b.code) {
+				break
+			}
+			if cond {
+				// The next instruction is skipped.
+				*in = optInstruction{op: runtime.OpGoto, target: i + 2, info: in.info, inlined: in.inlined}
+			} else {
+				*in = optInstruction{op: runtime.OpNone, target: -1, info: in.info, inlined: in.inlined}
+			}
+			changed = true
+		case runtime.OpNone, runtime.OpText, runtime.OpShow, -runtime.OpShow, runtime.OpConcat,
+			runtime.OpAddFloat64, -runtime.OpAddFloat64, runtime.OpSubFloat64, -runtime.OpSubFloat64,
+			runtime.OpMulFloat64, -runtime.OpMulFloat64, runtime.OpDivFloat64, -runtime.OpDivFloat64,
+			runtime.OpIf, -runtime.OpIf, runtime.OpIfFloat, -runtime.OpIfFloat,
+			runtime.OpIfString, -runtime.OpIfString, runtime.OpGoto:
+			// These instructions do not change the integer registers.
+		default:
+			for r := range known {
+				delete(known, r)
+			}
+		}
+	}
+	if changed {
+		b.compact()
+	}
+	return changed
+}
+
+// foldIntOperation returns the result of the integer operation op with
+// operands x and y. ok is false if the operation cannot be folded.
+func foldIntOperation(op runtime.Operation, x, y int64) (v int64, ok bool) {
+	if op < 0 {
+		op = -op
+	}
+	switch op {
+	case runtime.OpAddInt:
+		return x + y, true
+	case runtime.OpSubInt:
+		return x - y, true
+	case runtime.OpSubInvInt:
+		return y - x, true
+	case runtime.OpMulInt:
+		return x * y, true
+	case runtime.OpDivInt:
+		if y == 0 {
+			return 0, false
+		}
+		return x / y, true
+	case runtime.OpRemInt:
+		if y == 0 {
+			return 0, false
+		}
+		return x % y, true
+	case runtime.OpAnd:
+		return x & y, true
+	case runtime.OpAndNot:
+		return x &^ y, true
+	case runtime.OpOr:
+		return x | y, true
+	case runtime.OpXor:
+		return x ^ y, true
+	case runtime.OpShlInt:
+		return x << uint(y), true
+	case runtime.OpShrInt:
+		return x >> uint(y), true
+	}
+	return 0, false
+}
+
+// foldIntCondition returns the value of the condition cond of an IfInt
+// instruction with operands a and c. ok is false if the value is not known.
+func foldIntCondition(cond runtime.Condition, a, c int16, k bool, intValue func(int16, bool) (int64, bool)) (v bool, ok bool) {
+	x, ok := intValue(a, false)
+	if !ok {
+		return false, false
+	}
+	switch cond {
+	case runtime.ConditionZero:
+		return x == 0, true
+	case runtime.ConditionNotZero:
+		return x != 0, true
+	}
+	y, ok := intValue(c, k)
+	if !ok {
+		return false, false
+	}
+	switch cond {
+	case runtime.ConditionEqual:
+		return x == y, true
+	case runtime.ConditionNotEqual:
+		return x != y, true
+	case runtime.ConditionLess:
+		return x < y, true
+	case runtime.ConditionLessEqual:
+		return x <= y, true
+	case runtime.ConditionGreater:
+		return x > y, true
+	case runtime.ConditionGreaterEqual:
+		return x >= y, true
+	case runtime.ConditionLessU:
+		return uint64(x) < uint64(y), true
+	case runtime.ConditionLessEqualU:
+		return uint64(x) <= uint64(y), true
+	case runtime.ConditionGreaterU:
+		return uint64(x) > uint64(y), true
+	case runtime.ConditionGreaterEqualU:
+		return uint64(x) >= uint64(y), true
+	}
+	return false, false
+}
+
+// threadJumps makes the Goto instructions jump directly to the final target
+// of a chain of Goto instructions, and replaces a Goto instruction that
+// jumps to a Return instruction with a Return instruction.
+func (b *optBody) threadJumps() bool {
+	changed := false
+	_, fixed := b.pinned()
+	for i := range b.code {
+		in := &b.code[i]
+		if in.op != runtime.OpGoto {
+			continue
+		}
+		t := in.target
+		for n := 0; n < len(b.code) && t < len(b.code) && t != i && b.code[t].op == runtime.OpGoto; n++ {
+			t = b.code[t].target
+		}
+		if t != in.target {
+			in.target = t
+			changed = true
+		}
+		if !fixed[i] && t < len(b.code) && b.code[t].op == runtime.OpReturn {
+			in.op, in.target = runtime.OpReturn, -1
+			changed = true
+		}
+	}
+	return changed
+}
+
+// removeUnreachable removes the instructions that cannot be executed.
+func (b *optBody) removeUnreachable() bool {
+	if len(b.code) == 0 {
+		return false
+	}
+	reachable := make([]bool, len(b.code))
+	stack := []int{0}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if i >= len(b.code) || reachable[i] {
+			continue
+		}
+		reachable[i] = true
+		s1, s2 := b.successors(i)
+		if s1 >= 0 {
+			stack = append(stack, s1)
+		}
+		if s2 >= 0 {
+			stack = append(stack, s2)
+		}
+	}
+	changed := false
+	for i, ok := range reachable {
+		if !ok {
+			b.code[i].removed = true
+			changed = true
+		}
+	}
+	if changed {
+		b.compact()
+	}
+	return changed
+}
+
+// removeRedundant removes the Nop instructions, the Goto instructions that
+// jump to the next instruction and the moves of a register to itself.
+func (b *optBody) removeRedundant() bool {
+	changed := false
+	pinned, _ := b.pinned()
+	for i := range b.code {
+		if pinned[i] {
+			continue
+		}
+		in := &b.code[i]
+		switch in.op {
+		case runtime.OpNone:
+			in.removed = true
+		case runtime.OpGoto:
+			in.removed = in.target == i+1
+		case runtime.OpMove:
+			// A move of an array or a struct copies the value, so it is not
+			// redundant.
+			in.removed = in.b == in.c && in.c > 0 && registerType(in.a) != generalRegister
+		}
+		changed = changed || in.removed
+	}
+	if changed {
+		b.compact()
+	}
+	return changed
+}
+
+// mergeTexts merges the consecutive Text instructions, not in a URL, in a
+// single Text instruction.
+func (b *optBody) mergeTexts() bool {
+	changed := false
+	leaders := b.leaders()
+	pinned, _ := b.pinned()
+	last := -1
+	for i := range b.code {
+		in := &b.code[i]
+		if in.op != runtime.OpText || in.c != 0 || pinned[i] {
+			last = -1
+			continue
+		}
+		if last == -1 || leaders[i] {
+			last = i
+			continue
+		}
+		prev := &b.code[last]
+		text := make([]byte, len(prev.text)+len(in.text))
+		copy(text, prev.text)
+		copy(text[len(prev.text):], in.text)
+		prev.text = text
+		in.removed = true
+		changed = true
+	}
+	if changed {
+		b.compact()
+	}
+	return changed
+}
@@ -0,0 +1,154 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/open2b/scriggo/internal/fstest"
+	"github.com/open2b/scriggo/internal/runtime"
+)
+
+const optimizerTestProgram = `package main
+
+func add(a, b int) int { return a + b }
+
+func sum(s []int) int {
+	t := 0
+	for _, v := range s {
+		t = add(t, v)
+	}
+	return t
+}
+
+func main() {
+	a := 5
+	b := a * 3
+	if b == 15 {
+		println("ok")
+	}
+	for i := 0; i < 10; i++ {
+		if i == 5 {
+			continue
+		}
+		switch {
+		case i < 3:
+			println(add(i, b))
+		default:
+			println(sum([]int{i, b}))
+		}
+	}
+	c := make(chan int, 1)
+	select {
+	case c <- 1:
+	default:
+	}
+	for k, v := range "abc" {
+		println(k, v)
+	}
+	recovered(a)
+}
+
+func recovered(a int) {
+	defer func() {
+		_ = recover()
+	}()
+	panic(a)
+}
+`
+
+// optimizerTestFunctions returns fn and all the functions declared in fn,
+// recursively.
+func optimizerTestFunctions(fn *runtime.Function) []*runtime.Function {
+	functions := []*runtime.Function{fn}
+	for _, f := range fn.Functions {
+		if f.Parent != nil || f == fn {
+			continue
+		}
+		functions = append(functions, optimizerTestFunctions(f)...)
+	}
+	for _, f := range fn.Functions {
+		if f.Parent == fn {
+			functions = append(functions, optimizerTestFunctions(f)...)
+		}
+	}
+	return functions
+}
+
+// TestOptimizerEncodeDecode tests that encoding a decoded body, without
+// optimizing it, returns the same body.
+func TestOptimizerEncodeDecode(t *testing.T) {
+	code, err := BuildProgram(fstest.Files{"main.go": optimizerTestProgram}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fn := range optimizerTestFunctions(code.Main) {
+		body := append([]runtime.Instruction{}, fn.Body...)
+		text := append([][]byte{}, fn.Text...)
+		infos := map[runtime.Addr]runtime.InstructionInfo{}
+		for addr, info := range fn.InstructionInfo {
+			infos[addr] = info
+		}
+		vars := append([]runtime.VarInfo{}, fn.Vars...)
+		decodeBody(fn).encode()
+		if !reflect.DeepEqual(body, fn.Body) {
+			t.Fatalf("function %s: unexpected body %v, expected %v", fn.Name, fn.Body, body)
+		}
+		if len(text) != len(fn.Text) || len(text) > 0 && !reflect.DeepEqual(text, fn.Text) {
+			t.Fatalf("function %s: unexpected text %q, expected %q", fn.Name, fn.Text, text)
+		}
+		if len(infos) != len(fn.InstructionInfo) || len(infos) > 0 && !reflect.DeepEqual(infos, fn.InstructionInfo) {
+			t.Fatalf("function %s: unexpected instruction info %v, expected %v", fn.Name, fn.InstructionInfo, infos)
+		}
+		if len(vars) != len(fn.Vars) || len(vars) > 0 && !reflect.DeepEqual(vars, fn.Vars) {
+			t.Fatalf("function %s: unexpected vars %v, expected %v", fn.Name, fn.Vars, vars)
+		}
+	}
+}
+
+// TestOptimizerInlining tests that the calls to small leaf functions and
+// macros are inlined.
+func TestOptimizerInlining(t *testing.T) {
+	code, err := BuildProgram(fstest.Files{"main.go": optimizerTestProgram}, Options{Optimize: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fn := range optimizerTestFunctions(code.Main) {
+		for _, in := range decodeBody(fn).code {
+			if in.op == runtime.OpCallFunc && fn.Functions[uint16(in.a)].Name == "add" {
+				t.Fatalf("function %s: unexpected call to add", fn.Name)
+			}
+		}
+	}
+	src := "{% macro M(s string) %}<b>{{ s }}</b>{% end %}{{ M(\"a\") }} {{ M(\"b\") }}"
+	code, err = BuildTemplate(fstest.Files{"index.html": src}, "index.html", Options{FormatTypes: formatTypes, Optimize: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, in := range decodeBody(code.Main).code {
+		if in.op == runtime.OpCallMacro {
+			t.Fatal("unexpected call to macro M")
+		}
+	}
+}
+
+// TestOptimizerConstantFolding tests that the operations and the
+// conditions on constant operands are folded.
+func TestOptimizerConstantFolding(t *testing.T) {
+	src := "package main\n\nfunc main() {\n\ta := 5\n\tb := a * 3\n\tif b == 15 {\n\t\tprintln(b - a)\n\t}\n}\n"
+	code, err := BuildProgram(fstest.Files{"main.go": src}, Options{Optimize: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, in := range decodeBody(code.Main).code {
+		switch in.op {
+		case runtime.OpMulInt, -runtime.OpMulInt, runtime.OpSubInt, -runtime.OpSubInt:
+			t.Fatalf("unexpected operation %d", in.op)
+		case runtime.OpIfInt, -runtime.OpIfInt, runtime.OpGoto:
+			t.Fatalf("unexpected jump %d", in.op)
+		}
+	}
+}
@@ -135,6 +135,170 @@ type parsing struct {
 
 	// Unexpanded Extends, Import and Render nodes.
 	unexpanded []ast.Node
+
+	// Last token read.
+	last token
+
+	// Tokens read and then put back with the unread method.
+	unread []token
+
+	// Maximum number of errors, as in Options.MaxErrors.
+	maxErrors int
+
+	// Syntax errors found, if maxErrors is not zero.
+	errors []*SyntaxError
+
+	// Reports whether the tokens of a statement with a syntax error are
+	// being skipped.
+	skipping bool
+}
+
+// report reports a syntax error. If the errors are collected and their
+// maximum number has not been reached, it adds err to the errors and
+// returns, otherwise it panics with err.
+func (p *parsing) report(err *SyntaxError) {
+	if p.maxErrors == 0 {
+		panic(err)
+	}
+	for _, e := range p.errors {
+		if e == err {
+			panic(err)
+		}
+	}
+	p.errors = append(p.errors, err)
+	if len(p.errors) == p.maxErrors {
+		panic(err)
+	}
+}
+
+// recovering calls parse, that parses a statement terminated by end, and
+// returns the token it returns. If parse panics with a syntax error, and the
+// errors are collected, it reports the error, restores the ancestors and
+// skips the tokens up to the end of the statement.
+//
+// end can be %}, }}, %%} or EOF. For %%} and EOF, a statement is also
+// terminated by a semicolon or by a closing brace of the enclosing block.
+// For a package-level declaration, it skips the tokens up to the next
+// declaration.
+func (p *parsing) recovering(end tokenTyp, parse func() token) (tok token) {
+	if p.maxErrors == 0 {
+		return parse()
+	}
+	start := p.last
+	numAncestors := len(p.ancestors)
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := r.(*SyntaxError)
+			if !ok || err == p.lex.err {
+				panic(r)
+			}
+			p.report(err)
+			p.ancestors = p.ancestors[:numAncestors]
+			p.skipping = true
+			if _, ok := p.parent().(*ast.Package); ok {
+				tok = p.skipDeclaration(start)
+			} else {
+				tok = p.skip(end)
+			}
+			p.skipping = false
+		}
+	}()
+	return parse()
+}
+
+// skipDeclaration skips the tokens, starting from the last read token, up
+// to the next package-level declaration, that is a declaration keyword at
+// the beginning of a line, and returns it. start is the first token of the
+// declaration that failed.
+func (p *parsing) skipDeclaration(start token) token {
+	tok := p.last
+	if tok.pos == start.pos {
+		tok = p.next()
+	}
+	for {
+		switch tok.typ {
+		case tokenEOF:
+			return tok
+		case tokenConst, tokenFunc, tokenImport, tokenType, tokenVar:
+			if tok.pos.Column == 1 {
+				return tok
+			}
+		}
+		tok = p.next()
+	}
+}
+
+// skip skips the tokens, starting from the last read token, up to the end
+// of the current statement and returns the first token after it. See the
+// recovering method for the statement terminators.
+func (p *parsing) skip(end tokenTyp) token {
+	tok := p.last
+	switch end {
+	case tokenEndStatement, tokenRightBraces:
+		for tok.typ != end && tok.typ != tokenEOF {
+			tok = p.next()
+		}
+		if tok.typ == end {
+			tok = p.next()
+		}
+		return tok
+	}
+	// A closing brace that caused the error is skipped.
+	if tok.typ == tokenRightBrace {
+		tok = p.next()
+	}
+	depth := 0
+	for {
+		switch tok.typ {
+		case tokenEOF, tokenEndStatements:
+			return tok
+		case tokenLeftBrace, tokenLeftParenthesis, tokenLeftBracket:
+			depth++
+		case tokenRightBrace:
+			if depth == 0 {
+				return tok
+			}
+			depth--
+		case tokenRightParenthesis, tokenRightBracket:
+			if depth > 0 {
+				depth--
+			}
+		case tokenSemicolon:
+			if depth == 0 {
+				return p.next()
+			}
+		}
+		tok = p.next()
+	}
+}
+
+// syntaxErrors returns the syntax errors found parsing, including err if it
+// is a *SyntaxError value and it has not already been reported. It returns
+// nil if there are no errors, a *SyntaxError value if there is only one
+// error, otherwise an Errors value.
+//
+// A lexer error that occurs skipping a statement with a syntax error is not
+// returned, as it is a consequence of the reported error.
+func (p *parsing) syntaxErrors(err error) error {
+	if e, ok := err.(*SyntaxError); ok {
+		found := p.skipping && e == p.lex.err
+		for _, se := range p.errors {
+			if se == e {
+				found = true
+				break
+			}
+		}
+		if !found {
+			p.errors = append(p.errors, e)
+		}
+	} else if err != nil {
+		return err
+	}
+	errs := make(Errors, len(p.errors))
+	for i, e := range p.errors {
+		errs[i] = e
+	}
+	return errorList(errs)
 }
 
 // addToAncestors adds node to the ancestors.
@@ -165,6 +329,12 @@ func (p *parsing) inFunction() bool {
 // next returns the next token from the lexer. Panics if the lexer channel is
 // closed.
 func (p *parsing) next() token {
+	if n := len(p.unread); n > 0 {
+		tok := p.unread[n-1]
+		p.unread = p.unread[:n-1]
+		p.last = tok
+		return tok
+	}
 	tok, ok := <-p.lex.Tokens()
 	if !ok {
 		if p.lex.err == nil {
@@ -172,12 +342,20 @@ func (p *parsing) next() token {
 		}
 		panic(p.lex.err)
 	}
+	p.last = tok
 	return tok
 }
 
+// back puts back the token tok so that it is returned by the next call to
+// next. Tokens put back are returned in reverse order.
+func (p *parsing) back(tok token) {
+	p.unread = append(p.unread, tok)
+}
+
 // parseSource parses a program and returns its tree.
 // If noPackage is true, it does not expect a package statement.
-func parseSource(src []byte, noPackage bool) (tree *ast.Tree, err error) {
+// maxErrors is the maximum number of errors, as in Options.MaxErrors.
+func parseSource(src []byte, noPackage bool, maxErrors int) (tree *ast.Tree, err error) {
 
 	tree = ast.NewTree("", nil, ast.FormatText)
 
@@ -185,18 +363,21 @@ func parseSource(src []byte, noPackage bool) (tree *ast.Tree, err error) {
 		noPackage: noPackage,
 		ancestors: []ast.Node{tree},
 		lex:       scanProgram(src),
+		maxErrors: maxErrors,
 	}
 
 	defer func() {
 		p.lex.Stop()
 		if r := recover(); r != nil {
 			if e, ok := r.(*SyntaxError); ok {
-				tree = nil
 				err = e
 			} else {
 				panic(r)
 			}
 		}
+		if err = p.syntaxErrors(err); err != nil {
+			tree = nil
+		}
 	}()
 
 	tok := p.next()
@@ -205,7 +386,9 @@ func parseSource(src []byte, noPackage bool) (tree *ast.Tree, err error) {
 	}
 
 	for tok.typ != tokenEOF {
-		tok = p.parse(tok, tokenEOF)
+		tok = p.recovering(tokenEOF, func() token {
+			return p.parse(tok, tokenEOF)
+		})
 	}
 
 	if len(p.ancestors) == 1 {
@@ -224,6 +407,8 @@ func parseSource(src []byte, noPackage bool) (tree *ast.Tree, err error) {
 		}
 	}
 
+	tree.Comments = p.lex.comments
+
 	return tree, nil
 }
 
@@ -237,6 +422,12 @@ func parseSource(src []byte, noPackage bool) (tree *ast.Tree, err error) {
 // format can be Text, HTML, CSS, JS, JSON and Markdown. imported indicates
 // whether it is imported.
 func ParseTemplateSource(src []byte, format ast.Format, imported, noParseShow bool) (tree *ast.Tree, unexpanded []ast.Node, err error) {
+	return parseTemplateSource(src, format, imported, noParseShow, 0)
+}
+
+// parseTemplateSource is like ParseTemplateSource but collects up to
+// maxErrors syntax errors, as in Options.MaxErrors.
+func parseTemplateSource(src []byte, format ast.Format, imported, noParseShow bool, maxErrors int) (tree *ast.Tree, unexpanded []ast.Node, err error) {
 
 	if format < ast.FormatText || format > ast.FormatMarkdown {
 		return nil, nil, errors.New("scriggo: invalid format")
@@ -250,18 +441,22 @@ func ParseTemplateSource(src []byte, format ast.Format, imported, noParseShow bo
 		imported:   imported,
 		ancestors:  []ast.Node{tree},
 		unexpanded: []ast.Node{},
+		maxErrors:  maxErrors,
 	}
 
 	defer func() {
 		p.lex.Stop()
 		if r := recover(); r != nil {
 			if e, ok := r.(*SyntaxError); ok {
-				tree = nil
 				err = e
 			} else {
 				panic(r)
 			}
 		}
+		if err = p.syntaxErrors(err); err != nil {
+			tree = nil
+			unexpanded = nil
+		}
 	}()
 
 	// line is the current line number.
@@ -288,9 +483,10 @@ func ParseTemplateSource(src []byte, format ast.Format, imported, noParseShow bo
 			if (imported || p.hasExtend) && len(p.ancestors) == 1 && !containsOnlySpaces(tok.txt) {
 				pos := firstNonSpacePosition(tok)
 				if imported {
-					return nil, nil, syntaxError(pos, "unexpected text in imported file")
+					p.report(syntaxError(pos, "unexpected text in imported file"))
+				} else {
+					p.report(syntaxError(pos, "unexpected text in file with extends"))
 				}
-				return nil, nil, syntaxError(pos, "unexpected text in file with extends")
 			}
 			text = ast.NewText(tok.pos, tok.txt, ast.Cut{})
 		}
@@ -346,8 +542,9 @@ func ParseTemplateSource(src []byte, format ast.Format, imported, noParseShow bo
 		// {%
 		case tokenStartStatement:
 			numTokenInLine++
-			tok = p.next()
-			tok = p.parse(tok, tokenEndStatement)
+			tok = p.recovering(tokenEndStatement, func() token {
+				return p.parse(p.next(), tokenEndStatement)
+			})
 
 		// {%%
 		case tokenStartStatements:
@@ -357,7 +554,9 @@ func ParseTemplateSource(src []byte, format ast.Format, imported, noParseShow bo
 			p.addNode(statements)
 			tok = p.next()
 			for tok.typ != tokenEndStatements {
-				tok = p.parse(tok, tokenEndStatements)
+				tok = p.recovering(tokenEndStatements, func() token {
+					return p.parse(tok, tokenEndStatements)
+				})
 				if tok.typ == tokenEOF {
 					return nil, nil, syntaxError(tok.pos, "unexpected EOF, expecting %%%%}")
 				}
@@ -371,26 +570,10 @@ func ParseTemplateSource(src []byte, format ast.Format, imported, noParseShow bo
 
 		// {{
 		case tokenLeftBraces:
-			pos := tok.pos
-			if len(p.ancestors) == 1 && (p.imported || p.hasExtend) {
-				panic(syntaxError(pos, "unexpected %s, expecting declaration statement", tok))
-			}
 			numTokenInLine++
-			var expr ast.Expression
-			expr, tok = p.parseExpr(p.next(), false, false, false, false)
-			if expr == nil {
-				return nil, nil, syntaxError(tok.pos, "unexpected %s, expecting expression", tok)
-			}
-			if tok.typ != tokenRightBraces {
-				return nil, nil, syntaxError(tok.pos, "unexpected %s, expecting }}", tok)
-			}
-			pos.End = tok.pos.End
-			var node = ast.NewShow(pos, []ast.Expression{expr}, tok.ctx)
-			p.addNode(node)
-			if _, ok := expr.(*ast.Render); ok {
-				p.cutSpacesToken = true
-			}
-			tok = p.next()
+			tok = p.recovering(tokenRightBraces, func() token {
+				return p.parseShow(tok)
+			})
 
 		// StartURL
 		case tokenStartURL:
@@ -455,9 +638,35 @@ func ParseTemplateSource(src []byte, format ast.Format, imported, noParseShow bo
 		return nil, nil, syntaxError(tok.pos, "unexpected EOF, expecting {%% end %%} or {%% end %s %%}", stmt)
 	}
 
+	tree.Comments = p.lex.comments
+
 	return tree, p.unexpanded, nil
 }
 
+// parseShow parses a short show statement. tok is the {{ token. It returns
+// the first token after }}.
+func (p *parsing) parseShow(tok token) token {
+	pos := tok.pos
+	if len(p.ancestors) == 1 && (p.imported || p.hasExtend) {
+		panic(syntaxError(pos, "unexpected %s, expecting declaration statement", tok))
+	}
+	var expr ast.Expression
+	expr, tok = p.parseExpr(p.next(), false, false, false, false)
+	if expr == nil {
+		panic(syntaxError(tok.pos, "unexpected %s, expecting expression", tok))
+	}
+	if tok.typ != tokenRightBraces {
+		panic(syntaxError(tok.pos, "unexpected %s, expecting }}", tok))
+	}
+	pos.End = tok.pos.End
+	var node = ast.NewShow(pos, []ast.Expression{expr}, tok.ctx)
+	p.addNode(node)
+	if _, ok := expr.(*ast.Render); ok {
+		p.cutSpacesToken = true
+	}
+	return p.next()
+}
+
 // parse parses code.
 //
 // For a package or a function body, tok is the first token of a declaration
@@ -1598,12 +1807,32 @@ func (p *parsing) parseTypeDecl(tok token) (*ast.TypeDeclaration, token) {
 	if alias {
 		tok = p.next()
 	}
+	var typeParams []*ast.Parameter
+	if tok.typ == tokenLeftBracket && !alias {
+		// Distinguish the type parameters, as in "type T[P any] ...", from
+		// an array type, as in "type T [N]int".
+		isTypeParams := false
+		name := p.next()
+		if name.typ == tokenIdentifier {
+			next := p.next()
+			switch next.typ {
+			case tokenIdentifier, tokenComma, tokenTilde, tokenInterface, tokenMap, tokenChan, tokenFunc, tokenStruct:
+				isTypeParams = true
+			}
+			p.back(next)
+		}
+		p.back(name)
+		if isTypeParams {
+			typeParams, tok = p.parseTypeParams(tok)
+		}
+	}
 	var typ ast.Expression
 	typ, tok = p.parseExpr(tok, false, false, true, false)
 	if typ == nil {
 		panic(syntaxError(tok.pos, "unexpected %s in type declaration", tok))
 	}
 	node := ast.NewTypeDeclaration(pos, ident, typ, alias)
+	node.TypeParams = typeParams
 	return node, tok
 }
 
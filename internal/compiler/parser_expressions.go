@@ -11,6 +11,42 @@ import (
 	"github.com/open2b/scriggo/ast"
 )
 
+// ParseExpression parses a single expression, with the Go syntax, and
+// returns its tree.
+func ParseExpression(src []byte) (expr ast.Expression, err error) {
+
+	var p = &parsing{
+		lex: scanProgram(src),
+	}
+
+	defer func() {
+		p.lex.Stop()
+		if r := recover(); r != nil {
+			if e, ok := r.(*SyntaxError); ok {
+				expr = nil
+				err = e
+			} else {
+				panic(r)
+			}
+		}
+	}()
+
+	var tok token
+	expr, tok = p.parseExpr(p.next(), false, false, false, false)
+	if expr == nil {
+		panic(syntaxError(tok.pos, "unexpected %s, expecting expression", tok))
+	}
+	if tok.typ == tokenSemicolon && len(tok.txt) == 0 {
+		// Skip the semicolon automatically inserted at the end of the line.
+		tok = p.next()
+	}
+	if tok.typ != tokenEOF {
+		panic(syntaxError(tok.pos, "unexpected %s after expression", tok))
+	}
+
+	return expr, nil
+}
+
 // parseExpr parses an expression and returns its tree and the last read token
 // that does not belong to the expression. It panics on error.
 //
@@ -98,14 +134,16 @@ func (p *parsing) parseExpr(tok token, canBeSwitchGuard, canElideType, mustBeTyp
 				panic(syntaxError(tok.pos, "unexpected %s, expecting {", tok))
 			}
 			tok = p.next()
-			if tok.typ != tokenRightBrace {
-				if tok.typ == tokenIdentifier {
-					panic(syntaxError(tok.pos, "non-empty interfaces are not supported in this release of Scriggo"))
-				}
-				panic(syntaxError(tok.pos, "unexpected %s, expecting }", tok))
+			var methods []*ast.Field
+			for tok.typ != tokenRightBrace {
+				var method *ast.Field
+				method, tok = p.parseInterfaceMethod(tok)
+				methods = append(methods, method)
 			}
 			pos.End = tok.pos.End
-			operand = ast.NewInterface(pos)
+			iface := ast.NewInterface(pos)
+			iface.Methods = methods
+			operand = iface
 			tok = p.next()
 		case tokenFunc: // func
 			var node ast.Node
@@ -156,9 +194,10 @@ func (p *parsing) parseExpr(tok token, canBeSwitchGuard, canElideType, mustBeTyp
 			tokenExtendedNot,    // not e
 			tokenXor,            // ^e
 			tokenMultiplication, // *t, *T
-			tokenAmpersand:      // &e
+			tokenAmpersand,      // &e
+			tokenTilde:          // ~T
 			operator = ast.NewUnaryOperator(tok.pos, operatorFromTokenType(tok.typ, false), nil)
-			if mustBeType && tok.typ != tokenMultiplication {
+			if mustBeType && tok.typ != tokenMultiplication && tok.typ != tokenTilde {
 				panic(syntaxError(tok.pos, "unexpected %s, expecting type", tok.txt))
 			}
 			tok = p.next()
@@ -194,6 +233,17 @@ func (p *parsing) parseExpr(tok token, canBeSwitchGuard, canElideType, mustBeTyp
 					operand = ast.NewSelector(tok.pos, operand, ident.Name)
 					tok = p.next()
 				}
+				if tok.typ == tokenLeftBracket {
+					// Parse the type arguments of a generic type, unless the
+					// brackets start an array or slice type as in "a []int".
+					next := p.next()
+					p.back(next)
+					switch next.typ {
+					case tokenRightBracket, tokenEllipsis, tokenInt, tokenRune, tokenAddition, tokenSubtraction, tokenLeftParenthesis:
+					default:
+						operand, tok = p.parseTypeArgs(operand, tok)
+					}
+				}
 			}
 		case tokenLeftBracket: // [
 			canCompositeLiteral = true
@@ -332,12 +382,30 @@ func (p *parsing) parseExpr(tok token, canBeSwitchGuard, canElideType, mustBeTyp
 				operand = ast.NewCall(pos, operand, args, isVariadic)
 				canCompositeLiteral = false
 				tok = p.next()
-			case tokenLeftBracket: // e[...], e[.. : ..], e[.. : .. : ..],
+			case tokenLeftBracket: // e[...], e[.. : ..], e[.. : .. : ..], e[..., ...]
 				pos := tok.pos
 				pos.Start = operand.Pos().Start
 				var index ast.Expression
 				index, tok = p.parseExpr(p.next(), false, false, false, false)
-				if tok.typ == tokenColon {
+				if tok.typ == tokenComma && index != nil {
+					indices := []ast.Expression{index}
+					for tok.typ == tokenComma {
+						index, tok = p.parseExpr(p.next(), false, false, false, false)
+						if index == nil {
+							break
+						}
+						indices = append(indices, index)
+					}
+					if tok.typ != tokenRightBracket {
+						panic(syntaxError(tok.pos, "unexpected %s, expecting comma or ]", tok))
+					}
+					pos.End = tok.pos.End
+					if len(indices) == 1 {
+						operand = ast.NewIndex(pos, operand, indices[0])
+					} else {
+						operand = ast.NewIndexList(pos, operand, indices)
+					}
+				} else if tok.typ == tokenColon {
 					low := index
 					isFull := false
 					var high, max ast.Expression
@@ -724,6 +792,125 @@ func (p *parsing) parseField(tok token) (*ast.Field, token) {
 	return field, tok
 }
 
+// parseInterfaceMethod parses a method or an embedded interface of an
+// interface type. tok is the first token of the method or embedded interface.
+func (p *parsing) parseInterfaceMethod(tok token) (*ast.Field, token) {
+	if tok.typ != tokenIdentifier {
+		if tok.typ == tokenLeftParenthesis {
+			panic(syntaxError(tok.pos, "cannot parenthesize embedded type"))
+		}
+		if tok.typ != tokenTilde && !isTypeStart(tok.typ) {
+			panic(syntaxError(tok.pos, "unexpected %s, expecting method or interface name", tok))
+		}
+		// Type constraint element, as "~int | ~string".
+		field := ast.NewField(nil, nil, "")
+		field.Type, tok = p.parseExpr(tok, false, false, false, false)
+		return field, p.parseInterfaceElementEnd(tok)
+	}
+	pos := tok.pos
+	ident := ast.NewIdentifier(pos, string(tok.txt))
+	field := ast.NewField(nil, ident, "")
+	tok = p.next()
+	switch tok.typ {
+	case tokenPeriod:
+		// Embedded interface of a package.
+		tok = p.next()
+		if tok.typ != tokenIdentifier {
+			panic(syntaxError(tok.pos, "unexpected %s, expecting name", tok))
+		}
+		field.Type = ast.NewSelector(pos.WithEnd(tok.pos.End), ident, string(tok.txt))
+		tok = p.next()
+	case tokenLeftParenthesis:
+		// Method.
+		params, isVariadic, last, next := p.parseFuncParameters(tok, false, false)
+		typ := ast.NewFuncType(pos.WithEnd(last.End), false, params, nil, isVariadic)
+		typ.Result, _, last, tok = p.parseFuncParameters(next, false, true)
+		if typ.Result != nil {
+			typ.Position.End = last.End
+		}
+		field.Idents = []*ast.Identifier{ident}
+		field.Type = typ
+	case tokenComma:
+		panic(syntaxError(tok.pos, "name list not allowed in interface type"))
+	case tokenVerticalBar:
+		// Union of terms, as "int | ~string".
+		op := tok
+		var terms ast.Expression
+		terms, tok = p.parseExpr(p.next(), false, false, false, false)
+		if terms == nil {
+			panic(syntaxError(tok.pos, "unexpected %s, expecting type", tok))
+		}
+		field.Type = prependUnionTerm(ident, op.pos, terms)
+	}
+	return field, p.parseInterfaceElementEnd(tok)
+}
+
+// parseInterfaceElementEnd parses the end of an element of an interface type.
+// tok is the token after the element. It returns the next token.
+func (p *parsing) parseInterfaceElementEnd(tok token) token {
+	switch tok.typ {
+	case tokenSemicolon:
+		tok = p.next()
+	case tokenRightBrace:
+	default:
+		panic(syntaxError(tok.pos, "unexpected %s, expecting semicolon or newline or }", tok))
+	}
+	return tok
+}
+
+// prependUnionTerm prepends the term term to the union terms, whose "|"
+// operator is at position pos, and returns the resulting union.
+func prependUnionTerm(term ast.Expression, pos *ast.Position, terms ast.Expression) ast.Expression {
+	if op, ok := terms.(*ast.BinaryOperator); ok && op.Op == ast.OperatorBitOr && op.Parenthesis() == 0 {
+		op.Expr1 = prependUnionTerm(term, pos, op.Expr1)
+		op.Position.Start = term.Pos().Start
+		return op
+	}
+	pos = pos.WithEnd(terms.Pos().End)
+	pos.Start = term.Pos().Start
+	return ast.NewBinaryOperator(pos, ast.OperatorBitOr, term, terms)
+}
+
+// parseTypeArgs parses the type arguments of the generic type typ. tok is
+// the "[" token. It returns an Index node, if there is only one type argument,
+// or an IndexList node, and the next token after the "]" token.
+func (p *parsing) parseTypeArgs(typ ast.Expression, tok token) (ast.Expression, token) {
+	pos := tok.pos
+	pos.Start = typ.Pos().Start
+	var args []ast.Expression
+	tok = p.next()
+	for tok.typ != tokenRightBracket {
+		var arg ast.Expression
+		arg, tok = p.parseExpr(tok, false, false, true, false)
+		if arg == nil {
+			panic(syntaxError(tok.pos, "unexpected %s, expecting type", tok))
+		}
+		args = append(args, arg)
+		if tok.typ != tokenComma {
+			if tok.typ != tokenRightBracket {
+				panic(syntaxError(tok.pos, "unexpected %s, expecting comma or ]", tok))
+			}
+			break
+		}
+		tok = p.next()
+	}
+	pos.End = tok.pos.End
+	if len(args) == 1 {
+		return ast.NewIndex(pos, typ, args[0]), p.next()
+	}
+	return ast.NewIndexList(pos, typ, args), p.next()
+}
+
+// isTypeStart reports whether a token of type typ can start a type.
+func isTypeStart(typ tokenTyp) bool {
+	switch typ {
+	case tokenIdentifier, tokenLeftBracket, tokenMultiplication, tokenLeftParenthesis,
+		tokenFunc, tokenMap, tokenChan, tokenArrow, tokenStruct, tokenInterface:
+		return true
+	}
+	return false
+}
+
 // literalType returns a literal type from a token type.
 func literalType(typ tokenTyp) ast.LiteralType {
 	switch typ {
@@ -802,6 +989,8 @@ func operatorFromTokenType(typ tokenTyp, binary bool) ast.OperatorType {
 		return ast.OperatorLeftShift
 	case tokenRightShift:
 		return ast.OperatorRightShift
+	case tokenTilde:
+		return ast.OperatorTilde
 	default:
 		panic("invalid token type")
 	}
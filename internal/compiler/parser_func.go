@@ -22,21 +22,44 @@ const (
 func (p *parsing) parseFunc(tok token, kind funcKindToParse) (ast.Node, token) {
 	isMacro := tok.typ == tokenMacro
 	pos := tok.pos
-	// Parses the function name if present.
-	var ident *ast.Identifier
 	tok = p.next()
+	// Parses the receiver if present.
+	var recv *ast.Parameter
+	if !isMacro && kind == parseFuncDecl && tok.typ == tokenLeftParenthesis {
+		var params []*ast.Parameter
+		var isVariadic bool
+		lpar := tok.pos
+		params, isVariadic, _, tok = p.parseFuncParameters(tok, false, false)
+		if len(params) == 0 {
+			panic(syntaxError(lpar, "method has no receiver"))
+		}
+		if len(params) > 1 {
+			panic(syntaxError(lpar, "method has multiple receivers"))
+		}
+		if isVariadic {
+			panic(syntaxError(params[0].Type.Pos(), "invalid use of ..."))
+		}
+		recv = params[0]
+		if tok.typ != tokenIdentifier {
+			panic(syntaxError(tok.pos, "unexpected %s, expecting name", tok.txt))
+		}
+	}
+	// Parses the function name and the type parameters if present.
+	var ident *ast.Identifier
+	var typeParams []*ast.Parameter
 	if tok.typ == tokenIdentifier {
 		if kind&parseFuncDecl == 0 {
 			panic(syntaxError(tok.pos, "unexpected %s, expecting (", tok))
 		}
 		ident = ast.NewIdentifier(tok.pos, string(tok.txt))
 		tok = p.next()
-	} else if kind == parseFuncDecl {
-		// This check could be avoided (the code panics anyway) but improves the
-		// readability of the error message.
-		if !isMacro && tok.typ == tokenLeftParenthesis {
-			panic(syntaxError(tok.pos, "method declarations are not supported in this release of Scriggo"))
+		if tok.typ == tokenLeftBracket && !isMacro {
+			if recv != nil {
+				panic(syntaxError(tok.pos, "method must have no type parameters"))
+			}
+			typeParams, tok = p.parseTypeParams(tok)
 		}
+	} else if kind == parseFuncDecl {
 		// Node to parse must be a function declaration.
 		panic(syntaxError(tok.pos, "unexpected %s, expecting name", tok.txt))
 	}
@@ -66,6 +89,8 @@ func (p *parsing) parseFunc(tok token, kind funcKindToParse) (ast.Node, token) {
 		return typ, tok
 	}
 	node := ast.NewFunc(pos, ident, typ, nil, false, ast.Format(tok.ctx))
+	node.Recv = recv
+	node.TypeParams = typeParams
 	if !isMacro && tok.typ != tokenLeftBrace {
 		return node, tok
 	}
@@ -149,6 +174,27 @@ func (p *parsing) parseFuncParameters(tok token, isMacro, isResult bool) ([]*ast
 	for {
 		param := ast.NewParameter(nil, nil)
 		param.Type, tok = p.parseExpr(tok, false, false, true, false)
+		if index, ok := param.Type.(*ast.Index); ok {
+			// The parameter can be an array parameter as "a [N]int" that
+			// has been parsed as the instantiation "a[N]".
+			if name, ok := index.Expr.(*ast.Identifier); ok && isTypeStart(tok.typ) {
+				var elem ast.Expression
+				elem, tok = p.parseExpr(tok, false, false, true, false)
+				pos := index.Position.WithEnd(elem.Pos().End)
+				pos.Start += pos.Column - name.Column
+				param.Ident = name
+				param.Type = ast.NewArrayType(pos, index.Index, elem)
+				parameters = append(parameters, param)
+				if tok.typ != tokenComma {
+					if tok.typ != tokenRightParenthesis {
+						panic(syntaxError(tok.pos, "unexpected %s, expecting comma or )", tok))
+					}
+					break
+				}
+				tok = p.next()
+				continue
+			}
+		}
 		if tok.typ == tokenEllipsis {
 			if ellipses.param == nil {
 				ellipses.param = param
@@ -231,3 +277,39 @@ func (p *parsing) parseFuncParameters(tok token, isMacro, isResult bool) ([]*ast
 
 	return parameters, ellipses.param != nil, tok.pos, p.next()
 }
+
+// parseTypeParams parses the type parameters of a generic function or type
+// declaration. tok is the "[" token. It returns the type parameters and the
+// next token after the "]" token.
+func (p *parsing) parseTypeParams(tok token) ([]*ast.Parameter, token) {
+	var params []*ast.Parameter
+	tok = p.next()
+	if tok.typ == tokenRightBracket {
+		panic(syntaxError(tok.pos, "empty type parameter list"))
+	}
+	for tok.typ != tokenRightBracket {
+		if tok.typ != tokenIdentifier {
+			panic(syntaxError(tok.pos, "unexpected %s, expecting name", tok))
+		}
+		param := ast.NewParameter(p.parseIdentifierNode(tok), nil)
+		params = append(params, param)
+		tok = p.next()
+		if tok.typ != tokenComma {
+			param.Type, tok = p.parseExpr(tok, false, false, false, false)
+			if param.Type == nil {
+				panic(syntaxError(tok.pos, "unexpected %s, expecting type constraint", tok))
+			}
+			if tok.typ != tokenComma {
+				if tok.typ != tokenRightBracket {
+					panic(syntaxError(tok.pos, "unexpected %s, expecting comma or ]", tok))
+				}
+				break
+			}
+		}
+		tok = p.next()
+	}
+	if last := params[len(params)-1]; last.Type == nil {
+		panic(syntaxError(tok.pos, "missing type constraint"))
+	}
+	return params, p.next()
+}
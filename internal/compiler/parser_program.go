@@ -20,6 +20,12 @@ var (
 
 // ParseProgram parses a program.
 func ParseProgram(fsys fs.FS) (*ast.Tree, error) {
+	return parseProgram(fsys, 0)
+}
+
+// parseProgram parses a program collecting up to maxErrors syntax errors, as
+// in Options.MaxErrors. Errors are collected for a single file.
+func parseProgram(fsys fs.FS, maxErrors int) (*ast.Tree, error) {
 
 	modPath, err := readModulePath(fsys)
 	if err != nil {
@@ -48,7 +54,7 @@ func ParseProgram(fsys fs.FS) (*ast.Tree, error) {
 		if n.Path != "main" {
 			dir = strings.TrimPrefix(n.Path, modPrefix)
 		}
-		n.Tree, err = parsePackage(fsys, dir)
+		n.Tree, err = parsePackage(fsys, dir, maxErrors)
 		if err != nil {
 			return nil, err
 		}
@@ -118,7 +124,8 @@ func ParseProgram(fsys fs.FS) (*ast.Tree, error) {
 }
 
 // parsePackage parses a package at the given directory in fsys.
-func parsePackage(fsys fs.FS, dir string) (*ast.Tree, error) {
+// maxErrors is the maximum number of errors, as in Options.MaxErrors.
+func parsePackage(fsys fs.FS, dir string, maxErrors int) (*ast.Tree, error) {
 	files, err := fs.ReadDir(fsys, dir)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
@@ -150,7 +157,7 @@ func parsePackage(fsys fs.FS, dir string) (*ast.Tree, error) {
 	if err != nil {
 		return nil, err
 	}
-	tree, err := parseSource(src, false)
+	tree, err := parseSource(src, false, maxErrors)
 	if err != nil {
 		return nil, err
 	}
@@ -30,16 +30,27 @@ type FormatFS interface {
 // If noParseShow is true, short show statements are not parsed.
 //
 // ParseTemplate expands the nodes Extends, Import and Render parsing the
-// relative trees.
-func ParseTemplate(fsys fs.FS, name string, noParseShow bool) (*ast.Tree, error) {
+// relative trees. If noExpand is true, these nodes are not expanded and
+// their Tree fields are nil.
+func ParseTemplate(fsys fs.FS, name string, noParseShow, noExpand bool) (*ast.Tree, error) {
+	tree, _, err := parseTemplate(fsys, name, noParseShow, noExpand, 0)
+	return tree, err
+}
+
+// parseTemplate is like ParseTemplate but also returns the dependencies of
+// the named file, that are the references to the files extended, imported
+// and rendered, directly or indirectly, by the file. The dependencies are
+// returned in the order in which the references are expanded. maxErrors is
+// the maximum number of syntax errors of a file, as in Options.MaxErrors.
+func parseTemplate(fsys fs.FS, name string, noParseShow, noExpand bool, maxErrors int) (*ast.Tree, []Dependency, error) {
 
 	if name == "." || strings.HasSuffix(name, "/") {
-		return nil, os.ErrInvalid
+		return nil, nil, os.ErrInvalid
 	}
 
 	src, format, err := readFileAndFormat(fsys, name)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	pp := &templateExpansion{
@@ -48,28 +59,49 @@ func ParseTemplate(fsys fs.FS, name string, noParseShow bool) (*ast.Tree, error)
 		paths:       []string{},
 		canExtend:   true,
 		noParseShow: noParseShow,
+		noExpand:    noExpand,
+		maxErrors:   maxErrors,
 	}
 
 	tree, err := pp.parseSource(src, name, format, false)
 	if err != nil {
-		if err2, ok := err.(*SyntaxError); ok && err2.path == "" {
-			err2.path = name
-		} else if e, ok := err.(*CycleError); ok {
+		if e, ok := err.(*CycleError); ok {
 			e.msg = "file " + name + e.msg + ": cycle not allowed"
 		}
-		return nil, err
+		return nil, nil, err
 	}
 
-	return tree, nil
+	return tree, pp.dependencies, nil
 }
 
 // templateExpansion represents the state of a template expansion.
 type templateExpansion struct {
-	fsys        fs.FS
-	trees       map[string]parsedTree
-	paths       []string
-	canExtend   bool
-	noParseShow bool
+	fsys         fs.FS
+	trees        map[string]parsedTree
+	paths        []string
+	canExtend    bool
+	noParseShow  bool
+	noExpand     bool
+	maxErrors    int
+	dependencies []Dependency
+}
+
+// DependencyKind is the kind of a dependency.
+type DependencyKind uint8
+
+// Dependency kinds.
+const (
+	DependencyExtends DependencyKind = iota
+	DependencyImport
+	DependencyRender
+)
+
+// Dependency is a file extended, imported or rendered by a template file.
+type Dependency struct {
+	Path   string         // path of the file.
+	Parent string         // path of the file that extends, imports or renders the file.
+	Kind   DependencyKind // kind of the dependency.
+	Pos    ast.Position   // position of the reference in the parent file.
 }
 
 // parsedTree represents a parsed tree. parent is the file path and node that
@@ -154,6 +186,7 @@ func (pp *templateExpansion) parseNodeFile(node ast.Node) (*ast.Tree, error) {
 			}
 		}
 		tree = parsed.tree
+		pp.addDependency(name, node)
 	}
 
 	if tree == nil {
@@ -162,6 +195,7 @@ func (pp *templateExpansion) parseNodeFile(node ast.Node) (*ast.Tree, error) {
 		if err != nil {
 			return nil, err
 		}
+		pp.addDependency(name, node)
 		tree, err = pp.parseSource(src, name, format, imported)
 		if err != nil {
 			return nil, err
@@ -175,35 +209,66 @@ func (pp *templateExpansion) parseNodeFile(node ast.Node) (*ast.Tree, error) {
 	return tree, nil
 }
 
+// addDependency adds the file with the given path, referenced by node, to the
+// dependencies.
+func (pp *templateExpansion) addDependency(path string, node ast.Node) {
+	dep := Dependency{Path: path, Parent: pp.paths[len(pp.paths)-1], Pos: *node.Pos()}
+	switch node.(type) {
+	case *ast.Extends:
+		dep.Kind = DependencyExtends
+	case *ast.Import:
+		dep.Kind = DependencyImport
+	case *ast.Render:
+		dep.Kind = DependencyRender
+	}
+	pp.dependencies = append(pp.dependencies, dep)
+}
+
 // parseSource parses src expanding Extends, Import and Render nodes.
 // path is the path of the file, format is its content format, parseShebang
 // indicates whether the shebang line is parsed and imported indicates whether
 // the file is imported. path must be absolute and cleared.
 func (pp *templateExpansion) parseSource(src []byte, path string, format ast.Format, imported bool) (*ast.Tree, error) {
 
-	tree, unexpanded, err := ParseTemplateSource(src, format, imported, pp.noParseShow)
+	tree, unexpanded, err := parseTemplateSource(src, format, imported, pp.noParseShow, pp.maxErrors)
 	if err != nil {
-		if se, ok := err.(*SyntaxError); ok {
-			se.path = path
-		}
+		setSyntaxErrorPath(err, path)
 		return nil, err
 	}
 	tree.Path = path
 
+	if pp.noExpand {
+		return tree, nil
+	}
+
 	// Expand the nodes.
 	pp.paths = append(pp.paths, path)
 	err = pp.expand(unexpanded)
 	pp.paths = pp.paths[:len(pp.paths)-1]
 	if err != nil {
-		if e, ok := err.(*SyntaxError); ok && e.path == "" {
-			e.path = path
-		}
+		setSyntaxErrorPath(err, path)
 		return nil, err
 	}
 
 	return tree, nil
 }
 
+// setSyntaxErrorPath sets the path of err, if it is a syntax error without a
+// path, or the paths of the syntax errors without a path, if it is an Errors
+// value.
+func setSyntaxErrorPath(err error, path string) {
+	switch e := err.(type) {
+	case *SyntaxError:
+		if e.path == "" {
+			e.path = path
+		}
+	case Errors:
+		for _, err := range e {
+			setSyntaxErrorPath(err, path)
+		}
+	}
+}
+
 // expand expands nodes parsing the sub-trees.
 func (pp *templateExpansion) expand(nodes []ast.Node) error {
 
@@ -1449,7 +1449,7 @@ func fileTests() map[string]struct {
 
 func TestGoContextTrees(t *testing.T) {
 	for _, tree := range goContextTreeTests {
-		node, err := parseSource([]byte(tree.src), true)
+		node, err := parseSource([]byte(tree.src), true, 0)
 		if err != nil {
 			t.Errorf("source: %q, %s\n", tree.src, err)
 			continue
@@ -1478,7 +1478,7 @@ func TestShebang(t *testing.T) {
 		if test.template {
 			_, _, err = ParseTemplateSource([]byte(test.src), ast.FormatText, false, false)
 		} else {
-			_, err = parseSource([]byte(test.src), false)
+			_, err = parseSource([]byte(test.src), false, 0)
 		}
 		if err == nil {
 			if test.err != "" {
@@ -1493,6 +1493,56 @@ func TestShebang(t *testing.T) {
 	}
 }
 
+var syntaxErrorsTests = []struct {
+	src       string
+	template  bool
+	maxErrors int
+	err       string
+}{
+	{"{% a := %}{{ 1 + }}{% if %}{% end %}", true, -1, ":1:9: syntax error: unexpected %}, expecting expression\n" +
+		":1:18: syntax error: unexpected }}, expecting expression\n" +
+		":1:26: syntax error: missing condition in if statement\n" +
+		":1:31: syntax error: unexpected end"},
+	{"{% a := %}{{ 1 + }}{% if %}{% end %}", true, 2, ":1:9: syntax error: unexpected %}, expecting expression\n" +
+		":1:18: syntax error: unexpected }}, expecting expression"},
+	{"{% a := %}{{ 1 + }}", true, 0, ":1:9: syntax error: unexpected %}, expecting expression"},
+	{"{%% a := 1 +; b := ; c := 3 %%}", true, -1, ":1:13: syntax error: unexpected semicolon, expecting expression\n" +
+		":1:20: syntax error: unexpected semicolon, expecting expression"},
+	{"package main\nfunc f() { a := 1 +; b }\nfunc g() { c := }\nvar d = 5\n", false, -1, ":2:20: syntax error: unexpected semicolon, expecting expression\n" +
+		":3:17: syntax error: unexpected }, expecting expression"},
+	{"package main\nfunc f() { a := 1 +; b }\nfunc g() { c := }\n", false, 1, ":2:20: syntax error: unexpected semicolon, expecting expression"},
+	{"package main\nfunc () M() {}\n", false, -1, ":2:6: syntax error: method has no receiver"},
+	{"package main\nfunc (a, b T) M() {}\n", false, -1, ":2:6: syntax error: method has multiple receivers"},
+	{"package main\nfunc (t T) () {}\n", false, -1, ":2:12: syntax error: unexpected (, expecting name"},
+	{"package main\ntype I interface { (J) }\n", false, -1, ":2:20: syntax error: cannot parenthesize embedded type"},
+	{"package main\ntype I interface { M, N() }\n", false, -1, ":2:21: syntax error: name list not allowed in interface type"},
+	{"package main\ntype I interface { M() int string }\n", false, -1, ":2:28: syntax error: unexpected string, expecting semicolon or newline or }"},
+	{"package main\nfunc (t T) M[U any]() {}\n", false, -1, ":2:13: syntax error: method must have no type parameters"},
+	{"package main\nfunc f[]() {}\n", false, -1, ":2:8: syntax error: empty type parameter list"},
+	{"package main\ntype I interface { ~int | }\n", false, -1, ":2:27: syntax error: unexpected }, expecting expression"},
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	for _, test := range syntaxErrorsTests {
+		var err error
+		if test.template {
+			_, _, err = parseTemplateSource([]byte(test.src), ast.FormatText, false, false, test.maxErrors)
+		} else {
+			_, err = parseSource([]byte(test.src), false, test.maxErrors)
+		}
+		if err == nil {
+			t.Errorf("source: %q, expected error %q, got nothing\n", test.src, test.err)
+			continue
+		}
+		if err.Error() != test.err {
+			t.Errorf("source: %q, expected error %q, got %q\n", test.src, test.err, err)
+		}
+		if errs, ok := err.(Errors); ok && len(errs) < 2 {
+			t.Errorf("source: %q, unexpected %d errors in an Errors value\n", test.src, len(errs))
+		}
+	}
+}
+
 func TestTrees(t *testing.T) {
 	for _, tree := range treeTests {
 		node, _, err := ParseTemplateSource([]byte(tree.src), ast.FormatHTML, false, false)
@@ -117,6 +117,7 @@ const (
 	tokenContains                          // contains
 	tokenRaw                               // raw
 	tokenUsing                             // using
+	tokenTilde                             // ~
 )
 
 var tokenString = map[tokenTyp]string{
@@ -223,6 +224,7 @@ var tokenString = map[tokenTyp]string{
 	tokenContains:                 "contains",
 	tokenRaw:                      "raw",
 	tokenUsing:                    "using",
+	tokenTilde:                    "~",
 }
 
 func (tt tokenTyp) String() string {
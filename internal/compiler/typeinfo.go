@@ -33,15 +33,16 @@ const (
 // checker scopes to associate the declarations to the type checking
 // information.
 type typeInfo struct {
-	Type              reflect.Type // Type.
-	Alias             string       // Alias.
-	Properties        properties   // Properties.
-	Constant          constant     // Constant value.
-	NativePackageName string       // Name of the package. Empty string if non-native.
-	MethodType        methodType   // Method type.
-	value             interface{}  // value; for packages has type *Package.
-	valueType         reflect.Type // When value is a native type holds the original type of value.
-	replacement       ast.Node     // Replacement node.
+	Type              reflect.Type    // Type.
+	Alias             string          // Alias.
+	Properties        properties      // Properties.
+	Constant          constant        // Constant value.
+	NativePackageName string          // Name of the package. Empty string if non-native.
+	MethodType        methodType      // Method type.
+	value             interface{}     // value; for packages has type *Package.
+	valueType         reflect.Type    // When value is a native type holds the original type of value.
+	replacement       ast.Node        // Replacement node.
+	constraint        *typeConstraint // Type constraint, for interfaces with type sets.
 }
 
 // methodType represents the type of a method, intended as a combination of a
@@ -54,6 +55,9 @@ const (
 	methodValueInterface                   // Method value on an interface receiver.
 	methodCallConcrete                     // Method call on concrete receiver.
 	methodCallInterface                    // Method call on interface receiver.
+	methodValueScriggo                     // Method value of a method declared in Scriggo.
+	methodCallScriggo                      // Method call of a method declared in Scriggo.
+	methodExprScriggo                      // Method expression of a method declared in Scriggo.
 )
 
 // Nil reports whether it is the predeclared nil.
@@ -86,6 +90,12 @@ func (ti *typeInfo) IsType() bool {
 	return ti.Properties&propertyIsType != 0
 }
 
+// IsGeneric reports whether it is a generic function or type.
+func (ti *typeInfo) IsGeneric() bool {
+	_, ok := ti.value.(*generic)
+	return ok
+}
+
 // IsFormatType reports whether it is a format type.
 func (ti *typeInfo) IsFormatType() bool {
 	return ti.Properties&propertyIsFormatType != 0
@@ -21,12 +21,14 @@ type definedType struct {
 
 	name string
 
-	// sign ensures that a definedType returned by DefinedOf is always
+	// methods holds the methods declared in Scriggo.
+	//
+	// It also ensures that a definedType returned by DefinedOf is always
 	// different from every other instance of definedType.
 	// By doing so, two reflect.Types are equal if and only if the type they
 	// represents are identical (every defined type, in Go, is different from
 	// every other type).
-	sign *byte
+	methods *methodSet
 }
 
 // DefinedOf returns the defined type with the given name and underlying type.
@@ -36,7 +38,17 @@ func (types *Types) DefinedOf(name string, underlyingType reflect.Type) reflect.
 	if name == "" {
 		panic(internalError("name cannot be empty"))
 	}
-	return definedType{Type: underlyingType, name: name, sign: new(byte)}
+	return definedType{Type: underlyingType, name: name, methods: &methodSet{}}
+}
+
+// Underlying returns the underlying type passed to DefinedOf to create the
+// defined type t. It panics if t has not been created by DefinedOf.
+func Underlying(t reflect.Type) reflect.Type {
+	dt, ok := t.(definedType)
+	if !ok {
+		panic(internalError("%s is not a defined type", t))
+	}
+	return dt.Type
 }
 
 func (x definedType) Name() string {
@@ -55,7 +67,10 @@ func (x definedType) Implements(y reflect.Type) bool {
 	return Implements(x, y)
 }
 
-func (x definedType) MethodByName(string) (reflect.Method, bool) {
+func (x definedType) MethodByName(name string) (reflect.Method, bool) {
+	if x.Type.Kind() == reflect.Interface {
+		return x.Type.MethodByName(name)
+	}
 	// TODO.
 	return reflect.Method{}, false
 }
@@ -77,7 +92,31 @@ func (x definedType) GoType() reflect.Type {
 }
 
 // Unwrap implements the interface runtime.ScriggoType.
-func (x definedType) Unwrap(v reflect.Value) (reflect.Value, bool) { return unwrap(x, v) }
+func (x definedType) Unwrap(v reflect.Value) (reflect.Value, bool) {
+	if x.Type.Kind() == reflect.Interface {
+		return unwrapInterface(x, v)
+	}
+	return unwrap(x, v)
+}
 
 // Wrap implements the interface runtime.ScriggoType.
-func (x definedType) Wrap(v reflect.Value) reflect.Value { return wrap(x, v) }
+func (x definedType) Wrap(v reflect.Value) reflect.Value {
+	if x.Type.Kind() == reflect.Interface {
+		// Values of interface types are not wrapped.
+		return v
+	}
+	return wrap(x, v)
+}
+
+// ScriggoMethod implements the interface runtime.ScriggoMethodSet.
+func (x definedType) ScriggoMethod(name string) (*runtime.Function, bool, []int, bool) {
+	return scriggoMethod(x, name)
+}
+
+// WrapMethods implements the interface runtime.ScriggoMethodSet.
+func (x definedType) WrapMethods(v reflect.Value, call runtime.MethodCallFunc) reflect.Value {
+	if x.Type.Kind() == reflect.Interface {
+		return v
+	}
+	return wrapMethods(x, v, call)
+}
@@ -0,0 +1,142 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var emptyInterfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// InterfaceOf returns the interface type with the given methods. The type of
+// a method does not have the receiver. If there are no methods, it returns
+// the empty interface type, otherwise it returns a new Scriggo interface
+// type. The methods can have Scriggo types.
+func (types *Types) InterfaceOf(methods []reflect.Method) reflect.Type {
+	if len(methods) == 0 {
+		return emptyInterfaceType
+	}
+	ms := make([]reflect.Method, len(methods))
+	copy(ms, methods)
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Name < ms[j].Name })
+	for i := range ms {
+		ms[i].Index = i
+		ms[i].Func = reflect.Value{}
+	}
+	return interfaceType{
+		Type:    emptyInterfaceType,
+		methods: types.addMethods(ms),
+	}
+}
+
+// addMethods adds a list of interface methods to the cache if not already
+// present or returns the found one. This avoids duplication of interface
+// types by ensuring that every pointer to slice returned by this method is
+// equal if and only if the underlying slice is equal.
+func (types *Types) addMethods(methods []reflect.Method) *[]reflect.Method {
+	for _, stored := range types.interfaceMethodsLists {
+		if equalMethods(*stored, methods) {
+			return stored
+		}
+	}
+	newMethods := &methods
+	types.interfaceMethodsLists = append(types.interfaceMethodsLists, newMethods)
+	return newMethods
+}
+
+func equalMethods(ms1, ms2 []reflect.Method) bool {
+	if len(ms1) != len(ms2) {
+		return false
+	}
+	for i, m := range ms1 {
+		if m.Name != ms2[i].Name || m.PkgPath != ms2[i].PkgPath || m.Type != ms2[i].Type {
+			return false
+		}
+	}
+	return true
+}
+
+// interfaceType represents a non-empty interface type defined in Scriggo.
+// The embedded reflect.Type is the empty interface type, that is the type of
+// the values at run time.
+type interfaceType struct {
+	reflect.Type
+	methods *[]reflect.Method // sorted by name.
+}
+
+func (x interfaceType) AssignableTo(y reflect.Type) bool {
+	return AssignableTo(x, y)
+}
+
+func (x interfaceType) ConvertibleTo(y reflect.Type) bool {
+	return ConvertibleTo(x, y)
+}
+
+func (x interfaceType) Implements(y reflect.Type) bool {
+	return Implements(x, y)
+}
+
+func (x interfaceType) Method(i int) reflect.Method {
+	return (*x.methods)[i]
+}
+
+func (x interfaceType) MethodByName(name string) (reflect.Method, bool) {
+	methods := *x.methods
+	i := sort.Search(len(methods), func(i int) bool { return methods[i].Name >= name })
+	if i < len(methods) && methods[i].Name == name {
+		return methods[i], true
+	}
+	return reflect.Method{}, false
+}
+
+func (x interfaceType) NumMethod() int {
+	return len(*x.methods)
+}
+
+func (x interfaceType) String() string {
+	var b strings.Builder
+	b.WriteString("interface {")
+	for i, m := range *x.methods {
+		if i > 0 {
+			b.WriteByte(';')
+		}
+		b.WriteByte(' ')
+		b.WriteString(m.Name)
+		b.WriteString(strings.TrimPrefix(m.Type.String(), "func"))
+	}
+	b.WriteString(" }")
+	return b.String()
+}
+
+// GoType implements the interface runtime.ScriggoType.
+func (x interfaceType) GoType() reflect.Type {
+	return x.Type
+}
+
+// Unwrap implements the interface runtime.ScriggoType.
+func (x interfaceType) Unwrap(v reflect.Value) (reflect.Value, bool) {
+	return unwrapInterface(x, v)
+}
+
+// Wrap implements the interface runtime.ScriggoType.
+func (x interfaceType) Wrap(v reflect.Value) reflect.Value { return v }
+
+// unwrapInterface unwraps the value v, read from an interface value, if its
+// dynamic type implements the interface type x. As the values of the
+// interface types are not wrapped, the returned value is v itself.
+func unwrapInterface(x reflect.Type, v reflect.Value) (reflect.Value, bool) {
+	var t reflect.Type
+	if p, ok := v.Interface().(proxy); ok {
+		_, t = p.proxied()
+	} else {
+		t = v.Type()
+	}
+	if !Implements(t, x) {
+		return reflect.Value{}, false
+	}
+	return v, true
+}
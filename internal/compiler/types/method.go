@@ -0,0 +1,193 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/open2b/scriggo/internal/runtime"
+)
+
+// Method represents a method declared in Scriggo on a defined type.
+type Method struct {
+	Name string            // name.
+	Type reflect.Type      // type, without the receiver.
+	Ptr  bool              // reports whether the receiver is a pointer.
+	Func *runtime.Function // function, with the receiver as first parameter.
+}
+
+// methodSet is the set of the methods declared in Scriggo on a defined type.
+type methodSet struct {
+	methods []*Method // sorted by name.
+}
+
+// AddMethod adds the method m to the methods of the defined type t. It panics
+// if t has not been created by DefinedOf or if t already has a method with
+// the same name.
+func AddMethod(t reflect.Type, m *Method) {
+	dt, ok := t.(definedType)
+	if !ok {
+		panic(internalError("%s is not a defined type", t))
+	}
+	set := dt.methods
+	i := sort.Search(len(set.methods), func(i int) bool { return set.methods[i].Name >= m.Name })
+	if i < len(set.methods) && set.methods[i].Name == m.Name {
+		panic(internalError("method %s.%s already declared", t, m.Name))
+	}
+	set.methods = append(set.methods, nil)
+	copy(set.methods[i+1:], set.methods[i:])
+	set.methods[i] = m
+}
+
+// Methods returns the methods declared on the defined type t, sorted by name.
+// If t has not been created by DefinedOf, it returns nil.
+func Methods(t reflect.Type) []*Method {
+	if dt, ok := t.(definedType); ok {
+		return dt.methods.methods
+	}
+	return nil
+}
+
+// MethodByName returns the method declared in Scriggo with the given name in
+// the method set of t. The method set of a defined type T contains the
+// methods declared with receiver type T, the method set of the pointer type
+// *T contains also the methods declared with receiver type *T.
+func MethodByName(t reflect.Type, name string) (*Method, bool) {
+	ptr := false
+	if pt, ok := t.(ptrType); ok {
+		t = pt.elem
+		ptr = true
+	}
+	dt, ok := t.(definedType)
+	if !ok {
+		return nil, false
+	}
+	if m := dt.methods.lookup(name); m != nil && (ptr || !m.Ptr) {
+		return m, true
+	}
+	return nil, false
+}
+
+// LookupMethod is like MethodByName but, if t does not declare a method
+// with the given name, it also looks for a method declared in Scriggo that
+// is promoted to t from an embedded field. index is the index sequence of
+// the embedded field or nil if the method is declared on t.
+//
+// As in Go, a promoted method must be at the shallowest depth and it must
+// not be ambiguous or hidden by a field or by a native method. A promoted
+// method with a pointer receiver is in the method set of a struct type only
+// if it is promoted through an embedded pointer.
+func LookupMethod(t reflect.Type, name string) (m *Method, index []int, ok bool) {
+	if m, ok := MethodByName(t, name); ok {
+		return m, nil, true
+	}
+	ptr := false
+	if pt, ok := t.(ptrType); ok {
+		t = pt.elem
+		ptr = true
+	}
+	if dt, ok := t.(definedType); ok && dt.methods.lookup(name) != nil {
+		return nil, nil, false
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, nil, false
+	}
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+		ptr   bool // reports whether the field is reached through a pointer.
+	}
+	visited := map[reflect.Type]bool{}
+	current := []embedded{{typ: t, ptr: ptr}}
+	for depth := 0; len(current) > 0; depth++ {
+		var next []embedded
+		var found embedded
+		n := 0
+		m = nil
+		for _, e := range current {
+			typ := e.typ
+			if depth > 0 {
+				elem := typ
+				if pt, ok := typ.(ptrType); ok {
+					elem = pt.elem
+				}
+				if dt, ok := elem.(definedType); ok && dt.methods.lookup(name) != nil {
+					m, found = dt.methods.lookup(name), e
+					n++
+				} else if _, ok := typ.MethodByName(name); ok {
+					n++
+				}
+			}
+			if typ.Kind() == reflect.Ptr {
+				typ = typ.Elem()
+			}
+			if typ.Kind() != reflect.Struct || visited[typ] {
+				continue
+			}
+			visited[typ] = true
+			for i := 0; i < typ.NumField(); i++ {
+				f := typ.Field(i)
+				if fieldName(f.Name) == name {
+					n++
+				}
+				if f.Anonymous {
+					index := make([]int, len(e.index)+1)
+					copy(index, e.index)
+					index[len(e.index)] = i
+					next = append(next, embedded{typ: f.Type, index: index, ptr: e.ptr || f.Type.Kind() == reflect.Ptr})
+				}
+			}
+		}
+		if n > 0 {
+			if n > 1 || m == nil || m.Ptr && !found.ptr {
+				return nil, nil, false
+			}
+			return m, found.index, true
+		}
+		current = next
+	}
+	return nil, nil, false
+}
+
+// lookup returns the method with the given name, or nil if there is no such
+// method.
+func (set *methodSet) lookup(name string) *Method {
+	methods := set.methods
+	i := sort.Search(len(methods), func(i int) bool { return methods[i].Name >= name })
+	if i < len(methods) && methods[i].Name == name {
+		return methods[i]
+	}
+	return nil
+}
+
+// fieldName returns the name of a struct field, as declared in Scriggo,
+// given its name in the struct type.
+func fieldName(name string) string {
+	if !strings.HasPrefix(name, "𝗽") {
+		return name
+	}
+	return strings.TrimLeft(name[len("𝗽"):], "0123456789")
+}
+
+// scriggoMethod is called by the ScriggoMethod methods of the types defined
+// in this package.
+func scriggoMethod(t reflect.Type, name string) (*runtime.Function, bool, []int, bool) {
+	m, index, ok := LookupMethod(t, name)
+	if !ok {
+		return nil, false, nil, false
+	}
+	return m.Func, m.Ptr, index, true
+}
+
+// nativeMethods are the methods, declared in Scriggo, that are visible to
+// the native code. A value of a Scriggo type has these methods when it is
+// stored in an interface value, so a Scriggo type can implement a native
+// interface type only if the interface has no other methods.
+var nativeMethods = map[string]reflect.Type{
+	"Error":  reflect.TypeOf((func() string)(nil)),
+	"String": reflect.TypeOf((func() string)(nil)),
+}
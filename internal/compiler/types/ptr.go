@@ -64,3 +64,13 @@ func (x ptrType) Unwrap(v reflect.Value) (reflect.Value, bool) { return unwrap(x
 
 // Wrap implements the interface runtime.ScriggoType.
 func (x ptrType) Wrap(v reflect.Value) reflect.Value { return wrap(x, v) }
+
+// ScriggoMethod implements the interface runtime.ScriggoMethodSet.
+func (x ptrType) ScriggoMethod(name string) (*runtime.Function, bool, []int, bool) {
+	return scriggoMethod(x, name)
+}
+
+// WrapMethods implements the interface runtime.ScriggoMethodSet.
+func (x ptrType) WrapMethods(v reflect.Value, call runtime.MethodCallFunc) reflect.Value {
+	return wrapMethods(x, v, call)
+}
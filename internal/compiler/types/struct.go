@@ -156,3 +156,13 @@ func (x structType) Unwrap(v reflect.Value) (reflect.Value, bool) { return unwra
 
 // Wrap implements the interface runtime.ScriggoType.
 func (x structType) Wrap(v reflect.Value) reflect.Value { return wrap(x, v) }
+
+// ScriggoMethod implements the interface runtime.ScriggoMethodSet.
+func (x structType) ScriggoMethod(name string) (*runtime.Function, bool, []int, bool) {
+	return scriggoMethod(x, name)
+}
+
+// WrapMethods implements the interface runtime.ScriggoMethodSet.
+func (x structType) WrapMethods(v reflect.Value, call runtime.MethodCallFunc) reflect.Value {
+	return wrapMethods(x, v, call)
+}
@@ -24,6 +24,10 @@ type Types struct {
 	// structFieldsLists avoid the creation of two different structTypes with
 	// the same struct fields.
 	structFieldsLists []*map[int]reflect.StructField
+
+	// interfaceMethodsLists avoid the creation of two different
+	// interfaceTypes with the same methods.
+	interfaceMethodsLists []*[]reflect.Method
 }
 
 // NewTypes returns a new instance of Types.
@@ -158,18 +162,72 @@ func ConvertibleTo(x, y reflect.Type) bool {
 	return false
 }
 
+// IdenticalUnderlying reports whether x and y have identical underlying
+// types.
+func IdenticalUnderlying(x, y reflect.Type) bool {
+	return identical(x, y, true, false)
+}
+
 // Implements reports whether x implements the interface type y.
 func Implements(x, y reflect.Type) bool {
-	if _, ok := x.(runtime.ScriggoType); ok {
-		return y.NumMethod() == 0
+	_, xs := x.(runtime.ScriggoType)
+	_, ys := y.(runtime.ScriggoType)
+	if !xs && !ys {
+		// If y has unexported methods, and x is not an interface type, it is not possible to check
+		// if x implements y using the x.NumMethod and x.Method methods, because they do not return
+		// the unexported methods of x. Therefore, the x.Implements method is used instead.
+		return x.Implements(y)
 	}
-	if _, ok := y.(runtime.ScriggoType); ok {
-		return true
+	isInterface := x.Kind() == reflect.Interface
+	for i := 0; i < y.NumMethod(); i++ {
+		mi := y.Method(i)
+		var mt reflect.Type
+		switch {
+		case isInterface:
+			m, ok := x.MethodByName(mi.Name)
+			if !ok || m.PkgPath != mi.PkgPath {
+				return false
+			}
+			mt = m.Type
+		case xs:
+			m, _, ok := LookupMethod(x, mi.Name)
+			if !ok || mi.PkgPath != "" {
+				return false
+			}
+			mt = m.Type
+		default:
+			// x is a native type and y is a Scriggo interface type.
+			m, ok := x.MethodByName(mi.Name)
+			if !ok {
+				return false
+			}
+			mt = removeReceiver(m.Type)
+		}
+		if mt != mi.Type {
+			return false
+		}
+		// A Scriggo type implements a native interface type only if the
+		// methods of the interface are visible to the native code. The
+		// dynamic value of a Scriggo interface type can have a Scriggo type.
+		if xs && !ys && nativeMethods[mi.Name] != mi.Type {
+			return false
+		}
+	}
+	return true
+}
+
+// removeReceiver returns the type of the native method type t without the
+// receiver.
+func removeReceiver(t reflect.Type) reflect.Type {
+	in := make([]reflect.Type, t.NumIn()-1)
+	for i := range in {
+		in[i] = t.In(i + 1)
+	}
+	out := make([]reflect.Type, t.NumOut())
+	for i := range out {
+		out[i] = t.Out(i)
 	}
-	// If y has unexported methods, and x is not an interface type, it is not possible to check
-	// if x implements y using the x.NumMethod and x.Method methods, because they do not return
-	// the unexported methods of x. Therefore, the x.Implements method is used instead.
-	return x.Implements(y)
+	return reflect.FuncOf(in, out, t.IsVariadic())
 }
 
 // identical reports whether the types x and y, or their underlying types if
@@ -288,8 +346,9 @@ func (types *Types) TypeOf(v reflect.Value) reflect.Type {
 	if !v.IsValid() {
 		return nil
 	}
-	if p, ok := v.Interface().(emptyInterfaceProxy); ok {
-		return p.sign
+	if p, ok := v.Interface().(proxy); ok {
+		_, sign := p.proxied()
+		return sign
 	}
 	return v.Type()
 }
@@ -10,9 +10,10 @@ import (
 	"github.com/open2b/scriggo/internal/runtime"
 )
 
-// wrap and unwrap are called by the methods Wrap and Unwrap of the types
-// defined in this package. These two methods and the GoType method
-// implement the runtime.ScriggoType interface.
+// wrap, wrapMethods and unwrap are called by the methods Wrap, WrapMethods
+// and Unwrap of the types defined in this package. These methods and the
+// GoType method implement the runtime.ScriggoType and
+// runtime.ScriggoMethodSet interfaces.
 
 func wrap(t runtime.ScriggoType, v reflect.Value) reflect.Value {
 	return reflect.ValueOf(emptyInterfaceProxy{
@@ -21,19 +22,74 @@ func wrap(t runtime.ScriggoType, v reflect.Value) reflect.Value {
 	})
 }
 
-// TODO: currently unwrap always returns an empty interface wrapper. This will
-// change when methods declaration will be implemented in Scriggo.
+// wrapMethods is like wrap but, if t has the methods String or Error, the
+// returned proxy has such methods that call them with call.
+func wrapMethods(t runtime.ScriggoType, v reflect.Value, call runtime.MethodCallFunc) reflect.Value {
+	p := emptyInterfaceProxy{value: v, sign: t}
+	str := proxyMethod(t, v, "String", call)
+	err := proxyMethod(t, v, "Error", call)
+	switch {
+	case str != nil && err != nil:
+		return reflect.ValueOf(stringerErrorProxy{p, &proxyMethods{str: str, err: err}})
+	case str != nil:
+		return reflect.ValueOf(stringerProxy{p, &proxyMethods{str: str}})
+	case err != nil:
+		return reflect.ValueOf(errorProxy{p, &proxyMethods{err: err}})
+	}
+	return reflect.ValueOf(p)
+}
+
+// proxyMethod returns a function that calls, with call, the method of t with
+// the given name and receiver v. It returns nil if t does not have such
+// method or if it is not visible to the native code.
+func proxyMethod(t reflect.Type, v reflect.Value, name string, call runtime.MethodCallFunc) func() string {
+	m, index, ok := LookupMethod(t, name)
+	if !ok || m.Type != nativeMethods[name] {
+		return nil
+	}
+	return func() string {
+		rcv := v
+		for _, i := range index {
+			if rcv.Kind() == reflect.Ptr {
+				if rcv.IsNil() {
+					panic("invalid memory address or nil pointer dereference")
+				}
+				rcv = rcv.Elem()
+			}
+			rcv = rcv.Field(i)
+		}
+		if !m.Ptr && rcv.Kind() == reflect.Ptr {
+			if rcv.IsNil() {
+				if index != nil {
+					panic("invalid memory address or nil pointer dereference")
+				}
+				panic("value method " + t.Elem().String() + "." + name + " called using nil " + t.String() + " pointer")
+			}
+			rcv = rcv.Elem()
+		} else if m.Ptr && rcv.Kind() != reflect.Ptr {
+			rcv = rcv.Addr()
+		}
+		return call(m.Func, []reflect.Value{rcv})[0].String()
+	}
+}
+
 func unwrap(x runtime.ScriggoType, v reflect.Value) (reflect.Value, bool) {
-	p, ok := v.Interface().(emptyInterfaceProxy)
+	p, ok := v.Interface().(proxy)
 	// Not a proxy.
 	if !ok {
 		return reflect.Value{}, false
 	}
+	value, sign := p.proxied()
 	// v is a proxy but it has a different Scriggo type.
-	if p.sign != x {
+	if sign != x {
 		return reflect.Value{}, false
 	}
-	return p.value, true
+	return value, true
+}
+
+// proxy is implemented by the proxies of values of Scriggo types.
+type proxy interface {
+	proxied() (reflect.Value, runtime.ScriggoType)
 }
 
 // emptyInterfaceProxy is a proxy for values of types that have an empty
@@ -42,3 +98,40 @@ type emptyInterfaceProxy struct {
 	value reflect.Value
 	sign  runtime.ScriggoType
 }
+
+func (p emptyInterfaceProxy) proxied() (reflect.Value, runtime.ScriggoType) {
+	return p.value, p.sign
+}
+
+// proxyMethods holds the functions called by the methods of a proxy.
+type proxyMethods struct {
+	str func() string
+	err func() string
+}
+
+// stringerProxy is a proxy for values of types with the String method.
+type stringerProxy struct {
+	emptyInterfaceProxy
+	methods *proxyMethods
+}
+
+func (p stringerProxy) String() string { return p.methods.str() }
+
+// errorProxy is a proxy for values of types with the Error method.
+type errorProxy struct {
+	emptyInterfaceProxy
+	methods *proxyMethods
+}
+
+func (p errorProxy) Error() string { return p.methods.err() }
+
+// stringerErrorProxy is a proxy for values of types with both the String and
+// the Error methods.
+type stringerErrorProxy struct {
+	emptyInterfaceProxy
+	methods *proxyMethods
+}
+
+func (p stringerErrorProxy) String() string { return p.methods.str() }
+
+func (p stringerErrorProxy) Error() string { return p.methods.err() }
@@ -0,0 +1,124 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+// Coverage is implemented by the coverage collectors. The Add method is
+// called, at the end of the execution of every goroutine, with the number
+// of times the positioned instructions have been executed. It can be
+// called concurrently.
+type Coverage interface {
+	Add(counts []CoverageCount)
+}
+
+// CoverageCount is the number of times the instructions with a given
+// position have been executed.
+type CoverageCount struct {
+	Path     string   // path of the file.
+	Position Position // position in the file.
+	Count    int64    // number of executions.
+}
+
+// coverState is the state of the coverage collector of a goroutine.
+type coverState struct {
+	counts map[*Function][]int64 // execution counts of the instructions.
+	calls  map[*Function]int64   // number of calls of the functions.
+	fn     *Function             // current function.
+	depth  int                   // number of call frames of the current function.
+	cur    []int64               // execution counts of the current function.
+}
+
+// SetCoverage sets the coverage collector. declared contains the declared
+// functions, so that also those that are never called, or that are called
+// only through other functions that are never called, are reported.
+//
+// SetCoverage must not be called after vm has been started.
+func (vm *VM) SetCoverage(c Coverage, declared []*Function) {
+	vm.env.coverage = c
+	vm.env.declared = declared
+}
+
+// coverStep is called by the run method, if there is a coverage collector,
+// before executing the instruction at the current program counter, and
+// counts its execution. It also counts the calls of the current function,
+// as a jump to its first instruction does not change the call frames.
+func (vm *VM) coverStep() {
+	c := vm.cover
+	if vm.pc == 0 && (vm.fn != c.fn || len(vm.calls) != c.depth) {
+		c.calls[vm.fn]++
+	}
+	c.depth = len(vm.calls)
+	if vm.fn != c.fn {
+		c.fn = vm.fn
+		c.cur = c.counts[vm.fn]
+		if c.cur == nil {
+			c.cur = make([]int64, len(vm.fn.Body))
+			c.counts[vm.fn] = c.cur
+		}
+	}
+	c.cur[vm.instrAddr()]++
+}
+
+// addCoverage adds the counts of the executed instructions, and the number
+// of calls of the functions keyed by the position of their bodies, to the
+// coverage collector. If fn is not nil, it also adds, with a zero count, the
+// instructions and the bodies of fn, of the declared functions and of the
+// functions they refer to, also indirectly, that have not been executed.
+func (vm *VM) addCoverage(fn *Function) {
+	c := vm.cover
+	vm.cover = nil
+	// A call inlined by the optimizer is executed every time the first
+	// instruction of its body, or the instruction that follows it if the
+	// body is empty, is executed.
+	for f, executed := range c.counts {
+		for _, in := range f.Inlined {
+			if int(in.Start) < len(executed) {
+				c.calls[in.Func] += executed[in.Start]
+			}
+		}
+	}
+	var counts []CoverageCount
+	add := func(fn *Function, executed []int64) {
+		if fn.BodyPos != nil {
+			counts = append(counts, CoverageCount{Path: fn.File, Position: *fn.BodyPos, Count: c.calls[fn]})
+		}
+		for pc, info := range fn.InstructionInfo {
+			if info.Position.Line == 0 {
+				continue
+			}
+			count := CoverageCount{Path: info.Path, Position: info.Position}
+			if count.Path == "" {
+				count.Path = fn.File
+			}
+			if executed != nil {
+				count.Count = executed[pc]
+			}
+			counts = append(counts, count)
+		}
+	}
+	for f, executed := range c.counts {
+		add(f, executed)
+	}
+	if fn != nil {
+		seen := map[*Function]bool{}
+		var walk func(*Function)
+		walk = func(fn *Function) {
+			if seen[fn] {
+				return
+			}
+			seen[fn] = true
+			if _, ok := c.counts[fn]; !ok {
+				add(fn, nil)
+			}
+			for _, f := range fn.Functions {
+				walk(f)
+			}
+		}
+		walk(fn)
+		for _, f := range vm.env.declared {
+			walk(f)
+		}
+	}
+	vm.env.coverage.Add(counts)
+}
@@ -0,0 +1,213 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"reflect"
+)
+
+// DebugAction is the action requested by a debugger when the execution is
+// stopped.
+type DebugAction int
+
+const (
+	DebugContinue DebugAction = iota // continue to the next breakpoint.
+	DebugStepIn                      // stop at the next line, also in a called function.
+	DebugStepOver                    // stop at the next line of the current function or of a caller.
+	DebugStepOut                     // stop at the next line of a caller.
+)
+
+// Debugger is implemented by the debuggers. A debugger is called only by the
+// main goroutine, and it is not called when a native function calls a
+// Scriggo function.
+type Debugger interface {
+
+	// Break is called every time the execution reaches a new line and it
+	// reports whether the execution must stop, because there is a breakpoint
+	// or a pause has been requested.
+	Break(path string, line int) bool
+
+	// Stop is called when the execution is stopped, with the frames of the
+	// call stack starting from the current frame, and returns the action to
+	// take. The execution resumes when Stop returns.
+	Stop(frames []DebugFrame) DebugAction
+}
+
+// DebugFrame represents a frame of the call stack of a stopped execution.
+type DebugFrame struct {
+	StackFrame
+	Variables []DebugVariable // local variables and upvars in scope.
+}
+
+// DebugVariable represents a variable in a frame of a stopped execution.
+type DebugVariable struct {
+	Name  string        // name of the variable.
+	Value reflect.Value // value of the variable.
+	Upvar bool          // reports whether it is a variable of an enclosing function.
+}
+
+// debugState is the state of the debugger in the main goroutine.
+type debugState struct {
+	lines  []debugLine // last line reached, for every call depth.
+	action DebugAction // action requested at the last stop.
+	depth  int         // call depth at the last stop.
+}
+
+// debugLine is a line of a function.
+type debugLine struct {
+	fn   *Function
+	line int
+}
+
+// SetDebugger sets the debugger.
+//
+// SetDebugger must not be called after vm has been started.
+func (vm *VM) SetDebugger(d Debugger) {
+	vm.env.debugger = d
+}
+
+// debugStep is called by the run method, if there is a debugger, before
+// executing the instruction at the current program counter. If the
+// instruction begins a new line, it calls the Break method of the debugger
+// and, if the execution must stop, the Stop method.
+func (vm *VM) debugStep() {
+	info, ok := vm.fn.InstructionInfo[vm.instrAddr()]
+	if !ok || info.Position.Line == 0 {
+		return
+	}
+	d := vm.debug
+	depth := len(vm.calls)
+	fn := vm.fn
+	// The instructions of an inlined call are executed at a greater depth.
+	calls := fn.inlinedCalls(vm.instrAddr())
+	if calls != nil {
+		depth += len(calls)
+		fn = calls[0].Func
+	}
+	for len(d.lines) <= depth {
+		d.lines = append(d.lines, debugLine{})
+	}
+	d.lines = d.lines[:depth+1]
+	if vm.pc == 0 || calls != nil && vm.instrAddr() == calls[0].Start {
+		// A function has been called.
+		d.lines[depth] = debugLine{}
+	}
+	line := debugLine{fn: fn, line: info.Position.Line}
+	if d.lines[depth] == line {
+		return
+	}
+	d.lines[depth] = line
+	path := info.Path
+	if path == "" {
+		path = fn.File
+	}
+	stop := vm.env.debugger.Break(path, line.line)
+	switch d.action {
+	case DebugStepIn:
+		stop = true
+	case DebugStepOver:
+		stop = stop || depth <= d.depth
+	case DebugStepOut:
+		stop = stop || depth < d.depth
+	}
+	if stop {
+		d.action = vm.env.debugger.Stop(vm.debugFrames())
+		d.depth = depth
+	}
+}
+
+// debugFrames returns the frames of the call stack, starting from the frame
+// of the instruction at the current program counter.
+func (vm *VM) debugFrames() []DebugFrame {
+	fp, vars := vm.fp, vm.vars
+	defer func() {
+		vm.fp, vm.vars = fp, vars
+	}()
+	var frames []DebugFrame
+	for i := len(vm.calls); i >= 0; i-- {
+		var fn *Function
+		var pc Addr
+		readable := true
+		if i == len(vm.calls) {
+			fn = vm.fn
+			pc = vm.instrAddr()
+		} else {
+			call := vm.calls[i]
+			fn = call.cl.fn
+			if call.status == tailed {
+				pc = call.pc - 1
+			} else {
+				pc = call.callAddr()
+			}
+			readable = call.status == started
+			vm.fp, vm.vars = call.fp, call.cl.vars
+		}
+		if fn == nil {
+			continue
+		}
+		stack, calls := fn.frames(pc)
+		for j, f := range stack {
+			frame := DebugFrame{StackFrame: f}
+			if readable {
+				if j < len(calls) {
+					frame.Variables = vm.debugVariables(calls[j].Vars, nil, pc)
+				} else {
+					frame.Variables = vm.debugVariables(fn.Vars, fn.UpvarNames, pc)
+				}
+			}
+			frames = append(frames, frame)
+		}
+	}
+	return frames
+}
+
+// debugVariables returns the local variables in vars in scope at the
+// program counter pc, and the upvars with names upvars. vm.fp and vm.vars
+// must be the frame pointers and the variables of the frame.
+func (vm *VM) debugVariables(vars []VarInfo, upvars []string, pc Addr) []DebugVariable {
+	var variables []DebugVariable
+	index := map[string]int{}
+	for _, v := range vars {
+		if pc < v.Start || pc >= v.End {
+			continue
+		}
+		value, ok := vm.debugValue(v.Reg, v.Type)
+		if !ok {
+			continue
+		}
+		variable := DebugVariable{Name: v.Name, Value: value}
+		// An inner variable shadows an outer variable with the same name.
+		if i, ok := index[v.Name]; ok {
+			variables[i] = variable
+			continue
+		}
+		index[v.Name] = len(variables)
+		variables = append(variables, variable)
+	}
+	for i, name := range upvars {
+		if _, ok := index[name]; ok || i >= len(vm.vars) {
+			continue
+		}
+		variables = append(variables, DebugVariable{Name: name, Value: vm.vars[i], Upvar: true})
+	}
+	return variables
+}
+
+// debugValue returns the value of type t in the register r. If the value
+// cannot be read, for example because the variable has not yet been
+// initialized, it returns false.
+func (vm *VM) debugValue(r int16, t reflect.Type) (v reflect.Value, ok bool) {
+	defer func() {
+		if recover() != nil {
+			v, ok = reflect.Value{}, false
+		}
+	}()
+	if st, ok := t.(ScriggoType); ok {
+		t = st.GoType()
+	}
+	v = reflect.New(t).Elem()
+	vm.getIntoReflectValue(r, v, false)
+	return v, true
+}
@@ -12,11 +12,38 @@ import (
 
 type PrintFunc func(interface{})
 
+// A NativeCallCostFunc function returns the cost, in number of instructions,
+// of a call to the native function with the given package path and name.
+type NativeCallCostFunc func(pkg, name string) int64
+
+// A NativeCallFunc function is called before a call to a native function.
+// If it returns a non-nil error, the function is not called.
+type NativeCallFunc func(call NativeCall) error
+
+// NativeCall represents a call to a native function.
+type NativeCall struct {
+	Package  string        // package path; empty for a function value.
+	Name     string        // function name; empty for a function value.
+	Receiver reflect.Type  // receiver type, if it is a method call.
+	Method   string        // method name, if it is a method call.
+	Args     []interface{} // arguments, excluding the native.Env argument and the receiver.
+	Path     string        // path of the file of the call.
+	Position Position      // position of the call.
+}
+
 // Context represents a context in Show and Text instructions.
 type Context byte
 
 // The env type implements the native.Env interface.
 type env struct {
+	// fuel is the number of instructions that can still be executed if the
+	// execution is limited and allocated is the number of allocated bytes if
+	// the allocations are accounted. They are the first fields so that they
+	// are 64-bit aligned, as required for atomic operations, also on 32-bit
+	// platforms.
+	fuel      int64
+	allocated int64
+
 	ctx     context.Context // context.
 	globals []reflect.Value // global variables.
 	print   PrintFunc       // custom print builtin.
@@ -26,6 +53,20 @@ type env struct {
 	doneChan <-chan struct{}
 	doneCase reflect.SelectCase
 
+	limited         bool               // reports whether instructions are limited.
+	maxInstructions int64              // maximum number of instructions.
+	nativeCallCost  NativeCallCostFunc // cost of native function calls.
+
+	onNativeCall NativeCallFunc // called before native function calls.
+
+	accounted    bool  // reports whether allocations are accounted.
+	maxAllocated int64 // maximum number of allocated bytes.
+
+	debugger Debugger    // debugger.
+	profiler Profiler    // profiler.
+	coverage Coverage    // coverage collector.
+	declared []*Function // declared functions reported by the coverage collector.
+
 	// Only the callPath field can be changed after the vm has been started
 	// and access to this field must be done with this mutex.
 	mu       sync.Mutex
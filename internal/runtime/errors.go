@@ -82,21 +82,190 @@ func (err stopError) Error() string {
 	return "stop: " + err.Error()
 }
 
+// InstructionLimitError represents the error that occurs when the number of
+// executed instructions exceeds the limit set with the SetMaxInstructions
+// method of VM.
+type InstructionLimitError struct {
+	limit    int64
+	path     string
+	position Position
+}
+
+func (err *InstructionLimitError) Error() string {
+	return "instruction limit of " + strconv.FormatInt(err.limit, 10) + " exceeded"
+}
+
+// Limit returns the maximum number of instructions.
+func (err *InstructionLimitError) Limit() int64 {
+	return err.limit
+}
+
+// Path returns the path of the file of the last instruction.
+func (err *InstructionLimitError) Path() string {
+	return err.path
+}
+
+// Position returns the position of the last instruction.
+func (err *InstructionLimitError) Position() Position {
+	return err.position
+}
+
+// errInstructionLimit returns an instruction limit error for the instruction
+// at address pc of the running function.
+func (vm *VM) errInstructionLimit(pc Addr) *InstructionLimitError {
+	path, pos := vm.position(pc)
+	return &InstructionLimitError{limit: vm.env.maxInstructions, path: path, position: pos}
+}
+
+// AllocationLimitError represents the error that occurs when the bytes
+// allocated exceed the limit set with the SetMaxAllocatedBytes method of VM.
+type AllocationLimitError struct {
+	limit     int64
+	allocated int64
+	path      string
+	position  Position
+}
+
+func (err *AllocationLimitError) Error() string {
+	return "allocation limit of " + strconv.FormatInt(err.limit, 10) + " bytes exceeded"
+}
+
+// Limit returns the maximum number of bytes.
+func (err *AllocationLimitError) Limit() int64 {
+	return err.limit
+}
+
+// Allocated returns the number of bytes allocated before the allocation
+// that exceeded the limit.
+func (err *AllocationLimitError) Allocated() int64 {
+	return err.allocated
+}
+
+// Path returns the path of the file of the allocation.
+func (err *AllocationLimitError) Path() string {
+	return err.path
+}
+
+// Position returns the position of the allocation.
+func (err *AllocationLimitError) Position() Position {
+	return err.position
+}
+
+// errAllocationLimit returns an allocation limit error for the currently
+// running virtual machine instruction. allocated is the number of bytes
+// allocated before the allocation that exceeded the limit.
+func (vm *VM) errAllocationLimit(allocated int64) *AllocationLimitError {
+	path, pos := vm.position(vm.pc - 1)
+	return &AllocationLimitError{limit: vm.env.maxAllocated, allocated: allocated, path: path, position: pos}
+}
+
+// NativeCallDeniedError represents the error that occurs when the function
+// set with the SetOnNativeCall method of VM denies a native function call.
+type NativeCallDeniedError struct {
+	pkg      string
+	name     string
+	receiver reflect.Type
+	method   string
+	path     string
+	position Position
+	err      error
+}
+
+func (err *NativeCallDeniedError) Error() string {
+	name := err.name
+	if err.pkg != "" {
+		name = err.pkg + "." + name
+	}
+	if err.method != "" {
+		name = err.receiver.String() + "." + err.method
+		if err.receiver.Kind() == reflect.Ptr {
+			name = "(" + err.receiver.String() + ")." + err.method
+		}
+	}
+	if name == "" {
+		name = "native function"
+	}
+	return "call to " + name + " denied: " + err.err.Error()
+}
+
+// Unwrap returns the error returned by the function set with SetOnNativeCall.
+func (err *NativeCallDeniedError) Unwrap() error {
+	return err.err
+}
+
+// Package returns the package path of the function.
+func (err *NativeCallDeniedError) Package() string {
+	return err.pkg
+}
+
+// Name returns the name of the function.
+func (err *NativeCallDeniedError) Name() string {
+	return err.name
+}
+
+// Receiver returns the receiver type, if it is a method call, otherwise it
+// returns nil.
+func (err *NativeCallDeniedError) Receiver() reflect.Type {
+	return err.receiver
+}
+
+// Method returns the method name, if it is a method call.
+func (err *NativeCallDeniedError) Method() string {
+	return err.method
+}
+
+// Path returns the path of the file of the call.
+func (err *NativeCallDeniedError) Path() string {
+	return err.path
+}
+
+// Position returns the position of the call.
+func (err *NativeCallDeniedError) Position() Position {
+	return err.position
+}
+
+// position returns the path and the position of the instruction at address
+// pc of the running function. As not all the instructions have a position,
+// it returns the position of the nearest preceding instruction that has one.
+func (vm *VM) position(pc Addr) (string, Position) {
+	return vm.fn.position(pc)
+}
+
+// position returns the path and the position of the instruction at address
+// pc of fn, as the position method of VM does.
+func (fn *Function) position(pc Addr) (string, Position) {
+	for {
+		if info, ok := fn.InstructionInfo[pc]; ok && info.Position.Line > 0 {
+			return info.Path, info.Position
+		}
+		if pc == 0 {
+			break
+		}
+		pc--
+	}
+	return fn.File, Position{}
+}
+
 // errIndexOutOfRange returns an index of range runtime error for the
 // currently running virtual machine instruction.
 func (vm *VM) errIndexOutOfRange() runtimeError {
-	in := vm.fn.Body[vm.pc-1]
+	op := vm.fn.Body[vm.pc-1].Op
+	a, b, c := vm.operands(vm.pc - 1)
 	var index, length int
-	switch in.Op {
+	switch op {
 	case OpAddr, OpIndex, -OpIndex, OpIndexRef, -OpIndexRef:
-		index = int(vm.intk(in.B, in.Op < 0))
-		length = vm.general(in.A).Len()
+		index = int(vm.intk(b, op < 0))
+		v := vm.general(a)
+		if v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		length = v.Len()
 	case OpIndexString, -OpIndexString:
-		index = int(vm.intk(in.B, in.Op < 0))
-		length = len(vm.string(in.A))
+		index = int(vm.intk(b, op < 0))
+		length = len(vm.string(a))
 	case OpSetSlice, -OpSetSlice:
-		index = int(vm.int(in.C))
-		length = vm.general(in.B).Len()
+		index = int(vm.int(c))
+		length = vm.general(b).Len()
 	default:
 		panic("unexpected operation")
 	}
@@ -106,18 +275,37 @@ func (vm *VM) errIndexOutOfRange() runtimeError {
 
 // newPanic returns a new *PanicError with the given error message.
 func (vm *VM) newPanic(msg interface{}) *PanicError {
+	info := vm.fn.InstructionInfo[vm.panicAddr()]
 	return &PanicError{
-		message:  msg,
-		path:     vm.fn.InstructionInfo[vm.pc].Path,
-		position: vm.fn.InstructionInfo[vm.pc].Position,
+		message:    msg,
+		path:       info.Path,
+		position:   info.Position,
+		stackTrace: vm.stackTrace(),
 	}
 }
 
+// panicAddr returns the address of the instruction with the position of
+// the panic raised by the last executed instruction. A failed type
+// assertion is raised by an Assert instruction, but its position is stored
+// in the Panic instruction that follows it.
+func (vm *VM) panicAddr() Addr {
+	if vm.fn.Body[vm.pc-1].Op == OpAssert && int(vm.pc) < len(vm.fn.Body) {
+		return vm.instrAddr()
+	}
+	return vm.pc - 1
+}
+
 // convertPanic converts a panic to an error.
 func (vm *VM) convertPanic(msg interface{}) error {
 	switch err := msg.(type) {
 	case stopError:
 		return err
+	case *InstructionLimitError:
+		return err
+	case *AllocationLimitError:
+		return err
+	case *NativeCallDeniedError:
+		return err
 	case outError:
 		return vm.newPanic(err)
 	}
@@ -138,8 +326,8 @@ func (vm *VM) convertPanic(msg interface{}) error {
 			return vm.newPanic(runtimeError("append: out of memory"))
 		}
 	case OpCallIndirect:
-		in := vm.fn.Body[vm.pc-1]
-		v := vm.general(in.A)
+		a, _, _ := vm.operands(vm.pc - 1)
+		v := vm.general(a)
 		if !v.IsValid() || !v.CanInterface() {
 			break
 		}
@@ -255,7 +443,7 @@ func (vm *VM) convertPanic(msg interface{}) error {
 type PanicError struct {
 	message    interface{}
 	recovered  bool
-	stackTrace []byte
+	stackTrace []StackFrame
 	next       *PanicError
 	path       string
 	position   Position
@@ -310,6 +498,20 @@ func (p *PanicError) Position() Position {
 	return p.position
 }
 
+// StackTrace returns the stack trace of the goroutine that panicked.
+func (p *PanicError) StackTrace() []StackFrame {
+	return p.stackTrace
+}
+
+// StackFrame represents a frame of a stack trace.
+type StackFrame struct {
+	Func     string   // function name qualified by the package name.
+	Macro    bool     // reports whether the function is a macro.
+	Native   bool     // reports whether the function is a native function.
+	Path     string   // path of the file; empty for native functions.
+	Position Position // position of the executing instruction; zero for native functions.
+}
+
 func panicToString(msg interface{}) string {
 	switch v := msg.(type) {
 	case nil:
@@ -398,22 +600,34 @@ func missingMethod(typ reflect.Type, iface reflect.Type) string {
 	num := iface.NumMethod()
 	for i := 0; i < num; i++ {
 		mi := iface.Method(i)
-		mt, ok := typ.MethodByName(mi.Name)
-		if !ok {
-			return mi.Name
+		var mt reflect.Type
+		if ms, ok := typ.(ScriggoMethodSet); ok {
+			// The type of the function of a method declared in Scriggo has
+			// the receiver as first parameter, as for the native methods.
+			fn, _, _, ok := ms.ScriggoMethod(mi.Name)
+			if !ok {
+				return mi.Name
+			}
+			mt = fn.Type
+		} else {
+			m, ok := typ.MethodByName(mi.Name)
+			if !ok {
+				return mi.Name
+			}
+			mt = m.Type
 		}
 		numIn := mi.Type.NumIn()
 		numOut := mi.Type.NumOut()
-		if mt.Type.NumIn()-1 != numIn || mt.Type.NumOut() != numOut {
+		if mt.NumIn()-1 != numIn || mt.NumOut() != numOut {
 			return mi.Name
 		}
 		for j := 0; j < numIn; j++ {
-			if mt.Type.In(j+1) != mi.Type.In(j) {
+			if mt.In(j+1) != mi.Type.In(j) {
 				return mi.Name
 			}
 		}
 		for j := 0; j < numOut; j++ {
-			if mt.Type.Out(j) != mi.Type.Out(j) {
+			if mt.Out(j) != mi.Type.Out(j) {
 				return mi.Name
 			}
 		}
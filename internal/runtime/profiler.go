@@ -0,0 +1,235 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Profiler is implemented by the profilers. The Add method is called by the
+// main goroutine, at the end of an execution, with the collected samples.
+type Profiler interface {
+	Add(samples []ProfileSample, duration time.Duration)
+}
+
+// ProfileSample is a sample of a profile. It contains the number of executed
+// instructions and the elapsed time with a given call stack.
+type ProfileSample struct {
+	Stack        []ProfileLocation // call stack, starting from the innermost frame.
+	Instructions int64             // number of executed instructions.
+	Time         time.Duration     // sampled elapsed time, including the time spent in native calls.
+}
+
+// ProfileLocation is a location in a call stack of a profile sample.
+type ProfileLocation struct {
+	Func string // function name qualified by the package name.
+	Path string // path of the file.
+	Line int    // line in the file; zero if unknown.
+	Decl int    // line of the function declaration; zero if unknown.
+}
+
+// profileInterval is the interval at which the elapsed time is sampled.
+const profileInterval = time.Millisecond
+
+// profileState is the state of the profiler in the main goroutine.
+//
+// The instructions are counted exactly, while the elapsed time is sampled:
+// every profileInterval a timer sets the tick flag and, at the next step,
+// the time elapsed since the previous sampling is added to the sample of the
+// current stack.
+type profileState struct {
+	samples map[string]*ProfileSample // samples by stack.
+	ids     map[*Function]int         // identifiers of the functions in the stack keys.
+	sample  *ProfileSample            // sample of the current stack.
+	fn      *Function                 // function of the current stack.
+	depth   int                       // call depth of the current stack.
+	line    int                       // line of the current stack.
+	count   int64                     // instructions executed since start.
+	start   time.Time                 // time of the last sampling.
+	begin   time.Time                 // start time of the execution.
+	tick    int32                     // set to 1, atomically, when the time must be sampled.
+	timer   *time.Timer               // timer that sets tick.
+	key     []byte                    // key of the current stack.
+	frames  []profileFrame            // frames of the current stack, starting from the outermost.
+}
+
+// profileFrame is a frame of the current stack of a profileState. It
+// caches the location and the end of its part in the stack key, so that
+// the key is rebuilt only from the first frame that has changed.
+type profileFrame struct {
+	fn  *Function       // function.
+	pc  Addr            // address of the instruction; only for the calling frames.
+	loc ProfileLocation // location.
+	end int             // end of the frame in the stack key.
+}
+
+// SetProfiler sets the profiler.
+//
+// SetProfiler must not be called after vm has been started.
+func (vm *VM) SetProfiler(p Profiler) {
+	vm.env.profiler = p
+}
+
+// newProfileState returns a new profile state and starts its timer.
+func newProfileState() *profileState {
+	now := time.Now()
+	p := &profileState{
+		samples: map[string]*ProfileSample{},
+		ids:     map[*Function]int{},
+		start:   now,
+		begin:   now,
+	}
+	p.timer = time.AfterFunc(profileInterval, func() {
+		atomic.StoreInt32(&p.tick, 1)
+	})
+	return p
+}
+
+// profileStep is called by the run method, if there is a profiler, before
+// executing the instruction at the current program counter. It counts the
+// instruction and, if the call stack or the line changes, it adds the
+// instructions executed to the sample of the previous stack.
+func (vm *VM) profileStep() {
+	p := vm.profile
+	if atomic.LoadInt32(&p.tick) == 1 {
+		atomic.StoreInt32(&p.tick, 0)
+		p.flushTime(time.Now())
+		p.timer.Reset(profileInterval)
+	}
+	depth := len(vm.calls)
+	if vm.fn == p.fn && depth == p.depth {
+		info, ok := vm.fn.InstructionInfo[vm.instrAddr()]
+		if !ok || info.Position.Line == 0 || info.Position.Line == p.line {
+			p.count++
+			return
+		}
+	}
+	if p.sample != nil {
+		p.sample.Instructions += p.count
+	}
+	p.fn = vm.fn
+	p.depth = depth
+	p.count = 1
+	p.sample = vm.profileSample()
+}
+
+// profileSample returns the sample of the current call stack, and sets the
+// line of the current stack.
+func (vm *VM) profileSample() *ProfileSample {
+	p := vm.profile
+	n := 0 // number of valid frames.
+	changed := false
+	for i := 0; i <= len(vm.calls); i++ {
+		fn := vm.fn
+		var pc Addr
+		if i < len(vm.calls) {
+			call := vm.calls[i]
+			switch call.status {
+			case started:
+				pc = call.callAddr()
+			case tailed:
+				pc = call.pc - 1
+			default:
+				continue
+			}
+			fn = call.cl.fn
+		} else {
+			pc = vm.instrAddr()
+		}
+		if fn == nil {
+			continue
+		}
+		if !changed && n < len(p.frames) {
+			frame := p.frames[n]
+			if frame.fn == fn && frame.pc == pc && i < len(vm.calls) {
+				n++
+				continue
+			}
+			changed = true
+		}
+		if n == len(p.frames) {
+			p.frames = append(p.frames, profileFrame{})
+		}
+		if n == 0 {
+			p.key = p.key[:0]
+		} else {
+			p.key = p.key[:p.frames[n-1].end]
+		}
+		loc := profileLocation(fn, pc)
+		id, ok := p.ids[fn]
+		if !ok {
+			id = len(p.ids)
+			p.ids[fn] = id
+		}
+		p.key = strconv.AppendInt(p.key, int64(id), 10)
+		p.key = append(p.key, ':')
+		p.key = strconv.AppendInt(p.key, int64(loc.Line), 10)
+		p.key = append(p.key, ';')
+		p.frames[n] = profileFrame{fn: fn, pc: pc, loc: loc, end: len(p.key)}
+		n++
+	}
+	p.frames = p.frames[:n]
+	p.line = p.frames[n-1].loc.Line
+	sample, ok := p.samples[string(p.key)]
+	if !ok {
+		stack := make([]ProfileLocation, n)
+		for i, frame := range p.frames {
+			stack[n-1-i] = frame.loc
+		}
+		sample = &ProfileSample{Stack: stack}
+		p.samples[string(p.key)] = sample
+	}
+	return sample
+}
+
+// flushTime adds the time elapsed since the last sampling up to now to the
+// sample of the current stack.
+func (p *profileState) flushTime(now time.Time) {
+	if p.sample != nil {
+		p.sample.Time += now.Sub(p.start)
+	}
+	p.start = now
+}
+
+// profileLocation returns the location of the instruction of fn at pc. If
+// the instruction has no position, the line is the line of the nearest
+// preceding instruction with a position.
+func profileLocation(fn *Function, pc Addr) ProfileLocation {
+	loc := ProfileLocation{Func: fn.qualifiedName(), Path: fn.File}
+	if fn.Pos != nil {
+		loc.Decl = fn.Pos.Line
+	}
+	for i := int(pc); i >= 0; i-- {
+		if info, ok := fn.InstructionInfo[Addr(i)]; ok && info.Position.Line > 0 {
+			if info.Path != "" {
+				loc.Path = info.Path
+			}
+			loc.Line = info.Position.Line
+			break
+		}
+	}
+	return loc
+}
+
+// addProfile adds the samples collected by the profiler to the profiler.
+func (vm *VM) addProfile() {
+	p := vm.profile
+	p.timer.Stop()
+	now := time.Now()
+	p.flushTime(now)
+	if p.sample != nil {
+		p.sample.Instructions += p.count
+	}
+	samples := make([]ProfileSample, 0, len(p.samples))
+	for _, sample := range p.samples {
+		if sample.Instructions > 0 || sample.Time > 0 {
+			samples = append(samples, *sample)
+		}
+	}
+	vm.env.profiler.Add(samples, now.Sub(p.begin))
+	vm.profile = nil
+}
@@ -15,7 +15,7 @@ type registers struct {
 	general []reflect.Value
 }
 
-func (vm *VM) set(r int8, v reflect.Value) {
+func (vm *VM) set(r int16, v reflect.Value) {
 	k := v.Kind()
 	if reflect.Int <= k && k <= reflect.Int64 {
 		vm.setInt(r, v.Int())
@@ -30,14 +30,14 @@ func (vm *VM) set(r int8, v reflect.Value) {
 	}
 }
 
-func (vm *VM) int(r int8) int64 {
+func (vm *VM) int(r int16) int64 {
 	if r > 0 {
 		return vm.regs.int[vm.fp[0]+Addr(r)]
 	}
 	return vm.intIndirect(-r)
 }
 
-func (vm *VM) intk(r int8, k bool) int64 {
+func (vm *VM) intk(r int16, k bool) int64 {
 	if k {
 		return int64(r)
 	}
@@ -47,7 +47,7 @@ func (vm *VM) intk(r int8, k bool) int64 {
 	return vm.intIndirect(-r)
 }
 
-func (vm *VM) intIndirect(r int8) int64 {
+func (vm *VM) intIndirect(r int16) int64 {
 	v := vm.regs.general[vm.fp[3]+Addr(r)]
 	if v.IsNil() {
 		panic(errNilPointer)
@@ -67,7 +67,7 @@ func (vm *VM) intIndirect(r int8) int64 {
 	}
 }
 
-func (vm *VM) setInt(r int8, i int64) {
+func (vm *VM) setInt(r int16, i int64) {
 	if r > 0 {
 		vm.regs.int[vm.fp[0]+Addr(r)] = i
 		return
@@ -75,7 +75,7 @@ func (vm *VM) setInt(r int8, i int64) {
 	vm.setIntIndirect(-r, i)
 }
 
-func (vm *VM) setIntIndirect(r int8, i int64) {
+func (vm *VM) setIntIndirect(r int16, i int64) {
 	v := vm.regs.general[vm.fp[3]+Addr(r)]
 	elem := v.Elem()
 	k := elem.Kind()
@@ -89,14 +89,14 @@ func (vm *VM) setIntIndirect(r int8, i int64) {
 	}
 }
 
-func (vm *VM) bool(r int8) bool {
+func (vm *VM) bool(r int16) bool {
 	if r > 0 {
 		return vm.regs.int[vm.fp[0]+Addr(r)] > 0
 	}
 	return vm.boolIndirect(-r)
 }
 
-func (vm *VM) boolk(r int8, k bool) bool {
+func (vm *VM) boolk(r int16, k bool) bool {
 	if k {
 		return r > 0
 	}
@@ -106,7 +106,7 @@ func (vm *VM) boolk(r int8, k bool) bool {
 	return vm.boolIndirect(-r)
 }
 
-func (vm *VM) boolIndirect(r int8) bool {
+func (vm *VM) boolIndirect(r int16) bool {
 	v := vm.regs.general[vm.fp[3]+Addr(r)]
 	if v.IsNil() {
 		panic(errNilPointer)
@@ -114,7 +114,7 @@ func (vm *VM) boolIndirect(r int8) bool {
 	return v.Elem().Bool()
 }
 
-func (vm *VM) setBool(r int8, b bool) {
+func (vm *VM) setBool(r int16, b bool) {
 	if r > 0 {
 		v := int64(0)
 		if b {
@@ -126,19 +126,19 @@ func (vm *VM) setBool(r int8, b bool) {
 	vm.setBoolIndirect(-r, b)
 }
 
-func (vm *VM) setBoolIndirect(r int8, b bool) {
+func (vm *VM) setBoolIndirect(r int16, b bool) {
 	v := vm.regs.general[vm.fp[3]+Addr(r)]
 	v.Elem().SetBool(b)
 }
 
-func (vm *VM) float(r int8) float64 {
+func (vm *VM) float(r int16) float64 {
 	if r > 0 {
 		return vm.regs.float[vm.fp[1]+Addr(r)]
 	}
 	return vm.floatIndirect(-r)
 }
 
-func (vm *VM) floatk(r int8, k bool) float64 {
+func (vm *VM) floatk(r int16, k bool) float64 {
 	if k {
 		return float64(r)
 	}
@@ -148,7 +148,7 @@ func (vm *VM) floatk(r int8, k bool) float64 {
 	return vm.floatIndirect(-r)
 }
 
-func (vm *VM) floatIndirect(r int8) float64 {
+func (vm *VM) floatIndirect(r int16) float64 {
 	v := vm.regs.general[vm.fp[3]+Addr(r)]
 	if v.IsNil() {
 		panic(errNilPointer)
@@ -156,7 +156,7 @@ func (vm *VM) floatIndirect(r int8) float64 {
 	return v.Elem().Float()
 }
 
-func (vm *VM) setFloat(r int8, f float64) {
+func (vm *VM) setFloat(r int16, f float64) {
 	if r > 0 {
 		vm.regs.float[vm.fp[1]+Addr(r)] = f
 		return
@@ -164,19 +164,19 @@ func (vm *VM) setFloat(r int8, f float64) {
 	vm.setFloatIndirect(-r, f)
 }
 
-func (vm *VM) setFloatIndirect(r int8, f float64) {
+func (vm *VM) setFloatIndirect(r int16, f float64) {
 	v := vm.regs.general[vm.fp[3]+Addr(r)]
 	v.Elem().SetFloat(f)
 }
 
-func (vm *VM) string(r int8) string {
+func (vm *VM) string(r int16) string {
 	if r > 0 {
 		return vm.regs.string[vm.fp[2]+Addr(r)]
 	}
 	return vm.stringIndirect(-r)
 }
 
-func (vm *VM) stringk(r int8, k bool) string {
+func (vm *VM) stringk(r int16, k bool) string {
 	if k {
 		return vm.fn.Values.String[uint8(r)]
 	}
@@ -186,7 +186,7 @@ func (vm *VM) stringk(r int8, k bool) string {
 	return vm.stringIndirect(-r)
 }
 
-func (vm *VM) stringIndirect(r int8) string {
+func (vm *VM) stringIndirect(r int16) string {
 	v := vm.regs.general[vm.fp[3]+Addr(r)]
 	if v.IsNil() {
 		panic(errNilPointer)
@@ -194,7 +194,7 @@ func (vm *VM) stringIndirect(r int8) string {
 	return v.Elem().String()
 }
 
-func (vm *VM) setString(r int8, s string) {
+func (vm *VM) setString(r int16, s string) {
 	if r > 0 {
 		vm.regs.string[vm.fp[2]+Addr(r)] = s
 		return
@@ -202,19 +202,19 @@ func (vm *VM) setString(r int8, s string) {
 	vm.setStringIndirect(-r, s)
 }
 
-func (vm *VM) setStringIndirect(r int8, s string) {
+func (vm *VM) setStringIndirect(r int16, s string) {
 	v := vm.regs.general[vm.fp[3]+Addr(r)]
 	v.Elem().SetString(s)
 }
 
-func (vm *VM) general(r int8) reflect.Value {
+func (vm *VM) general(r int16) reflect.Value {
 	if r > 0 {
 		return vm.regs.general[vm.fp[3]+Addr(r)]
 	}
 	return vm.generalIndirect(-r)
 }
 
-func (vm *VM) generalk(r int8, k bool) reflect.Value {
+func (vm *VM) generalk(r int16, k bool) reflect.Value {
 	if k {
 		return vm.fn.Values.General[uint8(r)]
 	}
@@ -224,7 +224,7 @@ func (vm *VM) generalk(r int8, k bool) reflect.Value {
 	return vm.generalIndirect(-r)
 }
 
-func (vm *VM) generalIndirect(r int8) reflect.Value {
+func (vm *VM) generalIndirect(r int16) reflect.Value {
 	v := vm.regs.general[vm.fp[3]+Addr(r)]
 	if v.IsNil() {
 		panic(errNilPointer)
@@ -236,7 +236,7 @@ func (vm *VM) generalIndirect(r int8) reflect.Value {
 	return elem
 }
 
-func (vm *VM) setGeneral(r int8, v reflect.Value) {
+func (vm *VM) setGeneral(r int16, v reflect.Value) {
 	if r > 0 {
 		vm.regs.general[vm.fp[3]+Addr(r)] = v
 		return
@@ -244,11 +244,11 @@ func (vm *VM) setGeneral(r int8, v reflect.Value) {
 	vm.setGeneralIndirect(-r, v)
 }
 
-func (vm *VM) setGeneralIndirect(r int8, v reflect.Value) {
+func (vm *VM) setGeneralIndirect(r int16, v reflect.Value) {
 	vm.regs.general[vm.fp[3]+Addr(r)].Elem().Set(v)
 }
 
-func (vm *VM) getIntoReflectValue(r int8, v reflect.Value, k bool) registerType {
+func (vm *VM) getIntoReflectValue(r int16, v reflect.Value, k bool) registerType {
 	switch v.Kind() {
 	case reflect.Bool:
 		v.SetBool(vm.boolk(r, k))
@@ -285,7 +285,7 @@ func (vm *VM) getIntoReflectValue(r int8, v reflect.Value, k bool) registerType
 	}
 }
 
-func (vm *VM) setFromReflectValue(r int8, v reflect.Value) registerType {
+func (vm *VM) setFromReflectValue(r int16, v reflect.Value) registerType {
 	switch v.Kind() {
 	case reflect.Bool:
 		vm.setBool(r, v.Bool())
@@ -332,7 +332,7 @@ func appendCap(oc, nl int) int {
 	return c
 }
 
-func (vm *VM) appendSlice(first int8, length int, slice reflect.Value) reflect.Value {
+func (vm *VM) appendSlice(first int16, length int, slice reflect.Value) reflect.Value {
 	switch s := slice.Interface().(type) {
 	case []int:
 		ol := len(s)
@@ -10,13 +10,32 @@ import (
 	"strings"
 	"sync/atomic"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/native"
 )
 
 func (vm *VM) runFunc(fn *Function, vars []reflect.Value) error {
 	vm.fn = fn
 	vm.vars = vars
+	vm.pc = 0
+	vm.growStack(fn)
+	if vm.main && vm.env.debugger != nil && vm.debug == nil {
+		vm.debug = &debugState{}
+	}
+	if vm.main && vm.env.profiler != nil {
+		vm.profile = newProfileState()
+		defer vm.addProfile()
+	}
+	if vm.env.coverage != nil {
+		vm.cover = &coverState{counts: map[*Function][]int64{}, calls: map[*Function]int64{}}
+		root := fn
+		if !vm.main {
+			root = nil
+		}
+		defer vm.addCoverage(root)
+	}
 	var stop chan struct{}
 	if vm.env.doneChan != nil {
 		stop = make(chan struct{})
@@ -81,9 +100,13 @@ func (vm *VM) run() (Addr, bool) {
 	var startNativeGoroutine bool
 
 	var op Operation
-	var a, b, c int8
+	var a, b, c int16
 
 	done := vm.env.doneChan
+	limited := vm.env.limited
+	debugging := vm.debug != nil
+	profiling := vm.profile != nil
+	covering := vm.cover != nil
 
 	for {
 
@@ -91,10 +114,35 @@ func (vm *VM) run() (Addr, bool) {
 			return vm.stop()
 		}
 
+		if limited && atomic.AddInt64(&vm.env.fuel, -1) < 0 {
+			panic(vm.errInstructionLimit(vm.instrAddr()))
+		}
+
+		if covering {
+			vm.coverStep()
+		}
+
+		if profiling {
+			vm.profileStep()
+		}
+
+		if debugging {
+			vm.debugStep()
+		}
+
 		in := vm.fn.Body[vm.pc]
 
 		vm.pc++
-		op, a, b, c = in.Op, in.A, in.B, in.C
+		op, a, b, c = in.Op, int16(in.A), int16(in.B), int16(in.C)
+
+		if op == OpWide {
+			in = vm.fn.Body[vm.pc]
+			vm.pc++
+			op = in.Op
+			a = a<<8 | int16(uint8(in.A))
+			b = b<<8 | int16(uint8(in.B))
+			c = c<<8 | int16(uint8(in.C))
+		}
 
 		// If an instruction needs to change the program counter,
 		// it must be changed, if possible, at the end of the instruction execution.
@@ -140,7 +188,17 @@ func (vm *VM) run() (Addr, bool) {
 			case reflect.Slice, reflect.Array:
 				i := int(vm.int(b))
 				vm.setGeneral(c, v.Index(i).Addr())
-			case reflect.Struct, reflect.Ptr:
+			case reflect.Ptr:
+				if v.Type().Elem().Kind() == reflect.Array {
+					if v.IsNil() {
+						panic(errNilPointer)
+					}
+					i := int(vm.int(b))
+					vm.setGeneral(c, v.Elem().Index(i).Addr())
+					break
+				}
+				vm.setGeneral(c, vm.fieldByIndex(v, uint8(b)).Addr())
+			case reflect.Struct:
 				vm.setGeneral(c, vm.fieldByIndex(v, uint8(b)).Addr())
 			}
 
@@ -154,15 +212,24 @@ func (vm *VM) run() (Addr, bool) {
 
 		// Append
 		case OpAppend:
-			vm.setGeneral(c, vm.appendSlice(a, int(b-a), vm.general(c)))
+			s := vm.general(c)
+			if vm.env.accounted {
+				vm.allocAppend(s, int(b-a))
+			}
+			vm.setGeneral(c, vm.appendSlice(a, int(b-a), s))
 
 		// AppendSlice
 		case OpAppendSlice:
-			vm.setGeneral(c, reflect.AppendSlice(vm.general(c), vm.general(a)))
+			s, t := vm.general(c), vm.general(a)
+			if vm.env.accounted {
+				vm.allocAppend(s, t.Len())
+			}
+			vm.setGeneral(c, reflect.AppendSlice(s, t))
 
 		// Assert
 		case OpAssert:
-			v := vm.general(a)
+			iv := vm.general(a)
+			v := iv
 			t := vm.fn.Types[uint8(b)]
 			var ok bool
 			if v.IsValid() {
@@ -179,11 +246,14 @@ func (vm *VM) run() (Addr, bool) {
 			vm.ok = ok
 			if !ok {
 				in := vm.fn.Body[vm.pc]
+				if in.Op == OpWide {
+					in = vm.fn.Body[vm.pc+1]
+				}
 				if in.Op == OpPanic {
 					var concrete reflect.Type
 					var method string
-					if v.IsValid() {
-						concrete = v.Type()
+					if iv.IsValid() {
+						concrete = vm.env.typeof(iv)
 						if t.Kind() == reflect.Interface {
 							method = missingMethod(concrete, t)
 						}
@@ -229,32 +299,32 @@ func (vm *VM) run() (Addr, bool) {
 				}
 			}
 			if ok {
-				vm.pc++
+				vm.skip()
 			}
 
 		// Break
 		case OpBreak:
-			return Addr(decodeUint24(a, b, c)), true
+			return Addr(decodeUint24(int8(a), int8(b), int8(c))), true
 
 		// Call
 		case OpCallFunc:
-			call := callFrame{cl: callable{fn: vm.fn, vars: vm.vars}, fp: vm.fp, pc: vm.pc + 1}
-			fn := vm.fn.Functions[uint8(a)]
-			off := vm.fn.Body[vm.pc]
-			vm.fp[0] += Addr(off.Op)
-			if vm.fp[0]+Addr(fn.NumReg[0]) > vm.st[0] {
+			off, n := decodeStackShift(vm.fn.Body, vm.pc)
+			call := callFrame{cl: callable{fn: vm.fn, vars: vm.vars}, fp: vm.fp, pc: vm.pc + n}
+			fn := vm.fn.Functions[uint16(a)]
+			vm.fp[0] += Addr(off[0])
+			for vm.fp[0]+Addr(fn.NumReg[0]) > vm.st[0] {
 				vm.moreIntStack()
 			}
-			vm.fp[1] += Addr(off.A)
-			if vm.fp[1]+Addr(fn.NumReg[1]) > vm.st[1] {
+			vm.fp[1] += Addr(off[1])
+			for vm.fp[1]+Addr(fn.NumReg[1]) > vm.st[1] {
 				vm.moreFloatStack()
 			}
-			vm.fp[2] += Addr(off.B)
-			if vm.fp[2]+Addr(fn.NumReg[2]) > vm.st[2] {
+			vm.fp[2] += Addr(off[2])
+			for vm.fp[2]+Addr(fn.NumReg[2]) > vm.st[2] {
 				vm.moreStringStack()
 			}
-			vm.fp[3] += Addr(off.C)
-			if vm.fp[3]+Addr(fn.NumReg[3]) > vm.st[3] {
+			vm.fp[3] += Addr(off[3])
+			for vm.fp[3]+Addr(fn.NumReg[3]) > vm.st[3] {
 				vm.moreGeneralStack()
 			}
 			vm.fn = fn
@@ -263,29 +333,28 @@ func (vm *VM) run() (Addr, bool) {
 			vm.pc = 0
 		case OpCallIndirect:
 			f := vm.general(a).Interface().(*callable)
+			off, n := decodeStackShift(vm.fn.Body, vm.pc)
 			if f.fn == nil {
-				off := vm.fn.Body[vm.pc]
-				vm.callNative(f.Native(), c, StackShift{int8(off.Op), off.A, off.B, off.C}, startNativeGoroutine)
+				vm.callNative(f.Native(), int8(c), off, startNativeGoroutine, nil)
 				startNativeGoroutine = false
-				vm.pc++
+				vm.pc += n
 			} else {
-				call := callFrame{cl: callable{fn: vm.fn, vars: vm.vars}, fp: vm.fp, pc: vm.pc + 1}
+				call := callFrame{cl: callable{fn: vm.fn, vars: vm.vars}, fp: vm.fp, pc: vm.pc + n}
 				fn := f.fn
-				off := vm.fn.Body[vm.pc]
-				vm.fp[0] += Addr(off.Op)
-				if vm.fp[0]+Addr(fn.NumReg[0]) > vm.st[0] {
+				vm.fp[0] += Addr(off[0])
+				for vm.fp[0]+Addr(fn.NumReg[0]) > vm.st[0] {
 					vm.moreIntStack()
 				}
-				vm.fp[1] += Addr(off.A)
-				if vm.fp[1]+Addr(fn.NumReg[1]) > vm.st[1] {
+				vm.fp[1] += Addr(off[1])
+				for vm.fp[1]+Addr(fn.NumReg[1]) > vm.st[1] {
 					vm.moreFloatStack()
 				}
-				vm.fp[2] += Addr(off.B)
-				if vm.fp[2]+Addr(fn.NumReg[2]) > vm.st[2] {
+				vm.fp[2] += Addr(off[2])
+				for vm.fp[2]+Addr(fn.NumReg[2]) > vm.st[2] {
 					vm.moreStringStack()
 				}
-				vm.fp[3] += Addr(off.C)
-				if vm.fp[3]+Addr(fn.NumReg[3]) > vm.st[3] {
+				vm.fp[3] += Addr(off[3])
+				for vm.fp[3]+Addr(fn.NumReg[3]) > vm.st[3] {
 					vm.moreGeneralStack()
 				}
 				if fn.Macro {
@@ -296,29 +365,32 @@ func (vm *VM) run() (Addr, bool) {
 						vm.renderer = vm.renderer.WithConversion(fn.Format, ast.Format(b))
 					}
 				}
+				if f.recv.IsValid() {
+					vm.insertReceiver(fn, f.recv)
+				}
 				vm.fn = fn
 				vm.vars = f.vars
 				vm.calls = append(vm.calls, call)
 				vm.pc = 0
 			}
 		case OpCallMacro:
-			call := callFrame{cl: callable{fn: vm.fn, vars: vm.vars}, renderer: vm.renderer, fp: vm.fp, pc: vm.pc + 1}
-			fn := vm.fn.Functions[uint8(a)]
-			off := vm.fn.Body[vm.pc]
-			vm.fp[0] += Addr(off.Op)
-			if vm.fp[0]+Addr(fn.NumReg[0]) > vm.st[0] {
+			off, n := decodeStackShift(vm.fn.Body, vm.pc)
+			call := callFrame{cl: callable{fn: vm.fn, vars: vm.vars}, renderer: vm.renderer, fp: vm.fp, pc: vm.pc + n}
+			fn := vm.fn.Functions[uint16(a)]
+			vm.fp[0] += Addr(off[0])
+			for vm.fp[0]+Addr(fn.NumReg[0]) > vm.st[0] {
 				vm.moreIntStack()
 			}
-			vm.fp[1] += Addr(off.A)
-			if vm.fp[1]+Addr(fn.NumReg[1]) > vm.st[1] {
+			vm.fp[1] += Addr(off[1])
+			for vm.fp[1]+Addr(fn.NumReg[1]) > vm.st[1] {
 				vm.moreFloatStack()
 			}
-			vm.fp[2] += Addr(off.B)
-			if vm.fp[2]+Addr(fn.NumReg[2]) > vm.st[2] {
+			vm.fp[2] += Addr(off[2])
+			for vm.fp[2]+Addr(fn.NumReg[2]) > vm.st[2] {
 				vm.moreStringStack()
 			}
-			vm.fp[3] += Addr(off.C)
-			if vm.fp[3]+Addr(fn.NumReg[3]) > vm.st[3] {
+			vm.fp[3] += Addr(off[3])
+			for vm.fp[3]+Addr(fn.NumReg[3]) > vm.st[3] {
 				vm.moreGeneralStack()
 			}
 			if b == ReturnString {
@@ -331,11 +403,11 @@ func (vm *VM) run() (Addr, bool) {
 			vm.calls = append(vm.calls, call)
 			vm.pc = 0
 		case OpCallNative:
-			fn := vm.fn.NativeFunctions[uint8(a)]
-			off := vm.fn.Body[vm.pc]
-			vm.callNative(fn, c, StackShift{int8(off.Op), off.A, off.B, off.C}, startNativeGoroutine)
+			fn := vm.fn.NativeFunctions[uint16(a)]
+			off, n := decodeStackShift(vm.fn.Body, vm.pc)
+			vm.callNative(fn, int8(c), off, startNativeGoroutine, nil)
 			startNativeGoroutine = false
-			vm.pc++
+			vm.pc += n
 
 		// Cap
 		case OpCap:
@@ -396,14 +468,19 @@ func (vm *VM) run() (Addr, bool) {
 
 		// Continue
 		case OpContinue:
-			return Addr(decodeUint24(a, b, c)), false
+			return Addr(decodeUint24(int8(a), int8(b), int8(c))), false
 
 		// Convert
 		case OpConvert:
 			t := vm.fn.Types[uint8(b)]
 			switch t.Kind() {
 			case reflect.String:
-				vm.setString(c, vm.general(a).Convert(t).String())
+				v := vm.general(a)
+				s := v.Convert(t).String()
+				if vm.env.accounted && v.Kind() == reflect.Slice {
+					vm.alloc(len(s), 1)
+				}
+				vm.setString(c, s)
 			default:
 				vm.setGeneral(c, vm.general(a).Convert(t))
 			}
@@ -510,6 +587,13 @@ func (vm *VM) run() (Addr, bool) {
 			t := vm.fn.Types[uint8(b)]
 			v := reflect.ValueOf(vm.string(a))
 			if t.Kind() == reflect.Slice {
+				if vm.env.accounted {
+					if t.Elem().Kind() == reflect.Uint8 {
+						vm.alloc(v.Len(), 1)
+					} else {
+						vm.alloc(utf8.RuneCountInString(v.String()), t.Elem().Size())
+					}
+				}
 				vm.setGeneral(c, v.Convert(t))
 			} else {
 				var b bytes.Buffer
@@ -518,11 +602,17 @@ func (vm *VM) run() (Addr, bool) {
 				_, _ = r2.Out().Write([]byte(v.String()))
 				_ = r2.Close()
 				_ = r1.Close()
+				if vm.env.accounted {
+					vm.alloc(b.Len(), 1)
+				}
 				vm.setString(c, b.String())
 			}
 
 		// Concat
 		case OpConcat:
+			if vm.env.accounted {
+				vm.alloc(len(vm.string(a))+len(vm.string(b)), 1)
+			}
 			vm.setString(c, vm.string(a)+vm.string(b))
 
 		// Copy
@@ -535,17 +625,25 @@ func (vm *VM) run() (Addr, bool) {
 		// Defer
 		case OpDefer:
 			cl := vm.general(a).Interface().(*callable)
-			off := vm.fn.Body[vm.pc]
-			arg := vm.fn.Body[vm.pc+1]
+			off, n := decodeStackShift(vm.fn.Body, vm.pc)
+			arg, m := decodeStackShift(vm.fn.Body, vm.pc+n)
 			fp := [4]Addr{
-				vm.fp[0] + Addr(off.Op),
-				vm.fp[1] + Addr(off.A),
-				vm.fp[2] + Addr(off.B),
-				vm.fp[3] + Addr(off.C),
+				vm.fp[0] + Addr(off[0]),
+				vm.fp[1] + Addr(off[1]),
+				vm.fp[2] + Addr(off[2]),
+				vm.fp[3] + Addr(off[3]),
+			}
+			vm.swapStack(&vm.fp, &fp, arg)
+			call := callFrame{cl: *cl, renderer: vm.renderer, fp: fp, pc: 0, status: deferred, numVariadic: int8(c)}
+			if cl.fn == nil {
+				// For a native function, keep the address of the defer
+				// instruction so that the call can be reported with its
+				// position.
+				call.deferFn = vm.fn
+				call.pc = vm.pc - 1
 			}
-			vm.swapStack(&vm.fp, &fp, StackShift{int8(arg.Op), arg.A, arg.B, arg.C})
-			vm.calls = append(vm.calls, callFrame{cl: *cl, renderer: vm.renderer, fp: fp, pc: 0, status: deferred, numVariadic: c})
-			vm.pc += 2
+			vm.calls = append(vm.calls, call)
+			vm.pc += n + m
 
 		// Delete
 		case OpDelete:
@@ -597,7 +695,7 @@ func (vm *VM) run() (Addr, bool) {
 
 		// GetVar
 		case OpGetVar:
-			v := vm.vars[decodeInt16(a, b)]
+			v := vm.vars[decodeInt16(int8(a), int8(b))]
 			k := v.Kind()
 			switch {
 			case reflect.Bool <= k && k <= reflect.Float64:
@@ -613,7 +711,7 @@ func (vm *VM) run() (Addr, bool) {
 
 		// GetVarAddr
 		case OpGetVarAddr:
-			ptr := vm.vars[decodeInt16(a, b)].Addr()
+			ptr := vm.vars[decodeInt16(int8(a), int8(b))].Addr()
 			vm.setFromReflectValue(c, ptr)
 
 		// Go
@@ -625,7 +723,7 @@ func (vm *VM) run() (Addr, bool) {
 
 		// Goto
 		case OpGoto:
-			vm.pc = Addr(decodeUint24(a, b, c))
+			vm.pc = Addr(decodeUint24(int8(a), int8(b), int8(c)))
 
 		// If
 		case OpIf, -OpIf:
@@ -694,7 +792,7 @@ func (vm *VM) run() (Addr, bool) {
 				cond = !cond
 			}
 			if cond {
-				vm.pc++
+				vm.skip()
 			}
 		case OpIfInt, -OpIfInt:
 			var cond bool
@@ -794,7 +892,7 @@ func (vm *VM) run() (Addr, bool) {
 				}
 			}
 			if cond {
-				vm.pc++
+				vm.skip()
 			}
 		case OpIfFloat, -OpIfFloat:
 			var cond bool
@@ -850,7 +948,7 @@ func (vm *VM) run() (Addr, bool) {
 				}
 			}
 			if cond {
-				vm.pc++
+				vm.skip()
 			}
 		case OpIfString, -OpIfString:
 			var cond bool
@@ -924,7 +1022,7 @@ func (vm *VM) run() (Addr, bool) {
 				}
 			}
 			if cond {
-				vm.pc++
+				vm.skip()
 			}
 
 		// Index
@@ -935,7 +1033,23 @@ func (vm *VM) run() (Addr, bool) {
 			// change in a future commit.
 			v := vm.general(a)
 			i := int(vm.intk(b, op < 0))
-			vm.setFromReflectValue(c, v.Index(i))
+			// Read the elements of []int, []float64 and []string values without
+			// reflection. An addressable value is not converted to an interface
+			// because the conversion would allocate.
+			if v.Kind() == reflect.Slice && !v.CanAddr() && uint(i) < uint(v.Len()) {
+				switch s := v.Interface().(type) {
+				case []int:
+					vm.setInt(c, int64(s[i]))
+				case []float64:
+					vm.setFloat(c, s[i])
+				case []string:
+					vm.setString(c, s[i])
+				default:
+					vm.setFromReflectValue(c, v.Index(i))
+				}
+			} else {
+				vm.setFromReflectValue(c, v.Index(i))
+			}
 		case OpIndexString, -OpIndexString:
 			vm.setInt(c, int64(vm.string(a)[int(vm.intk(b, op < 0))]))
 		case OpIndexRef, -OpIndexRef:
@@ -955,7 +1069,7 @@ func (vm *VM) run() (Addr, bool) {
 
 		// Load
 		case OpLoad:
-			t, i := decodeValueIndex(a, b)
+			t, i := decodeValueIndex(int8(a), int8(b))
 			switch t {
 			case intRegister:
 				vm.setInt(c, vm.fn.Values.Int[i])
@@ -971,10 +1085,10 @@ func (vm *VM) run() (Addr, bool) {
 		case OpLoadFunc:
 			if a == 1 {
 				fn := callable{}
-				fn.native = vm.fn.NativeFunctions[uint8(b)]
+				fn.native = vm.fn.NativeFunctions[uint16(b)]
 				vm.setGeneral(c, reflect.ValueOf(&fn))
 			} else {
-				fn := vm.fn.Functions[uint8(b)]
+				fn := vm.fn.Functions[uint16(b)]
 				var vars []reflect.Value
 				if fn.VarRefs != nil {
 					vars = make([]reflect.Value, len(fn.VarRefs))
@@ -983,7 +1097,7 @@ func (vm *VM) run() (Addr, bool) {
 							// Calling Elem() is necessary because the general
 							// register contains an indirect value, that is
 							// stored as a pointer to a value.
-							vars[i] = vm.general(int8(-ref)).Elem()
+							vars[i] = vm.general(-ref).Elem()
 						} else {
 							vars[i] = vm.vars[ref]
 						}
@@ -997,6 +1111,9 @@ func (vm *VM) run() (Addr, bool) {
 		// MakeArray
 		case OpMakeArray:
 			t := vm.fn.Types[uint8(b)]
+			if vm.env.accounted {
+				vm.alloc(1, t.Size())
+			}
 			vm.setGeneral(c, reflect.New(t).Elem())
 
 		// MakeChan
@@ -1016,6 +1133,10 @@ func (vm *VM) run() (Addr, bool) {
 		case OpMakeMap, -OpMakeMap:
 			typ := vm.fn.Types[uint8(a)]
 			n := int(vm.intk(b, op < 0))
+			if vm.env.accounted {
+				vm.alloc(1, mapHeaderSize)
+				vm.alloc(n, typ.Key().Size()+typ.Elem().Size())
+			}
 			if n > 0 {
 				vm.setGeneral(c, reflect.MakeMapWithSize(typ, n))
 			} else {
@@ -1026,21 +1147,27 @@ func (vm *VM) run() (Addr, bool) {
 		case OpMakeSlice:
 			typ := vm.fn.Types[uint8(a)]
 			var len, cap int
+			var n Addr
 			if b > 0 {
-				next := vm.fn.Body[vm.pc]
+				var l, c int16
+				l, c, _, n = decodeDataWord(vm.fn.Body, vm.pc, b&(1<<3) != 0)
 				lenIsConst := (b & (1 << 1)) != 0
-				len = int(vm.intk(next.A, lenIsConst))
+				len = int(vm.intk(l, lenIsConst))
 				capIsConst := (b & (1 << 2)) != 0
-				cap = int(vm.intk(next.B, capIsConst))
+				cap = int(vm.intk(c, capIsConst))
 			}
-			vm.setGeneral(c, reflect.MakeSlice(typ, len, cap))
-			if b > 0 {
-				vm.pc++
+			if vm.env.accounted {
+				vm.alloc(cap, typ.Elem().Size())
 			}
+			vm.setGeneral(c, reflect.MakeSlice(typ, len, cap))
+			vm.pc += n
 
 		// MakeStruct
 		case OpMakeStruct:
 			t := vm.fn.Types[uint8(b)]
+			if vm.env.accounted {
+				vm.alloc(1, t.Size())
+			}
 			vm.setGeneral(c, reflect.New(t).Elem())
 
 		// MapIndex
@@ -1079,7 +1206,24 @@ func (vm *VM) run() (Addr, bool) {
 				panic(errNilPointer)
 			}
 			method := vm.stringk(b, true)
-			vm.setGeneral(c, reflect.ValueOf(&callable{value: receiver.MethodByName(method)}))
+			if cl, ok := vm.scriggoMethodValue(receiver, method); ok {
+				vm.setGeneral(c, reflect.ValueOf(cl))
+				break
+			}
+			if stub := native.MethodStub(receiver.Type(), method); stub != nil {
+				vm.setGeneral(c, reflect.ValueOf(&callable{native: newNativeMethod(receiver, method, stub)}))
+				break
+			}
+			m := receiver.MethodByName(method)
+			if !m.IsValid() {
+				// The method is declared in Scriggo but the receiver has
+				// not been typified with its Scriggo type.
+				panic(runtimeError("runtime error: type " + receiver.Type().String() + " has no method " + method))
+			}
+			fn := NewNativeFunction("", "", m)
+			fn.rcvType = receiver.Type()
+			fn.method = method
+			vm.setGeneral(c, reflect.ValueOf(&callable{value: m, native: fn}))
 
 		// Move
 		case OpMove, -OpMove:
@@ -1165,6 +1309,9 @@ func (vm *VM) run() (Addr, bool) {
 		// New
 		case OpNew:
 			t := vm.fn.Types[uint8(b)]
+			if vm.env.accounted {
+				vm.alloc(1, t.Size())
+			}
 			vm.setGeneral(c, reflect.New(t))
 
 		// Or
@@ -1192,7 +1339,6 @@ func (vm *VM) run() (Addr, bool) {
 		// Range
 		case OpRange:
 			endAddress := vm.pc
-			rangeAddress := endAddress - 1
 			bodyAddress := endAddress + 1
 			v := vm.general(a)
 			switch s := v.Interface().(type) {
@@ -1206,7 +1352,7 @@ func (vm *VM) run() (Addr, bool) {
 					}
 					vm.pc = bodyAddress
 					addr, breakOut := vm.run()
-					if addr != rangeAddress {
+					if addr != endAddress {
 						return addr, breakOut
 					}
 					if breakOut {
@@ -1223,7 +1369,7 @@ func (vm *VM) run() (Addr, bool) {
 					}
 					vm.pc = bodyAddress
 					addr, breakOut := vm.run()
-					if addr != rangeAddress {
+					if addr != endAddress {
 						return addr, breakOut
 					}
 					if breakOut {
@@ -1240,7 +1386,7 @@ func (vm *VM) run() (Addr, bool) {
 					}
 					vm.pc = bodyAddress
 					addr, breakOut := vm.run()
-					if addr != rangeAddress {
+					if addr != endAddress {
 						return addr, breakOut
 					}
 					if breakOut {
@@ -1257,7 +1403,7 @@ func (vm *VM) run() (Addr, bool) {
 					}
 					vm.pc = bodyAddress
 					addr, breakOut := vm.run()
-					if addr != rangeAddress {
+					if addr != endAddress {
 						return addr, breakOut
 					}
 					if breakOut {
@@ -1274,7 +1420,7 @@ func (vm *VM) run() (Addr, bool) {
 					}
 					vm.pc = bodyAddress
 					addr, breakOut := vm.run()
-					if addr != rangeAddress {
+					if addr != endAddress {
 						return addr, breakOut
 					}
 					if breakOut {
@@ -1291,7 +1437,7 @@ func (vm *VM) run() (Addr, bool) {
 					}
 					vm.pc = bodyAddress
 					addr, breakOut := vm.run()
-					if addr != rangeAddress {
+					if addr != endAddress {
 						return addr, breakOut
 					}
 					if breakOut {
@@ -1308,7 +1454,7 @@ func (vm *VM) run() (Addr, bool) {
 					}
 					vm.pc = bodyAddress
 					addr, breakOut := vm.run()
-					if addr != rangeAddress {
+					if addr != endAddress {
 						return addr, breakOut
 					}
 					if breakOut {
@@ -1325,7 +1471,7 @@ func (vm *VM) run() (Addr, bool) {
 					}
 					vm.pc = bodyAddress
 					addr, breakOut := vm.run()
-					if addr != rangeAddress {
+					if addr != endAddress {
 						return addr, breakOut
 					}
 					if breakOut {
@@ -1342,7 +1488,7 @@ func (vm *VM) run() (Addr, bool) {
 					}
 					vm.pc = bodyAddress
 					addr, breakOut := vm.run()
-					if addr != rangeAddress {
+					if addr != endAddress {
 						return addr, breakOut
 					}
 					if breakOut {
@@ -1359,7 +1505,7 @@ func (vm *VM) run() (Addr, bool) {
 					}
 					vm.pc = bodyAddress
 					addr, breakOut := vm.run()
-					if addr != rangeAddress {
+					if addr != endAddress {
 						return addr, breakOut
 					}
 					if breakOut {
@@ -1379,7 +1525,7 @@ func (vm *VM) run() (Addr, bool) {
 						}
 						vm.pc = bodyAddress
 						addr, breakOut := vm.run()
-						if addr != rangeAddress {
+						if addr != endAddress {
 							return addr, breakOut
 						}
 						if breakOut {
@@ -1410,7 +1556,7 @@ func (vm *VM) run() (Addr, bool) {
 						}
 						vm.pc = bodyAddress
 						addr, breakOut := vm.run()
-						if addr != rangeAddress {
+						if addr != endAddress {
 							return addr, breakOut
 						}
 						if breakOut {
@@ -1431,7 +1577,7 @@ func (vm *VM) run() (Addr, bool) {
 						}
 						vm.pc = bodyAddress
 						addr, breakOut := vm.run()
-						if addr != rangeAddress {
+						if addr != endAddress {
 							return addr, breakOut
 						}
 						if breakOut {
@@ -1443,10 +1589,191 @@ func (vm *VM) run() (Addr, bool) {
 			vm.ok = vm.pc != endAddress
 			vm.pc = endAddress
 
+		// RangeMapString
+		case OpRangeMapString:
+			endAddress := vm.pc
+			bodyAddress := endAddress + 1
+			v := vm.general(a)
+			switch m := v.Interface().(type) {
+			case map[string]int:
+				for k, e := range m {
+					if b != 0 {
+						vm.setString(b, k)
+					}
+					if c != 0 {
+						vm.setInt(c, int64(e))
+					}
+					vm.pc = bodyAddress
+					addr, breakOut := vm.run()
+					if addr != endAddress {
+						return addr, breakOut
+					}
+					if breakOut {
+						break
+					}
+				}
+			case map[string]float64:
+				for k, e := range m {
+					if b != 0 {
+						vm.setString(b, k)
+					}
+					if c != 0 {
+						vm.setFloat(c, e)
+					}
+					vm.pc = bodyAddress
+					addr, breakOut := vm.run()
+					if addr != endAddress {
+						return addr, breakOut
+					}
+					if breakOut {
+						break
+					}
+				}
+			case map[string]string:
+				for k, e := range m {
+					if b != 0 {
+						vm.setString(b, k)
+					}
+					if c != 0 {
+						vm.setString(c, e)
+					}
+					vm.pc = bodyAddress
+					addr, breakOut := vm.run()
+					if addr != endAddress {
+						return addr, breakOut
+					}
+					if breakOut {
+						break
+					}
+				}
+			case map[string]bool:
+				for k, e := range m {
+					if b != 0 {
+						vm.setString(b, k)
+					}
+					if c != 0 {
+						vm.setBool(c, e)
+					}
+					vm.pc = bodyAddress
+					addr, breakOut := vm.run()
+					if addr != endAddress {
+						return addr, breakOut
+					}
+					if breakOut {
+						break
+					}
+				}
+			default:
+				// The value is stored in a general register, so it is read as
+				// a reflect.Value, but the key is read as a string.
+				iter := v.MapRange()
+				for iter.Next() {
+					if b != 0 {
+						vm.setString(b, iter.Key().String())
+					}
+					if c != 0 {
+						vm.setFromReflectValue(c, iter.Value())
+					}
+					vm.pc = bodyAddress
+					addr, breakOut := vm.run()
+					if addr != endAddress {
+						return addr, breakOut
+					}
+					if breakOut {
+						break
+					}
+				}
+			}
+			vm.ok = vm.pc != endAddress
+			vm.pc = endAddress
+
+		// RangeSliceFloat64
+		case OpRangeSliceFloat64:
+			endAddress := vm.pc
+			bodyAddress := endAddress + 1
+			v := vm.general(a)
+			s, ok := v.Interface().([]float64)
+			if !ok {
+				s = v.Convert(float64SliceType).Interface().([]float64)
+			}
+			for i, e := range s {
+				if b != 0 {
+					vm.setInt(b, int64(i))
+				}
+				if c != 0 {
+					vm.setFloat(c, e)
+				}
+				vm.pc = bodyAddress
+				addr, breakOut := vm.run()
+				if addr != endAddress {
+					return addr, breakOut
+				}
+				if breakOut {
+					break
+				}
+			}
+			vm.ok = vm.pc != endAddress
+			vm.pc = endAddress
+
+		// RangeSliceInt
+		case OpRangeSliceInt:
+			endAddress := vm.pc
+			bodyAddress := endAddress + 1
+			v := vm.general(a)
+			s, ok := v.Interface().([]int)
+			if !ok {
+				s = v.Convert(intSliceType).Interface().([]int)
+			}
+			for i, e := range s {
+				if b != 0 {
+					vm.setInt(b, int64(i))
+				}
+				if c != 0 {
+					vm.setInt(c, int64(e))
+				}
+				vm.pc = bodyAddress
+				addr, breakOut := vm.run()
+				if addr != endAddress {
+					return addr, breakOut
+				}
+				if breakOut {
+					break
+				}
+			}
+			vm.ok = vm.pc != endAddress
+			vm.pc = endAddress
+
+		// RangeSliceString
+		case OpRangeSliceString:
+			endAddress := vm.pc
+			bodyAddress := endAddress + 1
+			v := vm.general(a)
+			s, ok := v.Interface().([]string)
+			if !ok {
+				s = v.Convert(stringSliceType).Interface().([]string)
+			}
+			for i, e := range s {
+				if b != 0 {
+					vm.setInt(b, int64(i))
+				}
+				if c != 0 {
+					vm.setString(c, e)
+				}
+				vm.pc = bodyAddress
+				addr, breakOut := vm.run()
+				if addr != endAddress {
+					return addr, breakOut
+				}
+				if breakOut {
+					break
+				}
+			}
+			vm.ok = vm.pc != endAddress
+			vm.pc = endAddress
+
 		// RangeString
 		case OpRangeString, -OpRangeString:
 			endAddress := vm.pc
-			rangeAddress := endAddress - 1
 			bodyAddress := endAddress + 1
 			s := vm.stringk(a, op < 0)
 			for i, e := range s {
@@ -1458,7 +1785,7 @@ func (vm *VM) run() (Addr, bool) {
 				}
 				vm.pc = bodyAddress
 				addr, breakOut := vm.run()
-				if addr != rangeAddress {
+				if addr != endAddress {
 					return addr, breakOut
 				}
 				if breakOut {
@@ -1607,9 +1934,14 @@ func (vm *VM) run() (Addr, bool) {
 			step := numCase - chosen
 			var pc Addr
 			if step > 0 {
-				pc = vm.pc - 2*Addr(step)
+				if a == 0 {
+					pc = vm.pc - 2*Addr(step)
+				} else {
+					// Every case has an OpWide prefix.
+					pc = vm.pc + 1 - 3*Addr(step)
+				}
 				if vm.cases[chosen].Dir == reflect.SelectRecv {
-					r := vm.fn.Body[pc-1].C
+					_, _, r := vm.operands(pc - 1)
 					if r != 0 {
 						vm.setFromReflectValue(r, recv)
 					}
@@ -1655,6 +1987,10 @@ func (vm *VM) run() (Addr, bool) {
 		// SetMap
 		case OpSetMap, -OpSetMap:
 			mv := vm.general(b)
+			var n int
+			if vm.env.accounted {
+				n = mv.Len()
+			}
 			switch m := mv.Interface().(type) {
 			case map[string]string:
 				k := vm.string(c)
@@ -1700,6 +2036,10 @@ func (vm *VM) run() (Addr, bool) {
 				vm.getIntoReflectValue(a, v, op < 0)
 				mv.SetMapIndex(k, v)
 			}
+			if vm.env.accounted && mv.Len() > n {
+				t := mv.Type()
+				vm.alloc(1, t.Key().Size()+t.Elem().Size())
+			}
 
 		// SetSlice
 		case OpSetSlice, -OpSetSlice:
@@ -1730,7 +2070,7 @@ func (vm *VM) run() (Addr, bool) {
 
 		// SetVar
 		case OpSetVar, -OpSetVar:
-			v := vm.vars[decodeInt16(b, c)]
+			v := vm.vars[decodeInt16(int8(b), int8(c))]
 			vm.getIntoReflectValue(a, v, op < 0)
 
 		// Shl
@@ -1780,7 +2120,7 @@ func (vm *VM) run() (Addr, bool) {
 			rv := reflect.New(t).Elem()
 			vm.getIntoReflectValue(b, rv, op < 0)
 			if st != nil {
-				rv = st.Wrap(rv)
+				rv = vm.wrap(st, rv)
 			}
 			var v interface{}
 			if rv.IsValid() {
@@ -1795,33 +2135,33 @@ func (vm *VM) run() (Addr, bool) {
 		case OpSlice:
 			var i1, i2, i3 int
 			s := vm.general(a)
-			next := vm.fn.Body[vm.pc]
-			i1 = int(vm.intk(next.A, b&1 != 0))
-			if k := b&2 != 0; k && next.B == -1 {
+			low, high, max, n := decodeDataWord(vm.fn.Body, vm.pc, b&8 != 0)
+			i1 = int(vm.intk(low, b&1 != 0))
+			if k := b&2 != 0; k && high == -1 {
 				i2 = s.Len()
 			} else {
-				i2 = int(vm.intk(next.B, k))
+				i2 = int(vm.intk(high, k))
 			}
-			if k := b&4 != 0; k && next.C == -1 {
+			if k := b&4 != 0; k && max == -1 {
 				i3 = s.Cap()
 			} else {
-				i3 = int(vm.intk(next.C, k))
+				i3 = int(vm.intk(max, k))
 			}
 			s = s.Slice3(i1, i2, i3)
 			vm.setGeneral(c, s)
-			vm.pc++
+			vm.pc += n
 		case OpStringSlice:
 			var i1, i2 int
 			s := vm.string(a)
-			next := vm.fn.Body[vm.pc]
-			i1 = int(vm.intk(next.A, b&1 != 0))
-			if k := b&2 != 0; k && next.B == -1 {
+			low, high, _, n := decodeDataWord(vm.fn.Body, vm.pc, b&8 != 0)
+			i1 = int(vm.intk(low, b&1 != 0))
+			if k := b&2 != 0; k && high == -1 {
 				i2 = len(s)
 			} else {
-				i2 = int(vm.intk(next.B, k))
+				i2 = int(vm.intk(high, k))
 			}
 			vm.setString(c, s[i1:i2])
-			vm.pc++
+			vm.pc += n
 
 		// Sub
 		case OpSub, -OpSub:
@@ -1897,19 +2237,19 @@ func (vm *VM) run() (Addr, bool) {
 					fn = closure.fn
 					vm.vars = closure.vars
 				} else {
-					fn = vm.fn.Functions[uint8(b)]
+					fn = vm.fn.Functions[uint16(b)]
 					vm.vars = vm.env.globals
 				}
-				if vm.fp[0]+Addr(fn.NumReg[0]) > vm.st[0] {
+				for vm.fp[0]+Addr(fn.NumReg[0]) > vm.st[0] {
 					vm.moreIntStack()
 				}
-				if vm.fp[1]+Addr(fn.NumReg[1]) > vm.st[1] {
+				for vm.fp[1]+Addr(fn.NumReg[1]) > vm.st[1] {
 					vm.moreFloatStack()
 				}
-				if vm.fp[2]+Addr(fn.NumReg[2]) > vm.st[2] {
+				for vm.fp[2]+Addr(fn.NumReg[2]) > vm.st[2] {
 					vm.moreStringStack()
 				}
-				if vm.fp[3]+Addr(fn.NumReg[3]) > vm.st[3] {
+				for vm.fp[3]+Addr(fn.NumReg[3]) > vm.st[3] {
 					vm.moreGeneralStack()
 				}
 				vm.fn = fn
@@ -1918,7 +2258,7 @@ func (vm *VM) run() (Addr, bool) {
 
 		// Text
 		case OpText:
-			txt := vm.fn.Text[decodeUint16(a, b)]
+			txt := vm.fn.Text[decodeUint16(int8(a), int8(b))]
 			inURL, isSet := c > 0, c == 2
 			err := vm.renderer.Text(txt, inURL, isSet)
 			if err != nil {
@@ -1935,7 +2275,7 @@ func (vm *VM) run() (Addr, bool) {
 			v := reflect.New(t).Elem()
 			vm.getIntoReflectValue(b, v, op < 0)
 			if st != nil {
-				v = st.Wrap(v)
+				v = vm.wrap(st, v)
 			}
 			vm.setGeneral(c, v)
 
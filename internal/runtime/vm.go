@@ -9,6 +9,7 @@ import (
 	"errors"
 	"io"
 	"reflect"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
@@ -23,6 +24,7 @@ const CurrentFunction = -1
 const ReturnString = -1
 
 const maxUint32 = 1<<31 - 1
+const maxInt64 = 1<<63 - 1
 
 const stackSize = 512
 
@@ -30,6 +32,9 @@ var envType = reflect.TypeOf((*native.Env)(nil)).Elem()
 var emptyInterfaceType = reflect.TypeOf(&[]interface{}{nil}[0]).Elem()
 var emptyInterfaceNil = reflect.ValueOf(&[]interface{}{nil}[0]).Elem()
 var stringType = reflect.TypeOf("")
+var intSliceType = reflect.TypeOf([]int(nil))
+var float64SliceType = reflect.TypeOf([]float64(nil))
+var stringSliceType = reflect.TypeOf([]string(nil))
 
 // Converter is implemented by format converters.
 type Converter func(src []byte, out io.Writer) error
@@ -58,7 +63,34 @@ type ScriggoType interface {
 	GoType() reflect.Type
 }
 
-type StackShift [4]int8
+// A ScriggoMethodSet is a Scriggo type that can have methods declared in
+// Scriggo, as a defined type or a pointer to a defined type.
+type ScriggoMethodSet interface {
+	ScriggoType
+
+	// ScriggoMethod returns the function of the method with the given name in
+	// the method set of the type, and reports whether the method has a
+	// pointer receiver. The receiver is the first parameter of the function.
+	// For a method promoted from an embedded field, index is the index
+	// sequence of the field, otherwise it is nil.
+	ScriggoMethod(name string) (fn *Function, ptr bool, index []int, ok bool)
+
+	// WrapMethods is like Wrap but the proxy also exposes to Go the methods
+	// String and Error, if the type has them, calling them with call.
+	WrapMethods(v reflect.Value, call MethodCallFunc) reflect.Value
+}
+
+// A MethodCallFunc function calls the function fn of a method with the given
+// arguments, where the first argument is the receiver, and returns its
+// results.
+type MethodCallFunc func(fn *Function, args []reflect.Value) []reflect.Value
+
+// StackShift is the shift of the frame pointers in a function call. It is
+// stored in the body of the function after the call instruction, in one
+// instruction if every shift fits in an int8, otherwise in four
+// instructions: the low and the high bytes of the shifts between two
+// instructions with a negative operation.
+type StackShift [4]int16
 
 type Instruction struct {
 	Op      Operation
@@ -81,6 +113,38 @@ func decodeValueIndex(a, b int8) (t registerType, i int) {
 	return registerType(uint8(a) >> 6), int(decodeUint16(a, b) &^ (3 << 14))
 }
 
+// decodeStackShift decodes the stack shift stored in body at address addr,
+// returning the shift and the number of instructions it occupies.
+func decodeStackShift(body []Instruction, addr Addr) (StackShift, Addr) {
+	s := body[addr]
+	if s.Op >= 0 {
+		return StackShift{int16(s.Op), int16(s.A), int16(s.B), int16(s.C)}, 1
+	}
+	lo, hi := body[addr+1], body[addr+2]
+	return StackShift{
+		int16(hi.Op)<<8 | int16(uint8(lo.Op)),
+		int16(hi.A)<<8 | int16(uint8(lo.A)),
+		int16(hi.B)<<8 | int16(uint8(lo.B)),
+		int16(hi.C)<<8 | int16(uint8(lo.C)),
+	}, 4
+}
+
+// decodeDataWord decodes the data word, at address addr of body, that
+// follows the MakeSlice, Slice and StringSlice instructions. If wide is true
+// the data word is followed by a word with the high bytes of its operands.
+// It returns the operands and the number of words.
+func decodeDataWord(body []Instruction, addr Addr, wide bool) (a, b, c int16, n Addr) {
+	in := body[addr]
+	if !wide {
+		return int16(in.A), int16(in.B), int16(in.C), 1
+	}
+	hi := body[addr+1]
+	a = int16(hi.A)<<8 | int16(uint8(in.A))
+	b = int16(hi.B)<<8 | int16(uint8(in.B))
+	c = int16(hi.C)<<8 | int16(uint8(in.C))
+	return a, b, c, 2
+}
+
 // VM represents a Scriggo virtual machine.
 type VM struct {
 	fp       [4]Addr              // frame pointers.
@@ -88,6 +152,7 @@ type VM struct {
 	pc       Addr                 // program counter.
 	ok       bool                 // ok flag.
 	regs     registers            // registers.
+	stubRegs native.Registers     // registers passed to native stubs.
 	fn       *Function            // running function.
 	vars     []reflect.Value      // global and closure variables.
 	env      *env                 // execution environment.
@@ -97,6 +162,9 @@ type VM struct {
 	cases    []reflect.SelectCase // select cases.
 	panic    *PanicError          // panic.
 	main     bool                 // reports whether this VM is executing the main goroutine.
+	debug    *debugState          // debugger state; nil if there is no debugger.
+	profile  *profileState        // profiler state; nil if there is no profiler.
+	cover    *coverState          // coverage state; nil if there is no coverage collector.
 }
 
 // NewVM returns a new virtual machine.
@@ -127,6 +195,9 @@ func (vm *VM) Reset() {
 		vm.cases = vm.cases[:0]
 	}
 	vm.panic = nil
+	vm.debug = nil
+	vm.profile = nil
+	vm.cover = nil
 }
 
 // stop is called in the vm.run method to stop the execution.
@@ -153,21 +224,79 @@ func (vm *VM) Run(fn *Function, typeof TypeOfFunc, globals []reflect.Value) erro
 	vm.env.globals = globals
 	err := vm.runFunc(fn, globals)
 	if err != nil {
-		switch e := err.(type) {
-		case *PanicError:
-			if outErr, ok := e.message.(outError); ok {
-				err = outErr.err
-			}
-		case *fatalError:
-			panic(e.msg)
-		case stopError:
-			err = e.err
-		}
-		return err
+		return runError(err)
 	}
 	return nil
 }
 
+// Call calls the function fn with the given global variables and arguments
+// and waits for it to complete. fn must be a function declared at package
+// level, or a function literal that refers only to global variables, and
+// args must have the types of the parameters of fn. If fn is variadic, the
+// last argument must be a slice with the variadic arguments.
+//
+// Run and Call can be called in sequence on the same VM, for example to
+// call a function after the package variables have been initialized.
+//
+// Call returns the results of fn. Errors are returned as for the Run method.
+func (vm *VM) Call(fn *Function, typeof TypeOfFunc, globals []reflect.Value, args []reflect.Value) ([]reflect.Value, error) {
+	if typeof == nil {
+		typeof = typeOfFunc
+	}
+	vm.env.typeof = typeof
+	vm.env.globals = globals
+	nOut := fn.Type.NumOut()
+	results := make([]reflect.Value, nOut)
+	var r = [4]int16{1, 1, 1, 1}
+	for i := 0; i < nOut; i++ {
+		typ := fn.Type.Out(i)
+		if st, ok := typ.(ScriggoType); ok {
+			typ = st.GoType()
+		}
+		results[i] = reflect.New(typ).Elem()
+		r[kindToType[typ.Kind()]]++
+	}
+	for _, arg := range args {
+		t := kindToType[arg.Kind()]
+		vm.setFromReflectValue(r[t], arg)
+		r[t]++
+	}
+	vars := globals
+	if fn.VarRefs != nil {
+		vars = make([]reflect.Value, len(fn.VarRefs))
+		for i, ref := range fn.VarRefs {
+			vars[i] = globals[ref]
+		}
+	}
+	err := vm.runFunc(fn, vars)
+	if err != nil {
+		return nil, runError(err)
+	}
+	r = [4]int16{1, 1, 1, 1}
+	for _, result := range results {
+		t := kindToType[result.Kind()]
+		vm.getIntoReflectValue(r[t], result, false)
+		r[t]++
+	}
+	return results, nil
+}
+
+// runError returns the error to return from the Run and Call methods given
+// the error returned by runFunc.
+func runError(err error) error {
+	switch e := err.(type) {
+	case *PanicError:
+		if outErr, ok := e.message.(outError); ok {
+			err = outErr.err
+		}
+	case *fatalError:
+		panic(e.msg)
+	case stopError:
+		err = e.err
+	}
+	return err
+}
+
 // SetContext sets the context.
 //
 // SetContext must not be called after vm has been started.
@@ -187,6 +316,65 @@ func (vm *VM) SetContext(ctx context.Context) {
 	vm.env.doneCase = reflect.SelectCase{}
 }
 
+// SetMaxInstructions sets the maximum number of instructions that can be
+// executed. When the limit is exceeded, the execution is stopped and Run
+// returns an *InstructionLimitError error. If max is zero or negative, the
+// number of instructions is not limited.
+//
+// Instructions executed by goroutines started by the program are counted
+// toward the same limit.
+//
+// SetMaxInstructions must not be called after vm has been started.
+func (vm *VM) SetMaxInstructions(max int64) {
+	if max <= 0 {
+		vm.env.limited = false
+		vm.env.maxInstructions = 0
+		vm.env.fuel = 0
+		return
+	}
+	vm.env.limited = true
+	vm.env.maxInstructions = max
+	vm.env.fuel = max
+}
+
+// SetNativeCallCost sets the function that returns the cost of a native
+// function call. The cost is subtracted, as number of instructions, from the
+// limit set with SetMaxInstructions. If there is no limit, f is never called.
+//
+// SetNativeCallCost must not be called after vm has been started.
+func (vm *VM) SetNativeCallCost(f NativeCallCostFunc) {
+	vm.env.nativeCallCost = f
+}
+
+// SetOnNativeCall sets the function called before every call to a native
+// function. If f returns a non-nil error, the function is not called, the
+// execution is stopped and Run returns a *NativeCallDeniedError error.
+//
+// f is also called by the goroutines, so it can be called concurrently.
+//
+// SetOnNativeCall must not be called after vm has been started.
+func (vm *VM) SetOnNativeCall(f NativeCallFunc) {
+	vm.env.onNativeCall = f
+}
+
+// SetMaxAllocatedBytes sets the maximum number of bytes that can be
+// allocated by the execution. When the limit is exceeded, the execution is
+// stopped and Run returns an *AllocationLimitError error. If max is not
+// positive, the allocations are not limited.
+//
+// The bytes are accounted when a slice, a map, a string, an array or a
+// struct is created, also by a conversion, or when a slice or a map grows.
+// The bytes are never subtracted, also if the memory is released, so max is
+// a budget for the whole execution and not a limit on the live memory.
+//
+// SetMaxAllocatedBytes must not be called after vm has been started.
+func (vm *VM) SetMaxAllocatedBytes(max int64) {
+	if max > 0 {
+		vm.env.accounted = true
+		vm.env.maxAllocated = max
+	}
+}
+
 // SetRenderer sets template output and markdown converter.
 //
 // SetRenderer must not be called after vm has been started.
@@ -226,7 +414,7 @@ func (vm *VM) Stack(buf []byte, all bool) int {
 			if call.status == tailed {
 				ppc = call.pc - 1
 			} else {
-				ppc = call.pc - 2
+				ppc = call.callAddr()
 			}
 		}
 		write("\n")
@@ -252,18 +440,132 @@ func (vm *VM) Stack(buf []byte, all bool) int {
 	return len(b)
 }
 
+// stackTrace returns the stack trace of the currently running goroutine,
+// starting from the frame of the currently executing instruction. If the
+// instruction calls a native function, the first frame is the frame of the
+// native function.
+func (vm *VM) stackTrace() []StackFrame {
+	var frames []StackFrame
+	if fn := vm.calledNative(); fn != nil {
+		frames = append(frames, StackFrame{Func: fn.qualifiedName(), Native: true})
+	}
+	for i := len(vm.calls); i >= 0; i-- {
+		var fn *Function
+		var ppc Addr
+		if i == len(vm.calls) {
+			fn = vm.fn
+			ppc = vm.panicAddr()
+		} else {
+			call := vm.calls[i]
+			fn = call.cl.fn
+			if call.status == tailed {
+				ppc = call.pc - 1
+			} else {
+				ppc = call.callAddr()
+			}
+		}
+		if fn == nil {
+			continue
+		}
+		f, _ := fn.frames(ppc)
+		frames = append(frames, f...)
+	}
+	return frames
+}
+
+// calledNative returns the native function called by the currently
+// executing instruction. If the instruction does not call a native
+// function, it returns nil.
+func (vm *VM) calledNative() *NativeFunction {
+	if vm.fn == nil || vm.pc == 0 {
+		return nil
+	}
+	op := vm.fn.Body[vm.pc-1].Op
+	a, _, _ := vm.operands(vm.pc - 1)
+	switch op {
+	case OpCallNative:
+		return vm.fn.NativeFunctions[uint16(a)]
+	case OpCallIndirect:
+		v := vm.general(a)
+		if !v.IsValid() || !v.CanInterface() {
+			return nil
+		}
+		if f, ok := v.Interface().(*callable); ok && f.fn == nil {
+			return f.Native()
+		}
+	}
+	return nil
+}
+
+// mapHeaderSize is the size, in bytes, accounted for the creation of a map.
+const mapHeaderSize = 48
+
+// alloc accounts the allocation of n elements of the given size. It panics
+// with an *AllocationLimitError if the allocation limit is exceeded.
+//
+// alloc must be called only if the allocations are accounted.
+func (vm *VM) alloc(n int, size uintptr) {
+	if n <= 0 || size == 0 {
+		return
+	}
+	bytes := int64(maxInt64)
+	if uint64(n) <= uint64(maxInt64)/uint64(size) {
+		bytes = int64(n) * int64(size)
+	}
+	if bytes > vm.env.maxAllocated {
+		panic(vm.errAllocationLimit(atomic.LoadInt64(&vm.env.allocated)))
+	}
+	if m := atomic.AddInt64(&vm.env.allocated, bytes); m > vm.env.maxAllocated {
+		panic(vm.errAllocationLimit(atomic.AddInt64(&vm.env.allocated, -bytes)))
+	}
+}
+
+// allocAppend accounts the growth of the slice s when n elements are
+// appended to it.
+//
+// allocAppend must be called only if the allocations are accounted.
+func (vm *VM) allocAppend(s reflect.Value, n int) {
+	if n <= 0 {
+		return
+	}
+	l, c := s.Len(), s.Cap()
+	if nl := l + n; nl > c && nl > l {
+		vm.alloc(appendCap(c, nl)-c, s.Type().Elem().Size())
+	}
+}
+
 // callNative calls a native function. numVariadic is the number of variadic
 // arguments, shift is the stack shift and asGoroutine reports whether the
-// function must be started as a goroutine.
+// function must be started as a goroutine. deferred is the call frame if it
+// is a deferred call, otherwise it is nil.
 //
-// When callNative is called, vm.pc must be the address of the call
-// instruction plus one.
-func (vm *VM) callNative(fn *NativeFunction, numVariadic int8, shift StackShift, asGoroutine bool) {
-
-	if fn.value.IsNil() {
+// When callNative is called, if the call is not deferred, vm.pc must be the
+// address of the call instruction plus one.
+func (vm *VM) callNative(fn *NativeFunction, numVariadic int8, shift StackShift, asGoroutine bool, deferred *callFrame) {
+
+	// A stub cannot be called as a goroutine, and the arguments of a call
+	// made with a stub cannot be checked, so in these cases the function is
+	// called with reflect.
+	useStub := fn.stub != nil && !asGoroutine && vm.env.onNativeCall == nil
+
+	if fn.receiver != nil {
+		// It is a method that has a stub.
+		if !useStub {
+			fn = fn.reflectMethod()
+		}
+	} else if fn.value.IsNil() {
 		panic(errNilPointer)
 	}
 
+	// Charge the cost of the call.
+	if vm.env.limited && vm.env.nativeCallCost != nil {
+		if cost := vm.env.nativeCallCost(fn.pkg, fn.name); cost > 0 {
+			if atomic.AddInt64(&vm.env.fuel, -cost) < 0 {
+				panic(vm.errInstructionLimit(vm.pc - 1))
+			}
+		}
+	}
+
 	// Make a copy of the frame pointer.
 	fp := vm.fp
 
@@ -273,8 +575,26 @@ func (vm *VM) callNative(fn *NativeFunction, numVariadic int8, shift StackShift,
 	vm.fp[2] += Addr(shift[2])
 	vm.fp[3] += Addr(shift[3])
 
+	// Call the function with its stub.
+	if useStub {
+		vm.stubRegs.Receiver = fn.receiver
+		if fn.methodExpr {
+			vm.stubRegs.Receiver = vm.regs.general[vm.fp[3]+1+Addr(fn.outOff[3])].Interface()
+		}
+		vm.stubRegs.Int = vm.regs.int[vm.fp[0]+1:]
+		vm.stubRegs.Float = vm.regs.float[vm.fp[1]+1:]
+		vm.stubRegs.String = vm.regs.string[vm.fp[2]+1:]
+		fn.stub(&vm.stubRegs)
+		vm.stubRegs.Receiver = nil
+		vm.fp = fp
+		return
+	}
+
 	// Call the function without the reflect.
 	if !fn.reflectCall {
+		if vm.env.onNativeCall != nil {
+			vm.checkNativeCall(fn, vm.nativeArgs(fn), deferred)
+		}
 		if asGoroutine {
 			switch f := fn.function.(type) {
 			case func(string) int:
@@ -355,32 +675,32 @@ func (vm *VM) callNative(fn *NativeFunction, numVariadic int8, shift StackShift,
 				switch k {
 				case reflect.Bool:
 					for j := 0; j < int(numVariadic); j++ {
-						slice.Index(j).SetBool(vm.bool(int8(j + 1)))
+						slice.Index(j).SetBool(vm.bool(int16(j + 1)))
 					}
 				case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 					for j := 0; j < int(numVariadic); j++ {
-						slice.Index(j).SetInt(vm.int(int8(j + 1)))
+						slice.Index(j).SetInt(vm.int(int16(j + 1)))
 					}
 				case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 					for j := 0; j < int(numVariadic); j++ {
-						slice.Index(j).SetUint(uint64(vm.int(int8(j + 1))))
+						slice.Index(j).SetUint(uint64(vm.int(int16(j + 1))))
 					}
 				case reflect.Float32, reflect.Float64:
 					for j := 0; j < int(numVariadic); j++ {
-						slice.Index(j).SetFloat(vm.float(int8(j + 1)))
+						slice.Index(j).SetFloat(vm.float(int16(j + 1)))
 					}
 				case reflect.Func:
 					for j := 0; j < int(numVariadic); j++ {
-						f := vm.general(int8(j + 1)).Interface().(*callable)
+						f := vm.general(int16(j + 1)).Interface().(*callable)
 						slice.Index(j).Set(f.Value(vm.renderer, vm.env))
 					}
 				case reflect.String:
 					for j := 0; j < int(numVariadic); j++ {
-						slice.Index(j).SetString(vm.string(int8(j + 1)))
+						slice.Index(j).SetString(vm.string(int16(j + 1)))
 					}
 				case reflect.Interface:
 					for j := 0; j < int(numVariadic); j++ {
-						if v := vm.general(int8(j + 1)); !v.IsValid() {
+						if v := vm.general(int16(j + 1)); !v.IsValid() {
 							if t := slice.Index(j).Type(); t == emptyInterfaceType {
 								slice.Index(j).Set(emptyInterfaceNil)
 							} else {
@@ -392,7 +712,7 @@ func (vm *VM) callNative(fn *NativeFunction, numVariadic int8, shift StackShift,
 					}
 				default:
 					for j := 0; j < int(numVariadic); j++ {
-						slice.Index(j).Set(vm.general(int8(j + 1)))
+						slice.Index(j).Set(vm.general(int16(j + 1)))
 					}
 				}
 				args[i].Set(slice)
@@ -407,6 +727,17 @@ func (vm *VM) callNative(fn *NativeFunction, numVariadic int8, shift StackShift,
 
 	}
 
+	if vm.env.onNativeCall != nil {
+		in := make([]interface{}, 0, len(args))
+		for i, arg := range args {
+			if i < 2 && typ.In(i) == envType {
+				continue
+			}
+			in = append(in, arg.Interface())
+		}
+		vm.checkNativeCall(fn, in, deferred)
+	}
+
 	if asGoroutine {
 
 		// Start a goroutine.
@@ -441,6 +772,54 @@ func (vm *VM) callNative(fn *NativeFunction, numVariadic int8, shift StackShift,
 	return
 }
 
+// nativeArgs returns the arguments of a call to the native function fn that
+// can be called without the reflect.
+func (vm *VM) nativeArgs(fn *NativeFunction) []interface{} {
+	switch fn.function.(type) {
+	case func(string) int:
+		return []interface{}{vm.string(1)}
+	case func(string) string:
+		return []interface{}{vm.string(2)}
+	case func(string, string) int, func(string, string) bool:
+		return []interface{}{vm.string(1), vm.string(2)}
+	case func(string, int) string:
+		return []interface{}{vm.string(2), int(vm.int(1))}
+	}
+	panic("unexpected")
+}
+
+// checkNativeCall calls the function set with SetOnNativeCall for a call to
+// fn with arguments args. deferred is the call frame if it is a deferred
+// call, otherwise it is nil. If the function returns an error,
+// checkNativeCall panics with a *NativeCallDeniedError error.
+func (vm *VM) checkNativeCall(fn *NativeFunction, args []interface{}, deferred *callFrame) {
+	if fn.rcvArg {
+		// The receiver is not an argument of the call.
+		args = args[1:]
+	}
+	var path string
+	var pos Position
+	if deferred != nil {
+		// The position is the position of the defer statement.
+		path, pos = deferred.deferFn.position(deferred.pc)
+	} else {
+		path, pos = vm.position(vm.pc - 1)
+	}
+	call := NativeCall{
+		Package:  fn.pkg,
+		Name:     fn.name,
+		Receiver: fn.rcvType,
+		Method:   fn.method,
+		Args:     args,
+		Path:     path,
+		Position: pos,
+	}
+	if err := vm.env.onNativeCall(call); err != nil {
+		panic(&NativeCallDeniedError{pkg: fn.pkg, name: fn.name, receiver: fn.rcvType, method: fn.method,
+			path: path, position: pos, err: err})
+	}
+}
+
 // equals reports whether x and y are equal.
 // It panics if x and y are not comparable.
 //
@@ -487,7 +866,7 @@ func (vm *VM) fieldByIndex(s reflect.Value, i uint8) reflect.Value {
 	return v
 }
 
-func (vm *VM) finalize(regs [][2]int8) {
+func (vm *VM) finalize(regs [][2]int16) {
 	for _, reg := range regs {
 		vm.setFromReflectValue(reg[1], vm.generalIndirect(reg[0]))
 	}
@@ -593,6 +972,11 @@ func (vm *VM) nextCall() bool {
 			if call.cl.fn != nil {
 				vm.calls = vm.calls[:i]
 				vm.fp = call.fp
+				vm.growStack(call.cl.fn)
+				if call.cl.recv.IsValid() {
+					// A deferred call of a method value is started.
+					vm.insertReceiver(call.cl.fn, call.cl.recv)
+				}
 				vm.pc = call.pc
 				vm.fn = call.cl.fn
 				vm.vars = call.cl.vars
@@ -600,7 +984,7 @@ func (vm *VM) nextCall() bool {
 				return true
 			}
 			vm.fp = call.fp
-			vm.callNative(call.cl.Native(), call.numVariadic, StackShift{}, false)
+			vm.callNative(call.cl.Native(), call.numVariadic, StackShift{}, false, &call)
 		}
 	}
 	return false
@@ -629,15 +1013,20 @@ func create(env *env) *VM {
 func (vm *VM) startGoroutine() bool {
 	var fn *Function
 	var vars []reflect.Value
-	call := vm.fn.Body[vm.pc]
+	pc := vm.pc
+	if vm.fn.Body[pc].Op == OpWide {
+		pc++
+	}
+	call := vm.fn.Body[pc]
+	a, _, _ := vm.operands(pc)
 	switch call.Op {
 	case OpCallFunc:
-		fn = vm.fn.Functions[uint8(call.A)]
+		fn = vm.fn.Functions[uint16(a)]
 		vars = vm.env.globals
 	case OpCallIndirect:
-		f := vm.general(call.A).Interface().(*callable)
+		f := vm.general(a).Interface().(*callable)
 		if f.fn == nil {
-			if f.native.value.IsNil() {
+			if f.native.receiver == nil && f.native.value.IsNil() {
 				panic(errors.New("fatal error: go of nil func value"))
 			}
 			return true
@@ -648,17 +1037,81 @@ func (vm *VM) startGoroutine() bool {
 		return true
 	}
 	nvm := create(vm.env)
-	vm.pc++
-	off := vm.fn.Body[vm.pc]
-	copy(nvm.regs.int, vm.regs.int[vm.fp[0]+Addr(off.Op):vm.fp[0]+127])
-	copy(nvm.regs.float, vm.regs.float[vm.fp[1]+Addr(off.A):vm.fp[1]+127])
-	copy(nvm.regs.string, vm.regs.string[vm.fp[2]+Addr(off.B):vm.fp[2]+127])
-	copy(nvm.regs.general, vm.regs.general[vm.fp[3]+Addr(off.C):vm.fp[3]+127])
+	nvm.growStack(fn)
+	off, n := decodeStackShift(vm.fn.Body, pc+1)
+	// end returns the end, in the stack of type t, of the registers of fn.
+	end := func(t int) Addr {
+		e := vm.fp[t] + Addr(off[t]) + Addr(fn.NumReg[t]) + 1
+		if e > vm.st[t] {
+			e = vm.st[t]
+		}
+		return e
+	}
+	copy(nvm.regs.int, vm.regs.int[vm.fp[0]+Addr(off[0]):end(0)])
+	copy(nvm.regs.float, vm.regs.float[vm.fp[1]+Addr(off[1]):end(1)])
+	copy(nvm.regs.string, vm.regs.string[vm.fp[2]+Addr(off[2]):end(2)])
+	copy(nvm.regs.general, vm.regs.general[vm.fp[3]+Addr(off[3]):end(3)])
+	if call.Op == OpCallIndirect {
+		if f := vm.general(a).Interface().(*callable); f.recv.IsValid() {
+			nvm.insertReceiver(fn, f.recv)
+		}
+	}
 	go nvm.runFunc(fn, vars)
-	vm.pc++
+	vm.pc = pc + 1 + n
 	return false
 }
 
+// growStack grows the stacks, if necessary, so that they can hold the
+// registers of fn starting from the current frame pointers.
+func (vm *VM) growStack(fn *Function) {
+	for vm.fp[0]+Addr(fn.NumReg[0]) >= vm.st[0] {
+		vm.moreIntStack()
+	}
+	for vm.fp[1]+Addr(fn.NumReg[1]) >= vm.st[1] {
+		vm.moreFloatStack()
+	}
+	for vm.fp[2]+Addr(fn.NumReg[2]) >= vm.st[2] {
+		vm.moreStringStack()
+	}
+	for vm.fp[3]+Addr(fn.NumReg[3]) >= vm.st[3] {
+		vm.moreGeneralStack()
+	}
+}
+
+// operands returns the operands of the instruction at address addr of the
+// running function, extended with the high bytes of its OpWide prefix if it
+// has one.
+func (vm *VM) operands(addr Addr) (a, b, c int16) {
+	in := vm.fn.Body[addr]
+	a, b, c = int16(in.A), int16(in.B), int16(in.C)
+	if addr > 0 {
+		if w := vm.fn.Body[addr-1]; w.Op == OpWide {
+			a = int16(w.A)<<8 | int16(uint8(in.A))
+			b = int16(w.B)<<8 | int16(uint8(in.B))
+			c = int16(w.C)<<8 | int16(uint8(in.C))
+		}
+	}
+	return a, b, c
+}
+
+// instrAddr returns the address of the instruction at the current program
+// counter, skipping its OpWide prefix if it has one.
+func (vm *VM) instrAddr() Addr {
+	if vm.fn.Body[vm.pc].Op == OpWide {
+		return vm.pc + 1
+	}
+	return vm.pc
+}
+
+// skip skips the next instruction, along with its OpWide prefix if it has
+// one.
+func (vm *VM) skip() {
+	if vm.fn.Body[vm.pc].Op == OpWide {
+		vm.pc++
+	}
+	vm.pc++
+}
+
 // swapStack swaps the stacks pointed by a and b. bSize is the size of the
 // stack pointed by b. The stacks must be consecutive and a must precede b.
 //
@@ -670,7 +1123,7 @@ func (vm *VM) swapStack(a, b *[4]Addr, bSize StackShift) {
 	bs := Addr(bSize[0])
 	if as > 0 && bs > 0 {
 		tot := as + bs
-		if a[0]+tot+bs > vm.st[0] {
+		for a[0]+tot+bs > vm.st[0] {
 			vm.moreIntStack()
 		}
 		s := vm.regs.int[a[0]+1:]
@@ -685,7 +1138,7 @@ func (vm *VM) swapStack(a, b *[4]Addr, bSize StackShift) {
 	bs = Addr(bSize[1])
 	if as > 0 && bs > 0 {
 		tot := as + bs
-		if a[1]+tot+bs > vm.st[1] {
+		for a[1]+tot+bs > vm.st[1] {
 			vm.moreFloatStack()
 		}
 		s := vm.regs.float[a[1]+1:]
@@ -700,7 +1153,7 @@ func (vm *VM) swapStack(a, b *[4]Addr, bSize StackShift) {
 	bs = Addr(bSize[2])
 	if as > 0 && bs > 0 {
 		tot := as + bs
-		if a[2]+tot+bs > vm.st[2] {
+		for a[2]+tot+bs > vm.st[2] {
 			vm.moreStringStack()
 		}
 		s := vm.regs.string[a[2]+1:]
@@ -715,7 +1168,7 @@ func (vm *VM) swapStack(a, b *[4]Addr, bSize StackShift) {
 	bs = Addr(bSize[3])
 	if as > 0 && bs > 0 {
 		tot := as + bs
-		if a[3]+tot+bs > vm.st[3] {
+		for a[3]+tot+bs > vm.st[3] {
 			vm.moreGeneralStack()
 		}
 		s := vm.regs.general[a[3]+1:]
@@ -748,6 +1201,12 @@ type NativeFunction struct {
 	value       reflect.Value // reflect value.
 	reflectCall bool          // reports whether it can be called only with reflect.
 	argsPool    *sync.Pool    // pool of arguments for reflect.Call and reflect.CallSlice.
+	stub        native.Stub   // stub, if it has been registered.
+	methodExpr  bool          // reports whether stub is called with the first argument as receiver.
+	receiver    interface{}   // receiver, if it is a method that has a stub.
+	rcvType     reflect.Type  // receiver type, if it is a method.
+	method      string        // method name, if it is a method.
+	rcvArg      bool          // reports whether the receiver of the method is passed as first argument.
 }
 
 // NewNativeFunction returns a new native function given its package and name
@@ -779,6 +1238,14 @@ func NewNativeFunction(pkg, name string, function interface{}) *NativeFunction {
 	case func(string, string) bool:
 	default:
 		fn.reflectCall = true
+		fn.stub = native.FuncStub(fn.value)
+		// A method expression can be called with the stub of the method
+		// only if the receiver is passed in a general register, as the
+		// stub does not read it from the other registers.
+		if fn.stub == nil && typ.NumIn() > 0 && kindToType[typ.In(0).Kind()] == generalRegister {
+			fn.stub = native.MethodExprStub(fn.value)
+			fn.methodExpr = fn.stub != nil
+		}
 		if numIn := typ.NumIn(); numIn > 0 {
 			fn.argsPool = &sync.Pool{
 				New: func() interface{} {
@@ -795,6 +1262,34 @@ func NewNativeFunction(pkg, name string, function interface{}) *NativeFunction {
 	return fn
 }
 
+// NewNativeMethod returns a new native function for the method with the
+// given name of the receiver type rcv, given the function value, or its
+// reflect value, that is called with the receiver as first argument.
+func NewNativeMethod(rcv reflect.Type, method string, function interface{}) *NativeFunction {
+	fn := NewNativeFunction("", "", function)
+	fn.rcvType = rcv
+	fn.method = method
+	fn.rcvArg = true
+	return fn
+}
+
+// newNativeMethod returns a new native function for the method value of the
+// method with the given name of the receiver rcv, that is called with the
+// stub stub. As for the other function values, its package and name are
+// empty.
+func newNativeMethod(rcv reflect.Value, method string, stub native.Stub) *NativeFunction {
+	return &NativeFunction{stub: stub, receiver: rcv.Interface(), rcvType: rcv.Type(), method: method}
+}
+
+// reflectMethod returns a native function, that can be called with reflect,
+// for the method of fn that has a stub.
+func (fn *NativeFunction) reflectMethod() *NativeFunction {
+	m := NewNativeFunction("", "", reflect.ValueOf(fn.receiver).MethodByName(fn.method))
+	m.rcvType = fn.rcvType
+	m.method = fn.method
+	return m
+}
+
 func (fn *NativeFunction) Package() string {
 	return fn.pkg
 }
@@ -807,18 +1302,53 @@ func (fn *NativeFunction) Func() interface{} {
 	return fn.function
 }
 
+// Receiver returns the receiver type, if fn is a method, otherwise it
+// returns nil.
+func (fn *NativeFunction) Receiver() reflect.Type {
+	return fn.rcvType
+}
+
+// Method returns the method name, if fn is a method.
+func (fn *NativeFunction) Method() string {
+	return fn.method
+}
+
+// qualifiedName returns the name of fn qualified by its package name, as
+// "strings.Index". If fn has no name, it returns the name of the Go
+// function.
+func (fn *NativeFunction) qualifiedName() string {
+	if fn.receiver != nil {
+		t := reflect.TypeOf(fn.receiver)
+		if t.Kind() == reflect.Ptr {
+			return "(" + t.String() + ")." + fn.method
+		}
+		return t.String() + "." + fn.method
+	}
+	if fn.name == "" {
+		if f := runtime.FuncForPC(fn.value.Pointer()); f != nil {
+			return f.Name()
+		}
+		return "???"
+	}
+	if fn.pkg == "" {
+		return fn.name
+	}
+	return packageName(fn.pkg) + "." + fn.name
+}
+
 // Function represents a function.
 type Function struct {
 	Pkg             string
 	Name            string
 	File            string
 	Pos             *Position // position of the function declaration.
+	BodyPos         *Position // position of the function body, used by the code coverage.
 	Type            reflect.Type
 	Parent          *Function
 	VarRefs         []int16
 	Types           []reflect.Type
-	NumReg          [4]int8
-	FinalRegs       [][2]int8 // [indirect -> return parameter registers]
+	NumReg          [4]int16
+	FinalRegs       [][2]int16 // [indirect -> return parameter registers]
 	Macro           bool
 	Format          ast.Format
 	Values          Registers
@@ -828,6 +1358,19 @@ type Function struct {
 	Body            []Instruction
 	Text            [][]byte
 	InstructionInfo map[Addr]InstructionInfo
+	Vars            []VarInfo     // local variables, used by debuggers.
+	UpvarNames      []string      // names of the variables referred by VarRefs, used by debuggers.
+	Inlined         []InlinedCall // inlined calls, used by debuggers; an inlined call follows the call that contains it.
+}
+
+// qualifiedName returns the name of fn qualified by its package name, as
+// "main.f". For a function literal, it returns the name of the enclosing
+// function followed by ".func", as "main.f.func".
+func (fn *Function) qualifiedName() string {
+	if fn.Name == "" && fn.Parent != nil {
+		return fn.Parent.qualifiedName() + ".func"
+	}
+	return packageName(fn.Pkg) + "." + fn.Name
 }
 
 // Position represents a source position.
@@ -851,6 +1394,72 @@ type InstructionInfo struct {
 	FuncType    reflect.Type    // type of the function that is called; only for call instructions.
 }
 
+// VarInfo describes a local variable of a function. It is used by debuggers
+// to read the values of the variables.
+type VarInfo struct {
+	Name  string       // name of the variable.
+	Type  reflect.Type // type of the variable.
+	Reg   int16        // register of the variable; negative for an indirect register.
+	Start Addr         // address of the first instruction in the scope of the variable.
+	End   Addr         // address of the first instruction after the scope of the variable.
+}
+
+// InlinedCall describes a call to a function whose body has been inlined
+// in the body of the calling function. It is used by debuggers to
+// reconstruct the frame of the called function.
+type InlinedCall struct {
+	Func     *Function // inlined function.
+	Parent   int       // index in Inlined of the inlined call that contains the call; -1 if there is none.
+	Start    Addr      // address of the first instruction of the inlined body.
+	End      Addr      // address of the first instruction after the inlined body.
+	Path     string    // path of the source file of the call.
+	Position Position  // position of the call.
+	Vars     []VarInfo // local variables of Func, with the registers and the addresses of the calling function.
+}
+
+// inlinedCalls returns the inlined calls of fn that contain the instruction
+// at address pc, starting from the innermost call.
+func (fn *Function) inlinedCalls(pc Addr) []*InlinedCall {
+	for i := len(fn.Inlined) - 1; i >= 0; i-- {
+		c := &fn.Inlined[i]
+		if pc < c.Start || pc >= c.End {
+			continue
+		}
+		calls := []*InlinedCall{c}
+		for c.Parent >= 0 {
+			c = &fn.Inlined[c.Parent]
+			calls = append(calls, c)
+		}
+		return calls
+	}
+	return nil
+}
+
+// frames returns the frames of fn, executing the instruction at address pc,
+// and of the inlined calls of fn that contain the instruction, starting from
+// the innermost inlined call. It also returns the inlined calls.
+func (fn *Function) frames(pc Addr) ([]StackFrame, []*InlinedCall) {
+	calls := fn.inlinedCalls(pc)
+	path := fn.File
+	if calls != nil {
+		path = calls[0].Func.File
+	}
+	var pos Position
+	if info, ok := fn.InstructionInfo[pc]; ok {
+		if info.Path != "" {
+			path = info.Path
+		}
+		pos = info.Position
+	}
+	frames := make([]StackFrame, len(calls)+1)
+	for i, c := range calls {
+		frames[i] = StackFrame{Func: c.Func.qualifiedName(), Macro: c.Func.Macro, Path: path, Position: pos}
+		path, pos = c.Path, c.Position
+	}
+	frames[len(calls)] = StackFrame{Func: fn.qualifiedName(), Macro: fn.Macro, Path: path, Position: pos}
+	return frames, calls
+}
+
 type Addr uint32
 
 type callStatus int8
@@ -872,6 +1481,16 @@ type callFrame struct {
 	pc          Addr       // program counter.
 	status      callStatus // status.
 	numVariadic int8       // number of variadic arguments.
+	deferFn     *Function  // function with the defer statement, if it is a deferred native call.
+}
+
+// callAddr returns the address of the call instruction of a started call.
+func (call callFrame) callAddr() Addr {
+	if call.cl.fn != nil && call.pc >= 5 && call.cl.fn.Body[call.pc-1].Op < 0 {
+		// The stack shift is stored in four instructions.
+		return call.pc - 5
+	}
+	return call.pc - 2
 }
 
 type callable struct {
@@ -879,6 +1498,7 @@ type callable struct {
 	fn     *Function       // function, if it is a Scriggo function.
 	native *NativeFunction // native function.
 	vars   []reflect.Value // non-local (global and closure) variables.
+	recv   reflect.Value   // receiver, if it is a method value of a method declared in Scriggo.
 }
 
 // Native returns the native function of a callable.
@@ -898,67 +1518,192 @@ func (c *callable) Value(renderer *renderer, env *env) reflect.Value {
 	}
 	if c.native != nil {
 		// It is a native function.
-		c.value = reflect.ValueOf(c.native.function)
+		if c.native.receiver != nil {
+			c.value = reflect.ValueOf(c.native.receiver).MethodByName(c.native.method)
+		} else {
+			c.value = reflect.ValueOf(c.native.function)
+		}
 		return c.value
 	}
 	// It is a Scriggo function.
 	fn := c.fn
 	vars := c.vars
-	c.value = reflect.MakeFunc(fn.Type, func(args []reflect.Value) []reflect.Value {
-		nvm := create(env)
-		if fn.Macro {
-			renderer = renderer.WithOut(&macroOutBuffer{})
+	typ := fn.Type
+	if recv := c.recv; recv.IsValid() {
+		// It is a method value, so the receiver is bound.
+		if st, ok := typ.(ScriggoType); ok {
+			typ = st.GoType()
 		}
-		nvm.renderer = renderer
-		nOut := fn.Type.NumOut()
-		results := make([]reflect.Value, nOut)
-		var r = [4]int8{1, 1, 1, 1}
-		for i := 0; i < nOut; i++ {
-			typ := fn.Type.Out(i)
-			results[i] = reflect.New(typ).Elem()
-			t := kindToType[typ.Kind()]
-			r[t]++
+		in := make([]reflect.Type, typ.NumIn()-1)
+		for i := range in {
+			in[i] = typ.In(i + 1)
 		}
-		for _, arg := range args {
-			t := kindToType[arg.Kind()]
-			nvm.setFromReflectValue(r[t], arg)
-			r[t]++
+		out := make([]reflect.Type, typ.NumOut())
+		for i := range out {
+			out[i] = typ.Out(i)
 		}
-		err := nvm.runFunc(fn, vars)
-		if err != nil {
-			if p, ok := err.(*PanicError); ok {
-				var msg string
-				for ; p != nil; p = p.next {
-					msg = "\n" + msg
-					if p.recovered {
-						msg = " [recovered]" + msg
-					}
-					msg = p.String() + msg
-					if p.next != nil {
-						msg = "\tpanic: " + msg
-					}
+		c.value = reflect.MakeFunc(reflect.FuncOf(in, out, typ.IsVariadic()), func(args []reflect.Value) []reflect.Value {
+			return callFunction(renderer, env, fn, vars, append([]reflect.Value{recv}, args...))
+		})
+		return c.value
+	}
+	c.value = reflect.MakeFunc(typ, func(args []reflect.Value) []reflect.Value {
+		return callFunction(renderer, env, fn, vars, args)
+	})
+	return c.value
+}
+
+// callFunction calls the Scriggo function fn, with the non-local variables
+// vars and the arguments args, in a new virtual machine with environment env
+// and returns its results.
+func callFunction(renderer *renderer, env *env, fn *Function, vars []reflect.Value, args []reflect.Value) []reflect.Value {
+	nvm := create(env)
+	if fn.Macro {
+		renderer = renderer.WithOut(&macroOutBuffer{})
+	}
+	nvm.renderer = renderer
+	nOut := fn.Type.NumOut()
+	results := make([]reflect.Value, nOut)
+	var r = [4]int16{1, 1, 1, 1}
+	for i := 0; i < nOut; i++ {
+		typ := fn.Type.Out(i)
+		if st, ok := typ.(ScriggoType); ok {
+			typ = st.GoType()
+		}
+		results[i] = reflect.New(typ).Elem()
+		t := kindToType[typ.Kind()]
+		r[t]++
+	}
+	for _, arg := range args {
+		t := kindToType[arg.Kind()]
+		nvm.setFromReflectValue(r[t], arg)
+		r[t]++
+	}
+	err := nvm.runFunc(fn, vars)
+	if err != nil {
+		if p, ok := err.(*PanicError); ok {
+			var msg string
+			for ; p != nil; p = p.next {
+				msg = "\n" + msg
+				if p.recovered {
+					msg = " [recovered]" + msg
+				}
+				msg = p.String() + msg
+				if p.next != nil {
+					msg = "\tpanic: " + msg
 				}
-				err = &fatalError{msg: msg}
 			}
-			panic(err)
+			err = &fatalError{msg: msg}
 		}
-		if fn.Macro {
-			b := renderer.Out().(*macroOutBuffer)
-			nvm.setString(1, b.String())
-			err := renderer.Close()
-			if err != nil {
-				panic(&fatalError{env: env, msg: err})
+		panic(err)
+	}
+	if fn.Macro {
+		b := renderer.Out().(*macroOutBuffer)
+		nvm.setString(1, b.String())
+		err := renderer.Close()
+		if err != nil {
+			panic(&fatalError{env: env, msg: err})
+		}
+	}
+	r = [4]int16{1, 1, 1, 1}
+	for _, result := range results {
+		t := kindToType[result.Kind()]
+		nvm.getIntoReflectValue(r[t], result, false)
+		r[t]++
+	}
+	return results
+}
+
+// scriggoMethodValue returns the method value of the method with the given
+// name of receiver, if the method has been declared in Scriggo. receiver is
+// a proxy of a value of a Scriggo type.
+func (vm *VM) scriggoMethodValue(receiver reflect.Value, name string) (*callable, bool) {
+	t, ok := vm.env.typeof(receiver).(ScriggoMethodSet)
+	if !ok {
+		return nil, false
+	}
+	fn, ptr, index, ok := t.ScriggoMethod(name)
+	if !ok {
+		return nil, false
+	}
+	recv, _ := t.Unwrap(receiver)
+	for _, i := range index {
+		if recv.Kind() == reflect.Ptr {
+			if recv.IsNil() {
+				panic(errNilPointer)
 			}
+			recv = recv.Elem()
 		}
-		r = [4]int8{1, 1, 1, 1}
-		for _, result := range results {
-			t := kindToType[result.Kind()]
-			nvm.getIntoReflectValue(r[t], result, false)
-			r[t]++
+		recv = recv.Field(i)
+	}
+	if recv.Kind() == reflect.Ptr && !ptr {
+		if recv.IsNil() {
+			panic(errNilPointer)
 		}
-		return results
-	})
-	return c.value
+		recv = recv.Elem()
+	} else if recv.Kind() != reflect.Ptr && ptr {
+		// The method is promoted through an embedded pointer, so the field
+		// is addressable.
+		recv = recv.Addr()
+	}
+	if k := recv.Kind(); k == reflect.Array || k == reflect.Struct {
+		// The receiver is evaluated and copied when the method value is
+		// evaluated.
+		v := reflect.New(recv.Type()).Elem()
+		v.Set(recv)
+		recv = v
+	}
+	return &callable{fn: fn, vars: vm.env.globals, recv: recv}, true
+}
+
+// insertReceiver inserts the receiver recv as the first input argument of
+// the method function fn, whose frame starts at the current frame pointer,
+// shifting the other input arguments of the same register type.
+func (vm *VM) insertReceiver(fn *Function, recv reflect.Value) {
+	typ := fn.Type
+	k := kindToType[typ.In(0).Kind()]
+	first := int16(1)
+	for i := 0; i < typ.NumOut(); i++ {
+		if kindToType[typ.Out(i).Kind()] == k {
+			first++
+		}
+	}
+	last := first
+	for i := 1; i < typ.NumIn(); i++ {
+		kind := typ.In(i).Kind()
+		if i == typ.NumIn()-1 && typ.IsVariadic() {
+			kind = reflect.Slice
+		}
+		if kindToType[kind] == k {
+			last++
+		}
+	}
+	for r := last; r > first; r-- {
+		switch k {
+		case intRegister:
+			vm.setInt(r, vm.int(r-1))
+		case floatRegister:
+			vm.setFloat(r, vm.float(r-1))
+		case stringRegister:
+			vm.setString(r, vm.string(r-1))
+		case generalRegister:
+			vm.setGeneral(r, vm.general(r-1))
+		}
+	}
+	vm.setFromReflectValue(first, recv)
+}
+
+// wrap wraps the value v of the Scriggo type t. If t has methods declared in
+// Scriggo, the proxy exposes the methods String and Error to Go.
+func (vm *VM) wrap(t ScriggoType, v reflect.Value) reflect.Value {
+	if ms, ok := t.(ScriggoMethodSet); ok {
+		renderer := vm.renderer
+		env := vm.env
+		return ms.WrapMethods(v, func(fn *Function, args []reflect.Value) []reflect.Value {
+			return callFunction(renderer, env, fn, env.globals, args)
+		})
+	}
+	return t.Wrap(v)
 }
 
 func packageName(pkg string) string {
@@ -1154,6 +1899,14 @@ const (
 
 	OpRange
 
+	OpRangeMapString
+
+	OpRangeSliceFloat64
+
+	OpRangeSliceInt
+
+	OpRangeSliceString
+
 	OpRangeString
 
 	OpRealImag
@@ -1209,3 +1962,13 @@ const (
 
 	OpZero
 )
+
+// OpWide is not an operation but the prefix of an instruction with operands
+// that do not fit in an int8, as the registers of a function with more than
+// 127 registers of the same type. Its A, B and C fields are the high bytes
+// of the operands of the instruction that follows.
+//
+// OpWide is negative and no k variant of an operation has its value, so an
+// OpWide prefix cannot be confused with the data, as a stack shift, that
+// follows some instructions.
+const OpWide Operation = -128
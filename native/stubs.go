@@ -0,0 +1,129 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package native
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Stub is a function that calls a native function, or a method, without
+// using reflection. It reads the arguments from the registers r and writes
+// the results to r.
+//
+// Stubs are usually generated by the 'scriggo import' command with the
+// -stubs flag, and registered with the RegisterFuncStub and
+// RegisterMethodStub functions.
+type Stub func(r *Registers)
+
+// Registers contains the arguments and the results of a call made with a
+// Stub.
+//
+// Only the values of boolean, integer, floating-point and string kinds are
+// passed in registers. Boolean and integer values are stored in Int, where a
+// boolean true is 1 and false is 0, floating-point values are stored in
+// Float and strings in String. In each of them the results come first, in
+// order, and then the arguments, in order.
+//
+// For example, for a call to a function with type
+//
+//	func(s string, n int) (string, bool)
+//
+// the argument s is in String[1], n is in Int[1] and the results must be
+// stored in String[0] and Int[0].
+type Registers struct {
+	Receiver interface{} // receiver, if it is a method.
+	Int      []int64
+	Float    []float64
+	String   []string
+}
+
+// stubFunc is the key of a function stub.
+type stubFunc struct {
+	pointer uintptr
+	typ     reflect.Type
+}
+
+// stubMethod is the key of a method stub.
+type stubMethod struct {
+	typ  reflect.Type
+	name string
+}
+
+var stubs struct {
+	sync.RWMutex
+	funcs   map[stubFunc]Stub
+	methods map[stubMethod]Stub
+	exprs   map[stubFunc]Stub
+}
+
+// RegisterFuncStub registers stub as the stub of the function fn. fn must be
+// a function declared at package level, and not a function literal or a
+// method value.
+//
+// RegisterFuncStub is usually called in an init function.
+func RegisterFuncStub(fn interface{}, stub Stub) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		panic("native: RegisterFuncStub with a non-function value")
+	}
+	stubs.Lock()
+	if stubs.funcs == nil {
+		stubs.funcs = map[stubFunc]Stub{}
+	}
+	stubs.funcs[stubFunc{v.Pointer(), v.Type()}] = stub
+	stubs.Unlock()
+}
+
+// RegisterMethodStub registers stub as the stub of the method with the given
+// name of the type typ. The receiver is passed to the stub in the Receiver
+// field of the registers, as a value of type typ.
+//
+// RegisterMethodStub is usually called in an init function.
+func RegisterMethodStub(typ reflect.Type, name string, stub Stub) {
+	m, ok := typ.MethodByName(name)
+	if !ok {
+		panic("native: RegisterMethodStub with a non-existent method " + typ.String() + "." + name)
+	}
+	stubs.Lock()
+	if stubs.methods == nil {
+		stubs.methods = map[stubMethod]Stub{}
+		stubs.exprs = map[stubFunc]Stub{}
+	}
+	stubs.methods[stubMethod{typ, name}] = stub
+	if typ.Kind() != reflect.Interface {
+		stubs.exprs[stubFunc{m.Func.Pointer(), m.Func.Type()}] = stub
+	}
+	stubs.Unlock()
+}
+
+// FuncStub returns the stub registered for the function fn, or nil if no
+// stub has been registered.
+func FuncStub(fn reflect.Value) Stub {
+	stubs.RLock()
+	stub := stubs.funcs[stubFunc{fn.Pointer(), fn.Type()}]
+	stubs.RUnlock()
+	return stub
+}
+
+// MethodStub returns the stub registered for the method with the given name
+// of the type typ, or nil if no stub has been registered.
+func MethodStub(typ reflect.Type, name string) Stub {
+	stubs.RLock()
+	stub := stubs.methods[stubMethod{typ, name}]
+	stubs.RUnlock()
+	return stub
+}
+
+// MethodExprStub returns the stub registered for the method of which fn is
+// the method expression, or nil if no stub has been registered. When the
+// stub is called, the receiver, that is the first argument of fn, must be
+// passed in the Receiver field of the registers.
+func MethodExprStub(fn reflect.Value) Stub {
+	stubs.RLock()
+	stub := stubs.exprs[stubFunc{fn.Pointer(), fn.Type()}]
+	stubs.RUnlock()
+	return stub
+}
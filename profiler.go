@@ -0,0 +1,296 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scriggo
+
+import (
+	"compress/gzip"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/open2b/scriggo/internal/runtime"
+)
+
+// Profiler collects the number of executed instructions and the elapsed time
+// of executions, per function, macro and source line. See the Profiler field
+// of RunOptions.
+//
+// The instructions and the time are collected only for the main goroutine.
+// The instructions are counted exactly, while the time is sampled every
+// millisecond, so it is approximate for short executions. The time spent in
+// a native function call, including the functions and macros it calls, is
+// attributed to the line of the call.
+//
+// A Profiler can collect the profiles of many executions, also concurrently.
+// The zero value is ready to use.
+type Profiler struct {
+	mu       sync.Mutex
+	samples  map[string]*profileSample // samples by stack.
+	start    time.Time                 // start time of the first execution.
+	duration time.Duration             // total duration of the executions.
+}
+
+// ProfileEntry represents the instructions executed and the time elapsed in
+// a function, macro or line, excluding the called functions and macros.
+type ProfileEntry struct {
+	Func         string        // function or macro name qualified by the package name.
+	Path         string        // path of the file.
+	Line         int           // line in the file; zero for a function or macro.
+	Instructions int64         // number of executed instructions.
+	Time         time.Duration // elapsed time.
+}
+
+// profileSample is a sample of a Profiler.
+type profileSample struct {
+	stack        []runtime.ProfileLocation
+	instructions int64
+	time         time.Duration
+}
+
+// profiler implements the runtime.Profiler interface adding the samples to
+// a Profiler.
+type profiler struct {
+	p *Profiler
+}
+
+func (p profiler) Add(samples []runtime.ProfileSample, duration time.Duration) {
+	p.p.add(samples, duration)
+}
+
+// add adds the samples of an execution with the given duration.
+func (p *Profiler) add(samples []runtime.ProfileSample, duration time.Duration) {
+	p.mu.Lock()
+	if p.samples == nil {
+		p.samples = map[string]*profileSample{}
+		p.start = time.Now().Add(-duration)
+	}
+	for _, s := range samples {
+		key := stackKey(s.Stack)
+		sample, ok := p.samples[key]
+		if !ok {
+			sample = &profileSample{stack: s.Stack}
+			p.samples[key] = sample
+		}
+		sample.instructions += s.Instructions
+		sample.time += s.Time
+	}
+	p.duration += duration
+	p.mu.Unlock()
+}
+
+// Functions returns the profile entries of the functions and macros, sorted
+// by time in descending order.
+func (p *Profiler) Functions() []ProfileEntry {
+	return p.entries(false)
+}
+
+// Lines returns the profile entries of the lines, sorted by time in
+// descending order.
+func (p *Profiler) Lines() []ProfileEntry {
+	return p.entries(true)
+}
+
+// entries returns the profile entries of the functions or, if lines is
+// true, of the lines.
+func (p *Profiler) entries(lines bool) []ProfileEntry {
+	p.mu.Lock()
+	index := map[ProfileEntry]int{}
+	var entries []ProfileEntry
+	for _, s := range p.samples {
+		loc := s.stack[0]
+		key := ProfileEntry{Func: loc.Func, Path: loc.Path}
+		if lines {
+			key.Line = loc.Line
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(entries)
+			index[key] = i
+			entries = append(entries, key)
+		}
+		entries[i].Instructions += s.instructions
+		entries[i].Time += s.time
+	}
+	p.mu.Unlock()
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Time != b.Time {
+			return a.Time > b.Time
+		}
+		if a.Func != b.Func {
+			return a.Func < b.Func
+		}
+		return a.Line < b.Line
+	})
+	return entries
+}
+
+// WriteProfile writes the collected profile to w in the gzip-compressed
+// protocol buffer format of pprof, so that it can be read by the 'go tool
+// pprof' command. The samples have two values, the number of executed
+// instructions and the elapsed time in nanoseconds.
+func (p *Profiler) WriteProfile(w io.Writer) error {
+
+	p.mu.Lock()
+	keys := make([]string, 0, len(p.samples))
+	for key := range p.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b protoBuffer
+	stringIndex := map[string]int64{"": 0}
+	stringTable := []string{""}
+	str := func(s string) int64 {
+		i, ok := stringIndex[s]
+		if !ok {
+			i = int64(len(stringTable))
+			stringIndex[s] = i
+			stringTable = append(stringTable, s)
+		}
+		return i
+	}
+	valueType := func(typ, unit string) func(*protoBuffer) {
+		return func(b *protoBuffer) {
+			b.int64(1, str(typ))
+			b.int64(2, str(unit))
+		}
+	}
+
+	// Sample types.
+	b.message(1, valueType("instructions", "count"))
+	b.message(1, valueType("time", "nanoseconds"))
+
+	// Samples, locations and functions.
+	type funcKey struct{ name, path string }
+	funcIDs := map[funcKey]uint64{}
+	locIDs := map[runtime.ProfileLocation]uint64{}
+	var functions, locations protoBuffer
+	for _, key := range keys {
+		s := p.samples[key]
+		ids := make([]uint64, len(s.stack))
+		for i, loc := range s.stack {
+			id, ok := locIDs[loc]
+			if !ok {
+				fk := funcKey{loc.Func, loc.Path}
+				fid, ok := funcIDs[fk]
+				if !ok {
+					fid = uint64(len(funcIDs) + 1)
+					funcIDs[fk] = fid
+					functions.message(5, func(b *protoBuffer) {
+						b.uint64(1, fid)
+						b.int64(2, str(loc.Func))
+						b.int64(3, str(loc.Func))
+						b.int64(4, str(loc.Path))
+						b.int64(5, int64(loc.Decl))
+					})
+				}
+				id = uint64(len(locIDs) + 1)
+				locIDs[loc] = id
+				line := int64(loc.Line)
+				locations.message(4, func(b *protoBuffer) {
+					b.uint64(1, id)
+					b.message(4, func(b *protoBuffer) {
+						b.uint64(1, fid)
+						b.int64(2, line)
+					})
+				})
+			}
+			ids[i] = id
+		}
+		b.message(2, func(b *protoBuffer) {
+			b.packed(1, ids)
+			b.packed(2, []uint64{uint64(s.instructions), uint64(s.time)})
+		})
+	}
+	b.b = append(b.b, locations.b...)
+	b.b = append(b.b, functions.b...)
+
+	// Time, duration and period.
+	var start time.Time
+	if p.samples != nil {
+		start = p.start
+	}
+	duration := p.duration
+	p.mu.Unlock()
+	for _, s := range stringTable {
+		b.string(6, s)
+	}
+	if !start.IsZero() {
+		b.int64(9, start.UnixNano())
+	}
+	b.int64(10, int64(duration))
+	b.message(11, valueType("time", "nanoseconds"))
+	b.int64(12, 1)
+
+	zw := gzip.NewWriter(w)
+	_, err := zw.Write(b.b)
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// stackKey returns a key that identifies a stack of a profile sample.
+func stackKey(stack []runtime.ProfileLocation) string {
+	var b []byte
+	for _, loc := range stack {
+		b = append(b, loc.Func...)
+		b = append(b, 0)
+		b = append(b, loc.Path...)
+		b = append(b, 0)
+		b = appendUvarint(b, uint64(loc.Line))
+	}
+	return string(b)
+}
+
+// protoBuffer is a buffer used to encode a protocol buffer message.
+type protoBuffer struct {
+	b []byte
+}
+
+// uint64 encodes a varint field.
+func (b *protoBuffer) uint64(field int, x uint64) {
+	b.b = appendUvarint(b.b, uint64(field)<<3)
+	b.b = appendUvarint(b.b, x)
+}
+
+// int64 encodes a varint field.
+func (b *protoBuffer) int64(field int, x int64) {
+	b.uint64(field, uint64(x))
+}
+
+// string encodes a string field.
+func (b *protoBuffer) string(field int, s string) {
+	b.b = appendUvarint(b.b, uint64(field)<<3|2)
+	b.b = appendUvarint(b.b, uint64(len(s)))
+	b.b = append(b.b, s...)
+}
+
+// packed encodes a packed repeated varint field.
+func (b *protoBuffer) packed(field int, xs []uint64) {
+	var p []byte
+	for _, x := range xs {
+		p = appendUvarint(p, x)
+	}
+	b.string(field, string(p))
+}
+
+// message encodes a message field whose fields are encoded by f.
+func (b *protoBuffer) message(field int, f func(*protoBuffer)) {
+	var m protoBuffer
+	f(&m)
+	b.string(field, string(m.b))
+}
+
+// appendUvarint appends the varint encoding of x to b.
+func appendUvarint(b []byte, x uint64) []byte {
+	for x >= 0x80 {
+		b = append(b, byte(x)|0x80)
+		x >>= 7
+	}
+	return append(b, byte(x))
+}
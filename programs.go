@@ -5,10 +5,14 @@
 package scriggo
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"io/fs"
 	"reflect"
+	"sync"
 
 	"github.com/open2b/scriggo/ast"
 	"github.com/open2b/scriggo/internal/compiler"
@@ -47,12 +51,72 @@ type BuildOptions struct {
 	//
 	// Used for templates only.
 	Globals native.Declarations
+
+	// MaxErrors is the maximum number of errors reported when the build
+	// fails. If it is zero, only the first error is reported and the
+	// returned error is a *BuildError value. If it is negative, all errors
+	// are reported. If more than one error is reported, the returned error is
+	// a BuildErrors value, with the first errors in order of path and
+	// position, and with only one error for each position.
+	MaxErrors int
+
+	// Optimize, when true, optimizes the bytecode of programs and templates
+	// after it has been emitted. The optimization folds constants, removes
+	// unreachable code and redundant instructions and inlines the calls to
+	// small functions and macros. It makes the build slower but can make the
+	// execution faster.
+	Optimize bool
+}
+
+// maxErrors returns the maximum number of errors to report. options can be
+// nil.
+func (options *BuildOptions) maxErrors() int {
+	if options == nil {
+		return 0
+	}
+	return options.MaxErrors
 }
 
 // PrintFunc represents a function that prints the arguments of the print and
 // println builtins.
 type PrintFunc func(interface{})
 
+// NativeCallCostFunc represents a function that returns the cost, in number
+// of instructions, of a call to the native function with the given package
+// path and name.
+type NativeCallCostFunc func(pkg, name string) int64
+
+// NativeCallFunc represents a function that is called before a call to a
+// native function. If it returns a non-nil error, the function is not called.
+type NativeCallFunc func(call NativeCall) error
+
+// NativeCall represents a call to a native function. See the OnNativeCall
+// field of RunOptions.
+type NativeCall struct {
+
+	// Package is the path of the package of the function, and Name is its
+	// name. They are empty for a function value, as a method value or a
+	// function returned by a native function.
+	Package string
+	Name    string
+
+	// Receiver is the type of the receiver and Method is the name of the
+	// method, if it is a call to a method of a native value. They are nil
+	// and empty otherwise.
+	Receiver reflect.Type
+	Method   string
+
+	// Args are the arguments of the call, excluding the native.Env argument
+	// and the receiver. The variadic arguments are in a slice as last
+	// argument.
+	Args []interface{}
+
+	// Path is the path of the file of the call and Position is its position
+	// in the file.
+	Path     string
+	Position Position
+}
+
 // RunOptions are the run options.
 type RunOptions struct {
 
@@ -65,13 +129,71 @@ type RunOptions struct {
 	// If it is nil, the print and println builtins format their arguments as
 	// expected and write the result to standard error.
 	Print PrintFunc
+
+	// MaxInstructions is the maximum number of instructions that can be
+	// executed. If it is exceeded, the execution is stopped and the Run
+	// method returns an *InstructionLimitError error. Unlike canceling the
+	// context, the limit does not depend on the running time, so a program
+	// or template without goroutines is always stopped at the same point.
+	// If it is zero, the number of instructions is not limited.
+	MaxInstructions int64
+
+	// NativeCallCost, if not nil, is called for every call to a native
+	// function and returns the cost of the call as number of instructions.
+	// It is used only if MaxInstructions is not zero.
+	NativeCallCost NativeCallCostFunc
+
+	// OnNativeCall, if not nil, is called before every call to a native
+	// function, also by the goroutines, so it can be called concurrently.
+	// If it returns a non-nil error, the function is not called, the
+	// execution is stopped and the Run method returns a
+	// *NativeCallDeniedError error that wraps the returned error.
+	OnNativeCall NativeCallFunc
+
+	// MaxAllocatedBytes is the maximum number of bytes that can be
+	// allocated by the execution. If it is exceeded, the execution is
+	// stopped and the Run method returns an *AllocationLimitError error,
+	// that reports the allocation site and the bytes allocated up to it. If
+	// it is zero, the allocations are not limited.
+	//
+	// The bytes are accounted, approximately, when a slice, a map, a string,
+	// an array or a struct is created, also by a conversion as []byte(s),
+	// and when a slice or a map grows. The bytes of the memory released are
+	// not subtracted, so it is a budget for the whole execution and not a
+	// limit on the memory in use.
+	MaxAllocatedBytes int64
+
+	// Debugger, if not nil, is called by the main goroutine on every new
+	// line to stop the execution on breakpoints and steps, and to inspect
+	// the call stack and the variables of a stopped execution.
+	Debugger Debugger
+
+	// Profiler, if not nil, collects the instructions executed and the time
+	// elapsed by the main goroutine, per function, macro and line.
+	Profiler *Profiler
+
+	// Coverage, if not nil, collects the number of times the statements and
+	// the expressions, of all the goroutines, have been executed.
+	Coverage *Coverage
 }
 
 // Program is a program compiled with the Build function.
 type Program struct {
-	fn      *runtime.Function
-	typeof  runtime.TypeOfFunc
-	globals []compiler.Global
+	fn        *runtime.Function
+	init      *runtime.Function
+	functions map[string]*runtime.Function
+	typeof    runtime.TypeOfFunc
+	globals   []compiler.Global
+	packages  []string
+	types     []reflect.Type
+	declared  []*runtime.Function
+	importer  native.Importer
+
+	// Package level variables shared by the calls of the functions
+	// returned by the Func method.
+	initMu      sync.Mutex
+	initialized bool // reports whether the initialization succeeded.
+	vars        []reflect.Value
 }
 
 // Build builds a program from the package in the root of fsys with the given
@@ -79,21 +201,114 @@ type Program struct {
 //
 // Current limitation: fsys can contain only one Go file in its root.
 //
-// If a build error occurs, it returns a *BuildError.
+// If a build error occurs, it returns a *BuildError or, if more than one
+// error occurred, a BuildErrors value.
 func Build(fsys fs.FS, options *BuildOptions) (*Program, error) {
-	co := compiler.Options{}
+	co := compiler.Options{
+		MaxErrors: options.maxErrors(),
+	}
 	if options != nil {
 		co.AllowGoStmt = options.AllowGoStmt
 		co.Importer = options.Packages
+		co.Optimize = options.Optimize
 	}
 	code, err := compiler.BuildProgram(fsys, co)
 	if err != nil {
-		if e, ok := err.(compiler.Error); ok {
-			err = &BuildError{err: e}
-		}
+		err = buildError(err)
+		return nil, err
+	}
+	return newProgram(code, co.Importer), nil
+}
+
+// ParseProgram parses the program in the root of fsys and returns its tree,
+// without type checking it. The packages of the module imported by the
+// program are parsed and their trees are assigned to the Tree fields of the
+// Import nodes. Native packages are not required.
+//
+// Current limitation: fsys can contain only one Go file in its root.
+//
+// If a syntax error occurs, it returns a *BuildError.
+func ParseProgram(fsys fs.FS) (*ast.Tree, error) {
+	tree, err := compiler.ParseProgram(fsys)
+	if err != nil {
+		err = buildError(err)
+		return nil, err
+	}
+	return tree, nil
+}
+
+// newProgram returns a new program given its code and the importer used to
+// build it.
+func newProgram(code *compiler.Code, importer native.Importer) *Program {
+	return &Program{
+		fn:        code.Main,
+		init:      code.Init,
+		functions: code.Functions,
+		typeof:    code.TypeOf,
+		globals:   code.Globals,
+		packages:  code.Packages,
+		types:     code.Types,
+		declared:  code.Declared,
+		importer:  importer,
+	}
+}
+
+// LoadProgram loads a program, read from r, previously encoded with the
+// MarshalBinary or WriteTo method of Program.
+//
+// options.Packages must provide the native packages imported by the program.
+// The native functions, variables and types used by the program are looked
+// up by package path and name, and if one of them no longer exists or its
+// type has been changed, LoadProgram returns an error. In this case, the
+// program should be built again.
+func LoadProgram(r io.Reader, options *BuildOptions) (*Program, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	co := compiler.Options{}
+	if options != nil {
+		co.Importer = options.Packages
+	}
+	code, err := compiler.Unmarshal(data, co)
+	if err != nil {
 		return nil, err
 	}
-	return &Program{fn: code.Main, globals: code.Globals, typeof: code.TypeOf}, nil
+	if code.Main.Macro {
+		return nil, errors.New("scriggo: cannot load a template as a program")
+	}
+	return newProgram(code, co.Importer), nil
+}
+
+// MarshalBinary returns the binary encoding of the program. The program can
+// be loaded with LoadProgram.
+//
+// Native functions, variables and types are encoded as references to their
+// declarations in the packages used to build the program. If the program
+// uses a native value that cannot be referenced, for example a method
+// expression of an interface type, MarshalBinary returns an error.
+func (p *Program) MarshalBinary() ([]byte, error) {
+	code := &compiler.Code{
+		Globals:   p.globals,
+		Functions: p.functions,
+		Main:      p.fn,
+		Init:      p.init,
+		Packages:  p.packages,
+		Types:     p.types,
+		Declared:  p.declared,
+	}
+	return compiler.Marshal(code, compiler.Options{Importer: p.importer})
+}
+
+// WriteTo writes the binary encoding of the program to w. It returns the
+// number of bytes written and, if occurred, the error. See MarshalBinary for
+// details.
+func (p *Program) WriteTo(w io.Writer) (int64, error) {
+	data, err := p.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+	return bytes.NewReader(data).WriteTo(w)
 }
 
 // Disassemble disassembles the package with the given path and returns its
@@ -122,6 +337,131 @@ func (p *Program) Disassemble(pkgPath string) ([]byte, error) {
 // If the context has been canceled, Run returns the error returned by the Err
 // method of the context.
 func (p *Program) Run(options *RunOptions) error {
+	vm := newVM(options, p.declared)
+	err := vm.Run(p.fn, p.typeof, initPackageLevelVariables(p.globals))
+	return convertRunError(err)
+}
+
+// Func returns the exported function with the given name declared in the
+// main package of the program. It returns an error if the program does not
+// declare such a function.
+func (p *Program) Func(name string) (*Func, error) {
+	fn, ok := p.functions[name]
+	if !ok || fn.Macro {
+		return nil, fmt.Errorf("scriggo: program does not declare function %s", name)
+	}
+	return &Func{program: p, fn: fn}, nil
+}
+
+// initVars initializes the package level variables, calling the init
+// functions, if they have not already been initialized. It returns the
+// variables and, if occurred, the initialization error.
+//
+// As the initialization can fail because of the options, for example for a
+// canceled context or an exceeded limit, an initialization error is not
+// retained, and the initialization is retried on the next call.
+func (p *Program) initVars(options *RunOptions) ([]reflect.Value, error) {
+	p.initMu.Lock()
+	defer p.initMu.Unlock()
+	if p.initialized {
+		return p.vars, nil
+	}
+	vars := initPackageLevelVariables(p.globals)
+	if p.init != nil {
+		vm := newVM(options, p.declared)
+		err := vm.Run(p.init, p.typeof, vars)
+		if err != nil {
+			return nil, convertRunError(err)
+		}
+	}
+	p.vars = vars
+	p.initialized = true
+	return vars, nil
+}
+
+// Func represents an exported function of a program. It can be called
+// multiple times, also concurrently by multiple goroutines.
+//
+// The package level variables of the program are initialized, and its init
+// functions are called, only once, the first time a function of the program
+// is called. Then the package level variables are shared by all the calls,
+// but not with the executions of the Run method.
+type Func struct {
+	program *Program
+	fn      *runtime.Function
+}
+
+// Name returns the name of the function.
+func (f *Func) Name() string {
+	return f.fn.Name
+}
+
+// Type returns the type of the function. Parameters and results with a type
+// defined in the program are represented by their underlying Go types.
+func (f *Func) Type() reflect.Type {
+	if st, ok := f.fn.Type.(runtime.ScriggoType); ok {
+		return st.GoType()
+	}
+	return f.fn.Type
+}
+
+// Call calls the function with the given arguments and waits for it to
+// complete. It returns the results of the function. If the function is
+// variadic, the last argument must be a slice with the variadic arguments,
+// as for the CallSlice method of reflect.Value.
+//
+// If the package level variables have not already been initialized, they
+// are initialized with the given options. If the initialization fails, the
+// error is returned and the initialization is retried on the next call.
+//
+// Call returns the same errors returned by the Run method of Program.
+func (f *Func) Call(args []reflect.Value, options *RunOptions) ([]reflect.Value, error) {
+	typ := f.Type()
+	if len(args) != typ.NumIn() {
+		return nil, fmt.Errorf("scriggo: %s called with %d arguments, want %d", f.fn.Name, len(args), typ.NumIn())
+	}
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		t := typ.In(i)
+		if !arg.IsValid() {
+			in[i] = reflect.Zero(t)
+			continue
+		}
+		if !arg.Type().AssignableTo(t) {
+			return nil, fmt.Errorf("scriggo: cannot use %s as type %s in argument to %s", arg.Type(), t, f.fn.Name)
+		}
+		in[i] = reflect.New(t).Elem()
+		in[i].Set(arg)
+	}
+	vars, err := f.program.initVars(options)
+	if err != nil {
+		return nil, err
+	}
+	vm := newVM(options, f.program.declared)
+	out, err := vm.Call(f.fn, f.program.typeof, vars, in)
+	return out, convertRunError(err)
+}
+
+// Value returns a function value, with the type returned by the Type method,
+// that calls the function with nil options. If the call returns an error,
+// the function value panics with the error.
+//
+// For example, to get a typed function:
+//
+//	score := f.Value().Interface().(func(int) float64)
+func (f *Func) Value() reflect.Value {
+	return reflect.MakeFunc(f.Type(), func(args []reflect.Value) []reflect.Value {
+		out, err := f.Call(args, nil)
+		if err != nil {
+			panic(err)
+		}
+		return out
+	})
+}
+
+// newVM returns a new virtual machine with the given run options. declared
+// contains the declared functions reported by the code coverage.
+func newVM(options *RunOptions, declared []*runtime.Function) *runtime.VM {
 	vm := runtime.NewVM()
 	if options != nil {
 		if options.Context != nil {
@@ -130,15 +470,63 @@ func (p *Program) Run(options *RunOptions) error {
 		if options.Print != nil {
 			vm.SetPrint(runtime.PrintFunc(options.Print))
 		}
-	}
-	err := vm.Run(p.fn, p.typeof, initPackageLevelVariables(p.globals))
-	if err != nil {
-		if p, ok := err.(*runtime.PanicError); ok {
-			err = &PanicError{p}
+		if options.MaxInstructions > 0 {
+			vm.SetMaxInstructions(options.MaxInstructions)
+			if options.NativeCallCost != nil {
+				vm.SetNativeCallCost(runtime.NativeCallCostFunc(options.NativeCallCost))
+			}
+		}
+		if options.MaxAllocatedBytes > 0 {
+			vm.SetMaxAllocatedBytes(options.MaxAllocatedBytes)
+		}
+		if options.OnNativeCall != nil {
+			vm.SetOnNativeCall(onNativeCall(options.OnNativeCall))
+		}
+		if options.Debugger != nil {
+			vm.SetDebugger(debugger{options.Debugger})
 		}
-		return err
+		if options.Profiler != nil {
+			vm.SetProfiler(profiler{options.Profiler})
+		}
+		if options.Coverage != nil {
+			vm.SetCoverage(coverage{options.Coverage}, declared)
+		}
+	}
+	return vm
+}
+
+// convertRunError converts an error returned by the Run method of a virtual
+// machine to an error returned by the Run methods of Program and Template.
+func convertRunError(err error) error {
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *runtime.PanicError:
+		return &PanicError{e}
+	case *runtime.InstructionLimitError:
+		return &InstructionLimitError{e}
+	case *runtime.AllocationLimitError:
+		return &AllocationLimitError{e}
+	case *runtime.NativeCallDeniedError:
+		return &NativeCallDeniedError{e}
+	}
+	return err
+}
+
+// onNativeCall returns a runtime.NativeCallFunc function that calls f.
+func onNativeCall(f NativeCallFunc) runtime.NativeCallFunc {
+	return func(call runtime.NativeCall) error {
+		pos := call.Position
+		return f(NativeCall{
+			Package:  call.Package,
+			Name:     call.Name,
+			Receiver: call.Receiver,
+			Method:   call.Method,
+			Args:     call.Args,
+			Path:     call.Path,
+			Position: Position{Line: pos.Line, Column: pos.Column, Start: pos.Start, End: pos.End},
+		})
 	}
-	return nil
 }
 
 // initPackageLevelVariables initializes the package level variables and
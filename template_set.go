@@ -0,0 +1,145 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scriggo
+
+import (
+	"io/fs"
+	"sync"
+)
+
+// TemplateSet is a set of templates built from the files of a file system
+// with the same build options. Templates are built the first time they are
+// requested, and then they are cached until they are invalidated.
+//
+// The methods of a TemplateSet can be called concurrently by multiple
+// goroutines.
+type TemplateSet struct {
+	fsys    fs.FS
+	options *BuildOptions
+
+	mu        sync.Mutex
+	templates map[string]*templateSetEntry
+	// dependents contains, for each file, the names of the cached templates
+	// that extend, import or render it, directly or indirectly.
+	dependents map[string]map[string]struct{}
+}
+
+// templateSetEntry is an entry of a template set. done is closed when the
+// build of the template is completed.
+type templateSetEntry struct {
+	done     chan struct{}
+	template *Template
+	err      error
+}
+
+// NewTemplateSet returns a new template set that builds the templates rooted
+// at fsys with the given options. The options must not be modified after
+// NewTemplateSet is called.
+func NewTemplateSet(fsys fs.FS, options *BuildOptions) *TemplateSet {
+	return &TemplateSet{
+		fsys:       fsys,
+		options:    options,
+		templates:  map[string]*templateSetEntry{},
+		dependents: map[string]map[string]struct{}{},
+	}
+}
+
+// Get returns the named template, building it if it is not in the set. If
+// the template is being built by another goroutine, Get waits for the build
+// to complete.
+//
+// Get returns the errors returned by BuildTemplate. If an error occurs, the
+// template is not added to the set and a later call to Get builds it again.
+func (set *TemplateSet) Get(name string) (*Template, error) {
+	set.mu.Lock()
+	entry, ok := set.templates[name]
+	if ok {
+		set.mu.Unlock()
+		<-entry.done
+		return entry.template, entry.err
+	}
+	entry = &templateSetEntry{done: make(chan struct{})}
+	set.templates[name] = entry
+	set.mu.Unlock()
+	entry.template, entry.err = BuildTemplate(set.fsys, name, set.options)
+	set.mu.Lock()
+	// Add the template only if it has been built and it has not been
+	// invalidated in the meantime.
+	if set.templates[name] == entry {
+		if entry.err == nil {
+			for _, dep := range entry.template.deps {
+				dependents, ok := set.dependents[dep.Path]
+				if !ok {
+					dependents = map[string]struct{}{}
+					set.dependents[dep.Path] = dependents
+				}
+				dependents[name] = struct{}{}
+			}
+		} else {
+			delete(set.templates, name)
+		}
+	}
+	close(entry.done)
+	set.mu.Unlock()
+	return entry.template, entry.err
+}
+
+// Invalidate removes from the set the named template and all the templates
+// that extend, import or render the named file, directly or indirectly. It
+// should be called when the named file is changed or removed.
+//
+// The templates that are being built when Invalidate is called are not added
+// to the set, because they may have read the file before it was changed.
+func (set *TemplateSet) Invalidate(name string) {
+	set.mu.Lock()
+	set.remove(name)
+	for dependent := range set.dependents[name] {
+		set.remove(dependent)
+	}
+	delete(set.dependents, name)
+	for n, entry := range set.templates {
+		select {
+		case <-entry.done:
+		default:
+			delete(set.templates, n)
+		}
+	}
+	set.mu.Unlock()
+}
+
+// InvalidateAll removes all the templates from the set.
+func (set *TemplateSet) InvalidateAll() {
+	set.mu.Lock()
+	set.templates = map[string]*templateSetEntry{}
+	set.dependents = map[string]map[string]struct{}{}
+	set.mu.Unlock()
+}
+
+// remove removes the named template from the set and from the dependents of
+// its dependencies. It must be called with set.mu held.
+func (set *TemplateSet) remove(name string) {
+	entry, ok := set.templates[name]
+	if !ok {
+		return
+	}
+	delete(set.templates, name)
+	select {
+	case <-entry.done:
+	default:
+		// The template is being built.
+		return
+	}
+	if entry.template == nil {
+		return
+	}
+	for _, dep := range entry.template.deps {
+		if dependents, ok := set.dependents[dep.Path]; ok {
+			delete(dependents, name)
+			if len(dependents) == 0 {
+				delete(set.dependents, dep.Path)
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scriggo
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/open2b/scriggo/internal/fstest"
+	"github.com/open2b/scriggo/native"
+)
+
+func TestTemplateSet(t *testing.T) {
+
+	fsys := fstest.Files{
+		"layout.html":  `<title>{{ title }}</title>{{ Body() }}`,
+		"index.html":   `{% extends "layout.html" %}{% import "macros.html" %}{% macro Body %}{{ Hello() }}{% end %}`,
+		"about.html":   `{% extends "layout.html" %}{% macro Body %}{{ render "partial.html" }}{% end %}`,
+		"macros.html":  `{% macro Hello %}hello{% end %}`,
+		"partial.html": `{% if true %}{{ render "footer.html" }}{% end %}`,
+		"footer.html":  `footer`,
+		"other.html":   `other`,
+	}
+	options := &BuildOptions{Globals: native.Declarations{"title": "Scriggo"}}
+	set := NewTemplateSet(fsys, options)
+
+	render := func(name string) string {
+		t.Helper()
+		template, err := set.Get(name)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var b strings.Builder
+		err = template.Run(&b, nil, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return b.String()
+	}
+
+	if out := render("index.html"); out != "<title>Scriggo</title>hello" {
+		t.Fatalf("unexpected output %q", out)
+	}
+	if out := render("about.html"); out != "<title>Scriggo</title>footer" {
+		t.Fatalf("unexpected output %q", out)
+	}
+	if out := render("other.html"); out != "other" {
+		t.Fatalf("unexpected output %q", out)
+	}
+
+	// Get returns the cached template.
+	t1, _ := set.Get("index.html")
+	t2, _ := set.Get("index.html")
+	if t1 != t2 {
+		t.Fatal("expected cached template")
+	}
+
+	// A file that is not a dependency does not invalidate other templates.
+	set.Invalidate("macros.txt")
+	if t3, _ := set.Get("index.html"); t3 != t1 {
+		t.Fatal("expected cached template")
+	}
+
+	// Changing a file rendered indirectly invalidates only its dependents.
+	fsys["footer.html"] = `new footer`
+	set.Invalidate("footer.html")
+	if _, ok := set.templates["about.html"]; ok {
+		t.Fatal("expected about.html to be invalidated")
+	}
+	if _, ok := set.templates["index.html"]; !ok {
+		t.Fatal("expected index.html to be cached")
+	}
+	if out := render("about.html"); out != "<title>Scriggo</title>new footer" {
+		t.Fatalf("unexpected output %q", out)
+	}
+
+	// Changing the extended file invalidates all the extending files.
+	fsys["layout.html"] = `<h1>{{ title }}</h1>{{ Body() }}`
+	set.Invalidate("layout.html")
+	for _, name := range []string{"index.html", "about.html"} {
+		if _, ok := set.templates[name]; ok {
+			t.Fatalf("expected %s to be invalidated", name)
+		}
+	}
+	if _, ok := set.templates["other.html"]; !ok {
+		t.Fatal("expected other.html to be cached")
+	}
+	if out := render("index.html"); out != "<h1>Scriggo</h1>hello" {
+		t.Fatalf("unexpected output %q", out)
+	}
+
+	// Invalidating a template removes it from the dependents.
+	set.Invalidate("index.html")
+	if _, ok := set.dependents["macros.html"]; ok {
+		t.Fatal("expected no dependents for macros.html")
+	}
+	if _, ok := set.dependents["layout.html"]["index.html"]; ok {
+		t.Fatal("expected index.html not to be a dependent of layout.html")
+	}
+
+	set.InvalidateAll()
+	if len(set.templates) != 0 || len(set.dependents) != 0 {
+		t.Fatal("expected an empty set")
+	}
+
+}
+
+func TestTemplateSetErrors(t *testing.T) {
+	fsys := fstest.Files{"index.html": `{{ a }}`}
+	set := NewTemplateSet(fsys, nil)
+	_, err := set.Get("missing.html")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected not exist error, got %v", err)
+	}
+	_, err = set.Get("index.html")
+	if _, ok := err.(*BuildError); !ok {
+		t.Fatalf("expected *BuildError, got %v", err)
+	}
+	if len(set.templates) != 0 {
+		t.Fatal("expected no templates")
+	}
+	// The template is built again.
+	fsys["index.html"] = `a`
+	if _, err = set.Get("index.html"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestTemplateSetConcurrentGet(t *testing.T) {
+	set := NewTemplateSet(fstest.Files{"index.html": `{{ 1 + 2 }}`}, nil)
+	templates := make([]*Template, 10)
+	var wg sync.WaitGroup
+	for i := range templates {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			template, err := set.Get("index.html")
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			templates[i] = template
+		}(i)
+	}
+	wg.Wait()
+	for _, template := range templates[1:] {
+		if template != templates[0] {
+			t.Fatal("expected the template to be built once")
+		}
+	}
+}
@@ -5,6 +5,7 @@
 package scriggo
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -36,15 +37,55 @@ func (format Format) String() string {
 	return ast.Format(format).String()
 }
 
+// A DependencyKind represents the kind of a dependency.
+type DependencyKind int
+
+// Dependency kinds.
+const (
+	DependencyExtends DependencyKind = iota
+	DependencyImport
+	DependencyRender
+)
+
+// String returns the name of the kind, as the keyword of the statement:
+// "extends", "import" or "render".
+func (kind DependencyKind) String() string {
+	switch kind {
+	case DependencyExtends:
+		return "extends"
+	case DependencyImport:
+		return "import"
+	case DependencyRender:
+		return "render"
+	}
+	panic("invalid dependency kind")
+}
+
+// Dependency is a reference, in a template file, to a file that it extends,
+// imports or renders.
+type Dependency struct {
+	Path     string         // path of the referenced file.
+	File     string         // path of the file that contains the reference.
+	Kind     DependencyKind // kind of the reference.
+	Position Position       // position of the reference in File.
+}
+
 // Converter is implemented by format converters.
 type Converter func(src []byte, out io.Writer) error
 
 // Template is a template compiled with the BuildTemplate function.
 type Template struct {
-	fn      *runtime.Function
-	typeof  runtime.TypeOfFunc
-	globals []compiler.Global
-	conv    runtime.Converter
+	fn       *runtime.Function
+	init     *runtime.Function
+	macros   map[string]*runtime.Function
+	typeof   runtime.TypeOfFunc
+	globals  []compiler.Global
+	conv     runtime.Converter
+	packages []string
+	importer native.Importer
+	decls    native.Declarations
+	deps     []compiler.Dependency
+	declared []*runtime.Function
 }
 
 // FormatFS is the interface implemented by a file system that can determine
@@ -90,13 +131,15 @@ var formatTypes = map[ast.Format]reflect.Type{
 // If the named file does not exist, BuildTemplate returns an error satisfying
 // errors.Is(err, fs.ErrNotExist).
 //
-// If a build error occurs, it returns a *BuildError.
+// If a build error occurs, it returns a *BuildError or, if more than one
+// error occurred, a BuildErrors value.
 func BuildTemplate(fsys fs.FS, name string, options *BuildOptions) (*Template, error) {
 	if f, ok := fsys.(FormatFS); ok {
 		fsys = formatFS{f}
 	}
 	co := compiler.Options{
 		FormatTypes: formatTypes,
+		MaxErrors:   options.maxErrors(),
 	}
 	var conv Converter
 	if options != nil {
@@ -106,16 +149,144 @@ func BuildTemplate(fsys fs.FS, name string, options *BuildOptions) (*Template, e
 		co.NoParseShortShowStmt = options.NoParseShortShowStmt
 		co.Importer = options.Packages
 		co.MDConverter = compiler.Converter(options.MarkdownConverter)
+		co.Optimize = options.Optimize
 		conv = options.MarkdownConverter
 	}
 	code, err := compiler.BuildTemplate(fsys, name, co)
 	if err != nil {
-		if e, ok := err.(compiler.Error); ok {
-			err = &BuildError{err: e}
-		}
+		err = buildError(err)
+		return nil, err
+	}
+	return newTemplate(code, co, conv), nil
+}
+
+// ParseOptions contains options for parsing templates.
+type ParseOptions struct {
+
+	// NoParseShortShowStmt, when true, don't parse the short show statements.
+	NoParseShortShowStmt bool
+
+	// NoExpand, when true, the extended, imported and rendered files are not
+	// parsed and the Tree fields of the Extends, Import and Render nodes are
+	// nil.
+	NoExpand bool
+}
+
+// ParseTemplate parses the named template file rooted at the given file
+// system and returns its tree, without type checking it. Extended, imported
+// and rendered files are read from fsys and their trees are assigned to the
+// Tree fields of the Extends, Import and Render nodes, unless
+// options.NoExpand is true.
+//
+// File formats are determined as for BuildTemplate. The returned tree is not
+// shared, so it can be modified by the caller.
+//
+// If the named file does not exist, ParseTemplate returns an error
+// satisfying errors.Is(err, fs.ErrNotExist).
+//
+// If a syntax error occurs, it returns a *BuildError.
+func ParseTemplate(fsys fs.FS, name string, options *ParseOptions) (*ast.Tree, error) {
+	if f, ok := fsys.(FormatFS); ok {
+		fsys = formatFS{f}
+	}
+	var noParseShow, noExpand bool
+	if options != nil {
+		noParseShow = options.NoParseShortShowStmt
+		noExpand = options.NoExpand
+	}
+	tree, err := compiler.ParseTemplate(fsys, name, noParseShow, noExpand)
+	if err != nil {
+		err = buildError(err)
+		return nil, err
+	}
+	return tree, nil
+}
+
+// newTemplate returns a new template given its code, the options used to
+// build it and the Markdown converter.
+func newTemplate(code *compiler.Code, co compiler.Options, conv Converter) *Template {
+	return &Template{
+		fn:       code.Main,
+		init:     code.Init,
+		macros:   code.Functions,
+		typeof:   code.TypeOf,
+		globals:  code.Globals,
+		conv:     runtime.Converter(conv),
+		packages: code.Packages,
+		importer: co.Importer,
+		decls:    co.Globals,
+		deps:     code.Dependencies,
+		declared: code.Declared,
+	}
+}
+
+// LoadTemplate loads a template, read from r, previously encoded with the
+// MarshalBinary or WriteTo method of Template.
+//
+// options.Packages and options.Globals must provide the native packages and
+// the globals used by the template, and options.MarkdownConverter is used as
+// Markdown converter. The native functions, variables and types used by the
+// template are looked up by package path and name, and if one of them no
+// longer exists or its type has been changed, LoadTemplate returns an error.
+// In this case, the template should be built again.
+func LoadTemplate(r io.Reader, options *BuildOptions) (*Template, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	co := compiler.Options{
+		FormatTypes: formatTypes,
+	}
+	var conv Converter
+	if options != nil {
+		co.Globals = options.Globals
+		co.Importer = options.Packages
+		conv = options.MarkdownConverter
+	}
+	code, err := compiler.Unmarshal(data, co)
+	if err != nil {
 		return nil, err
 	}
-	return &Template{fn: code.Main, typeof: code.TypeOf, globals: code.Globals, conv: runtime.Converter(conv)}, nil
+	if !code.Main.Macro {
+		return nil, errors.New("scriggo: cannot load a program as a template")
+	}
+	return newTemplate(code, co, conv), nil
+}
+
+// MarshalBinary returns the binary encoding of the template. The template can
+// be loaded with LoadTemplate.
+//
+// Native functions, variables and types are encoded as references to their
+// declarations in the packages and in the globals used to build the template.
+// If the template uses a native value that cannot be referenced, for example
+// a method expression of an interface type, MarshalBinary returns an error.
+func (t *Template) MarshalBinary() ([]byte, error) {
+	code := &compiler.Code{
+		Main:         t.fn,
+		Init:         t.init,
+		Functions:    t.macros,
+		Globals:      t.globals,
+		Packages:     t.packages,
+		Dependencies: t.deps,
+		Declared:     t.declared,
+	}
+	co := compiler.Options{
+		FormatTypes: formatTypes,
+		Globals:     t.decls,
+		Importer:    t.importer,
+	}
+	return compiler.Marshal(code, co)
+}
+
+// WriteTo writes the binary encoding of the template to w. It returns the
+// number of bytes written and, if occurred, the error. See MarshalBinary for
+// details.
+func (t *Template) WriteTo(w io.Writer) (int64, error) {
+	data, err := t.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+	return bytes.NewReader(data).WriteTo(w)
 }
 
 // Run runs the template and write the rendered code to out. vars contains
@@ -141,24 +312,66 @@ func (t *Template) Run(out io.Writer, vars map[string]interface{}, options *RunO
 	if out == nil {
 		return errors.New("invalid nil out")
 	}
-	vm := runtime.NewVM()
-	if options != nil {
-		if options.Context != nil {
-			vm.SetContext(options.Context)
+	vm := newVM(options, t.declared)
+	vm.SetRenderer(out, t.conv)
+	err := vm.Run(t.fn, t.typeof, initGlobalVariables(t.globals, vars))
+	return convertRunError(err)
+}
+
+// RunMacro runs the named macro, declared in the file of the template, and
+// writes the rendered code to out. args contains the arguments of the macro
+// and vars contains the values of the global variables. It can be called
+// concurrently by multiple goroutines.
+//
+// The file of the template is not executed and, if it extends another file,
+// neither is the extended file, but the files imported by the template file
+// are initialized. The macro is rendered in its format, and its result is
+// discarded.
+//
+// If the template file does not extend another file, the declarations of
+// the file that the macro refers to, also indirectly, are executed before
+// the macro, but the other statements of the file are not executed.
+//
+// RunMacro returns the same errors returned by the Run method.
+func (t *Template) RunMacro(out io.Writer, name string, args []interface{}, vars map[string]interface{}, options *RunOptions) error {
+	if out == nil {
+		return errors.New("invalid nil out")
+	}
+	fn, ok := t.macros[name]
+	if !ok {
+		return fmt.Errorf("scriggo: template does not declare macro %s", name)
+	}
+	typ := fn.Type
+	if st, ok := typ.(runtime.ScriggoType); ok {
+		typ = st.GoType()
+	}
+	if len(args) != typ.NumIn() {
+		return fmt.Errorf("scriggo: macro %s called with %d arguments, want %d", name, len(args), typ.NumIn())
+	}
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		t := typ.In(i)
+		in[i] = reflect.New(t).Elem()
+		if arg == nil {
+			continue
 		}
-		if options.Print != nil {
-			vm.SetPrint(runtime.PrintFunc(options.Print))
+		v := reflect.ValueOf(arg)
+		if !v.Type().AssignableTo(t) {
+			return fmt.Errorf("scriggo: cannot use %s as type %s in argument to macro %s", v.Type(), t, name)
 		}
+		in[i].Set(v)
 	}
+	vm := newVM(options, t.declared)
 	vm.SetRenderer(out, t.conv)
-	err := vm.Run(t.fn, t.typeof, initGlobalVariables(t.globals, vars))
-	if err != nil {
-		if p, ok := err.(*runtime.PanicError); ok {
-			err = &PanicError{p}
-		}
-		return err
+	globals := initGlobalVariables(t.globals, vars)
+	var err error
+	if t.init != nil {
+		err = vm.Run(t.init, t.typeof, globals)
+	}
+	if err == nil {
+		_, err = vm.Call(fn, t.typeof, globals, in)
 	}
-	return nil
+	return convertRunError(err)
 }
 
 // Disassemble disassembles a template and returns its assembly code.
@@ -173,6 +386,33 @@ func (t *Template) Disassemble(n int) []byte {
 	return assemblies["main"]
 }
 
+// Dependencies returns the dependencies of the template, that are the
+// references to the files extended, imported and rendered by the template
+// file and, transitively, by these files. The paths are rooted at the file
+// system used to build the template.
+//
+// A file referenced more than once is returned once for every reference, but
+// its dependencies are returned only for the first one. The dependencies
+// are returned in the order in which the references are found, visiting the
+// files in depth-first order.
+func (t *Template) Dependencies() []Dependency {
+	deps := make([]Dependency, len(t.deps))
+	for i, dep := range t.deps {
+		deps[i] = Dependency{
+			Path: dep.Path,
+			File: dep.Parent,
+			Kind: DependencyKind(dep.Kind),
+			Position: Position{
+				Line:   dep.Pos.Line,
+				Column: dep.Pos.Column,
+				Start:  dep.Pos.Start,
+				End:    dep.Pos.End,
+			},
+		}
+	}
+	return deps
+}
+
 // UsedVars returns the names of the global variables used in the template.
 // A variable used in dead code may not be returned as used.
 func (t *Template) UsedVars() []string {
@@ -35,6 +35,7 @@ func main() {
 	}
 
 	var disallowGoStmt = flag.Bool("disallowGoStatement", false, "disallow the 'go' statement")
+	var optimize = flag.Bool("optimize", false, "optimize the bytecode")
 
 	flag.Parse()
 
@@ -74,6 +75,7 @@ func main() {
 		opts := &scriggo.BuildOptions{}
 		opts.AllowGoStmt = !*disallowGoStmt
 		opts.Packages = packages
+		opts.Optimize = *optimize
 		var fsys fs.FS
 		if cmd == "rundir" {
 			fsys = os.DirFS(flag.Arg(2))
@@ -111,6 +113,7 @@ func main() {
 			Globals:           globals,
 			Packages:          packages,
 			MarkdownConverter: markdownConverter,
+			Optimize:          *optimize,
 		}
 		template, err := scriggo.BuildTemplate(fsys, "index"+ext, &opts)
 		if err != nil {
@@ -42,6 +42,7 @@ func main() {
 	var (
 		color             = flag.Bool("c", false, "enable colored output. output device must support ANSI escape sequences. require verbose or stats to take effect")
 		keepTestingOnFail = flag.Bool("k", false, "keep testing on fail")
+		optimize          = flag.Bool("O", false, "optimize the bytecode of the tests")
 		parallel          = flag.Int("l", 4, "number of parallel tests to run")
 		pattern           = flag.String("p", "", "executes test whose path is matched by the given pattern. regular expressions are supported, in the syntax of stdlib package 'regexp'")
 		stat              = flag.Bool("s", false, "print some stats about executed tests. Parallelism is not influenced.")
@@ -171,6 +172,9 @@ func main() {
 				_, _ = fmt.Fprintf(os.Stderr, "cannot read mode: %s\n", err)
 				os.Exit(1)
 			}
+			if *optimize {
+				opts = append(opts, "-optimize")
+			}
 			// Skip or run the test.
 			if mode == "skip" {
 				atomic.AddInt64(&countSkipped, 1)
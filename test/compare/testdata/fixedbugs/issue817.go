@@ -1,9 +1,18 @@
-// errorcheck
+// run
 
 package main
 
+import "fmt"
+
 type I interface {
-	M() // ERROR `non-empty interfaces are not supported in this release of Scriggo`
+	M() string
 }
 
-func main() {}
+type T int
+
+func (t T) M() string { return fmt.Sprint("M", int(t)) }
+
+func main() {
+	var i I = T(5)
+	fmt.Println(i.M())
+}
@@ -1,4 +1,4 @@
-// skip : method declaration https://github.com/open2b/scriggo/issues/458
+// skip : error messages report the name of the alias instead of the name of the type
 
 // errorcheck
 
@@ -8,7 +8,7 @@
 
 // Test basic restrictions on type aliases.
 
-package p
+package main
 
 import (
 	"reflect"
@@ -104,3 +104,5 @@ type B1 = struct{}
 func (B1) m() {} // ERROR "invalid receiver type"
 
 // TODO(gri) expand
+
+func main() { }
@@ -1,5 +1,3 @@
-// skip : method definition (see https://github.com/open2b/scriggo/issues/194)
-
 // errorcheck
 
 // Copyright 2009 The Go Authors. All rights reserved.
@@ -15,3 +13,5 @@ func (x T) M () {}  // ERROR "pointer|receiver"
 /*
 bug046.go:7: illegal <this> pointer
 */
+
+func main() { }
@@ -1,12 +1,10 @@
-// skip : method declaration
-
 // compile
 
 // Copyright 2009 The Go Authors. All rights reserved.
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package bug071
+package main
 
 type rat struct  {
 	den  int;
@@ -23,3 +21,5 @@ func dosplit(in *dch){
 	dat := <-in.dat;
 	_ = dat;
 }
+
+func main() { }
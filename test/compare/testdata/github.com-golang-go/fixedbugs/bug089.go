@@ -1,5 +1,3 @@
-// skip : interface definition https://github.com/open2b/scriggo/issues/218
-
 // compile
 
 // Copyright 2009 The Go Authors. All rights reserved.
@@ -11,7 +9,7 @@ package main
 type	I1	interface {}
 type	I2	interface { pr() }
 
-func	e()	I1;
+func	e()	I1 { return nil };
 
 var	i1	I1;
 var	i2	I2;
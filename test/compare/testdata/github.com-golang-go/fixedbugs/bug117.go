@@ -1,4 +1,4 @@
-// skip : method definition (see https://github.com/open2b/scriggo/issues/194)
+// skip : Scriggo reports "missing return at end of function" for a function whose return statement calls an undefined method
 
 // errorcheck
 
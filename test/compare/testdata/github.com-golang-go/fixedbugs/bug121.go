@@ -1,5 +1,3 @@
-// skip : interface definition https://github.com/open2b/scriggo/issues/218
-
 // errorcheck
 
 // Copyright 2009 The Go Authors. All rights reserved.
@@ -17,3 +15,5 @@ type I interface {
 type J interface {
 	h T;  // ERROR "syntax|signature"
 }
+
+func main() { }
@@ -1,19 +1,17 @@
-// skip : interface definition https://github.com/open2b/scriggo/issues/218
-
 // compile
 
 // Copyright 2009 The Go Authors. All rights reserved.
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package bug150
+package main
 
 type T int
-func (t T) M()
+func (t T) M() {}
 
 type M interface { M() } 
 
-func g() (T, T)
+func g() (T, T) { return 0, 0 }
 
 func f() (a, b M) {
 	a, b = g();
@@ -23,3 +21,5 @@ func f() (a, b M) {
 /*
 bugs/bug150.go:13: reorder2: too many funcation calls evaluating parameters
 */
+
+func main() { }
@@ -1,12 +1,10 @@
-// skip : method definition (see https://github.com/open2b/scriggo/issues/194)
-
 // compile
 
 // Copyright 2009 The Go Authors. All rights reserved.
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package bug151
+package main
 
 type S string
 
@@ -21,3 +19,5 @@ bugs/bug151.go:10: illegal types for operand: CALL
 	string
 	S
 */
+
+func main() { }
@@ -1,4 +1,4 @@
-// skip : interface definition https://github.com/open2b/scriggo/issues/218
+// skip : invalid recursive type https://github.com/open2b/scriggo/issues/440
 
 // compile
 
@@ -1,4 +1,4 @@
-// skip : interface definition
+// skip : duplicate methods of embedded interfaces are allowed since Go 1.14
 
 // errorcheck
 
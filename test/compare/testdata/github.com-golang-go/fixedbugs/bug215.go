@@ -1,4 +1,4 @@
-// skip : method definition (see https://github.com/open2b/scriggo/issues/194)
+// skip : invalid recursive type https://github.com/open2b/scriggo/issues/440
 
 // errorcheck
 
@@ -1,5 +1,3 @@
-// skip : method definition https://github.com/open2b/scriggo/issues/458
-
 // errorcheck
 
 // Copyright 2009 The Go Authors. All rights reserved.
@@ -17,3 +15,4 @@ func (a b, c d) x()	// ERROR "multiple receiver"
 
 type b int
 
+func main() { }
@@ -1,10 +1,10 @@
-// skip : interface definition https://github.com/open2b/scriggo/issues/218
-
 // compile
 
 // Copyright 2009 The Go Authors. All rights reserved.
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package bug232
+package main
 type I interface { X(...int) }
+
+func main() { }
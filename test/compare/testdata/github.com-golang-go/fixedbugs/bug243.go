@@ -1,5 +1,3 @@
-// skip : method definition (see https://github.com/open2b/scriggo/issues/194)
-
 // run
 
 // Copyright 2010 The Go Authors. All rights reserved.
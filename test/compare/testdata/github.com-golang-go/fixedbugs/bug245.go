@@ -1,5 +1,3 @@
-// skip : method definition (see https://github.com/open2b/scriggo/issues/194)
-
 // compile
 
 // Copyright 2010 The Go Authors. All rights reserved.
@@ -9,7 +7,7 @@
 package main
 
 type T []int
-func (t T) m()
+func (t T) m() {}
 
 func main() {
 	_ = T{}
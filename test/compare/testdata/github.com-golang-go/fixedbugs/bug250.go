@@ -1,4 +1,4 @@
-// skip : interface definition https://github.com/open2b/scriggo/issues/218
+// skip : invalid recursive type https://github.com/open2b/scriggo/issues/440
 
 // compile
 
@@ -6,7 +6,7 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package bug250
+package main
 
 type I1 interface {
 	m() I2
@@ -19,3 +19,5 @@ type I2 interface {
 var i1 I1 = i2
 var i2 I2
 var i2a I2 = i1
+
+func main() { }
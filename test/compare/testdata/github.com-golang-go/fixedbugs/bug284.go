@@ -1,4 +1,4 @@
-// skip : interface definition (https://github.com/open2b/scriggo/issues/218)
+// skip : this test must be rewritten https://github.com/open2b/scriggo/issues/417
 
 // errorcheck
 
@@ -1,4 +1,4 @@
-// skip : method declaration https://github.com/open2b/scriggo/issues/458
+// skip : invalid recursive type https://github.com/open2b/scriggo/issues/440
 
 // run
 
@@ -1,5 +1,3 @@
-// skip : method declaration https://github.com/open2b/scriggo/issues/458
-
 // errorcheck
 
 // Copyright 2010 The Go Authors. All rights reserved.
@@ -29,3 +27,5 @@ func (p *(T)) g() {}
 func (p (*T)) h() {}
 func (p (*(T))) i() {}
 func ((T),) j() {}
+
+func main() { }
@@ -1,4 +1,4 @@
-// skip : method declaration https://github.com/open2b/scriggo/issues/458
+// skip : Scriggo reports "declared but not used" for a variable used only in an expression with an error
 
 // errorcheck
 
@@ -1,5 +1,3 @@
-// skip : interface declaration https://github.com/open2b/scriggo/issues/218
-
 // errorcheck
 
 // Copyright 2011 The Go Authors. All rights reserved.
@@ -8,7 +6,7 @@
 
 // Issue 1871.
 
-package p
+package main
 
 type a interface {
 	foo(x int) (x int) // ERROR "duplicate argument|redefinition"
@@ -20,3 +18,5 @@ Previously:
 bug.go:1 x redclared in this block
     previous declaration at bug.go:1
 */
+
+func main() { }
@@ -1,5 +1,3 @@
-// skip : method declaration
-
 // errorcheck
 
 // Copyright 2011 The Go Authors. All rights reserved.
@@ -15,3 +13,5 @@ func (T) m() {} // ERROR "T[.]m redeclared|redefinition"
 
 func (*T) p() {} // GCCGO_ERROR "previous"
 func (*T) p() {} // ERROR "[(][*]T[)][.]p redeclared|redefinition"
+
+func main() { }
@@ -1,4 +1,4 @@
-// skip : method declaration
+// skip : Scriggo reports "declared but not used" for a variable used only in an expression with an error
 
 // errorcheck
 
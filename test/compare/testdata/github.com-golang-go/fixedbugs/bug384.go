@@ -1,5 +1,3 @@
-// skip : method declaration
-
 // errorcheck
 
 // Copyright 2011 The Go Authors. All rights reserved.
@@ -8,7 +6,9 @@
 
 // Issue 2500
 
-package foo
+package main
 
 // Check that we only get root cause message, no further complaints about r undefined
 func (r *indexWriter) foo() {}  // ERROR "undefined.*indexWriter"
+
+func main() { }
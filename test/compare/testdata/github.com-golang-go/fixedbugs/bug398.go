@@ -1,4 +1,4 @@
-// skip : interface declaration https://github.com/open2b/scriggo/issues/218
+// skip : invalid recursive type https://github.com/open2b/scriggo/issues/440
 
 // compile
 
@@ -9,7 +9,7 @@
 // Used to crash compiler in interface type equality check.
 // (This test used to have problems - see #15596.)
 
-package p
+package main
 
 // exported interfaces
 
@@ -44,3 +44,5 @@ var v2 i2
 func f() bool {
        return v1 == v2
 }
+
+func main() { }
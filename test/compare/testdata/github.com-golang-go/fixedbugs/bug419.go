@@ -1,5 +1,3 @@
-// skip : interface declaration https://github.com/open2b/scriggo/issues/218
-
 // compile
 
 // Copyright 2012 The Go Authors. All rights reserved.
@@ -9,7 +7,7 @@
 // Issue 1811.
 // gccgo failed to compile this.
 
-package p
+package main
 
 type E interface{}
 
@@ -17,3 +15,5 @@ type I interface {
 	E
 	E
 }
+
+func main() { }
@@ -1,5 +1,3 @@
-// skip : method declaration
-
 // compile
 
 // Copyright 2012 The Go Authors. All rights reserved.
@@ -8,7 +6,7 @@
 
 // Gccgo used to crash compiling this.
 
-package p
+package main
 
 type E int
 
@@ -22,3 +20,5 @@ const (
 func F() *E {
 	return C2.P()
 }
+
+func main() { }
@@ -1,4 +1,4 @@
-// skip : method declaration
+// skip : invalid recursive type https://github.com/open2b/scriggo/issues/440
 
 // compile
 
@@ -9,7 +9,7 @@
 // Was failing to compile with 'invalid receiver' due to
 // incomplete type definition evaluation.  Issue 3709.
 
-package p
+package main
 
 type T1 struct { F *T2 }
 type T2 T1
@@ -17,3 +17,4 @@ type T2 T1
 type T3 T2
 func (*T3) M()  // was invalid receiver
 
+func main() { }
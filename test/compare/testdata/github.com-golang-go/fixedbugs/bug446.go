@@ -1,4 +1,4 @@
-// skip : method declarations
+// skip : package variables are not initialized after the variables used by the methods they call
 
 // run
 
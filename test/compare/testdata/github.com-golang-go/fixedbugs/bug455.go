@@ -1,4 +1,4 @@
-// skip : interface type literal with methods
+// skip : invalid recursive type https://github.com/open2b/scriggo/issues/440
 
 // run
 
@@ -1,4 +1,4 @@
-// skip : method declaration
+// skip : initialization loops through methods are not detected
 
 // errorcheck
 
@@ -9,7 +9,7 @@
 // Issue 3890: missing detection of init loop involving
 // method calls in function bodies.
 
-package flag
+package main
 
 var commandLine = NewFlagSet() // ERROR "loop|depends upon itself"
 
@@ -35,3 +35,5 @@ func NewFlagSet() *FlagSet {
 func (f *FlagSet) setErrorHandling(b bool) {
 	f.failf("DIE")
 }
+
+func main() { }
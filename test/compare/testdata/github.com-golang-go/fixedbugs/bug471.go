@@ -1,5 +1,3 @@
-// skip : method declaration
-
 // compile
 
 // Copyright 2012 The Go Authors. All rights reserved.
@@ -8,7 +6,7 @@
 
 // Caused an internal compiler error in gccgo.
 
-package p
+package main
 
 type C chan struct{}
 
@@ -18,3 +16,5 @@ func (c C) F() {
 	default:
 	}
 }
+
+func main() { }
@@ -1,5 +1,3 @@
-// skip : method declaration
-
 // compile
 
 // Copyright 2013 The Go Authors. All rights reserved.
@@ -10,7 +8,7 @@
 // supporting an implicit conversion to an interface type.  This used
 // to crash gccgo.
 
-package p
+package main
 
 type B bool
 
@@ -23,3 +21,5 @@ type I interface {
 func F(a, b B) I {
 	return a && b
 }
+
+func main() { }
@@ -1,4 +1,4 @@
-// skip : method declaration
+// skip : methods promoted through embedded fields are not in the method set of the embedding type
 
 // compile
 
@@ -9,7 +9,7 @@
 // Test multiple identical unnamed structs with methods.  This caused
 // a compilation error with gccgo.
 
-package p
+package main
 
 type S1 struct{}
 
@@ -34,3 +34,5 @@ func F() {
 	var i2 I = s2.F2
 	_, _ = i1, i2
 }
+
+func main() { }
@@ -1,5 +1,3 @@
-// skip : method declaration
-
 // compile
 
 // Copyright 2015 The Go Authors. All rights reserved.
@@ -12,7 +10,7 @@
 // <built-in>: error: redefinition of ‘s$F$equal’
 // <built-in>: note: previous definition of ‘s$F$equal’ was here
 
-package p
+package main
 
 type T1 int
 
@@ -29,3 +27,5 @@ func (t T2) F() {
 		f string
 	}
 }
+
+func main() { }
@@ -1,4 +1,4 @@
-// skip : interface definition (https://github.com/open2b/scriggo/issues/218)
+// skip : option '-lang' not supported by mode 'errorcheck' https://github.com/open2b/scriggo/issues/417
 
 // errorcheck -lang=go1.17
 
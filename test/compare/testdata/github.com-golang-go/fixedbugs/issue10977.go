@@ -1,12 +1,10 @@
-// skip : method declaration (https://github.com/open2b/scriggo/issues/458)
-
 // compile
 
 // Copyright 2015 The Go Authors. All rights reserved.
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package p
+package main
 
 type T struct{}
 
@@ -20,3 +18,5 @@ func x(T) (int, int) { return 0, 0 }
 var _, _ = x(u)
 
 func (T) New() T { return T{} }
+
+func main() { }
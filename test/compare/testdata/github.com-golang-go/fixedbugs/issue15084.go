@@ -1,12 +1,10 @@
-// skip : method definition (see https://github.com/open2b/scriggo/issues/194)
-
 // compile
 
 // Copyright 2016 The Go Authors.  All rights reserved.
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package x
+package main
 
 type T struct {
 	i int
@@ -30,3 +28,5 @@ func g(t *T) {
 		}
 	}
 }
+
+func main() { }
@@ -1,12 +1,10 @@
-// skip : method definition (see https://github.com/open2b/scriggo/issues/194)
-
 // compile
 
 // Copyright 2017 The Go Authors. All rights reserved.
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package foo
+package main
 
 import (
 	"encoding/binary"
@@ -39,3 +37,5 @@ func (bld *DbBuilder) Finish() error {
 
 	return nil
 }
+
+func main() { }
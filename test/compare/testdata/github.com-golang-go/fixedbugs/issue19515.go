@@ -1,5 +1,3 @@
-// skip : method definition (see https://github.com/open2b/scriggo/issues/194)
-
 // compile
 
 // Copyright 2017 The Go Authors. All rights reserved.
@@ -8,7 +6,7 @@
 
 // Issue 19515: compiler panics on spilling int128 constant.
 
-package x
+package main
 
 type VScrollPanel struct {
 	x, y int
@@ -50,3 +48,5 @@ func (v *VScrollPanel) Draw() {
 	BoxGradient(x+x-2, y-1, 0, 0, 0, Color{}, Color{})
 	BoxGradient(x+y-2, y-1, 0, 0, 0, Color{}, Color{})
 }
+
+func main() { }
@@ -1,5 +1,3 @@
-// skip : interface definition is not supported in Scriggo https://github.com/open2b/scriggo/issues/218
-
 // errorcheck
 
 // Copyright 2017 The Go Authors. All rights reserved.
@@ -8,6 +6,8 @@
 
 // Issue 20245: panic while formatting an error message
 
-package p
+package main
 
 var e = interface{ I1 } // ERROR "undefined: I1"
+
+func main() { }
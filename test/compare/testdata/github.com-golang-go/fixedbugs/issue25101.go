@@ -1,5 +1,3 @@
-// skip : interface definition https://github.com/open2b/scriggo/issues/218
-
 // compile
 
 // Copyright 2018 The Go Authors. All rights reserved.
@@ -9,10 +7,12 @@
 // Indexed export format must not crash when writing
 // the anonymous parameter for m.
 
-package p
+package main
 
 var x interface {
 	m(int)
 }
 
 var M = x.m
+
+func main() { }
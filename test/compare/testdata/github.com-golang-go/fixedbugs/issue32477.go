@@ -1,4 +1,4 @@
-// skip : method definition (see https://github.com/open2b/scriggo/issues/194)
+// skip : import "runtime" https://github.com/open2b/scriggo/issues/524
 
 // run
 
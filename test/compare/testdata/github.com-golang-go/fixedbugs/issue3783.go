@@ -1,4 +1,4 @@
-// skip : method declarations are not supported https://github.com/open2b/scriggo/issues/238
+// skip : function declaration without body.
 
 // errorcheck
 
@@ -6,9 +6,10 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package foo
+package main
 
 var i int
 
 func (*i) bar() // ERROR "not a type|expected type"
 
+func main() { }
@@ -1,4 +1,4 @@
-// skip : interface declaration
+// skip : Scriggo reports "undefined: v" for a variable declared with an invalid initialization value
 
 // errorcheck
 
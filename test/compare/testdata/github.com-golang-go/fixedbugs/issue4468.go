@@ -1,5 +1,3 @@
-// skip : method declaration
-
 // errorcheck
 
 // Copyright 2012 The Go Authors. All rights reserved.
@@ -8,7 +6,7 @@
 
 // Issue 4468: go/defer calls may not be parenthesized.
 
-package p
+package main
 
 type T int
 
@@ -32,3 +30,5 @@ func F() {
 	go (&s.t).F()
 	defer (&s.t).F()
 }
+
+func main() { }
@@ -1,4 +1,4 @@
-// skip : interface definition
+// skip : method expressions of interface types defined in Scriggo are not supported
 
 // run
 
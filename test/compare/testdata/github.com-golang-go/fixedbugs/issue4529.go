@@ -1,5 +1,3 @@
-// skip : method declaration
-
 // compile
 
 // Copyright 2012 The Go Authors. All rights reserved.
@@ -33,3 +31,5 @@ func Init(a string, b *A, c interface {
 }
 
 func (a *A) c(b <-chan M, _ chan<- M) {}
+
+func main() { }
@@ -1,5 +1,3 @@
-// skip : method declaration
-
 // compile
 
 // Copyright 2013 The Go Authors. All rights reserved.
@@ -8,7 +6,7 @@
 
 // Caused gccgo to emit multiple definitions of the same symbol.
 
-package p
+package main
 
 type S1 struct{}
 
@@ -21,3 +19,5 @@ type S2 struct {
 func F() {
 	_ = struct{ *S1 }{}
 }
+
+func main() { }
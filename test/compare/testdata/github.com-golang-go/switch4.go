@@ -1,5 +1,3 @@
-// skip : interface definition https://github.com/open2b/scriggo/issues/218
-
 // errorcheck
 
 // Copyright 2011 The Go Authors. All rights reserved.
@@ -36,3 +34,5 @@ func good() {
 	case i:
 	}
 }
+
+func main() { }
@@ -1,5 +1,3 @@
-// skip : interface definition https://github.com/open2b/scriggo/issues/218
-
 // errorcheck
 
 // Copyright 2016 The Go Authors. All rights reserved.
@@ -46,3 +44,5 @@ func f2() {
 	case X: // ERROR "impossible type switch case: i \(type I\) cannot have dynamic type X \(Foo method has pointer receiver\)"
 	}
 }
+
+func main() { }
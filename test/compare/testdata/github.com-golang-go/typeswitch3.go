@@ -1,4 +1,4 @@
-// skip : interface definition (see https://github.com/open2b/scriggo/issues/194)
+// skip : this test must be rewritten https://github.com/open2b/scriggo/issues/417
 
 // errorcheck
 
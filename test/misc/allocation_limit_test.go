@@ -0,0 +1,111 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package misc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/internal/fstest"
+)
+
+func TestProgramMaxAllocatedBytes(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		line int
+	}{
+		{"make slice", "\t_ = make([]byte, 1<<40)\n", 4},
+		{"make map", "\t_ = make(map[int]int, 1<<40)\n", 4},
+		{"grow map", "\tm := map[int]int{}\n\tfor i := 0; ; i++ {\n\t\tm[i] = i\n\t}\n", 6},
+		{"append", "\tvar s []int\n\tfor i := 0; ; i++ {\n\t\ts = append(s, i)\n\t}\n", 6},
+		{"append slice", "\tvar s []int\n\tt := []int{1, 2, 3}\n\tfor {\n\t\ts = append(s, t...)\n\t}\n", 7},
+		{"concat", "\ts := \"a\"\n\tfor {\n\t\ts += s\n\t}\n", 6},
+		{"new", "\tfor {\n\t\t_ = new([1024]byte)\n\t}\n", 5},
+		{"composite literal", "\ttype T struct{ a [1024]byte }\n\tfor {\n\t\t_ = T{}\n\t}\n", 6},
+		{"conversion to string", "\tvar s string\n\t_ = s\n\tb := make([]byte, 1024)\n\tfor {\n\t\ts = string(b)\n\t}\n", 8},
+		{"conversion to bytes", "\tvar b []byte\n\t_ = b\n\ts := string(make([]byte, 1024))\n\tfor {\n\t\tb = []byte(s)\n\t}\n", 8},
+		{"conversion to runes", "\tvar r []rune\n\t_ = r\n\ts := string(make([]byte, 1024))\n\tfor {\n\t\tr = []rune(s)\n\t}\n", 8},
+		{"release", "\tfor {\n\t\tb := make([]byte, 1024)\n\t\tb = nil\n\t\t_ = b\n\t}\n", 5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := "package main\n\nfunc main() {\n" + test.body + "}\n"
+			program, err := scriggo.Build(fstest.Files{"main.go": src}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = program.Run(&scriggo.RunOptions{MaxAllocatedBytes: 1 << 20})
+			var e *scriggo.AllocationLimitError
+			if !errors.As(err, &e) {
+				t.Fatalf("expected *scriggo.AllocationLimitError, got %v", err)
+			}
+			if e.Error() != "allocation limit of 1048576 bytes exceeded" {
+				t.Fatalf("unexpected error message %q", e.Error())
+			}
+			if e.Limit() != 1<<20 {
+				t.Fatalf("expected limit %d, got %d", 1<<20, e.Limit())
+			}
+			if e.Path() != "main" {
+				t.Fatalf("expected path %q, got %q", "main", e.Path())
+			}
+			if e.Position().Line != test.line {
+				t.Fatalf("expected line %d, got %d", test.line, e.Position().Line)
+			}
+			if e.Allocated() > 1<<20 {
+				t.Fatalf("expected at most %d allocated bytes, got %d", 1<<20, e.Allocated())
+			}
+		})
+	}
+}
+
+func TestProgramAllocatedBytes(t *testing.T) {
+	src := "package main\n\nfunc main() {\n\ts := make([]int64, 10, 100)\n\tfor i := 0; i < 50; i++ {\n\t\ts = append(s, 1)\n\t}\n\tm := map[string]int{}\n\tm[\"a\"] = 1\n\tm[\"a\"] = 2\n\tb := []byte(\"abc\")\n\t_ = string(b)\n\t_ = make([]byte, 1<<20)\n}\n"
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = program.Run(&scriggo.RunOptions{MaxAllocatedBytes: 1 << 20})
+	var e *scriggo.AllocationLimitError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected *scriggo.AllocationLimitError, got %v", err)
+	}
+	// The slice does not grow, the map has a single entry and the
+	// conversions allocate three bytes each.
+	if expected := int64(800 + 48 + 16 + 8 + 3 + 3); e.Allocated() != expected {
+		t.Fatalf("expected %d allocated bytes, got %d", expected, e.Allocated())
+	}
+	err = program.Run(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestTemplateMaxAllocatedBytes(t *testing.T) {
+	fsys := fstest.Files{"index.html": "{% s := \"abc\" %}{% for i := 0; i < 20; i++ %}{% s += s %}{% end %}{{ len(s) }}"}
+	template, err := scriggo.BuildTemplate(fsys, "index.html", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	err = template.Run(&b, nil, &scriggo.RunOptions{MaxAllocatedBytes: 1 << 20})
+	var e *scriggo.AllocationLimitError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected *scriggo.AllocationLimitError, got %v", err)
+	}
+	if e.Path() != "index.html" {
+		t.Fatalf("expected path %q, got %q", "index.html", e.Path())
+	}
+	b.Reset()
+	err = template.Run(&b, nil, &scriggo.RunOptions{MaxAllocatedBytes: 1 << 23})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if b.String() != "3145728" {
+		t.Fatalf("expected output %q, got %q", "3145728", b.String())
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package misc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/internal/fstest"
+	"github.com/open2b/scriggo/native"
+)
+
+func TestAnalyzeTemplate(t *testing.T) {
+	src := `{% import "macros.html" %}{% s := "a" %}{{ M(s) }}{{ upper(s) }}{{ b }}`
+	fsys := fstest.Files{
+		"index.html":  src,
+		"macros.html": `{% macro M(s string) %}{{ s }}{% end %}`,
+	}
+	opts := &scriggo.BuildOptions{
+		Globals: native.Declarations{"upper": strings.ToUpper},
+	}
+	a, err := scriggo.AnalyzeTemplate(fsys, "index.html", opts)
+	var e *scriggo.BuildError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected a *scriggo.BuildError, got %#v", err)
+	}
+	if e.Message() != "undefined: b" {
+		t.Fatalf("unexpected error message %q", e.Message())
+	}
+	if a == nil {
+		t.Fatal("expected the analysis, got nil")
+	}
+	s, pos, ok := a.Describe(strings.Index(src, "s) }}"))
+	if !ok {
+		t.Fatal("expected a description, got nothing")
+	}
+	if s != "var s string" || pos.String() != "1:46" {
+		t.Fatalf("unexpected description %q at %s", s, pos)
+	}
+	loc, ok := a.Definition(strings.Index(src, "M(s)"))
+	if !ok {
+		t.Fatal("expected the definition of M, got nothing")
+	}
+	if loc.Path != "macros.html" || loc.Native || loc.Position.String() != "1:10" {
+		t.Fatalf("unexpected definition of M: %#v", loc)
+	}
+	loc, ok = a.Definition(strings.Index(src, "upper"))
+	if !ok {
+		t.Fatal("expected the definition of upper, got nothing")
+	}
+	if !loc.Native || !strings.HasSuffix(loc.Path, "strings/strings.go") {
+		t.Fatalf("unexpected definition of upper: %#v", loc)
+	}
+	if _, ok := a.Definition(strings.Index(src, "{{ b }}")); ok {
+		t.Fatal("unexpected definition for b")
+	}
+}
+
+func TestAnalyzeProgram(t *testing.T) {
+	src := "package main\n\nconst c = 5\n\nfunc main() {\n\tx := c\n\t_ = x\n}\n"
+	fsys := fstest.Files{"main.go": src}
+	a, err := scriggo.AnalyzeProgram(fsys, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if a.Path() != "main" {
+		t.Fatalf("unexpected path %q", a.Path())
+	}
+	s, _, ok := a.Describe(strings.Index(src, "c\n\t_"))
+	if !ok || s != "const c untyped int = 5" {
+		t.Fatalf("unexpected description %q", s)
+	}
+	loc, ok := a.Definition(strings.Index(src, "x\n}"))
+	if !ok || loc.Path != "main" || loc.Position.String() != "6:2" {
+		t.Fatalf("unexpected definition of x: %#v", loc)
+	}
+}
+
+func TestAnalyzeSyntaxError(t *testing.T) {
+	a, err := scriggo.AnalyzeTemplate(fstest.Files{"index.html": "{% if %}"}, "index.html", nil)
+	if a != nil {
+		t.Fatal("expected a nil analysis")
+	}
+	var e *scriggo.BuildError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected a *scriggo.BuildError, got %#v", err)
+	}
+}
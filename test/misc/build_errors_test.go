@@ -0,0 +1,109 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package misc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/internal/fstest"
+)
+
+func TestBuildErrors(t *testing.T) {
+
+	// Syntax errors.
+	fsys := fstest.Files{"index.html": "{% a := %}\n{{ 1 + }}\n{% if %}{% end %}"}
+	_, err := scriggo.BuildTemplate(fsys, "index.html", &scriggo.BuildOptions{MaxErrors: 10})
+	errs, ok := err.(scriggo.BuildErrors)
+	if !ok {
+		t.Fatalf("expected scriggo.BuildErrors, got %T", err)
+	}
+	if len(errs) != 4 {
+		t.Fatalf("expected 4 errors, got %d: %s", len(errs), err)
+	}
+	lines := []int{1, 2, 3, 3}
+	for i, e := range errs {
+		if e.Path() != "index.html" || e.Position().Line != lines[i] {
+			t.Fatalf("error %d: unexpected path %q and line %d", i, e.Path(), e.Position().Line)
+		}
+	}
+
+	// Type checking errors.
+	fsys = fstest.Files{"index.html": "{% a := 1 + \"\" %}{{ a }}{{ b }}{{ c }}"}
+	_, err = scriggo.BuildTemplate(fsys, "index.html", &scriggo.BuildOptions{MaxErrors: 10})
+	expected := "index.html:1:11: invalid operation: 1 + \"\" (mismatched types int and string)\n" +
+		"index.html:1:28: undefined: b\n" +
+		"index.html:1:35: undefined: c"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error %q, got %v", expected, err)
+	}
+
+	// Maximum number of errors.
+	_, err = scriggo.BuildTemplate(fsys, "index.html", &scriggo.BuildOptions{MaxErrors: 1})
+	if _, ok := err.(*scriggo.BuildError); !ok {
+		t.Fatalf("expected *scriggo.BuildError, got %T", err)
+	}
+	src := "{{ a }}" + strings.Repeat("{{ b }}", 20)
+	_, err = scriggo.BuildTemplate(fstest.Files{"index.html": src}, "index.html", &scriggo.BuildOptions{MaxErrors: 10})
+	if errs, ok := err.(scriggo.BuildErrors); !ok || len(errs) != 10 {
+		t.Fatalf("expected 10 errors, got %v", err)
+	}
+	_, err = scriggo.BuildTemplate(fstest.Files{"index.html": src}, "index.html", &scriggo.BuildOptions{MaxErrors: -1})
+	if errs, ok := err.(scriggo.BuildErrors); !ok || len(errs) != 21 {
+		t.Fatalf("expected 21 errors, got %v", err)
+	}
+
+	// Programs.
+	fsys = fstest.Files{"main.go": "package main\n\nfunc main() {\n\ta := \n}\n\nfunc f() {\n\tb := 1 +\n}\n"}
+	_, err = scriggo.Build(fsys, &scriggo.BuildOptions{MaxErrors: 10})
+	if errs, ok := err.(scriggo.BuildErrors); !ok || len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %v", err)
+	}
+
+	// By default, only the first error is reported.
+	_, err = scriggo.Build(fsys, nil)
+	e, ok := err.(*scriggo.BuildError)
+	if !ok {
+		t.Fatalf("expected *scriggo.BuildError, got %T", err)
+	}
+	if e.Position().Line != 5 {
+		t.Fatalf("expected error at line 5, got line %d", e.Position().Line)
+	}
+
+	// errors.As finds the first of the errors.
+	_, err = scriggo.Build(fsys, &scriggo.BuildOptions{MaxErrors: -1})
+	e = nil
+	if !errors.As(err, &e) {
+		t.Fatalf("expected errors.As to find a *scriggo.BuildError in %T", err)
+	}
+	if e.Position().Line != 5 {
+		t.Fatalf("expected error at line 5, got line %d", e.Position().Line)
+	}
+
+	// Errors are sorted by position before being truncated.
+	fsys = fstest.Files{"main.go": "package main\n\nfunc main() {\n\t_ = x\n}\n\nvar y int = \"\"\n\nfunc f() { _ = z }\n\nvar w = v\n"}
+	_, err = scriggo.Build(fsys, &scriggo.BuildOptions{MaxErrors: -1})
+	expected = "main:4:6: undefined: x\n" +
+		"main:7:13: cannot use \"\" (type untyped string) as type int in assignment\n" +
+		"main:9:16: undefined: z\n" +
+		"main:11:9: undefined: v"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error %q, got %v", expected, err)
+	}
+	_, err = scriggo.Build(fsys, &scriggo.BuildOptions{MaxErrors: 2})
+	expected = "main:4:6: undefined: x\n" +
+		"main:7:13: cannot use \"\" (type untyped string) as type int in assignment"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error %q, got %v", expected, err)
+	}
+
+	// A bad token is reported only once.
+	_, err = scriggo.BuildTemplate(fstest.Files{"index.html": "{{ q }"}, "index.html", &scriggo.BuildOptions{MaxErrors: -1})
+	if e, ok := err.(*scriggo.BuildError); !ok || e.Error() != "index.html:1:6: syntax error: unexpected }, expecting }}" {
+		t.Fatalf("expected a single error, got %v", err)
+	}
+}
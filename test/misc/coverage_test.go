@@ -0,0 +1,191 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package misc
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/internal/fstest"
+	"github.com/open2b/scriggo/native"
+)
+
+func TestCoverage(t *testing.T) {
+
+	fsys := fstest.Files{
+		"index.html": "{% if n > 0 %}\npositive\n{% else if n < 0 %}\nnegative\n{% else %}\nzero\n{% end %}\n{{ n }}",
+	}
+	n := 0
+	globals := native.Declarations{"n": &n}
+	template, err := scriggo.BuildTemplate(fsys, "index.html", &scriggo.BuildOptions{Globals: globals})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c scriggo.Coverage
+	for _, v := range []int{1, 2, -1} {
+		n = v
+		err = template.Run(io.Discard, nil, &scriggo.RunOptions{Coverage: &c})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Determine the minimum count of every line.
+	lines := map[int]int64{}
+	for _, block := range c.Blocks() {
+		if block.Path != "index.html" {
+			t.Fatalf("unexpected path %q", block.Path)
+		}
+		line := block.Position.Line
+		if count, ok := lines[line]; !ok || block.Count < count {
+			lines[line] = block.Count
+		}
+	}
+	expected := map[int]int64{1: 3, 2: 2, 3: 1, 4: 1, 6: 0, 8: 3}
+	for line, count := range expected {
+		if got, ok := lines[line]; !ok || got != count {
+			t.Fatalf("line %d: expected count %d, got %v", line, count, lines)
+		}
+	}
+	if p := c.Percent(); p <= 0 || p >= 100 {
+		t.Fatalf("unexpected percent %f", p)
+	}
+
+	var b bytes.Buffer
+	err = c.WriteProfile(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if profile[0] != "mode: count" {
+		t.Fatalf("unexpected profile mode line %q", profile[0])
+	}
+	if !strings.Contains(b.String(), "\nindex.html:6.1,6.2 1 0\n") {
+		t.Fatalf("expected a not covered block on line 6, got %q", b.String())
+	}
+	for _, line := range profile[1:] {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || !strings.HasPrefix(fields[0], "index.html:") || fields[1] != "1" {
+			t.Fatalf("unexpected profile line %q", line)
+		}
+		if _, err := strconv.ParseInt(fields[2], 10, 64); err != nil {
+			t.Fatalf("unexpected profile line %q", line)
+		}
+	}
+
+	b.Reset()
+	err = c.WriteHTML(&b, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := b.String()
+	for _, s := range []string{"index.html", `<span class="nocov" title="0"><span class="num">    6</span> zero</span>`, `<span class="cov" title="2"><span class="num">    2</span> positive</span>`} {
+		if !strings.Contains(report, s) {
+			t.Fatalf("expected %q in the HTML report, got %s", s, report)
+		}
+	}
+}
+
+func TestCoverageProgram(t *testing.T) {
+
+	fsys := fstest.Files{
+		"main.go": "package main\n\nfunc f(b bool) int {\n\tif b {\n\t\treturn 1\n\t}\n\treturn 0\n}\n\nfunc main() {\n\t_ = f(true)\n}\n\nfunc g() int {\n\treturn 2\n}\n",
+	}
+	program, err := scriggo.Build(fsys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c scriggo.Coverage
+	err = program.Run(&scriggo.RunOptions{Coverage: &c})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := map[int]int64{}
+	for _, block := range c.Blocks() {
+		lines[block.Position.Line] = block.Count
+	}
+	if lines[5] != 1 || lines[7] != 0 || lines[11] != 1 {
+		t.Fatalf("unexpected counts %v", lines)
+	}
+	if count, ok := lines[15]; !ok || count != 0 {
+		t.Fatalf("unexpected counts %v", lines)
+	}
+	var b bytes.Buffer
+	err = c.WriteHTML(&b, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "return 0</span>") {
+		t.Fatalf("expected the source in the HTML report, got %s", b.String())
+	}
+}
+
+func TestCoverageNotCalledMacros(t *testing.T) {
+
+	fsys := fstest.Files{
+		"index.html":   "{% import \"imports.html\" %}\n{{ Used() }}",
+		"imports.html": "{% macro Used %}\nused\n{% end %}\n{% macro Unused %}\nunused\n{% end %}\n{% macro Empty %}{% end %}",
+	}
+	template, err := scriggo.BuildTemplate(fsys, "index.html", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c scriggo.Coverage
+	err = template.Run(io.Discard, nil, &scriggo.RunOptions{Coverage: &c})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := map[string]int64{}
+	for _, block := range c.Blocks() {
+		line := block.Path + ":" + strconv.Itoa(block.Position.Line)
+		if count, ok := lines[line]; !ok || block.Count < count {
+			lines[line] = block.Count
+		}
+	}
+	if count, ok := lines["imports.html:2"]; !ok || count != 1 {
+		t.Fatalf("unexpected counts %v", lines)
+	}
+	if count, ok := lines["imports.html:5"]; !ok || count != 0 {
+		t.Fatalf("unexpected counts %v", lines)
+	}
+	if count, ok := lines["imports.html:7"]; !ok || count != 0 {
+		t.Fatalf("unexpected counts %v", lines)
+	}
+	if p := c.Percent(); p <= 0 || p >= 100 {
+		t.Fatalf("unexpected percent %f", p)
+	}
+}
+
+func TestCoverageEmptyFunctions(t *testing.T) {
+
+	fsys := fstest.Files{
+		"main.go": "package main\n\nfunc called() {}\n\nfunc notCalled() {}\n\nfunc main() {\n\tfor i := 0; i < 3; i++ {\n\t\tcalled()\n\t}\n\tf := func() {}\n\tg := func() {}\n\tf()\n\t_ = g\n}\n",
+	}
+	for _, optimize := range []bool{false, true} {
+		program, err := scriggo.Build(fsys, &scriggo.BuildOptions{Optimize: optimize})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var c scriggo.Coverage
+		err = program.Run(&scriggo.RunOptions{Coverage: &c})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		err = c.WriteProfile(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, block := range []string{"main:3.15,3.16 1 3", "main:5.18,5.19 1 0", "main:11.14,11.15 1 1", "main:12.14,12.15 1 0"} {
+			if !strings.Contains(b.String(), "\n"+block+"\n") {
+				t.Fatalf("optimize %t: expected block %q, got %q", optimize, block, b.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package misc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/internal/fstest"
+)
+
+// testDebugger is a debugger that stops at a breakpoint and then executes
+// a sequence of actions, recording the stops.
+type testDebugger struct {
+	path    string
+	line    int
+	actions []scriggo.DebugAction
+	stops   []string
+}
+
+func (d *testDebugger) Break(path string, line int) bool {
+	return path == d.path && line == d.line
+}
+
+func (d *testDebugger) Stop(frames []scriggo.DebugFrame) scriggo.DebugAction {
+	var b strings.Builder
+	for i, frame := range frames {
+		if i > 0 {
+			b.WriteString(" | ")
+		}
+		_, _ = fmt.Fprintf(&b, "%s %s:%d", frame.Func, frame.Path, frame.Position.Line)
+		for _, v := range frame.Variables {
+			if v.Value.Kind() == reflect.Func {
+				_, _ = fmt.Fprintf(&b, " %s", v.Name)
+			} else {
+				_, _ = fmt.Fprintf(&b, " %s=%v", v.Name, v.Value)
+			}
+			if v.Upvar {
+				b.WriteString("^")
+			}
+		}
+	}
+	d.stops = append(d.stops, b.String())
+	if len(d.actions) == 0 {
+		return scriggo.DebugContinue
+	}
+	action := d.actions[0]
+	d.actions = d.actions[1:]
+	return action
+}
+
+func TestDebugger(t *testing.T) {
+
+	// Program.
+	fsys := fstest.Files{
+		"main.go": "package main\n\nfunc main() {\n\ta := 1\n\tf := func() int {\n\t\treturn a + 1\n\t}\n" +
+			"\tb := f()\n\tfor i := 0; i < 2; i++ {\n\t\tb += i\n\t}\n\tprintln(b)\n}\n",
+	}
+	program, err := scriggo.Build(fsys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &testDebugger{
+		path:    "main",
+		line:    6,
+		actions: []scriggo.DebugAction{scriggo.DebugStepOver, scriggo.DebugStepIn, scriggo.DebugStepOver},
+	}
+	err = program.Run(&scriggo.RunOptions{Print: func(interface{}) {}, Debugger: d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testDebuggerStops(t, d.stops, []string{
+		"main.main.func main:6 a=1^ | main.main main:8 a=1 f",
+		"main.main main:9 a=1 f b=2",
+		"main.main main:10 a=1 f b=2 i=0",
+		"main.main main:9 a=1 f b=2 i=0",
+	})
+
+	// Template.
+	fsys = fstest.Files{
+		"index.html":  "{% import \"macros.html\" %}\n{% s := \"a\" %}\n{{ M(s) }}\n{{ s }}",
+		"macros.html": "{% macro M(v string) %}\n{{ v }}\n{% end %}",
+	}
+	template, err := scriggo.BuildTemplate(fsys, "index.html", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d = &testDebugger{
+		path:    "index.html",
+		line:    3,
+		actions: []scriggo.DebugAction{scriggo.DebugStepIn, scriggo.DebugStepIn, scriggo.DebugStepOut},
+	}
+	err = template.Run(io.Discard, nil, &scriggo.RunOptions{Debugger: d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testDebuggerStops(t, d.stops, []string{
+		"main.main index.html:3 s=a",
+		"main.M macros.html:1 v=a | main.main index.html:3 s=a",
+		"main.M macros.html:2 v=a | main.main index.html:3 s=a",
+		"main.main index.html:4 s=a",
+	})
+
+	// Optimized program with inlined calls.
+	fsys = fstest.Files{
+		"main.go": "package main\n\nfunc double(n int) int {\n\treturn n * 2\n}\n\nfunc add(a, b int) int {\n\tc := double(a) + b\n\treturn c\n}\n" +
+			"\nfunc main() {\n\tx := 1\n\tfor i := 0; i < 2; i++ {\n\t\tx = add(x, i)\n\t}\n\tprintln(x)\n}\n",
+	}
+	program, err = scriggo.Build(fsys, &scriggo.BuildOptions{Optimize: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	asm, err := program.Disassemble("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(asm), "Call main.") {
+		t.Fatalf("expected inlined calls, got:\n%s", asm)
+	}
+	data, err := program.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	program, err = scriggo.LoadProgram(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d = &testDebugger{
+		path:    "main",
+		line:    4,
+		actions: []scriggo.DebugAction{scriggo.DebugStepIn, scriggo.DebugStepIn, scriggo.DebugStepOver, scriggo.DebugStepIn, scriggo.DebugStepOut},
+	}
+	err = program.Run(&scriggo.RunOptions{Print: func(interface{}) {}, Debugger: d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testDebuggerStops(t, d.stops, []string{
+		"main.double main:4 n=1 | main.add main:8 a=1 b=0 | main.main main:15 x=1 i=0",
+		"main.add main:9 a=1 b=0 c=2 | main.main main:15 x=1 i=0",
+		"main.main main:14 x=2 i=0",
+		"main.main main:15 x=2 i=1",
+		"main.add main:8 a=2 b=1 | main.main main:15 x=2 i=1",
+		"main.double main:4 n=2 | main.add main:8 a=2 b=1 | main.main main:15 x=2 i=1",
+	})
+}
+
+func testDebuggerStops(t *testing.T, got, expected []string) {
+	t.Helper()
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d stops, got %d: %q", len(expected), len(got), got)
+	}
+	for i, stop := range got {
+		if stop != expected[i] {
+			t.Fatalf("stop %d: expected %q, got %q", i+1, expected[i], stop)
+		}
+	}
+}
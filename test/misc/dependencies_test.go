@@ -0,0 +1,61 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package misc
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/internal/fstest"
+)
+
+func TestTemplateDependencies(t *testing.T) {
+	fsys := fstest.Files{
+		"index.html":              "{% extends \"layout.html\" %}{% import \"macros.html\" %}\n{% macro Body %}{{ render \"partials/footer.html\" }}{% end %}",
+		"layout.html":             `{% import "macros.html" %}{{ Body() }}`,
+		"macros.html":             `{% macro M %}{{ render "partials/footer.html" }}{% end %}`,
+		"partials/footer.html":    `{{ render "copyright.html" }}`,
+		"partials/copyright.html": `(c)`,
+	}
+	template, err := scriggo.BuildTemplate(fsys, "index.html", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []scriggo.Dependency{
+		{Path: "layout.html", File: "index.html", Kind: scriggo.DependencyExtends, Position: scriggo.Position{Line: 1, Column: 4, Start: 3, End: 23}},
+		{Path: "macros.html", File: "layout.html", Kind: scriggo.DependencyImport, Position: scriggo.Position{Line: 1, Column: 11, Start: 10, End: 22}},
+		{Path: "partials/footer.html", File: "macros.html", Kind: scriggo.DependencyRender, Position: scriggo.Position{Line: 1, Column: 17, Start: 16, End: 44}},
+		{Path: "partials/copyright.html", File: "partials/footer.html", Kind: scriggo.DependencyRender, Position: scriggo.Position{Line: 1, Column: 4, Start: 3, End: 25}},
+		{Path: "macros.html", File: "index.html", Kind: scriggo.DependencyImport, Position: scriggo.Position{Line: 1, Column: 38, Start: 37, End: 49}},
+		{Path: "partials/footer.html", File: "index.html", Kind: scriggo.DependencyRender, Position: scriggo.Position{Line: 2, Column: 20, Start: 73, End: 101}},
+	}
+	deps := template.Dependencies()
+	if !reflect.DeepEqual(deps, expected) {
+		t.Fatalf("unexpected dependencies:\n%v\nexpected:\n%v", deps, expected)
+	}
+	// The dependencies are marshaled with the template.
+	data, err := template.MarshalBinary()
+	if err != nil {
+		t.Fatalf("cannot marshal: %s", err)
+	}
+	template, err = scriggo.LoadTemplate(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatalf("cannot load: %s", err)
+	}
+	deps = template.Dependencies()
+	if !reflect.DeepEqual(deps, expected) {
+		t.Fatalf("unexpected dependencies after load:\n%v\nexpected:\n%v", deps, expected)
+	}
+	// A file without dependencies.
+	template, err = scriggo.BuildTemplate(fsys, "partials/copyright.html", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deps = template.Dependencies(); len(deps) != 0 {
+		t.Fatalf("expected no dependencies, got %v", deps)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package misc
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/native"
+)
+
+type expressionOrder struct {
+	Total float64
+	Tags  []string
+}
+
+func expressionDecls() native.Declarations {
+	return native.Declarations{
+		"order": (*expressionOrder)(nil),
+		"limit": (*int)(nil),
+		"contains": func(s []string, v string) bool {
+			for _, e := range s {
+				if e == v {
+					return true
+				}
+			}
+			return false
+		},
+		"upper": strings.ToUpper,
+		"Max":   native.UntypedNumericConst("100"),
+		"strings": native.Package{
+			Name: "strings",
+			Declarations: native.Declarations{
+				"HasPrefix": strings.HasPrefix,
+			},
+		},
+	}
+}
+
+var boolType = reflect.TypeOf(false)
+
+func TestCompileExpression(t *testing.T) {
+	expr, err := scriggo.CompileExpression(`order.Total > Max && contains(order.Tags, "vip")`, expressionDecls(), boolType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expr.Type() != boolType {
+		t.Fatalf("expected type bool, got %s", expr.Type())
+	}
+	tests := []struct {
+		order    *expressionOrder
+		expected bool
+	}{
+		{&expressionOrder{Total: 150, Tags: []string{"new", "vip"}}, true},
+		{&expressionOrder{Total: 50, Tags: []string{"vip"}}, false},
+		{&expressionOrder{Total: 150, Tags: []string{"new"}}, false},
+	}
+	for _, test := range tests {
+		v, err := expr.Eval(map[string]interface{}{"order": test.order}, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if v != test.expected {
+			t.Fatalf("expected %t, got %v", test.expected, v)
+		}
+	}
+}
+
+func TestCompileExpressionResultType(t *testing.T) {
+	tests := []struct {
+		src      string
+		typ      reflect.Type
+		vars     map[string]interface{}
+		expected interface{}
+	}{
+		{`1 + 2`, reflect.TypeOf(float64(0)), nil, float64(3)},
+		{`1 + 2`, nil, nil, 3},
+		{`upper("a") + "b"`, nil, nil, "Ab"},
+		{`strings.HasPrefix("scriggo", "scr")`, boolType, nil, true},
+		{`limit * 2`, reflect.TypeOf(0), map[string]interface{}{"limit": 21}, 42},
+		{`func() int { s := 0; for i := 0; i < limit; i++ { s += i }; return s }()`, reflect.TypeOf(0), map[string]interface{}{"limit": 5}, 10},
+		{`[]int{1, 2}`, reflect.TypeOf([]interface{}{}).Elem(), nil, []int{1, 2}},
+	}
+	for _, test := range tests {
+		expr, err := scriggo.CompileExpression(test.src, expressionDecls(), test.typ)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", test.src, err)
+		}
+		v, err := expr.Eval(test.vars, nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", test.src, err)
+		}
+		if !reflect.DeepEqual(v, test.expected) {
+			t.Fatalf("%s: expected %#v, got %#v", test.src, test.expected, v)
+		}
+	}
+}
+
+func TestCompileExpressionErrors(t *testing.T) {
+	tests := []struct {
+		src      string
+		typ      reflect.Type
+		expected string
+	}{
+		{`order.Total >`, boolType, "expression:1:14: syntax error: unexpected EOF, expecting expression"},
+		{`order.Total > 1 1`, boolType, "expression:1:17: syntax error: unexpected int after expression"},
+		{`order.Total + missing`, nil, "expression:1:15: undefined: missing"},
+		{`order.Total`, boolType, "expression:1:6: cannot use order.Total (type float64) as type bool in expression result"},
+		{`1 + 2`, boolType, "expression:1:3: cannot use 1 + 2 (type untyped int) as type bool in expression result"},
+		{`nil`, boolType, "expression:1:1: cannot use nil as type bool in expression result"},
+		{`func() bool { var b bool = 1; return b }()`, boolType, "expression:1:28: cannot use 1 (type untyped int) as type bool in assignment"},
+		{`$result`, nil, "expression:1:1: syntax error: invalid character U+0024 '$'"},
+	}
+	for _, test := range tests {
+		_, err := scriggo.CompileExpression(test.src, expressionDecls(), test.typ)
+		if err == nil {
+			t.Fatalf("%s: expected error, got no error", test.src)
+		}
+		var e *scriggo.BuildError
+		if !errors.As(err, &e) {
+			t.Fatalf("%s: expected *scriggo.BuildError, got %T", test.src, err)
+		}
+		if e.Error() != test.expected {
+			t.Fatalf("%s: expected error %q, got %q", test.src, test.expected, e.Error())
+		}
+	}
+}
+
+func TestCompileExpressionPanic(t *testing.T) {
+	expr, err := scriggo.CompileExpression(`order.Tags[2]`, expressionDecls(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = expr.Eval(map[string]interface{}{"order": &expressionOrder{}}, nil)
+	var p *scriggo.PanicError
+	if !errors.As(err, &p) {
+		t.Fatalf("expected *scriggo.PanicError, got %v", err)
+	}
+	if p.Path() != "expression" {
+		t.Fatalf("expected path %q, got %q", "expression", p.Path())
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package misc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/internal/fstest"
+)
+
+var genericsTests = []struct {
+	name     string
+	src      string
+	expected string
+}{
+	{
+		name: "functions and type inference",
+		src: `
+		func Map[T, U any](s []T, f func(T) U) []U {
+			r := make([]U, 0, len(s))
+			for _, v := range s {
+				r = append(r, f(v))
+			}
+			return r
+		}
+
+		func Filter[S ~[]E, E any](s S, f func(E) bool) S {
+			var r S
+			for _, v := range s {
+				if f(v) {
+					r = append(r, v)
+				}
+			}
+			return r
+		}
+
+		type Ints []int
+
+		func main() {
+			s := Map([]int{1, 2, 3}, func(i int) string { return fmt.Sprint(i * 2) })
+			out.Print(s, " ", len(s), " ")
+			var evens Ints = Filter(Ints{1, 2, 3, 4}, func(i int) bool { return i%2 == 0 })
+			out.Print(len(evens), " ", Map[int, int](evens, func(i int) int { return -i }))
+		}`,
+		expected: "[2 4 6] 3 2 [-2 -4]",
+	},
+	{
+		name: "untyped constant arguments",
+		src: `
+		func Max[T ~int | ~float64](a, b T) T {
+			if a > b {
+				return a
+			}
+			return b
+		}
+
+		type Celsius float64
+
+		func main() {
+			out.Print(Max(3, 7), " ", Max(2, 2.5), " ", Max[float64](1, 0.5), " ", float64(Max(Celsius(1), 3)))
+		}`,
+		expected: "7 2.5 1 3",
+	},
+	{
+		name: "constraints",
+		src: `
+		type Number interface {
+			~int | ~int64 | ~float64
+		}
+
+		type Stringer interface {
+			comparable
+			String() string
+		}
+
+		func Sum[T Number](s ...T) T {
+			var t T
+			for _, v := range s {
+				t += v
+			}
+			return t
+		}
+
+		func Index[T comparable](s []T, v T) int {
+			for i, w := range s {
+				if w == v {
+					return i
+				}
+			}
+			return -1
+		}
+
+		func Join[T Stringer](s ...T) string {
+			var b string
+			for _, v := range s {
+				b += v.String()
+			}
+			return b
+		}
+
+		type Color int
+
+		func (c Color) String() string { return [...]string{"r", "g", "b"}[c] }
+
+		func main() {
+			out.Print(Sum(1, 2, 3), " ", Sum(1.5, 2), " ", int(Sum[Color](1, 1)), " ")
+			out.Print(Index([]string{"a", "b"}, "b"), " ", Join(Color(0), Color(2)))
+		}`,
+		expected: "6 3.5 2 1 rb",
+	},
+	{
+		name: "generic types and methods",
+		src: `
+		type Stack[T any] struct {
+			items []T
+		}
+
+		func (s *Stack[T]) Push(v T) { s.items = append(s.items, v) }
+
+		func (s *Stack[T]) Pop() T {
+			v := s.items[len(s.items)-1]
+			s.items = s.items[:len(s.items)-1]
+			return v
+		}
+
+		func (s Stack[T]) Len() int { return len(s.items) }
+
+		type Pair[K comparable, V any] struct {
+			Key K
+			Val V
+		}
+
+		func (p Pair[K, V]) String() string { return fmt.Sprint(p.Key, "=", p.Val) }
+
+		func NewPair[K comparable, V any](k K, v V) Pair[K, V] {
+			return Pair[K, V]{k, v}
+		}
+
+		var stack = &Stack[string]{}
+
+		func main() {
+			var s Stack[int]
+			s.Push(1)
+			s.Push(2)
+			out.Print(s.Len(), " ", s.Pop(), " ", s.Len(), " ")
+			stack.Push("a")
+			out.Print(stack.Pop(), " ")
+			var st fmt.Stringer = NewPair("a", 1)
+			out.Print(st.String(), " ", Pair[int, bool]{1, true}.String())
+		}`,
+		expected: "2 2 1 a a=1 1=true",
+	},
+	{
+		name: "function values",
+		src: `
+		func Apply[T any](v T, fs ...func(T) T) T {
+			for _, f := range fs {
+				v = f(v)
+			}
+			return v
+		}
+
+		func main() {
+			double := func(i int) int { return i * 2 }
+			f := Apply[int]
+			out.Print(f(1, double, double), " ", Apply("a", func(s string) string { return s + "b" }))
+		}`,
+		expected: "4 ab",
+	},
+}
+
+func TestGenerics(t *testing.T) {
+	for _, test := range genericsTests {
+		t.Run(test.name, func(t *testing.T) {
+			var out strings.Builder
+			src := "package main\n\nimport (\n\t\"fmt\"\n\t\"out\"\n)\n\nvar _ = fmt.Sprint\n" + test.src
+			opts := &scriggo.BuildOptions{Packages: methodsPackages(&out)}
+			program, err := scriggo.Build(fstest.Files{"main.go": src}, opts)
+			if err != nil {
+				t.Fatalf("build error: %s", err)
+			}
+			err = program.Run(nil)
+			if err != nil {
+				t.Fatalf("run error: %s", err)
+			}
+			if out.String() != test.expected {
+				t.Fatalf("expected %q, got %q", test.expected, out.String())
+			}
+		})
+	}
+}
+
+func TestGenericsImport(t *testing.T) {
+	var out strings.Builder
+	files := fstest.Files{
+		"go.mod": "module a.b",
+		"main.go": `package main
+			import (
+				"a.b/list"
+				"out"
+			)
+			func main() {
+				l := list.New("a", "b")
+				l.Add("c")
+				l.Each(func(s string) { out.Print(s) })
+				var m list.List[int]
+				m.Add(1)
+				out.Print(" ", m.Len(), " ", len(list.Keys(map[int]bool{1: true, 2: false})))
+			}`,
+		"list/list.go": `package list
+			import "fmt"
+			type List[T any] struct {
+				items []T
+			}
+			func New[T any](items ...T) *List[T] {
+				return &List[T]{items: items}
+			}
+			func (l *List[T]) Add(v T) { l.items = append(l.items, v) }
+			func (l *List[T]) Each(f func(T)) {
+				for _, v := range l.items {
+					f(v)
+				}
+			}
+			func (l List[T]) Len() int { return len(fmt.Sprint(l.items)) - 2 }
+			func Keys[K comparable, V any](m map[K]V) []K {
+				keys := make([]K, 0, len(m))
+				for k := range m {
+					keys = append(keys, k)
+				}
+				return keys
+			}`,
+	}
+	opts := &scriggo.BuildOptions{Packages: methodsPackages(&out)}
+	program, err := scriggo.Build(files, opts)
+	if err != nil {
+		t.Fatalf("build error: %s", err)
+	}
+	err = program.Run(nil)
+	if err != nil {
+		t.Fatalf("run error: %s", err)
+	}
+	if expected := "abc 1 2"; out.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, out.String())
+	}
+}
+
+var genericsErrorTests = []struct {
+	src string
+	err string
+}{
+	{"func F[T any](x T) T { return x }\nvar _ = F", "main:3:9: cannot use generic function F without instantiation"},
+	{"func F[T any](x T) T { return x }\nvar _ = F[int, string]", "main:3:10: got 2 type arguments but F has 1 type parameters"},
+	{"func F[T, U any](x T) (u U) { return }\nvar _ = F(1)", "main:3:10: cannot infer U"},
+	{"func F[T ~int](x T) T { return x }\nvar _ = F(\"a\")", "main:3:9: string does not satisfy ~int (string missing in ~int)"},
+	{"func F[T comparable](x T) {}\nfunc g() { F([]int{}) }", "main:3:12: []int does not satisfy comparable"},
+	{"type I interface { M() }\nfunc F[T I](x T) {}\nfunc g() { F(1) }", "main:4:12: int does not satisfy I (missing method M)"},
+	{"type S[T any] struct{ v T }\nvar _ S", "main:3:7: cannot use generic type S without instantiation"},
+	{"type S[T any] struct{ v T }\nvar _ S[int, int]", "main:3:8: got 2 type arguments but S has 1 type parameters"},
+	{"type N interface { ~int | ~string }\nvar _ N", "main:3:7: cannot use type N outside a type constraint: interface contains type constraints"},
+	{"type C interface { comparable }\nvar _ C", "main:3:7: cannot use type C outside a type constraint: interface is (or embeds) comparable"},
+	{"func F[T any](x T) T { return x + 1 }\nvar _ = F(\"a\")", "main:2:33: invalid operation: x + 1 (cannot convert 1 (type untyped int) to type string)"},
+	{"func init[T any]() {}", "main:2:6: func init must have no type parameters"},
+	{"func F[T any, T any]() {}", "main:2:15: T redeclared in this block"},
+	{"func f() { type S[T any] struct{} }", "main:2:12: generic type S cannot be declared inside a function"},
+	{"var _ = ~1", "main:2:9: cannot use ~ outside of interface or type constraint"},
+	{"type S[T any] struct{}\nfunc (s S[T, U]) M() {}", "main:3:10: got 2 type parameters, but receiver base type declares 1"},
+	{"type S int\nfunc (s S[T]) M() {}", "main:3:9: S is not a generic type"},
+	{"var a [3]int\nvar _ = a[1, 2]", "main:3:10: invalid operation: more than one index"},
+}
+
+func TestGenericsErrors(t *testing.T) {
+	for _, test := range genericsErrorTests {
+		src := "package main\n" + test.src + "\nfunc main() {}\n"
+		_, err := scriggo.Build(fstest.Files{"main.go": src}, nil)
+		if err == nil {
+			t.Errorf("source %q: expected error %q, got no error", test.src, test.err)
+			continue
+		}
+		if err.Error() != test.err {
+			t.Errorf("source %q: expected error %q, got %q", test.src, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package misc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/internal/fstest"
+	"github.com/open2b/scriggo/native"
+)
+
+func TestProgramMaxInstructions(t *testing.T) {
+	src := "package main\n\nfunc main() {\n\ts := 0\n\tfor i := 0; ; i++ {\n\t\ts += i\n\t}\n\t_ = s\n}\n"
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var first *scriggo.InstructionLimitError
+	for i := 0; i < 3; i++ {
+		err = program.Run(&scriggo.RunOptions{MaxInstructions: 1000})
+		if err == nil {
+			t.Fatal("expected error, got no error")
+		}
+		var e *scriggo.InstructionLimitError
+		if !errors.As(err, &e) {
+			t.Fatalf("expected *scriggo.InstructionLimitError, got %T", err)
+		}
+		if e.Error() != "instruction limit of 1000 exceeded" {
+			t.Fatalf("unexpected error message %q", e.Error())
+		}
+		if e.Limit() != 1000 {
+			t.Fatalf("expected limit 1000, got %d", e.Limit())
+		}
+		if e.Path() != "main" {
+			t.Fatalf("expected path %q, got %q", "main", e.Path())
+		}
+		if line := e.Position().Line; line < 5 || line > 6 {
+			t.Fatalf("expected position in the loop, got %s", e.Position())
+		}
+		if first == nil {
+			first = e
+		} else if e.Position() != first.Position() {
+			t.Fatalf("expected position %s, got %s", first.Position(), e.Position())
+		}
+	}
+}
+
+func TestProgramMaxInstructionsNotExceeded(t *testing.T) {
+	src := "package main\n\nfunc main() {\n\ts := 0\n\tfor i := 0; i < 10; i++ {\n\t\ts += i\n\t}\n\tprint(s)\n}\n"
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out interface{}
+	err = program.Run(&scriggo.RunOptions{MaxInstructions: 1000, Print: func(v interface{}) { out = v }})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out != 45 {
+		t.Fatalf("expected output 45, got %v", out)
+	}
+}
+
+func TestTemplateNativeCallCost(t *testing.T) {
+	calls := 0
+	fsys := fstest.Files{"index.html": "{% for _, s := range list %}{{ f(s) }}{% end %}"}
+	opts := &scriggo.BuildOptions{
+		Globals: native.Declarations{
+			"list": &[]string{"a", "b", "c", "d", "e", "f", "g", "h"},
+			"f": func(s string) string {
+				calls++
+				return s
+			},
+		},
+	}
+	template, err := scriggo.BuildTemplate(fsys, "index.html", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without cost, the template completes.
+	var b strings.Builder
+	err = template.Run(&b, nil, &scriggo.RunOptions{MaxInstructions: 1000})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if b.String() != "abcdefgh" {
+		t.Fatalf("expected output %q, got %q", "abcdefgh", b.String())
+	}
+	// With a cost of 300 instructions for each call to f, only three calls
+	// are executed.
+	calls = 0
+	b.Reset()
+	var names []string
+	cost := func(pkg, name string) int64 {
+		names = append(names, name)
+		return 300
+	}
+	err = template.Run(&b, nil, &scriggo.RunOptions{MaxInstructions: 1000, NativeCallCost: cost})
+	var e *scriggo.InstructionLimitError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected *scriggo.InstructionLimitError, got %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 calls, got %d", calls)
+	}
+	if b.String() != "abc" {
+		t.Fatalf("expected output %q, got %q", "abc", b.String())
+	}
+	if len(names) != 4 || names[0] != "f" {
+		t.Fatalf("unexpected calls to the cost function: %v", names)
+	}
+	if pos := e.Position(); pos.Line != 1 || pos.Column != 33 {
+		t.Fatalf("expected position 1:33, got %s", pos)
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package misc
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/internal/fstest"
+	"github.com/open2b/scriggo/native"
+)
+
+type interfacesSquare float64
+
+func (s interfacesSquare) Area() float64 { return float64(s * s) }
+
+func interfacesPackages(out *strings.Builder) native.Packages {
+	packages := methodsPackages(out)
+	packages["geo"] = native.Package{
+		Name: "geo",
+		Declarations: native.Declarations{
+			"Square": reflect.TypeOf(interfacesSquare(0)),
+		},
+	}
+	return packages
+}
+
+var interfacesTests = []struct {
+	name     string
+	src      string
+	expected string
+}{
+	{
+		name: "dynamic dispatch",
+		src: `
+		type Shape interface {
+			Area() float64
+		}
+
+		type Rect struct{ W, H float64 }
+
+		func (r Rect) Area() float64 { return r.W * r.H }
+
+		type Circle float64
+
+		func (c *Circle) Area() float64 { return 3 * float64(*c) * float64(*c) }
+
+		func total(shapes ...Shape) float64 {
+			t := 0.0
+			for _, s := range shapes {
+				t += s.Area()
+			}
+			return t
+		}
+
+		func main() {
+			c := Circle(1)
+			var s Shape = Rect{2, 3}
+			out.Print(s.Area(), " ")
+			s = &c
+			c = 2
+			out.Print(s.Area(), " ", total(Rect{1, 1}, &c, geo.Square(3)))
+		}`,
+		expected: "6 12 22",
+	},
+	{
+		name: "unexported methods and method values",
+		src: `
+		type namer interface {
+			name() string
+		}
+
+		type T struct{ s string }
+
+		func (t T) name() string { return t.s }
+
+		func main() {
+			var n namer = T{"a"}
+			f := n.name
+			n = T{"b"}
+			out.Print(f(), n.name())
+		}`,
+		expected: "ab",
+	},
+	{
+		name: "embedded interfaces",
+		src: `
+		type Shape interface {
+			Area() float64
+		}
+
+		type Named interface {
+			fmt.Stringer
+			Shape
+		}
+
+		type Rect struct{ W, H float64 }
+
+		func (r Rect) Area() float64 { return r.W * r.H }
+
+		func (r Rect) String() string { return fmt.Sprintf("%vx%v", r.W, r.H) }
+
+		func main() {
+			var n Named = Rect{2, 3}
+			var s Shape = n
+			var st fmt.Stringer = n
+			out.Print(n.String(), " ", s.Area(), " ", st, " ", fmt.Sprint(n))
+		}`,
+		expected: "2x3 6 2x3 2x3",
+	},
+	{
+		name: "type assertions",
+		src: `
+		type Shape interface {
+			Area() float64
+		}
+
+		type Named interface {
+			Shape
+			Name() string
+		}
+
+		type Rect struct{ W, H float64 }
+
+		func (r Rect) Area() float64 { return r.W * r.H }
+
+		func main() {
+			var i interface{} = Rect{2, 3}
+			s, ok := i.(Shape)
+			out.Print(s.Area(), " ", ok, " ")
+			_, ok = i.(Named)
+			out.Print(ok, " ")
+			_, ok = s.(Named)
+			out.Print(ok, " ")
+			r := s.(Rect)
+			out.Print(r.W, " ")
+			i = geo.Square(2)
+			out.Print(i.(Shape).Area(), " ")
+			i = 5
+			_, ok = i.(Shape)
+			out.Print(ok)
+		}`,
+		expected: "6 true false false 2 4 false",
+	},
+	{
+		name: "type switches",
+		src: `
+		type Shape interface {
+			Area() float64
+		}
+
+		type Named interface {
+			Shape
+			fmt.Stringer
+		}
+
+		type Rect struct{ W, H float64 }
+
+		func (r Rect) Area() float64 { return r.W * r.H }
+
+		func (r Rect) String() string { return "rect" }
+
+		type Circle float64
+
+		func (c Circle) Area() float64 { return 3 * float64(c) * float64(c) }
+
+		func describe(v interface{}) string {
+			switch v := v.(type) {
+			case Named:
+				return fmt.Sprint(v, " ", v.Area())
+			case Shape:
+				return fmt.Sprint("shape ", v.Area())
+			case nil:
+				return "nil"
+			}
+			return "other"
+		}
+
+		func main() {
+			out.Print(describe(Rect{1, 2}), ", ", describe(Circle(1)), ", ", describe(nil), ", ", describe(1))
+		}`,
+		expected: "rect 2, shape 3, nil, other",
+	},
+	{
+		name: "comparison and nil",
+		src: `
+		type Shape interface {
+			Area() float64
+		}
+
+		type Square float64
+
+		func (s Square) Area() float64 { return float64(s * s) }
+
+		func main() {
+			var s Shape
+			out.Print(s == nil, " ")
+			s = Square(2)
+			var t interface{ Area() float64 } = Square(2)
+			out.Print(s == nil, " ", s == t, " ", s == Square(3))
+		}`,
+		expected: "true false true false",
+	},
+}
+
+func TestInterfaces(t *testing.T) {
+	for _, test := range interfacesTests {
+		t.Run(test.name, func(t *testing.T) {
+			var out strings.Builder
+			src := "package main\n\nimport (\n\t\"fmt\"\n\t\"geo\"\n\t\"out\"\n)\n\nvar _ = fmt.Sprint\nvar _ geo.Square\n" + test.src
+			opts := &scriggo.BuildOptions{Packages: interfacesPackages(&out)}
+			program, err := scriggo.Build(fstest.Files{"main.go": src}, opts)
+			if err != nil {
+				t.Fatalf("build error: %s", err)
+			}
+			err = program.Run(nil)
+			if err != nil {
+				t.Fatalf("run error: %s", err)
+			}
+			if out.String() != test.expected {
+				t.Fatalf("expected %q, got %q", test.expected, out.String())
+			}
+		})
+	}
+}
+
+func TestInterfacesAssertionPanic(t *testing.T) {
+	src := "package main\n\ntype Shape interface{ Area() float64 }\n\ntype T int\n\nfunc main() {\n\tvar i interface{} = T(1)\n\t_ = i.(Shape)\n}\n"
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, nil)
+	if err != nil {
+		t.Fatalf("build error: %s", err)
+	}
+	err = program.Run(nil)
+	var e *scriggo.PanicError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected *scriggo.PanicError, got %v", err)
+	}
+	expected := "interface conversion: T is not Shape: missing method Area"
+	if msg := e.Error(); !strings.Contains(msg, expected) {
+		t.Fatalf("expected panic %q, got %q", expected, msg)
+	}
+}
+
+var interfacesErrorTests = []struct {
+	src string
+	err string
+}{
+	{"type I interface { M(); M() }", "main:2:25: duplicate method M"},
+	{"type I interface { _() }", "main:2:20: methods must have a unique non-blank name"},
+	{"type I interface { int }\nvar _ I", "main:3:7: cannot use type I outside a type constraint: interface contains type constraints"},
+	{"type I interface { M() }\ntype J interface { I; M(int) }", "main:3:23: duplicate method M"},
+	{"type I interface { M() }\ntype T int\nvar _ I = T(0)", "main:4:12: cannot use T(0) (type T) as type I in assignment"},
+	{"type I interface { M() }\ntype T int\nfunc (t *T) M() {}\nfunc f(i I) { _ = i.(T) }", "main:5:20: impossible type assertion:\n\tT does not implement I (M method has pointer receiver)"},
+	{"type I interface { M() }\nvar _ = I.M", "main:3:10: method expression I.M on interface type defined in Scriggo is not supported in this release of Scriggo"},
+}
+
+func TestInterfacesErrors(t *testing.T) {
+	for _, test := range interfacesErrorTests {
+		src := "package main\n" + test.src + "\nfunc main() {}\n"
+		_, err := scriggo.Build(fstest.Files{"main.go": src}, nil)
+		if err == nil {
+			t.Errorf("source %q: expected error %q, got no error", test.src, test.err)
+			continue
+		}
+		if err.Error() != test.err {
+			t.Errorf("source %q: expected error %q, got %q", test.src, test.err, err)
+		}
+	}
+}
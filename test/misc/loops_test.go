@@ -0,0 +1,303 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package misc
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/internal/fstest"
+	"github.com/open2b/scriggo/native"
+)
+
+type loopsScores map[string]int
+
+var loopsProgramTests = []struct {
+	name     string
+	src      string
+	expected string
+}{
+	{"slices", `package main
+
+import "out"
+
+func main() {
+	is := []int{1, 2, 3}
+	fs := []float64{0.5, 1.5}
+	ss := []string{"a", "b"}
+	for i, v := range is {
+		out.Print(i, v, is[i], " ")
+	}
+	for i, v := range fs {
+		out.Print(v+fs[i], " ")
+	}
+	for i := range ss {
+		out.Print(ss[i])
+	}
+	for _, s := range ss {
+		out.Print(s)
+	}
+	var nilSlice []int
+	for range nilSlice {
+		out.Print("unexpected")
+	}
+}
+`, "0 1 1 1 2 2 2 3 3 1 3 abab"},
+	{"named slices", `package main
+
+import (
+	"loops"
+	"out"
+)
+
+type Names []string
+
+func main() {
+	ns := Names{"x", "y"}
+	for i, n := range ns {
+		out.Print(i, n, ns[i])
+	}
+	is := loops.IntSlice{3, 4}
+	for i := 0; i < len(is); i++ {
+		out.Print(is[i])
+	}
+	for _, v := range loops.Floats {
+		out.Print(" ", v)
+	}
+}
+`, "0xx1yy34 1.5 2.5"},
+	{"maps", `package main
+
+import (
+	"loops"
+	"out"
+)
+
+type point struct{ x, y int }
+
+func main() {
+	s := "z"
+	for s = range map[string]int{"a": 1} {
+	}
+	out.Print(s, " ")
+	for k, v := range map[string]bool{"t": true} {
+		out.Print(k, v, " ")
+	}
+	for k, v := range map[string]float64{"f": 1.5} {
+		out.Print(k, v, " ")
+	}
+	for k, v := range map[string]string{"k": "v"} {
+		out.Print(k, v, " ")
+	}
+	for k, v := range map[string]point{"p": {1, 2}} {
+		out.Print(k, v.x+v.y, " ")
+	}
+	for k, v := range loops.Scores {
+		out.Print(k, v)
+	}
+}
+`, "a ttrue f1.5 kv p3 a5"},
+	{"for statements", `package main
+
+import "out"
+
+func main() {
+	s := []int{1, 2, 3}
+	t := 0
+	for i := 0; i < len(s); i++ {
+		t += s[i]
+	}
+	out.Print(t, " ")
+	for i := 0; i < len(s); i++ {
+		if i == 0 {
+			s = append(s, 4)
+		}
+		out.Print(s[i])
+	}
+	out.Print(" ")
+	for i := 0; i < len(s); i++ {
+		out.Print(s[i])
+		i++
+	}
+	out.Print(" ")
+	for i := 0; i < len(s); i++ {
+		s := []int{7}
+		out.Print(s[0])
+	}
+}
+`, "6 1234 13 7777"},
+	{"break and continue", `package main
+
+import "out"
+
+func main() {
+	s := []int{1, 2, 3}
+	for i := range s {
+		for j := 0; j < 3; j++ {
+			if j == 1 {
+				continue
+			}
+			if j == 2 {
+				break
+			}
+			out.Print(i, j, " ")
+		}
+		if i == 1 {
+			break
+		}
+	}
+	for j := 0; j < 2; j++ {
+		for _, v := range s {
+			if v == 2 {
+				break
+			}
+			out.Print(j, v, " ")
+		}
+	}
+	k := 0
+	for ; ; k++ {
+		if k < 2 {
+			continue
+		}
+		break
+	}
+	out.Print(k)
+}
+`, "0 0 1 0 0 1 1 1 2"},
+	{"continue in a for statement without condition", `package main
+
+import "out"
+
+func main() {
+	n := 0
+	for i := 0; ; i++ {
+		n++
+		if n > 10 || i == 6 {
+			break
+		}
+		if i%2 == 0 {
+			continue
+		}
+		out.Print(i)
+	}
+	out.Print(" ", n, " ")
+	for j := 0; j < 3; j++ {
+		for {
+			n++
+			break
+		}
+		if n > 20 {
+			break
+		}
+		if j == 1 {
+			continue
+		}
+		out.Print(j)
+	}
+}
+`, "135 7 02"},
+	{"keys in registers of their kind", `package main
+
+import "out"
+
+func main() {
+	s := "s"
+	for k := range map[string]bool{"k": true} {
+		out.Print(k, s, " ")
+	}
+	f := 0.5
+	for k := range map[float64]bool{1.5: true} {
+		out.Print(k, " ", f, " ")
+	}
+	ch := make(chan string, 1)
+	ch <- "c"
+	close(ch)
+	for v := range ch {
+		out.Print(v, s)
+	}
+}
+`, "ks 1.5 0.5 cs"},
+	{"index out of range", `package main
+
+import "out"
+
+func main() {
+	defer func() {
+		out.Print(recover())
+	}()
+	s := []int{1, 2}
+	for i := range s {
+		out.Print(s[i+1], " ")
+	}
+}
+`, "2 runtime error: index out of range [2] with length 2"},
+}
+
+// loopsPackages returns the packages used by the loops tests.
+func loopsPackages(out *strings.Builder) native.Packages {
+	packages := methodsPackages(out)
+	packages["loops"] = native.Package{
+		Name: "loops",
+		Declarations: native.Declarations{
+			"IntSlice": reflect.TypeOf(sort.IntSlice(nil)),
+			"Floats":   &sort.Float64Slice{1.5, 2.5},
+			"Scores":   &loopsScores{"a": 5},
+		},
+	}
+	return packages
+}
+
+// TestLoops tests the loops on slices and maps, with and without the
+// bytecode optimization.
+func TestLoops(t *testing.T) {
+	for _, test := range loopsProgramTests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, optimize := range []bool{false, true} {
+				var out strings.Builder
+				opts := &scriggo.BuildOptions{Packages: loopsPackages(&out), Optimize: optimize}
+				program, err := scriggo.Build(fstest.Files{"main.go": test.src}, opts)
+				if err != nil {
+					t.Fatalf("optimize %t: build error: %s", optimize, err)
+				}
+				err = program.Run(nil)
+				if err != nil {
+					t.Fatalf("optimize %t: run error: %s", optimize, err)
+				}
+				if out.String() != test.expected {
+					t.Fatalf("optimize %t: expected %q, got %q", optimize, test.expected, out.String())
+				}
+			}
+		})
+	}
+}
+
+// TestLoopsTemplate tests the loops on slices and maps in templates.
+func TestLoopsTemplate(t *testing.T) {
+	src := `{% for i := 0; i < len(rows); i++ %}{{ rows[i] }}{% end %} ` +
+		`{% for name in names %}{{ name }}{% end %} ` +
+		`{% for k, v := range scores %}{{ k }}={{ v }}{% end %} ` +
+		`{% for _, v := range sort.IntSlice(rows) %}{{ v }}{% end %}`
+	globals := native.Declarations{
+		"rows":   &[]int{1, 2, 3},
+		"names":  &[]string{"a", "b"},
+		"scores": &map[string]int{"x": 7},
+		"sort":   native.Package{Name: "sort", Declarations: native.Declarations{"IntSlice": reflect.TypeOf(sort.IntSlice(nil))}},
+	}
+	template, err := scriggo.BuildTemplate(fstest.Files{"index.html": src}, "index.html", &scriggo.BuildOptions{Globals: globals})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	err = template.Run(&b, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "123 ab x=7 123"; b.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, b.String())
+	}
+}
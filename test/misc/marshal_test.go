@@ -0,0 +1,268 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package misc
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/internal/fstest"
+	"github.com/open2b/scriggo/native"
+)
+
+type marshalPoint struct {
+	X, Y int
+}
+
+func (p marshalPoint) Sum() int { return p.X + p.Y }
+
+var marshalCounter = 5
+
+func marshalPackages(sum interface{}) native.Packages {
+	return native.Packages{
+		"pkg": native.Package{
+			Name: "pkg",
+			Declarations: native.Declarations{
+				"Sum":     sum,
+				"Counter": &marshalCounter,
+				"Point":   reflect.TypeOf(marshalPoint{}),
+				"Upper":   strings.ToUpper,
+				"Sprint":  fmt.Sprint,
+			},
+		},
+		"fmt": native.Package{
+			Name: "fmt",
+			Declarations: native.Declarations{
+				"Stringer": reflect.TypeOf((*fmt.Stringer)(nil)).Elem(),
+			},
+		},
+	}
+}
+
+const marshalProgram = `package main
+
+import "pkg"
+
+type Celsius float64
+
+type Pair struct {
+	a, b Celsius
+}
+
+type Summer interface {
+	Sum() Celsius
+}
+
+func (p Pair) Sum() Celsius { return p.a + p.b }
+
+func (c *Celsius) Inc() { *c++ }
+
+func (c Celsius) String() string { return "C" }
+
+func apply(f func(int, int) int, a, b int) int {
+	return f(a, b)
+}
+
+func main() {
+	n := 10
+	inc := func() { n++ }
+	inc()
+	p := pkg.Point{X: 1, Y: 2}
+	sum := pkg.Point.Sum
+	c := complex(1, 2) * complex(3, 4)
+	pair := Pair{a: 20.5, b: 0.5}
+	pair.b.Inc()
+	s := interface{}(pair).(Summer)
+	pkg.Counter++
+	print(n, " ", apply(pkg.Sum, 3, 4), " ", sum(p), " ", pkg.Upper("a"), " ", real(c), " ", float64(s.Sum()), " ", pkg.Counter, " ", pkg.Sprint(pair.a))
+}
+`
+
+func TestProgramMarshalBinary(t *testing.T) {
+	sum := func(a, b int) int { return a + b }
+	opts := &scriggo.BuildOptions{Packages: marshalPackages(sum)}
+	program, err := scriggo.Build(fstest.Files{"main.go": marshalProgram}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := program.MarshalBinary()
+	if err != nil {
+		t.Fatalf("cannot marshal: %s", err)
+	}
+	var b bytes.Buffer
+	n, err := program.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("cannot write: %s", err)
+	}
+	if n != int64(len(data)) || !bytes.Equal(data, b.Bytes()) {
+		t.Fatalf("WriteTo and MarshalBinary return different encodings")
+	}
+	marshalCounter = 5
+	program, err = scriggo.LoadProgram(bytes.NewReader(data), opts)
+	if err != nil {
+		t.Fatalf("cannot load: %s", err)
+	}
+	var out strings.Builder
+	err = program.Run(&scriggo.RunOptions{Print: func(v interface{}) { out.WriteString(fmt.Sprint(v)) }})
+	if err != nil {
+		t.Fatalf("run error: %s", err)
+	}
+	expected := "11 7 3 A -5 22 6 C"
+	if out.String() != expected {
+		t.Fatalf("expected output %q, got %q", expected, out.String())
+	}
+}
+
+func TestProgramLoadErrors(t *testing.T) {
+	sum := func(a, b int) int { return a + b }
+	opts := &scriggo.BuildOptions{Packages: marshalPackages(sum)}
+	program, err := scriggo.Build(fstest.Files{"main.go": marshalProgram}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := program.MarshalBinary()
+	if err != nil {
+		t.Fatalf("cannot marshal: %s", err)
+	}
+	tests := []struct {
+		opts     *scriggo.BuildOptions
+		expected string
+	}{
+		{nil, `scriggo: cannot find package "pkg"`},
+		{&scriggo.BuildOptions{Packages: marshalPackages(func(a, b int64) int64 { return a + b })}, "scriggo: Sum does not have type func(int, int) int"},
+		{&scriggo.BuildOptions{Packages: native.Packages{"pkg": native.Package{Name: "pkg"}}}, "scriggo: type github.com/open2b/scriggo/test/misc.marshalPoint does not exist"},
+	}
+	for _, test := range tests {
+		_, err = scriggo.LoadProgram(bytes.NewReader(data), test.opts)
+		if err == nil {
+			t.Fatalf("expected error %q, got no error", test.expected)
+		}
+		if err.Error() != test.expected {
+			t.Fatalf("expected error %q, got %q", test.expected, err)
+		}
+	}
+	_, err = scriggo.LoadTemplate(bytes.NewReader(data), opts)
+	if err == nil {
+		t.Fatal("expected error loading a program as a template, got no error")
+	}
+	_, err = scriggo.LoadProgram(bytes.NewReader(data[:len(data)/2]), opts)
+	if err == nil || err.Error() != "scriggo: invalid code" {
+		t.Fatalf("expected error %q, got %v", "scriggo: invalid code", err)
+	}
+}
+
+func TestProgramMarshalBinaryError(t *testing.T) {
+	src := `package main
+
+	import "fmt"
+
+	func main() {
+		_ = fmt.Stringer.String
+	}`
+	opts := &scriggo.BuildOptions{Packages: marshalPackages(nil)}
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = program.MarshalBinary()
+	if err == nil {
+		t.Fatal("expected error, got no error")
+	}
+	expected := "scriggo: cannot marshal value of type func(fmt.Stringer) string: it is not a native declaration"
+	if err.Error() != expected {
+		t.Fatalf("expected error %q, got %q", expected, err)
+	}
+}
+
+func TestTemplateMarshalBinary(t *testing.T) {
+	fsys := fstest.Files{
+		"index.html":   `{% extends "layout.html" %}{% import "imp.html" %}{% macro Body %}{{ Title(title) }} {{ upper(name) }} {{ n }}{% end %}`,
+		"layout.html":  `<b>{{ Body() }}</b>{{ render "partial.html" }}`,
+		"imp.html":     `{% macro Title(s string) %}[{{ s }}]{% end %}`,
+		"partial.html": `{% for i := range []int{0, 1, 2} %}{{ i }}{% end %}`,
+	}
+	title := "home"
+	opts := &scriggo.BuildOptions{
+		Globals: native.Declarations{
+			"upper": strings.ToUpper,
+			"title": &title,
+			"name":  (*string)(nil),
+			"n":     native.UntypedNumericConst("42"),
+		},
+	}
+	template, err := scriggo.BuildTemplate(fsys, "index.html", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := template.MarshalBinary()
+	if err != nil {
+		t.Fatalf("cannot marshal: %s", err)
+	}
+	template, err = scriggo.LoadTemplate(bytes.NewReader(data), opts)
+	if err != nil {
+		t.Fatalf("cannot load: %s", err)
+	}
+	var b bytes.Buffer
+	err = template.Run(&b, map[string]interface{}{"name": "scriggo"}, nil)
+	if err != nil {
+		t.Fatalf("run error: %s", err)
+	}
+	expected := "<b>[home] SCRIGGO 42</b>012"
+	if b.String() != expected {
+		t.Fatalf("expected output %q, got %q", expected, b.String())
+	}
+	if vars := template.UsedVars(); len(vars) != 2 || vars[0] != "name" || vars[1] != "title" {
+		t.Fatalf("expected used vars [name title], got %v", vars)
+	}
+	// Load the template with an incompatible global.
+	opts.Globals["upper"] = func(s string) []byte { return []byte(s) }
+	_, err = scriggo.LoadTemplate(bytes.NewReader(data), opts)
+	if err == nil {
+		t.Fatal("expected error, got no error")
+	}
+	expected = "scriggo: upper does not have type func(string) string"
+	if err.Error() != expected {
+		t.Fatalf("expected error %q, got %q", expected, err)
+	}
+}
+
+// TestProgramLoadCorrupted tests that loading a corrupted or truncated
+// program returns an error or a program, but does not panic.
+func TestProgramLoadCorrupted(t *testing.T) {
+	sum := func(a, b int) int { return a + b }
+	opts := &scriggo.BuildOptions{Packages: marshalPackages(sum)}
+	program, err := scriggo.Build(fstest.Files{"main.go": marshalProgram}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := program.MarshalBinary()
+	if err != nil {
+		t.Fatalf("cannot marshal: %s", err)
+	}
+	load := func(data []byte, desc string) {
+		defer func() {
+			if r := recover(); r != nil {
+				t.Fatalf("%s: unexpected panic: %v", desc, r)
+			}
+		}()
+		_, _ = scriggo.LoadProgram(bytes.NewReader(data), opts)
+	}
+	corrupted := make([]byte, len(data))
+	for i := range data {
+		for _, b := range []byte{0x00, data[i] ^ 0x01, data[i] ^ 0xff} {
+			if b == data[i] {
+				continue
+			}
+			copy(corrupted, data)
+			corrupted[i] = b
+			load(corrupted, fmt.Sprintf("byte %d set to %#x", i, b))
+		}
+		load(data[:i], fmt.Sprintf("truncated at %d", i))
+	}
+}
@@ -0,0 +1,419 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package misc
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/internal/fstest"
+	"github.com/open2b/scriggo/native"
+)
+
+func methodsPackages(out *strings.Builder) native.Packages {
+	return native.Packages{
+		"fmt": native.Package{
+			Name: "fmt",
+			Declarations: native.Declarations{
+				"Stringer": reflect.TypeOf((*fmt.Stringer)(nil)).Elem(),
+				"Sprint":   fmt.Sprint,
+				"Sprintf":  fmt.Sprintf,
+			},
+		},
+		"out": native.Package{
+			Name: "out",
+			Declarations: native.Declarations{
+				"Print": func(a ...interface{}) { out.WriteString(fmt.Sprint(a...)) },
+				"Error": func(err error) string { return "error: " + err.Error() },
+			},
+		},
+	}
+}
+
+var methodsTests = []struct {
+	name     string
+	src      string
+	expected string
+}{
+	{
+		name: "value and pointer receivers",
+		src: `
+		type Counter struct{ n int }
+
+		func (c Counter) Value() int { return c.n }
+
+		func (c *Counter) Add(n int) { c.n += n }
+
+		func main() {
+			var c Counter
+			c.Add(2)
+			p := &c
+			p.Add(3)
+			out.Print(c.Value(), " ", p.Value())
+		}`,
+		expected: "5 5",
+	},
+	{
+		name: "value receiver is a copy",
+		src: `
+		type Point struct{ X, Y int }
+
+		func (p Point) Move() Point { p.X++; return p }
+
+		func main() {
+			p := Point{1, 2}
+			q := p.Move()
+			out.Print(p.X, " ", q.X)
+		}`,
+		expected: "1 2",
+	},
+	{
+		name: "methods on non-struct types",
+		src: `
+		type Celsius float64
+
+		type Names []string
+
+		func (c Celsius) Fahrenheit() float64 { return float64(c)*9/5 + 32 }
+
+		func (n Names) Join(sep string, prefix ...string) string {
+			s := ""
+			for i, name := range n {
+				if i > 0 {
+					s += sep
+				}
+				for _, p := range prefix {
+					s += p
+				}
+				s += name
+			}
+			return s
+		}
+
+		func main() {
+			out.Print(Celsius(100).Fahrenheit(), " ", Names{"a", "b"}.Join(",", "-", "+"))
+		}`,
+		expected: "212 -+a,-+b",
+	},
+	{
+		name: "method values and expressions",
+		src: `
+		type T struct{ s string }
+
+		func (t T) Get(suffix string) string { return t.s + suffix }
+
+		func (t *T) Set(s string) { t.s = s }
+
+		func main() {
+			t := T{"a"}
+			get := t.Get
+			set := t.Set
+			set("b")
+			out.Print(get("!"), " ", t.Get("?"), " ", T.Get(t, "."), " ")
+			(*T).Set(&t, "c")
+			f := T.Get
+			out.Print(f(t, ";"))
+		}`,
+		expected: "a! b? b. c;",
+	},
+	{
+		name: "native interfaces",
+		src: `
+		type Color int
+
+		func (c Color) String() string { return [...]string{"red", "green"}[c] }
+
+		type NotFound struct{ name string }
+
+		func (e *NotFound) Error() string { return e.name + " not found" }
+
+		func find(name string) error {
+			return &NotFound{name}
+		}
+
+		func main() {
+			var s fmt.Stringer = Color(1)
+			out.Print(s.String(), " ", Color(0), " ", fmt.Sprintf("%v", s), " ")
+			err := find("x")
+			out.Print(out.Error(err), " ", err)
+		}`,
+		expected: "green red green error: x not found x not found",
+	},
+	{
+		name: "type assertions",
+		src: `
+		type Color int
+
+		func (c Color) String() string { return "color" }
+
+		type Code int
+
+		func main() {
+			var i interface{} = Color(1)
+			s, ok := i.(fmt.Stringer)
+			out.Print(s, " ", ok, " ")
+			i = Code(1)
+			_, ok = i.(fmt.Stringer)
+			out.Print(ok)
+		}`,
+		expected: "color true false",
+	},
+	{
+		name: "defer and go",
+		src: `
+		type Log struct{ s string }
+
+		func (l *Log) Write(s string) { l.s += s }
+
+		func (l Log) Print(done chan bool) { out.Print(l.s); done <- true }
+
+		func main() {
+			l := &Log{}
+			func() {
+				defer l.Write("b")
+				l.Write("a")
+			}()
+			done := make(chan bool)
+			go l.Print(done)
+			<-done
+		}`,
+		expected: "ab",
+	},
+	{
+		name: "methods calling methods",
+		src: `
+		type List []int
+
+		func (l List) Sum() int {
+			if len(l) == 0 {
+				return 0
+			}
+			return l[0] + l[1:].Sum()
+		}
+
+		func (l *List) Len() int { return l.count(0) }
+
+		func (l *List) count(n int) int {
+			if len(*l) == n {
+				return n
+			}
+			return l.count(n + 1)
+		}
+
+		func main() {
+			l := List{1, 2, 3}
+			out.Print(l.Sum(), " ", l.Len())
+		}`,
+		expected: "6 3",
+	},
+	{
+		name: "values made by new and make",
+		src: `
+		type Namer interface{ Name() string }
+
+		type S struct{ n int }
+
+		func (s *S) Name() string { return fmt.Sprint("S", s.n) }
+
+		type L []int
+
+		func (l L) Name() string { return fmt.Sprint("L", len(l)) }
+
+		func main() {
+			var x Namer = new(S)
+			out.Print(x.Name(), " ")
+			var i interface{} = new(S)
+			out.Print(i.(Namer).Name(), " ")
+			x = make(L, 2)
+			out.Print(x.Name())
+		}`,
+		expected: "S0 S0 L2",
+	},
+	{
+		name: "promoted methods",
+		src: `
+		type B struct{ name string }
+
+		func (b B) Hello() string { return "hello " + b.name }
+
+		func (b *B) Rename(name string) { b.name = name }
+
+		type C struct{ *B }
+
+		type D struct {
+			C
+			n int
+		}
+
+		func main() {
+			d := D{C: C{&B{"b"}}}
+			out.Print(d.Hello(), ", ")
+			d.Rename("c")
+			hello := d.Hello
+			p := &d
+			out.Print(hello(), ", ", p.Hello())
+		}`,
+		expected: "hello b, hello c, hello c",
+	},
+	{
+		name: "promoted methods implement interfaces",
+		src: `
+		type Namer interface{ Name() string }
+
+		type Setter interface{ Set(n string) }
+
+		type base struct{ n string }
+
+		func (b base) Name() string { return b.n }
+
+		func (b *base) Set(n string) { b.n = n }
+
+		func (b base) String() string { return "<" + b.n + ">" }
+
+		type V struct{ base }
+
+		type P struct{ *base }
+
+		type E struct {
+			V
+			n int
+		}
+
+		func main() {
+			var n Namer = V{base{"v"}}
+			var s Setter = &V{}
+			s.Set("w")
+			out.Print(n.Name(), " ", s.(Namer).Name(), " ")
+			p := P{&base{"p"}}
+			s = p
+			s.Set("q")
+			out.Print(p.Name(), " ")
+			n = E{V: V{base{"e"}}}
+			_, ok := n.(Setter)
+			var i interface{} = &E{}
+			_, ok2 := i.(Setter)
+			out.Print(n.Name(), " ", ok, " ", ok2, " ", fmt.Sprint(n, V{base{"f"}}))
+		}`,
+		expected: "v w q e false true <e> <f>",
+	},
+	{
+		name: "constant receivers",
+		src: `
+		type E int
+
+		func (e E) Next() E { return e + 1 }
+
+		const (
+			C1 E = 1
+			C2   = C1
+		)
+
+		func main() {
+			next := C2.Next
+			out.Print(int(C1.Next()), " ", int(next()), " ", int(E(5).Next()))
+		}`,
+		expected: "2 2 6",
+	},
+	{
+		name: "multiple values as arguments",
+		src: `
+		type T struct{ n int }
+
+		func (t *T) Pair() (int, string) { return t.n, "ab" }
+
+		func (t T) Sum(n int, s string) int { return t.n + n + len(s) }
+
+		func (t T) Add(ns ...int) int {
+			for _, n := range ns {
+				t.n += n
+			}
+			return t.n
+		}
+
+		func pair() (int, int) { return 2, 3 }
+
+		func main() {
+			t := &T{1}
+			out.Print(t.Sum(t.Pair()), " ", t.Add(pair()), " ", t.Add())
+		}`,
+		expected: "4 6 1",
+	},
+}
+
+func TestMethods(t *testing.T) {
+	for _, test := range methodsTests {
+		t.Run(test.name, func(t *testing.T) {
+			var out strings.Builder
+			src := "package main\n\nimport (\n\t\"fmt\"\n\t\"out\"\n)\n\nvar _ = fmt.Sprint\n" + test.src
+			opts := &scriggo.BuildOptions{AllowGoStmt: true, Packages: methodsPackages(&out)}
+			program, err := scriggo.Build(fstest.Files{"main.go": src}, opts)
+			if err != nil {
+				t.Fatalf("build error: %s", err)
+			}
+			err = program.Run(nil)
+			if err != nil {
+				t.Fatalf("run error: %s", err)
+			}
+			if out.String() != test.expected {
+				t.Fatalf("expected %q, got %q", test.expected, out.String())
+			}
+		})
+	}
+}
+
+func TestMethodsNilPointer(t *testing.T) {
+	src := "package main\n\ntype T int\n\nfunc (t T) M() {}\n\nfunc main() {\n\tvar p *T\n\tp.M()\n}\n"
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, nil)
+	if err != nil {
+		t.Fatalf("build error: %s", err)
+	}
+	err = program.Run(nil)
+	var e *scriggo.PanicError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected *scriggo.PanicError, got %v", err)
+	}
+	if msg := e.Error(); !strings.Contains(msg, "nil pointer dereference") {
+		t.Fatalf("unexpected panic %q", msg)
+	}
+}
+
+var methodsErrorTests = []struct {
+	src string
+	err string
+}{
+	{"type T int\nfunc (t T) M() {}\nfunc (t T) M() {}", "main:4:12: T.M redeclared in this block"},
+	{"type T int\nfunc (t *T) M() {}\nfunc (t *T) M() {}", "main:4:13: (*T).M redeclared in this block"},
+	{"type T int\nfunc (t T) M() {}\nfunc (t *T) M() {}", "main:4:13: method redeclared: T.M"},
+	{"type T struct{ M int }\nfunc (t T) M() {}", "main:3:12: type T has both field and method named M"},
+	{"func (s string) M() {}", "main:2:9: cannot define new methods on non-local type string"},
+	{"type P *int\nfunc (p P) M() {}", "main:3:9: invalid receiver type P (pointer or interface type)"},
+	{"type T int\nfunc (t T) M() {}\nfunc f() { T(1).N() }", "main:4:16: T(1).N undefined (type T has no field or method N)"},
+	{"type T int\nfunc (t *T) M() {}\nfunc f() { T(1).M() }", "main:4:16: cannot call pointer method on T(1)"},
+	{"type T int\nfunc (t T) M() {}\nfunc f() { _ = (*T).M }", "main:4:20: method expression (*T).M with value receiver is not supported in this release of Scriggo"},
+	{"type T int\nfunc (t *T) M() {}\nfunc f() { _ = T.M }", "main:4:17: invalid method expression T.M (needs pointer receiver: (*T).M)"},
+	{"type T int\nfunc (t T) M() {}\nfunc f(p **T) { p.M() }", "main:4:18: calling method M with receiver p (type **T) requires explicit dereference"},
+	{"type A int\nfunc (a A) M() {}\ntype B int\nfunc (b B) M() {}\ntype T struct{ A; B }\nfunc f() { T{}.M() }", "main:7:15: ambiguous selector T{}.M"},
+	{"type I interface{ M() }\ntype B int\nfunc (b *B) M() {}\ntype T struct{ B }\nvar _ I = T{}", "main:6:12: cannot use T{} (type T) as type I in assignment"},
+	{"type I interface{ M() }\ntype A int\nfunc (a A) M() {}\ntype B int\nfunc (b B) M() {}\ntype T struct{ A; B }\nvar _ I = T{}", "main:8:12: cannot use T{} (type T) as type I in assignment"},
+	{"type I interface{ M() }\ntype A int\nfunc (a A) M() {}\ntype T struct{ A; M int }\nvar _ I = T{}", "main:6:12: cannot use T{} (type T) as type I in assignment"},
+}
+
+func TestMethodsErrors(t *testing.T) {
+	for _, test := range methodsErrorTests {
+		src := "package main\n" + test.src + "\nfunc main() {}\n"
+		_, err := scriggo.Build(fstest.Files{"main.go": src}, nil)
+		if err == nil {
+			t.Errorf("source %q: expected error %q, got no error", test.src, test.err)
+			continue
+		}
+		if err.Error() != test.err {
+			t.Errorf("source %q: expected error %q, got %q", test.src, test.err, err)
+		}
+	}
+}
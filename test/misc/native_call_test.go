@@ -0,0 +1,199 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package misc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/internal/fstest"
+	"github.com/open2b/scriggo/native"
+)
+
+func TestOnNativeCall(t *testing.T) {
+
+	src := "package main\n\nimport \"db\"\n\nfunc main() {\n\tdefer func() { recover() }()\n\tdb.Join(\"a\", 1, 2)\n\tdb.Upper(\"b\")\n\tdb.Lookup(\"c\")\n\tdb.Upper(\"d\")\n}\n"
+	var lookups []string
+	packages := native.Packages{
+		"db": native.Package{
+			Name: "db",
+			Declarations: native.Declarations{
+				"Join": func(env native.Env, s string, n ...int) string {
+					return s + fmt.Sprint(n)
+				},
+				"Upper": func(s string) string {
+					return strings.ToUpper(s)
+				},
+				"Lookup": func(key string) string {
+					lookups = append(lookups, key)
+					return key
+				},
+			},
+		},
+	}
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, &scriggo.BuildOptions{Packages: packages})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls []scriggo.NativeCall
+	errDenied := errors.New("lookups are not allowed")
+	onNativeCall := func(call scriggo.NativeCall) error {
+		calls = append(calls, call)
+		if call.Package == "db" && call.Name == "Lookup" {
+			return errDenied
+		}
+		return nil
+	}
+	err = program.Run(&scriggo.RunOptions{OnNativeCall: onNativeCall})
+	var e *scriggo.NativeCallDeniedError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected *scriggo.NativeCallDeniedError, got %v", err)
+	}
+	if !errors.Is(err, errDenied) {
+		t.Fatalf("expected error to wrap the denial error, got %v", err)
+	}
+	if e.Package() != "db" || e.Name() != "Lookup" || e.Path() != "main" {
+		t.Fatalf("unexpected error %s %s %s", e.Package(), e.Name(), e.Path())
+	}
+	if pos := e.Position(); pos.Line != 9 || pos.Column != 11 {
+		t.Fatalf("expected position 9:11, got %s", pos)
+	}
+	if e.Error() != "call to db.Lookup denied: lookups are not allowed" {
+		t.Fatalf("unexpected error message %q", e.Error())
+	}
+	if lookups != nil {
+		t.Fatalf("expected no lookups, got %v", lookups)
+	}
+
+	expected := []scriggo.NativeCall{
+		{Package: "db", Name: "Join", Args: []interface{}{"a", []int{1, 2}}, Path: "main"},
+		{Package: "db", Name: "Upper", Args: []interface{}{"b"}, Path: "main"},
+		{Package: "db", Name: "Lookup", Args: []interface{}{"c"}, Path: "main"},
+	}
+	if len(calls) != len(expected) {
+		t.Fatalf("expected %d calls, got %d", len(expected), len(calls))
+	}
+	for i, call := range calls {
+		line := call.Position.Line
+		call.Position = scriggo.Position{}
+		if !reflect.DeepEqual(call, expected[i]) {
+			t.Fatalf("call %d: expected %#v, got %#v", i+1, expected[i], call)
+		}
+		if line != 7+i {
+			t.Fatalf("call %d: expected line %d, got %d", i+1, 7+i, line)
+		}
+	}
+
+	// Without a denial, all the functions are called.
+	calls = nil
+	err = program.Run(&scriggo.RunOptions{OnNativeCall: func(call scriggo.NativeCall) error {
+		calls = append(calls, call)
+		return nil
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(calls) != 4 || len(lookups) != 1 {
+		t.Fatalf("expected 4 calls and 1 lookup, got %d calls and %d lookups", len(calls), len(lookups))
+	}
+}
+
+func TestOnNativeCallMethodsAndDefer(t *testing.T) {
+
+	src := `package main
+
+import "db"
+
+func main() {
+	var b db.Builder
+	defer db.Upper("a")
+	b.WriteString("b")
+	defer b.WriteString("c")
+}
+`
+	packages := native.Packages{
+		"db": native.Package{
+			Name: "db",
+			Declarations: native.Declarations{
+				"Builder": reflect.TypeOf(strings.Builder{}),
+				"Upper":   strings.ToUpper,
+			},
+		},
+	}
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, &scriggo.BuildOptions{Packages: packages})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder := reflect.TypeOf(&strings.Builder{})
+	expected := []scriggo.NativeCall{
+		{Receiver: builder, Method: "WriteString", Args: []interface{}{"b"}, Path: "main"},
+		{Receiver: builder, Method: "WriteString", Args: []interface{}{"c"}, Path: "main"},
+		{Package: "db", Name: "Upper", Args: []interface{}{"a"}, Path: "main"},
+	}
+	lines := []int{8, 9, 7}
+
+	// The calls are the same also for a marshaled program.
+	data, err := program.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := scriggo.LoadProgram(bytes.NewReader(data), &scriggo.BuildOptions{Packages: packages})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []*scriggo.Program{program, loaded} {
+		var calls []scriggo.NativeCall
+		err = p.Run(&scriggo.RunOptions{OnNativeCall: func(call scriggo.NativeCall) error {
+			calls = append(calls, call)
+			return nil
+		}})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(calls) != len(expected) {
+			t.Fatalf("expected %d calls, got %d", len(expected), len(calls))
+		}
+		for i, call := range calls {
+			line := call.Position.Line
+			call.Position = scriggo.Position{}
+			if !reflect.DeepEqual(call, expected[i]) {
+				t.Fatalf("call %d: expected %#v, got %#v", i+1, expected[i], call)
+			}
+			if line != lines[i] {
+				t.Fatalf("call %d: expected line %d, got %d", i+1, lines[i], line)
+			}
+		}
+	}
+
+	// Deny the deferred method call.
+	errDenied := errors.New("not allowed")
+	err = program.Run(&scriggo.RunOptions{OnNativeCall: func(call scriggo.NativeCall) error {
+		if call.Method == "WriteString" && call.Args[0] == "c" {
+			return errDenied
+		}
+		return nil
+	}})
+	var e *scriggo.NativeCallDeniedError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected *scriggo.NativeCallDeniedError, got %v", err)
+	}
+	if e.Receiver() != builder || e.Method() != "WriteString" || e.Package() != "" || e.Name() != "" {
+		t.Fatalf("unexpected error %s %s %s %s", e.Receiver(), e.Method(), e.Package(), e.Name())
+	}
+	if pos := e.Position(); pos.Line != 9 || pos.Column != 2 {
+		t.Fatalf("expected position 9:2, got %s", pos)
+	}
+	if e.Error() != "call to (*strings.Builder).WriteString denied: not allowed" {
+		t.Fatalf("unexpected error message %q", e.Error())
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package misc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/internal/fstest"
+	"github.com/open2b/scriggo/native"
+)
+
+var optimizeProgramTests = []struct {
+	name     string
+	src      string
+	expected string
+}{
+	{"constants", `package main
+
+import "out"
+
+func main() {
+	a := 5
+	b := a * 3
+	if b == 15 {
+		out.Print("b is 15 ")
+	}
+	if b != 15 {
+		out.Print("b is not 15 ")
+	}
+	c := b / a << 2
+	out.Print(c, " ", b%4, " ", a-b)
+}
+`, "b is 15 12 3 -10"},
+	{"inlining", `package main
+
+import "out"
+
+func add(a, b int) int { return a + b }
+
+func twice(s string) string { return s + s }
+
+func half(f float64) float64 { return f / 2 }
+
+func main() {
+	n := 0
+	for i := 0; i < 5; i++ {
+		n = add(n, i)
+	}
+	out.Print(n, " ", twice("ab"), " ", half(3), " ", add(add(1, 2), add(3, 4)))
+}
+`, "10 abab 1.5 10"},
+	{"loops", `package main
+
+import "out"
+
+func main() {
+	s := []int{1, 2, 3, 4, 5, 6}
+	t := 0
+	for i, v := range s {
+		if i == 1 {
+			continue
+		}
+		if v == 5 {
+			break
+		}
+		t += v
+	}
+	for _, c := range "héllo" {
+		if c == 'l' {
+			t++
+		}
+	}
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			if j == 2 {
+				break
+			}
+			t += i * j
+		}
+	}
+	out.Print(t)
+}
+`, "13"},
+	{"select", `package main
+
+import "out"
+
+func send(c chan int, v int) { c <- v }
+
+func main() {
+	c := make(chan int, 1)
+	done := make(chan bool)
+	go func() {
+		send(c, 3)
+		done <- true
+	}()
+	<-done
+	for i := 0; i < 2; i++ {
+		select {
+		case v := <-c:
+			out.Print("received ", v, " ")
+		default:
+			out.Print("default ")
+		}
+	}
+}
+`, "received 3 default "},
+	{"panics", `package main
+
+import "out"
+
+func div(a, b int) int { return a / b }
+
+func main() {
+	defer func() {
+		out.Print("recovered: ", recover())
+	}()
+	z := 0
+	out.Print(div(6, 2), " ")
+	out.Print(div(1, z))
+}
+`, "3 recovered: runtime error: integer divide by zero"},
+}
+
+// TestOptimizeProgram tests that the programs have the same output with and
+// without the bytecode optimization.
+func TestOptimizeProgram(t *testing.T) {
+	for _, test := range optimizeProgramTests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, optimize := range []bool{false, true} {
+				var out strings.Builder
+				opts := &scriggo.BuildOptions{AllowGoStmt: true, Packages: methodsPackages(&out), Optimize: optimize}
+				program, err := scriggo.Build(fstest.Files{"main.go": test.src}, opts)
+				if err != nil {
+					t.Fatalf("optimize %t: build error: %s", optimize, err)
+				}
+				err = program.Run(nil)
+				if err != nil {
+					t.Fatalf("optimize %t: run error: %s", optimize, err)
+				}
+				if out.String() != test.expected {
+					t.Fatalf("optimize %t: expected %q, got %q", optimize, test.expected, out.String())
+				}
+			}
+		})
+	}
+}
+
+var optimizeTemplateTests = []struct {
+	name     string
+	files    fstest.Files
+	expected string
+}{
+	{"macros", fstest.Files{
+		"index.html": `{% macro B(s string) %}<b>{{ s }}</b>{% end %}{% macro I %}<i>i</i>{% end %}` +
+			`{% for i := 0; i < 3; i++ %}{{ B(itoa(i)) }}{{ I() }}{% end %} {{ B("a") }}`,
+	}, "<b>0</b><i>i</i><b>1</b><i>i</i><b>2</b><i>i</i> <b>a</b>"},
+	{"imported macros", fstest.Files{
+		"index.html": `{% import "imp.html" %}{% for _, s := range []string{"a", "b"} %}{{ Link(s) }}{% end %}`,
+		"imp.html":   `{% macro Link(s string) %}<a href="{{ s }}">{{ s }}</a>{% end %}`,
+	}, `<a href="a">a</a><a href="b">b</a>`},
+	{"converted macros", fstest.Files{
+		"index.html": `{% macro M %}<b>a</b>{% end %}{% macro S string %}<b>a</b>{% end %}{{ M() }} {{ S() }} {% s := M() %}{{ len(s) }}`,
+	}, "<b>a</b> &lt;b&gt;a&lt;/b&gt; 8"},
+	{"constants", fstest.Files{
+		"index.html": `{% n := 3 %}{% if n * 2 == 6 %}six{% else %}not six{% end %} {{ n + 4 }}`,
+	}, "six 7"},
+	{"layout", fstest.Files{
+		"index.html":  `{% extends "layout.html" %}{% macro Title %}T{% end %}{% macro Body %}{% for i := 0; i < 2; i++ %}{{ i }}{% end %}{% end %}`,
+		"layout.html": `<title>{{ Title() }}</title><body>{{ Body() }}</body>`,
+	}, "<title>T</title><body>01</body>"},
+}
+
+// TestOptimizeTemplate tests that the templates have the same output with
+// and without the bytecode optimization.
+func TestOptimizeTemplate(t *testing.T) {
+	globals := native.Declarations{
+		"itoa": func(i int) string { return string(rune('0' + i)) },
+	}
+	for _, test := range optimizeTemplateTests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, optimize := range []bool{false, true} {
+				opts := &scriggo.BuildOptions{Globals: globals, Optimize: optimize}
+				template, err := scriggo.BuildTemplate(test.files, "index.html", opts)
+				if err != nil {
+					t.Fatalf("optimize %t: build error: %s", optimize, err)
+				}
+				var b strings.Builder
+				err = template.Run(&b, nil, nil)
+				if err != nil {
+					t.Fatalf("optimize %t: run error: %s", optimize, err)
+				}
+				if b.String() != test.expected {
+					t.Fatalf("optimize %t: expected %q, got %q", optimize, test.expected, b.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package misc
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/internal/fstest"
+)
+
+func TestParseTemplate(t *testing.T) {
+	fsys := fstest.Files{
+		"index.html":   `{% extends "layout.html" %}{% import "macros.html" %}{% macro Body %}{{ undefined }}{% end %}`,
+		"layout.html":  `{{ Body() }}`,
+		"macros.html":  `{% import "fmt" %}{% macro M %}{{ render "partial.html" }}{% end %}`,
+		"partial.html": `{{ a }}`,
+		"error.html":   `{% if %}`,
+	}
+
+	// Parse expanding the files. Identifiers are not resolved and native
+	// packages are not required.
+	tree, err := scriggo.ParseTemplate(fsys, "index.html", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if tree.Path != "index.html" || tree.Format != ast.FormatHTML {
+		t.Fatalf("unexpected path %q and format %s", tree.Path, tree.Format)
+	}
+	extends, ok := tree.Nodes[0].(*ast.Extends)
+	if !ok {
+		t.Fatalf("expected *ast.Extends, got %T", tree.Nodes[0])
+	}
+	if extends.Tree == nil || extends.Tree.Path != "layout.html" {
+		t.Fatal("expected the extended file to be expanded")
+	}
+	imp := tree.Nodes[1].(*ast.Import)
+	if imp.Tree == nil || imp.Tree.Path != "macros.html" {
+		t.Fatal("expected the imported file to be expanded")
+	}
+	render := imp.Tree.Nodes[1].(*ast.Func).Body.Nodes[0].(*ast.Show).Expressions[0].(*ast.Render)
+	if render.Tree == nil || render.Tree.Path != "partial.html" {
+		t.Fatal("expected the rendered file to be expanded")
+	}
+
+	// Parse without expanding the files.
+	tree, err = scriggo.ParseTemplate(fsys, "index.html", &scriggo.ParseOptions{NoExpand: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n := tree.Nodes[0].(*ast.Extends); n.Path != "layout.html" || n.Tree != nil {
+		t.Fatal("expected the extended file not to be expanded")
+	}
+	if n := tree.Nodes[1].(*ast.Import); n.Path != "macros.html" || n.Tree != nil {
+		t.Fatal("expected the imported file not to be expanded")
+	}
+
+	// A syntax error.
+	_, err = scriggo.ParseTemplate(fsys, "error.html", nil)
+	var e *scriggo.BuildError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected *scriggo.BuildError, got %v", err)
+	}
+	if e.Path() != "error.html" || e.Position().String() != "1:7" {
+		t.Fatalf("unexpected error %q", err)
+	}
+
+	// A file that does not exist.
+	_, err = scriggo.ParseTemplate(fsys, "missing.html", nil)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected not exist error, got %v", err)
+	}
+}
+
+func TestParseProgram(t *testing.T) {
+	fsys := fstest.Files{
+		"go.mod":         "module example.com/hello",
+		"main.go":        "package main\n\nimport (\n\t\"fmt\"\n\t\"example.com/hello/greet\"\n)\n\nfunc main() { fmt.Println(greet.Hello(undefined)) }",
+		"greet/greet.go": "package greet\n\nfunc Hello(name string) string { return \"hello \" + name }",
+	}
+	tree, err := scriggo.ParseProgram(fsys)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pkg, ok := tree.Nodes[0].(*ast.Package)
+	if !ok {
+		t.Fatalf("expected *ast.Package, got %T", tree.Nodes[0])
+	}
+	if pkg.Name != "main" || len(pkg.Declarations) != 3 {
+		t.Fatalf("unexpected package %s with %d declarations", pkg.Name, len(pkg.Declarations))
+	}
+	if imp := pkg.Declarations[0].(*ast.Import); imp.Path != "fmt" || imp.Tree != nil {
+		t.Fatal("expected the native package not to be parsed")
+	}
+	if imp := pkg.Declarations[1].(*ast.Import); imp.Tree == nil || imp.Tree.Path != "example.com/hello/greet" {
+		t.Fatal("expected the package of the module to be parsed")
+	}
+
+	// A syntax error.
+	fsys["main.go"] = "package main\n\nfunc main() {"
+	_, err = scriggo.ParseProgram(fsys)
+	if _, ok := err.(*scriggo.BuildError); !ok {
+		t.Fatalf("expected *scriggo.BuildError, got %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package misc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/internal/fstest"
+	"github.com/open2b/scriggo/native"
+)
+
+func TestProfiler(t *testing.T) {
+
+	fsys := fstest.Files{
+		"index.html":  "{% import \"macros.html\" %}\n{% for i := 0; i < 10; i++ %}{{ M(i) }}{% end %}",
+		"macros.html": "{% macro M(n int) %}\n{% s := 0 %}\n{% for i := 0; i < n; i++ %}{% s += i %}{% end %}\n{{ s }}\n{% end %}",
+	}
+	template, err := scriggo.BuildTemplate(fsys, "index.html", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p scriggo.Profiler
+	for i := 0; i < 2; i++ {
+		err = template.Run(io.Discard, nil, &scriggo.RunOptions{Profiler: &p})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	functions := map[string]int64{}
+	for _, e := range p.Functions() {
+		functions[e.Func+" "+e.Path] = e.Instructions
+	}
+	if len(functions) != 2 || functions["main.main index.html"] == 0 || functions["main.M macros.html"] == 0 {
+		t.Fatalf("unexpected functions %v", functions)
+	}
+	if functions["main.M macros.html"] <= functions["main.main index.html"] {
+		t.Fatalf("expected more instructions in main.M, got %v", functions)
+	}
+
+	lines := map[string]bool{}
+	for _, e := range p.Lines() {
+		if e.Instructions == 0 {
+			t.Fatalf("unexpected zero instructions for %s %s:%d", e.Func, e.Path, e.Line)
+		}
+		lines[e.Path+":"+strconv.Itoa(e.Line)] = true
+	}
+	for _, line := range []string{"index.html:2", "macros.html:2", "macros.html:3", "macros.html:4"} {
+		if !lines[line] {
+			t.Fatalf("expected line %s, got %v", line, lines)
+		}
+	}
+
+	var b bytes.Buffer
+	err = p.WriteProfile(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := gzip.NewReader(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"instructions", "nanoseconds", "main.M", "macros.html"} {
+		if !bytes.Contains(data, []byte(s)) {
+			t.Fatalf("expected %q in the profile", s)
+		}
+	}
+}
+
+func TestProfilerNativeCallTime(t *testing.T) {
+	src := "package main\n\nimport \"clock\"\n\nfunc main() {\n\tfor i := 0; i < 3; i++ {\n\t\tclock.Sleep()\n\t}\n}\n"
+	packages := native.Packages{
+		"clock": native.Package{
+			Name: "clock",
+			Declarations: native.Declarations{
+				"Sleep": func() { time.Sleep(10 * time.Millisecond) },
+			},
+		},
+	}
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, &scriggo.BuildOptions{Packages: packages})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p scriggo.Profiler
+	err = program.Run(&scriggo.RunOptions{Profiler: &p})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := p.Lines()
+	if len(lines) == 0 || lines[0].Line != 7 {
+		t.Fatalf("expected line 7 as first line, got %v", lines)
+	}
+	if lines[0].Instructions != 3 {
+		t.Fatalf("expected 3 instructions, got %d", lines[0].Instructions)
+	}
+	if lines[0].Time < 25*time.Millisecond {
+		t.Fatalf("expected at least 25ms, got %s", lines[0].Time)
+	}
+}
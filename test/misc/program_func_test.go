@@ -0,0 +1,248 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package misc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/internal/fstest"
+	"github.com/open2b/scriggo/native"
+)
+
+const programFuncSource = `package main
+
+var inits = 0
+var factor = 2.0 * 1.5
+
+var calls int
+
+func init() {
+	inits++
+}
+
+type Points int
+
+func Score(p Points, bonus float64) float64 {
+	calls++
+	return float64(p)*factor + bonus
+}
+
+func Double(p Points) Points {
+	return p * 2
+}
+
+func Sum(prefix string, n ...int) (string, int) {
+	s := 0
+	for _, v := range n {
+		s += v
+	}
+	return prefix, s
+}
+
+func Stats() (int, int) {
+	return inits, calls
+}
+
+func Fail(msg string) {
+	panic(msg)
+}
+
+func main() {
+	calls = 100
+}
+`
+
+func TestProgramFunc(t *testing.T) {
+	program, err := scriggo.Build(fstest.Files{"main.go": programFuncSource}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	score, err := program.Func("Score")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score.Name() != "Score" {
+		t.Fatalf("expected name Score, got %s", score.Name())
+	}
+	if typ := score.Type().String(); typ != "func(int, float64) float64" {
+		t.Fatalf("unexpected type %s", typ)
+	}
+	for i := 1; i <= 3; i++ {
+		out, err := score.Call([]reflect.Value{reflect.ValueOf(i), reflect.ValueOf(0.5)}, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got, expected := out[0].Float(), float64(i)*3+0.5; got != expected {
+			t.Fatalf("expected %f, got %f", expected, got)
+		}
+	}
+	// Result with a type defined in the program.
+	double, err := program.Func("Double")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ := double.Type().String(); typ != "func(int) int" {
+		t.Fatalf("unexpected type %s", typ)
+	}
+	out, err := double.Call([]reflect.Value{reflect.ValueOf(4)}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out[0].Int() != 8 {
+		t.Fatalf("expected 8, got %v", out[0])
+	}
+	// Run does not share the package level variables with Func.
+	if err = program.Run(nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	stats, err := program.Func("Stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := stats.Value().Interface().(func() (int, int))
+	if inits, calls := f(); inits != 1 || calls != 3 {
+		t.Fatalf("expected 1 init and 3 calls, got %d inits and %d calls", inits, calls)
+	}
+	// Variadic function.
+	sum, err := program.Func("Sum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := sum.Value().Interface().(func(string, ...int) (string, int))
+	if prefix, s := fn("total", 1, 2, 3); prefix != "total" || s != 6 {
+		t.Fatalf("expected total 6, got %s %d", prefix, s)
+	}
+	out, err = sum.Call([]reflect.Value{reflect.ValueOf("n"), reflect.ValueOf([]int{5, 6})}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out[0].String() != "n" || out[1].Int() != 11 {
+		t.Fatalf("expected n 11, got %v %v", out[0], out[1])
+	}
+}
+
+func TestProgramFuncMarshalBinary(t *testing.T) {
+	program, err := scriggo.Build(fstest.Files{"main.go": programFuncSource}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := program.MarshalBinary()
+	if err != nil {
+		t.Fatalf("cannot marshal: %s", err)
+	}
+	program, err = scriggo.LoadProgram(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatalf("cannot load: %s", err)
+	}
+	score, err := program.Func("Score")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := score.Value().Interface().(func(int, float64) float64)
+	if s := f(2, 1); s != 7 {
+		t.Fatalf("expected 7, got %f", s)
+	}
+}
+
+func TestProgramFuncErrors(t *testing.T) {
+	program, err := scriggo.Build(fstest.Files{"main.go": programFuncSource}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"main", "init", "Missing", "calls"} {
+		_, err = program.Func(name)
+		if err == nil {
+			t.Fatalf("expected error for function %s, got no error", name)
+		}
+	}
+	score, err := program.Func("Score")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = score.Call([]reflect.Value{reflect.ValueOf(1)}, nil)
+	if err == nil || err.Error() != "scriggo: Score called with 1 arguments, want 2" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = score.Call([]reflect.Value{reflect.ValueOf("a"), reflect.ValueOf(0.5)}, nil)
+	if err == nil || err.Error() != "scriggo: cannot use string as type int in argument to Score" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fail, err := program.Func("Fail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fail.Call([]reflect.Value{reflect.ValueOf("boom")}, nil)
+	var p *scriggo.PanicError
+	if !errors.As(err, &p) {
+		t.Fatalf("expected *scriggo.PanicError, got %v", err)
+	}
+	if p.String() != "boom" {
+		t.Fatalf("expected panic message %q, got %q", "boom", p.String())
+	}
+}
+
+func TestProgramFuncInitError(t *testing.T) {
+	src := "package main\n\nvar s []int\n\nvar n = s[2]\n\nfunc N() int { return n }\n\nfunc main() {}\n"
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn, err := program.Func("N")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		_, err = fn.Call(nil, nil)
+		var p *scriggo.PanicError
+		if !errors.As(err, &p) {
+			t.Fatalf("expected *scriggo.PanicError, got %v", err)
+		}
+	}
+}
+
+func TestProgramFuncInitRetry(t *testing.T) {
+	src := "package main\n\nimport \"loop\"\n\nvar inits int\n\nfunc init() {\n\tfor i := 0; i < loop.N; i++ {\n\t}\n\tinits++\n}\n\nfunc Inits() int { return inits }\n\nfunc main() {}\n"
+	n := 1 << 40
+	packages := native.Packages{
+		"loop": native.Package{Name: "loop", Declarations: native.Declarations{"N": &n}},
+	}
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, &scriggo.BuildOptions{Packages: packages})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn, err := program.Func("Inits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The initialization fails because of the options.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = fn.Call(nil, &scriggo.RunOptions{Context: ctx})
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	_, err = fn.Call(nil, &scriggo.RunOptions{MaxInstructions: 100})
+	var e *scriggo.InstructionLimitError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected *scriggo.InstructionLimitError, got %v", err)
+	}
+	// The initialization is retried with the new options, and it is no
+	// longer executed after it succeeded.
+	n = 1
+	for i := 0; i < 2; i++ {
+		out, err := fn.Call(nil, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if inits := out[0].Int(); inits != 1 {
+			t.Fatalf("expected 1 initialization, got %d", inits)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package misc
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/internal/fstest"
+	"github.com/open2b/scriggo/native"
+)
+
+type runMacroProduct struct {
+	Name  string
+	Price float64
+}
+
+var runMacroFiles = fstest.Files{
+	"layout.html": `{% import "unused.html" %}<html>{{ Body() }}</html>`,
+	"unused.html": `{% var _ = fail() %}`,
+	"price.html":  `{% var currency = "€" %}{% macro Price(p float64) %}{{ p }} {{ currency }}{% end %}`,
+	"products.html": `{% extends "layout.html" %}{% import "price.html" %}
+{% var rows = 0 %}
+{% macro Body %}<table>{% for _, p := range products %}{{ ProductRow(p) }}{% end %}</table>{% end %}
+{% macro ProductRow(p product) %}{% rows++ %}<tr><td>{{ p.Name }}</td><td>{{ Price(p.Price) }}</td><td>{{ rows }}</td></tr>{% end %}
+{% macro row(n int) %}<tr>{{ n }}</tr>{% end %}`,
+	"page.html": `{% import "price.html" %}{{ fail() }}
+{% macro Total(t float64) %}<b>{{ title }}: {{ Price(t) }}</b>{% end %}
+{% macro Row(n int) %}{{ Total(float64(n)) }}{% end %}
+{{ Total(10) }}`,
+	"greet.html": `{% var unused = fail() %}{% var greeting = "Hello" %}{{ fail() }}
+{% macro Name(name string) %}<i>{{ name }}</i>{% end %}
+{%% greeting += "," %%}
+{% var separator = " " %}
+{% macro Greet(name string) %}{{ greeting }}{{ separator }}{{ Name(name) }}{% end %}
+{% macro Greetings(names ...string) %}{% for _, name := range names %}{{ Greet(name) }}. {% end %}{% end %}`,
+}
+
+func runMacroGlobals() native.Declarations {
+	return native.Declarations{
+		"product":  reflect.TypeOf(runMacroProduct{}),
+		"products": (*[]runMacroProduct)(nil),
+		"title":    (*string)(nil),
+		"fail": func() string {
+			panic("file executed")
+		},
+	}
+}
+
+func TestTemplateRunMacro(t *testing.T) {
+	options := &scriggo.BuildOptions{Globals: runMacroGlobals()}
+	template, err := scriggo.BuildTemplate(runMacroFiles, "products.html", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := map[string]interface{}{"products": []runMacroProduct{{"a", 1}, {"b", 2}}}
+	tests := []struct {
+		name     string
+		args     []interface{}
+		expected string
+	}{
+		{"ProductRow", []interface{}{runMacroProduct{"shoes", 25.5}}, "<tr><td>shoes</td><td>25.5 €</td><td>1</td></tr>"},
+		{"Body", nil, "<table><tr><td>a</td><td>1 €</td><td>1</td></tr><tr><td>b</td><td>2 €</td><td>2</td></tr></table>"},
+		{"row", []interface{}{3}, "<tr>3</tr>"},
+	}
+	for _, test := range tests {
+		for i := 0; i < 2; i++ {
+			var b strings.Builder
+			err = template.RunMacro(&b, test.name, test.args, vars, nil)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %s", test.name, err)
+			}
+			if b.String() != test.expected {
+				t.Fatalf("%s: expected output %q, got %q", test.name, test.expected, b.String())
+			}
+		}
+	}
+	// The template can be marshaled with its macros.
+	data, err := template.MarshalBinary()
+	if err != nil {
+		t.Fatalf("cannot marshal: %s", err)
+	}
+	template, err = scriggo.LoadTemplate(bytes.NewReader(data), options)
+	if err != nil {
+		t.Fatalf("cannot load: %s", err)
+	}
+	var b strings.Builder
+	err = template.RunMacro(&b, tests[0].name, tests[0].args, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if b.String() != tests[0].expected {
+		t.Fatalf("expected output %q, got %q", tests[0].expected, b.String())
+	}
+}
+
+func TestTemplateRunMacroNotExtending(t *testing.T) {
+	template, err := scriggo.BuildTemplate(runMacroFiles, "page.html", &scriggo.BuildOptions{Globals: runMacroGlobals()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	err = template.RunMacro(&b, "Total", []interface{}{12.5}, map[string]interface{}{"title": "Total"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := "<b>Total: 12.5 €</b>"; b.String() != expected {
+		t.Fatalf("expected output %q, got %q", expected, b.String())
+	}
+	// Row refers to the Total macro declared in the file.
+	b.Reset()
+	err = template.RunMacro(&b, "Row", []interface{}{1}, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := "<b>: 1 €</b>"; b.String() != expected {
+		t.Fatalf("expected output %q, got %q", expected, b.String())
+	}
+}
+
+func TestTemplateRunMacroSiblings(t *testing.T) {
+	template, err := scriggo.BuildTemplate(runMacroFiles, "greet.html", &scriggo.BuildOptions{Globals: runMacroGlobals()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		args     []interface{}
+		expected string
+	}{
+		{"Name", []interface{}{"Bob"}, "<i>Bob</i>"},
+		{"Greet", []interface{}{"Bob"}, "Hello <i>Bob</i>"},
+		{"Greetings", []interface{}{[]string{"Bob", "Alice"}}, "Hello <i>Bob</i>. Hello <i>Alice</i>. "},
+	}
+	for _, test := range tests {
+		var b strings.Builder
+		err = template.RunMacro(&b, test.name, test.args, nil, nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", test.name, err)
+		}
+		if b.String() != test.expected {
+			t.Fatalf("%s: expected output %q, got %q", test.name, test.expected, b.String())
+		}
+	}
+}
+
+func TestTemplateRunMacroErrors(t *testing.T) {
+	template, err := scriggo.BuildTemplate(runMacroFiles, "products.html", &scriggo.BuildOptions{Globals: runMacroGlobals()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		args     []interface{}
+		expected string
+	}{
+		{"Missing", nil, "scriggo: template does not declare macro Missing"},
+		{"Price", []interface{}{1.0}, "scriggo: template does not declare macro Price"},
+		{"row", nil, "scriggo: macro row called with 0 arguments, want 1"},
+		{"row", []interface{}{"a"}, "scriggo: cannot use string as type int in argument to macro row"},
+	}
+	for _, test := range tests {
+		err = template.RunMacro(&strings.Builder{}, test.name, test.args, nil, nil)
+		if err == nil || err.Error() != test.expected {
+			t.Fatalf("%s: expected error %q, got %v", test.name, test.expected, err)
+		}
+	}
+	// A panic in the macro.
+	template, err = scriggo.BuildTemplate(fstest.Files{
+		"index.html": `{% macro M(s []int) %}{{ s[1] }}{% end %}`,
+	}, "index.html", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = template.RunMacro(&strings.Builder{}, "M", []interface{}{[]int{1}}, nil, nil)
+	var p *scriggo.PanicError
+	if !errors.As(err, &p) {
+		t.Fatalf("expected *scriggo.PanicError, got %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package misc
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/internal/fstest"
+	"github.com/open2b/scriggo/native"
+)
+
+func TestPanicErrorStackTrace(t *testing.T) {
+
+	// Template.
+	fsys := fstest.Files{
+		"index.html":  "{% import \"macros.html\" %}\n{{ M(0) }}",
+		"macros.html": "{% macro M(n int) %}{{ N(n) }}{% end %}\n{% macro N(n int) %}{{ 1 / n }}{% end %}",
+	}
+	template, err := scriggo.BuildTemplate(fsys, "index.html", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = template.Run(io.Discard, nil, nil)
+	var p *scriggo.PanicError
+	if !errors.As(err, &p) {
+		t.Fatalf("expected *scriggo.PanicError, got %v", err)
+	}
+	expected := []scriggo.StackFrame{
+		{Func: "main.N", Macro: true, Path: "macros.html", Position: scriggo.Position{Line: 2, Column: 26, Start: 63, End: 67}},
+		{Func: "main.M", Macro: true, Path: "macros.html", Position: scriggo.Position{Line: 1, Column: 25, Start: 23, End: 26}},
+		{Func: "main.main", Macro: true, Path: "index.html", Position: scriggo.Position{Line: 2, Column: 5, Start: 30, End: 33}},
+	}
+	testStackTrace(t, p.StackTrace(), expected)
+
+	// Program with a panic in a native function.
+	fsys = fstest.Files{
+		"main.go": "package main\n\nimport \"p\"\n\nfunc main() {\n\tfunc() {\n\t\tp.F()\n\t}()\n}\n",
+	}
+	packages := native.Packages{
+		"p": native.Package{
+			Name:         "p",
+			Declarations: native.Declarations{"F": func() { panic("boom") }},
+		},
+	}
+	program, err := scriggo.Build(fsys, &scriggo.BuildOptions{Packages: packages})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = program.Run(nil)
+	if !errors.As(err, &p) {
+		t.Fatalf("expected *scriggo.PanicError, got %v", err)
+	}
+	expected = []scriggo.StackFrame{
+		{Func: "p.F", Native: true},
+		{Func: "main.main.func", Path: "main", Position: scriggo.Position{Line: 7, Column: 6, Start: 52, End: 56}},
+		{Func: "main.main", Path: "main", Position: scriggo.Position{Line: 8, Column: 3, Start: 41, End: 61}},
+	}
+	testStackTrace(t, p.StackTrace(), expected)
+}
+
+var panicErrorPositionTests = []struct {
+	name string
+	src  string
+	line int
+	col  int
+}{
+	{"index", "s := []int{1}\n\ti := 2\n\t_ = s[i]", 6, 7},
+	{"divide", "a, b := 1, 0\n\t_ = a / b", 5, 8},
+	{"nil map", "var m map[string]int\n\tm[\"a\"] = 1", 5, 3},
+	{"type assertion", "var i interface{} = 1\n\t_ = i.(string)", 5, 7},
+}
+
+func TestPanicErrorPosition(t *testing.T) {
+	for _, test := range panicErrorPositionTests {
+		t.Run(test.name, func(t *testing.T) {
+			src := "package main\n\nfunc main() {\n\t" + test.src + "\n}\n"
+			program, err := scriggo.Build(fstest.Files{"main.go": src}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = program.Run(nil)
+			var p *scriggo.PanicError
+			if !errors.As(err, &p) {
+				t.Fatalf("expected *scriggo.PanicError, got %v", err)
+			}
+			if pos := p.Position(); pos.Line != test.line || pos.Column != test.col {
+				t.Fatalf("expected position %d:%d, got %d:%d", test.line, test.col, pos.Line, pos.Column)
+			}
+			if pos := p.StackTrace()[0].Position; pos.Line != test.line || pos.Column != test.col {
+				t.Fatalf("expected stack trace position %d:%d, got %d:%d", test.line, test.col, pos.Line, pos.Column)
+			}
+		})
+	}
+}
+
+func testStackTrace(t *testing.T, got, expected []scriggo.StackFrame) {
+	t.Helper()
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d frames, got %d: %#v", len(expected), len(got), got)
+	}
+	for i, frame := range got {
+		if frame != expected[i] {
+			t.Fatalf("frame %d: expected %#v, got %#v", i, expected[i], frame)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2022 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package misc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/internal/fstest"
+	"github.com/open2b/scriggo/native"
+)
+
+// stubsCalls counts the calls made with the stubs.
+var stubsCalls int
+
+// stubsNotified receives the values passed to stubsNotify.
+var stubsNotified = make(chan int, 1)
+
+func stubsScale(x float64, n int) (float64, bool) {
+	return x * float64(n), n > 0
+}
+
+func stubsNotify(n int) {
+	stubsNotified <- n
+}
+
+func stubsApply(f func(int) int, n int) int {
+	return f(n)
+}
+
+type stubsCounter struct{ n int }
+
+func (c *stubsCounter) Add(n int) int { c.n += n; return c.n }
+func (c stubsCounter) Value() int     { return c.n }
+
+// The stubs are written as they are generated by 'scriggo import -stubs'.
+func init() {
+	native.RegisterFuncStub(stubsScale, func(r *native.Registers) {
+		stubsCalls++
+		v0, v1 := stubsScale(r.Float[1], int(r.Int[1]))
+		r.Float[0] = v0
+		if v1 {
+			r.Int[0] = 1
+		} else {
+			r.Int[0] = 0
+		}
+	})
+	native.RegisterFuncStub(stubsNotify, func(r *native.Registers) {
+		stubsCalls++
+		stubsNotify(int(r.Int[0]))
+	})
+	native.RegisterMethodStub(reflect.TypeOf((*stubsCounter)(nil)), "Add", func(r *native.Registers) {
+		stubsCalls++
+		v0 := r.Receiver.(*stubsCounter).Add(int(r.Int[1]))
+		r.Int[0] = int64(v0)
+	})
+	native.RegisterMethodStub(reflect.TypeOf((*stubsCounter)(nil)).Elem(), "Value", func(r *native.Registers) {
+		stubsCalls++
+		v0 := r.Receiver.(stubsCounter).Value()
+		r.Int[0] = int64(v0)
+	})
+	native.RegisterMethodStub(reflect.TypeOf((*stubsCounter)(nil)), "Value", func(r *native.Registers) {
+		stubsCalls++
+		v0 := r.Receiver.(*stubsCounter).Value()
+		r.Int[0] = int64(v0)
+	})
+}
+
+// stubsPackages returns the packages used by the stubs tests.
+func stubsPackages(out *strings.Builder) native.Packages {
+	packages := methodsPackages(out)
+	packages["stubs"] = native.Package{
+		Name: "stubs",
+		Declarations: native.Declarations{
+			"Apply":   stubsApply,
+			"Counter": reflect.TypeOf(stubsCounter{}),
+			"Notify":  stubsNotify,
+			"Scale":   stubsScale,
+		},
+	}
+	return packages
+}
+
+var stubsProgramTests = []struct {
+	name     string
+	src      string
+	expected string
+	calls    int
+}{
+	{"function", `package main
+
+import (
+	"out"
+	"stubs"
+)
+
+func main() {
+	x, ok := stubs.Scale(1.5, 3)
+	out.Print(x, " ", ok)
+	scale := stubs.Scale
+	x, ok = scale(2, -1)
+	out.Print(" ", x, " ", ok)
+}
+`, "4.5 true -2 false", 2},
+	{"method", `package main
+
+import (
+	"out"
+	"stubs"
+)
+
+func main() {
+	var c stubs.Counter
+	c.Add(2)
+	p := &c
+	out.Print(p.Add(3), " ", c.Value(), " ", p.Value())
+}
+`, "5 5 5", 4},
+	{"method value", `package main
+
+import (
+	"out"
+	"stubs"
+)
+
+func main() {
+	c := &stubs.Counter{}
+	add := c.Add
+	add(4)
+	value := c.Value
+	out.Print(add(1), " ", value(), " ", stubs.Apply(add, 2), " ", c.Value())
+}
+`, "5 5 7 7", 4},
+}
+
+// TestStubs tests the calls of native functions and methods with stubs.
+func TestStubs(t *testing.T) {
+	for _, test := range stubsProgramTests {
+		t.Run(test.name, func(t *testing.T) {
+			var out strings.Builder
+			program, err := scriggo.Build(fstest.Files{"main.go": test.src}, &scriggo.BuildOptions{Packages: stubsPackages(&out)})
+			if err != nil {
+				t.Fatalf("build error: %s", err)
+			}
+			stubsCalls = 0
+			err = program.Run(nil)
+			if err != nil {
+				t.Fatalf("run error: %s", err)
+			}
+			if out.String() != test.expected {
+				t.Fatalf("expected %q, got %q", test.expected, out.String())
+			}
+			if stubsCalls != test.calls {
+				t.Fatalf("expected %d calls with stubs, got %d", test.calls, stubsCalls)
+			}
+		})
+	}
+}
+
+// TestStubsFallback tests that the functions with stubs are called with
+// reflect when a stub cannot be used.
+func TestStubsFallback(t *testing.T) {
+	src := `package main
+
+import (
+	"out"
+	"stubs"
+)
+
+func main() {
+	x, _ := stubs.Scale(2, 2)
+	c := &stubs.Counter{}
+	add := c.Add
+	out.Print(x, " ", add(3))
+	go stubs.Notify(5)
+}
+`
+	var out strings.Builder
+	opts := &scriggo.BuildOptions{AllowGoStmt: true, Packages: stubsPackages(&out)}
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls []string
+	stubsCalls = 0
+	err = program.Run(&scriggo.RunOptions{OnNativeCall: func(call scriggo.NativeCall) error {
+		if call.Method != "" {
+			calls = append(calls, call.Receiver.String()+"."+call.Method)
+		} else {
+			calls = append(calls, call.Package+"."+call.Name)
+		}
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := <-stubsNotified; n != 5 {
+		t.Fatalf("expected 5, got %d", n)
+	}
+	if expected := "4 3"; out.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, out.String())
+	}
+	if stubsCalls != 0 {
+		t.Fatalf("expected no calls with stubs, got %d", stubsCalls)
+	}
+	if expected := []string{"stubs.Scale", "*misc.stubsCounter.Add", "out.Print", "stubs.Notify"}; !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("expected calls %v, got %v", expected, calls)
+	}
+}
@@ -861,6 +861,22 @@ var templateMultiFileCases = map[string]struct {
 		expectedOut: `42`,
 	},
 
+	"Reading an initialized global variable from a function literal": {
+		sources: fstest.Files{
+			"index.txt": `{{ func() int { return initMainVar }() }}`,
+		},
+		main: native.Package{
+			Name: "main",
+			Declarations: native.Declarations{
+				"initMainVar": (*int)(nil),
+			},
+		},
+		vars: map[string]interface{}{
+			"initMainVar": 42,
+		},
+		expectedOut: `42`,
+	},
+
 	"Calling a global function": {
 		sources: fstest.Files{
 			"index.txt": `{{ lowercase("HellO ScrIgGo!") }}{% x := "A String" %}{{ lowercase(x) }}`,